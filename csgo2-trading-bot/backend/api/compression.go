@@ -0,0 +1,175 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	gzipPool = sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	}}
+	// 在线压缩用较低等级，压缩率接近gzip -9而CPU开销小得多
+	brotliPool = sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(io.Discard, 4)
+	}}
+)
+
+// CompressionMiddleware 按Accept-Encoding对响应进行brotli或gzip压缩，小于minSize的响应不压缩
+func CompressionMiddleware(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead || c.GetHeader("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minSize: minSize}
+		c.Writer = w
+		c.Header("Vary", "Accept-Encoding")
+		defer w.finish()
+
+		c.Next()
+	}
+}
+
+// negotiateEncoding 选择客户端支持的编码，优先brotli
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if len(fields) > 1 && strings.ReplaceAll(fields[1], " ", "") == "q=0" {
+			continue
+		}
+		accepted[name] = true
+	}
+
+	switch {
+	case accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressWriter 先缓冲到minSize再决定是否压缩
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+	buf      []byte
+	encoder  io.WriteCloser
+	skip     bool
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.encoder != nil {
+		return w.encoder.Write(data)
+	}
+	if w.skip {
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buf = append(w.buf, data...)
+	if len(w.buf) >= w.minSize {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 推送已压缩的数据
+func (w *compressWriter) Flush() {
+	if w.encoder == nil && !w.skip {
+		w.start()
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// start 根据响应头决定压缩或直接输出，并写出缓冲区
+func (w *compressWriter) start() error {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || !compressible(header.Get("Content-Type")) ||
+		w.Status() == http.StatusNoContent || w.Status() == http.StatusNotModified {
+		w.skip = true
+	} else {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+
+		switch w.encoding {
+		case "br":
+			bw := brotliPool.Get().(*brotli.Writer)
+			bw.Reset(w.ResponseWriter)
+			w.encoder = bw
+		default:
+			gw := gzipPool.Get().(*gzip.Writer)
+			gw.Reset(w.ResponseWriter)
+			w.encoder = gw
+		}
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// finish 请求结束时输出剩余数据并归还编码器
+func (w *compressWriter) finish() {
+	if w.encoder == nil {
+		if len(w.buf) > 0 {
+			w.ResponseWriter.Write(w.buf)
+		}
+		return
+	}
+
+	w.encoder.Close()
+	switch e := w.encoder.(type) {
+	case *brotli.Writer:
+		brotliPool.Put(e)
+	case *gzip.Writer:
+		gzipPool.Put(e)
+	}
+	w.encoder = nil
+}
+
+// compressible 只压缩文本类响应，图片等已压缩格式直接输出
+func compressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range []string{"application/json", "text/", "application/javascript", "image/svg+xml", "application/xml"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// benchTrends 与market.GetMarketTrends结构相同的趋势数据：涨幅、跌幅、热度各10件物品和市场总览
+func benchTrends() map[string]interface{} {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	list := func(kind string) []models.Item {
+		items := make([]models.Item, 10)
+		for i := range items {
+			name := fmt.Sprintf("%s | Bench Skin %d (Field-Tested)", kind, i)
+			items[i] = models.Item{
+				MarketHashName: name,
+				Name:           name,
+				Type:           "Rifle",
+				Rarity:         "Classified",
+				Quality:        "Normal",
+				Exterior:       "Field-Tested",
+				Collection:     "The Bench Collection",
+				IconURL:        "https://community.akamai.steamstatic.com/economy/image/-9a81dlWLwJ2UUGcVs_nsVtzdOEdtWwKGZZLQHTxDZ7I56KU0Zwwo4NUX4oFJZEHLbXH5ApeO4YmlhxYQknCRvCo04DEVlxkKgpot7HxfDhjxszJemkV09-5lpKKqPrxN7LEmyVQ7MEpiLuSrYmnjQO3-UdsZGHyd4_Bd1RvNQ7T_FDrw-_ng5Pu75iY1zI97bhLsvQz",
+				Popularity:     float64(i) * 1.7,
+				CurrentPrice:   10 + float64(i)*3.25,
+				AvgPrice7Days:  9.5 + float64(i)*3.1,
+				AvgPrice30Days: 9 + float64(i)*3,
+				Volume24h:      100 + i*13,
+				LastUpdated:    now,
+			}
+		}
+		return items
+	}
+	return map[string]interface{}{
+		"rising_items":  list("AK-47"),
+		"falling_items": list("M4A4"),
+		"popular_items": list("AWP"),
+		"overview": map[string]interface{}{
+			"total_items":      21000,
+			"total_volume_24h": 1840000,
+			"avg_price":        37.42,
+			"median_price":     3.18,
+		},
+	}
+}
+
+// BenchmarkCompressionMiddleware 压缩趋势接口大小的JSON响应，B/s按压缩前的大小计算，wire-B/op为实际发送的字节数
+func BenchmarkCompressionMiddleware(b *testing.B) {
+	gin.SetMode(gin.ReleaseMode)
+	body, err := json.Marshal(benchTrends())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, encoding := range []string{"identity", "gzip", "br"} {
+		b.Run(encoding, func(b *testing.B) {
+			router := gin.New()
+			router.Use(CompressionMiddleware(1024))
+			router.GET("/trends", func(c *gin.Context) {
+				c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+			})
+			benchServe(b, router, encoding, len(body))
+		})
+	}
+}
+
+// BenchmarkMarketTrendsResponse 每次请求序列化趋势数据与直接输出预先序列化的结果，两者都经过gzip压缩
+func BenchmarkMarketTrendsResponse(b *testing.B) {
+	gin.SetMode(gin.ReleaseMode)
+	trends := benchTrends()
+	data, err := json.Marshal(trends)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	handlers := []struct {
+		name    string
+		handler gin.HandlerFunc
+	}{
+		{"marshal", func(c *gin.Context) { c.JSON(http.StatusOK, trends) }},
+		{"premarshaled", func(c *gin.Context) { c.Data(http.StatusOK, "application/json; charset=utf-8", data) }},
+	}
+	for _, h := range handlers {
+		b.Run(h.name, func(b *testing.B) {
+			router := gin.New()
+			router.Use(CompressionMiddleware(1024))
+			router.GET("/trends", h.handler)
+			benchServe(b, router, "gzip", len(data))
+		})
+	}
+}
+
+func benchServe(b *testing.B, handler http.Handler, encoding string, size int) {
+	req := httptest.NewRequest(http.MethodGet, "/trends", nil)
+	if encoding != "identity" {
+		req.Header.Set("Accept-Encoding", encoding)
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	var wire int
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			b.Fatalf("status %d", w.Code)
+		}
+		if encoding != "identity" && w.Header().Get("Content-Encoding") != encoding {
+			b.Fatalf("response is not %s encoded", encoding)
+		}
+		wire = w.Body.Len()
+	}
+	b.ReportMetric(float64(wire), "wire-B/op")
+}
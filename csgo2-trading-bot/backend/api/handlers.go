@@ -1,13 +1,48 @@
 package api
 
 import (
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"net/http/pprof"
 	"strconv"
+	"strings"
+	"time"
 
 	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/activity"
+	"csgo2-trading-bot/services/admin"
+	"csgo2-trading-bot/services/alerts"
+	"csgo2-trading-bot/services/analytics"
+	"csgo2-trading-bot/services/appraisal"
+	"csgo2-trading-bot/services/audit"
 	"csgo2-trading-bot/services/auth"
+	"csgo2-trading-bot/services/catalog"
+	"csgo2-trading-bot/services/depth"
+	"csgo2-trading-bot/services/email"
+	"csgo2-trading-bot/services/exports"
+	"csgo2-trading-bot/services/fx"
+	"csgo2-trading-bot/services/inspect"
 	"csgo2-trading-bot/services/market"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/outbox"
+	"csgo2-trading-bot/services/platformsession"
+	"csgo2-trading-bot/services/popularity"
+	"csgo2-trading-bot/services/profiling"
+	"csgo2-trading-bot/services/proxypool"
+	"csgo2-trading-bot/services/ratelimit"
+	"csgo2-trading-bot/services/retention"
+	"csgo2-trading-bot/services/storage"
+	"csgo2-trading-bot/services/system"
+	"csgo2-trading-bot/services/telegram"
 	"csgo2-trading-bot/services/trading"
+	"csgo2-trading-bot/services/verify"
+	"csgo2-trading-bot/services/views"
+	"csgo2-trading-bot/services/watch"
+	"csgo2-trading-bot/services/webhooks"
+	"csgo2-trading-bot/services/wechat"
+	"csgo2-trading-bot/websocket"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,7 +58,7 @@ func SteamLogin(authService *auth.Service) gin.HandlerFunc {
 	}
 }
 
-func SteamCallback(authService *auth.Service) gin.HandlerFunc {
+func SteamCallback(authService *auth.Service, auditService *audit.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 获取OpenID参数
 		query := c.Request.URL.Query()
@@ -35,20 +70,59 @@ func SteamCallback(authService *auth.Service) gin.HandlerFunc {
 			return
 		}
 
-		// 生成JWT
-		token, err := authService.GenerateJWT(user)
+		// 记录登录设备，新设备登录时通知用户
+		authService.RecordLogin(user.ID, c.Request.UserAgent(), c.ClientIP())
+		auditService.Log(audit.Entry{
+			ActorID:    &user.ID,
+			UserID:     &user.ID,
+			Action:     "auth.login",
+			EntityType: "user",
+			EntityID:   user.ID,
+			Details:    gin.H{"method": "steam", "user_agent": c.Request.UserAgent()},
+			IP:         c.ClientIP(),
+		})
+
+		// 签发访问令牌和刷新令牌
+		tokens, err := authService.IssueTokens(c.Request.Context(), user, c.Request.UserAgent(), c.ClientIP())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"token": token,
-			"user":  user,
+			"token":         tokens.Token,
+			"expires_at":    tokens.ExpiresAt,
+			"refresh_token": tokens.RefreshToken,
+			"user":          user,
 		})
 	}
 }
 
+// RefreshToken 用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+func RefreshToken(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			RefreshToken string `json:"refresh_token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		tokens, err := authService.RefreshTokens(c.Request.Context(), req.RefreshToken, c.ClientIP())
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to refresh token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
 func VerifyToken(authService *auth.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
@@ -73,15 +147,105 @@ func VerifyToken(authService *auth.Service) gin.HandlerFunc {
 	}
 }
 
-func Logout(authService *auth.Service) gin.HandlerFunc {
+// Logout 吊销当前会话，会话的访问令牌和刷新令牌立即失效
+func Logout(authService *auth.Service, auditService *audit.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 清除会话（如果使用）
+		claims, ok := c.Get("claims")
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "logout requires a login session"})
+			return
+		}
+		if err := authService.Logout(c.Request.Context(), claims.(*auth.JWTClaims)); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to revoke session"})
+			return
+		}
+		auditService.Log(auditEntry(c, "auth.logout", "user", c.GetUint("user_id"), nil, nil))
+
 		c.JSON(http.StatusOK, gin.H{
 			"message": "logged out successfully",
 		})
 	}
 }
 
+// RevokeAllTokens 吊销用户的全部会话，用于令牌泄露后让所有设备重新登录
+func RevokeAllTokens(authService *auth.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		if err := authService.RevokeAllTokens(c.Request.Context(), userID); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to revoke tokens"})
+			return
+		}
+		auditService.Log(auditEntry(c, "auth.revoke_all", "user", userID, nil, nil))
+
+		c.JSON(http.StatusOK, gin.H{"message": "all sessions revoked successfully"})
+	}
+}
+
+// currentSessionID 发起请求的登录会话，API Key请求为空
+func currentSessionID(c *gin.Context) string {
+	if claims, ok := c.Get("claims"); ok {
+		return claims.(*auth.JWTClaims).SessionID
+	}
+	return ""
+}
+
+// GetSessions 用户当前有效的登录会话
+func GetSessions(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		sessions, err := authService.ListSessions(userID, currentSessionID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+	}
+}
+
+// RevokeSession 吊销单个会话，对应设备需要重新登录
+func RevokeSession(authService *auth.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+			return
+		}
+
+		session, err := authService.RevokeSession(c.Request.Context(), userID, uint(sessionID))
+		if err != nil {
+			if errors.Is(err, auth.ErrSessionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to revoke session"})
+			return
+		}
+		auditService.Log(auditEntry(c, "auth.session_revoke", "session", session.ID, session, nil))
+
+		c.JSON(http.StatusOK, gin.H{"message": "session revoked successfully"})
+	}
+}
+
+// RevokeOtherSessions 吊销除当前会话以外的全部会话
+func RevokeOtherSessions(authService *auth.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		revoked, err := authService.RevokeOtherSessions(c.Request.Context(), userID, currentSessionID(c))
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to revoke sessions"})
+			return
+		}
+		auditService.Log(auditEntry(c, "auth.session_revoke_others", "user", userID, nil, gin.H{"revoked": revoked}))
+
+		c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+	}
+}
+
 // Market Handlers
 
 func GetMarketItems(marketService *market.Service) gin.HandlerFunc {
@@ -96,6 +260,38 @@ func GetMarketItems(marketService *market.Service) gin.HandlerFunc {
 		if rarity := c.Query("rarity"); rarity != "" {
 			filters["rarity"] = rarity
 		}
+		if text := c.Query("q"); text != "" {
+			filters["q"] = text
+		}
+		if trend := c.Query("trend"); trend != "" {
+			filters["trend"] = trend
+		}
+		if exterior := c.Query("exterior"); exterior != "" {
+			filters["exterior"] = exterior
+		}
+		if paintIndex := c.Query("paint_index"); paintIndex != "" {
+			if index, err := strconv.Atoi(paintIndex); err == nil {
+				filters["paint_index"] = index
+			}
+		}
+		if minFloat := c.Query("min_float"); minFloat != "" {
+			if value, err := strconv.ParseFloat(minFloat, 64); err == nil {
+				filters["min_float"] = value
+			}
+		}
+		if maxFloat := c.Query("max_float"); maxFloat != "" {
+			if value, err := strconv.ParseFloat(maxFloat, 64); err == nil {
+				filters["max_float"] = value
+			}
+		}
+		if minPopularity := c.Query("min_popularity"); minPopularity != "" {
+			if value, err := strconv.ParseFloat(minPopularity, 64); err == nil {
+				filters["min_popularity"] = value
+			}
+		}
+		if sort := c.Query("sort"); sort != "" {
+			filters["sort"] = sort
+		}
 		if minPrice := c.Query("min_price"); minPrice != "" {
 			if price, err := strconv.ParseFloat(minPrice, 64); err == nil {
 				filters["min_price"] = price
@@ -122,6 +318,66 @@ func GetMarketItems(marketService *market.Service) gin.HandlerFunc {
 	}
 }
 
+func GetItemFull(marketService *market.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		itemID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item id"})
+			return
+		}
+
+		full, err := marketService.GetItemFull(uint(itemID), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "item not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, full)
+	}
+}
+
+func ComparePrices(marketService *market.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var itemIDs []uint
+		for _, v := range splitQuery(c.Query("item_ids")) {
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item id: " + v})
+				return
+			}
+			itemIDs = append(itemIDs, uint(id))
+		}
+		if len(itemIDs) == 0 || len(itemIDs) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "item_ids must contain 1-100 ids"})
+			return
+		}
+
+		currency := strings.ToUpper(c.Query("currency"))
+		rows, platforms, err := marketService.ComparePrices(itemIDs, currency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if currency == "" {
+			currency = marketService.BaseCurrency()
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"currency":  currency,
+			"platforms": platforms,
+			"items":     rows,
+		})
+	}
+}
+
+// GetFXRates 当前使用的汇率
+func GetFXRates(fxService *fx.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, fxService.Snapshot())
+	}
+}
+
 func GetItemDetails(marketService *market.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		itemID, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -150,6 +406,39 @@ func GetPriceHistory(marketService *market.Service) gin.HandlerFunc {
 
 		days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
 
+		// 图表标记（成交、策略操作、事件标注）随价格数据一起返回，annotations=false时跳过
+		markers := []market.Marker{}
+		if c.Query("annotations") != "false" {
+			markers, err = marketService.GetChartMarkers(uint(itemID), c.GetUint("user_id"), time.Now().AddDate(0, 0, -days))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// 指定interval时返回聚合后的K线，避免长周期返回海量原始数据
+		if v := c.Query("interval"); v != "" {
+			interval, err := time.ParseDuration(v)
+			if err != nil || interval < time.Minute {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval"})
+				return
+			}
+
+			buckets, err := marketService.GetPriceBuckets(uint(itemID), c.Query("platform"), days, interval)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"buckets":  buckets,
+				"markers":  markers,
+				"days":     days,
+				"interval": v,
+			})
+			return
+		}
+
 		history, err := marketService.GetPriceHistory(uint(itemID), days)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -158,6 +447,7 @@ func GetPriceHistory(marketService *market.Service) gin.HandlerFunc {
 
 		c.JSON(http.StatusOK, gin.H{
 			"history": history,
+			"markers": markers,
 			"days":    days,
 		})
 	}
@@ -165,278 +455,3638 @@ func GetPriceHistory(marketService *market.Service) gin.HandlerFunc {
 
 func GetMarketTrends(marketService *market.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		trends, err := marketService.GetMarketTrends()
+		data, err := marketService.GetMarketTrendsJSON()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, trends)
+		c.Data(http.StatusOK, "application/json; charset=utf-8", data)
 	}
 }
 
-// Trading Handlers
-
-func GetInventory(tradingService *trading.Service) gin.HandlerFunc {
+// GetItemPopularity 物品每日社区提及数和热度
+func GetItemPopularity(popularityService *popularity.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetUint("user_id")
+		itemID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item id"})
+			return
+		}
+		days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+		if days > 365 {
+			days = 365
+		}
 
-		inventory, err := tradingService.GetInventory(userID)
+		points, err := popularityService.History(uint(itemID), days)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"inventory": inventory,
+			"item_id": itemID,
+			"days":    points,
 		})
 	}
 }
 
-func CreateBuyOrder(tradingService *trading.Service) gin.HandlerFunc {
+// GetItemDepth 物品的买卖盘深度图，at指定时刻时返回该时刻之前的最后一次快照
+func GetItemDepth(depthService *depth.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetUint("user_id")
-
-		var req struct {
-			ItemID   uint    `json:"item_id" binding:"required"`
-			Price    float64 `json:"price" binding:"required,min=0"`
-			Quantity int     `json:"quantity" binding:"required,min=1"`
-			Platform string  `json:"platform" binding:"required"`
-		}
-
-		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		itemID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item id"})
 			return
 		}
+		var at time.Time
+		if v := c.Query("at"); v != "" {
+			if at, _, err = parseQueryTime(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid at"})
+				return
+			}
+		}
 
-		order, err := tradingService.CreateBuyOrder(userID, req.ItemID, req.Price, req.Quantity, req.Platform)
+		chart, err := depthService.Chart(uint(itemID), c.DefaultQuery("platform", depth.Platform), at)
 		if err != nil {
+			if errors.Is(err, depth.ErrNoSnapshot) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "no order book snapshot"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusCreated, order)
+		c.JSON(http.StatusOK, chart)
 	}
 }
 
-func CreateSellOrder(tradingService *trading.Service) gin.HandlerFunc {
+// GetItemDepthHistory 物品买卖盘快照的盘口摘要序列
+func GetItemDepthHistory(depthService *depth.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetUint("user_id")
-
-		var req struct {
-			ItemID   uint    `json:"item_id" binding:"required"`
-			Price    float64 `json:"price" binding:"required,min=0"`
-			Quantity int     `json:"quantity" binding:"required,min=1"`
-			Platform string  `json:"platform" binding:"required"`
+		itemID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item id"})
+			return
 		}
-
-		if err := c.ShouldBindJSON(&req); err != nil {
+		from, to, err := parsePeriod(c)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		order, err := tradingService.CreateSellOrder(userID, req.ItemID, req.Price, req.Quantity, req.Platform)
+		snapshots, err := depthService.History(uint(itemID), c.DefaultQuery("platform", depth.Platform), from, to)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusCreated, order)
+		c.JSON(http.StatusOK, gin.H{
+			"item_id":   itemID,
+			"from":      from,
+			"to":        to,
+			"snapshots": snapshots,
+		})
 	}
 }
 
-func GetOrders(tradingService *trading.Service) gin.HandlerFunc {
+// GetItemRegionalPrices 物品在Steam各分区的最新盘口
+func GetItemRegionalPrices(depthService *depth.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetUint("user_id")
-		status := c.Query("status")
-		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		itemID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item id"})
+			return
+		}
 
-		orders, total, err := tradingService.GetOrders(userID, status, page, pageSize)
+		prices, err := depthService.RegionalPrices(uint(itemID))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"orders":    orders,
-			"total":     total,
-			"page":      page,
-			"page_size": pageSize,
-		})
+		c.JSON(http.StatusOK, gin.H{"item_id": itemID, "regions": prices})
 	}
 }
 
-func CancelOrder(tradingService *trading.Service) gin.HandlerFunc {
+// GetArbitrageOpportunities 跨平台套利机会，收益按扣除买卖手续费和提现费后的净额计算；
+// hours为报价的有效时长，currency不为空时金额换算为该币种
+func GetArbitrageOpportunities(tradingService *trading.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetUint("user_id")
-		orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
-			return
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		hours, _ := strconv.Atoi(c.DefaultQuery("hours", "24"))
+		if hours <= 0 {
+			hours = 24
 		}
+		minPct := 0.0
+		if raw := c.Query("min_pct"); raw != "" {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil || value < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid min_pct"})
+				return
+			}
+			minPct = value
+		}
+		currency := strings.ToUpper(c.Query("currency"))
 
-		if err := tradingService.CancelOrder(uint(orderID), userID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		since := time.Now().Add(-time.Duration(hours) * time.Hour)
+		opportunities, err := tradingService.GetArbitrageOpportunities(since, minPct, limit, currency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"message": "order cancelled successfully",
+			"type":          trading.OpportunityCrossPlatform,
+			"opportunities": opportunities,
+			"count":         len(opportunities),
 		})
 	}
 }
 
-// Strategy Handlers
-
-func GetStrategies(tradingService *trading.Service) gin.HandlerFunc {
+// GetRegionalSpreads Steam分区价差机会，min_pct不传时使用配置的最低收益率
+func GetRegionalSpreads(depthService *depth.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.GetUint("user_id")
+		itemID, _ := strconv.ParseUint(c.Query("item_id"), 10, 32)
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		minPct := -1.0
+		if raw := c.Query("min_pct"); raw != "" {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil || value < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid min_pct"})
+				return
+			}
+			minPct = value
+		}
 
-		strategies, err := tradingService.GetStrategies(userID)
+		spreads, err := depthService.RegionalSpreads(uint(itemID), minPct, limit)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"strategies": strategies,
+			"type":    depth.OpportunityRegional,
+			"spreads": spreads,
+			"count":   len(spreads),
 		})
 	}
 }
 
-func CreateStrategy(tradingService *trading.Service) gin.HandlerFunc {
+// Trading Handlers
+
+func GetInventory(tradingService *trading.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetUint("user_id")
 
-		var strategy models.Strategy
-		if err := c.ShouldBindJSON(&strategy); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-
-		if err := tradingService.CreateStrategy(userID, &strategy); err != nil {
+		inventory, err := tradingService.GetInventory(userID)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusCreated, strategy)
+		c.JSON(http.StatusOK, gin.H{
+			"inventory": inventory,
+		})
 	}
 }
 
-func UpdateStrategy(tradingService *trading.Service) gin.HandlerFunc {
+// GetPositions 当前用户按物品汇总的持仓，含平均成本、已实现和未实现盈亏
+func GetPositions(tradingService *trading.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetUint("user_id")
-		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
-			return
-		}
-
-		var updates map[string]interface{}
-		if err := c.ShouldBindJSON(&updates); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
 
-		if err := tradingService.UpdateStrategy(uint(strategyID), userID, updates); err != nil {
+		positions, err := tradingService.GetPositions(userID)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"message": "strategy updated successfully",
+			"positions": positions,
 		})
 	}
 }
 
-func DeleteStrategy(tradingService *trading.Service) gin.HandlerFunc {
+// GetLedger 当前用户的余额和资金流水
+func GetLedger(tradingService *trading.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetUint("user_id")
-		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
-			return
-		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
 
-		if err := tradingService.DeleteStrategy(uint(strategyID), userID); err != nil {
+		balance, entries, err := tradingService.GetLedger(userID, limit)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"message": "strategy deleted successfully",
+			"balance": balance,
+			"entries": entries,
 		})
 	}
 }
 
-func ActivateStrategy(tradingService *trading.Service) gin.HandlerFunc {
+func CreateBuyOrder(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetUint("user_id")
-		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
-			return
-		}
 
-		if err := tradingService.ActivateStrategy(uint(strategyID), userID); err != nil {
+		var req struct {
+			ItemID   uint    `json:"item_id" binding:"required"`
+			Price    float64 `json:"price" binding:"required,min=0"`
+			Quantity int     `json:"quantity" binding:"required,min=1"`
+			Platform string  `json:"platform"` // 为空时使用默认平台，auto表示自动路由
+			TTL       int        `json:"ttl"`        // 有效期（秒），与expires_at二选一
+			ExpiresAt *time.Time `json:"expires_at"` // 过期时间，到期仍未成交自动取消
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		expiresAt, err := orderExpiry(req.TTL, req.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		order, err := tradingService.CreateBuyOrder(userID, req.ItemID, req.Price, req.Quantity, req.Platform, expiresAt)
+		if err != nil {
+			respondOrderError(c, err)
+			return
+		}
+		auditService.Log(auditEntry(c, "order.create", "order", order.ID, nil, order))
+
+		c.JSON(http.StatusCreated, order)
+	}
+}
+
+func CreateSellOrder(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req struct {
+			ItemID   uint    `json:"item_id" binding:"required"`
+			Price    float64 `json:"price" binding:"required,min=0"`
+			Quantity int     `json:"quantity" binding:"required,min=1"`
+			Platform string  `json:"platform"` // 为空时使用默认平台，auto表示自动路由
+			LotMethod string `json:"lot_method"` // 为空时使用用户默认的批次选择方式
+			TTL       int        `json:"ttl"`        // 有效期（秒），与expires_at二选一
+			ExpiresAt *time.Time `json:"expires_at"` // 过期时间，到期仍未成交自动取消
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		expiresAt, err := orderExpiry(req.TTL, req.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		order, err := tradingService.CreateSellOrder(userID, req.ItemID, req.Price, req.Quantity, req.Platform, req.LotMethod, expiresAt)
+		if err != nil {
+			respondOrderError(c, err)
+			return
+		}
+		auditService.Log(auditEntry(c, "order.create", "order", order.ID, nil, order))
+
+		c.JSON(http.StatusCreated, order)
+	}
+}
+
+// CreateOCOOrder 为持仓提交止盈止损OCO订单，一腿开始执行时另一腿自动取消
+func CreateOCOOrder(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req struct {
+			ItemID     uint       `json:"item_id" binding:"required"`
+			Quantity   int        `json:"quantity" binding:"required,min=1"`
+			Platform   string     `json:"platform"`
+			LotMethod  string     `json:"lot_method"`
+			TakeProfit float64    `json:"take_profit" binding:"required,gt=0"`
+			StopPrice  float64    `json:"stop_price" binding:"required,gt=0"`
+			StopLimit  float64    `json:"stop_limit"` // 止损卖出价，为空时按触发价
+			TTL        int        `json:"ttl"`
+			ExpiresAt  *time.Time `json:"expires_at"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		expiresAt, err := orderExpiry(req.TTL, req.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pair, err := tradingService.CreateOCOOrder(userID, trading.OCORequest{
+			ItemID:     req.ItemID,
+			Quantity:   req.Quantity,
+			Platform:   req.Platform,
+			LotMethod:  req.LotMethod,
+			TakeProfit: req.TakeProfit,
+			StopPrice:  req.StopPrice,
+			StopLimit:  req.StopLimit,
+			ExpiresAt:  expiresAt,
+		})
+		if err != nil {
+			respondOrderError(c, err)
+			return
+		}
+		auditService.Log(auditEntry(c, "order.create_oco", "order", pair.TakeProfit.ID, nil, pair))
+
+		c.JSON(http.StatusCreated, pair)
+	}
+}
+
+// CreateStopOrder 提交止损单（不填limit_price，触发后按当时价格成交）或止损限价单
+func CreateStopOrder(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req struct {
+			Type       string     `json:"type" binding:"required,oneof=buy sell"`
+			ItemID     uint       `json:"item_id" binding:"required"`
+			Quantity   int        `json:"quantity" binding:"required,min=1"`
+			Platform   string     `json:"platform"`
+			LotMethod  string     `json:"lot_method"`
+			StopPrice  float64    `json:"stop_price" binding:"required,gt=0"`
+			LimitPrice float64    `json:"limit_price" binding:"min=0"`
+			TTL        int        `json:"ttl"`
+			ExpiresAt  *time.Time `json:"expires_at"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		expiresAt, err := orderExpiry(req.TTL, req.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		order, err := tradingService.CreateStopOrder(userID, trading.StopRequest{
+			Type:       req.Type,
+			ItemID:     req.ItemID,
+			Quantity:   req.Quantity,
+			Platform:   req.Platform,
+			LotMethod:  req.LotMethod,
+			StopPrice:  req.StopPrice,
+			LimitPrice: req.LimitPrice,
+			ExpiresAt:  expiresAt,
+		})
+		if err != nil {
+			respondOrderError(c, err)
+			return
+		}
+		auditService.Log(auditEntry(c, "order.create", "order", order.ID, nil, order))
+
+		c.JSON(http.StatusCreated, order)
+	}
+}
+
+// GetReservations 生效中的库存预留
+func GetReservations(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		reservations, err := tradingService.GetReservations(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"reservations": reservations})
+	}
+}
+
+// ReserveInventory 为站外用途预留库存，到期前策略和自动卖出规则不会动用
+func ReserveInventory(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		inventoryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid inventory id"})
+			return
+		}
+
+		var req trading.ReservationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		inventory, err := tradingService.ReserveInventory(userID, uint(inventoryID), req)
+		if err != nil {
+			if errors.Is(err, trading.ErrInventoryNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		auditService.Log(auditEntry(c, "inventory.reserve", "inventory", inventory.ID, nil, gin.H{
+			"reserved_until": inventory.ReservedUntil,
+			"reserved_for":   inventory.ReservedFor,
+		}))
+
+		c.JSON(http.StatusOK, inventory)
+	}
+}
+
+// ReleaseReservation 取消库存预留
+func ReleaseReservation(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		inventoryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid inventory id"})
+			return
+		}
+
+		inventory, err := tradingService.ReleaseReservation(userID, uint(inventoryID))
+		if err != nil {
+			switch {
+			case errors.Is(err, trading.ErrInventoryNotFound), errors.Is(err, trading.ErrInventoryNotReserved):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		auditService.Log(auditEntry(c, "inventory.release", "inventory", inventory.ID, nil, nil))
+
+		c.JSON(http.StatusOK, gin.H{"message": "reservation released successfully"})
+	}
+}
+
+func GetBreakEven(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		buyPrice, err := strconv.ParseFloat(c.Query("buy_price"), 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid buy_price"})
+			return
+		}
+		itemID, _ := strconv.ParseUint(c.Query("item_id"), 10, 32)
+
+		result, err := tradingService.BreakEven(buyPrice, c.Query("platform"), c.Query("buy_platform"), uint(itemID))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// respondOrderError 风控拒单返回422及原因代码，其他错误返回500
+// orderExpiry 根据ttl（秒）或expires_at计算订单的过期时间，都未指定时返回nil
+func orderExpiry(ttl int, expiresAt *time.Time) (*time.Time, error) {
+	switch {
+	case ttl < 0:
+		return nil, errors.New("ttl must be positive")
+	case ttl > 0 && expiresAt != nil:
+		return nil, errors.New("ttl and expires_at are mutually exclusive")
+	case ttl > 0:
+		at := time.Now().Add(time.Duration(ttl) * time.Second)
+		return &at, nil
+	}
+	return expiresAt, nil
+}
+
+func respondOrderError(c *gin.Context, err error) {
+	if errors.Is(err, trading.ErrInvalidExpiry) || errors.Is(err, trading.ErrInvalidOCOPrices) ||
+		errors.Is(err, trading.ErrInvalidStopOrder) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, trading.ErrMaintenance) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	var violation *trading.RiskViolation
+	if errors.As(err, &violation) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": violation.Reason,
+			"risk":  violation,
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+func GetOrders(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		status := c.Query("status")
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+		orders, total, err := tradingService.GetOrders(userID, status, page, pageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"orders":    orders,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		})
+	}
+}
+
+func SearchOrders(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		search := trading.OrderSearch{
+			Text:      strings.TrimSpace(c.Query("q")),
+			Types:     splitQuery(c.Query("type")),
+			Platforms: splitQuery(c.Query("platform")),
+			Statuses:  splitQuery(c.Query("status")),
+			SortBy:    c.DefaultQuery("sort", "created_at"),
+			SortDesc:  c.DefaultQuery("order", "desc") != "asc",
+		}
+		search.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+		search.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		search.MinPrice, _ = strconv.ParseFloat(c.Query("min_price"), 64)
+		search.MaxPrice, _ = strconv.ParseFloat(c.Query("max_price"), 64)
+
+		if v := c.Query("strategy_id"); v != "" {
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+				return
+			}
+			strategyID := uint(id)
+			search.StrategyID = &strategyID
+		}
+
+		if v := c.Query("from"); v != "" {
+			from, _, err := parseQueryTime(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+				return
+			}
+			search.From = &from
+		}
+		if v := c.Query("to"); v != "" {
+			to, dateOnly, err := parseQueryTime(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+				return
+			}
+			// 只给日期时包含当天
+			if dateOnly {
+				to = to.AddDate(0, 0, 1)
+			}
+			search.To = &to
+		}
+
+		orders, total, err := tradingService.SearchOrders(userID, search)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"orders":    orders,
+			"total":     total,
+			"page":      search.Page,
+			"page_size": search.PageSize,
+		})
+	}
+}
+
+// splitQuery 解析逗号分隔的查询参数
+func splitQuery(v string) []string {
+	var values []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// parseQueryTime 支持 RFC3339 和 2006-01-02 两种日期格式
+func parseQueryTime(v string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+	return t, true, err
+}
+
+func CancelOrder(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+			return
+		}
+
+		// ?version=读取到的订单版本（必填），订单在此之后发生变化时返回409
+		raw, ok := c.GetQuery("version")
+		if !ok {
+			respondVersionRequired(c)
+			return
+		}
+		version, err := strconv.Atoi(raw)
+		if err != nil || version <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+
+		before, err := tradingService.GetOrder(uint(orderID), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+
+		if err := tradingService.CancelOrder(uint(orderID), userID, version); err != nil {
+			if errors.Is(err, trading.ErrVersionConflict) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		after, _ := tradingService.GetOrder(uint(orderID), userID)
+		auditService.Log(auditEntry(c, "order.cancel", "order", before.ID, before, after))
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "order cancelled successfully",
+		})
+	}
+}
+
+// respondVersionRequired 改单、撤单和修改策略须带上读取到的版本，否则可能覆盖期间发生的变化
+func respondVersionRequired(c *gin.Context) {
+	c.JSON(http.StatusPreconditionRequired, gin.H{"error": "version is required"})
+}
+
+// GetOrderEvents 订单的事件时间线：创建、入队、延迟、提交平台、平台确认、成交或失败原因等
+func GetOrderEvents(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+			return
+		}
+
+		events, err := tradingService.GetOrderEvents(uint(orderID), userID)
+		if errors.Is(err, trading.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"events": events})
+	}
+}
+
+// AmendOrder 修改挂单的价格或数量，body中须带上读取到的订单版本version，缺少时返回428，订单已变化时返回409
+func AmendOrder(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+			return
+		}
+
+		var req struct {
+			Price    *float64 `json:"price"`
+			Quantity *int     `json:"quantity"`
+			Version  *int     `json:"version"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Version == nil {
+			respondVersionRequired(c)
+			return
+		}
+		if *req.Version <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+
+		before, err := tradingService.GetOrder(uint(orderID), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+			return
+		}
+
+		order, err := tradingService.AmendOrder(uint(orderID), userID, *req.Version, trading.OrderAmendment{
+			Price:    req.Price,
+			Quantity: req.Quantity,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, trading.ErrVersionConflict):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, trading.ErrOrderNotAmendable):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				respondOrderError(c, err)
+			}
+			return
+		}
+		auditService.Log(auditEntry(c, "order.amend", "order", order.ID, before, order))
+
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+func CreateSlicedOrder(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req trading.SlicedOrderRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		parent, err := tradingService.CreateSlicedOrder(userID, req)
+		if err != nil {
+			respondOrderError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, parent)
+	}
+}
+
+func GetSlicedOrders(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		parents, err := tradingService.GetSlicedOrders(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"orders": parents})
+	}
+}
+
+func GetSlicedOrder(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+			return
+		}
+
+		parent, err := tradingService.GetSlicedOrder(userID, uint(id))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, parent)
+	}
+}
+
+func CancelSlicedOrder(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+			return
+		}
+
+		if err := tradingService.CancelSlicedOrder(userID, uint(id)); err != nil {
+			if errors.Is(err, trading.ErrSlicedOrderNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "sliced order cancelled successfully"})
+	}
+}
+
+// GetRoutingPreference 获取下单平台偏好及可选平台
+func GetRoutingPreference(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		c.JSON(http.StatusOK, gin.H{
+			"preference": tradingService.GetRoutingPreference(userID),
+			"platforms":  tradingService.RoutablePlatforms(),
+		})
+	}
+}
+
+// SaveRoutingPreference 修改下单平台偏好
+func SaveRoutingPreference(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req trading.RoutingSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pref, err := tradingService.SaveRoutingPreference(userID, req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, pref)
+	}
+}
+
+// GetLotMethod 获取卖出时默认的持仓批次选择方式
+func GetLotMethod(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		c.JSON(http.StatusOK, gin.H{
+			"lot_method": tradingService.GetLotMethod(userID),
+			"methods":    trading.LotMethods,
+		})
+	}
+}
+
+// SaveLotMethod 修改卖出时默认的持仓批次选择方式
+func SaveLotMethod(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req struct {
+			LotMethod string `json:"lot_method" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tradingService.SetLotMethod(userID, req.LotMethod); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"lot_method": req.LotMethod})
+	}
+}
+
+// Strategy Handlers
+
+func GetStrategies(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		strategies, err := tradingService.GetStrategies(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"strategies": strategies,
+		})
+	}
+}
+
+func CreateStrategy(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var strategy models.Strategy
+		if err := c.ShouldBindJSON(&strategy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := tradingService.CreateStrategy(userID, &strategy); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditService.Log(auditEntry(c, "strategy.create", "strategy", strategy.ID, nil, strategy))
+
+		c.JSON(http.StatusCreated, strategy)
+	}
+}
+
+func UpdateStrategy(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+
+		var updates map[string]interface{}
+		if err := c.ShouldBindJSON(&updates); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 请求体中的version为读取到的策略版本（必填），策略在此之后被修改时返回409
+		raw, ok := updates["version"]
+		if !ok {
+			respondVersionRequired(c)
+			return
+		}
+		version, ok := raw.(float64)
+		if !ok || version < 1 || version != float64(int(version)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version"})
+			return
+		}
+
+		before, err := tradingService.GetStrategy(uint(strategyID), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "strategy not found"})
+			return
+		}
+
+		if err := tradingService.UpdateStrategy(uint(strategyID), userID, updates, int(version)); err != nil {
+			switch {
+			case errors.Is(err, trading.ErrVersionConflict):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, trading.ErrInvalidStrategyUpdate):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		after, _ := tradingService.GetStrategy(uint(strategyID), userID)
+		auditService.Log(auditEntry(c, "strategy.update", "strategy", before.ID, before, after))
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "strategy updated successfully",
+		})
+	}
+}
+
+func DeleteStrategy(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+
+		before, err := tradingService.GetStrategy(uint(strategyID), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "strategy not found"})
+			return
+		}
+
+		if err := tradingService.DeleteStrategy(uint(strategyID), userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditService.Log(auditEntry(c, "strategy.delete", "strategy", before.ID, before, nil))
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "strategy deleted successfully",
+		})
+	}
+}
+
+func ActivateStrategy(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+
+		// 请求体可选，没有警告的策略无需确认
+		var req struct {
+			Acknowledged []string `json:"acknowledged_warnings"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		before, err := tradingService.GetStrategy(uint(strategyID), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "strategy not found"})
+			return
+		}
+
+		if err := tradingService.ActivateStrategy(uint(strategyID), userID, req.Acknowledged); err != nil {
+			var required *trading.PreflightRequired
+			switch {
+			case errors.As(err, &required):
+				c.JSON(http.StatusConflict, gin.H{
+					"error":          err.Error(),
+					"preflight":      required.Preflight,
+					"unacknowledged": required.Unacknowledged,
+				})
+			case errors.Is(err, trading.ErrVersionConflict):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		after, _ := tradingService.GetStrategy(uint(strategyID), userID)
+		auditService.Log(auditEntry(c, "strategy.activate", "strategy", before.ID, before, after))
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "strategy activated successfully",
+		})
+	}
+}
+
+// PreflightStrategy 激活前检查，返回风险评分和需要确认的警告
+func PreflightStrategy(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+
+		result, err := tradingService.PreflightStrategy(uint(strategyID), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "strategy not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetStrategyRunLogs 策略运行日志，包括冲突仲裁结果
+func GetStrategyRunLogs(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+		logs, err := tradingService.GetStrategyRunLogs(uint(strategyID), userID, limit)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "strategy not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"logs": logs})
+	}
+}
+
+// GetStrategySuggestions 策略复查给出的调整建议，changes可以直接提交给修改策略接口
+func GetStrategySuggestions(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+
+		suggestions, err := tradingService.GetStrategySuggestions(uint(strategyID), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "strategy not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+	}
+}
+
+// StartStrategyExperiment 以多组参数变体运行策略，按权重分配预算，评估期结束后推广胜者
+func StartStrategyExperiment(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+
+		var req trading.ExperimentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		experiment, err := tradingService.StartExperiment(userID, uint(strategyID), req)
+		if err != nil {
+			var required *trading.PreflightRequired
+			if errors.As(err, &required) {
+				c.JSON(http.StatusConflict, gin.H{
+					"error":          err.Error(),
+					"preflight":      required.Preflight,
+					"unacknowledged": required.Unacknowledged,
+				})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		auditService.Log(auditEntry(c, "strategy.experiment_start", "strategy", uint(strategyID), nil, experiment))
+
+		c.JSON(http.StatusCreated, experiment)
+	}
+}
+
+// GetStrategyExperiments 策略的A/B测试列表
+func GetStrategyExperiments(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+
+		experiments, err := tradingService.GetExperiments(userID, uint(strategyID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"experiments": experiments})
+	}
+}
+
+// experimentParams 解析路径中的策略ID和实验ID
+func experimentParams(c *gin.Context) (uint, uint, bool) {
+	strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+		return 0, 0, false
+	}
+	experimentID, err := strconv.ParseUint(c.Param("experiment_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid experiment id"})
+		return 0, 0, false
+	}
+	return uint(strategyID), uint(experimentID), true
+}
+
+// GetStrategyExperiment A/B测试详情及各变体的当前表现
+func GetStrategyExperiment(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		strategyID, experimentID, ok := experimentParams(c)
+		if !ok {
+			return
+		}
+
+		report, err := tradingService.GetExperiment(c.GetUint("user_id"), strategyID, experimentID)
+		if err != nil {
+			if errors.Is(err, trading.ErrExperimentNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// PromoteStrategyVariant 提前结束A/B测试并推广指定变体
+func PromoteStrategyVariant(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		strategyID, experimentID, ok := experimentParams(c)
+		if !ok {
+			return
+		}
+		var req struct {
+			VariantID uint `json:"variant_id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		experiment, err := tradingService.PromoteVariant(c.GetUint("user_id"), strategyID, experimentID, req.VariantID)
+		if err != nil {
+			if errors.Is(err, trading.ErrExperimentNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, experiment)
+	}
+}
+
+// CancelStrategyExperiment 取消A/B测试，停止全部变体并恢复母策略
+func CancelStrategyExperiment(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		strategyID, experimentID, ok := experimentParams(c)
+		if !ok {
+			return
+		}
+
+		experiment, err := tradingService.CancelExperiment(c.GetUint("user_id"), strategyID, experimentID)
+		if err != nil {
+			if errors.Is(err, trading.ErrExperimentNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, experiment)
+	}
+}
+
+// EvaluateStrategy 试运行策略，返回当前会产生的信号及理由，不会下单
+func EvaluateStrategy(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+
+		evaluation, err := tradingService.EvaluateStrategy(uint(strategyID), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "strategy not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, evaluation)
+	}
+}
+
+func DeactivateStrategy(tradingService *trading.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+
+		before, err := tradingService.GetStrategy(uint(strategyID), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "strategy not found"})
+			return
+		}
+
+		if err := tradingService.DeactivateStrategy(uint(strategyID), userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		after, _ := tradingService.GetStrategy(uint(strategyID), userID)
+		auditService.Log(auditEntry(c, "strategy.deactivate", "strategy", before.ID, before, after))
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "strategy deactivated successfully",
+		})
+	}
+}
+
+func GetStrategyPerformance(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+		days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+
+		report, err := tradingService.GetStrategyPerformance(uint(strategyID), userID, days)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetPerformance 当前用户及各策略的收益风险指标，指定days时按最近days天即时计算，否则返回定期计算的结果
+func GetPerformance(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		days, _ := strconv.Atoi(c.Query("days"))
+		if days < 0 || days > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+			return
+		}
+
+		metrics, strategies, err := tradingService.GetPerformance(userID, days)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"performance": metrics,
+			"strategies":  strategies,
+		})
+	}
+}
+
+// Copy Trading Handlers
+
+func GetPublicStrategies(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		strategies, err := tradingService.GetPublicStrategies()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"strategies": strategies,
+		})
+	}
+}
+
+func SubscribeStrategy(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			return
+		}
+
+		var req struct {
+			Budget        float64 `json:"budget" binding:"required,gt=0"`
+			MaxOrderValue float64 `json:"max_order_value" binding:"min=0"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		subscription, err := tradingService.Subscribe(userID, uint(strategyID), req.Budget, req.MaxOrderValue)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, subscription)
+	}
+}
+
+func GetSubscriptions(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		subscriptions, err := tradingService.GetSubscriptions(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"subscriptions": subscriptions,
+		})
+	}
+}
+
+func Unsubscribe(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		subscriptionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription id"})
+			return
+		}
+
+		if err := tradingService.Unsubscribe(uint(subscriptionID), userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "unsubscribed successfully",
+		})
+	}
+}
+
+// Stats Handlers
+
+func GetProfitStats(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		period := c.DefaultQuery("period", "month")
+		groupBy := c.Query("group_by")
+
+		stats, err := tradingService.GetProfitStats(userID, period, groupBy)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+func GetTradingStats(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		stats, err := tradingService.GetTradingStats(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+// Admin Handlers
+
+func GetMaintenance(maintenance *system.Maintenance) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, maintenance.Status())
+	}
+}
+
+func SetMaintenance(maintenance *system.Maintenance) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req struct {
+			Enabled *bool  `json:"enabled" binding:"required"`
+			Reason  string `json:"reason"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var err error
+		if *req.Enabled {
+			err = maintenance.Enable(userID, req.Reason)
+		} else {
+			err = maintenance.Disable(userID)
+		}
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "failed to save maintenance state: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, maintenance.Status())
+	}
+}
+
+func AdjustUserInventory(adminService *admin.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetUint("user_id")
+		userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		var req admin.InventoryAdjustment
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		inventory, err := adminService.AdjustInventory(actorID, uint(userID), req)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, inventory)
+	}
+}
+
+func AdjustUserBalance(adminService *admin.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetUint("user_id")
+		userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		var req struct {
+			Amount float64 `json:"amount" binding:"required"`
+			Reason string  `json:"reason" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		entry, err := adminService.AdjustBalance(actorID, uint(userID), req.Amount, req.Reason)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, entry)
+	}
+}
+
+func GetUserLedger(adminService *admin.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+		balance, entries, err := adminService.Ledger(uint(userID), limit)
+		if err != nil {
+			respondAdminError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"balance": balance,
+			"entries": entries,
+		})
+	}
+}
+
+func RebuildOrders(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetUint("user_id")
+
+		var req struct {
+			OrderIDs []uint `json:"order_ids"`
+			DryRun   bool   `json:"dry_run"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		report, err := tradingService.RebuildOrders(actorID, req.OrderIDs, req.DryRun)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetHaltedItems 暂停交易中的物品
+func GetHaltedItems(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		items, err := tradingService.HaltedItems()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	}
+}
+
+// HaltItem 暂停物品的交易，买卖订单和策略信号都会被拒绝
+func HaltItem(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetUint("user_id")
+		itemID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item id"})
+			return
+		}
+
+		var req struct {
+			Reason string `json:"reason" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item, err := tradingService.HaltItem(&actorID, uint(itemID), req.Reason)
+		if errors.Is(err, trading.ErrItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+// ResumeItem 恢复物品的交易
+func ResumeItem(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetUint("user_id")
+		itemID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item id"})
+			return
+		}
+
+		item, err := tradingService.ResumeItem(actorID, uint(itemID))
+		if errors.Is(err, trading.ErrItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+// GetPlatformQuotas 各平台账户的限额、已用量和剩余额度
+func GetPlatformQuotas(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"quotas": tradingService.GetQuotas()})
+	}
+}
+
+// GetProxyPools 各平台代理池中代理的健康分和冷却状态，未启用的平台不返回
+func GetProxyPools(pools map[string]*proxypool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := make(map[string][]proxypool.Stats, len(pools))
+		for platform, pool := range pools {
+			if pool != nil {
+				result[platform] = pool.Stats()
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"pools": result})
+	}
+}
+
+// GetPlatformSessions 各平台登录会话的状态
+func GetPlatformSessions(sessions map[string]*platformsession.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := make(map[string]models.PlatformSession, len(sessions))
+		for platform, session := range sessions {
+			if session != nil {
+				result[platform] = session.Status()
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"sessions": result})
+	}
+}
+
+// UpdatePlatformSession 管理员重新登录后提交新Cookie，校验登录状态通过后替换
+func UpdatePlatformSession(sessions map[string]*platformsession.Manager, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessions[c.Param("platform")]
+		if session == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+
+		var req struct {
+			Cookie string `json:"cookie" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		before := session.Status()
+		status, err := session.SetCookie(c.Request.Context(), req.Cookie)
+		switch {
+		case errors.Is(err, platformsession.ErrEmptyCookie):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, platformsession.ErrLoginRequired):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "cookie is not logged in"})
+			return
+		case err != nil:
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		auditService.Log(auditEntry(c, "admin.session_update", "platform_session", status.ID, before, status))
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// CheckPlatformSession 立即检查会话，失效时会尝试自动刷新
+func CheckPlatformSession(sessions map[string]*platformsession.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := sessions[c.Param("platform")]
+		if session == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+
+		session.Check(c.Request.Context())
+		c.JSON(http.StatusOK, session.Status())
+	}
+}
+
+// GetOutboxStats 事务发件箱中未投递和重试中的事件数
+func GetOutboxStats(relay *outbox.Relay) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := relay.Stats()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+// GetWebSocketStats 推送连接的发送队列积压、慢连接和分发耗时
+func GetWebSocketStats(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, hub.Stats())
+	}
+}
+
+// Pprof net/http/pprof接口，路由为/admin/debug/pprof/*name，如profile?seconds=30、heap、goroutine?debug=2
+func Pprof() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch name := strings.TrimPrefix(c.Param("name"), "/"); name {
+		case "":
+			// 索引页中的链接是相对路径，需要以/结尾
+			pprof.Index(c.Writer, c.Request)
+		case "cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			pprof.Handler(name).ServeHTTP(c.Writer, c.Request)
+		}
+	}
+}
+
+// GetProfiles 持续剖析保存的CPU和堆剖析文件
+func GetProfiles(profilingService *profiling.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		files, err := profilingService.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"profiles": files})
+	}
+}
+
+// DownloadProfile 下载剖析文件，用go tool pprof查看
+func DownloadProfile(profilingService *profiling.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path, err := profilingService.Path(c.Param("name"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.FileAttachment(path, c.Param("name"))
+	}
+}
+
+// GetLatencyReport 行情采集到策略下单各环节的耗时分布
+func GetLatencyReport(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, tradingService.GetLatencyReport())
+	}
+}
+
+// GetFeeHistory 平台手续费的历史版本
+func GetFeeHistory(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		platform := c.Query("platform")
+		if platform == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "platform is required"})
+			return
+		}
+
+		history, err := tradingService.GetFeeHistory(platform)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, history)
+	}
+}
+
+// CreateFeeVersion 新增带生效时间的手续费版本
+func CreateFeeVersion(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetUint("user_id")
+
+		var req trading.FeeVersionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		version, err := tradingService.CreateFeeVersion(actorID, req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, version)
+	}
+}
+
+// RecomputeFees 按历史手续费重算时间范围内的交易，dry_run=true时只返回差异
+func RecomputeFees(tradingService *trading.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetUint("user_id")
+
+		var req struct {
+			Platform string    `json:"platform"`
+			From     time.Time `json:"from" binding:"required"`
+			To       time.Time `json:"to" binding:"required"`
+			DryRun   bool      `json:"dry_run"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !req.To.After(req.From) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+			return
+		}
+
+		report, err := tradingService.RecomputeFees(actorID, req.Platform, req.From, req.To, req.DryRun)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func respondAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, admin.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+	case errors.Is(err, admin.ErrInventoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "inventory not found"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// Saved View Handlers
+
+type savedViewRequest struct {
+	Name    string        `json:"name" binding:"required"`
+	Target  string        `json:"target" binding:"required"`
+	Filters views.Filters `json:"filters"`
+}
+
+func GetSavedViews(viewService *views.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		savedViews, err := viewService.List(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"views": savedViews,
+		})
+	}
+}
+
+func CreateSavedView(viewService *views.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req savedViewRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		view, err := viewService.Create(userID, req.Name, req.Target, req.Filters)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, view)
+	}
+}
+
+func UpdateSavedView(viewService *views.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		viewID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid view id"})
+			return
+		}
+
+		var req savedViewRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		view, err := viewService.Update(uint(viewID), userID, req.Name, req.Target, req.Filters)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+func DeleteSavedView(viewService *views.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		viewID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid view id"})
+			return
+		}
+
+		if err := viewService.Delete(uint(viewID), userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "view deleted successfully",
+		})
+	}
+}
+
+func ExecuteSavedView(viewService *views.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		viewID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid view id"})
+			return
+		}
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+		view, err := viewService.Get(uint(viewID), userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "view not found"})
+			return
+		}
+
+		result, err := viewService.Execute(view, page, pageSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func StartRetentionRun(retentionService *retention.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, err := retentionService.Start("manual")
+		if errors.Is(err, retention.ErrRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, run)
+	}
+}
+
+func GetRetentionRuns(retentionService *retention.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+		runs, err := retentionService.ListRuns(limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"runs":    runs,
+			"running": retentionService.Running(),
+		})
+	}
+}
+
+func GetRetentionRun(retentionService *retention.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid run id"})
+			return
+		}
+
+		run, err := retentionService.GetRun(uint(runID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, run)
+	}
+}
+
+func StartCatalogImport(catalogService *catalog.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, err := catalogService.Start("manual")
+		if errors.Is(err, catalog.ErrRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, run)
+	}
+}
+
+func GetCatalogImports(catalogService *catalog.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+		runs, err := catalogService.ListRuns(limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"runs":    runs,
+			"running": catalogService.Running(),
+		})
+	}
+}
+
+func GetCatalogImport(catalogService *catalog.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		runID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid run id"})
+			return
+		}
+
+		run, err := catalogService.GetRun(uint(runID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, run)
+	}
+}
+
+// GetNewItems 处于快速通道中的新上架物品
+func GetNewItems(catalogService *catalog.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		items, err := catalogService.GetFastTrackedItems()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"items": items})
+	}
+}
+
+func GetNewItemSubscription(catalogService *catalog.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		sub, err := catalogService.GetNewItemSubscription(userID)
+		if errors.Is(err, catalog.ErrNoSubscription) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, sub)
+	}
+}
+
+func SaveNewItemSubscription(catalogService *catalog.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req struct {
+			Keywords []string `json:"keywords"` // 为空表示订阅全部新物品
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sub, err := catalogService.SaveNewItemSubscription(userID, req.Keywords)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, sub)
+	}
+}
+
+func DeleteNewItemSubscription(catalogService *catalog.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		if err := catalogService.DeleteNewItemSubscription(userID); err != nil {
+			if errors.Is(err, catalog.ErrNoSubscription) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "subscription deleted successfully"})
+	}
+}
+
+func RunIntegrityCheck(verifyService *verify.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := verifyService.Run(c.Request.Context())
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// Appraisal Handlers
+
+func CreateAppraisalShare(appraisalService *appraisal.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req struct {
+			Title    string `json:"title"`
+			TTLHours int    `json:"ttl_hours" binding:"min=0"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		share, err := appraisalService.Create(userID, req.Title, time.Duration(req.TTLHours)*time.Hour)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, share)
+	}
+}
+
+func GetAppraisalShares(appraisalService *appraisal.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		shares, err := appraisalService.List(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"shares": shares})
+	}
+}
+
+func RevokeAppraisalShare(appraisalService *appraisal.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		shareID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid share id"})
+			return
+		}
+
+		if err := appraisalService.Revoke(uint(shareID), userID); err != nil {
+			if errors.Is(err, appraisal.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "share revoked successfully"})
+	}
+}
+
+// GetPublicAppraisal 无需登录，凭签名链接只读访问估值快照
+func GetPublicAppraisal(appraisalService *appraisal.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := appraisalService.Get(c.Param("token"))
+		if err != nil {
+			switch {
+			case errors.Is(err, appraisal.ErrInvalidToken):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			case errors.Is(err, appraisal.ErrNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// Inspect Handlers
+
+func InspectInventoryItem(inspectService *inspect.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		inventoryID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid inventory id"})
+			return
+		}
+
+		var req struct {
+			InspectLink string `json:"inspect_link"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		inventory, err := inspectService.InspectInventory(c.Request.Context(), uint(inventoryID), userID, req.InspectLink)
+		if err != nil {
+			respondInspectError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, inventory)
+	}
+}
+
+func ResolveInspectLink(inspectService *inspect.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := inspectService.Resolve(c.Request.Context(), c.Query("link"))
+		if err != nil {
+			respondInspectError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// respondInspectError 按错误类型返回状态码，检视服务本身出错返回502
+func respondInspectError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, inspect.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, inspect.ErrInvalidLink), errors.Is(err, inspect.ErrRejected):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, inspect.ErrDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	}
+}
+
+// Item Watch Handlers
+
+func GetItemWatches(watchService *watch.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		watches, err := watchService.List(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"watches": watches,
+		})
+	}
+}
+
+func CreateItemWatch(watchService *watch.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req struct {
+			ItemID     uint    `json:"item_id" binding:"required"`
+			WebhookURL string  `json:"webhook_url"`
+			RSIAbove   float64 `json:"rsi_above"`
+			RSIBelow   float64 `json:"rsi_below"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		created, err := watchService.Create(userID, models.ItemWatch{
+			ItemID:     req.ItemID,
+			WebhookURL: req.WebhookURL,
+			RSIAbove:   req.RSIAbove,
+			RSIBelow:   req.RSIBelow,
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+func DeleteItemWatch(watchService *watch.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		watchID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid watch id"})
+			return
+		}
+
+		if err := watchService.Delete(uint(watchID), userID); err != nil {
+			if errors.Is(err, watch.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "watch not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "watch deleted successfully",
+		})
+	}
+}
+
+// Price Alert Handlers
+
+func GetPriceAlerts(alertService *alerts.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		list, err := alertService.List(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"alerts": list,
+		})
+	}
+}
+
+func CreatePriceAlert(alertService *alerts.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req alerts.Rule
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		alert, err := alertService.Create(userID, req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, alert)
+	}
+}
+
+func UpdatePriceAlert(alertService *alerts.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		alertID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid alert id"})
+			return
+		}
+
+		var req alerts.Rule
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		alert, err := alertService.Update(uint(alertID), userID, req)
+		if err != nil {
+			if errors.Is(err, alerts.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "alert not found"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, alert)
+	}
+}
+
+func DeletePriceAlert(alertService *alerts.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		alertID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid alert id"})
+			return
+		}
+
+		if err := alertService.Delete(uint(alertID), userID); err != nil {
+			if errors.Is(err, alerts.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "alert not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "alert deleted successfully",
+		})
+	}
+}
+
+// Webhook Handlers
+
+func GetWebhooks(webhookService *webhooks.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		hooks, err := webhookService.List(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"webhooks": hooks,
+			"events":   webhooks.Events,
+		})
+	}
+}
+
+func CreateWebhook(webhookService *webhooks.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req struct {
+			URL         string   `json:"url" binding:"required"`
+			Events      []string `json:"events"`
+			Description string   `json:"description"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		hook, err := webhookService.Create(userID, req.URL, req.Events, req.Description)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// 签名密钥不写入审计日志
+		auditService.Log(auditEntry(c, "credential.webhook_create", "webhook", hook.ID, nil, hook.Webhook))
+
+		c.JSON(http.StatusCreated, hook)
+	}
+}
+
+func DeleteWebhook(webhookService *webhooks.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		hookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+			return
+		}
+
+		if err := webhookService.Delete(uint(hookID), userID); err != nil {
+			if errors.Is(err, webhooks.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditService.Log(auditEntry(c, "credential.webhook_delete", "webhook", uint(hookID), gin.H{"id": hookID}, nil))
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "webhook deleted successfully",
+		})
+	}
+}
+
+// GetAPIKeys 用户的API Key及可授予的权限
+func GetAPIKeys(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := authService.ListAPIKeys(c.GetUint("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"api_keys": keys,
+			"scopes":   auth.Scopes,
+		})
+	}
+}
+
+// CreateAPIKey 创建API Key，明文只在响应中返回一次
+func CreateAPIKey(authService *auth.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req auth.APIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		key, err := authService.CreateAPIKey(c.GetUint("user_id"), req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// 明文不写入审计日志
+		auditService.Log(auditEntry(c, "credential.api_key_create", "api_key", key.ID, nil, key.APIKey))
+
+		c.JSON(http.StatusCreated, key)
+	}
+}
+
+// RevokeAPIKey 吊销API Key
+func RevokeAPIKey(authService *auth.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key id"})
+			return
+		}
+
+		key, err := authService.RevokeAPIKey(c.GetUint("user_id"), uint(keyID))
+		if err != nil {
+			if errors.Is(err, auth.ErrAPIKeyNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditService.Log(auditEntry(c, "credential.api_key_revoke", "api_key", key.ID, nil, key))
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "api key revoked successfully",
+		})
+	}
+}
+
+func GetWebhookDeliveries(webhookService *webhooks.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		hookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+		deliveries, err := webhookService.Deliveries(uint(hookID), userID, c.Query("status"), limit)
+		if err != nil {
+			if errors.Is(err, webhooks.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"deliveries": deliveries,
+		})
+	}
+}
+
+func PingWebhook(webhookService *webhooks.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		hookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+			return
+		}
+
+		delivery, err := webhookService.Ping(uint(hookID), userID)
+		if err != nil {
+			if errors.Is(err, webhooks.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, delivery)
+	}
+}
+
+// Telegram Handlers
+
+func GetTelegramLink(telegramService *telegram.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		link, err := telegramService.Status(userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, link)
+	}
+}
+
+func CreateTelegramLink(telegramService *telegram.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		code, err := telegramService.Link(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditService.Log(auditEntry(c, "credential.telegram_link", "telegram_link", userID, nil, nil))
+
+		c.JSON(http.StatusCreated, code)
+	}
+}
+
+func DeleteTelegramLink(telegramService *telegram.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		before, _ := telegramService.Status(userID)
+		if err := telegramService.Unlink(userID); err != nil {
+			if errors.Is(err, telegram.ErrNotLinked) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		auditService.Log(auditEntry(c, "credential.telegram_unlink", "telegram_link", userID, before, nil))
+
+		c.JSON(http.StatusOK, gin.H{"message": "Telegram unlinked successfully"})
+	}
+}
+
+// Email Handlers
+
+func GetEmailSubscription(emailService *email.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		sub, err := emailService.Get(userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, sub)
+	}
+}
+
+func SaveEmailSubscription(emailService *email.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req email.Settings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sub, err := emailService.Save(userID, req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, sub)
+	}
+}
+
+func DeleteEmailSubscription(emailService *email.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		if err := emailService.Delete(userID); err != nil {
+			if errors.Is(err, email.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email subscription deleted successfully"})
+	}
+}
+
+func SendTestEmail(emailService *email.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		if err := emailService.SendTest(userID); err != nil {
+			if errors.Is(err, email.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Test email sent successfully"})
+	}
+}
+
+// Notification Preference Handlers
+
+func GetNotificationPreferences(notifier *notify.Router) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		prefs, err := notifier.Preferences(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"preferences": prefs,
+			"events":      notify.Events,
+			"severities":  notify.Severities,
+		})
+	}
+}
+
+func SaveNotificationPreference(notifier *notify.Router) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req notify.PreferenceSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pref, err := notifier.SavePreference(userID, c.Param("channel"), req)
+		if err != nil {
+			if errors.Is(err, notify.ErrUnknownChannel) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, pref)
+	}
+}
+
+func ResetNotificationPreference(notifier *notify.Router) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		if err := notifier.ResetPreference(userID, c.Param("channel")); err != nil {
+			if errors.Is(err, notify.ErrUnknownChannel) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Notification preference reset successfully"})
+	}
+}
+
+// WeChat Handlers
+
+func GetWeChatBinding(wechatService *wechat.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		binding, err := wechatService.Get(userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, binding)
+	}
+}
+
+func SaveWeChatBinding(wechatService *wechat.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req wechat.Settings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		before, _ := wechatService.Get(userID)
+		binding, err := wechatService.Save(userID, req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// 推送key不写入审计日志，只记录是否更换
+		auditService.Log(auditEntry(c, "credential.wechat_save", "wechat_binding", binding.ID, before, gin.H{
+			"provider":    binding.Provider,
+			"key_changed": before == nil || before.Key != binding.Key,
+		}))
+
+		c.JSON(http.StatusOK, binding)
+	}
+}
+
+func DeleteWeChatBinding(wechatService *wechat.Service, auditService *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		before, _ := wechatService.Get(userID)
+		if err := wechatService.Delete(userID); err != nil {
+			if errors.Is(err, wechat.ErrNotBound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		auditService.Log(auditEntry(c, "credential.wechat_delete", "wechat_binding", userID, before, nil))
+
+		c.JSON(http.StatusOK, gin.H{"message": "WeChat binding deleted successfully"})
+	}
+}
+
+func SendTestWeChat(wechatService *wechat.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		if err := wechatService.SendTest(userID); err != nil {
+			if errors.Is(err, wechat.ErrNotBound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Test message sent successfully"})
+	}
+}
+
+// Annotation Handlers
+
+type annotationRequest struct {
+	ItemID      *uint     `json:"item_id"`
+	Kind        string    `json:"kind"`
+	Title       string    `json:"title" binding:"required"`
+	Description string    `json:"description"`
+	URL         string    `json:"url"`
+	Time        time.Time `json:"time"`
+}
+
+func (r annotationRequest) annotation() models.Annotation {
+	return models.Annotation{
+		ItemID:      r.ItemID,
+		Kind:        r.Kind,
+		Title:       r.Title,
+		Description: r.Description,
+		URL:         r.URL,
+		Time:        r.Time,
+	}
+}
+
+func GetAnnotations(marketService *market.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		itemID, _ := strconv.ParseUint(c.Query("item_id"), 10, 32)
+
+		annotations, err := marketService.ListAnnotations(userID, uint(itemID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"annotations": annotations,
+		})
+	}
+}
+
+// CreateAnnotation 用户在图表上添加个人备注
+func CreateAnnotation(marketService *market.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req annotationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		annotation := req.annotation()
+		annotation.UserID = &userID
+		annotation.Kind = "note"
+
+		created, err := marketService.CreateAnnotation(annotation)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+func DeleteAnnotation(marketService *market.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		deleteAnnotation(c, marketService, &userID)
+	}
+}
+
+// CreateGlobalAnnotation 管理员发布全局事件，如游戏更新、箱子发布
+func CreateGlobalAnnotation(marketService *market.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req annotationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		created, err := marketService.CreateAnnotation(req.annotation())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+func DeleteGlobalAnnotation(marketService *market.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deleteAnnotation(c, marketService, nil)
+	}
+}
+
+func deleteAnnotation(c *gin.Context, marketService *market.Service, userID *uint) {
+	annotationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid annotation id"})
+		return
+	}
+
+	if err := marketService.DeleteAnnotation(uint(annotationID), userID); err != nil {
+		if errors.Is(err, market.ErrAnnotationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "annotation deleted successfully",
+	})
+}
+
+// Analytics Handlers
+
+// parsePeriod 解析from/to区间，未指定from时取最近days天（默认30天）
+func parsePeriod(c *gin.Context) (time.Time, time.Time, error) {
+	to := time.Now()
+	if v := c.Query("to"); v != "" {
+		t, dateOnly, err := parseQueryTime(v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid to")
+		}
+		// 只有日期时包含当天
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+
+	if v := c.Query("from"); v != "" {
+		from, _, err := parseQueryTime(v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid from")
+		}
+		return from, to, nil
+	}
+
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if days <= 0 {
+		days = 30
+	}
+	return to.AddDate(0, 0, -days), to, nil
+}
+
+func GetAttribution(analyticsService *analytics.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		from, to, err := parsePeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		report, err := analyticsService.GetAttribution(userID, from, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func GetBenchmark(analyticsService *analytics.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		from, to, err := parsePeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var indexes []string
+		if v := c.Query("indexes"); v != "" {
+			indexes = strings.Split(v, ",")
+		}
+
+		report, err := analyticsService.GetBenchmark(userID, indexes, from, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetPortfolioValue 组合市值和浮动盈亏的每日走势
+func GetPortfolioValue(analyticsService *analytics.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		from, to, err := parsePeriod(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		value, err := analyticsService.GetPortfolioValue(userID, from, to)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"message": "strategy activated successfully",
+		c.JSON(http.StatusOK, value)
+	}
+}
+
+func GetHedges(analyticsService *analytics.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		itemID, _ := strconv.ParseUint(c.Query("item_id"), 10, 32)
+		window, _ := strconv.Atoi(c.DefaultQuery("window", "30"))
+		minCorrelation, _ := strconv.ParseFloat(c.DefaultQuery("min_correlation", "0.3"), 64)
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+		report, err := analyticsService.GetHedges(userID, analytics.HedgeOptions{
+			ItemID:         uint(itemID),
+			Window:         window,
+			MinCorrelation: minCorrelation,
+			Limit:          limit,
 		})
+		if err != nil {
+			if errors.Is(err, analytics.ErrNoPosition) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func GetMarketIndexes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"indexes": analytics.MarketIndexNames()})
+	}
+}
+
+// Audit Handlers
+
+// auditEntry 当前登录用户对自己账户的操作
+func auditEntry(c *gin.Context, action, entityType string, entityID uint, before, after interface{}) audit.Entry {
+	userID := c.GetUint("user_id")
+	entry := audit.Entry{
+		ActorID:    &userID,
+		UserID:     &userID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Before:     before,
+		After:      after,
+		IP:         c.ClientIP(),
+	}
+	// 通过API Key发起的操作记录使用的密钥
+	if keyID, ok := c.Get("api_key_id"); ok {
+		entry.Details = gin.H{"api_key_id": keyID}
 	}
+	return entry
 }
 
-func DeactivateStrategy(tradingService *trading.Service) gin.HandlerFunc {
+// GetAuditLogs 查询审计日志：普通用户只能查看自己账户的记录，管理员可按user_id查询或查看全部
+func GetAuditLogs(auditService *audit.Service, authService *auth.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetUint("user_id")
-		strategyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		user, err := authService.GetUserByID(userID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
 			return
 		}
 
-		if err := tradingService.DeactivateStrategy(uint(strategyID), userID); err != nil {
+		filter := audit.Filter{
+			UserID:     &userID,
+			Action:     c.Query("action"),
+			EntityType: c.Query("entity_type"),
+		}
+		filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+		filter.PageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "50"))
+		if entityID, err := strconv.ParseUint(c.Query("entity_id"), 10, 32); err == nil {
+			filter.EntityID = uint(entityID)
+		}
+		for param, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			if value := c.Query(param); value != "" {
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + ", expected RFC3339"})
+					return
+				}
+				*target = t
+			}
+		}
+
+		if user.IsAdmin {
+			filter.UserID = nil
+			if value := c.Query("user_id"); value != "" {
+				id, err := strconv.ParseUint(value, 10, 32)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+					return
+				}
+				owner := uint(id)
+				filter.UserID = &owner
+			}
+			if value := c.Query("actor_id"); value != "" {
+				id, err := strconv.ParseUint(value, 10, 32)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid actor_id"})
+					return
+				}
+				actor := uint(id)
+				filter.ActorID = &actor
+			}
+		}
+
+		logs, total, err := auditService.List(filter)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"message": "strategy deactivated successfully",
+			"logs":  logs,
+			"total": total,
 		})
 	}
 }
 
-// Stats Handlers
+// File Handlers
 
-func GetProfitStats(tradingService *trading.Service) gin.HandlerFunc {
+// GetFiles 用户的报表、导出等文件
+func GetFiles(storageService *storage.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetUint("user_id")
-		period := c.DefaultQuery("period", "month")
 
-		stats, err := tradingService.GetProfitStats(userID, period)
+		files, err := storageService.List(userID, c.Query("kind"))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, stats)
+		c.JSON(http.StatusOK, gin.H{"files": files})
 	}
 }
 
-func GetTradingStats(tradingService *trading.Service) gin.HandlerFunc {
+// GetFileDownload 签发文件的限时下载链接
+func GetFileDownload(storageService *storage.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID := c.GetUint("user_id")
+		fileID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+			return
+		}
 
-		stats, err := tradingService.GetTradingStats(userID)
+		file, err := storageService.Get(userID, uint(fileID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		download, err := storageService.DownloadURL(file)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, stats)
+		c.JSON(http.StatusOK, download)
+	}
+}
+
+// DeleteFile 删除文件
+func DeleteFile(storageService *storage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		fileID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file id"})
+			return
+		}
+
+		if err := storageService.Delete(c.Request.Context(), userID, uint(fileID)); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "file deleted successfully"})
+	}
+}
+
+// DownloadFile 无需登录，凭签名链接下载本地存储的文件
+func DownloadFile(storageService *storage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+
+		file, body, err := storageService.OpenSigned(c.Request.Context(), key, c.Query("expires"), c.Query("signature"))
+		if err != nil {
+			switch {
+			case errors.Is(err, storage.ErrInvalidSignature):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			case errors.Is(err, storage.ErrNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		defer body.Close()
+
+		c.DataFromReader(http.StatusOK, file.Size, file.ContentType, body, map[string]string{
+			"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}),
+		})
+	}
+}
+
+// Export Handlers
+
+// CreateExport 创建异步导出任务，完成后通过下载接口获取文件
+func CreateExport(exportService *exports.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req struct {
+			Kind string `json:"kind" binding:"required"`
+			exports.Params
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		job, err := exportService.Create(userID, req.Kind, req.Params)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// CreateTaxReport 按年度异步生成已实现收益报告（CSV或PDF），完成后通过导出下载接口获取文件
+func CreateTaxReport(exportService *exports.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		var req struct {
+			Year     int    `json:"year" binding:"required"`
+			Method   string `json:"method"` // lots（默认）、average
+			Format   string `json:"format"` // csv（默认）、pdf
+			ItemID   uint   `json:"item_id"`
+			Platform string `json:"platform"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		job, err := exportService.Create(userID, exports.KindTaxReport, exports.Params{
+			Year:     req.Year,
+			Method:   req.Method,
+			Format:   req.Format,
+			ItemID:   req.ItemID,
+			Platform: req.Platform,
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"job":      job,
+			"download": "/api/v1/exports/" + strconv.FormatUint(uint64(job.ID), 10) + "/download",
+		})
+	}
+}
+
+// GetExports 用户的导出任务及进度
+func GetExports(exportService *exports.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+
+		jobs, err := exportService.List(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"exports": jobs})
+	}
+}
+
+// GetExport 单个导出任务的进度
+func GetExport(exportService *exports.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export id"})
+			return
+		}
+
+		job, err := exportService.Get(userID, uint(jobID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// GetExportDownload 已完成导出的限时下载链接
+func GetExportDownload(exportService *exports.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export id"})
+			return
+		}
+
+		download, err := exportService.Download(userID, uint(jobID))
+		if err != nil {
+			switch {
+			case errors.Is(err, exports.ErrNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, exports.ErrNotReady):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, exports.ErrExpired):
+				c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, download)
+	}
+}
+
+// CancelExport 取消导出任务
+func CancelExport(exportService *exports.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export id"})
+			return
+		}
+
+		job, err := exportService.Cancel(userID, uint(jobID))
+		if err != nil {
+			if errors.Is(err, exports.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
 	}
-}
\ No newline at end of file
+}
+
+// ResumeExport 从检查点继续失败的导出任务
+func ResumeExport(exportService *exports.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export id"})
+			return
+		}
+
+		job, err := exportService.Resume(userID, uint(jobID))
+		if err != nil {
+			if errors.Is(err, exports.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// DeleteExport 删除已结束的导出任务及其文件
+func DeleteExport(exportService *exports.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid export id"})
+			return
+		}
+
+		if err := exportService.Delete(c.Request.Context(), userID, uint(jobID)); err != nil {
+			switch {
+			case errors.Is(err, exports.ErrNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, exports.ErrActive):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "export deleted successfully"})
+	}
+}
+
+// GetAPIUsage 当前用户在各限流规则当前窗口内的用量和剩余次数
+func GetAPIUsage(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limiter.Enabled() {
+			c.JSON(http.StatusOK, gin.H{"enabled": false, "rules": []ratelimit.RuleUsage{}})
+			return
+		}
+
+		usage, err := limiter.Usage(c.Request.Context(), c.GetUint("user_id"))
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "rate limiter unavailable"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"enabled": true, "rules": usage})
+	}
+}
+
+// GetAPIUsageHistory 当前用户每小时的请求数和被限流次数，?hours=默认24
+func GetAPIUsageHistory(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+		if err != nil || hours <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid hours"})
+			return
+		}
+		if !limiter.Enabled() {
+			c.JSON(http.StatusOK, []ratelimit.UsageHour{})
+			return
+		}
+
+		history, err := limiter.UsageHistory(c.Request.Context(), c.GetUint("user_id"), hours)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "rate limiter unavailable"})
+			return
+		}
+		c.JSON(http.StatusOK, history)
+	}
+}
+
+// GetActivity 当前用户的动态，按时间倒序，?before=上一页返回的next
+func GetActivity(activityService *activity.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		limit, _ := strconv.Atoi(c.Query("limit"))
+
+		entries, next, err := activityService.Page(c.Request.Context(), userID, c.Query("before"), limit)
+		if errors.Is(err, activity.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"entries": entries, "next": next})
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMutationsRequireVersion 撤单、改单和修改策略缺少版本时返回428，版本不合法时返回400，不会执行修改
+func TestMutationsRequireVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.DELETE("/trading/orders/:id", CancelOrder(nil, nil))
+	router.PATCH("/trading/orders/:id", AmendOrder(nil, nil))
+	router.PUT("/strategies/:id", UpdateStrategy(nil, nil))
+
+	cases := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodDelete, "/trading/orders/1", "", http.StatusPreconditionRequired},
+		{http.MethodDelete, "/trading/orders/1?version=0", "", http.StatusBadRequest},
+		{http.MethodDelete, "/trading/orders/1?version=x", "", http.StatusBadRequest},
+		{http.MethodPatch, "/trading/orders/1", `{"price": 10}`, http.StatusPreconditionRequired},
+		{http.MethodPatch, "/trading/orders/1", `{"price": 10, "version": 0}`, http.StatusBadRequest},
+		{http.MethodPut, "/strategies/1", `{"name": "trend"}`, http.StatusPreconditionRequired},
+		{http.MethodPut, "/strategies/1", `{"name": "trend", "version": 1.5}`, http.StatusBadRequest},
+		{http.MethodPut, "/strategies/1", `{"name": "trend", "version": "1"}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s %s %s returned %d, want %d", tc.method, tc.path, tc.body, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// BodyLimitMiddleware 限制请求体大小，超限返回413，客户端发送过慢返回408
+func BodyLimitMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody || maxBytes <= 0 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		}
+
+		// 预先读取请求体，Content-Length缺失或不实时也能准确判断
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBytes+1))
+		c.Request.Body.Close()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				c.AbortWithStatusJSON(http.StatusRequestTimeout, gin.H{"error": "request body read timeout"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+		if int64(len(body)) > maxBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+// WithTimeouts 为HTTP处理设置超时，prefixes按路径前缀覆盖默认超时。
+// 超时后返回503，处理协程结束前不会复用gin上下文；WebSocket升级请求不受限制。
+// http.TimeoutHandler会缓冲整个响应，streams中的路径前缀（如文件下载）不经过它，
+// 而是直接流式写出，只把连接的写超时延长为对应时长
+func WithTimeouts(h http.Handler, timeout time.Duration, prefixes, streams map[string]time.Duration) http.Handler {
+	if timeout <= 0 {
+		return h
+	}
+
+	const body = `{"error":"request timeout"}`
+	handlers := make(map[string]http.Handler, len(prefixes))
+	for prefix, d := range prefixes {
+		handlers[prefix] = http.TimeoutHandler(h, d, body)
+	}
+	fallback := http.TimeoutHandler(h, timeout, body)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isWebSocketUpgrade(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		for prefix, d := range streams {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d)); err != nil {
+					logrus.Warnf("Failed to extend write deadline for %s: %v", r.URL.Path, err)
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		// 最长前缀优先
+		matched := ""
+		for prefix := range handlers {
+			if strings.HasPrefix(r.URL.Path, prefix) && len(prefix) > len(matched) {
+				matched = prefix
+			}
+		}
+		if matched != "" {
+			handlers[matched].ServeHTTP(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
+// isWebSocketUpgrade 请求是否为WebSocket握手
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
@@ -1,19 +1,35 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"csgo2-trading-bot/services/auth"
+	"csgo2-trading-bot/services/ratelimit"
+	"csgo2-trading-bot/services/system"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
-// AuthMiddleware JWT认证中间件
+// AuthMiddleware 认证中间件，支持登录后的JWT和API Key（Bearer或X-API-Key头）
 func AuthMiddleware(authService *auth.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			authenticateAPIKey(c, authService, key)
+			return
+		}
+
 		// 获取Authorization header
 		authHeader := c.GetHeader("Authorization")
+		if token := c.Query("access_token"); authHeader == "" && token != "" && isWebSocketUpgrade(c.Request) {
+			// 浏览器建立WebSocket连接时无法设置请求头，令牌通过查询参数传递
+			authHeader = "Bearer " + token
+		}
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header required"})
 			c.Abort()
@@ -28,6 +44,11 @@ func AuthMiddleware(authService *auth.Service) gin.HandlerFunc {
 			return
 		}
 
+		if strings.HasPrefix(parts[1], auth.APIKeyPrefix) {
+			authenticateAPIKey(c, authService, parts[1])
+			return
+		}
+
 		// 验证JWT
 		claims, err := authService.ValidateJWT(parts[1])
 		if err != nil {
@@ -36,33 +57,165 @@ func AuthMiddleware(authService *auth.Service) gin.HandlerFunc {
 			return
 		}
 
+		// 检查令牌是否已被吊销；Redis不可用时放行，访问令牌有效期很短
+		if err := authService.CheckRevoked(c.Request.Context(), claims); errors.Is(err, auth.ErrTokenRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		} else if err != nil {
+			logrus.Warnf("Token revocation check skipped: %v", err)
+		}
+
 		// 将用户信息存储到上下文
 		c.Set("user_id", claims.UserID)
 		c.Set("steam_id", claims.SteamID)
+		c.Set("claims", claims)
+		authService.TouchSession(c.Request.Context(), claims, c.ClientIP())
+
+		c.Next()
+	}
+}
+
+// authenticateAPIKey 校验API Key及其对当前路由的权限
+func authenticateAPIKey(c *gin.Context, authService *auth.Service, key string) {
+	apiKey, err := authService.ValidateAPIKey(key, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	scope := apiKeyScope(c.Request.Method, c.FullPath())
+	if scope == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "this endpoint is not available to api keys"})
+		c.Abort()
+		return
+	}
+	if !auth.HasScope(apiKey, scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "api key lacks scope " + scope})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", apiKey.UserID)
+	c.Set("api_key_id", apiKey.ID)
+
+	c.Next()
+}
+
+// apiKeyScope API Key访问该路由所需的权限，空字符串表示只能通过登录会话访问（如账户设置、管理接口）
+func apiKeyScope(method, path string) string {
+	path = strings.TrimPrefix(path, "/api/v1")
+	switch {
+	case strings.HasPrefix(path, "/market/"), path == "/fx/rates", path == "/annotations":
+		if method == http.MethodGet {
+			return auth.ScopeReadMarket
+		}
+	case strings.HasPrefix(path, "/trading/"), path == "/inspect":
+		return auth.ScopeTradeExecute
+	case strings.HasPrefix(path, "/strategies"), strings.HasPrefix(path, "/subscriptions"):
+		return auth.ScopeManageStrategies
+	}
+	return ""
+}
+
+// ReadOnlyMiddleware 只读模式下拒绝所有写操作
+func ReadOnlyMiddleware(readOnly func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if readOnly() && c.Request.Method != http.MethodGet {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "service is running in read-only mode"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// MaintenanceMiddleware 维护模式下拒绝交易写操作，读接口以及登出、吊销会话和API Key、停用策略等照常可用
+func MaintenanceMiddleware(maintenance *system.Maintenance) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tradingWrite(c.Request.Method, c.FullPath()) && maintenance.Enabled() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":       "service is under maintenance",
+				"maintenance": maintenance.Status(),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// tradingWrite 是否为会改变交易状态的写操作：下单、改单撤单、预留库存、交易设置、创建修改和启用策略、A/B实验、跟单。
+// 停用策略、取消实验、取消跟单只会减少交易，维护期间仍允许执行
+func tradingWrite(method, path string) bool {
+	if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+		return false
+	}
+	path = strings.TrimPrefix(path, "/api/v1")
+	switch {
+	case path == "/trading/inventory/:id/inspect":
+		return false
+	case strings.HasPrefix(path, "/trading/"):
+		return true
+	case path == "/strategies/:id/deactivate", path == "/strategies/:id/evaluate",
+		path == "/strategies/:id/experiments/:experiment_id/cancel":
+		return false
+	case path == "/strategies", strings.HasPrefix(path, "/strategies/"):
+		return true
+	}
+	return false
+}
+
+// AdminMiddleware 仅允许管理员访问，需在AuthMiddleware之后使用
+func AdminMiddleware(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := authService.GetUserByID(c.GetUint("user_id"))
+		if err != nil || !user.IsAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin privileges required"})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
 }
 
-// RateLimitMiddleware 限流中间件
-func RateLimitMiddleware(maxRequests int) gin.HandlerFunc {
-	// 简单的内存限流实现
-	requests := make(map[string]int)
-	
+// RateLimitMiddleware 限流中间件，by为ip时按客户端IP计数，为user时按登录用户计数（需放在认证中间件之后）
+func RateLimitMiddleware(limiter *ratelimit.Limiter, by string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		
-		if count, exists := requests[ip]; exists {
-			if count >= maxRequests {
-				c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
-				c.Abort()
-				return
-			}
-			requests[ip]++
-		} else {
-			requests[ip] = 1
-		}
-		
+		if !limiter.Enabled() {
+			c.Next()
+			return
+		}
+
+		identity := c.ClientIP()
+		if by == ratelimit.ByUser {
+			identity = strconv.FormatUint(uint64(c.GetUint("user_id")), 10)
+		}
+
+		result, err := limiter.Allow(c.Request.Context(), by, identity, limiter.Rules(by, c.Request.Method, c.FullPath()))
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "rate limiter unavailable"})
+			c.Abort()
+			return
+		}
+		if result == nil {
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Rule.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
@@ -73,7 +226,7 @@ func CORSMiddleware() gin.HandlerFunc {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -92,4 +245,68 @@ func LoggerMiddleware() gin.HandlerFunc {
 // RecoveryMiddleware 恢复中间件
 func RecoveryMiddleware() gin.HandlerFunc {
 	return gin.Recovery()
-}
\ No newline at end of file
+}
+
+// SecureTransportMiddleware HTTPS下发送HSTS头，并为所有Cookie加上Secure和HttpOnly
+func SecureTransportMiddleware(hstsMaxAge int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if hstsMaxAge > 0 {
+			c.Header("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", hstsMaxAge))
+		}
+		c.SetSameSite(http.SameSiteLaxMode)
+		w := &secureCookieWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		// 没有响应体时由gin在最后写出响应头
+		if !w.Written() {
+			w.patch()
+		}
+	}
+}
+
+// secureCookieWriter 在响应头写出前改写Set-Cookie
+type secureCookieWriter struct {
+	gin.ResponseWriter
+	patched bool
+}
+
+func (w *secureCookieWriter) patch() {
+	if w.patched {
+		return
+	}
+	w.patched = true
+
+	cookies := w.Header().Values("Set-Cookie")
+	for i, cookie := range cookies {
+		lower := strings.ToLower(cookie)
+		if !strings.Contains(lower, "; secure") {
+			cookie += "; Secure"
+		}
+		if !strings.Contains(lower, "; httponly") {
+			cookie += "; HttpOnly"
+		}
+		cookies[i] = cookie
+	}
+}
+
+func (w *secureCookieWriter) WriteHeaderNow() {
+	w.patch()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *secureCookieWriter) Write(data []byte) (int, error) {
+	w.patch()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *secureCookieWriter) WriteString(s string) (int, error) {
+	w.patch()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Flush 流式响应（如SSE）第一次Flush时就会写出响应头
+func (w *secureCookieWriter) Flush() {
+	w.patch()
+	w.ResponseWriter.Flush()
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"csgo2-trading-bot/services/scheduler"
+	"csgo2-trading-bot/services/system"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMaintenanceAllowsSafetyActions 维护期间只拒绝交易写操作，登出、吊销会话和API Key、停用策略仍可执行
+func TestMaintenanceAllowsSafetyActions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	maintenance := system.NewMaintenance(scheduler.New(), nil)
+	if err := maintenance.Enable(1, "upgrade"); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	protected := router.Group("/api/v1").Group("/")
+	protected.Use(MaintenanceMiddleware(maintenance))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	routes := []struct {
+		method, path, request string
+		want                  int
+	}{
+		{http.MethodPost, "/auth/logout", "/api/v1/auth/logout", http.StatusOK},
+		{http.MethodPost, "/auth/revoke-all", "/api/v1/auth/revoke-all", http.StatusOK},
+		{http.MethodDelete, "/sessions/:id", "/api/v1/sessions/3", http.StatusOK},
+		{http.MethodDelete, "/api-keys/:id", "/api/v1/api-keys/4", http.StatusOK},
+		{http.MethodPost, "/strategies/:id/deactivate", "/api/v1/strategies/5/deactivate", http.StatusOK},
+		{http.MethodDelete, "/subscriptions/:id", "/api/v1/subscriptions/6", http.StatusOK},
+		{http.MethodGet, "/trading/orders", "/api/v1/trading/orders", http.StatusOK},
+		{http.MethodPost, "/trading/buy", "/api/v1/trading/buy", http.StatusServiceUnavailable},
+		{http.MethodPost, "/trading/stop", "/api/v1/trading/stop", http.StatusServiceUnavailable},
+		{http.MethodDelete, "/trading/orders/:id", "/api/v1/trading/orders/7", http.StatusServiceUnavailable},
+		{http.MethodPost, "/strategies/:id/activate", "/api/v1/strategies/5/activate", http.StatusServiceUnavailable},
+	}
+	for _, r := range routes {
+		protected.Handle(r.method, r.path, ok)
+	}
+
+	for _, r := range routes {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(r.method, r.request, nil))
+		if w.Code != r.want {
+			t.Errorf("%s %s during maintenance returned %d, want %d", r.method, r.request, w.Code, r.want)
+		}
+	}
+
+	if err := maintenance.Disable(1); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/trading/buy", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("POST /api/v1/trading/buy after maintenance returned %d, want 200", w.Code)
+	}
+}
+
+// TestSecureCookiesOnFlush 流式响应先Flush再写响应体时，Cookie同样加上Secure和HttpOnly
+func TestSecureCookiesOnFlush(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(SecureTransportMiddleware(0))
+	router.GET("/stream", func(c *gin.Context) {
+		c.SetCookie("session", "abc", 3600, "/", "", false, false)
+		c.Writer.Flush()
+		c.Writer.WriteString("data: ok\n\n")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	cookie := w.Result().Header.Get("Set-Cookie")
+	if !strings.Contains(cookie, "Secure") || !strings.Contains(cookie, "HttpOnly") {
+		t.Fatalf("Set-Cookie %q after Flush, want Secure and HttpOnly", cookie)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/services/backup"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+)
+
+const usage = `用法:
+  backup run                 立即备份并清理过期备份
+  backup schedule            按 backup.schedule 定时备份（常驻）
+  backup list                列出本地备份
+  backup restore -file PATH  从本地文件或 s3:// 地址恢复数据库
+`
+
+func main() {
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	service := backup.NewService(cfg.Database, cfg.Backup)
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "run":
+		if _, err := service.Run(ctx); err != nil {
+			log.Fatalf("Backup failed: %v", err)
+		}
+		if _, err := service.Prune(); err != nil {
+			log.Fatalf("Prune failed: %v", err)
+		}
+
+	case "schedule":
+		sched := scheduler.New()
+		if err := sched.Add(scheduler.Job{
+			ID:   "backup",
+			Spec: cfg.Backup.Schedule,
+			Run: func() {
+				if _, err := service.Run(ctx); err != nil {
+					logrus.Errorf("Backup failed: %v", err)
+					return
+				}
+				if _, err := service.Prune(); err != nil {
+					logrus.Errorf("Prune failed: %v", err)
+				}
+			},
+		}); err != nil {
+			log.Fatalf("Invalid backup schedule: %v", err)
+		}
+		sched.Start()
+		logrus.Infof("Backup scheduler started: %s", cfg.Backup.Schedule)
+
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		<-quit
+		sched.Stop()
+
+	case "list":
+		files, err := service.List()
+		if err != nil {
+			log.Fatalf("List failed: %v", err)
+		}
+		for _, f := range files {
+			fmt.Println(f)
+		}
+
+	case "restore":
+		fs := flag.NewFlagSet("restore", flag.ExitOnError)
+		file := fs.String("file", "", "备份文件路径或 s3:// 地址")
+		fs.Parse(os.Args[2:])
+		if *file == "" {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		if err := service.Restore(ctx, *file); err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
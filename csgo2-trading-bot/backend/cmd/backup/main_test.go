@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database"
+	"csgo2-trading-bot/database/dbtest"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/backup"
+)
+
+// envRunMain 设置后测试二进制直接执行main，用于以子进程运行命令
+const envRunMain = "BACKUP_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envRunMain) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// TestRestoreCommand 以子进程运行 backup restore -file，确认恢复后的空库与导出的库数据一致。
+// 需要TEST_DATABASE_URL（账号有CREATEDB权限）以及PATH中的pg_dump、pg_restore
+func TestRestoreCommand(t *testing.T) {
+	for _, tool := range []string{"pg_dump", "pg_restore"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found in PATH, skipping restore test", tool)
+		}
+	}
+
+	srcCfg := dbtest.CreateDatabase(t)
+	src := dbtest.Connect(t, srcCfg)
+	if err := database.Migrate(src); err != nil {
+		t.Fatalf("migrate source: %v", err)
+	}
+	items := make([]models.Item, 50)
+	for i := range items {
+		items[i] = models.Item{MarketHashName: fmt.Sprintf("Restore Command #%d", i), CurrentPrice: float64(i) / 3}
+	}
+	if err := src.Create(&items).Error; err != nil {
+		t.Fatalf("seed items: %v", err)
+	}
+	want := dbtest.TakeSnapshot(t, src)
+
+	dir := t.TempDir()
+	path, err := backup.NewService(srcCfg, config.BackupConfig{Dir: dir}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("dump source: %v", err)
+	}
+
+	// 命令从工作目录读取config.yaml，指向新建的空库
+	dstCfg := dbtest.CreateDatabase(t)
+	yaml := fmt.Sprintf("database:\n  host: %q\n  port: %d\n  user: %q\n  password: %q\n  dbname: %q\n  sslmode: %q\nbackup:\n  dir: %q\n",
+		dstCfg.Host, dstCfg.Port, dstCfg.User, dstCfg.Password, dstCfg.DBName, dstCfg.SSLMode, dir)
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(exe, "restore", "-file", path)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), envRunMain+"=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("backup restore: %v\n%s", err, out)
+	}
+
+	got := dbtest.TakeSnapshot(t, dbtest.Connect(t, dstCfg))
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("restored database differs from the dump source:\nwant %+v\ngot  %+v", want, got)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"csgo2-trading-bot/services/platforms/mock"
+)
+
+// mockmarket 启动模拟的平台接口，供本地端到端运行和CI集成测试使用。
+// 在配置中把各连接器的sandbox_url指向 http://ADDR/bitskins、http://ADDR/marketcsgo，
+// 目录导入的catalog.url指向 http://ADDR/steam/market/search/render/ 即可。
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8099", "监听地址")
+	balance := flag.Float64("balance", 10000, "各平台初始余额（美元）")
+	failRate := flag.Float64("fail-rate", 0, "请求随机失败的比例，0-1")
+	latency := flag.Duration("latency", 0, "每个请求的额外延迟")
+	seed := flag.Int64("seed", 1, "随机数种子，相同种子的失败序列一致")
+	flag.Parse()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", *addr, err)
+	}
+
+	server := httptest.NewUnstartedServer(mock.New(mock.Options{
+		Balance:  *balance,
+		FailRate: *failRate,
+		Latency:  *latency,
+		Seed:     *seed,
+	}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	log.Printf("Mock marketplaces listening on %s", server.URL)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database"
+	"csgo2-trading-bot/services/verify"
+)
+
+// verify 运行数据完整性检查并输出JSON报告，存在违规时退出码为1
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, err := database.Initialize(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+
+	report := verify.NewService(db).Run(context.Background())
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if !report.Passed {
+		os.Exit(1)
+	}
+}
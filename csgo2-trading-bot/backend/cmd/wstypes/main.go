@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/websocket"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// wstypes 根据websocket包中的消息结构生成前端TypeScript类型定义
+func main() {
+	out := flag.String("out", "../frontend/src/types/websocket.ts", "output file")
+	flag.Parse()
+
+	g := &generator{seen: make(map[reflect.Type]bool)}
+	var members []string
+	for _, schema := range websocket.Schemas {
+		data := "unknown"
+		if schema.Payload != nil {
+			data = g.typeOf(reflect.TypeOf(schema.Payload))
+		}
+		name := messageName(schema.Type)
+		g.decls = append(g.decls, fmt.Sprintf("export interface %s extends WSEnvelope {\n  type: '%s';\n  data: %s;\n}\n", name, schema.Type, data))
+		members = append(members, name)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by backend/cmd/wstypes. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "export const WS_SCHEMA_VERSION = %d;\n\n", websocket.SchemaVersion)
+	buf.WriteString("export interface WSEnvelope {\n  type: string;\n  schema?: number;\n  seq?: number;\n  data: unknown;\n}\n\n")
+	buf.WriteString(strings.Join(g.decls, "\n"))
+	fmt.Fprintf(&buf, "\nexport type WSMessage =\n  | %s;\n", strings.Join(members, "\n  | "))
+
+	if err := os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *out, err)
+	}
+}
+
+type generator struct {
+	seen  map[reflect.Type]bool
+	decls []string
+}
+
+// typeOf 返回Go类型对应的TypeScript类型，结构体会生成同名interface
+func (g *generator) typeOf(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "string"
+	case t == rawType:
+		return "unknown"
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.typeOf(t.Elem()) + " | null"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		elem := g.typeOf(t.Elem())
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return fmt.Sprintf("Record<string, %s>", g.typeOf(t.Elem()))
+	case reflect.Struct:
+		g.declare(t)
+		return t.Name()
+	default:
+		return "unknown"
+	}
+}
+
+func (g *generator) declare(t reflect.Type) {
+	if g.seen[t] {
+		return
+	}
+	g.seen[t] = true
+
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		optional := ""
+		if strings.Contains(opts, "omitempty") {
+			optional = "?"
+		}
+		fields = append(fields, fmt.Sprintf("  %s%s: %s;\n", name, optional, g.typeOf(field.Type)))
+	}
+	g.decls = append(g.decls, fmt.Sprintf("export interface %s {\n%s}\n", t.Name(), strings.Join(fields, "")))
+}
+
+// messageName price_update -> PriceUpdateMessage
+func messageName(msgType string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(msgType, "_") {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	b.WriteString("Message")
+	return b.String()
+}
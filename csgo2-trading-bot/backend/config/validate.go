@@ -0,0 +1,361 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+)
+
+// 问题级别
+const (
+	LevelError    = "error"    // 无论运行模式都拒绝启动
+	LevelInsecure = "insecure" // 不安全或未替换的默认值，生产环境下拒绝启动
+	LevelWarning  = "warning"
+)
+
+// 签名密钥的最短长度
+const minSecretLength = 32
+
+// 仓库中示例配置自带的凭据，生产环境必须替换
+var knownDefaults = map[string]bool{
+	"csgo2_password":  true,
+	"your-secret-key": true,
+	"changeme":        true,
+	"secret":          true,
+	"password":        true,
+}
+
+// Issue 配置检查发现的一个问题
+type Issue struct {
+	Level   string
+	Key     string // 配置项，如 steam.shared_secret
+	Message string
+}
+
+// Report 配置检查结果
+type Report struct {
+	Production bool
+	Issues     []Issue
+}
+
+// Fatal 是否应拒绝启动：存在错误，或生产环境下存在不安全的默认值
+func (r *Report) Fatal() bool {
+	for _, issue := range r.Issues {
+		if issue.Level == LevelError || (issue.Level == LevelInsecure && r.Production) {
+			return true
+		}
+	}
+	return false
+}
+
+// Table 以表格形式输出检查结果
+func (r *Report) Table() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LEVEL\tKEY\tPROBLEM")
+	for _, issue := range r.Issues {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", issue.Level, issue.Key, issue.Message)
+	}
+	w.Flush()
+	return b.String()
+}
+
+func (r *Report) add(level, key, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Level: level, Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// secret 检查密钥：为空、仍是未替换的${ENV}占位符或示例值时视为不安全，minLength大于0时同时检查长度
+func (r *Report) secret(key, value string, minLength int) {
+	switch {
+	case value == "":
+		r.add(LevelInsecure, key, "not set")
+	case strings.Contains(value, "${"):
+		r.add(LevelInsecure, key, "unresolved placeholder %s, set the value directly or through the environment", value)
+	case knownDefaults[value]:
+		r.add(LevelInsecure, key, "uses the example value from the repository")
+	case minLength > 0 && len(value) < minLength:
+		r.add(LevelInsecure, key, "shorter than %d characters", minLength)
+	}
+}
+
+// url 检查地址格式，required为false时允许为空
+func (r *Report) url(key, value string, required bool) {
+	if value == "" {
+		if required {
+			r.add(LevelError, key, "not set")
+		}
+		return
+	}
+	if strings.Contains(value, "${") {
+		r.add(LevelInsecure, key, "unresolved placeholder %s", value)
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		r.add(LevelError, key, "invalid URL %q, expected http(s)://host/...", value)
+	}
+}
+
+// port 检查端口范围
+func (r *Report) port(key string, value int) {
+	if value < 1 || value > 65535 {
+		r.add(LevelError, key, "port %d out of range 1-65535", value)
+	}
+}
+
+// positive 检查数值大于0
+func (r *Report) positive(key string, value int) {
+	if value <= 0 {
+		r.add(LevelError, key, "must be greater than 0, got %d", value)
+	}
+}
+
+// Validate 启动前检查配置，server.mode为production或release时视为生产环境
+func (c *Config) Validate() *Report {
+	r := &Report{Production: c.Server.Mode == "production" || c.Server.Mode == "release"}
+
+	// 服务
+	switch c.Server.Mode {
+	case "debug", "test", "production", "release":
+	default:
+		r.add(LevelError, "server.mode", "unknown mode %q, expected debug, test or production", c.Server.Mode)
+	}
+	r.port("server.port", c.Server.Port)
+	if c.Server.TLS.Enabled {
+		if c.Server.TLS.AutoCert {
+			if len(c.Server.TLS.Domains) == 0 {
+				r.add(LevelError, "server.tls.domains", "required when autocert is enabled")
+			}
+		} else if c.Server.TLS.CertFile == "" || c.Server.TLS.KeyFile == "" {
+			r.add(LevelError, "server.tls.cert_file", "cert_file and key_file are required unless autocert is enabled")
+		}
+		if c.Server.TLS.RedirectHTTP {
+			r.port("server.tls.http_port", c.Server.TLS.HTTPPort)
+			if c.Server.TLS.HTTPPort == c.Server.Port {
+				r.add(LevelError, "server.tls.http_port", "must differ from server.port")
+			}
+		}
+	} else if r.Production {
+		r.add(LevelWarning, "server.tls.enabled", "TLS is off, make sure a reverse proxy terminates HTTPS")
+	}
+
+	// 数据库和Redis
+	if c.Database.Host == "" {
+		r.add(LevelError, "database.host", "not set")
+	}
+	r.port("database.port", c.Database.Port)
+	r.secret("database.password", c.Database.Password, 0)
+	if c.Database.SSLMode == "disable" && r.Production && c.Database.Host != "localhost" && c.Database.Host != "127.0.0.1" {
+		r.add(LevelWarning, "database.sslmode", "connections to a remote database are not encrypted")
+	}
+	switch c.Redis.Mode {
+	case "", "single":
+		r.port("redis.port", c.Redis.Port)
+	case "sentinel":
+		if c.Redis.MasterName == "" || len(c.Redis.Addrs) == 0 {
+			r.add(LevelError, "redis.addrs", "sentinel mode requires master_name and addrs")
+		}
+	case "cluster":
+		if len(c.Redis.Addrs) == 0 {
+			r.add(LevelError, "redis.addrs", "cluster mode requires addrs")
+		}
+	default:
+		r.add(LevelError, "redis.mode", "unknown mode %q, expected single, sentinel or cluster", c.Redis.Mode)
+	}
+
+	// 登录：shared_secret同时是JWT和各类签名链接的密钥
+	r.secret("steam.shared_secret", c.Steam.SharedSecret, minSecretLength)
+	if strings.Contains(c.Steam.APIKey, "${") || c.Steam.APIKey == "" {
+		r.add(LevelWarning, "steam.api_key", "not set, Steam login cannot load user profiles")
+	}
+	r.url("steam.login_url", c.Steam.LoginURL, true)
+	if c.Steam.CallbackURL == "" {
+		r.add(LevelInsecure, "steam.callback_url", "not set, Steam login will not return to this server")
+	}
+	r.url("steam.callback_url", c.Steam.CallbackURL, false)
+	r.positive("steam.access_token_ttl", c.Steam.AccessTokenTTL)
+	if c.Steam.RefreshTokenTTL < c.Steam.AccessTokenTTL {
+		r.add(LevelError, "steam.refresh_token_ttl", "must not be shorter than access_token_ttl")
+	}
+
+	// 交易平台：启用时必须配置凭据
+	if c.Trading.BuffAPI.Enabled {
+		r.url("trading.buff.base_url", c.Trading.BuffAPI.BaseURL, true)
+		r.secret("trading.buff.cookie", c.Trading.BuffAPI.Cookie, 0)
+		if proxies := c.Trading.BuffAPI.Proxies; proxies.Enabled {
+			if len(proxies.Proxies) == 0 && proxies.ProviderURL == "" {
+				r.add(LevelError, "trading.buff.proxies", "requires proxies or provider_url when enabled")
+			}
+			r.url("trading.buff.proxies.provider_url", proxies.ProviderURL, false)
+			if proxies.MinScore < 0 || proxies.MinScore >= 1 {
+				r.add(LevelError, "trading.buff.proxies.min_score", "must be between 0 and 1, got %v", proxies.MinScore)
+			}
+		}
+		session := c.Trading.BuffAPI.Session
+		r.positive("trading.buff.session.check_interval", session.CheckInterval)
+		if !strings.HasPrefix(session.CheckPath, "/") {
+			r.add(LevelError, "trading.buff.session.check_path", "must be a path starting with /, got %q", session.CheckPath)
+		}
+	}
+	if c.Trading.YouPin.Enabled {
+		r.url("trading.youpin.base_url", c.Trading.YouPin.BaseURL, true)
+		r.secret("trading.youpin.api_secret", c.Trading.YouPin.APISecret, 0)
+	}
+	if c.Trading.BitSkins.Enabled {
+		r.url("trading.bitskins.base_url", c.Trading.BitSkins.BaseURL, true)
+		r.url("trading.bitskins.sandbox_url", c.Trading.BitSkins.SandboxURL, false)
+		r.secret("trading.bitskins.api_key", c.Trading.BitSkins.APIKey, 0)
+	}
+	if c.Trading.MarketCSGO.Enabled {
+		r.url("trading.market_csgo.base_url", c.Trading.MarketCSGO.BaseURL, true)
+		r.secret("trading.market_csgo.api_key", c.Trading.MarketCSGO.APIKey, 0)
+	}
+	r.positive("trading.execution.workers", c.Trading.Execution.Workers)
+	r.positive("trading.execution.claim_idle", c.Trading.Execution.ClaimIdle)
+	r.positive("trading.order_triggers.interval", c.Trading.OrderTriggers.Interval)
+	if c.Trading.Execution.StaleAfter <= c.Trading.Execution.ClaimIdle {
+		r.add(LevelError, "trading.execution.stale_after", "must be longer than claim_idle")
+	}
+	if perf := c.Trading.Performance; perf.Enabled {
+		r.positive("trading.performance.interval", perf.Interval)
+		r.positive("trading.performance.days", perf.Days)
+	}
+	if review := c.Trading.StrategyReview; review.Enabled {
+		r.positive("trading.strategy_review.interval", review.Interval)
+		r.positive("trading.strategy_review.idle_days", review.IdleDays)
+		r.positive("trading.strategy_review.loss_days", review.LossDays)
+	}
+	if halt := c.Trading.AnomalyHalt; halt.Enabled {
+		r.positive("trading.anomaly_halt.interval", halt.Interval)
+		if halt.MaxDeviation <= 0 {
+			r.add(LevelError, "trading.anomaly_halt.max_deviation", "must be greater than 0, got %v", halt.MaxDeviation)
+		}
+	}
+
+	// 出站请求
+	r.positive("http_client.retry.attempts", c.HTTPClient.Retry.Attempts)
+	if c.HTTPClient.Retry.Attempts > 1 && c.HTTPClient.Retry.MaxDelay < c.HTTPClient.Retry.BaseDelay {
+		r.add(LevelError, "http_client.retry.max_delay", "must not be shorter than base_delay")
+	}
+	for platform, budget := range c.HTTPClient.Budgets {
+		r.positive("http_client.budgets."+platform+".requests", budget.Requests)
+		r.positive("http_client.budgets."+platform+".per", budget.Per)
+	}
+
+	// 外部数据源
+	if c.FX.Provider != "static" {
+		r.url("fx.url", c.FX.URL, true)
+	}
+	if c.Catalog.Enabled {
+		r.url("catalog.url", c.Catalog.URL, true)
+	}
+	if c.Inspect.Enabled {
+		r.url("inspect.url", c.Inspect.URL, true)
+	}
+	if c.Depth.Enabled {
+		r.url("depth.listing_url", c.Depth.ListingURL, true)
+		r.url("depth.histogram_url", c.Depth.HistogramURL, true)
+		r.positive("depth.interval", c.Depth.Interval)
+		if len(c.Depth.Regions) > 0 {
+			r.positive("depth.region_interval", c.Depth.RegionInterval)
+		}
+		seen := make(map[string]bool, len(c.Depth.Regions))
+		for i, region := range c.Depth.Regions {
+			key := fmt.Sprintf("depth.regions[%d]", i)
+			if region.Code == "" || region.Country == "" || region.Currency == "" {
+				r.add(LevelError, key, "requires code, country and currency")
+			}
+			if seen[region.Code] {
+				r.add(LevelError, key, "duplicate region code %q", region.Code)
+			}
+			seen[region.Code] = true
+		}
+	}
+
+	// 通知渠道
+	if c.Telegram.Enabled {
+		r.secret("telegram.token", c.Telegram.Token, 0)
+		r.url("telegram.api_url", c.Telegram.APIURL, true)
+	}
+	if c.Email.Enabled {
+		if c.Email.Host == "" || c.Email.From == "" {
+			r.add(LevelError, "email.host", "host and from are required when email is enabled")
+		}
+		r.port("email.port", c.Email.Port)
+	}
+	if c.WeChat.Enabled {
+		r.url("wechat.serverchan_url", c.WeChat.ServerChanURL, true)
+		r.url("wechat.wecom_url", c.WeChat.WeComURL, true)
+	}
+
+	// 文件存储
+	switch c.Storage.Driver {
+	case "", "local":
+		r.url("storage.public_url", c.Storage.PublicURL, true)
+		if r.Production && strings.Contains(c.Storage.PublicURL, "localhost") {
+			r.add(LevelWarning, "storage.public_url", "points to localhost, download links will not work for users")
+		}
+	case "s3":
+		if c.Storage.S3.Bucket == "" {
+			r.add(LevelError, "storage.s3.bucket", "required for the s3 driver")
+		}
+		r.url("storage.s3.endpoint", c.Storage.S3.Endpoint, false)
+		r.secret("storage.s3.secret_access_key", c.Storage.S3.SecretAccessKey, 0)
+	default:
+		r.add(LevelError, "storage.driver", "unknown driver %q, expected local or s3", c.Storage.Driver)
+	}
+	r.positive("storage.url_ttl", c.Storage.URLTTL)
+	if c.Exports.WorkDir == "" {
+		r.add(LevelError, "exports.work_dir", "not set")
+	}
+	r.positive("exports.file_ttl", c.Exports.FileTTL)
+
+	// WebSocket推送
+	r.positive("websocket.send_queue", c.WebSocket.SendQueue)
+	if c.WebSocket.SlowThreshold <= 0 || c.WebSocket.SlowThreshold > 1 {
+		r.add(LevelError, "websocket.slow_threshold", "must be greater than 0 and at most 1, got %v", c.WebSocket.SlowThreshold)
+	}
+	if p := c.WebSocket.OverflowPolicy; p != "disconnect" && p != "drop" {
+		r.add(LevelError, "websocket.overflow_policy", "must be disconnect or drop, got %q", p)
+	}
+
+	// 性能剖析
+	if c.Profiling.Continuous {
+		if c.Profiling.Dir == "" {
+			r.add(LevelError, "profiling.dir", "not set")
+		}
+		r.positive("profiling.cpu_duration", c.Profiling.CPUDuration)
+		r.positive("profiling.keep", c.Profiling.Keep)
+		if c.Profiling.Interval <= c.Profiling.CPUDuration {
+			r.add(LevelError, "profiling.interval", "must be longer than cpu_duration")
+		}
+	}
+
+	// 事务发件箱
+	r.positive("outbox.interval", c.Outbox.Interval)
+	r.positive("outbox.batch_size", c.Outbox.BatchSize)
+	r.positive("outbox.retention_hours", c.Outbox.RetentionHours)
+
+	// 库存估值快照
+	if c.Valuation.Enabled && c.Valuation.Schedule == "" {
+		r.add(LevelError, "valuation.schedule", "not set")
+	}
+
+	// 限流
+	if c.RateLimit.Enabled {
+		r.positive("rate_limit.window", c.RateLimit.Window)
+		r.positive("rate_limit.history_days", c.RateLimit.HistoryDays)
+		for i, route := range c.RateLimit.Routes {
+			key := fmt.Sprintf("rate_limit.routes[%d]", i)
+			if route.By != "" && route.By != "ip" && route.By != "user" {
+				r.add(LevelError, key, "by must be ip or user, got %q", route.By)
+			}
+			if route.Limit <= 0 || !strings.HasPrefix(route.Path, "/") {
+				r.add(LevelError, key, "requires a path starting with / and a positive limit")
+			}
+		}
+	}
+
+	return r
+}
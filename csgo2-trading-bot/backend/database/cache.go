@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCacheUnavailable Redis不可用时返回，调用方应回退到数据库
+var ErrCacheUnavailable = errors.New("cache unavailable")
+
+// cacheCooldown Redis出错后跳过缓存的时间，避免每个请求都等待超时
+const cacheCooldown = 10 * time.Second
+
+// Cache 对Redis的缓存读写做降级处理：出错时跳过缓存而不是让请求失败
+type Cache struct {
+	client    redis.UniversalClient
+	downUntil atomic.Int64
+
+	hits     atomic.Int64
+	misses   atomic.Int64
+	failures atomic.Int64
+	skipped  atomic.Int64
+}
+
+// CacheStats 缓存降级指标
+type CacheStats struct {
+	Available bool  `json:"available"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Failures  int64 `json:"failures"`
+	Skipped   int64 `json:"skipped"`
+}
+
+func NewCache(client redis.UniversalClient) *Cache {
+	return &Cache{client: client}
+}
+
+// Client 返回底层Redis客户端（发布订阅等非缓存用途）
+func (c *Cache) Client() redis.UniversalClient {
+	return c.client
+}
+
+// Available Redis当前是否可用
+func (c *Cache) Available() bool {
+	return time.Now().UnixNano() >= c.downUntil.Load()
+}
+
+// Get 读取缓存，未命中返回redis.Nil，Redis不可用返回ErrCacheUnavailable
+func (c *Cache) Get(ctx context.Context, key string) (string, error) {
+	if !c.Available() {
+		c.skipped.Add(1)
+		return "", ErrCacheUnavailable
+	}
+
+	value, err := c.client.Get(ctx, key).Result()
+	switch {
+	case err == nil:
+		c.hits.Add(1)
+		return value, nil
+	case errors.Is(err, redis.Nil):
+		c.misses.Add(1)
+		return "", err
+	default:
+		c.markDown(err)
+		return "", ErrCacheUnavailable
+	}
+}
+
+// Set 写入缓存，Redis不可用时跳过
+func (c *Cache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) {
+	if !c.Available() {
+		c.skipped.Add(1)
+		return
+	}
+
+	if err := c.client.Set(ctx, key, value, ttl).Err(); err != nil {
+		c.markDown(err)
+	}
+}
+
+// Del 删除缓存，Redis不可用时跳过
+func (c *Cache) Del(ctx context.Context, keys ...string) {
+	if !c.Available() {
+		c.skipped.Add(1)
+		return
+	}
+
+	if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		c.markDown(err)
+	}
+}
+
+// Stats 返回缓存降级指标
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Available: c.Available(),
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Failures:  c.failures.Load(),
+		Skipped:   c.skipped.Load(),
+	}
+}
+
+func (c *Cache) markDown(err error) {
+	c.failures.Add(1)
+	c.downUntil.Store(time.Now().Add(cacheCooldown).UnixNano())
+	logrus.Warnf("Redis unavailable, degrading cache for %s: %v", cacheCooldown, err)
+}
@@ -8,6 +8,7 @@ import (
 	"csgo2-trading-bot/models"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -34,7 +35,21 @@ func Initialize(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
-	// 自动迁移
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
+
+	if cfg.TimescaleDB {
+		if err := setupTimescale(db, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+// Migrate 自动迁移表结构并创建索引、触发器等AutoMigrate无法表达的对象，可重复执行
+func Migrate(db *gorm.DB) error {
 	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Item{},
@@ -43,20 +58,149 @@ func Initialize(cfg config.DatabaseConfig) (*gorm.DB, error) {
 		&models.Transaction{},
 		&models.Strategy{},
 		&models.Inventory{},
+		&models.Position{},
+		&models.PortfolioSnapshot{},
 		&models.MarketData{},
+		&models.Notification{},
+		&models.Subscription{},
+		&models.SavedView{},
+		&models.PriceAggregate{},
+		&models.RetentionRun{},
+		&models.ItemWatch{},
+		&models.Annotation{},
+		&models.AuditLog{},
+		&models.CatalogImport{},
+		&models.StrategyState{},
+		&models.AppraisalShare{},
+		&models.ItemMention{},
+		&models.PriceAlert{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.LedgerEntry{},
+		&models.TelegramLink{},
+		&models.OrderEvent{},
+		&models.EmailSubscription{},
+		&models.LoginDevice{},
+		&models.UserSession{},
+		&models.WeChatBinding{},
+		&models.NotificationPreference{},
+		&models.SlicedOrder{},
+		&models.RoutingPreference{},
+		&models.OrderLatency{},
+		&models.NewItemSubscription{},
+		&models.FeeScheduleVersion{},
+		&models.StrategyRunLog{},
+		&models.OrderBookSnapshot{},
+		&models.SteamRegionalPrice{},
+		&models.StrategyExperiment{},
+		&models.APIKey{},
+		&models.StoredFile{},
+		&models.ExportJob{},
+		&models.PlatformSession{},
+		&models.OutboxEvent{},
+		&models.StrategySuggestion{},
 	); err != nil {
-		return nil, err
+		return err
 	}
 
-	return db, nil
+	if err := createIndexes(db); err != nil {
+		return err
+	}
+
+	if err := seedPositions(db); err != nil {
+		return err
+	}
+
+	return protectAuditLogs(db)
 }
 
-func InitRedis(cfg config.RedisConfig) *redis.Client {
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
+// createIndexes 创建AutoMigrate无法通过标签表达的索引
+func createIndexes(db *gorm.DB) error {
+	// 订单搜索：按用户过滤并按创建时间倒序分页
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_orders_user_created ON orders (user_id, created_at DESC)").Error; err != nil {
+		return err
+	}
+
+	// 价格历史按物品和时间范围查询
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_price_histories_item_time ON price_histories (item_id, recorded_at DESC)").Error; err != nil {
+		return err
+	}
+
+	// 物品名称模糊搜索依赖pg_trgm扩展，没有权限创建扩展时退化为顺序扫描
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		logrus.Warnf("pg_trgm unavailable, item name search will not be indexed: %v", err)
+		return nil
+	}
+	for _, stmt := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_items_name_trgm ON items USING gin (name gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_items_market_hash_name_trgm ON items USING gin (market_hash_name gin_trgm_ops)",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seedPositions 为还没有持仓记录的用户和物品按现有库存批次建立持仓，平均成本取批次买入价的加权平均；
+// 之后持仓随成交更新，已存在的记录不会被覆盖
+func seedPositions(db *gorm.DB) error {
+	return db.Exec(`
+		INSERT INTO positions (created_at, updated_at, user_id, item_id, quantity, avg_price, realized_pnl)
+		SELECT NOW(), NOW(), user_id, item_id, SUM(quantity), SUM(quantity * buy_price) / SUM(quantity), 0
+		FROM inventories
+		WHERE deleted_at IS NULL AND quantity > 0
+		GROUP BY user_id, item_id
+		ON CONFLICT (user_id, item_id) DO NOTHING`).Error
+}
 
-	return client
+// protectAuditLogs 审计日志只允许追加，触发器拒绝对已有记录的修改和删除
+func protectAuditLogs(db *gorm.DB) error {
+	for _, stmt := range []string{
+		`CREATE OR REPLACE FUNCTION audit_logs_immutable() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_logs is append-only';
+		END;
+		$$ LANGUAGE plpgsql`,
+		"DROP TRIGGER IF EXISTS audit_logs_immutable ON audit_logs",
+		"CREATE TRIGGER audit_logs_immutable BEFORE UPDATE OR DELETE ON audit_logs FOR EACH ROW EXECUTE FUNCTION audit_logs_immutable()",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func InitRedis(cfg config.RedisConfig) (redis.UniversalClient, error) {
+	switch cfg.Mode {
+	case "", "single":
+		return redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+			Password: cfg.Password,
+			DB:       cfg.DB,
+		}), nil
+	case "sentinel":
+		if cfg.MasterName == "" || len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("redis sentinel mode requires master_name and addrs")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addrs,
+			SentinelPassword: cfg.SentinelPassword,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+		}), nil
+	case "cluster":
+		if len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("redis cluster mode requires addrs")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:    cfg.Addrs,
+			Password: cfg.Password,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown redis mode: %s", cfg.Mode)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,182 @@
+// Package dbtest 集成测试使用的PostgreSQL数据库。
+// TEST_DATABASE_URL指向一个可以创建schema的测试库，每个测试在独立的schema中迁移表结构，结束后删除；
+// 未设置时跳过测试。例如：
+//
+//	TEST_DATABASE_URL="host=localhost user=postgres password=postgres dbname=csgo2_test sslmode=disable" go test ./...
+package dbtest
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// EnvDatabaseURL 测试库连接串的环境变量
+const EnvDatabaseURL = "TEST_DATABASE_URL"
+
+// Open 创建独立schema并迁移表结构，返回只访问该schema（和public中的扩展）的连接
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, _ := OpenSchema(t)
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test schema: %v", err)
+	}
+	return db
+}
+
+// OpenSchema 创建独立的空schema，不迁移表结构，同时返回schema名称
+func OpenSchema(t testing.TB) (*gorm.DB, string) {
+	t.Helper()
+	dsn := os.Getenv(EnvDatabaseURL)
+	if dsn == "" {
+		t.Skipf("%s is not set, skipping database test", EnvDatabaseURL)
+	}
+
+	admin := open(t, dsn)
+	schema := fmt.Sprintf("test_%d_%d", time.Now().UnixNano(), rand.Intn(1000))
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("create test schema: %v", err)
+	}
+
+	db := open(t, WithSearchPath(dsn, schema))
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db, schema
+}
+
+// WithSearchPath 在连接串中指定search_path，同时支持URL和key=value两种格式
+func WithSearchPath(dsn, schema string) string {
+	path := schema + ",public"
+	if strings.Contains(dsn, "://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + "search_path=" + strings.ReplaceAll(path, ",", "%2C")
+	}
+	return dsn + " search_path=" + path
+}
+
+// CreateDatabase 在测试库所在的实例上创建空数据库（需要CREATEDB权限），返回其连接配置，测试结束后删除。
+// 用于pg_dump、pg_restore等按整库操作的测试
+func CreateDatabase(t testing.TB) config.DatabaseConfig {
+	t.Helper()
+	dsn := os.Getenv(EnvDatabaseURL)
+	if dsn == "" {
+		t.Skipf("%s is not set, skipping database test", EnvDatabaseURL)
+	}
+	parsed, err := pgconn.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("parse %s: %v", EnvDatabaseURL, err)
+	}
+
+	admin := open(t, dsn)
+	name := fmt.Sprintf("test_%d_%d", time.Now().UnixNano(), rand.Intn(1000))
+	if err := admin.Exec("CREATE DATABASE " + name).Error; err != nil {
+		t.Fatalf("create test database: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	sslMode := "disable"
+	if parsed.TLSConfig != nil {
+		sslMode = "require"
+	}
+	return config.DatabaseConfig{
+		Host:     parsed.Host,
+		Port:     int(parsed.Port),
+		User:     parsed.User,
+		Password: parsed.Password,
+		DBName:   name,
+		SSLMode:  sslMode,
+	}
+}
+
+// Connect 连接CreateDatabase创建的数据库，不迁移表结构，测试结束后关闭
+func Connect(t testing.TB, cfg config.DatabaseConfig) *gorm.DB {
+	t.Helper()
+	db := open(t, fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+		cfg.Host, cfg.User, cfg.Password, cfg.DBName, cfg.Port, cfg.SSLMode))
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// TableChecksum 表的行数和全部行按文本排序后的md5
+type TableChecksum struct {
+	Rows int64
+	MD5  string
+}
+
+// Snapshot public中每个表的校验和与每个序列的当前值，两个库的Snapshot相等说明数据一致
+type Snapshot struct {
+	Tables    map[string]TableChecksum
+	Sequences map[string]int64
+}
+
+// TakeSnapshot 计算库中数据的Snapshot
+func TakeSnapshot(t testing.TB, db *gorm.DB) Snapshot {
+	t.Helper()
+	var tables []string
+	if err := db.Raw(`SELECT table_name FROM information_schema.tables
+		WHERE table_schema = 'public' AND table_type = 'BASE TABLE' ORDER BY table_name`).Scan(&tables).Error; err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+
+	snapshot := Snapshot{Tables: make(map[string]TableChecksum), Sequences: make(map[string]int64)}
+	for _, table := range tables {
+		var sum TableChecksum
+		if err := db.Raw(fmt.Sprintf(`SELECT count(*) AS rows, coalesce(md5(string_agg(r::text, E'\n' ORDER BY r::text)), '') AS md5
+			FROM public.%q r`, table)).Scan(&sum).Error; err != nil {
+			t.Fatalf("checksum %s: %v", table, err)
+		}
+		snapshot.Tables[table] = sum
+	}
+
+	var sequences []struct {
+		Name  string
+		Value int64
+	}
+	if err := db.Raw(`SELECT sequencename AS name, coalesce(last_value, 0) AS value
+		FROM pg_sequences WHERE schemaname = 'public'`).Scan(&sequences).Error; err != nil {
+		t.Fatalf("list sequences: %v", err)
+	}
+	for _, seq := range sequences {
+		snapshot.Sequences[seq.Name] = seq.Value
+	}
+	return snapshot
+}
+
+func open(t testing.TB, dsn string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	return db
+}
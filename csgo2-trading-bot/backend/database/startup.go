@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"csgo2-trading-bot/config"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// WaitFor 按指数退避重试check，直到成功或超过最大等待时间
+func WaitFor(name string, cfg config.StartupConfig, check func() error) error {
+	deadline := time.Now().Add(time.Duration(cfg.MaxWait) * time.Second)
+	backoff := time.Duration(cfg.InitialBackoff) * time.Second
+	maxBackoff := time.Duration(cfg.MaxBackoff) * time.Second
+
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil {
+			if attempt > 1 {
+				logrus.Infof("%s is ready after %d attempts", name, attempt)
+			}
+			return nil
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			return fmt.Errorf("%s not ready after %d attempts: %w", name, attempt, err)
+		}
+
+		logrus.Warnf("%s not ready (attempt %d), retrying in %s: %v", name, attempt, backoff, err)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// InitializeWithRetry 等待数据库可用后初始化
+func InitializeWithRetry(dbCfg config.DatabaseConfig, startup config.StartupConfig) (*gorm.DB, error) {
+	var db *gorm.DB
+	err := WaitFor("database", startup, func() error {
+		var err error
+		db, err = Initialize(dbCfg)
+		return err
+	})
+	return db, err
+}
+
+// PingRedis 检查Redis是否可用
+func PingRedis(client redis.UniversalClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return client.Ping(ctx).Err()
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// PriceBucket 按时间桶聚合的价格（K线）
+type PriceBucket struct {
+	Bucket  time.Time `json:"bucket"`
+	Open    float64   `json:"open"`
+	High    float64   `json:"high"`
+	Low     float64   `json:"low"`
+	Close   float64   `json:"close"`
+	Avg     float64   `json:"avg"`
+	Volume  int       `json:"volume"`
+	Samples int       `json:"samples"`
+}
+
+// PriceStore 价格历史的读写入口，屏蔽普通表与TimescaleDB hypertable的差异
+type PriceStore struct {
+	db        *gorm.DB
+	timescale bool
+	batchSize int
+}
+
+func NewPriceStore(db *gorm.DB, cfg config.DatabaseConfig) *PriceStore {
+	batchSize := cfg.InsertBatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &PriceStore{
+		db:        db,
+		timescale: cfg.TimescaleDB,
+		batchSize: batchSize,
+	}
+}
+
+// Insert 分批写入价格历史
+func (p *PriceStore) Insert(rows []models.PriceHistory) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	return p.db.CreateInBatches(rows, p.batchSize).Error
+}
+
+// Buckets 按interval聚合物品价格，platform为空时合并所有平台
+func (p *PriceStore) Buckets(itemID uint, platform string, interval time.Duration, from, to time.Time) ([]PriceBucket, error) {
+	seconds := int64(interval.Seconds())
+	if seconds <= 0 {
+		return nil, fmt.Errorf("invalid bucket interval: %s", interval)
+	}
+
+	var query string
+	var args []interface{}
+	if p.timescale {
+		query = `
+			SELECT time_bucket(?::interval, recorded_at) AS bucket,
+			       first(price, recorded_at) AS open,
+			       MAX(price) AS high,
+			       MIN(price) AS low,
+			       last(price, recorded_at) AS close,
+			       AVG(price) AS avg,
+			       COALESCE(SUM(volume), 0) AS volume,
+			       COUNT(*) AS samples`
+		args = append(args, fmt.Sprintf("%d seconds", seconds))
+	} else {
+		query = `
+			SELECT to_timestamp(floor(extract(epoch FROM recorded_at) / ?) * ?) AS bucket,
+			       (array_agg(price ORDER BY recorded_at))[1] AS open,
+			       MAX(price) AS high,
+			       MIN(price) AS low,
+			       (array_agg(price ORDER BY recorded_at DESC))[1] AS close,
+			       AVG(price) AS avg,
+			       COALESCE(SUM(volume), 0) AS volume,
+			       COUNT(*) AS samples`
+		args = append(args, seconds, seconds)
+	}
+
+	query += `
+		FROM price_histories
+		WHERE item_id = ? AND recorded_at >= ? AND recorded_at < ? AND deleted_at IS NULL`
+	args = append(args, itemID, from, to)
+	if platform != "" {
+		query += " AND platform = ?"
+		args = append(args, platform)
+	}
+	query += " GROUP BY bucket ORDER BY bucket"
+
+	var buckets []PriceBucket
+	err := p.db.Raw(query, args...).Scan(&buckets).Error
+	return buckets, err
+}
+
+// setupTimescale 将price_histories转换为hypertable，可重复执行
+func setupTimescale(db *gorm.DB, cfg config.DatabaseConfig) error {
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS timescaledb").Error; err != nil {
+		return fmt.Errorf("timescaledb extension unavailable: %v", err)
+	}
+
+	var exists bool
+	if err := db.Raw(`SELECT EXISTS (
+		SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = 'price_histories'
+	)`).Scan(&exists).Error; err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	chunkInterval := cfg.ChunkInterval
+	if chunkInterval == "" {
+		chunkInterval = "7 days"
+	}
+
+	// hypertable的唯一约束必须包含分区列
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			"ALTER TABLE price_histories ALTER COLUMN recorded_at SET NOT NULL",
+			"ALTER TABLE price_histories DROP CONSTRAINT IF EXISTS price_histories_pkey",
+			"ALTER TABLE price_histories ADD PRIMARY KEY (id, recorded_at)",
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Exec("SELECT create_hypertable('price_histories', 'recorded_at', chunk_time_interval => ?::interval, migrate_data => true)",
+			chunkInterval).Error; err != nil {
+			return err
+		}
+
+		logrus.Infof("price_histories converted to hypertable (chunk interval %s)", chunkInterval)
+		return nil
+	})
+}
@@ -7,15 +7,46 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"csgo2-trading-bot/api"
 	"csgo2-trading-bot/config"
 	"csgo2-trading-bot/database"
+	"csgo2-trading-bot/services/activity"
+	"csgo2-trading-bot/services/admin"
+	"csgo2-trading-bot/services/alerts"
+	"csgo2-trading-bot/services/analytics"
+	"csgo2-trading-bot/services/appraisal"
+	"csgo2-trading-bot/services/audit"
 	"csgo2-trading-bot/services/auth"
+	"csgo2-trading-bot/services/catalog"
+	"csgo2-trading-bot/services/depth"
+	"csgo2-trading-bot/services/email"
+	"csgo2-trading-bot/services/exports"
+	"csgo2-trading-bot/services/fx"
+	"csgo2-trading-bot/services/httpclient"
+	"csgo2-trading-bot/services/inspect"
 	"csgo2-trading-bot/services/market"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/platformsession"
+	"csgo2-trading-bot/services/popularity"
+	"csgo2-trading-bot/services/outbox"
+	"csgo2-trading-bot/services/profiling"
+	"csgo2-trading-bot/services/proxypool"
+	"csgo2-trading-bot/services/ratelimit"
+	"csgo2-trading-bot/services/retention"
+	"csgo2-trading-bot/services/scheduler"
+	"csgo2-trading-bot/services/storage"
+	"csgo2-trading-bot/services/system"
+	"csgo2-trading-bot/services/telegram"
 	"csgo2-trading-bot/services/trading"
+	"csgo2-trading-bot/services/verify"
+	"csgo2-trading-bot/services/views"
+	"csgo2-trading-bot/services/watch"
+	"csgo2-trading-bot/services/webhooks"
+	"csgo2-trading-bot/services/wechat"
 	"csgo2-trading-bot/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -33,19 +64,375 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// 初始化数据库
-	db, err := database.Initialize(cfg.Database)
+	// 检查配置，存在错误或生产环境使用不安全的默认值时拒绝启动
+	report := cfg.Validate()
+	if len(report.Issues) > 0 {
+		fmt.Fprintf(os.Stderr, "Config check found %d problem(s):\n%s", len(report.Issues), report.Table())
+	}
+	if report.Fatal() {
+		log.Fatalf("Refusing to start with invalid config (server.mode=%s)", cfg.Server.Mode)
+	}
+
+	// 初始化数据库（等待数据库就绪）
+	db, err := database.InitializeWithRetry(cfg.Database, cfg.Startup)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
 	// 初始化Redis
-	redisClient := database.InitRedis(cfg.Redis)
+	redisClient, err := database.InitRedis(cfg.Redis)
+	if err != nil {
+		log.Fatalf("Failed to initialize redis: %v", err)
+	}
+	cache := database.NewCache(redisClient)
+
+	// Redis不可用时以只读模式启动，恢复后自动切换为正常模式
+	var readOnly atomic.Bool
+	if err := database.WaitFor("redis", cfg.Startup, func() error {
+		return database.PingRedis(redisClient)
+	}); err != nil {
+		if !cfg.Startup.AllowReadOnly {
+			log.Fatalf("Failed to connect to redis: %v", err)
+		}
+		logrus.Warnf("Starting in read-only mode: %v", err)
+		readOnly.Store(true)
+	}
+
+	// 初始化WebSocket Hub
+	hub := websocket.NewHub(cache, cfg.WebSocket)
+	go hub.Run()
+
+	// 初始化调度器
+	sched := scheduler.New()
+	sched.Start()
+
+	maintenance := system.NewMaintenance(sched, cache)
 
 	// 初始化服务
-	authService := auth.NewService(db, redisClient, cfg.Steam)
-	marketService := market.NewService(db, redisClient)
-	tradingService := trading.NewService(db, redisClient, cfg.Trading)
+	httpClients := httpclient.New(cfg.HTTPClient)
+
+	// BUFF按IP限流，启用代理池后BUFF请求轮换出口IP
+	var buffProxies *proxypool.Pool
+	if cfg.Trading.BuffAPI.Proxies.Enabled {
+		buffProxies, err = proxypool.New("buff", cfg.Trading.BuffAPI.Proxies, httpClients.Client("proxy_provider"))
+		if err != nil {
+			log.Fatalf("Invalid buff proxy config: %v", err)
+		}
+		httpClients.UseProxies("buff", buffProxies)
+		if err := buffProxies.Start(sched); err != nil {
+			logrus.Errorf("Failed to start buff proxy refresh: %v", err)
+		}
+	}
+
+	// Webhook和物品订阅的回调地址由用户指定，只允许连接公网地址
+	httpClients.PublicOnly("webhook")
+	webhookService := webhooks.NewService(db, httpClients.Client("webhook"), cfg.Webhooks)
+	activityService := activity.NewService(redisClient, cfg.Activity)
+	notifier := notify.NewRouter(db, hub, webhookService, activityService)
+
+	// BUFF使用Cookie登录，会话失效时自动刷新或通知管理员重新登录
+	var buffSession *platformsession.Manager
+	if cfg.Trading.BuffAPI.Enabled {
+		buffSession, err = platformsession.New("buff", cfg.Trading.BuffAPI.BaseURL, cfg.Trading.BuffAPI.Cookie, cfg.Trading.BuffAPI.Session, db, httpClients, notifier)
+		if err != nil {
+			log.Fatalf("Failed to load buff session: %v", err)
+		}
+		if err := buffSession.Start(sched); err != nil {
+			logrus.Errorf("Failed to start buff session check: %v", err)
+		}
+	}
+	authService := auth.NewService(db, redisClient, cfg.Steam, httpClients.Client("steam"), notifier)
+	fxProvider, err := fx.NewProvider(cfg.FX, cfg.Trading.FXRates, httpClients.Client("fx"))
+	if err != nil {
+		log.Fatalf("Invalid fx config: %v", err)
+	}
+	fxService := fx.NewService(cfg.FX, cfg.Trading.BaseCurrency, cfg.Trading.FXRates, cache, fxProvider)
+	if err := fxService.Start(sched); err != nil {
+		logrus.Errorf("Failed to start fx refresh: %v", err)
+	}
+	priceStore := database.NewPriceStore(db, cfg.Database)
+	marketService := market.NewService(db, cache, priceStore, fxService)
+	marketService.OnPriceUpdate(func(update market.PriceUpdate) {
+		websocket.BroadcastPriceUpdate(hub, update.ItemID, update.Price, update.Platform)
+	})
+	outboxRelay := outbox.NewRelay(db, cfg.Outbox)
+	tradingService := trading.NewService(db, cache, cfg.Trading, hub, sched, httpClients, fxService, notifier, activityService, outboxRelay)
+	tradingService.UseMaintenance(maintenance)
+	tradingService.WatchPrices(marketService)
+	verifyService := verify.NewService(db)
+	adminService := admin.NewService(db)
+	auditService := audit.NewService(db)
+	analyticsService := analytics.NewService(db, tradingService.SellFee)
+	appraisalService := appraisal.NewService(db, cfg.Steam.SharedSecret, cfg.Trading.BaseCurrency)
+	viewService := views.NewService(db, tradingService, marketService)
+	retentionService := retention.NewService(db, cfg.Retention)
+	watchService := watch.NewService(db, marketService, notifier, httpClients.Client("webhook"), cfg.Watch)
+	catalogSource, err := catalog.NewSource(cfg.Catalog, httpClients.Client("steam"), httpClients.Budget("steam"))
+	if err != nil {
+		log.Fatalf("Invalid catalog config: %v", err)
+	}
+	catalogService := catalog.NewService(db, catalogSource, notifier, cfg.Catalog)
+	inspectService := inspect.NewService(db, cache, httpClients.Client("inspect"), cfg.Inspect)
+	alertService := alerts.NewService(db, notifier, cfg.Alerts)
+	popularityService := popularity.NewService(db, cache, httpClients.Client("popularity"), cfg.Popularity)
+	depthService := depth.NewService(db, httpClients.Client("steam"), httpClients.Budget("steam"), fxService, tradingService.SellFee, cfg.Depth)
+	telegramService := telegram.NewService(db, httpClients.Client("telegram"), tradingService, cfg.Telegram)
+	emailService := email.NewService(db, marketService, cfg.Email)
+	wechatService := wechat.NewService(db, httpClients.Client("wechat"), cfg.WeChat)
+	fileStore, err := storage.NewStore(cfg.Storage, httpClients.Client("storage"), cfg.Steam.SharedSecret)
+	if err != nil {
+		log.Fatalf("Invalid storage config: %v", err)
+	}
+	storageService := storage.NewService(db, fileStore, cfg.Storage)
+
+	// 过期的报表和导出文件清理
+	if err := storageService.Start(sched); err != nil {
+		logrus.Errorf("Invalid storage cleanup schedule: %v", err)
+	}
+	exportService := exports.NewService(db, storageService, cfg.Exports)
+	if err := exportService.Start(sched); err != nil {
+		logrus.Errorf("Failed to start export worker: %v", err)
+	}
+
+	// 持续剖析
+	profilingService := profiling.NewService(cfg.Profiling)
+	if err := profilingService.Start(sched); err != nil {
+		logrus.Errorf("Failed to start continuous profiling: %v", err)
+	}
+
+	// 价格数据降采样与清理
+	if cfg.Retention.Enabled {
+		if err := sched.Add(scheduler.Job{
+			ID:   "price_retention",
+			Spec: cfg.Retention.Schedule,
+			Run: func() {
+				if _, err := retentionService.Run("scheduled"); err != nil {
+					logrus.Warnf("Price retention skipped: %v", err)
+				}
+			},
+		}); err != nil {
+			logrus.Errorf("Invalid retention schedule: %v", err)
+		}
+	}
+
+	// 每晚保存用户库存估值快照
+	if cfg.Valuation.Enabled {
+		if err := analyticsService.SnapshotPortfolios(sched, cfg.Valuation.Schedule, cfg.Valuation.RetentionDays); err != nil {
+			logrus.Errorf("Invalid valuation schedule: %v", err)
+		}
+	}
+
+	// 物品目录导入
+	if cfg.Catalog.Enabled {
+		if err := sched.Add(scheduler.Job{
+			ID:   "catalog_import",
+			Spec: cfg.Catalog.Schedule,
+			Run: func() {
+				if _, err := catalogService.Run("scheduled"); err != nil {
+					logrus.Warnf("Catalog import skipped: %v", err)
+				}
+			},
+		}); err != nil {
+			logrus.Errorf("Invalid catalog schedule: %v", err)
+		}
+	}
+
+	// 新物品快速通道：平台报价中出现未收录的物品时立即建档，到期后回到默认采集层级
+	if cfg.Catalog.FastTrack {
+		tradingService.OnNewItems(func(platform string, names []string) {
+			catalogService.FastTrack(platform, names)
+		})
+		if err := sched.Add(scheduler.Job{
+			ID:   "catalog_fast_track_demote",
+			Spec: (10 * time.Minute).String(),
+			Run:  catalogService.DemoteFastTrack,
+		}); err != nil {
+			logrus.Errorf("Failed to schedule fast-track demotion: %v", err)
+		}
+	}
+
+	// 库存磨损值补全
+	if cfg.Inspect.Enabled {
+		if err := inspectService.Start(sched); err != nil {
+			logrus.Errorf("Failed to start inspect enrichment: %v", err)
+		}
+	}
+
+	// 社区热度采集
+	if cfg.Popularity.Enabled {
+		if err := popularityService.Start(sched); err != nil {
+			logrus.Errorf("Failed to start popularity ingestion: %v", err)
+		}
+	}
+
+	// Steam买卖盘深度快照
+	if cfg.Depth.Enabled {
+		if err := depthService.Start(sched); err != nil {
+			logrus.Errorf("Failed to start depth snapshots: %v", err)
+		}
+	}
+
+	// 价格提醒
+	if cfg.Alerts.Enabled {
+		if err := alertService.Start(marketService, sched); err != nil {
+			logrus.Errorf("Failed to start price alerts: %v", err)
+		}
+	}
+
+	// 用户Webhook重试
+	if cfg.Webhooks.Enabled {
+		if err := webhookService.Start(sched); err != nil {
+			logrus.Errorf("Failed to start webhook retries: %v", err)
+		}
+	}
+
+	// Telegram机器人
+	if cfg.Telegram.Enabled {
+		if err := telegramService.Start(); err != nil {
+			logrus.Errorf("Failed to start telegram bot: %v", err)
+		} else {
+			notifier.Register(telegramService)
+		}
+	}
+
+	// 邮件通知与每日摘要
+	if cfg.Email.Enabled {
+		if err := emailService.Start(sched); err != nil {
+			logrus.Errorf("Failed to start email notifications: %v", err)
+		} else {
+			notifier.Register(emailService)
+		}
+	}
+
+	// 微信推送（Server酱/企业微信）
+	if cfg.WeChat.Enabled {
+		notifier.Register(wechatService)
+	}
+
+	// 通知路由：站内通知及以上已启用的渠道
+	notifier.Start()
+
+	// 事务发件箱投递（订单事件推送），处理函数已在各服务创建时注册
+	if err := outboxRelay.Start(sched); err != nil {
+		logrus.Errorf("Failed to start outbox relay: %v", err)
+	}
+
+	// 物品趋势订阅
+	if cfg.Watch.Enabled {
+		if err := watchService.Start(sched); err != nil {
+			logrus.Errorf("Failed to start item watch: %v", err)
+		}
+	}
+
+	// 启动交易相关的后台任务（只读模式下推迟到Redis恢复后）
+	startTrading := func() {
+		// 订单执行队列，继续执行重启前未完成的订单
+		if err := tradingService.StartExecution(); err != nil {
+			logrus.Errorf("Failed to start order execution: %v", err)
+		}
+
+		// 恢复激活中的策略
+		if err := tradingService.RestoreActiveStrategies(); err != nil {
+			logrus.Errorf("Failed to restore active strategies: %v", err)
+		}
+
+		// 启动持仓止损止盈监控
+		if cfg.Trading.PositionMonitor.Enabled {
+			if err := tradingService.MonitorPositions(time.Duration(cfg.Trading.PositionMonitor.Interval) * time.Second); err != nil {
+				logrus.Errorf("Failed to start position monitor: %v", err)
+			}
+		}
+
+		// 解锁崩溃后遗留的锁定库存
+		if cfg.Trading.InventoryJanitor.Enabled {
+			if err := tradingService.CleanupLockedInventory(
+				time.Duration(cfg.Trading.InventoryJanitor.Interval)*time.Second,
+				time.Duration(cfg.Trading.InventoryJanitor.Threshold)*time.Second,
+			); err != nil {
+				logrus.Errorf("Failed to start inventory janitor: %v", err)
+			}
+		}
+
+		// 止损、止盈等条件单按实时价格触发
+		if err := tradingService.TriggerOrders(time.Duration(cfg.Trading.OrderTriggers.Interval) * time.Second); err != nil {
+			logrus.Errorf("Failed to start order triggers: %v", err)
+		}
+
+		// 过期长时间未成交的挂单；下单时指定了过期时间的订单始终需要检查，不受enabled影响
+		if err := tradingService.ExpireOrders(time.Duration(cfg.Trading.OrderExpiry.Interval) * time.Second); err != nil {
+			logrus.Errorf("Failed to start order expiry: %v", err)
+		}
+
+		// 价格异常时自动暂停物品交易
+		if cfg.Trading.AnomalyHalt.Enabled {
+			if err := tradingService.DetectPriceAnomalies(time.Duration(cfg.Trading.AnomalyHalt.Interval) * time.Second); err != nil {
+				logrus.Errorf("Failed to start price anomaly detection: %v", err)
+			}
+		}
+
+		// 闲置和持续亏损策略的调整建议
+		if cfg.Trading.StrategyReview.Enabled {
+			if err := tradingService.ReviewStrategies(time.Duration(cfg.Trading.StrategyReview.Interval) * time.Second); err != nil {
+				logrus.Errorf("Failed to start strategy review: %v", err)
+			}
+		}
+
+		// 策略A/B测试评估与胜者推广
+		if cfg.Trading.Experiments.Enabled {
+			if err := tradingService.RunExperiments(time.Duration(cfg.Trading.Experiments.Interval) * time.Second); err != nil {
+				logrus.Errorf("Failed to start strategy experiments: %v", err)
+			}
+		}
+
+		// 按用户和策略定期计算收益风险指标
+		if cfg.Trading.Performance.Enabled {
+			if err := tradingService.RecordPerformance(time.Duration(cfg.Trading.Performance.Interval)*time.Second, cfg.Trading.Performance.Days); err != nil {
+				logrus.Errorf("Failed to start performance metrics: %v", err)
+			}
+		}
+
+		// 大额订单的TWAP/冰山拆单执行
+		if cfg.Trading.SlicedOrders.Enabled {
+			if err := tradingService.RunSlicedOrders(time.Duration(cfg.Trading.SlicedOrders.Interval) * time.Second); err != nil {
+				logrus.Errorf("Failed to start sliced order execution: %v", err)
+			}
+		}
+
+		// 同步BitSkins价格，用于比价和套利
+		if cfg.Trading.BitSkins.Enabled {
+			if err := tradingService.SyncBitSkinsPrices(time.Duration(cfg.Trading.BitSkins.PriceSync) * time.Second); err != nil {
+				logrus.Errorf("Failed to start BitSkins price sync: %v", err)
+			}
+		}
+
+		// Market.CSGO价格同步与交易报价交接
+		if cfg.Trading.MarketCSGO.Enabled {
+			if err := tradingService.SyncMarketCSGO(
+				time.Duration(cfg.Trading.MarketCSGO.PriceSync)*time.Second,
+				time.Duration(cfg.Trading.MarketCSGO.Handoff)*time.Second,
+			); err != nil {
+				logrus.Errorf("Failed to start Market.CSGO sync: %v", err)
+			}
+		}
+	}
+
+	if readOnly.Load() {
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.Startup.MaxBackoff) * time.Second)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if database.PingRedis(redisClient) == nil {
+					logrus.Info("Redis is available, leaving read-only mode")
+					readOnly.Store(false)
+					startTrading()
+					return
+				}
+			}
+		}()
+	} else {
+		startTrading()
+	}
 
 	// 设置Gin路由
 	router := gin.Default()
@@ -54,8 +441,8 @@ func main() {
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 		
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -65,58 +452,271 @@ func main() {
 		c.Next()
 	})
 
+	// HTTPS部署时发送HSTS并强制Cookie使用Secure标记
+	if cfg.Server.TLS.Enabled {
+		router.Use(api.SecureTransportMiddleware(cfg.Server.TLS.HSTSMaxAge))
+	}
+
+	// 请求体大小限制
+	router.Use(api.BodyLimitMiddleware(cfg.Server.MaxBodyBytes))
+
+	// 响应压缩（1KB以下的响应压缩收益不明显）
+	router.Use(api.CompressionMiddleware(1024))
+
+	// 接口限流：按IP覆盖全部接口，登录后的接口再按用户计数
+	limiter := ratelimit.NewLimiter(redisClient, cfg.RateLimit)
+
 	// API路由
-	apiGroup := router.Group("/api/v1")
+	apiGroup := router.Group("/api/v1", api.RateLimitMiddleware(limiter, ratelimit.ByIP))
 	{
 		// 认证相关
 		apiGroup.POST("/auth/steam/login", api.SteamLogin(authService))
-		apiGroup.POST("/auth/steam/callback", api.SteamCallback(authService))
+		apiGroup.POST("/auth/steam/callback", api.SteamCallback(authService, auditService))
 		apiGroup.POST("/auth/steam/verify-token", api.VerifyToken(authService))
-		apiGroup.POST("/auth/logout", api.Logout(authService))
+		apiGroup.POST("/auth/refresh", api.RefreshToken(authService))
+
+		// 库存估值分享链接（公开只读）
+		apiGroup.GET("/public/appraisals/:token", api.GetPublicAppraisal(appraisalService))
+		apiGroup.GET("/files/download/*key", api.DownloadFile(storageService))
 
 		// 需要认证的路由
 		protected := apiGroup.Group("/")
 		protected.Use(api.AuthMiddleware(authService))
+		protected.Use(api.RateLimitMiddleware(limiter, ratelimit.ByUser))
+		protected.Use(api.ReadOnlyMiddleware(readOnly.Load))
+		protected.Use(api.MaintenanceMiddleware(maintenance))
 		{
 			// 市场数据
 			protected.GET("/market/items", api.GetMarketItems(marketService))
 			protected.GET("/market/items/:id", api.GetItemDetails(marketService))
+			protected.GET("/market/items/:id/full", api.GetItemFull(marketService))
 			protected.GET("/market/items/:id/history", api.GetPriceHistory(marketService))
+			protected.GET("/market/items/:id/popularity", api.GetItemPopularity(popularityService))
+			protected.GET("/market/items/:id/depth", api.GetItemDepth(depthService))
+			protected.GET("/market/items/:id/depth/history", api.GetItemDepthHistory(depthService))
+			protected.GET("/market/items/:id/regions", api.GetItemRegionalPrices(depthService))
+			protected.GET("/market/regional-spreads", api.GetRegionalSpreads(depthService))
+			protected.GET("/market/arbitrage", api.GetArbitrageOpportunities(tradingService))
 			protected.GET("/market/trends", api.GetMarketTrends(marketService))
+			protected.GET("/market/compare", api.ComparePrices(marketService))
+			protected.GET("/market/new-items", api.GetNewItems(catalogService))
+			protected.GET("/market/new-items/subscription", api.GetNewItemSubscription(catalogService))
+			protected.PUT("/market/new-items/subscription", api.SaveNewItemSubscription(catalogService))
+			protected.DELETE("/market/new-items/subscription", api.DeleteNewItemSubscription(catalogService))
+			protected.GET("/fx/rates", api.GetFXRates(fxService))
+
+			// 图表标注
+			protected.GET("/annotations", api.GetAnnotations(marketService))
+			protected.POST("/annotations", api.CreateAnnotation(marketService))
+			protected.DELETE("/annotations/:id", api.DeleteAnnotation(marketService))
 
 			// 交易相关
 			protected.GET("/trading/inventory", api.GetInventory(tradingService))
-			protected.POST("/trading/buy", api.CreateBuyOrder(tradingService))
-			protected.POST("/trading/sell", api.CreateSellOrder(tradingService))
+			protected.GET("/positions", api.GetPositions(tradingService))
+			protected.GET("/trading/performance", api.GetPerformance(tradingService))
+			protected.GET("/trading/ledger", api.GetLedger(tradingService))
+			protected.GET("/trading/break-even", api.GetBreakEven(tradingService))
+			protected.GET("/trading/fees/history", api.GetFeeHistory(tradingService))
+			protected.GET("/appraisals", api.GetAppraisalShares(appraisalService))
+			protected.POST("/appraisals", api.CreateAppraisalShare(appraisalService))
+			protected.DELETE("/appraisals/:id", api.RevokeAppraisalShare(appraisalService))
+			protected.GET("/files", api.GetFiles(storageService))
+			protected.GET("/files/:id/download", api.GetFileDownload(storageService))
+			protected.DELETE("/files/:id", api.DeleteFile(storageService))
+			protected.POST("/exports", api.CreateExport(exportService))
+			protected.POST("/reports/tax", api.CreateTaxReport(exportService))
+			protected.GET("/exports", api.GetExports(exportService))
+			protected.GET("/exports/:id", api.GetExport(exportService))
+			protected.GET("/exports/:id/download", api.GetExportDownload(exportService))
+			protected.POST("/exports/:id/cancel", api.CancelExport(exportService))
+			protected.POST("/exports/:id/resume", api.ResumeExport(exportService))
+			protected.DELETE("/exports/:id", api.DeleteExport(exportService))
+			protected.POST("/trading/inventory/:id/inspect", api.InspectInventoryItem(inspectService))
+			protected.GET("/trading/reservations", api.GetReservations(tradingService))
+			protected.PUT("/trading/inventory/:id/reservation", api.ReserveInventory(tradingService, auditService))
+			protected.DELETE("/trading/inventory/:id/reservation", api.ReleaseReservation(tradingService, auditService))
+			protected.GET("/inspect", api.ResolveInspectLink(inspectService))
+			protected.POST("/trading/buy", api.CreateBuyOrder(tradingService, auditService))
+			protected.POST("/trading/sell", api.CreateSellOrder(tradingService, auditService))
+			protected.POST("/trading/oco", api.CreateOCOOrder(tradingService, auditService))
+			protected.POST("/trading/stop", api.CreateStopOrder(tradingService, auditService))
 			protected.GET("/trading/orders", api.GetOrders(tradingService))
-			protected.DELETE("/trading/orders/:id", api.CancelOrder(tradingService))
+			protected.GET("/trading/orders/search", api.SearchOrders(tradingService))
+			protected.GET("/trading/orders/:id/events", api.GetOrderEvents(tradingService))
+			protected.PATCH("/trading/orders/:id", api.AmendOrder(tradingService, auditService))
+			protected.DELETE("/trading/orders/:id", api.CancelOrder(tradingService, auditService))
+			protected.POST("/trading/sliced-orders", api.CreateSlicedOrder(tradingService))
+			protected.GET("/trading/sliced-orders", api.GetSlicedOrders(tradingService))
+			protected.GET("/trading/sliced-orders/:id", api.GetSlicedOrder(tradingService))
+			protected.DELETE("/trading/sliced-orders/:id", api.CancelSlicedOrder(tradingService))
+			protected.GET("/trading/routing", api.GetRoutingPreference(tradingService))
+			protected.PUT("/trading/routing", api.SaveRoutingPreference(tradingService))
+			protected.GET("/trading/lot-method", api.GetLotMethod(tradingService))
+			protected.PUT("/trading/lot-method", api.SaveLotMethod(tradingService))
 
 			// 策略管理
 			protected.GET("/strategies", api.GetStrategies(tradingService))
-			protected.POST("/strategies", api.CreateStrategy(tradingService))
-			protected.PUT("/strategies/:id", api.UpdateStrategy(tradingService))
-			protected.DELETE("/strategies/:id", api.DeleteStrategy(tradingService))
-			protected.POST("/strategies/:id/activate", api.ActivateStrategy(tradingService))
-			protected.POST("/strategies/:id/deactivate", api.DeactivateStrategy(tradingService))
+			protected.POST("/strategies", api.CreateStrategy(tradingService, auditService))
+			protected.PUT("/strategies/:id", api.UpdateStrategy(tradingService, auditService))
+			protected.DELETE("/strategies/:id", api.DeleteStrategy(tradingService, auditService))
+			protected.GET("/strategies/:id/preflight", api.PreflightStrategy(tradingService))
+			protected.POST("/strategies/:id/activate", api.ActivateStrategy(tradingService, auditService))
+			protected.POST("/strategies/:id/deactivate", api.DeactivateStrategy(tradingService, auditService))
+			protected.POST("/strategies/:id/evaluate", api.EvaluateStrategy(tradingService))
+			protected.GET("/strategies/:id/performance", api.GetStrategyPerformance(tradingService))
+			protected.GET("/strategies/:id/logs", api.GetStrategyRunLogs(tradingService))
+			protected.GET("/strategies/:id/suggestions", api.GetStrategySuggestions(tradingService))
+			protected.GET("/strategies/:id/experiments", api.GetStrategyExperiments(tradingService))
+			protected.POST("/strategies/:id/experiments", api.StartStrategyExperiment(tradingService, auditService))
+			protected.GET("/strategies/:id/experiments/:experiment_id", api.GetStrategyExperiment(tradingService))
+			protected.POST("/strategies/:id/experiments/:experiment_id/promote", api.PromoteStrategyVariant(tradingService))
+			protected.POST("/strategies/:id/experiments/:experiment_id/cancel", api.CancelStrategyExperiment(tradingService))
+
+			// 跟单
+			protected.GET("/strategies/public", api.GetPublicStrategies(tradingService))
+			protected.POST("/strategies/:id/subscribe", api.SubscribeStrategy(tradingService))
+			protected.GET("/subscriptions", api.GetSubscriptions(tradingService))
+			protected.DELETE("/subscriptions/:id", api.Unsubscribe(tradingService))
 
 			// 统计数据
 			protected.GET("/stats/profit", api.GetProfitStats(tradingService))
 			protected.GET("/stats/trading", api.GetTradingStats(tradingService))
+
+			// 收益分析
+			protected.GET("/analytics/attribution", api.GetAttribution(analyticsService))
+			protected.GET("/analytics/benchmark", api.GetBenchmark(analyticsService))
+			protected.GET("/analytics/portfolio-value", api.GetPortfolioValue(analyticsService))
+			protected.GET("/analytics/hedges", api.GetHedges(analyticsService))
+			protected.GET("/analytics/indexes", api.GetMarketIndexes())
+
+			// 保存的筛选视图
+			protected.GET("/views", api.GetSavedViews(viewService))
+			protected.POST("/views", api.CreateSavedView(viewService))
+			protected.PUT("/views/:id", api.UpdateSavedView(viewService))
+			protected.DELETE("/views/:id", api.DeleteSavedView(viewService))
+			protected.GET("/views/:id/results", api.ExecuteSavedView(viewService))
+
+			// 物品趋势订阅
+			protected.GET("/watches", api.GetItemWatches(watchService))
+			protected.POST("/watches", api.CreateItemWatch(watchService))
+			protected.DELETE("/watches/:id", api.DeleteItemWatch(watchService))
+			protected.GET("/alerts", api.GetPriceAlerts(alertService))
+			protected.POST("/alerts", api.CreatePriceAlert(alertService))
+			protected.PUT("/alerts/:id", api.UpdatePriceAlert(alertService))
+			protected.DELETE("/alerts/:id", api.DeletePriceAlert(alertService))
+			protected.POST("/auth/logout", api.Logout(authService, auditService))
+			protected.POST("/auth/revoke-all", api.RevokeAllTokens(authService, auditService))
+			protected.GET("/sessions", api.GetSessions(authService))
+			protected.DELETE("/sessions", api.RevokeOtherSessions(authService, auditService))
+			protected.DELETE("/sessions/:id", api.RevokeSession(authService, auditService))
+			protected.GET("/api-keys", api.GetAPIKeys(authService))
+			protected.POST("/api-keys", api.CreateAPIKey(authService, auditService))
+			protected.DELETE("/api-keys/:id", api.RevokeAPIKey(authService, auditService))
+			protected.GET("/webhooks", api.GetWebhooks(webhookService))
+			protected.POST("/webhooks", api.CreateWebhook(webhookService, auditService))
+			protected.DELETE("/webhooks/:id", api.DeleteWebhook(webhookService, auditService))
+			protected.GET("/webhooks/:id/deliveries", api.GetWebhookDeliveries(webhookService))
+			protected.POST("/webhooks/:id/ping", api.PingWebhook(webhookService))
+			protected.GET("/telegram/link", api.GetTelegramLink(telegramService))
+			protected.POST("/telegram/link", api.CreateTelegramLink(telegramService, auditService))
+			protected.DELETE("/telegram/link", api.DeleteTelegramLink(telegramService, auditService))
+			protected.GET("/email/subscription", api.GetEmailSubscription(emailService))
+			protected.PUT("/email/subscription", api.SaveEmailSubscription(emailService))
+			protected.DELETE("/email/subscription", api.DeleteEmailSubscription(emailService))
+			protected.POST("/email/test", api.SendTestEmail(emailService))
+			protected.GET("/notifications/preferences", api.GetNotificationPreferences(notifier))
+			protected.PUT("/notifications/preferences/:channel", api.SaveNotificationPreference(notifier))
+			protected.DELETE("/notifications/preferences/:channel", api.ResetNotificationPreference(notifier))
+			protected.GET("/activity", api.GetActivity(activityService))
+			protected.GET("/usage", api.GetAPIUsage(limiter))
+			protected.GET("/usage/history", api.GetAPIUsageHistory(limiter))
+			protected.GET("/activity/stream", websocket.HandleActivityStream(activityService))
+			protected.GET("/wechat", api.GetWeChatBinding(wechatService))
+			protected.PUT("/wechat", api.SaveWeChatBinding(wechatService, auditService))
+			protected.DELETE("/wechat", api.DeleteWeChatBinding(wechatService, auditService))
+			protected.POST("/wechat/test", api.SendTestWeChat(wechatService))
+
+			// 审计日志
+			protected.GET("/audit", api.GetAuditLogs(auditService, authService))
+		}
+	}
+
+	// 管理员路由（不受维护模式限制）
+	adminGroup := apiGroup.Group("/admin")
+	adminGroup.Use(api.AuthMiddleware(authService), api.RateLimitMiddleware(limiter, ratelimit.ByUser), api.AdminMiddleware(authService))
+	{
+		adminGroup.GET("/maintenance", api.GetMaintenance(maintenance))
+		adminGroup.POST("/maintenance", api.SetMaintenance(maintenance))
+		adminGroup.GET("/verify", api.RunIntegrityCheck(verifyService))
+		adminGroup.POST("/users/:id/inventory/adjustments", api.AdjustUserInventory(adminService))
+		adminGroup.POST("/users/:id/balance/adjustments", api.AdjustUserBalance(adminService))
+		adminGroup.GET("/users/:id/ledger", api.GetUserLedger(adminService))
+		adminGroup.POST("/orders/rebuild", api.RebuildOrders(tradingService))
+		adminGroup.GET("/halts", api.GetHaltedItems(tradingService))
+		adminGroup.PUT("/items/:id/halt", api.HaltItem(tradingService))
+		adminGroup.DELETE("/items/:id/halt", api.ResumeItem(tradingService))
+		adminGroup.GET("/quotas", api.GetPlatformQuotas(tradingService))
+		adminGroup.GET("/latency", api.GetLatencyReport(tradingService))
+		adminGroup.GET("/websocket", api.GetWebSocketStats(hub))
+		adminGroup.GET("/outbox", api.GetOutboxStats(outboxRelay))
+		adminGroup.GET("/profiles", api.GetProfiles(profilingService))
+		adminGroup.GET("/profiles/:name", api.DownloadProfile(profilingService))
+		if cfg.Profiling.Pprof {
+			adminGroup.GET("/debug/pprof/*name", api.Pprof())
 		}
+		adminGroup.GET("/proxies", api.GetProxyPools(map[string]*proxypool.Pool{"buff": buffProxies}))
+		platformSessions := map[string]*platformsession.Manager{"buff": buffSession}
+		adminGroup.GET("/sessions", api.GetPlatformSessions(platformSessions))
+		adminGroup.PUT("/sessions/:platform", api.UpdatePlatformSession(platformSessions, auditService))
+		adminGroup.POST("/sessions/:platform/check", api.CheckPlatformSession(platformSessions))
+		adminGroup.POST("/fees", api.CreateFeeVersion(tradingService))
+		adminGroup.POST("/fees/recompute", api.RecomputeFees(tradingService))
+		adminGroup.POST("/retention/runs", api.StartRetentionRun(retentionService))
+		adminGroup.GET("/retention/runs", api.GetRetentionRuns(retentionService))
+		adminGroup.GET("/retention/runs/:id", api.GetRetentionRun(retentionService))
+		adminGroup.POST("/catalog/imports", api.StartCatalogImport(catalogService))
+		adminGroup.GET("/catalog/imports", api.GetCatalogImports(catalogService))
+		adminGroup.GET("/catalog/imports/:id", api.GetCatalogImport(catalogService))
+		adminGroup.POST("/annotations", api.CreateGlobalAnnotation(marketService))
+		adminGroup.DELETE("/annotations/:id", api.DeleteGlobalAnnotation(marketService))
 	}
 
 	// WebSocket连接
-	router.GET("/ws", websocket.HandleWebSocket(marketService))
+	router.GET("/ws", websocket.HandleWebSocket(hub, marketService))
 
 	// 健康检查
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "healthy"})
-	})
+	health := func(c *gin.Context) {
+		status := "healthy"
+		if maintenance.Enabled() {
+			status = "maintenance"
+		}
+
+		c.JSON(200, gin.H{
+			"status":      status,
+			"read_only":   readOnly.Load(),
+			"maintenance": maintenance.Status(),
+			"cache":       cache.Stats(),
+			"outbound":    httpClients.Stats(),
+		})
+	}
+	router.GET("/health", health)
+	router.GET("/healthz", health)
 
 	// 启动服务器
-	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
-		Handler: router,
+	// 处理超时：调用外部平台的接口允许更长时间
+	handler := api.WithTimeouts(router, time.Duration(cfg.Server.HandlerTimeout)*time.Second, map[string]time.Duration{
+		"/api/v1/auth/steam":   time.Duration(cfg.Server.ExternalTimeout) * time.Second,
+		"/api/v1/admin/verify": time.Duration(cfg.Server.ExternalTimeout) * time.Second,
+		// CPU剖析和trace默认采样30秒，只受连接写超时限制
+		"/api/v1/admin/debug/pprof": time.Duration(cfg.Server.WriteTimeout) * time.Second,
+	}, map[string]time.Duration{
+		// 大文件导出下载需要流式写出
+		"/api/v1/files/download": time.Duration(cfg.Server.DownloadTimeout) * time.Second,
+	})
+
+	srv, err := newServer(handler, cfg.Server)
+	if err != nil {
+		log.Fatalf("Invalid server config: %v", err)
 	}
 
 	// 优雅关闭
@@ -134,6 +734,7 @@ func main() {
 	<-quit
 
 	logrus.Info("Shutting down server...")
+	sched.Stop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
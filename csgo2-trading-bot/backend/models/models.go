@@ -19,6 +19,9 @@ type User struct {
 	LastLogin        time.Time `json:"last_login"`
 	TotalProfit      float64   `json:"total_profit"`
 	TotalTransactions int      `json:"total_transactions"`
+	IsAdmin           bool     `json:"is_admin" gorm:"default:false"`
+	LotMethod         string   `json:"lot_method" gorm:"default:fifo"` // 卖出时默认的持仓批次选择方式
+	Performance       *string  `json:"performance,omitempty" gorm:"type:jsonb"` // 定期计算的收益风险指标JSON
 }
 
 // Item 物品模型
@@ -29,12 +32,23 @@ type Item struct {
 	Type           string  `json:"type"`
 	Rarity         string  `json:"rarity"`
 	Quality        string  `json:"quality"`
+	Exterior       string  `json:"exterior"`   // 磨损：Factory New 等，无磨损的物品为空
+	PaintIndex     int     `json:"paint_index,omitempty"` // 皮肤图案编号，由检视结果回填
+	Popularity     float64 `json:"popularity"` // 社区热度：当日提及数相对前7日日均的倍数
+	Collection     string  `json:"collection"` // 所属收藏品/武器箱
 	IconURL        string  `json:"icon_url"`
 	CurrentPrice   float64 `json:"current_price"`
 	AvgPrice7Days  float64 `json:"avg_price_7days"`
 	AvgPrice30Days float64 `json:"avg_price_30days"`
 	Volume24h      int     `json:"volume_24h"`
 	LastUpdated    time.Time `json:"last_updated"`
+	CollectionTier int        `json:"collection_tier" gorm:"default:3;index"` // 采集层级，1最高，采集器按层级决定采集频率
+	FastTrackUntil *time.Time `json:"fast_track_until,omitempty"`             // 新物品快速通道的截止时间，到期后回到默认层级
+	SteamNameID    int64      `json:"-"`                                      // Steam市场item_nameid，查询买卖盘时使用，首次采集深度时从商品页解析
+	HaltedAt       *time.Time `json:"halted_at,omitempty" gorm:"index"`       // 暂停交易的时间，为空表示正常交易
+	HaltReason     string     `json:"halt_reason,omitempty"`
+	HaltSource     string     `json:"halt_source,omitempty"`     // admin, anomaly
+	HaltResumedAt  *time.Time `json:"halt_resumed_at,omitempty"` // 最近一次恢复交易的时间，冷却期内异常检测不再自动暂停
 }
 
 // PriceHistory 价格历史
@@ -45,7 +59,82 @@ type PriceHistory struct {
 	Price        float64   `json:"price"`
 	Volume       int       `json:"volume"`
 	Platform     string    `json:"platform"` // buff, youpin, steam
-	RecordedAt   time.Time `json:"recorded_at"`
+	RecordedAt   time.Time `json:"recorded_at"` // 采集时间
+	IngestedAt   time.Time `json:"ingested_at" gorm:"default:CURRENT_TIMESTAMP"` // 入库时间，由数据库填充
+}
+
+// OrderBookSnapshot 平台买卖盘深度快照，各档价格和数量以gzip压缩的JSON存放在Data中
+type OrderBookSnapshot struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	ItemID     uint      `json:"item_id" gorm:"index:idx_order_book_snapshots_item_time,priority:1"`
+	Platform   string    `json:"platform" gorm:"size:32"`
+	CapturedAt time.Time `json:"captured_at" gorm:"index:idx_order_book_snapshots_item_time,priority:2"`
+	BestBid    float64   `json:"best_bid"`
+	BestAsk    float64   `json:"best_ask"`
+	BidVolume  int       `json:"bid_volume"` // 全部买单数量
+	AskVolume  int       `json:"ask_volume"` // 全部卖单数量
+	Levels     int       `json:"levels"`     // 保存的档位数（买卖合计）
+	Data       []byte    `json:"-" gorm:"type:bytea"`
+}
+
+// SteamRegionalPrice Steam某个钱包币种下的盘口，本位币价格按采集时的汇率换算
+type SteamRegionalPrice struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	ItemID     uint      `json:"item_id" gorm:"index:idx_steam_regional_prices_item_time,priority:1"`
+	Region     string    `json:"region" gorm:"size:16"`
+	Currency   string    `json:"currency" gorm:"size:8"`
+	CapturedAt time.Time `json:"captured_at" gorm:"index:idx_steam_regional_prices_item_time,priority:2"`
+	LocalBid   float64   `json:"local_bid"` // 该币种下的最高买价
+	LocalAsk   float64   `json:"local_ask"` // 该币种下的最低卖价
+	BestBid    float64   `json:"best_bid"`
+	BestAsk    float64   `json:"best_ask"`
+	BidVolume  int       `json:"bid_volume"`
+	AskVolume  int       `json:"ask_volume"`
+	FXRate     float64   `json:"fx_rate"` // 1单位该币种折合的本位币
+}
+
+// PriceAggregate 降采样后的价格K线
+type PriceAggregate struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	ItemID     uint      `json:"item_id" gorm:"uniqueIndex:idx_price_aggregates_bucket"`
+	Platform   string    `json:"platform" gorm:"uniqueIndex:idx_price_aggregates_bucket"`
+	Resolution string    `json:"resolution" gorm:"uniqueIndex:idx_price_aggregates_bucket"` // hour, day
+	Bucket     time.Time `json:"bucket" gorm:"uniqueIndex:idx_price_aggregates_bucket"`
+	Open       float64   `json:"open"`
+	High       float64   `json:"high"`
+	Low        float64   `json:"low"`
+	Close      float64   `json:"close"`
+	Avg        float64   `json:"avg"`
+	Volume     int       `json:"volume"`
+	Samples    int       `json:"samples"`
+}
+
+// RetentionRun 价格数据降采样/清理任务的执行记录
+type RetentionRun struct {
+	gorm.Model
+	Trigger    string     `json:"trigger"`    // scheduled, manual
+	Status     string     `json:"status"`     // running, completed, failed
+	Stage      string     `json:"stage"`      // hourly, daily
+	Progress   float64    `json:"progress"`   // 0-100
+	Aggregated int64      `json:"aggregated"` // 写入的K线数
+	Purged     int64      `json:"purged"`     // 删除的明细行数
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// CatalogImport 物品目录导入任务的执行记录
+type CatalogImport struct {
+	gorm.Model
+	Trigger    string     `json:"trigger"` // scheduled, manual
+	Source     string     `json:"source"`  // steam_market, schema
+	Status     string     `json:"status"`  // running, completed, failed
+	Fetched    int        `json:"fetched"` // 从数据源读取的条目数
+	Created    int        `json:"created"` // 新增的物品数
+	Updated    int        `json:"updated"` // 更新的物品数
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
 }
 
 // Order 订单模型
@@ -56,14 +145,98 @@ type Order struct {
 	ItemID       uint      `json:"item_id"`
 	Item         Item      `json:"item" gorm:"foreignKey:ItemID"`
 	Type         string    `json:"type"` // buy, sell
-	Status       string    `json:"status"` // pending, completed, cancelled, failed
+	Status       string    `json:"status" gorm:"index"` // pending, completed, cancelled, failed, expired
 	Price        float64   `json:"price"`
 	Quantity     int       `json:"quantity"`
-	Platform     string    `json:"platform"`
-	StrategyID   *uint     `json:"strategy_id,omitempty"`
+	FilledQuantity int     `json:"filled_quantity"` // 已成交数量，部分成交时小于Quantity
+	Platform     string    `json:"platform" gorm:"index"`
+	StrategyID   *uint     `json:"strategy_id,omitempty" gorm:"index"`
 	Strategy     *Strategy `json:"strategy,omitempty" gorm:"foreignKey:StrategyID"`
+	SubscriptionID *uint   `json:"subscription_id,omitempty"` // 跟单订单所属的订阅
+	ParentID     *uint     `json:"parent_id,omitempty" gorm:"index"` // 拆分执行时所属的母单
+	Routing      *string   `json:"routing,omitempty" gorm:"type:jsonb"` // platform为auto时的路由决策
+	LotMethod    string    `json:"lot_method,omitempty"` // 卖单的持仓批次选择方式
+	Lots         *string   `json:"lots,omitempty" gorm:"type:jsonb"` // 卖单选定的持仓批次
+	Latency      *OrderLatency `json:"latency,omitempty" gorm:"foreignKey:OrderID"` // 策略订单从行情采集到提交的各环节时间
+	ExecutionStartedAt *time.Time `json:"execution_started_at,omitempty"` // 执行队列开始向平台提交的时间，用于防止重复执行
+	ExecutionHeartbeatAt *time.Time `json:"-"` // 执行中的工作协程定期更新，长时间未更新的执行视为中断
+	ExpiresAt    *time.Time `json:"expires_at,omitempty" gorm:"index"` // 下单时指定的过期时间，到期仍未成交的订单自动取消
+	Kind         string    `json:"kind,omitempty" gorm:"index"` // 条件单类型（take_profit、stop_loss），为空时立即执行
+	StopPrice    *float64  `json:"stop_price,omitempty"` // 止损单的触发价格，当前价格不高于该价格时按Price卖出
+	TriggeredAt  *time.Time `json:"triggered_at,omitempty"` // 条件单满足条件、交给执行队列的时间
+	OCOID        *uint     `json:"oco_id,omitempty" gorm:"index"` // OCO订单中另一腿的订单，一腿开始执行或结束时另一腿自动取消
 	ExecutedAt   *time.Time `json:"executed_at,omitempty"`
 	FailedReason string    `json:"failed_reason,omitempty"`
+	Version      int       `json:"version" gorm:"not null;default:1"` // 每次状态变化加1，用于拒绝基于旧状态的修改
+}
+
+
+// OrderLatency 策略订单所依据的行情从采集到订单提交到平台的时间点
+type OrderLatency struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	OrderID     uint       `json:"order_id" gorm:"uniqueIndex"`
+	StrategyID  uint       `json:"strategy_id" gorm:"index"`
+	CollectedAt time.Time  `json:"collected_at"` // 行情采集时间
+	IngestedAt  time.Time  `json:"ingested_at"`  // 行情入库时间
+	EvaluatedAt time.Time  `json:"evaluated_at"` // 策略依据行情做出决策的时间
+	SubmittedAt *time.Time `json:"submitted_at"` // 订单提交到平台的时间
+}
+
+// RoutingPreference 用户的下单平台偏好
+type RoutingPreference struct {
+	ID              uint      `json:"id" gorm:"primarykey"`
+	UserID          uint      `json:"user_id" gorm:"uniqueIndex"`
+	DefaultPlatform string    `json:"default_platform"` // 下单未指定平台时使用，为空或auto表示自动路由
+	Preferred       string    `json:"preferred"`        // 逗号分隔，按优先级排列
+	Excluded        string    `json:"excluded"`         // 逗号分隔，自动路由不会选择这些平台
+	Margin          float64   `json:"margin"`           // 偏好平台的有效价格与最优价相差不超过该百分比时优先选择
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// SlicedOrder 拆分执行的大额订单（母单），按TWAP或冰山方式分批提交子订单，子订单通过ParentID关联
+type SlicedOrder struct {
+	gorm.Model
+	UserID         uint       `json:"user_id" gorm:"index"`
+	ItemID         uint       `json:"item_id"`
+	Item           Item       `json:"item" gorm:"foreignKey:ItemID"`
+	Type           string     `json:"type"`  // buy, sell
+	Mode           string     `json:"mode"`  // twap, iceberg
+	Price          float64    `json:"price"` // 子订单的限价
+	Quantity       int        `json:"quantity"`
+	Platform       string     `json:"platform"`
+	Window         int        `json:"window,omitempty"`     // TWAP执行窗口（秒）
+	Slices         int        `json:"slices,omitempty"`     // TWAP计划的分片数
+	SliceSize      int        `json:"slice_size,omitempty"` // 冰山模式每次挂出的数量
+	Jitter         float64    `json:"jitter"`               // 分片数量和间隔的随机浮动比例
+	Status         string     `json:"status" gorm:"index"`  // active, completed, cancelled, failed
+	FilledQuantity int        `json:"filled_quantity"`
+	FilledAmount   float64    `json:"filled_amount"`
+	NextSliceAt    *time.Time `json:"next_slice_at,omitempty"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	FailedReason   string     `json:"failed_reason,omitempty"`
+	Orders         []Order    `json:"orders,omitempty" gorm:"foreignKey:ParentID"`
+}
+
+// OrderEvent 订单事件，订单表是按Sequence顺序投影事件得到的读模型
+type OrderEvent struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	OrderID   uint      `json:"order_id" gorm:"uniqueIndex:idx_order_event_seq"`
+	Sequence  int       `json:"sequence" gorm:"uniqueIndex:idx_order_event_seq"`
+	Type      string    `json:"type"` // created, amended, queued, deferred, triggered, sent, acknowledged, filled, completed, failed, cancelled, expired
+	Data      string    `json:"data" gorm:"type:jsonb"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OutboxEvent 事务发件箱中的事件，与产生它的业务修改在同一事务中写入，由投递协程推送后标记SentAt
+type OutboxEvent struct {
+	ID            uint       `json:"id" gorm:"primarykey"`
+	Topic         string     `json:"topic" gorm:"index"`
+	Payload       string     `json:"payload" gorm:"type:jsonb"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index:idx_outbox_pending,where:sent_at IS NULL"`
+	SentAt        *time.Time `json:"sent_at" gorm:"index"`
+	CreatedAt     time.Time  `json:"created_at"`
 }
 
 // Transaction 交易记录
@@ -74,12 +247,16 @@ type Transaction struct {
 	OrderID     uint    `json:"order_id"`
 	Order       Order   `json:"order" gorm:"foreignKey:OrderID"`
 	Type        string  `json:"type"` // buy, sell
+	Quantity    int     `json:"quantity"` // 本笔成交的数量，部分成交时小于订单数量
 	Amount      float64 `json:"amount"`
 	Fee         float64 `json:"fee"`
 	Profit      float64 `json:"profit"`
 	Platform    string  `json:"platform"`
 	TradeID     string  `json:"trade_id"`
 	CompletedAt time.Time `json:"completed_at"`
+	CostBasis   float64 `json:"cost_basis,omitempty"` // 卖出批次的买入成本
+	LotMethod   string  `json:"lot_method,omitempty"`
+	Lots        *string `json:"lots,omitempty" gorm:"type:jsonb"` // 实际卖出的持仓批次
 }
 
 // Strategy 交易策略
@@ -89,14 +266,56 @@ type Strategy struct {
 	User        User    `json:"user" gorm:"foreignKey:UserID"`
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
-	Type        string  `json:"type"` // grid, arbitrage, trend_following, mean_reversion
+	Type        string  `json:"type"` // grid, arbitrage, trend_following, mean_reversion, script
 	Status      string  `json:"status"` // active, paused, stopped
 	Config      string  `json:"config" gorm:"type:jsonb"` // JSON配置
 	MaxInvest   float64 `json:"max_invest"`
 	MinProfit   float64 `json:"min_profit"`
 	StopLoss    float64 `json:"stop_loss"`
 	TakeProfit  float64 `json:"take_profit"`
+	Schedule    string  `json:"schedule"`        // cron表达式或间隔，如 "*/5 * * * *"、"30s"
+	Jitter      int     `json:"jitter"`          // 随机延迟上限（秒）
+	Concurrency int     `json:"concurrency"`     // 允许同时运行的实例数
 	Performance string  `json:"performance" gorm:"type:jsonb"` // 性能统计JSON
+	IsPublic    bool    `json:"is_public"`                     // 是否允许其他用户跟单
+	Priority    int     `json:"priority"`                      // 与其他策略冲突时按priority仲裁，数值大的优先
+
+	ExperimentID *uint  `json:"experiment_id,omitempty" gorm:"index"` // A/B测试的变体，指向所属实验
+	Variant      string `json:"variant,omitempty"`                    // 变体名称
+	Version      int    `json:"version" gorm:"not null;default:1"`    // 每次修改配置或状态加1，修改时可带上读取到的版本防止覆盖他人的修改
+}
+
+
+// StrategySuggestion 策略复查对闲置或持续亏损策略给出的调整建议
+type StrategySuggestion struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	StrategyID uint      `json:"strategy_id" gorm:"index"`
+	UserID     uint      `json:"user_id" gorm:"index"`
+	Finding    string    `json:"finding"` // idle, losing
+	Action     string    `json:"action"`  // recenter_grid, denser_grid, widen_grid, lower_min_spread, switch_item, review
+	Reason     string    `json:"reason"`
+	Changes    string    `json:"changes" gorm:"type:jsonb"` // 建议的策略修改，可直接作为修改策略的请求体
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// StrategyExperiment 策略参数A/B测试：每个变体是按权重分得母策略预算的子策略，
+// 评估期结束后按指标选出胜者，AutoPromote时将胜者的参数写回母策略并重新激活
+type StrategyExperiment struct {
+	gorm.Model
+	UserID       uint       `json:"user_id" gorm:"index"`
+	StrategyID   uint       `json:"strategy_id" gorm:"index"` // 母策略
+	Status       string     `json:"status"`                   // running, completed, inconclusive, cancelled
+	Metric       string     `json:"metric"`                   // profit, return, win_rate
+	MinTrades    int        `json:"min_trades"`               // 变体至少完成的卖出笔数，不足的不参与评选
+	AutoPromote  bool       `json:"auto_promote"`
+	StartedAt    time.Time  `json:"started_at"`
+	EndsAt       time.Time  `json:"ends_at" gorm:"index"`
+	CompletedAt  *time.Time `json:"completed_at"`
+	WinnerID     *uint      `json:"winner_id"`                 // 胜出的变体策略
+	Promoted     bool       `json:"promoted"`                  // 胜者参数是否已写回母策略
+	ParentStatus string     `json:"-"`                         // 实验开始前母策略的状态，未推广时恢复
+	Results      string     `json:"results" gorm:"type:jsonb"` // 结束时各变体的表现
+	Variants     []Strategy `json:"variants,omitempty" gorm:"foreignKey:ExperimentID"`
 }
 
 // Inventory 库存
@@ -110,9 +329,53 @@ type Inventory struct {
 	Quantity   int       `json:"quantity"`
 	BuyPrice   float64   `json:"buy_price"`
 	Platform   string    `json:"platform"`
+	StrategyID *uint     `json:"strategy_id,omitempty"` // 由哪个策略买入
+	SubscriptionID *uint `json:"subscription_id,omitempty"` // 由哪个跟单订阅买入
 	AcquiredAt time.Time `json:"acquired_at"`
 	Tradable   bool      `json:"tradable"`
 	Locked     bool      `json:"locked"` // 是否被策略锁定
+
+	// 检视链接解析出的磨损值和图案模板
+	InspectLink  string     `json:"inspect_link,omitempty"`
+	FloatValue   *float64   `json:"float_value,omitempty" gorm:"index"`
+	PaintSeed    *int       `json:"paint_seed,omitempty"`
+	PaintIndex   *int       `json:"paint_index,omitempty"`
+	InspectedAt  *time.Time `json:"inspected_at,omitempty"`
+	InspectError string     `json:"inspect_error,omitempty"`
+
+	// 为站外用途（赠送、手动交易等）预留，到期前策略和自动卖出规则不会动用
+	ReservedUntil *time.Time `json:"reserved_until,omitempty" gorm:"index"`
+	ReservedFor   string     `json:"reserved_for,omitempty"`
+}
+
+// Position 用户在单个物品上的持仓汇总，按移动平均成本计算盈亏；Inventory保存构成持仓的各个批次
+type Position struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      uint      `json:"user_id" gorm:"uniqueIndex:idx_positions_user_item"`
+	ItemID      uint      `json:"item_id" gorm:"uniqueIndex:idx_positions_user_item"`
+	Item        Item      `json:"item" gorm:"foreignKey:ItemID"`
+	Quantity    int       `json:"quantity"`
+	AvgPrice    float64   `json:"avg_price"`                               // 含买入手续费的平均成本
+	RealizedPnL float64   `json:"realized_pnl" gorm:"column:realized_pnl"` // 卖出金额扣除手续费和平均成本后的累计盈亏
+
+	// 按物品当前价格计算，不入库
+	MarketValue   float64 `json:"market_value" gorm:"-"`
+	UnrealizedPnL float64 `json:"unrealized_pnl" gorm:"-"`
+}
+
+// PortfolioSnapshot 用户库存每日估值快照，按当日物品价格计算，没有价格的物品按买入价计算
+type PortfolioSnapshot struct {
+	ID            uint      `json:"id" gorm:"primarykey"`
+	CreatedAt     time.Time `json:"created_at"`
+	UserID        uint      `json:"user_id" gorm:"uniqueIndex:idx_portfolio_snapshots_user_date,priority:1"`
+	Date          time.Time `json:"date" gorm:"type:date;uniqueIndex:idx_portfolio_snapshots_user_date,priority:2"`
+	MarketValue   float64   `json:"market_value"`
+	CostBasis     float64   `json:"cost_basis"`
+	UnrealizedPnL float64   `json:"unrealized_pnl" gorm:"column:unrealized_pnl"`
+	RealizedPnL   float64   `json:"realized_pnl" gorm:"column:realized_pnl"` // 截至当日的累计已实现盈亏
+	Quantity      int       `json:"quantity"`                                // 持有物品件数
 }
 
 // MarketData 市场数据快照
@@ -136,11 +399,342 @@ type Notification struct {
 	gorm.Model
 	UserID   uint      `json:"user_id"`
 	User     User      `json:"user" gorm:"foreignKey:UserID"`
-	Type     string    `json:"type"` // price_alert, order_executed, strategy_alert
+	Type     string    `json:"type"` // 事件名，如price.alert、risk.rejected
 	Title    string    `json:"title"`
 	Message  string    `json:"message"`
 	Read     bool      `json:"read"`
-	Priority string    `json:"priority"` // low, medium, high
+	Priority string    `json:"priority"` // low, medium, high, critical
 	Data     string    `json:"data" gorm:"type:jsonb"`
 	ReadAt   *time.Time `json:"read_at,omitempty"`
-}
\ No newline at end of file
+}
+
+// Subscription 跟单订阅
+type Subscription struct {
+	gorm.Model
+	FollowerID    uint     `json:"follower_id" gorm:"index"`
+	Follower      User     `json:"-" gorm:"foreignKey:FollowerID"`
+	StrategyID    uint     `json:"strategy_id" gorm:"index"`
+	Strategy      Strategy `json:"strategy" gorm:"foreignKey:StrategyID"`
+	Budget        float64  `json:"budget"`          // 跟单者为该策略分配的资金
+	MaxOrderValue float64  `json:"max_order_value"` // 单笔跟单金额上限，0表示不限制
+	Status        string   `json:"status"`          // active, paused
+}
+
+// SavedView 用户保存的筛选视图
+type SavedView struct {
+	gorm.Model
+	UserID  uint   `json:"user_id" gorm:"uniqueIndex:idx_saved_views_user_name"`
+	Name    string `json:"name" gorm:"uniqueIndex:idx_saved_views_user_name"`
+	Target  string `json:"target"` // orders, market_items
+	Filters string `json:"filters" gorm:"type:jsonb"` // JSON筛选条件
+}
+
+// ItemWatch 物品趋势订阅，趋势反转或RSI越过阈值时通知
+type ItemWatch struct {
+	gorm.Model
+	UserID         uint       `json:"user_id" gorm:"uniqueIndex:idx_item_watches_user_item"`
+	ItemID         uint       `json:"item_id" gorm:"uniqueIndex:idx_item_watches_user_item"`
+	Item           Item       `json:"item" gorm:"foreignKey:ItemID"`
+	WebhookURL     string     `json:"webhook_url"`
+	RSIAbove       float64    `json:"rsi_above"` // 0表示不监控
+	RSIBelow       float64    `json:"rsi_below"`
+	Trend          string     `json:"trend"`           // 已确认的趋势：bullish, bearish
+	Zone           string     `json:"zone"`            // 已确认的RSI区间：above, below, 空表示区间内
+	PendingTrend   string     `json:"-"`
+	PendingZone    string     `json:"-"`
+	TrendCount     int        `json:"-"`
+	ZoneCount      int        `json:"-"`
+	LastNotifiedAt *time.Time `json:"last_notified_at,omitempty"`
+}
+
+// PriceAlert 用户自定义价格提醒，条件满足时记录通知并推送
+type PriceAlert struct {
+	gorm.Model
+	UserID          uint       `json:"user_id" gorm:"index"`
+	ItemID          uint       `json:"item_id" gorm:"index"`
+	Item            Item       `json:"item" gorm:"foreignKey:ItemID"`
+	Platform        string     `json:"platform"`   // 为空表示任意平台
+	Expression      string     `json:"expression"` // 原始条件，如 "price < 100"、"drops 10% in 1h"
+	Operator        string     `json:"operator"`   // <, <=, >, >=, drops, rises
+	Threshold       float64    `json:"threshold"`  // 价格或涨跌百分比
+	Window          int        `json:"window" gorm:"column:window_seconds"` // 涨跌幅统计窗口（秒）
+	Repeat          bool       `json:"repeat"`     // 触发后继续生效，否则触发一次后停用
+	Cooldown        int        `json:"cooldown"`   // 重复提醒的最小间隔（秒）
+	Enabled         bool       `json:"enabled"`
+	Active          bool       `json:"active"` // 条件当前是否满足，条件恢复后才会再次触发
+	TriggerCount    int        `json:"trigger_count"`
+	LastPrice       float64    `json:"last_price"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at,omitempty"`
+}
+
+// Webhook 用户注册的事件回调
+type Webhook struct {
+	gorm.Model
+	UserID      uint   `json:"user_id" gorm:"index"`
+	URL         string `json:"url"`
+	Events      string `json:"events"` // 逗号分隔的事件名，*表示全部事件
+	Secret      string `json:"-"`      // 请求签名密钥，只在创建时返回
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// WebhookDelivery Webhook投递记录，失败后按指数退避重试
+type WebhookDelivery struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	WebhookID     uint       `json:"webhook_id" gorm:"index"`
+	Event         string     `json:"event"`
+	Payload       string     `json:"payload" gorm:"type:jsonb"`
+	Status        string     `json:"status" gorm:"index"` // pending, success, failed
+	Attempts      int        `json:"attempts"`
+	ResponseCode  int        `json:"response_code"`
+	Error         string     `json:"error"`
+	DurationMs    int64      `json:"duration_ms"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty" gorm:"index"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"index"`
+}
+
+// TelegramLink 用户绑定的Telegram会话，ChatID为空表示绑定码尚未使用
+type TelegramLink struct {
+	ID            uint       `json:"id" gorm:"primarykey"`
+	UserID        uint       `json:"user_id" gorm:"uniqueIndex"`
+	ChatID        *int64     `json:"chat_id,omitempty" gorm:"index"`
+	Username      string     `json:"username"`
+	LinkCode      string     `json:"-" gorm:"index"`
+	LinkExpiresAt *time.Time `json:"-"`
+	LinkedAt      *time.Time `json:"linked_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// NewItemSubscription 用户订阅的新物品上架通知
+type NewItemSubscription struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex"`
+	Keywords  string    `json:"keywords"` // 逗号分隔，物品名包含任一关键词时通知，为空表示全部
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// EmailSubscription 用户的邮件通知设置
+type EmailSubscription struct {
+	ID           uint       `json:"id" gorm:"primarykey"`
+	UserID       uint       `json:"user_id" gorm:"uniqueIndex"`
+	Address      string     `json:"address"`
+	Alerts       bool       `json:"alerts"` // 关键事件：订单失败、策略停止、新设备登录
+	Digest       bool       `json:"digest"` // 每日摘要，需用户主动开启
+	LastDigestAt *time.Time `json:"last_digest_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// LoginDevice 用户登录过的设备，按User-Agent识别
+type LoginDevice struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	UserID      uint      `json:"user_id" gorm:"uniqueIndex:idx_login_device"`
+	Fingerprint string    `json:"-" gorm:"uniqueIndex:idx_login_device"`
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// UserSession 一次登录产生的会话，刷新令牌轮换时沿用，吊销后该会话的令牌全部失效
+type UserSession struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	SessionID  string     `json:"-" gorm:"uniqueIndex"` // 令牌中的sid
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Current    bool       `json:"current" gorm:"-"` // 是否为发起查询的会话
+}
+
+// APIKey 供脚本和机器人使用的长期访问密钥，只保存SHA-256哈希，明文只在创建时返回一次
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // 密钥开头的若干字符，便于用户辨认
+	Hash       string     `json:"-" gorm:"uniqueIndex"`
+	Scopes     string     `json:"scopes"` // 逗号分隔的权限，如 read:market,trade:execute
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// StoredFile 存储中的用户文件（报表、导出、图片缓存），过期后由清理任务删除
+type StoredFile struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UserID      uint       `json:"user_id" gorm:"index"`
+	Kind        string     `json:"kind" gorm:"index"` // report, export, image
+	Name        string     `json:"name"`              // 下载时的文件名
+	Key         string     `json:"-" gorm:"uniqueIndex"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" gorm:"index"` // 为空表示永久保存
+}
+
+// ExportJob 异步导出任务，Cursor和Written为最近一次检查点：已导出的最后一条记录ID和临时文件中已写入的字节数
+type ExportJob struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Kind       string     `json:"kind" gorm:"size:32"`         // price_history, transactions, tax_report
+	Params     string     `json:"params" gorm:"type:jsonb"`     // 筛选条件
+	Status     string     `json:"status" gorm:"size:16;index"` // pending, running, completed, failed, canceled
+	Total      int64      `json:"total"`                       // 开始时统计的总行数
+	Rows       int64      `json:"rows"`                        // 已导出的行数
+	Progress   float64    `json:"progress" gorm:"-"`
+	Cursor     uint       `json:"-"`
+	Written    int64      `json:"-"`
+	LeaseUntil *time.Time `json:"-"` // 执行中的实例定期续期，过期后由其他实例接手
+	FileID     *uint      `json:"file_id,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // 导出文件的过期时间
+}
+
+// PlatformSession 使用Cookie登录的平台的会话，Cookie自动刷新或管理员重新登录后保存，重启后优先于配置文件
+type PlatformSession struct {
+	ID          uint       `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Platform    string     `json:"platform" gorm:"uniqueIndex;size:32"`
+	Cookie      string     `json:"-" gorm:"type:text"`
+	Status      string     `json:"status" gorm:"size:16"` // unknown, healthy, expired, error
+	Failures    int        `json:"failures"`              // 连续检查失败次数
+	CheckedAt   *time.Time `json:"checked_at,omitempty"`
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty"` // 最近一次换取到新会话或管理员更新Cookie的时间
+	ExpiredAt   *time.Time `json:"expired_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// WeChatBinding 用户的微信推送设置，Provider为serverchan或wecom
+type WeChatBinding struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex"`
+	Provider  string    `json:"provider"`
+	Key       string    `json:"-"` // Server酱的SendKey或企业微信群机器人的key
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NotificationPreference 用户对某个通知渠道的偏好，没有记录时使用渠道的默认设置
+type NotificationPreference struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	UserID      uint      `json:"user_id" gorm:"uniqueIndex:idx_notification_pref"`
+	Channel     string    `json:"channel" gorm:"uniqueIndex:idx_notification_pref"` // websocket, email, telegram, wechat
+	Enabled     bool      `json:"enabled"`
+	Events      string    `json:"events"`       // 逗号分隔的事件名，*表示全部事件
+	MinSeverity string    `json:"min_severity"` // low, medium, high, critical
+	QuietStart  string    `json:"quiet_start"`  // 免打扰开始时间HH:MM，为空表示不启用
+	QuietEnd    string    `json:"quiet_end"`
+	Timezone    string    `json:"timezone"` // 免打扰时段的时区，为空表示UTC
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Annotation 价格图表标注：全局事件（游戏更新、箱子发布）或用户备注
+type Annotation struct {
+	gorm.Model
+	UserID      *uint     `json:"user_id,omitempty" gorm:"index"` // 为空表示管理员发布的全局事件
+	ItemID      *uint     `json:"item_id,omitempty" gorm:"index"` // 为空表示作用于所有物品
+	Kind        string    `json:"kind"`                           // game_update, case_release, note
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	URL         string    `json:"url"`
+	Time        time.Time `json:"time" gorm:"index"`
+}
+
+// ItemMention 物品在社区来源上的每日提及数
+type ItemMention struct {
+	ID       uint      `json:"id" gorm:"primarykey"`
+	ItemID   uint      `json:"item_id" gorm:"uniqueIndex:idx_item_mentions_day"`
+	Day      time.Time `json:"day" gorm:"type:date;uniqueIndex:idx_item_mentions_day"`
+	Source   string    `json:"source" gorm:"uniqueIndex:idx_item_mentions_day"` // reddit, weibo
+	Mentions int       `json:"mentions"`
+}
+
+// AppraisalShare 库存估值分享，创建时保存估值快照，通过签名链接只读访问
+type AppraisalShare struct {
+	gorm.Model
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Title      string     `json:"title"`
+	Currency   string     `json:"currency"`
+	TotalValue float64    `json:"total_value"`
+	ItemCount  int        `json:"item_count"`
+	Items      string     `json:"-" gorm:"type:jsonb"` // 物品明细快照
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Views      int        `json:"views"`
+}
+
+// StrategyState 策略运行时状态快照，服务重启后用于恢复执行器
+type StrategyState struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	StrategyID uint      `json:"strategy_id" gorm:"uniqueIndex"`
+	Type       string    `json:"type"`
+	State      string    `json:"state" gorm:"type:jsonb"`
+	Cycle      int64     `json:"cycle"` // 快照时已执行的周期数
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// StrategyRunLog 策略运行中的关键事件，如与其他策略冲突时的仲裁结果
+type StrategyRunLog struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time `json:"created_at"`
+	StrategyID uint      `json:"strategy_id" gorm:"index"`
+	Event      string    `json:"event"`
+	Message    string    `json:"message"`
+	Data       string    `json:"data" gorm:"type:jsonb"`
+}
+
+// FeeScheduleVersion 平台手续费和规则的历史版本，自EffectiveFrom起生效直到下一个版本；
+// 早于第一个版本的交易使用配置文件中的手续费
+type FeeScheduleVersion struct {
+	ID            uint      `json:"id" gorm:"primarykey"`
+	Platform      string    `json:"platform" gorm:"index:idx_fee_versions_platform_from"` // default表示未单独配置的平台
+	Buy           float64   `json:"buy"`
+	Sell          float64   `json:"sell"`
+	MinFee        float64   `json:"min_fee"`
+	WithdrawalFee float64   `json:"withdrawal_fee"` // 提现费率
+	Notes         string    `json:"notes"`          // 规则变化说明，如交易冷却期调整
+	EffectiveFrom time.Time `json:"effective_from" gorm:"index:idx_fee_versions_platform_from"`
+	CreatedBy     uint      `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// LedgerEntry 资金流水，余额为流水金额之和；流水只追加，更正通过反向流水完成
+type LedgerEntry struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Type      string    `json:"type"`   // trade, fee, adjustment
+	Amount    float64   `json:"amount"` // 本位币，正数入账、负数出账
+	OrderID   *uint     `json:"order_id,omitempty" gorm:"index"`
+	ActorID   *uint     `json:"actor_id,omitempty"` // 手工调整的管理员
+	Reason    string    `json:"reason,omitempty"`
+	Balance   float64   `json:"balance"` // 入账后的余额
+}
+
+// AuditLog 审计日志，记录用户、管理员和系统自动修复的操作，写入后不可修改或删除
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+	ActorID    *uint     `json:"actor_id,omitempty" gorm:"index"` // 为空表示系统操作
+	UserID     *uint     `json:"user_id,omitempty" gorm:"index"`  // 被操作的账户，账户所有者可查询
+	Action     string    `json:"action" gorm:"index"`
+	EntityType string    `json:"entity_type"`
+	EntityID   uint      `json:"entity_id"`
+	Details    string    `json:"details" gorm:"type:jsonb"`
+	Before     string    `json:"before" gorm:"type:jsonb"` // 修改前的状态，新建时为null
+	After      string    `json:"after" gorm:"type:jsonb"`  // 修改后的状态，删除时为null
+	IP         string    `json:"ip,omitempty"`
+}
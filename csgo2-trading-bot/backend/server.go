@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"csgo2-trading-bot/config"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// server 主服务以及可选的HTTP重定向/ACME验证服务
+type server struct {
+	main     *http.Server
+	redirect *http.Server
+	cfg      config.ServerConfig
+}
+
+func newServer(handler http.Handler, cfg config.ServerConfig) (*server, error) {
+	s := &server{
+		main: &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.Port),
+			Handler:           handler,
+			ReadTimeout:       seconds(cfg.ReadTimeout),
+			ReadHeaderTimeout: seconds(cfg.ReadHeaderTimeout),
+			WriteTimeout:      seconds(cfg.WriteTimeout),
+			IdleTimeout:       seconds(cfg.IdleTimeout),
+		},
+		cfg: cfg,
+	}
+
+	tlsCfg := cfg.TLS
+	if !tlsCfg.Enabled {
+		return s, nil
+	}
+
+	var challenge func(http.Handler) http.Handler
+	if tlsCfg.AutoCert {
+		if len(tlsCfg.Domains) == 0 {
+			return nil, errors.New("server.tls.domains is required for autocert")
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tlsCfg.Domains...),
+			Cache:      autocert.DirCache(tlsCfg.CacheDir),
+			Email:      tlsCfg.Email,
+		}
+		// TLSConfig已包含h2和ACME TLS-ALPN协议
+		s.main.TLSConfig = manager.TLSConfig()
+		challenge = manager.HTTPHandler
+	} else {
+		if tlsCfg.CertFile == "" || tlsCfg.KeyFile == "" {
+			return nil, errors.New("server.tls.cert_file and key_file are required")
+		}
+		s.main.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			NextProtos: []string{"h2", "http/1.1"},
+		}
+	}
+
+	// autocert的HTTP-01验证同样需要80端口
+	if tlsCfg.RedirectHTTP || tlsCfg.AutoCert {
+		var h http.Handler = http.HandlerFunc(redirectToHTTPS(cfg.Port))
+		if challenge != nil {
+			h = challenge(h)
+		}
+		s.redirect = &http.Server{
+			Addr:              fmt.Sprintf(":%d", tlsCfg.HTTPPort),
+			Handler:           h,
+			ReadHeaderTimeout: seconds(cfg.ReadHeaderTimeout),
+			IdleTimeout:       seconds(cfg.IdleTimeout),
+		}
+	}
+
+	return s, nil
+}
+
+// ListenAndServe 启动服务，阻塞直到主服务退出
+func (s *server) ListenAndServe() error {
+	if s.redirect != nil {
+		go func() {
+			if err := s.redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logrus.Errorf("HTTP redirect server failed: %v", err)
+			}
+		}()
+	}
+
+	if !s.cfg.TLS.Enabled {
+		return s.main.ListenAndServe()
+	}
+	if s.cfg.TLS.AutoCert {
+		return s.main.ListenAndServeTLS("", "")
+	}
+	return s.main.ListenAndServeTLS(s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile)
+}
+
+// Shutdown 优雅关闭所有监听
+func (s *server) Shutdown(ctx context.Context) error {
+	if s.redirect != nil {
+		s.redirect.Shutdown(ctx)
+	}
+	return s.main.Shutdown(ctx)
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+func redirectToHTTPS(port int) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, fmt.Sprint(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
@@ -0,0 +1,181 @@
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/config"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const keyPrefix = "activity:"
+
+// 单页最多返回的条目数
+const maxPage = 200
+
+// ErrInvalidCursor 分页游标不是合法的流ID
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Entry 动态中的一条记录，ID为Redis流ID，按时间递增，可作为分页和续读的游标
+type Entry struct {
+	ID    string          `json:"id"`
+	Type  string          `json:"type"` // 订单事件为order.<事件>，其余与通知事件相同
+	Title string          `json:"title"`
+	Body  string          `json:"body,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Time  time.Time       `json:"time"`
+}
+
+// Service 用户动态：订单、成交、策略事件和提醒按时间顺序写入每个用户的Redis流，超出长度的旧记录自动裁剪
+type Service struct {
+	redis  redis.UniversalClient
+	config config.ActivityConfig
+}
+
+func NewService(redisClient redis.UniversalClient, cfg config.ActivityConfig) *Service {
+	if cfg.MaxLen <= 0 {
+		cfg.MaxLen = 1000
+	}
+	return &Service{
+		redis:  redisClient,
+		config: cfg,
+	}
+}
+
+// Record 追加一条动态，写入失败只记录日志，不影响调用方
+func (s *Service) Record(userID uint, entryType, title, body string, data interface{}) {
+	if s == nil || userID == 0 {
+		return
+	}
+	values := map[string]interface{}{
+		"type":  entryType,
+		"title": title,
+		"time":  time.Now().UnixMilli(),
+	}
+	if body != "" {
+		values["body"] = body
+	}
+	if data != nil {
+		if b, err := json.Marshal(data); err == nil {
+			values["data"] = string(b)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	key := streamKey(userID)
+	pipe := s.redis.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: int64(s.config.MaxLen),
+		Approx: true,
+		Values: values,
+	})
+	if s.config.TTLDays > 0 {
+		// 长期不活跃的用户整条流过期，活跃用户每次写入都会续期
+		pipe.Expire(ctx, key, time.Duration(s.config.TTLDays)*24*time.Hour)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logrus.Warnf("Failed to record %s activity for user %d: %v", entryType, userID, err)
+	}
+}
+
+// Page 按时间倒序分页，before为上一页最后一条的ID，为空时从最新开始；返回的next为空表示没有更早的记录
+func (s *Service) Page(ctx context.Context, userID uint, before string, limit int) ([]Entry, string, error) {
+	if limit <= 0 || limit > maxPage {
+		limit = 50
+	}
+	end := "+"
+	if before != "" {
+		if !ValidCursor(before) {
+			return nil, "", ErrInvalidCursor
+		}
+		end = "(" + before
+	}
+
+	messages, err := s.redis.XRevRangeN(ctx, streamKey(userID), end, "-", int64(limit)).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	entries := decode(messages)
+	next := ""
+	if len(entries) == limit {
+		next = entries[len(entries)-1].ID
+	}
+	return entries, next, nil
+}
+
+// Latest 最新一条动态的ID，没有动态时返回0-0，用作续读的起点
+func (s *Service) Latest(ctx context.Context, userID uint) (string, error) {
+	messages, err := s.redis.XRevRangeN(ctx, streamKey(userID), "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "0-0", nil
+	}
+	return messages[0].ID, nil
+}
+
+// Tail 阻塞等待after之后的新动态，最多等待block；没有新动态时返回空
+func (s *Service) Tail(ctx context.Context, userID uint, after string, block time.Duration) ([]Entry, error) {
+	if !ValidCursor(after) {
+		return nil, ErrInvalidCursor
+	}
+	streams, err := s.redis.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{streamKey(userID), after},
+		Count:   maxPage,
+		Block:   block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil || len(streams) == 0 {
+		return nil, err
+	}
+	return decode(streams[0].Messages), nil
+}
+
+func decode(messages []redis.XMessage) []Entry {
+	entries := make([]Entry, 0, len(messages))
+	for _, msg := range messages {
+		entry := Entry{ID: msg.ID}
+		entry.Type, _ = msg.Values["type"].(string)
+		entry.Title, _ = msg.Values["title"].(string)
+		entry.Body, _ = msg.Values["body"].(string)
+		if data, ok := msg.Values["data"].(string); ok && json.Valid([]byte(data)) {
+			entry.Data = json.RawMessage(data)
+		}
+		if ms, ok := msg.Values["time"].(string); ok {
+			if v, err := strconv.ParseInt(ms, 10, 64); err == nil {
+				entry.Time = time.UnixMilli(v)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// ValidCursor 游标是否为合法的流ID，格式为<毫秒>-<序号>，也接受只有毫秒的形式
+func ValidCursor(id string) bool {
+	ms, seq, found := strings.Cut(id, "-")
+	if _, err := strconv.ParseUint(ms, 10, 64); err != nil {
+		return false
+	}
+	if found {
+		_, err := strconv.ParseUint(seq, 10, 64)
+		return err == nil
+	}
+	return true
+}
+
+func streamKey(userID uint) string {
+	return keyPrefix + strconv.FormatUint(uint64(userID), 10)
+}
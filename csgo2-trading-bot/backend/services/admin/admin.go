@@ -0,0 +1,230 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/audit"
+	"csgo2-trading-bot/services/ledger"
+	"csgo2-trading-bot/services/positions"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrUserNotFound 用户不存在
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInventoryNotFound 库存不存在或不属于该用户
+	ErrInventoryNotFound = errors.New("inventory not found")
+)
+
+// InventoryAdjustment 库存手工调整
+//
+//	add     补录库存（如平台上已到账但未同步的物品），需要item_id和quantity
+//	remove  移除库存（如卡在平台上已无法取回的物品），quantity为0或不小于现有数量时整条移除
+//	unlock  解除锁定（如挂单已不存在但库存仍被锁定）
+type InventoryAdjustment struct {
+	Action       string  `json:"action" binding:"required"`
+	InventoryID  uint    `json:"inventory_id"`
+	ItemID       uint    `json:"item_id"`
+	Quantity     int     `json:"quantity"`
+	BuyPrice     float64 `json:"buy_price"`
+	Platform     string  `json:"platform"`
+	AssetID      string  `json:"asset_id"`
+	Compensation float64 `json:"compensation"` // 不为0时同时记一笔资金流水，如补偿无法取回物品的价值
+	Reason       string  `json:"reason" binding:"required"`
+}
+
+// Service 管理员手工修正库存和余额，所有修改都写入审计日志
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// AdjustInventory 调整用户库存，返回调整后的库存记录
+func (s *Service) AdjustInventory(actorID, userID uint, adj InventoryAdjustment) (*models.Inventory, error) {
+	adj.Reason = strings.TrimSpace(adj.Reason)
+	if adj.Reason == "" {
+		return nil, errors.New("reason is required")
+	}
+	if adj.Quantity < 0 {
+		return nil, errors.New("quantity must not be negative")
+	}
+
+	var inventory models.Inventory
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.userExists(tx, userID); err != nil {
+			return err
+		}
+
+		var before interface{}
+		switch adj.Action {
+		case "add":
+			if adj.ItemID == 0 || adj.Quantity == 0 {
+				return errors.New("item_id and quantity are required")
+			}
+			var item models.Item
+			if err := tx.Select("id").First(&item, adj.ItemID).Error; err != nil {
+				return errors.New("item not found")
+			}
+			inventory = models.Inventory{
+				UserID:     userID,
+				ItemID:     adj.ItemID,
+				AssetID:    adj.AssetID,
+				Quantity:   adj.Quantity,
+				BuyPrice:   adj.BuyPrice,
+				Platform:   adj.Platform,
+				AcquiredAt: time.Now(),
+				Tradable:   true,
+			}
+			if err := tx.Create(&inventory).Error; err != nil {
+				return err
+			}
+			if err := positions.Buy(tx, userID, adj.ItemID, adj.Quantity, adj.BuyPrice*float64(adj.Quantity)); err != nil {
+				return err
+			}
+
+		case "remove", "unlock":
+			if err := tx.Where("id = ? AND user_id = ?", adj.InventoryID, userID).First(&inventory).Error; err != nil {
+				return ErrInventoryNotFound
+			}
+			before = map[string]interface{}{"quantity": inventory.Quantity, "locked": inventory.Locked}
+
+			removed := inventory.Quantity
+			var err error
+			switch {
+			case adj.Action == "unlock":
+				inventory.Locked = false
+				err = tx.Model(&inventory).Update("locked", false).Error
+			case adj.Quantity == 0 || adj.Quantity >= inventory.Quantity:
+				inventory.Quantity = 0
+				err = tx.Delete(&inventory).Error
+			default:
+				inventory.Quantity -= adj.Quantity
+				err = tx.Model(&inventory).Update("quantity", inventory.Quantity).Error
+			}
+			if err != nil {
+				return err
+			}
+			if removed -= inventory.Quantity; removed > 0 {
+				if err := positions.Remove(tx, userID, inventory.ItemID, removed); err != nil {
+					return err
+				}
+			}
+
+		default:
+			return fmt.Errorf("unknown action %q", adj.Action)
+		}
+
+		details := map[string]interface{}{
+			"user_id":  userID,
+			"reason":   adj.Reason,
+			"item_id":  inventory.ItemID,
+			"quantity": inventory.Quantity,
+			"locked":   inventory.Locked,
+		}
+		if before != nil {
+			details["before"] = before
+		}
+		if adj.Compensation != 0 {
+			entry := models.LedgerEntry{
+				UserID:  userID,
+				Type:    ledger.TypeAdjustment,
+				Amount:  adj.Compensation,
+				ActorID: &actorID,
+				Reason:  adj.Reason,
+			}
+			if err := ledger.Post(tx, &entry); err != nil {
+				return err
+			}
+			details["ledger_entry_id"] = entry.ID
+			details["compensation"] = adj.Compensation
+		}
+		return audit.Log(tx, audit.Entry{
+			ActorID:    &actorID,
+			UserID:     &userID,
+			Action:     "admin.inventory_" + adj.Action,
+			EntityType: "inventory",
+			EntityID:   inventory.ID,
+			Details:    details,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &inventory, nil
+}
+
+// AdjustBalance 记一笔余额更正流水，amount为正表示入账（如线下充值），为负表示扣减
+func (s *Service) AdjustBalance(actorID, userID uint, amount float64, reason string) (*models.LedgerEntry, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("reason is required")
+	}
+	if amount == 0 {
+		return nil, errors.New("amount must not be zero")
+	}
+
+	entry := models.LedgerEntry{
+		UserID:  userID,
+		Type:    ledger.TypeAdjustment,
+		Amount:  amount,
+		ActorID: &actorID,
+		Reason:  reason,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.userExists(tx, userID); err != nil {
+			return err
+		}
+		if err := ledger.Post(tx, &entry); err != nil {
+			return err
+		}
+		return audit.Log(tx, audit.Entry{
+			ActorID:    &actorID,
+			UserID:     &userID,
+			Action:     "admin.balance_adjust",
+			EntityType: "ledger_entry",
+			EntityID:   entry.ID,
+			Details: map[string]interface{}{
+				"user_id": userID,
+				"amount":  amount,
+				"balance": entry.Balance,
+				"reason":  reason,
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Ledger 用户的余额和最近的资金流水
+func (s *Service) Ledger(userID uint, limit int) (float64, []models.LedgerEntry, error) {
+	if err := s.userExists(s.db, userID); err != nil {
+		return 0, nil, err
+	}
+	balance, err := ledger.Balance(s.db, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	entries, err := ledger.Entries(s.db, userID, limit)
+	return balance, entries, err
+}
+
+func (s *Service) userExists(db *gorm.DB, userID uint) error {
+	var count int64
+	if err := db.Model(&models.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
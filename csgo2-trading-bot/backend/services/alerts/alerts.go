@@ -0,0 +1,302 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/market"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/scheduler"
+	"csgo2-trading-bot/services/webhooks"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound 提醒不存在或不属于当前用户
+var ErrNotFound = errors.New("alert not found")
+
+// Rule 创建或修改提醒时提交的规则
+type Rule struct {
+	ItemID    uint   `json:"item_id" binding:"required"`
+	Platform  string `json:"platform"`
+	Condition string `json:"condition" binding:"required"` // 如 "price < 100"、"drops 10% in 1h"
+	Repeat    bool   `json:"repeat"`
+	Cooldown  int    `json:"cooldown"`
+	Enabled   *bool  `json:"enabled"`
+}
+
+// Event 提醒触发时写入通知的数据
+type Event struct {
+	Event         string    `json:"event"`
+	AlertID       uint      `json:"alert_id"`
+	ItemID        uint      `json:"item_id"`
+	ItemName      string    `json:"item_name"`
+	Platform      string    `json:"platform"`
+	Condition     string    `json:"condition"`
+	Price         float64   `json:"price"`
+	Reference     float64   `json:"reference,omitempty"`      // 窗口内的最高价或最低价
+	ChangePercent float64   `json:"change_percent,omitempty"` // 相对reference的涨跌幅
+	Time          time.Time `json:"time"`
+}
+
+// Service 价格提醒，行情服务写入价格时实时评估，并定期扫描其他来源写入的价格
+type Service struct {
+	db        *gorm.DB
+	notifier  *notify.Router
+	config    config.AlertsConfig
+	ticks     chan market.PriceUpdate
+	lastSweep time.Time
+}
+
+func NewService(db *gorm.DB, notifier *notify.Router, cfg config.AlertsConfig) *Service {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	return &Service{
+		db:       db,
+		notifier: notifier,
+		config:   cfg,
+		ticks:    make(chan market.PriceUpdate, cfg.QueueSize),
+	}
+}
+
+// Start 订阅行情服务的价格更新，启动评估协程并注册补充扫描任务
+func (s *Service) Start(marketService *market.Service, sched *scheduler.Scheduler) error {
+	marketService.OnPriceUpdate(s.enqueue)
+	s.lastSweep = time.Now()
+	go s.run()
+
+	return sched.Add(scheduler.Job{
+		ID:   "price_alerts",
+		Spec: (time.Duration(s.config.Interval) * time.Second).String(),
+		Run:  s.sweep,
+	})
+}
+
+// List 获取用户的提醒规则
+func (s *Service) List(userID uint) ([]models.PriceAlert, error) {
+	var alerts []models.PriceAlert
+	err := s.db.Preload("Item").Where("user_id = ?", userID).Order("created_at DESC").Find(&alerts).Error
+	return alerts, err
+}
+
+// Create 创建提醒规则
+func (s *Service) Create(userID uint, rule Rule) (*models.PriceAlert, error) {
+	var count int64
+	s.db.Model(&models.PriceAlert{}).Where("user_id = ?", userID).Count(&count)
+	if s.config.MaxPerUser > 0 && count >= int64(s.config.MaxPerUser) {
+		return nil, fmt.Errorf("at most %d alerts are allowed", s.config.MaxPerUser)
+	}
+
+	alert := models.PriceAlert{UserID: userID, Enabled: true}
+	if err := s.apply(&alert, rule); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(&alert).Error; err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// Update 修改提醒规则，修改后重新开始判断条件
+func (s *Service) Update(alertID, userID uint, rule Rule) (*models.PriceAlert, error) {
+	var alert models.PriceAlert
+	if err := s.db.Where("id = ? AND user_id = ?", alertID, userID).First(&alert).Error; err != nil {
+		return nil, ErrNotFound
+	}
+	if err := s.apply(&alert, rule); err != nil {
+		return nil, err
+	}
+	alert.Active = false
+
+	err := s.db.Model(&alert).
+		Select("item_id", "platform", "expression", "operator", "threshold", "window_seconds", "repeat", "cooldown", "enabled", "active").
+		Updates(&alert).Error
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// Delete 删除提醒规则
+func (s *Service) Delete(alertID, userID uint) error {
+	result := s.db.Unscoped().Where("id = ? AND user_id = ?", alertID, userID).Delete(&models.PriceAlert{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// apply 校验规则并写入提醒
+func (s *Service) apply(alert *models.PriceAlert, rule Rule) error {
+	cond, err := parseCondition(rule.Condition)
+	if err != nil {
+		return err
+	}
+	if rule.Cooldown < 0 {
+		return errors.New("cooldown must not be negative")
+	}
+
+	var item models.Item
+	if err := s.db.Select("id").First(&item, rule.ItemID).Error; err != nil {
+		return errors.New("item not found")
+	}
+
+	alert.ItemID = rule.ItemID
+	alert.Platform = strings.TrimSpace(rule.Platform)
+	alert.Expression = strings.Join(strings.Fields(rule.Condition), " ")
+	alert.Operator = cond.Operator
+	alert.Threshold = cond.Threshold
+	alert.Window = int(cond.Window / time.Second)
+	alert.Repeat = rule.Repeat
+	alert.Cooldown = rule.Cooldown
+	if rule.Enabled != nil {
+		alert.Enabled = *rule.Enabled
+	}
+	return nil
+}
+
+// enqueue 价格更新回调，缓冲区满时丢弃，由补充扫描兜底
+func (s *Service) enqueue(update market.PriceUpdate) {
+	select {
+	case s.ticks <- update:
+	default:
+		logrus.Debugf("Price alert queue is full, item %d update dropped", update.ItemID)
+	}
+}
+
+// run 单协程按顺序评估价格，避免同一提醒被并发触发
+func (s *Service) run() {
+	for update := range s.ticks {
+		s.evaluate(update)
+	}
+}
+
+// sweep 把上次扫描之后写入的各平台最新价格加入评估队列，覆盖平台同步等直接写库的价格来源
+func (s *Service) sweep() {
+	since := s.lastSweep
+	s.lastSweep = time.Now()
+
+	var rows []models.PriceHistory
+	err := s.db.Raw(`
+		SELECT DISTINCT ON (item_id, platform) item_id, platform, price, recorded_at
+		FROM price_histories
+		WHERE recorded_at > ?
+		AND item_id IN (SELECT item_id FROM price_alerts WHERE enabled AND deleted_at IS NULL)
+		ORDER BY item_id, platform, recorded_at DESC`, since).Scan(&rows).Error
+	if err != nil {
+		logrus.Errorf("Failed to load prices for alerts: %v", err)
+		return
+	}
+
+	for _, row := range rows {
+		s.enqueue(market.PriceUpdate{ItemID: row.ItemID, Price: row.Price, Platform: row.Platform, Time: row.RecordedAt})
+	}
+}
+
+// evaluate 用一条价格评估该物品的所有提醒
+func (s *Service) evaluate(update market.PriceUpdate) {
+	var alerts []models.PriceAlert
+	err := s.db.Preload("Item").
+		Where("item_id = ? AND enabled = ? AND (platform = '' OR platform = ?)", update.ItemID, true, update.Platform).
+		Find(&alerts).Error
+	if err != nil {
+		logrus.Errorf("Failed to load price alerts for item %d: %v", update.ItemID, err)
+		return
+	}
+
+	for i := range alerts {
+		s.check(&alerts[i], update)
+	}
+}
+
+// check 条件从不满足变为满足时触发，条件恢复后才会再次触发
+func (s *Service) check(alert *models.PriceAlert, update market.PriceUpdate) {
+	cond := condition{
+		Operator:  alert.Operator,
+		Threshold: alert.Threshold,
+		Window:    time.Duration(alert.Window) * time.Second,
+	}
+
+	var reference float64
+	if cond.relative() {
+		reference = s.reference(alert.ItemID, update, cond)
+	}
+	met := cond.met(update.Price, reference)
+
+	fire := met && !alert.Active && !s.coolingDown(alert, update.Time)
+	updates := map[string]interface{}{
+		"active":     met,
+		"last_price": update.Price,
+	}
+	if fire {
+		updates["trigger_count"] = gorm.Expr("trigger_count + 1")
+		updates["last_triggered_at"] = update.Time
+		if !alert.Repeat {
+			updates["enabled"] = false
+		}
+	}
+	if err := s.db.Model(alert).Updates(updates).Error; err != nil {
+		logrus.Errorf("Failed to save price alert %d: %v", alert.ID, err)
+		return
+	}
+
+	if fire {
+		s.notify(alert, update, reference)
+	}
+}
+
+// reference 窗口内同一平台的最高价（drops）或最低价（rises），不同平台之间的价差不计入涨跌幅
+func (s *Service) reference(itemID uint, update market.PriceUpdate, cond condition) float64 {
+	agg := "MAX(price)"
+	if cond.Operator == "rises" {
+		agg = "MIN(price)"
+	}
+
+	var reference float64
+	s.db.Model(&models.PriceHistory{}).
+		Where("item_id = ? AND platform = ? AND recorded_at >= ? AND recorded_at < ?",
+			itemID, update.Platform, update.Time.Add(-cond.Window), update.Time).
+		Select("COALESCE(" + agg + ", 0)").
+		Scan(&reference)
+	return reference
+}
+
+func (s *Service) coolingDown(alert *models.PriceAlert, now time.Time) bool {
+	if alert.LastTriggeredAt == nil || alert.Cooldown <= 0 {
+		return false
+	}
+	return now.Sub(*alert.LastTriggeredAt) < time.Duration(alert.Cooldown)*time.Second
+}
+
+// notify 发布价格提醒通知
+func (s *Service) notify(alert *models.PriceAlert, update market.PriceUpdate, reference float64) {
+	event := Event{
+		Event:     "price_alert",
+		AlertID:   alert.ID,
+		ItemID:    alert.ItemID,
+		ItemName:  alert.Item.Name,
+		Platform:  update.Platform,
+		Condition: alert.Expression,
+		Price:     update.Price,
+		Reference: reference,
+		Time:      update.Time,
+	}
+	if reference > 0 {
+		event.ChangePercent = (update.Price - reference) / reference * 100
+	}
+	s.notifier.Publish(alert.UserID, notify.Message{
+		Event: webhooks.EventPriceAlert,
+		Title: "价格提醒：" + alert.Item.Name,
+		Body:  fmt.Sprintf("%s 在 %s 的价格为 %.2f，满足条件 %s", alert.Item.Name, update.Platform, update.Price, alert.Expression),
+		Data:  event,
+	})
+}
@@ -0,0 +1,97 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 涨跌幅窗口的上限，超过后价格历史已被降采样
+const maxWindow = 7 * 24 * time.Hour
+
+var errExpression = errors.New(`condition must look like "price < 100" or "drops 10% in 1h"`)
+
+// condition 解析后的提醒条件
+type condition struct {
+	Operator  string
+	Threshold float64
+	Window    time.Duration
+}
+
+// parseCondition 解析提醒条件，支持：
+//
+//	price < 100、price <= 100、price > 100、price >= 100
+//	drops 10% in 1h、rises 5% in 30m、drops 20% in 2d
+func parseCondition(expr string) (*condition, error) {
+	fields := strings.Fields(strings.ToLower(expr))
+	switch {
+	case len(fields) == 3 && fields[0] == "price":
+		op := fields[1]
+		if op != "<" && op != "<=" && op != ">" && op != ">=" {
+			return nil, errExpression
+		}
+		threshold, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || threshold <= 0 {
+			return nil, errors.New("price threshold must be a positive number")
+		}
+		return &condition{Operator: op, Threshold: threshold}, nil
+
+	case len(fields) == 4 && (fields[0] == "drops" || fields[0] == "rises") && fields[2] == "in":
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[1], "%"), 64)
+		if err != nil || percent <= 0 || (fields[0] == "drops" && percent >= 100) {
+			return nil, errors.New("percentage must be between 0 and 100")
+		}
+		window, err := parseWindow(fields[3])
+		if err != nil {
+			return nil, err
+		}
+		return &condition{Operator: fields[0], Threshold: percent, Window: window}, nil
+	}
+	return nil, errExpression
+}
+
+// parseWindow 在time.ParseDuration的基础上支持天（d）
+func parseWindow(v string) (time.Duration, error) {
+	var window time.Duration
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q", v)
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if window, err = time.ParseDuration(v); err != nil {
+			return 0, fmt.Errorf("invalid window %q", v)
+		}
+	}
+	if window < time.Minute || window > maxWindow {
+		return 0, errors.New("window must be between 1m and 7d")
+	}
+	return window, nil
+}
+
+// met 判断价格是否满足条件；涨跌幅条件的reference为窗口内的最高价（drops）或最低价（rises）
+func (c *condition) met(price, reference float64) bool {
+	switch c.Operator {
+	case "<":
+		return price < c.Threshold
+	case "<=":
+		return price <= c.Threshold
+	case ">":
+		return price > c.Threshold
+	case ">=":
+		return price >= c.Threshold
+	case "drops":
+		return reference > 0 && (reference-price)/reference*100 >= c.Threshold
+	case "rises":
+		return reference > 0 && (price-reference)/reference*100 >= c.Threshold
+	}
+	return false
+}
+
+func (c *condition) relative() bool {
+	return c.Operator == "drops" || c.Operator == "rises"
+}
@@ -0,0 +1,169 @@
+package analytics
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Contribution 某一维度下单个分组对组合收益的贡献
+type Contribution struct {
+	Key          string  `json:"key"`
+	Name         string  `json:"name"`
+	Realized     float64 `json:"realized"`   // 卖出已实现收益（已扣除卖出手续费）
+	Unrealized   float64 `json:"unrealized"` // 期末持仓相对期初（或买入价）的浮动盈亏
+	BuyFees      float64 `json:"buy_fees"`
+	Contribution float64 `json:"contribution"`
+	Share        float64 `json:"share"` // 占总收益的百分比
+}
+
+// AttributionReport 组合收益归因报告
+type AttributionReport struct {
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Total      Contribution   `json:"total"`
+	ByStrategy []Contribution `json:"by_strategy"`
+	ByCategory []Contribution `json:"by_category"`
+	ByPlatform []Contribution `json:"by_platform"`
+}
+
+// attributionRow 按 策略 x 类别 x 平台 聚合的最细粒度结果
+type attributionRow struct {
+	StrategyID   uint
+	StrategyName string
+	Category     string
+	Platform     string
+	Realized     float64
+	Unrealized   float64
+	BuyFees      float64
+}
+
+// 成交记录：卖出收益和买入手续费，通过订单关联策略和物品
+const realizedQuery = `
+	SELECT COALESCE(o.strategy_id, 0) AS strategy_id, COALESCE(st.name, '') AS strategy_name,
+	       COALESCE(NULLIF(i.type, ''), 'other') AS category, t.platform,
+	       COALESCE(SUM(t.profit) FILTER (WHERE t.type = 'sell'), 0) AS realized,
+	       COALESCE(SUM(t.fee) FILTER (WHERE t.type = 'buy'), 0) AS buy_fees
+	FROM transactions t
+	JOIN orders o ON o.id = t.order_id
+	JOIN items i ON i.id = o.item_id
+	LEFT JOIN strategies st ON st.id = o.strategy_id
+	WHERE t.user_id = ? AND t.completed_at >= ? AND t.completed_at < ? AND t.deleted_at IS NULL
+	GROUP BY 1, 2, 3, 4`
+
+// 持仓快照：期末价格相对期初价格（期内买入的按买入价）的变化。
+// 价格取区间端点之前最近的价格记录，没有记录时分别退回买入价和当前价
+const unrealizedQuery = `
+	SELECT COALESCE(inv.strategy_id, 0) AS strategy_id, COALESCE(st.name, '') AS strategy_name,
+	       COALESCE(NULLIF(i.type, ''), 'other') AS category, inv.platform,
+	       SUM(inv.quantity * (
+	           COALESCE((SELECT ph.price FROM price_histories ph
+	                     WHERE ph.item_id = inv.item_id AND ph.recorded_at < ? AND ph.deleted_at IS NULL
+	                     ORDER BY ph.recorded_at DESC LIMIT 1), i.current_price)
+	           - CASE WHEN inv.acquired_at < ? THEN
+	               COALESCE((SELECT ph.price FROM price_histories ph
+	                         WHERE ph.item_id = inv.item_id AND ph.recorded_at < ? AND ph.deleted_at IS NULL
+	                         ORDER BY ph.recorded_at DESC LIMIT 1), inv.buy_price)
+	             ELSE inv.buy_price END
+	       )) AS unrealized
+	FROM inventories inv
+	JOIN items i ON i.id = inv.item_id
+	LEFT JOIN strategies st ON st.id = inv.strategy_id
+	WHERE inv.user_id = ? AND inv.acquired_at < ? AND inv.deleted_at IS NULL
+	GROUP BY 1, 2, 3, 4`
+
+// Service 收益分析
+type Service struct {
+	db      *gorm.DB
+	sellFee FeeFunc
+}
+
+func NewService(db *gorm.DB, sellFee FeeFunc) *Service {
+	return &Service{db: db, sellFee: sellFee}
+}
+
+// GetAttribution 将区间内的组合收益分解到策略、物品类别和平台。
+// 已实现收益来自成交记录，浮动盈亏来自当前持仓在区间内的价格变化
+func (s *Service) GetAttribution(userID uint, from, to time.Time) (*AttributionReport, error) {
+	if !from.Before(to) {
+		return nil, errors.New("from must be before to")
+	}
+
+	var realized []attributionRow
+	if err := s.db.Raw(realizedQuery, userID, from, to).Scan(&realized).Error; err != nil {
+		return nil, err
+	}
+
+	var unrealized []attributionRow
+	if err := s.db.Raw(unrealizedQuery, to, from, from, userID, to).Scan(&unrealized).Error; err != nil {
+		return nil, err
+	}
+
+	report := &AttributionReport{From: from, To: to}
+	byStrategy := make(map[string]*Contribution)
+	byCategory := make(map[string]*Contribution)
+	byPlatform := make(map[string]*Contribution)
+
+	for _, row := range append(realized, unrealized...) {
+		strategyKey, strategyName := "manual", "手动交易"
+		if row.StrategyID != 0 {
+			strategyKey, strategyName = uintKey(row.StrategyID), row.StrategyName
+		}
+
+		for _, c := range []*Contribution{
+			&report.Total,
+			group(byStrategy, strategyKey, strategyName),
+			group(byCategory, row.Category, row.Category),
+			group(byPlatform, row.Platform, row.Platform),
+		} {
+			c.Realized += row.Realized
+			c.Unrealized += row.Unrealized
+			c.BuyFees += row.BuyFees
+		}
+	}
+
+	report.Total.Key, report.Total.Name = "total", "合计"
+	finish(&report.Total, report.Total.Realized+report.Total.Unrealized-report.Total.BuyFees)
+	total := report.Total.Contribution
+
+	report.ByStrategy = sorted(byStrategy, total)
+	report.ByCategory = sorted(byCategory, total)
+	report.ByPlatform = sorted(byPlatform, total)
+	return report, nil
+}
+
+func group(groups map[string]*Contribution, key, name string) *Contribution {
+	c, ok := groups[key]
+	if !ok {
+		c = &Contribution{Key: key, Name: name}
+		groups[key] = c
+	}
+	return c
+}
+
+func finish(c *Contribution, total float64) {
+	c.Contribution = c.Realized + c.Unrealized - c.BuyFees
+	if total != 0 {
+		c.Share = c.Contribution / total * 100
+	}
+}
+
+// sorted 计算占比并按贡献从大到小排序
+func sorted(groups map[string]*Contribution, total float64) []Contribution {
+	result := make([]Contribution, 0, len(groups))
+	for _, c := range groups {
+		finish(c, total)
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Contribution > result[j].Contribution
+	})
+	return result
+}
+
+func uintKey(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
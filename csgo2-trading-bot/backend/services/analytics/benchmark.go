@@ -0,0 +1,378 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// ErrUnknownIndex 不支持的市场指数
+var ErrUnknownIndex = errors.New("unknown market index")
+
+// marketIndex 等权市场指数：成分为满足条件的物品，每日收益为成分物品日均价涨跌幅的平均值
+type marketIndex struct {
+	name      string
+	condition string
+}
+
+// marketIndexes 可用于对比的市场指数
+var marketIndexes = map[string]marketIndex{
+	"overall":   {name: "全市场指数", condition: "TRUE"},
+	"knife":     {name: "刀具指数", condition: "i.type ILIKE '%knife%'"},
+	"gloves":    {name: "手套指数", condition: "i.type ILIKE '%gloves%'"},
+	"rifle":     {name: "步枪指数", condition: "i.type ILIKE '%rifle%'"},
+	"container": {name: "武器箱指数", condition: "i.type ILIKE '%container%' OR i.type ILIKE '%case%'"},
+}
+
+// 物品日均价，合并原始价格和降采样后的K线，保证长区间也有数据
+const dailyPricesQuery = `
+	SELECT p.item_id, date_trunc('day', p.at AT TIME ZONE 'UTC') AS day, AVG(p.price) AS price
+	FROM (
+		SELECT item_id, recorded_at AS at, price FROM price_histories
+		WHERE recorded_at >= ? AND recorded_at < ? AND deleted_at IS NULL AND price > 0
+		UNION ALL
+		SELECT item_id, bucket AS at, avg AS price FROM price_aggregates
+		WHERE bucket >= ? AND bucket < ? AND avg > 0
+	) p
+	JOIN items i ON i.id = p.item_id
+	WHERE (%s)
+	GROUP BY 1, 2`
+
+// 指数日收益：成分物品相对上一个有价格的交易日的涨跌幅取平均，剔除明显异常的价格跳变
+const indexReturnsQuery = `
+	WITH daily AS (` + dailyPricesQuery + `),
+	ratios AS (
+		SELECT day, price / LAG(price) OVER (PARTITION BY item_id ORDER BY day) AS ratio
+		FROM daily
+	)
+	SELECT day, AVG(ratio) - 1 AS ret
+	FROM ratios
+	WHERE ratio BETWEEN 0.2 AND 5
+	GROUP BY day
+	ORDER BY day`
+
+// SeriesPoint 净值曲线上的一点，Value以区间起点为100
+type SeriesPoint struct {
+	Date   time.Time `json:"date"`
+	Value  float64   `json:"value"`
+	Return float64   `json:"return"` // 当日收益率
+}
+
+// BenchmarkStats 组合相对指数的统计指标，收益类指标为百分比，年化按365天计算
+type BenchmarkStats struct {
+	PortfolioReturn  float64 `json:"portfolio_return"` // 区间累计收益率
+	IndexReturn      float64 `json:"index_return"`
+	ExcessReturn     float64 `json:"excess_return"`
+	Alpha            float64 `json:"alpha"` // 年化超额收益
+	Beta             float64 `json:"beta"`
+	Correlation      float64 `json:"correlation"`
+	TrackingError    float64 `json:"tracking_error"` // 年化
+	InformationRatio float64 `json:"information_ratio"`
+	Days             int     `json:"days"`
+}
+
+// Benchmark 单个指数的对比结果
+type Benchmark struct {
+	Index  string         `json:"index"`
+	Name   string         `json:"name"`
+	Series []SeriesPoint  `json:"series"`
+	Stats  BenchmarkStats `json:"stats"`
+}
+
+// BenchmarkReport 组合与市场指数的对比
+type BenchmarkReport struct {
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Portfolio  []SeriesPoint `json:"portfolio"`
+	Benchmarks []Benchmark   `json:"benchmarks"`
+}
+
+// MarketIndexNames 返回可选的指数及名称
+func MarketIndexNames() map[string]string {
+	names := make(map[string]string, len(marketIndexes))
+	for key, index := range marketIndexes {
+		names[key] = index.name
+	}
+	return names
+}
+
+// GetBenchmark 对比区间内用户组合的每日收益和所选市场指数，indexes为空时使用全市场指数
+func (s *Service) GetBenchmark(userID uint, indexes []string, from, to time.Time) (*BenchmarkReport, error) {
+	if !from.Before(to) {
+		return nil, errors.New("from must be before to")
+	}
+	if len(indexes) == 0 {
+		indexes = []string{"overall"}
+	}
+	for _, key := range indexes {
+		if _, ok := marketIndexes[key]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownIndex, key)
+		}
+	}
+
+	days := dayRange(from, to)
+	portfolioReturns, err := s.portfolioReturns(userID, days)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BenchmarkReport{
+		From:       from,
+		To:         to,
+		Portfolio:  toSeries(days, portfolioReturns),
+		Benchmarks: make([]Benchmark, 0, len(indexes)),
+	}
+	for _, key := range indexes {
+		indexReturns, err := s.indexReturns(marketIndexes[key], from, to)
+		if err != nil {
+			return nil, err
+		}
+		report.Benchmarks = append(report.Benchmarks, Benchmark{
+			Index:  key,
+			Name:   marketIndexes[key].name,
+			Series: toSeries(days, indexReturns),
+			Stats:  compareReturns(days, portfolioReturns, indexReturns),
+		})
+	}
+	return report, nil
+}
+
+// indexReturns 计算指数每日收益
+func (s *Service) indexReturns(index marketIndex, from, to time.Time) (map[time.Time]float64, error) {
+	var rows []struct {
+		Day time.Time
+		Ret float64
+	}
+	// 多取一天以便计算首日收益
+	start := from.AddDate(0, 0, -1)
+	query := fmt.Sprintf(indexReturnsQuery, index.condition)
+	if err := s.db.Raw(query, start, to, start, to).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	returns := make(map[time.Time]float64, len(rows))
+	for _, row := range rows {
+		returns[truncateDay(row.Day)] = row.Ret
+	}
+	return returns, nil
+}
+
+// portfolioReturns 计算组合每日收益：当日盈亏（持仓市值变化加已实现收益）除以前一日持仓成本
+func (s *Service) portfolioReturns(userID uint, days []time.Time) (map[time.Time]float64, error) {
+	from, to := days[0], days[len(days)-1].AddDate(0, 0, 1)
+
+	// 区间内任一时刻持有过的库存，已卖出的库存为软删除状态
+	var inventories []models.Inventory
+	err := s.db.Unscoped().
+		Where("user_id = ? AND acquired_at < ? AND (deleted_at IS NULL OR deleted_at >= ?)", userID, to, from.AddDate(0, 0, -1)).
+		Find(&inventories).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var realizedRows []struct {
+		Day    time.Time
+		Profit float64
+	}
+	err = s.db.Raw(`
+		SELECT date_trunc('day', completed_at AT TIME ZONE 'UTC') AS day, SUM(profit) AS profit
+		FROM transactions
+		WHERE user_id = ? AND type = 'sell' AND completed_at >= ? AND completed_at < ? AND deleted_at IS NULL
+		GROUP BY 1`, userID, from, to).Scan(&realizedRows).Error
+	if err != nil {
+		return nil, err
+	}
+	realized := make(map[time.Time]float64, len(realizedRows))
+	for _, row := range realizedRows {
+		realized[truncateDay(row.Day)] = row.Profit
+	}
+
+	prices, err := s.dailyPrices(inventories, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每日收盘时的持仓成本和浮动盈亏
+	type snapshot struct{ cost, unrealized float64 }
+	snapshotAt := func(day time.Time) snapshot {
+		end := day.AddDate(0, 0, 1)
+		var snap snapshot
+		for _, inv := range inventories {
+			if !inv.AcquiredAt.Before(end) || (inv.DeletedAt.Valid && inv.DeletedAt.Time.Before(end)) {
+				continue
+			}
+			price, ok := priceOn(prices[inv.ItemID], day)
+			if !ok {
+				price = inv.BuyPrice
+			}
+			snap.cost += float64(inv.Quantity) * inv.BuyPrice
+			snap.unrealized += float64(inv.Quantity) * (price - inv.BuyPrice)
+		}
+		return snap
+	}
+
+	returns := make(map[time.Time]float64, len(days))
+	prev := snapshotAt(from.AddDate(0, 0, -1))
+	for _, day := range days {
+		cur := snapshotAt(day)
+		pnl := cur.unrealized - prev.unrealized + realized[day]
+
+		base := prev.cost
+		if base <= 0 {
+			base = cur.cost
+		}
+		if base > 0 {
+			returns[day] = pnl / base
+		}
+		prev = cur
+	}
+	return returns, nil
+}
+
+// dailyPrices 获取库存涉及物品的日均价，按日期升序
+func (s *Service) dailyPrices(inventories []models.Inventory, from, to time.Time) (map[uint][]datedPrice, error) {
+	prices := make(map[uint][]datedPrice)
+	if len(inventories) == 0 {
+		return prices, nil
+	}
+
+	itemIDs := make([]uint, 0, len(inventories))
+	for _, inv := range inventories {
+		itemIDs = append(itemIDs, inv.ItemID)
+	}
+
+	// 往前多取一段时间，用于区间开始前最后一个价格
+	start := from.AddDate(0, 0, -30)
+	var rows []struct {
+		ItemID uint
+		Day    time.Time
+		Price  float64
+	}
+	query := fmt.Sprintf(dailyPricesQuery, "i.id IN ?") + " ORDER BY 2"
+	if err := s.db.Raw(query, start, to, start, to, itemIDs).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		prices[row.ItemID] = append(prices[row.ItemID], datedPrice{day: truncateDay(row.Day), price: row.Price})
+	}
+	return prices, nil
+}
+
+type datedPrice struct {
+	day   time.Time
+	price float64
+}
+
+// priceOn 取不晚于day的最近价格
+func priceOn(prices []datedPrice, day time.Time) (float64, bool) {
+	price, ok := 0.0, false
+	for _, p := range prices {
+		if p.day.After(day) {
+			break
+		}
+		price, ok = p.price, true
+	}
+	return price, ok
+}
+
+// compareReturns 用两条序列都有数据的交易日计算对比指标
+func compareReturns(days []time.Time, portfolio, index map[time.Time]float64) BenchmarkStats {
+	var p, b []float64
+	for _, day := range days {
+		pr, ok1 := portfolio[day]
+		br, ok2 := index[day]
+		if ok1 && ok2 {
+			p = append(p, pr)
+			b = append(b, br)
+		}
+	}
+
+	stats := BenchmarkStats{
+		PortfolioReturn: cumulative(days, portfolio),
+		IndexReturn:     cumulative(days, index),
+		Days:            len(p),
+	}
+	stats.ExcessReturn = stats.PortfolioReturn - stats.IndexReturn
+	if len(p) < 2 {
+		return stats
+	}
+
+	meanP, meanB := mean(p), mean(b)
+	var covPB, varP, varB, varDiff float64
+	diffs := make([]float64, len(p))
+	for i := range p {
+		dp, db := p[i]-meanP, b[i]-meanB
+		covPB += dp * db
+		varP += dp * dp
+		varB += db * db
+		diffs[i] = p[i] - b[i]
+	}
+	meanDiff := mean(diffs)
+	for _, d := range diffs {
+		varDiff += (d - meanDiff) * (d - meanDiff)
+	}
+	n := float64(len(p) - 1)
+	covPB, varP, varB, varDiff = covPB/n, varP/n, varB/n, varDiff/n
+
+	if varB > 0 {
+		stats.Beta = covPB / varB
+	}
+	stats.Alpha = (meanP - stats.Beta*meanB) * 365 * 100
+	if varP > 0 && varB > 0 {
+		stats.Correlation = covPB / math.Sqrt(varP*varB)
+	}
+	trackingError := math.Sqrt(varDiff * 365)
+	stats.TrackingError = trackingError * 100
+	if trackingError > 0 {
+		stats.InformationRatio = meanDiff * 365 / trackingError
+	}
+	return stats
+}
+
+// toSeries 将每日收益连乘为以100起点的净值，缺失的日期视为收益为0
+func toSeries(days []time.Time, returns map[time.Time]float64) []SeriesPoint {
+	series := make([]SeriesPoint, 0, len(days))
+	value := 100.0
+	for _, day := range days {
+		ret := returns[day]
+		value *= 1 + ret
+		series = append(series, SeriesPoint{Date: day, Value: value, Return: ret})
+	}
+	return series
+}
+
+func cumulative(days []time.Time, returns map[time.Time]float64) float64 {
+	value := 1.0
+	for _, day := range days {
+		value *= 1 + returns[day]
+	}
+	return (value - 1) * 100
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// dayRange 区间内的每一天（UTC零点）
+func dayRange(from, to time.Time) []time.Time {
+	var days []time.Time
+	for day := truncateDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,296 @@
+package analytics
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// ErrNoPosition 用户未持有要对冲的物品
+var ErrNoPosition = errors.New("no position in item")
+
+// 计算相关性至少需要的共同交易日
+const minHedgeDays = 10
+
+// FeeFunc 按平台计算卖出成交额对应的手续费
+type FeeFunc func(platform string, amount float64) float64
+
+// HedgeOptions 对冲建议参数
+type HedgeOptions struct {
+	ItemID         uint    // 要对冲的持仓，为0时对冲整个组合
+	Window         int     // 计算相关性的滚动窗口（天）
+	MinCorrelation float64 // 低于该相关系数的物品不作为对冲工具
+	Limit          int
+}
+
+// HedgeSuggestion 一条对冲建议：卖出一部分相关持仓以抵消风险敞口
+type HedgeSuggestion struct {
+	ItemID       uint    `json:"item_id"`
+	Name         string  `json:"name"`
+	Platform     string  `json:"platform"`
+	Price        float64 `json:"price"`
+	HeldQuantity int     `json:"held_quantity"`
+	Correlation  float64 `json:"correlation"` // 与敞口日收益的相关系数
+	HedgeRatio   float64 `json:"hedge_ratio"` // 最小方差对冲比率：每单位敞口市值应卖出的市值
+	SellQuantity int     `json:"sell_quantity"`
+	SellValue    float64 `json:"sell_value"`
+	Capped       bool    `json:"capped"` // 持仓不足，按全部持仓计算
+
+	EstimatedFee    float64 `json:"estimated_fee"`
+	RealizedProfit  float64 `json:"realized_profit"` // 按买入均价计算，卖出后实现的盈亏
+	VolatilityAfter float64 `json:"volatility_after"`
+	RiskReduction   float64 `json:"risk_reduction"` // 敞口波动率下降的百分比
+}
+
+// HedgeReport 对冲建议报告，波动率为年化的日盈亏标准差（本位币）
+type HedgeReport struct {
+	ItemID        uint              `json:"item_id,omitempty"`
+	Window        int               `json:"window"`
+	From          time.Time         `json:"from"`
+	To            time.Time         `json:"to"`
+	ExposureValue float64           `json:"exposure_value"`
+	Volatility    float64           `json:"volatility"`
+	Suggestions   []HedgeSuggestion `json:"suggestions"`
+}
+
+// holding 按物品合并的持仓
+type holding struct {
+	itemID   uint
+	name     string
+	platform string
+	quantity int
+	cost     float64
+	price    float64
+	returns  map[time.Time]float64
+}
+
+func (h *holding) value() float64 {
+	return float64(h.quantity) * h.price
+}
+
+// GetHedges 用滚动窗口内的日收益相关性，为持仓或整个组合建议卖出相关持仓的数量。
+// 对冲比率为 cov(敞口, 工具) / var(工具)，卖出后敞口的日盈亏方差最小
+func (s *Service) GetHedges(userID uint, opts HedgeOptions) (*HedgeReport, error) {
+	if opts.Window < minHedgeDays {
+		opts.Window = 30
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+
+	to := truncateDay(time.Now())
+	from := to.AddDate(0, 0, -opts.Window)
+	days := dayRange(from, to)
+
+	holdings, err := s.holdings(userID, days)
+	if err != nil {
+		return nil, err
+	}
+
+	// 敞口每日盈亏：单个持仓或全部持仓按当前市值加权
+	exposure := make(map[time.Time]float64, len(days))
+	var exposureValue float64
+	for _, h := range holdings {
+		if opts.ItemID != 0 && h.itemID != opts.ItemID {
+			continue
+		}
+		exposureValue += h.value()
+		for day, ret := range h.returns {
+			exposure[day] += h.value() * ret
+		}
+	}
+	if opts.ItemID != 0 && exposureValue == 0 {
+		return nil, ErrNoPosition
+	}
+
+	report := &HedgeReport{
+		ItemID:        opts.ItemID,
+		Window:        opts.Window,
+		From:          from,
+		To:            to,
+		ExposureValue: exposureValue,
+		Volatility:    annualize(stddev(valuesOn(days, exposure))),
+		Suggestions:   []HedgeSuggestion{},
+	}
+
+	for _, h := range holdings {
+		if h.itemID == opts.ItemID || h.quantity == 0 || h.price <= 0 {
+			continue
+		}
+		if suggestion, ok := s.hedgeWith(h, days, exposure, exposureValue, opts.MinCorrelation); ok {
+			report.Suggestions = append(report.Suggestions, suggestion)
+		}
+	}
+
+	sort.Slice(report.Suggestions, func(i, j int) bool {
+		return report.Suggestions[i].RiskReduction > report.Suggestions[j].RiskReduction
+	})
+	if len(report.Suggestions) > opts.Limit {
+		report.Suggestions = report.Suggestions[:opts.Limit]
+	}
+	return report, nil
+}
+
+// hedgeWith 计算卖出持仓h对敞口的对冲效果
+func (s *Service) hedgeWith(h *holding, days []time.Time, exposure map[time.Time]float64, exposureValue, minCorrelation float64) (HedgeSuggestion, bool) {
+	var e, r []float64
+	for _, day := range days {
+		ret, ok1 := h.returns[day]
+		pnl, ok2 := exposure[day]
+		if ok1 && ok2 {
+			e = append(e, pnl)
+			r = append(r, ret)
+		}
+	}
+	if len(r) < minHedgeDays || exposureValue <= 0 {
+		return HedgeSuggestion{}, false
+	}
+
+	cov, varE, varR := covariance(e, r)
+	if varE <= 0 || varR <= 0 {
+		return HedgeSuggestion{}, false
+	}
+	correlation := cov / math.Sqrt(varE*varR)
+	// 只有正相关的持仓卖出后才能降低风险
+	if correlation <= 0 || correlation < minCorrelation {
+		return HedgeSuggestion{}, false
+	}
+
+	// 最优卖出市值，不超过持仓市值，按整件取整
+	target := cov / varR
+	quantity := int(math.Min(target, h.value()) / h.price)
+	if quantity == 0 {
+		return HedgeSuggestion{}, false
+	}
+	sellValue := float64(quantity) * h.price
+
+	hedged := make([]float64, len(e))
+	for i := range e {
+		hedged[i] = e[i] - sellValue*r[i]
+	}
+	// 对冲前后都只用两者共同的交易日比较
+	before, after := annualize(stddev(e)), annualize(stddev(hedged))
+
+	suggestion := HedgeSuggestion{
+		ItemID:          h.itemID,
+		Name:            h.name,
+		Platform:        h.platform,
+		Price:           h.price,
+		HeldQuantity:    h.quantity,
+		Correlation:     correlation,
+		HedgeRatio:      target / exposureValue,
+		SellQuantity:    quantity,
+		SellValue:       sellValue,
+		Capped:          target > h.value(),
+		RealizedProfit:  sellValue - float64(quantity)*h.cost,
+		VolatilityAfter: after,
+	}
+	if s.sellFee != nil {
+		suggestion.EstimatedFee = s.sellFee(h.platform, sellValue)
+		suggestion.RealizedProfit -= suggestion.EstimatedFee
+	}
+	if before > 0 {
+		suggestion.RiskReduction = (1 - after/before) * 100
+	}
+	return suggestion, suggestion.RiskReduction > 0
+}
+
+// holdings 用户当前持仓及窗口内每日收益
+func (s *Service) holdings(userID uint, days []time.Time) ([]*holding, error) {
+	var inventories []models.Inventory
+	if err := s.db.Preload("Item").Where("user_id = ? AND quantity > 0", userID).Find(&inventories).Error; err != nil {
+		return nil, err
+	}
+
+	from, to := days[0], days[len(days)-1].AddDate(0, 0, 1)
+	prices, err := s.dailyPrices(inventories, from.AddDate(0, 0, -1), to)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[uint]*holding)
+	var result []*holding
+	for _, inv := range inventories {
+		h, ok := index[inv.ItemID]
+		if !ok {
+			h = &holding{
+				itemID:   inv.ItemID,
+				name:     inv.Item.Name,
+				platform: inv.Platform,
+				price:    inv.Item.CurrentPrice,
+				returns:  dailyReturns(days, prices[inv.ItemID]),
+			}
+			index[inv.ItemID] = h
+			result = append(result, h)
+		}
+		// cost暂存总成本，合并后换算为买入均价
+		h.cost += float64(inv.Quantity) * inv.BuyPrice
+		h.quantity += inv.Quantity
+	}
+	for _, h := range result {
+		if h.quantity > 0 {
+			h.cost /= float64(h.quantity)
+		}
+		if h.price <= 0 {
+			if p, ok := priceOn(prices[h.itemID], days[len(days)-1]); ok {
+				h.price = p
+			}
+		}
+	}
+	return result, nil
+}
+
+// dailyReturns 相邻两日都有价格时的日收益，剔除明显异常的价格跳变
+func dailyReturns(days []time.Time, prices []datedPrice) map[time.Time]float64 {
+	returns := make(map[time.Time]float64, len(days))
+	for _, day := range days {
+		prev, ok1 := priceOn(prices, day.AddDate(0, 0, -1))
+		cur, ok2 := priceOn(prices, day)
+		if !ok1 || !ok2 || prev <= 0 {
+			continue
+		}
+		if ratio := cur / prev; ratio >= 0.2 && ratio <= 5 {
+			returns[day] = ratio - 1
+		}
+	}
+	return returns
+}
+
+func valuesOn(days []time.Time, series map[time.Time]float64) []float64 {
+	values := make([]float64, 0, len(days))
+	for _, day := range days {
+		if v, ok := series[day]; ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// covariance 样本协方差及两组数据各自的样本方差
+func covariance(a, b []float64) (cov, varA, varB float64) {
+	if len(a) < 2 {
+		return 0, 0, 0
+	}
+	meanA, meanB := mean(a), mean(b)
+	for i := range a {
+		da, db := a[i]-meanA, b[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	n := float64(len(a) - 1)
+	return cov / n, varA / n, varB / n
+}
+
+func stddev(values []float64) float64 {
+	_, v, _ := covariance(values, values)
+	return math.Sqrt(v)
+}
+
+// annualize 日标准差按365天年化
+func annualize(daily float64) float64 {
+	return daily * math.Sqrt(365)
+}
@@ -0,0 +1,98 @@
+package analytics
+
+import (
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+)
+
+// valuationColumns 按物品当前价格给库存估值，没有价格的物品按买入价计算；已实现盈亏取自持仓汇总
+const valuationColumns = `
+	COALESCE(SUM(inv.quantity * COALESCE(NULLIF(items.current_price, 0), inv.buy_price)), 0) AS market_value,
+	COALESCE(SUM(inv.quantity * inv.buy_price), 0) AS cost_basis,
+	COALESCE(SUM(inv.quantity), 0) AS quantity`
+
+// PortfolioValue 组合市值走势：每日快照及按当前价格计算的最新估值
+type PortfolioValue struct {
+	Snapshots []models.PortfolioSnapshot `json:"snapshots"`
+	Current   models.PortfolioSnapshot   `json:"current"`
+}
+
+// SnapshotPortfolios 按spec定期保存全部用户的库存估值，retentionDays大于0时清理更早的快照
+func (s *Service) SnapshotPortfolios(sched *scheduler.Scheduler, spec string, retentionDays int) error {
+	return sched.Add(scheduler.Job{
+		ID:   "portfolio_snapshots",
+		Spec: spec,
+		Run: func() {
+			if err := s.snapshotPortfolios(time.Now()); err != nil {
+				logrus.Errorf("Failed to snapshot portfolios: %v", err)
+			}
+			if retentionDays > 0 {
+				s.db.Where("date < ?", time.Now().AddDate(0, 0, -retentionDays)).Delete(&models.PortfolioSnapshot{})
+			}
+		},
+	})
+}
+
+// snapshotPortfolios 保存每个有库存或有已实现盈亏的用户当日的估值，同一天重复执行时覆盖
+func (s *Service) snapshotPortfolios(now time.Time) error {
+	result := s.db.Exec(`
+		INSERT INTO portfolio_snapshots (created_at, user_id, date, market_value, cost_basis, unrealized_pnl, realized_pnl, quantity)
+		SELECT ?, users.id, ?, v.market_value, v.cost_basis, v.market_value - v.cost_basis, COALESCE(p.realized_pnl, 0), v.quantity
+		FROM users
+		JOIN LATERAL (
+			SELECT `+valuationColumns+`
+			FROM inventories inv
+			JOIN items ON items.id = inv.item_id
+			WHERE inv.user_id = users.id AND inv.deleted_at IS NULL
+		) v ON TRUE
+		LEFT JOIN (
+			SELECT user_id, SUM(realized_pnl) AS realized_pnl FROM positions GROUP BY user_id
+		) p ON p.user_id = users.id
+		WHERE users.deleted_at IS NULL AND (v.quantity > 0 OR COALESCE(p.realized_pnl, 0) <> 0)
+		ON CONFLICT (user_id, date) DO UPDATE SET
+			created_at = EXCLUDED.created_at,
+			market_value = EXCLUDED.market_value,
+			cost_basis = EXCLUDED.cost_basis,
+			unrealized_pnl = EXCLUDED.unrealized_pnl,
+			realized_pnl = EXCLUDED.realized_pnl,
+			quantity = EXCLUDED.quantity`,
+		now, now.Format("2006-01-02"))
+	if result.Error != nil {
+		return result.Error
+	}
+	logrus.Infof("Saved %d portfolio snapshots", result.RowsAffected)
+	return nil
+}
+
+// GetPortfolioValue 用户在[from, to)内的每日估值快照，以及按当前价格计算的最新估值
+func (s *Service) GetPortfolioValue(userID uint, from, to time.Time) (*PortfolioValue, error) {
+	value := &PortfolioValue{Snapshots: []models.PortfolioSnapshot{}}
+	if err := s.db.Where("user_id = ? AND date >= ? AND date < ?", userID, from.Format("2006-01-02"), to).
+		Order("date").
+		Find(&value.Snapshots).Error; err != nil {
+		return nil, err
+	}
+
+	current := &value.Current
+	if err := s.db.Table("inventories inv").
+		Joins("JOIN items ON items.id = inv.item_id").
+		Where("inv.user_id = ? AND inv.deleted_at IS NULL", userID).
+		Select(valuationColumns).
+		Scan(current).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&models.Position{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(realized_pnl), 0)").
+		Scan(&current.RealizedPnL).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	current.UserID, current.Date, current.CreatedAt = userID, now, now
+	current.UnrealizedPnL = current.MarketValue - current.CostBasis
+	return value, nil
+}
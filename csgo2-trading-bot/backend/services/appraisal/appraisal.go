@@ -0,0 +1,228 @@
+package appraisal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultTTL = 7 * 24 * time.Hour
+	maxTTL     = 30 * 24 * time.Hour
+	tokenScope = "appraisal"
+)
+
+var (
+	// ErrNotFound 分享不存在、不属于当前用户、已撤销或已过期
+	ErrNotFound = errors.New("appraisal not found")
+	// ErrInvalidToken 链接签名无效
+	ErrInvalidToken = errors.New("invalid appraisal link")
+)
+
+// Item 估值快照中的单个物品，价格为创建分享时的市场价
+type Item struct {
+	ItemID         uint     `json:"item_id"`
+	MarketHashName string   `json:"market_hash_name"`
+	Name           string   `json:"name"`
+	IconURL        string   `json:"icon_url,omitempty"`
+	Rarity         string   `json:"rarity,omitempty"`
+	Exterior       string   `json:"exterior,omitempty"`
+	FloatValue     *float64 `json:"float_value,omitempty"`
+	Quantity       int      `json:"quantity"`
+	Price          float64  `json:"price"`
+	Value          float64  `json:"value"`
+}
+
+// Appraisal 公开访问时返回的估值快照，不包含用户身份和买入成本
+type Appraisal struct {
+	Title      string    `json:"title"`
+	Currency   string    `json:"currency"`
+	TotalValue float64   `json:"total_value"`
+	ItemCount  int       `json:"item_count"`
+	Items      []Item    `json:"items"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Share 分享记录及其访问令牌
+type Share struct {
+	models.AppraisalShare
+	Token string `json:"token,omitempty"`
+}
+
+type claims struct {
+	Scope string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// Service 库存估值分享链接
+type Service struct {
+	db       *gorm.DB
+	key      []byte
+	currency string
+}
+
+// NewService secret与登录令牌共用，派生出单独的签名密钥，避免分享令牌被当作登录令牌使用
+func NewService(db *gorm.DB, secret string, currency string) *Service {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(tokenScope))
+	return &Service{
+		db:       db,
+		key:      mac.Sum(nil),
+		currency: currency,
+	}
+}
+
+// Create 生成用户当前库存的估值快照并返回分享令牌
+func (s *Service) Create(userID uint, title string, ttl time.Duration) (*Share, error) {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	if ttl > maxTTL {
+		return nil, errors.New("ttl must not exceed 30 days")
+	}
+
+	var inventory []models.Inventory
+	if err := s.db.Preload("Item").Where("user_id = ?", userID).Order("item_id").Find(&inventory).Error; err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0, len(inventory))
+	share := models.AppraisalShare{
+		UserID:    userID,
+		Title:     strings.TrimSpace(title),
+		Currency:  s.currency,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	for _, inv := range inventory {
+		item := Item{
+			ItemID:         inv.ItemID,
+			MarketHashName: inv.Item.MarketHashName,
+			Name:           inv.Item.Name,
+			IconURL:        inv.Item.IconURL,
+			Rarity:         inv.Item.Rarity,
+			Exterior:       inv.Item.Exterior,
+			FloatValue:     inv.FloatValue,
+			Quantity:       inv.Quantity,
+			Price:          inv.Item.CurrentPrice,
+			Value:          inv.Item.CurrentPrice * float64(inv.Quantity),
+		}
+		items = append(items, item)
+		share.TotalValue += item.Value
+		share.ItemCount += item.Quantity
+	}
+	if share.Title == "" {
+		share.Title = "库存估值"
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	share.Items = string(data)
+	if err := s.db.Create(&share).Error; err != nil {
+		return nil, err
+	}
+
+	token, err := s.sign(&share)
+	if err != nil {
+		return nil, err
+	}
+	return &Share{AppraisalShare: share, Token: token}, nil
+}
+
+// List 用户创建的分享，未撤销且未过期的附带令牌
+func (s *Service) List(userID uint) ([]Share, error) {
+	var rows []models.AppraisalShare
+	if err := s.db.Where("user_id = ?", userID).Order("id DESC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	shares := make([]Share, 0, len(rows))
+	now := time.Now()
+	for _, row := range rows {
+		share := Share{AppraisalShare: row}
+		if row.RevokedAt == nil && row.ExpiresAt.After(now) {
+			share.Token, _ = s.sign(&row)
+		}
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// Revoke 撤销分享，链接立即失效
+func (s *Service) Revoke(shareID, userID uint) error {
+	result := s.db.Model(&models.AppraisalShare{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", shareID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Get 校验令牌并返回估值快照
+func (s *Service) Get(token string) (*Appraisal, error) {
+	parsed, err := jwt.ParseWithClaims(token, &claims{}, func(t *jwt.Token) (interface{}, error) {
+		return s.key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrNotFound
+		}
+		return nil, ErrInvalidToken
+	}
+	c, ok := parsed.Claims.(*claims)
+	if !ok || c.Scope != tokenScope {
+		return nil, ErrInvalidToken
+	}
+	shareID, err := strconv.ParseUint(c.Subject, 10, 32)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var share models.AppraisalShare
+	err = s.db.Where("id = ? AND revoked_at IS NULL AND expires_at > ?", shareID, time.Now()).First(&share).Error
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	s.db.Model(&share).UpdateColumn("views", gorm.Expr("views + 1"))
+
+	appraisal := &Appraisal{
+		Title:      share.Title,
+		Currency:   share.Currency,
+		TotalValue: share.TotalValue,
+		ItemCount:  share.ItemCount,
+		Items:      []Item{},
+		CreatedAt:  share.CreatedAt,
+		ExpiresAt:  share.ExpiresAt,
+	}
+	if err := json.Unmarshal([]byte(share.Items), &appraisal.Items); err != nil {
+		return nil, err
+	}
+	return appraisal, nil
+}
+
+// sign 令牌只包含分享ID和过期时间，相同分享每次签出的令牌一致
+func (s *Service) sign(share *models.AppraisalShare) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		Scope: tokenScope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(share.ID), 10),
+			ExpiresAt: jwt.NewNumericDate(share.ExpiresAt),
+		},
+	})
+	return token.SignedString(s.key)
+}
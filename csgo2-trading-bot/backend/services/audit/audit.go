@@ -0,0 +1,67 @@
+package audit
+
+import (
+	"encoding/json"
+
+	"csgo2-trading-bot/models"
+
+	"gorm.io/gorm"
+)
+
+// Entry 一条审计记录。Before/After为操作前后的实体状态，
+// 凭据类实体只记录是否配置等非敏感字段
+type Entry struct {
+	ActorID    *uint // 为空表示系统操作
+	UserID     *uint // 被操作的账户
+	Action     string
+	EntityType string
+	EntityID   uint
+	Details    interface{}
+	Before     interface{}
+	After      interface{}
+	IP         string
+}
+
+// Record 写入一条审计日志，actorID为空表示系统操作。
+// 传入事务句柄时审计日志与业务修改一起提交。
+func Record(db *gorm.DB, actorID *uint, action, entityType string, entityID uint, details interface{}) error {
+	return Log(db, Entry{
+		ActorID:    actorID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Details:    details,
+	})
+}
+
+// Log 写入一条审计日志，传入事务句柄时与业务修改一起提交
+func Log(db *gorm.DB, entry Entry) error {
+	details := "{}"
+	if entry.Details != nil {
+		b, err := json.Marshal(entry.Details)
+		if err != nil {
+			return err
+		}
+		details = string(b)
+	}
+	before, err := json.Marshal(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := json.Marshal(entry.After)
+	if err != nil {
+		return err
+	}
+
+	return db.Create(&models.AuditLog{
+		ActorID:    entry.ActorID,
+		UserID:     entry.UserID,
+		Action:     entry.Action,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Details:    details,
+		Before:     string(before),
+		After:      string(after),
+		IP:         entry.IP,
+	}).Error
+}
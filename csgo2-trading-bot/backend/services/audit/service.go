@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Service 审计日志的写入和查询。审计日志只追加，数据库触发器拒绝修改和删除
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Filter 审计日志查询条件，UserID为空表示不限账户（仅管理员）
+type Filter struct {
+	UserID     *uint
+	ActorID    *uint
+	Action     string // 支持前缀匹配，如 order. 匹配所有订单操作
+	EntityType string
+	EntityID   uint
+	From       time.Time
+	To         time.Time
+	Page       int
+	PageSize   int
+}
+
+// Log 写入审计日志，失败时只记录错误，不影响已完成的操作
+func (s *Service) Log(entry Entry) {
+	if err := Log(s.db, entry); err != nil {
+		logrus.Errorf("Failed to write audit log %s %s#%d: %v", entry.Action, entry.EntityType, entry.EntityID, err)
+	}
+}
+
+// List 按条件查询审计日志，按时间倒序
+func (s *Service) List(filter Filter) ([]models.AuditLog, int64, error) {
+	query := s.db.Model(&models.AuditLog{})
+	if filter.UserID != nil {
+		// 账户所有者能看到针对自己账户的操作，以及自己发起的操作
+		query = query.Where("user_id = ? OR actor_id = ?", *filter.UserID, *filter.UserID)
+	}
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		if filter.Action[len(filter.Action)-1] == '.' {
+			query = query.Where("action LIKE ?", filter.Action+"%")
+		} else {
+			query = query.Where("action = ?", filter.Action)
+		}
+	}
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID > 0 {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 || filter.PageSize > 200 {
+		filter.PageSize = 50
+	}
+
+	var logs []models.AuditLog
+	err := query.Order("created_at DESC, id DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&logs).Error
+	return logs, total, err
+}
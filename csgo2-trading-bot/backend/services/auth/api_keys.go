@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// API Key权限
+const (
+	ScopeReadMarket       = "read:market"       // 行情数据
+	ScopeTradeExecute     = "trade:execute"     // 库存、下单和撤单
+	ScopeManageStrategies = "manage:strategies" // 策略的创建、修改和启停
+)
+
+// Scopes 全部可授予的权限
+var Scopes = []string{ScopeReadMarket, ScopeTradeExecute, ScopeManageStrategies}
+
+// APIKeyPrefix API Key的固定前缀，用于和JWT区分
+const APIKeyPrefix = "csk_"
+
+const (
+	maxAPIKeys = 20
+	// 最近使用时间的写入间隔，避免每个请求都更新数据库
+	lastUsedInterval = time.Minute
+)
+
+var (
+	// ErrAPIKeyNotFound API Key不存在或不属于该用户
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrInvalidAPIKey API Key无效、已吊销或已过期
+	ErrInvalidAPIKey = errors.New("invalid or revoked api key")
+)
+
+// APIKeyRequest 创建API Key
+type APIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatedAPIKey 新建的API Key，Key为明文，只在创建时返回
+type CreatedAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKey 为用户创建API Key
+func (s *Service) CreateAPIKey(userID uint, req APIKeyRequest) (*CreatedAPIKey, error) {
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("expires_at must be in the future")
+	}
+
+	var count int64
+	s.db.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&count)
+	if count >= maxAPIKeys {
+		return nil, fmt.Errorf("at most %d api keys are allowed", maxAPIKeys)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	key := APIKeyPrefix + hex.EncodeToString(buf)
+
+	record := models.APIKey{
+		UserID:    userID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    key[:len(APIKeyPrefix)+8],
+		Hash:      hashAPIKey(key),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+	return &CreatedAPIKey{APIKey: record, Key: key}, nil
+}
+
+// ListAPIKeys 用户的全部API Key，包括已吊销的
+func (s *Service) ListAPIKeys(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey 吊销API Key，立即失效
+func (s *Service) RevokeAPIKey(userID, keyID uint) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := s.db.Where("id = ? AND user_id = ?", keyID, userID).First(&key).Error; err != nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	if key.RevokedAt != nil {
+		return &key, nil
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&key).Update("revoked_at", now).Error; err != nil {
+		return nil, err
+	}
+	key.RevokedAt = &now
+	return &key, nil
+}
+
+// ValidateAPIKey 校验API Key并记录最近使用时间和IP
+func (s *Service) ValidateAPIKey(key, ip string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var record models.APIKey
+	if err := s.db.Where("hash = ?", hashAPIKey(key)).First(&record).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if record.RevokedAt != nil || (record.ExpiresAt != nil && !record.ExpiresAt.After(now)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= lastUsedInterval || record.LastUsedIP != ip {
+		s.db.Model(&record).Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip})
+		record.LastUsedAt = &now
+		record.LastUsedIP = ip
+	}
+	return &record, nil
+}
+
+// HasScope API Key是否拥有该权限
+func HasScope(key *models.APIKey, scope string) bool {
+	for _, s := range strings.Split(key.Scopes, ",") {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeScopes 校验并去重，按固定顺序排列
+func normalizeScopes(scopes []string) ([]string, error) {
+	valid := make(map[string]bool, len(Scopes))
+	for _, scope := range Scopes {
+		valid[scope] = true
+	}
+
+	seen := make(map[string]bool)
+	var result []string
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !valid[scope] {
+			return nil, fmt.Errorf("unknown scope: %s", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// hashAPIKey API Key是高熵随机值，直接用SHA-256保存即可抵御泄露后的还原
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 会话最近活跃时间的写入间隔，避免每个请求都更新数据库
+const sessionSeenInterval = time.Minute
+
+const sessionSeenKeyPrefix = "auth:seen:"
+
+// ErrSessionNotFound 会话不存在、已过期或不属于该用户
+var ErrSessionNotFound = errors.New("session not found")
+
+// ListSessions 用户当前有效的会话，currentSessionID对应的会话标记为当前会话
+func (s *Service) ListSessions(userID uint, currentSessionID string) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].SessionID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// RevokeSession 吊销用户的单个会话，该会话的访问令牌和刷新令牌立即失效
+func (s *Service) RevokeSession(ctx context.Context, userID, id uint) (*models.UserSession, error) {
+	var session models.UserSession
+	err := s.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", id, userID, time.Now()).
+		First(&session).Error
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	if err := s.revokeSession(ctx, session.SessionID); err != nil {
+		return nil, err
+	}
+	if err := s.markSessionsRevoked(s.db.Where("id = ?", session.ID)); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// RevokeOtherSessions 吊销除当前会话以外的全部会话，返回吊销数量
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID uint, currentSessionID string) (int, error) {
+	sessions, err := s.ListSessions(userID, currentSessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.Current {
+			continue
+		}
+		if _, err := s.RevokeSession(ctx, userID, session.ID); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+// TouchSession 记录会话最近活跃的时间和IP，同一会话每分钟最多写入一次
+func (s *Service) TouchSession(ctx context.Context, claims *JWTClaims, ip string) {
+	if claims.SessionID == "" {
+		return
+	}
+	first, err := s.redis.SetNX(ctx, sessionSeenKeyPrefix+claims.SessionID, 1, sessionSeenInterval).Result()
+	if err != nil || !first {
+		return
+	}
+	s.touchSession(claims.SessionID, ip)
+}
+
+func (s *Service) touchSession(sessionID, ip string) {
+	err := s.db.Model(&models.UserSession{}).
+		Where("session_id = ?", sessionID).
+		Updates(map[string]interface{}{"last_seen_at": time.Now(), "ip": ip}).Error
+	if err != nil {
+		logrus.Warnf("Failed to update session activity: %v", err)
+	}
+}
+
+// markSessionsRevoked 标记query匹配的会话为已吊销
+func (s *Service) markSessionsRevoked(query *gorm.DB) error {
+	return query.Model(&models.UserSession{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+}
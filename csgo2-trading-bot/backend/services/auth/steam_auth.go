@@ -3,29 +3,35 @@ package auth
 import (
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/base32"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 
 	"csgo2-trading-bot/config"
 	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/webhooks"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type Service struct {
 	db          *gorm.DB
-	redis       *redis.Client
+	redis       redis.UniversalClient
 	steamConfig config.SteamConfig
+	http        *http.Client
+	notifier    *notify.Router
 }
 
 type SteamUser struct {
@@ -36,16 +42,19 @@ type SteamUser struct {
 }
 
 type JWTClaims struct {
-	UserID  uint   `json:"user_id"`
-	SteamID string `json:"steam_id"`
+	UserID    uint   `json:"user_id"`
+	SteamID   string `json:"steam_id"`
+	SessionID string `json:"sid,omitempty"` // 所属登录会话，吊销会话时一并失效
 	jwt.RegisteredClaims
 }
 
-func NewService(db *gorm.DB, redis *redis.Client, cfg config.SteamConfig) *Service {
+func NewService(db *gorm.DB, redis redis.UniversalClient, cfg config.SteamConfig, httpClient *http.Client, notifier *notify.Router) *Service {
 	return &Service{
 		db:          db,
 		redis:       redis,
 		steamConfig: cfg,
+		http:        httpClient,
+		notifier:    notifier,
 	}
 }
 
@@ -106,6 +115,52 @@ func (s *Service) VerifySteamLogin(query url.Values) (*models.User, error) {
 	return &user, nil
 }
 
+// RecordLogin 记录登录设备，用户已有其他设备而本次设备从未出现过时发出新设备登录事件
+func (s *Service) RecordLogin(userID uint, userAgent, ip string) {
+	if err := s.recordLogin(userID, userAgent, ip); err != nil {
+		logrus.Warnf("Failed to record login device for user %d: %v", userID, err)
+	}
+}
+
+func (s *Service) recordLogin(userID uint, userAgent, ip string) error {
+	sum := sha256.Sum256([]byte(userAgent))
+	fingerprint := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	var device models.LoginDevice
+	err := s.db.Where("user_id = ? AND fingerprint = ?", userID, fingerprint).First(&device).Error
+	if err == nil {
+		return s.db.Model(&device).Updates(map[string]interface{}{"ip": ip, "last_seen_at": now}).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	var known int64
+	s.db.Model(&models.LoginDevice{}).Where("user_id = ?", userID).Count(&known)
+
+	device = models.LoginDevice{
+		UserID:      userID,
+		Fingerprint: fingerprint,
+		UserAgent:   userAgent,
+		IP:          ip,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+	if err := s.db.Create(&device).Error; err != nil {
+		return err
+	}
+
+	if known > 0 {
+		s.notifier.Publish(userID, notify.Message{Event: webhooks.EventLoginNewDevice, Data: map[string]interface{}{
+			"user_agent": userAgent,
+			"ip":         ip,
+			"time":       now,
+		}})
+	}
+	return nil
+}
+
 // validateOpenIDResponse 验证OpenID响应
 func (s *Service) validateOpenIDResponse(query url.Values) (string, error) {
 	// 构建验证请求
@@ -122,7 +177,7 @@ func (s *Service) validateOpenIDResponse(query url.Values) (string, error) {
 	}
 
 	// 发送验证请求到Steam
-	resp, err := http.PostForm("https://steamcommunity.com/openid/login", params)
+	resp, err := s.http.PostForm("https://steamcommunity.com/openid/login", params)
 	if err != nil {
 		return "", err
 	}
@@ -153,7 +208,7 @@ func (s *Service) getSteamUserInfo(steamID string) (*SteamUser, error) {
 	url := fmt.Sprintf("http://api.steampowered.com/ISteamUser/GetPlayerSummaries/v0002/?key=%s&steamids=%s",
 		s.steamConfig.APIKey, steamID)
 
-	resp, err := http.Get(url)
+	resp, err := s.http.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -176,21 +231,6 @@ func (s *Service) getSteamUserInfo(steamID string) (*SteamUser, error) {
 	return &result.Response.Players[0], nil
 }
 
-// GenerateJWT 生成JWT令牌
-func (s *Service) GenerateJWT(user *models.User) (string, error) {
-	claims := JWTClaims{
-		UserID:  user.ID,
-		SteamID: user.SteamID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.steamConfig.SharedSecret))
-}
-
 // ValidateJWT 验证JWT令牌
 func (s *Service) ValidateJWT(tokenString string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
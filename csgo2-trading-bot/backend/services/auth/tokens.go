@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// RefreshTokenPrefix 刷新令牌的固定前缀
+const RefreshTokenPrefix = "csr_"
+
+// 令牌相关的Redis键
+const (
+	refreshKeyPrefix       = "auth:refresh:"        // 未使用的刷新令牌
+	refreshUsedKeyPrefix   = "auth:refresh_used:"   // 已轮换的刷新令牌，再次出现说明令牌被盗用
+	sessionKeyPrefix       = "auth:session:"        // 一次登录产生的会话，刷新令牌轮换时沿用
+	revokedSessionPrefix   = "auth:revoked:"        // 已吊销会话，该会话签发的访问令牌一并失效
+	deniedTokenPrefix      = "auth:deny:"           // 已吊销的单个访问令牌
+	revokedBeforeKeyPrefix = "auth:revoked_before:" // 用户在该时间之前签发的令牌全部失效
+)
+
+var (
+	// ErrInvalidRefreshToken 刷新令牌无效、已过期或所属会话已吊销
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused 已轮换的刷新令牌被再次使用，整个会话已吊销
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+	// ErrTokenRevoked 访问令牌已被吊销
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// TokenPair 登录或刷新后下发的令牌
+type TokenPair struct {
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	RefreshToken string    `json:"refresh_token"`
+}
+
+// refreshRecord 刷新令牌在Redis中保存的内容
+type refreshRecord struct {
+	UserID    uint   `json:"user_id"`
+	SessionID string `json:"session_id"`
+}
+
+// session 会话在Redis中保存的内容
+type session struct {
+	UserID    uint      `json:"user_id"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+func (s *Service) accessTTL() time.Duration {
+	return time.Duration(s.steamConfig.AccessTokenTTL) * time.Second
+}
+
+func (s *Service) refreshTTL() time.Duration {
+	return time.Duration(s.steamConfig.RefreshTokenTTL) * time.Second
+}
+
+// IssueTokens 登录成功后创建会话并签发访问令牌和刷新令牌
+func (s *Service) IssueTokens(ctx context.Context, user *models.User, userAgent, ip string) (*TokenPair, error) {
+	sessionID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	raw, err := json.Marshal(session{UserID: user.ID, StartedAt: now})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.redis.Set(ctx, sessionKeyPrefix+sessionID, raw, s.refreshTTL()).Err(); err != nil {
+		return nil, err
+	}
+
+	record := models.UserSession{
+		UserID:     user.ID,
+		SessionID:  sessionID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.refreshTTL()),
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+	return s.issuePair(ctx, user, sessionID)
+}
+
+// RefreshTokens 用刷新令牌换取新的令牌，旧刷新令牌随即作废；已作废的令牌再次出现时吊销整个会话
+func (s *Service) RefreshTokens(ctx context.Context, refreshToken, ip string) (*TokenPair, error) {
+	hash := hashAPIKey(refreshToken)
+
+	value, err := s.redis.GetDel(ctx, refreshKeyPrefix+hash).Result()
+	if errors.Is(err, redis.Nil) {
+		sessionID, err := s.redis.Get(ctx, refreshUsedKeyPrefix+hash).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.revokeSession(ctx, sessionID); err != nil {
+			return nil, err
+		}
+		s.markSessionsRevoked(s.db.Where("session_id = ?", sessionID))
+		logrus.Warnf("Refresh token reuse detected, revoked session %s", sessionID)
+		return nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record refreshRecord
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err := s.redis.Set(ctx, refreshUsedKeyPrefix+hash, record.SessionID, s.refreshTTL()).Err(); err != nil {
+		return nil, err
+	}
+
+	active, err := s.sessionActive(ctx, record.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.GetUserByID(record.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	s.touchSession(record.SessionID, ip)
+	return s.issuePair(ctx, user, record.SessionID)
+}
+
+// Logout 吊销当前访问令牌所属的会话
+func (s *Service) Logout(ctx context.Context, claims *JWTClaims) error {
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		if ttl := time.Until(claims.ExpiresAt.Time); ttl > 0 {
+			if err := s.redis.Set(ctx, deniedTokenPrefix+claims.ID, 1, ttl).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	if claims.SessionID == "" {
+		return nil
+	}
+	if err := s.revokeSession(ctx, claims.SessionID); err != nil {
+		return err
+	}
+	return s.markSessionsRevoked(s.db.Where("session_id = ?", claims.SessionID))
+}
+
+// RevokeAllTokens 吊销用户此前签发的全部访问令牌和刷新令牌
+func (s *Service) RevokeAllTokens(ctx context.Context, userID uint) error {
+	ttl := s.refreshTTL()
+	if access := s.accessTTL(); access > ttl {
+		ttl = access
+	}
+	if err := s.redis.Set(ctx, revokedBeforeKeyPrefix+strconv.FormatUint(uint64(userID), 10), time.Now().Unix(), ttl).Err(); err != nil {
+		return err
+	}
+	return s.markSessionsRevoked(s.db.Where("user_id = ?", userID))
+}
+
+// CheckRevoked 访问令牌本身、所属会话或用户的全部令牌是否已被吊销
+func (s *Service) CheckRevoked(ctx context.Context, claims *JWTClaims) error {
+	keys := []string{revokedBeforeKeyPrefix + strconv.FormatUint(uint64(claims.UserID), 10)}
+	if claims.ID != "" {
+		keys = append(keys, deniedTokenPrefix+claims.ID)
+	}
+	if claims.SessionID != "" {
+		keys = append(keys, revokedSessionPrefix+claims.SessionID)
+	}
+
+	values, err := s.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return err
+	}
+	if cutoff, ok := values[0].(string); ok && claims.IssuedAt != nil {
+		if unix, err := strconv.ParseInt(cutoff, 10, 64); err == nil && claims.IssuedAt.Unix() <= unix {
+			return ErrTokenRevoked
+		}
+	}
+	for _, value := range values[1:] {
+		if value != nil {
+			return ErrTokenRevoked
+		}
+	}
+	return nil
+}
+
+// issuePair 为会话签发新的访问令牌和刷新令牌
+func (s *Service) issuePair(ctx context.Context, user *models.User, sessionID string) (*TokenPair, error) {
+	token, expiresAt, err := s.generateAccessToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken := RefreshTokenPrefix + secret
+	raw, err := json.Marshal(refreshRecord{UserID: user.ID, SessionID: sessionID})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.redis.Set(ctx, refreshKeyPrefix+hashAPIKey(refreshToken), raw, s.refreshTTL()).Err(); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{Token: token, ExpiresAt: expiresAt, RefreshToken: refreshToken}, nil
+}
+
+// generateAccessToken 签发短期访问令牌，jti用于单独吊销，sid关联所属会话
+func (s *Service) generateAccessToken(user *models.User, sessionID string) (string, time.Time, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(s.accessTTL())
+	claims := JWTClaims{
+		UserID:    user.ID,
+		SteamID:   user.SteamID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(s.steamConfig.SharedSecret))
+	return signed, expiresAt, err
+}
+
+// sessionActive 会话是否仍有效：未过期、未吊销，且不早于用户的全部吊销时间
+func (s *Service) sessionActive(ctx context.Context, sessionID string) (bool, error) {
+	value, err := s.redis.Get(ctx, sessionKeyPrefix+sessionID).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var sess session
+	if err := json.Unmarshal([]byte(value), &sess); err != nil {
+		return false, nil
+	}
+
+	cutoff, err := s.redis.Get(ctx, revokedBeforeKeyPrefix+strconv.FormatUint(uint64(sess.UserID), 10)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return sess.StartedAt.Unix() > cutoff, nil
+}
+
+// revokeSession 删除会话，该会话签发的访问令牌在其有效期内都会被拒绝
+func (s *Service) revokeSession(ctx context.Context, sessionID string) error {
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, sessionKeyPrefix+sessionID)
+	pipe.Set(ctx, revokedSessionPrefix+sessionID, 1, s.accessTTL())
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
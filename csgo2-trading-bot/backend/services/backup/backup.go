@@ -0,0 +1,155 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+const filePrefix = "backup_"
+
+// Service 数据库备份：pg_dump导出、上传S3、按保留策略清理
+type Service struct {
+	db     config.DatabaseConfig
+	config config.BackupConfig
+}
+
+func NewService(db config.DatabaseConfig, cfg config.BackupConfig) *Service {
+	return &Service{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// Run 执行一次备份，返回本地备份文件路径
+func (s *Service) Run(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(s.config.Dir, 0o750); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%s%s.dump", filePrefix, time.Now().Format("20060102_150405"))
+	path := filepath.Join(s.config.Dir, name)
+
+	// 自定义格式在单个事务快照内导出，保证一致性，并支持pg_restore选择性恢复
+	cmd := exec.CommandContext(ctx, "pg_dump",
+		"--format=custom",
+		"--no-owner",
+		"--host", s.db.Host,
+		"--port", fmt.Sprint(s.db.Port),
+		"--username", s.db.User,
+		"--dbname", s.db.DBName,
+		"--file", path,
+	)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+s.db.Password)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("pg_dump failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	if s.config.S3.Enabled {
+		if err := s.upload(ctx, path); err != nil {
+			return path, err
+		}
+	}
+
+	logrus.Infof("Backup created: %s", path)
+	return path, nil
+}
+
+// Restore 从备份文件恢复数据库，file可以是本地路径或s3://地址
+func (s *Service) Restore(ctx context.Context, file string) error {
+	if strings.HasPrefix(file, "s3://") {
+		local := filepath.Join(s.config.Dir, filepath.Base(file))
+		if err := awsCLI(ctx, "s3", "cp", file, local); err != nil {
+			return err
+		}
+		file = local
+	}
+
+	cmd := exec.CommandContext(ctx, "pg_restore",
+		"--clean",
+		"--if-exists",
+		"--no-owner",
+		"--single-transaction",
+		"--host", s.db.Host,
+		"--port", fmt.Sprint(s.db.Port),
+		"--username", s.db.User,
+		"--dbname", s.db.DBName,
+		file,
+	)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+s.db.Password)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("pg_restore failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	logrus.Infof("Database restored from %s", file)
+	return nil
+}
+
+// Prune 删除超过保留期限的本地备份，至少保留最近的KeepMin个
+func (s *Service) Prune() ([]string, error) {
+	files, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -s.config.RetentionDays)
+	var removed []string
+	for i, f := range files {
+		if i < s.config.KeepMin {
+			continue
+		}
+
+		info, err := os.Stat(f)
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			return removed, err
+		}
+		removed = append(removed, f)
+	}
+
+	if len(removed) > 0 {
+		logrus.Infof("Pruned %d expired backups", len(removed))
+	}
+	return removed, nil
+}
+
+// List 列出本地备份文件（最新的在前）
+func (s *Service) List() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.config.Dir, filePrefix+"*.dump"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+	return files, nil
+}
+
+func (s *Service) upload(ctx context.Context, path string) error {
+	dest := fmt.Sprintf("s3://%s/%s", s.config.S3.Bucket, strings.TrimPrefix(filepath.Join(s.config.S3.Prefix, filepath.Base(path)), "/"))
+	if err := awsCLI(ctx, "s3", "cp", path, dest); err != nil {
+		return err
+	}
+
+	logrus.Infof("Backup uploaded to %s", dest)
+	return nil
+}
+
+// awsCLI 通过aws命令行上传下载，S3生命周期规则负责远端保留策略
+func awsCLI(ctx context.Context, args ...string) error {
+	out, err := exec.CommandContext(ctx, "aws", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("aws %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database"
+	"csgo2-trading-bot/database/dbtest"
+	"csgo2-trading-bot/models"
+
+	"gorm.io/gorm"
+)
+
+// TestRestoreRoundTrip 导出迁移并写入数据的库，恢复到空库后比较每个表的行数、校验和以及序列值。
+// 需要TEST_DATABASE_URL（账号有CREATEDB权限）以及PATH中的pg_dump、pg_restore
+func TestRestoreRoundTrip(t *testing.T) {
+	requireTools(t)
+	ctx := context.Background()
+
+	srcCfg := dbtest.CreateDatabase(t)
+	src := dbtest.Connect(t, srcCfg)
+	if err := database.Migrate(src); err != nil {
+		t.Fatalf("migrate source: %v", err)
+	}
+	seed(t, src)
+	want := dbtest.TakeSnapshot(t, src)
+
+	backupCfg := config.BackupConfig{Dir: t.TempDir(), KeepMin: 1}
+	path, err := NewService(srcCfg, backupCfg).Run(ctx)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	dstCfg := dbtest.CreateDatabase(t)
+	if err := NewService(dstCfg, backupCfg).Restore(ctx, path); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	dst := dbtest.Connect(t, dstCfg)
+	assertSnapshot(t, want, dbtest.TakeSnapshot(t, dst))
+
+	// 触发器不在校验和范围内，单独确认审计日志仍然只能追加
+	if err := dst.Exec("UPDATE audit_logs SET action = 'tampered'").Error; err == nil {
+		t.Error("audit_logs accepted an UPDATE after restore, immutability trigger is missing")
+	}
+
+	// --clean恢复到已有数据的库时，以备份为准覆盖
+	if err := dst.Create(&models.Item{MarketHashName: "Restored Later"}).Error; err != nil {
+		t.Fatalf("insert after restore: %v", err)
+	}
+	if err := NewService(dstCfg, backupCfg).Restore(ctx, path); err != nil {
+		t.Fatalf("Restore over existing data: %v", err)
+	}
+	assertSnapshot(t, want, dbtest.TakeSnapshot(t, dst))
+}
+
+func requireTools(t *testing.T) {
+	t.Helper()
+	for _, tool := range []string{"pg_dump", "pg_restore"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found in PATH, skipping restore test", tool)
+		}
+	}
+}
+
+// seed 写入覆盖常见列类型的数据：jsonb、可空外键、软删除行、非ASCII文本
+func seed(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	users := []models.User{
+		{SteamID: "76561198000000001", Username: "alice", LastLogin: at},
+		{SteamID: "76561198000000002", Username: "鲍勃", LastLogin: at, IsAdmin: true},
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatalf("seed users: %v", err)
+	}
+
+	items := make([]models.Item, 20)
+	for i := range items {
+		items[i] = models.Item{
+			MarketHashName: fmt.Sprintf("AK-47 | Redline #%d (Field-Tested)", i),
+			Name:           "AK-47 | Redline",
+			Exterior:       "Field-Tested",
+			CurrentPrice:   10 + float64(i)*0.37,
+			Volume24h:      i * 11,
+			LastUpdated:    at,
+		}
+	}
+	if err := db.Create(&items).Error; err != nil {
+		t.Fatalf("seed items: %v", err)
+	}
+	if err := db.Delete(&items[len(items)-1]).Error; err != nil {
+		t.Fatalf("soft delete item: %v", err)
+	}
+
+	var history []models.PriceHistory
+	for i, item := range items {
+		for h := 0; h < 25; h++ {
+			history = append(history, models.PriceHistory{
+				ItemID:     item.ID,
+				Price:      item.CurrentPrice + float64(h%5)*0.01,
+				Volume:     i + h,
+				Platform:   []string{"steam", "buff", "bitskins"}[h%3],
+				RecordedAt: at.Add(-time.Duration(h) * time.Hour),
+				IngestedAt: at,
+			})
+		}
+	}
+	if err := db.CreateInBatches(&history, 200).Error; err != nil {
+		t.Fatalf("seed price histories: %v", err)
+	}
+
+	routing := `{"platform": "bitskins", "reason": "lowest total cost"}`
+	orders := []models.Order{
+		{UserID: users[0].ID, ItemID: items[0].ID, Type: "buy", Status: "completed", Price: 10, Quantity: 1, FilledQuantity: 1, Platform: "bitskins", Routing: &routing},
+		{UserID: users[1].ID, ItemID: items[1].ID, Type: "sell", Status: "pending", Price: 12.5, Quantity: 2, Platform: "steam"},
+	}
+	if err := db.Create(&orders).Error; err != nil {
+		t.Fatalf("seed orders: %v", err)
+	}
+	if err := db.Create(&models.Transaction{
+		UserID: users[0].ID, OrderID: orders[0].ID, Type: "buy", Quantity: 1,
+		Amount: 10, Fee: 0.1, Platform: "bitskins", TradeID: "bs-1", CompletedAt: at,
+	}).Error; err != nil {
+		t.Fatalf("seed transactions: %v", err)
+	}
+
+	if err := db.Create(&models.AuditLog{
+		CreatedAt: at, ActorID: &users[1].ID, UserID: &users[0].ID, Action: "order.create",
+		EntityType: "order", EntityID: orders[0].ID, Details: `{"note": "备份测试"}`, Before: "null", After: `{"status": "pending"}`,
+	}).Error; err != nil {
+		t.Fatalf("seed audit logs: %v", err)
+	}
+}
+
+func assertSnapshot(t *testing.T, want, got dbtest.Snapshot) {
+	t.Helper()
+	if reflect.DeepEqual(want, got) {
+		return
+	}
+	for table, sum := range want.Tables {
+		if got.Tables[table] != sum {
+			t.Errorf("table %s: restored %+v, want %+v", table, got.Tables[table], sum)
+		}
+	}
+	for table := range got.Tables {
+		if _, ok := want.Tables[table]; !ok {
+			t.Errorf("table %s exists only in the restored database", table)
+		}
+	}
+	for seq, value := range want.Sequences {
+		if got.Sequences[seq] != value {
+			t.Errorf("sequence %s: restored %d, want %d", seq, got.Sequences[seq], value)
+		}
+	}
+	if len(got.Sequences) != len(want.Sequences) {
+		t.Errorf("restored %d sequences, want %d", len(got.Sequences), len(want.Sequences))
+	}
+}
@@ -0,0 +1,186 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/notify"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrRunning 已有导入任务在执行
+var ErrRunning = errors.New("catalog import already in progress")
+
+// 目录字段为空时保留已有值，避免信息较少的数据源覆盖掉已有的收藏品等字段
+var keepExisting = clause.Assignments(map[string]interface{}{
+	"name":       gorm.Expr("COALESCE(NULLIF(EXCLUDED.name, ''), items.name)"),
+	"type":       gorm.Expr("COALESCE(NULLIF(EXCLUDED.type, ''), items.type)"),
+	"rarity":     gorm.Expr("COALESCE(NULLIF(EXCLUDED.rarity, ''), items.rarity)"),
+	"exterior":   gorm.Expr("COALESCE(NULLIF(EXCLUDED.exterior, ''), items.exterior)"),
+	"collection": gorm.Expr("COALESCE(NULLIF(EXCLUDED.collection, ''), items.collection)"),
+	"icon_url":   gorm.Expr("COALESCE(NULLIF(EXCLUDED.icon_url, ''), items.icon_url)"),
+	"updated_at": gorm.Expr("EXCLUDED.updated_at"),
+})
+
+// Service 从Steam批量导入CS2物品目录，同一时间只允许一个任务执行；平台报价中出现的新物品走快速通道
+type Service struct {
+	db       *gorm.DB
+	source   Source
+	notifier *notify.Router
+	config   config.CatalogConfig
+	running  atomic.Bool
+}
+
+func NewService(db *gorm.DB, source Source, notifier *notify.Router, cfg config.CatalogConfig) *Service {
+	return &Service{
+		db:       db,
+		source:   source,
+		notifier: notifier,
+		config:   cfg,
+	}
+}
+
+// Run 同步执行一次导入，供定时任务调用
+func (s *Service) Run(trigger string) (*models.CatalogImport, error) {
+	run, err := s.begin(trigger)
+	if err != nil {
+		return nil, err
+	}
+	s.execute(run)
+	return run, nil
+}
+
+// Start 异步执行一次导入，立即返回执行记录以便查询进度
+func (s *Service) Start(trigger string) (*models.CatalogImport, error) {
+	run, err := s.begin(trigger)
+	if err != nil {
+		return nil, err
+	}
+	go s.execute(run)
+	return run, nil
+}
+
+// Running 是否有导入任务在执行
+func (s *Service) Running() bool {
+	return s.running.Load()
+}
+
+// ListRuns 获取最近的导入记录
+func (s *Service) ListRuns(limit int) ([]models.CatalogImport, error) {
+	var runs []models.CatalogImport
+	err := s.db.Order("id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// GetRun 获取单次导入记录
+func (s *Service) GetRun(id uint) (*models.CatalogImport, error) {
+	var run models.CatalogImport
+	if err := s.db.First(&run, id).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (s *Service) begin(trigger string) (*models.CatalogImport, error) {
+	if !s.running.CompareAndSwap(false, true) {
+		return nil, ErrRunning
+	}
+
+	run := &models.CatalogImport{
+		Trigger:   trigger,
+		Source:    s.source.Name(),
+		Status:    "running",
+		StartedAt: time.Now(),
+	}
+	if err := s.db.Create(run).Error; err != nil {
+		s.running.Store(false)
+		return nil, err
+	}
+	return run, nil
+}
+
+func (s *Service) execute(run *models.CatalogImport) {
+	defer s.running.Store(false)
+
+	// 全量目录有上万件物品，Steam接口需要慢速翻页
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
+	defer cancel()
+
+	err := s.source.Fetch(ctx, func(entries []Entry) error {
+		if err := s.upsert(run, entries); err != nil {
+			return err
+		}
+		return s.db.Save(run).Error
+	})
+
+	now := time.Now()
+	run.FinishedAt = &now
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+		logrus.Errorf("Catalog import %d failed after %d items: %v", run.ID, run.Fetched, err)
+	} else {
+		run.Status = "completed"
+		logrus.Infof("Catalog import %d completed: %d fetched, %d created, %d updated", run.ID, run.Fetched, run.Created, run.Updated)
+	}
+	s.db.Save(run)
+}
+
+// upsert 按market_hash_name写入一批物品，只更新目录字段，价格由采集器维护
+func (s *Service) upsert(run *models.CatalogImport, entries []Entry) error {
+	run.Fetched += len(entries)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(entries))
+	items := make([]models.Item, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if seen[e.MarketHashName] {
+			continue
+		}
+		seen[e.MarketHashName] = true
+		names = append(names, e.MarketHashName)
+
+		quality := e.Exterior
+		if quality == "" {
+			quality = "Not Applicable"
+		}
+		items = append(items, models.Item{
+			MarketHashName: e.MarketHashName,
+			Name:           e.Name,
+			Type:           e.Type,
+			Rarity:         e.Rarity,
+			Quality:        quality,
+			Exterior:       e.Exterior,
+			Collection:     e.Collection,
+			IconURL:        e.IconURL,
+			LastUpdated:    time.Now(),
+		})
+	}
+
+	var existing int64
+	if err := s.db.Model(&models.Item{}).Unscoped().Where("market_hash_name IN ?", names).Count(&existing).Error; err != nil {
+		return err
+	}
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "market_hash_name"}},
+		DoUpdates: keepExisting,
+	}).Create(&items).Error
+	if err != nil {
+		return err
+	}
+
+	run.Created += len(items) - int(existing)
+	run.Updated += int(existing)
+	return nil
+}
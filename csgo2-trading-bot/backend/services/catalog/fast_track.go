@@ -0,0 +1,175 @@
+package catalog
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/notify"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 采集层级，采集器按层级决定采集频率
+const (
+	TierFastTrack = 1 // 新上架物品，每分钟采集
+	TierDefault   = 3
+)
+
+// ErrNoSubscription 用户没有订阅新物品通知
+var ErrNoSubscription = errors.New("new item subscription not found")
+
+// FastTrack 平台报价中出现目录未收录的物品时立即建档，放入最高采集层级并通知订阅用户。
+// 只写入名称和磨损，其余字段由采集器和下一次全量导入补全
+func (s *Service) FastTrack(platform string, names []string) []models.Item {
+	if !s.config.FastTrack || len(names) == 0 {
+		return nil
+	}
+	if limit := s.config.FastTrackLimit; limit > 0 && len(names) > limit {
+		logrus.Warnf("%d unknown items in %s prices, fast-tracking the first %d", len(names), platform, limit)
+		names = names[:limit]
+	}
+
+	now := time.Now()
+	until := now.Add(time.Duration(s.config.FastTrackHours) * time.Hour)
+	var created []models.Item
+	for _, name := range names {
+		exterior := exteriorOf(name)
+		quality := exterior
+		if quality == "" {
+			quality = "Not Applicable"
+		}
+		item := models.Item{
+			MarketHashName: name,
+			Name:           name,
+			Quality:        quality,
+			Exterior:       exterior,
+			LastUpdated:    now,
+			CollectionTier: TierFastTrack,
+			FastTrackUntil: &until,
+		}
+
+		// 并发同步的另一个平台可能已经建档，冲突时跳过
+		result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&item)
+		if result.Error != nil {
+			logrus.Errorf("Failed to fast-track %s: %v", name, result.Error)
+			continue
+		}
+		if result.RowsAffected > 0 {
+			created = append(created, item)
+		}
+	}
+	if len(created) == 0 {
+		return nil
+	}
+
+	logrus.Infof("Fast-tracked %d new items from %s", len(created), platform)
+	s.notifyNewItems(platform, created)
+	return created
+}
+
+// DemoteFastTrack 快速通道到期的物品回到默认采集层级
+func (s *Service) DemoteFastTrack() {
+	result := s.db.Model(&models.Item{}).
+		Where("collection_tier = ? AND fast_track_until < ?", TierFastTrack, time.Now()).
+		Updates(map[string]interface{}{"collection_tier": TierDefault, "fast_track_until": nil})
+	if result.Error != nil {
+		logrus.Errorf("Failed to demote fast-tracked items: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		logrus.Infof("Demoted %d fast-tracked items", result.RowsAffected)
+	}
+}
+
+// GetFastTrackedItems 处于快速通道中的物品，按建档时间倒序
+func (s *Service) GetFastTrackedItems() ([]models.Item, error) {
+	var items []models.Item
+	err := s.db.Where("collection_tier = ?", TierFastTrack).Order("created_at DESC").Find(&items).Error
+	return items, err
+}
+
+// notifyNewItems 按订阅关键词给每个用户发一条汇总通知
+func (s *Service) notifyNewItems(platform string, items []models.Item) {
+	var subs []models.NewItemSubscription
+	if err := s.db.Find(&subs).Error; err != nil {
+		logrus.Errorf("Failed to load new item subscriptions: %v", err)
+		return
+	}
+
+	for _, sub := range subs {
+		var matched []map[string]interface{}
+		for _, item := range items {
+			if matchKeywords(sub.Keywords, item.MarketHashName) {
+				matched = append(matched, map[string]interface{}{
+					"item_id":          item.ID,
+					"market_hash_name": item.MarketHashName,
+				})
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		s.notifier.Publish(sub.UserID, notify.Message{Event: notify.EventNewItem, Data: map[string]interface{}{
+			"platform": platform,
+			"items":    matched,
+			"time":     time.Now(),
+		}})
+	}
+}
+
+// GetNewItemSubscription 获取用户的新物品通知订阅
+func (s *Service) GetNewItemSubscription(userID uint) (*models.NewItemSubscription, error) {
+	var sub models.NewItemSubscription
+	if err := s.db.Where("user_id = ?", userID).First(&sub).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoSubscription
+		}
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// SaveNewItemSubscription 创建或修改新物品通知订阅
+func (s *Service) SaveNewItemSubscription(userID uint, keywords []string) (*models.NewItemSubscription, error) {
+	cleaned := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			cleaned = append(cleaned, keyword)
+		}
+	}
+
+	sub := models.NewItemSubscription{UserID: userID}
+	s.db.Where("user_id = ?", userID).First(&sub)
+	sub.Keywords = strings.Join(cleaned, ",")
+	if err := s.db.Save(&sub).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// DeleteNewItemSubscription 取消新物品通知订阅
+func (s *Service) DeleteNewItemSubscription(userID uint) error {
+	result := s.db.Where("user_id = ?", userID).Delete(&models.NewItemSubscription{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNoSubscription
+	}
+	return nil
+}
+
+func matchKeywords(keywords, name string) bool {
+	if keywords == "" {
+		return true
+	}
+	name = strings.ToLower(name)
+	for _, keyword := range strings.Split(keywords, ",") {
+		if strings.Contains(name, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,294 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/services/httpclient"
+)
+
+// steamImageURL Steam经济系统图片地址前缀，市场接口只返回图片哈希
+const steamImageURL = "https://community.akamai.steamstatic.com/economy/image/"
+
+// Entry 数据源中的一个物品
+type Entry struct {
+	MarketHashName string
+	Name           string
+	Type           string
+	Rarity         string
+	Exterior       string
+	Collection     string
+	IconURL        string
+}
+
+// Source 物品目录数据源，分批回调以免一次性占用过多内存
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context, emit func([]Entry) error) error
+}
+
+// NewSource 按配置创建数据源
+func NewSource(cfg config.CatalogConfig, httpClient *http.Client, budget *httpclient.Budget) (Source, error) {
+	switch cfg.Source {
+	case "", "steam_market":
+		return &SteamMarketSource{
+			URL:      cfg.URL,
+			PageSize: cfg.PageSize,
+			HTTP:     httpClient,
+			Budget:   budget,
+		}, nil
+	case "schema":
+		return &SchemaSource{URL: cfg.URL, HTTP: httpClient}, nil
+	default:
+		return nil, fmt.Errorf("unknown catalog source: %s", cfg.Source)
+	}
+}
+
+// SteamMarketSource 分页遍历Steam市场搜索接口中CS2的全部物品
+type SteamMarketSource struct {
+	URL      string
+	PageSize int
+	HTTP     *http.Client
+	Budget   *httpclient.Budget // 翻页按Steam请求预算以后台优先级排队，为nil时不限制
+}
+
+type steamSearchResponse struct {
+	Success    bool `json:"success"`
+	TotalCount int  `json:"total_count"`
+	Results    []struct {
+		Name             string `json:"name"`
+		HashName         string `json:"hash_name"`
+		AssetDescription struct {
+			Type    string `json:"type"`
+			IconURL string `json:"icon_url"`
+		} `json:"asset_description"`
+	} `json:"results"`
+}
+
+func (s *SteamMarketSource) Name() string {
+	return "steam_market"
+}
+
+func (s *SteamMarketSource) Fetch(ctx context.Context, emit func([]Entry) error) error {
+	pageSize := s.PageSize
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 100
+	}
+
+	for start, total := 0, -1; total < 0 || start < total; start += pageSize {
+		page, err := s.fetchPage(ctx, start, pageSize)
+		if err != nil {
+			return fmt.Errorf("steam market page %d: %w", start/pageSize, err)
+		}
+		total = page.TotalCount
+		if len(page.Results) == 0 {
+			break
+		}
+
+		entries := make([]Entry, 0, len(page.Results))
+		for _, r := range page.Results {
+			if r.HashName == "" {
+				continue
+			}
+			rarity, kind := parseSteamType(r.AssetDescription.Type)
+			entry := Entry{
+				MarketHashName: r.HashName,
+				Name:           r.Name,
+				Type:           kind,
+				Rarity:         rarity,
+				Exterior:       exteriorOf(r.HashName),
+			}
+			if r.AssetDescription.IconURL != "" {
+				entry.IconURL = steamImageURL + r.AssetDescription.IconURL
+			}
+			entries = append(entries, entry)
+		}
+		if err := emit(entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchPage 请求一页数据，被限流时退避重试
+func (s *SteamMarketSource) fetchPage(ctx context.Context, start, count int) (*steamSearchResponse, error) {
+	params := url.Values{}
+	params.Set("appid", "730")
+	params.Set("norender", "1")
+	params.Set("search_descriptions", "0")
+	params.Set("sort_column", "name")
+	params.Set("sort_dir", "asc")
+	params.Set("start", strconv.Itoa(start))
+	params.Set("count", strconv.Itoa(count))
+	endpoint := s.URL + "?" + params.Encode()
+
+	backoff := 30 * time.Second
+	for attempt := 0; ; attempt++ {
+		ctx, err := s.Budget.Reserve(ctx, httpclient.PriorityBackground)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := s.HTTP.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			resp.Body.Close()
+			if err := sleep(ctx, backoff); err != nil {
+				return nil, err
+			}
+			backoff *= 2
+			continue
+		}
+
+		var page steamSearchResponse
+		err = decode(resp, &page)
+		if err != nil {
+			return nil, err
+		}
+		if !page.Success {
+			return nil, fmt.Errorf("steam market search failed")
+		}
+		return &page, nil
+	}
+}
+
+// SchemaSource 由游戏items_game导出的物品JSON数组，包含收藏品等市场接口没有的信息
+type SchemaSource struct {
+	URL  string
+	HTTP *http.Client
+}
+
+type schemaName struct {
+	Name string `json:"name"`
+}
+
+type schemaItem struct {
+	MarketHashName string       `json:"market_hash_name"`
+	Name           string       `json:"name"`
+	Category       schemaName   `json:"category"`
+	Rarity         schemaName   `json:"rarity"`
+	Wear           schemaName   `json:"wear"`
+	Collections    []schemaName `json:"collections"`
+	Image          string       `json:"image"`
+}
+
+func (s *SchemaSource) Name() string {
+	return "schema"
+}
+
+func (s *SchemaSource) Fetch(ctx context.Context, emit func([]Entry) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+
+	var items []schemaItem
+	if err := decode(resp, &items); err != nil {
+		return err
+	}
+
+	const batch = 500
+	for i := 0; i < len(items); i += batch {
+		end := i + batch
+		if end > len(items) {
+			end = len(items)
+		}
+
+		entries := make([]Entry, 0, end-i)
+		for _, item := range items[i:end] {
+			if item.MarketHashName == "" {
+				continue
+			}
+			entry := Entry{
+				MarketHashName: item.MarketHashName,
+				Name:           item.Name,
+				Type:           item.Category.Name,
+				Rarity:         item.Rarity.Name,
+				Exterior:       item.Wear.Name,
+				IconURL:        item.Image,
+			}
+			if len(item.Collections) > 0 {
+				entry.Collection = item.Collections[0].Name
+			}
+			entries = append(entries, entry)
+		}
+		if err := emit(entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 市场类型描述中可能出现的稀有度
+var rarities = []string{
+	"Consumer Grade", "Industrial Grade", "Mil-Spec Grade", "Base Grade", "High Grade",
+	"Restricted", "Classified", "Covert", "Contraband",
+	"Remarkable", "Exotic", "Extraordinary",
+	"Distinguished", "Exceptional", "Superior", "Master",
+}
+
+var exteriors = []string{"Factory New", "Minimal Wear", "Field-Tested", "Well-Worn", "Battle-Scarred"}
+
+// parseSteamType 从市场类型描述中拆出稀有度和类别，如"★ StatTrak™ Covert Knife"
+func parseSteamType(t string) (rarity, kind string) {
+	rest := strings.TrimSpace(t)
+	for _, prefix := range []string{"★", "StatTrak™", "Souvenir"} {
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, prefix))
+	}
+
+	for _, r := range rarities {
+		if strings.HasPrefix(rest, r+" ") {
+			return r, strings.TrimPrefix(rest, r+" ")
+		}
+	}
+	return "", rest
+}
+
+// exteriorOf 从物品名称末尾的括号中取出磨损
+func exteriorOf(marketHashName string) string {
+	for _, e := range exteriors {
+		if strings.HasSuffix(marketHashName, "("+e+")") {
+			return e
+		}
+	}
+	return ""
+}
+
+func decode(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,44 @@
+// Package clock 可替换的时间来源。服务默认使用系统时间，场景测试用Fake在压缩的时间线上推进
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 当前时间
+type Clock interface {
+	Now() time.Time
+}
+
+// System 系统时间
+type System struct{}
+
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// Fake 手动推进的时间，可并发使用
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake 创建停在now的时间
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance 向前推进d
+func (f *Fake) Advance(d time.Duration) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	return f.now
+}
@@ -0,0 +1,141 @@
+package depth
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"gorm.io/gorm"
+)
+
+// 超过该时长的快照不再作为策略信号
+const maxSignalAge = time.Hour
+
+var (
+	// ErrNoSnapshot 物品没有买卖盘快照
+	ErrNoSnapshot = errors.New("no order book snapshot")
+	// ErrStaleSnapshot 最新快照太旧，不能作为信号
+	ErrStaleSnapshot = errors.New("order book snapshot is stale")
+)
+
+// Level 一档价格及该价格上的挂单数量
+type Level struct {
+	Price    float64 `json:"p"`
+	Quantity int     `json:"q"`
+}
+
+// Book 一次快照的买卖盘，Bids按价格降序，Asks按价格升序
+type Book struct {
+	Bids []Level `json:"b"`
+	Asks []Level `json:"a"`
+}
+
+// AskWall 最低卖价上方一定范围内的卖单，Thin表示卖压很薄，少量买入即可推高价格
+type AskWall struct {
+	ItemID     uint      `json:"item_id"`
+	CapturedAt time.Time `json:"captured_at"`
+	BestAsk    float64   `json:"best_ask"`
+	Ceiling    float64   `json:"ceiling"`  // 统计范围的上限价格
+	Quantity   int       `json:"quantity"` // 范围内的卖单数量
+	Cost       float64   `json:"cost"`     // 买光范围内卖单的金额
+	NextAsk    float64   `json:"next_ask"` // 范围之上的第一档卖价，0表示没有
+	Thin       bool      `json:"thin"`
+}
+
+// encode 压缩存储买卖盘
+func (b *Book) encode() ([]byte, error) {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeBook 解压快照中的买卖盘
+func decodeBook(data []byte) (*Book, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	var book Book
+	if err := json.Unmarshal(raw, &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// AskWall 统计最低卖价上方pct（如0.05表示5%）范围内的卖单
+func (b *Book) AskWall(pct float64) AskWall {
+	var wall AskWall
+	if len(b.Asks) == 0 {
+		return wall
+	}
+	wall.BestAsk = b.Asks[0].Price
+	wall.Ceiling = wall.BestAsk * (1 + pct)
+	for _, level := range b.Asks {
+		if level.Price > wall.Ceiling {
+			wall.NextAsk = level.Price
+			break
+		}
+		wall.Quantity += level.Quantity
+		wall.Cost += level.Price * float64(level.Quantity)
+	}
+	return wall
+}
+
+// Snapshot 物品在平台上at时刻之前的最后一次快照，at为零值时取最新的快照
+func Snapshot(db *gorm.DB, itemID uint, platform string, at time.Time) (*models.OrderBookSnapshot, *Book, error) {
+	query := db.Where("item_id = ? AND platform = ?", itemID, platform)
+	if !at.IsZero() {
+		query = query.Where("captured_at <= ?", at)
+	}
+
+	var snapshot models.OrderBookSnapshot
+	if err := query.Order("captured_at DESC").First(&snapshot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrNoSnapshot
+		}
+		return nil, nil, err
+	}
+	book, err := decodeBook(snapshot.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &snapshot, book, nil
+}
+
+// ThinAskWall 按最新快照检测薄卖墙：最低卖价上方pct范围内的卖单不超过maxQty
+func ThinAskWall(db *gorm.DB, itemID uint, platform string, pct float64, maxQty int) (*AskWall, error) {
+	snapshot, book, err := Snapshot(db, itemID, platform, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(snapshot.CapturedAt) > maxSignalAge {
+		return nil, ErrStaleSnapshot
+	}
+
+	wall := book.AskWall(pct)
+	wall.ItemID = itemID
+	wall.CapturedAt = snapshot.CapturedAt
+	wall.Thin = wall.BestAsk > 0 && wall.Quantity <= maxQty
+	return &wall, nil
+}
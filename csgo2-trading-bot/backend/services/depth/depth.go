@@ -0,0 +1,290 @@
+package depth
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/fx"
+	"csgo2-trading-bot/services/httpclient"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Platform 目前只有Steam公开买卖盘
+const Platform = "steam"
+
+// 历史查询最多返回的快照数
+const maxHistory = 2000
+
+// ChartLevel 深度图的一档，Cumulative为该档及更优价格的累计数量
+type ChartLevel struct {
+	Price      float64 `json:"price"`
+	Quantity   int     `json:"quantity"`
+	Cumulative int     `json:"cumulative"`
+}
+
+// Chart 某一时刻的深度图
+type Chart struct {
+	ItemID     uint         `json:"item_id"`
+	Platform   string       `json:"platform"`
+	CapturedAt time.Time    `json:"captured_at"`
+	BestBid    float64      `json:"best_bid"`
+	BestAsk    float64      `json:"best_ask"`
+	Spread     float64      `json:"spread"`
+	SpreadPct  float64      `json:"spread_pct"` // 买卖价差占最低卖价的比例
+	Bids       []ChartLevel `json:"bids"`
+	Asks       []ChartLevel `json:"asks"`
+}
+
+// Service 定期采集Steam买卖盘深度和分区报价，提供深度图和分区价差查询
+type Service struct {
+	db      *gorm.DB
+	http    *http.Client
+	budget  *httpclient.Budget // Steam请求预算，由所有Steam请求共享
+	fx      *fx.Service
+	sellFee func(platform string, amount float64) float64
+	config  config.DepthConfig
+	ctx     context.Context
+}
+
+func NewService(db *gorm.DB, httpClient *http.Client, budget *httpclient.Budget, fxService *fx.Service, sellFee func(platform string, amount float64) float64, cfg config.DepthConfig) *Service {
+	return &Service{
+		db:      db,
+		http:    httpClient,
+		budget:  budget,
+		fx:      fxService,
+		sellFee: sellFee,
+		config:  cfg,
+		ctx:     context.Background(),
+	}
+}
+
+// Start 注册深度快照任务，配置了分区时同时注册分区报价任务
+func (s *Service) Start(sched *scheduler.Scheduler) error {
+	err := sched.Add(scheduler.Job{
+		ID:   "depth_snapshot",
+		Spec: (time.Duration(s.config.Interval) * time.Second).String(),
+		Run:  s.Capture,
+	})
+	if err != nil || len(s.config.Regions) == 0 {
+		return err
+	}
+	return sched.Add(scheduler.Job{
+		ID:   "steam_regional_prices",
+		Spec: (time.Duration(s.config.RegionInterval) * time.Second).String(),
+		Run:  s.CaptureRegions,
+	})
+}
+
+// Capture 为成交最活跃的物品和激活策略交易的物品保存一次买卖盘快照，并清理过期快照
+func (s *Service) Capture() {
+	items, err := s.targets()
+	if err != nil {
+		logrus.Errorf("Failed to load items for depth snapshots: %v", err)
+		return
+	}
+
+	rate, err := s.fx.ToBase(1, s.config.Currency)
+	if err != nil {
+		logrus.Errorf("Depth snapshots skipped: %v", err)
+		return
+	}
+
+	captured := 0
+	for i := range items {
+		err := s.capture(&items[i], rate)
+		if errors.Is(err, errRateLimited) {
+			logrus.Warnf("Depth snapshots stopped after %d items: %v", captured, err)
+			break
+		}
+		if err != nil {
+			logrus.Warnf("Failed to snapshot depth of %s: %v", items[i].MarketHashName, err)
+			continue
+		}
+		captured++
+	}
+
+	s.prune()
+}
+
+// targets 需要采集深度的物品
+func (s *Service) targets() ([]models.Item, error) {
+	var items []models.Item
+	if s.config.TopItems > 0 {
+		err := s.db.Select("id", "market_hash_name", "steam_name_id").
+			Where("volume_24h > 0").
+			Order("volume_24h DESC").
+			Limit(s.config.TopItems).
+			Find(&items).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var strategyItems []uint
+	err := s.db.Raw(`
+		SELECT DISTINCT (config->>'item_id')::bigint
+		FROM strategies
+		WHERE status = ? AND deleted_at IS NULL AND config->>'item_id' ~ '^[0-9]+$'`, "active").
+		Scan(&strategyItems).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool, len(items))
+	for _, item := range items {
+		seen[item.ID] = true
+	}
+	var missing []uint
+	for _, id := range strategyItems {
+		if !seen[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		var extra []models.Item
+		if err := s.db.Select("id", "market_hash_name", "steam_name_id").Where("id IN ?", missing).Find(&extra).Error; err != nil {
+			return nil, err
+		}
+		items = append(items, extra...)
+	}
+	return items, nil
+}
+
+// capture 拉取一个物品的买卖盘，价格按rate换算为本位币后保存
+func (s *Service) capture(item *models.Item, rate float64) error {
+	ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+	defer cancel()
+
+	if err := s.resolveNameID(ctx, item); err != nil {
+		return err
+	}
+	book, err := s.fetchBook(ctx, item.SteamNameID, "US", s.config.Currency)
+	if err != nil {
+		return err
+	}
+
+	snapshot := models.OrderBookSnapshot{
+		ItemID:     item.ID,
+		Platform:   Platform,
+		CapturedAt: time.Now(),
+		BidVolume:  convert(book.Bids, rate),
+		AskVolume:  convert(book.Asks, rate),
+	}
+	if len(book.Bids) > 0 {
+		snapshot.BestBid = book.Bids[0].Price
+	}
+	if len(book.Asks) > 0 {
+		snapshot.BestAsk = book.Asks[0].Price
+	}
+
+	// 买卖总量按完整的买卖盘统计，只保存离盘口最近的若干档
+	if s.config.Levels > 0 {
+		book.Bids = book.Bids[:min(len(book.Bids), s.config.Levels)]
+		book.Asks = book.Asks[:min(len(book.Asks), s.config.Levels)]
+	}
+	snapshot.Levels = len(book.Bids) + len(book.Asks)
+
+	snapshot.Data, err = book.encode()
+	if err != nil {
+		return err
+	}
+	return s.db.Create(&snapshot).Error
+}
+
+// resolveNameID 物品还没有item_nameid时从商品页解析并保存
+func (s *Service) resolveNameID(ctx context.Context, item *models.Item) error {
+	if item.SteamNameID != 0 {
+		return nil
+	}
+	nameID, err := s.fetchNameID(ctx, item.MarketHashName)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Model(item).Update("steam_name_id", nameID).Error; err != nil {
+		return err
+	}
+	item.SteamNameID = nameID
+	return nil
+}
+
+// convert 将各档价格换算为本位币，返回总数量
+func convert(levels []Level, rate float64) int {
+	total := 0
+	for i := range levels {
+		levels[i].Price = math.Round(levels[i].Price*rate*100) / 100
+		total += levels[i].Quantity
+	}
+	return total
+}
+
+// prune 删除超过保留天数的快照
+func (s *Service) prune() {
+	if s.config.RetentionDays <= 0 {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -s.config.RetentionDays)
+	if err := s.db.Where("captured_at < ?", cutoff).Delete(&models.OrderBookSnapshot{}).Error; err != nil {
+		logrus.Errorf("Failed to prune order book snapshots: %v", err)
+	}
+	if err := s.db.Where("captured_at < ?", cutoff).Delete(&models.SteamRegionalPrice{}).Error; err != nil {
+		logrus.Errorf("Failed to prune steam regional prices: %v", err)
+	}
+}
+
+// Chart at时刻（为零值时为最新）的深度图
+func (s *Service) Chart(itemID uint, platform string, at time.Time) (*Chart, error) {
+	snapshot, book, err := Snapshot(s.db, itemID, platform, at)
+	if err != nil {
+		return nil, err
+	}
+
+	chart := &Chart{
+		ItemID:     itemID,
+		Platform:   snapshot.Platform,
+		CapturedAt: snapshot.CapturedAt,
+		BestBid:    snapshot.BestBid,
+		BestAsk:    snapshot.BestAsk,
+		Bids:       cumulative(book.Bids),
+		Asks:       cumulative(book.Asks),
+	}
+	if chart.BestBid > 0 && chart.BestAsk > 0 {
+		chart.Spread = chart.BestAsk - chart.BestBid
+		chart.SpreadPct = chart.Spread / chart.BestAsk
+	}
+	return chart, nil
+}
+
+func cumulative(levels []Level) []ChartLevel {
+	result := make([]ChartLevel, 0, len(levels))
+	total := 0
+	for _, level := range levels {
+		total += level.Quantity
+		result = append(result, ChartLevel{Price: level.Price, Quantity: level.Quantity, Cumulative: total})
+	}
+	return result
+}
+
+// History [from, to)内各次快照的盘口摘要，按时间升序；超过上限时保留最近的快照
+func (s *Service) History(itemID uint, platform string, from, to time.Time) ([]models.OrderBookSnapshot, error) {
+	var snapshots []models.OrderBookSnapshot
+	err := s.db.Omit("data").
+		Where("item_id = ? AND platform = ? AND captured_at >= ? AND captured_at < ?", itemID, platform, from, to).
+		Order("captured_at DESC").
+		Limit(maxHistory).
+		Find(&snapshots).Error
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(snapshots)-1; i < j; i, j = i+1, j-1 {
+		snapshots[i], snapshots[j] = snapshots[j], snapshots[i]
+	}
+	return snapshots, nil
+}
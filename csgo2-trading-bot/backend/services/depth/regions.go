@@ -0,0 +1,261 @@
+package depth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OpportunityRegional 分区价差的机会类型，区别于跨平台套利
+const OpportunityRegional = "steam_regional"
+
+// RegionalSpread 在一个分区按最低卖价买入、在另一个分区按最低卖价挂单卖出的价差，金额为本位币
+type RegionalSpread struct {
+	Type           string    `json:"type"`
+	ItemID         uint      `json:"item_id"`
+	MarketHashName string    `json:"market_hash_name"`
+	BuyRegion      string    `json:"buy_region"`
+	BuyCurrency    string    `json:"buy_currency"`
+	BuyLocalPrice  float64   `json:"buy_local_price"`
+	BuyPrice       float64   `json:"buy_price"`
+	BuyVolume      int       `json:"buy_volume"` // 买入区的卖单数量
+	SellRegion     string    `json:"sell_region"`
+	SellCurrency   string    `json:"sell_currency"`
+	SellLocalPrice float64   `json:"sell_local_price"`
+	SellPrice      float64   `json:"sell_price"`
+	SellBid        float64   `json:"sell_bid"` // 卖出区的最高买价，急于变现时的成交价
+	Fee            float64   `json:"fee"`
+	Profit         float64   `json:"profit"`
+	ProfitPct      float64   `json:"profit_pct"`
+	CapturedAt     time.Time `json:"captured_at"` // 两个分区中较早的采集时间
+	Constraints    []string  `json:"constraints"`
+}
+
+// CaptureRegions 按配置的各分区采集物品的盘口，价格按当前汇率换算为本位币
+func (s *Service) CaptureRegions() {
+	items, err := s.targets()
+	if err != nil {
+		logrus.Errorf("Failed to load items for regional prices: %v", err)
+		return
+	}
+
+	var regions []config.SteamRegionConfig
+	rates := make(map[string]float64, len(s.config.Regions))
+	for _, region := range s.config.Regions {
+		rate, err := s.fx.ToBase(1, region.Currency)
+		if err != nil {
+			logrus.Warnf("Regional prices for %s skipped: %v", region.Code, err)
+			continue
+		}
+		regions = append(regions, region)
+		rates[region.Code] = rate
+	}
+	if len(regions) < 2 {
+		logrus.Warn("Regional prices skipped: fewer than two regions with exchange rates")
+		return
+	}
+
+	captured := 0
+	for i := range items {
+		err := s.captureRegions(&items[i], regions, rates)
+		if errors.Is(err, errRateLimited) {
+			logrus.Warnf("Regional prices stopped after %d items: %v", captured, err)
+			return
+		}
+		if err != nil {
+			logrus.Warnf("Failed to capture regional prices of %s: %v", items[i].MarketHashName, err)
+			continue
+		}
+		captured++
+	}
+}
+
+// captureRegions 依次拉取一个物品在各分区的盘口
+func (s *Service) captureRegions(item *models.Item, regions []config.SteamRegionConfig, rates map[string]float64) error {
+	now := time.Now()
+	prices := make([]models.SteamRegionalPrice, 0, len(regions))
+	for _, region := range regions {
+		ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+		book, err := s.fetchRegion(ctx, item, region)
+		cancel()
+		if errors.Is(err, errRateLimited) {
+			return err
+		}
+		if err != nil {
+			logrus.Warnf("Failed to fetch %s prices of %s: %v", region.Code, item.MarketHashName, err)
+			continue
+		}
+
+		rate := rates[region.Code]
+		price := models.SteamRegionalPrice{
+			ItemID:     item.ID,
+			Region:     region.Code,
+			Currency:   strings.ToUpper(region.Currency),
+			CapturedAt: now,
+			FXRate:     rate,
+		}
+		if len(book.Bids) > 0 {
+			price.LocalBid = book.Bids[0].Price
+		}
+		if len(book.Asks) > 0 {
+			price.LocalAsk = book.Asks[0].Price
+		}
+		price.BidVolume = convert(book.Bids, rate)
+		price.AskVolume = convert(book.Asks, rate)
+		price.BestBid = math.Round(price.LocalBid*rate*100) / 100
+		price.BestAsk = math.Round(price.LocalAsk*rate*100) / 100
+		prices = append(prices, price)
+	}
+	if len(prices) == 0 {
+		return errors.New("no region returned prices")
+	}
+	return s.db.Create(&prices).Error
+}
+
+func (s *Service) fetchRegion(ctx context.Context, item *models.Item, region config.SteamRegionConfig) (*Book, error) {
+	if err := s.resolveNameID(ctx, item); err != nil {
+		return nil, err
+	}
+	return s.fetchBook(ctx, item.SteamNameID, region.Country, region.Currency)
+}
+
+// RegionalPrices 物品在各分区的最新盘口
+func (s *Service) RegionalPrices(itemID uint) ([]models.SteamRegionalPrice, error) {
+	var prices []models.SteamRegionalPrice
+	err := s.db.Raw(`
+		SELECT DISTINCT ON (region) *
+		FROM steam_regional_prices
+		WHERE item_id = ?
+		ORDER BY region, captured_at DESC`, itemID).
+		Scan(&prices).Error
+	return prices, err
+}
+
+// RegionalSpreads 最近一轮分区报价中扣除Steam手续费后收益率不低于minPct的价差，按收益率降序。
+// itemID不为零时只看该物品，minPct小于零时使用配置的region_min_spread
+func (s *Service) RegionalSpreads(itemID uint, minPct float64, limit int) ([]RegionalSpread, error) {
+	if minPct < 0 {
+		minPct = s.config.RegionMinSpread
+	}
+	// 超过两个采集周期的报价视为过期，避免与另一分区的新报价比较
+	since := time.Now().Add(-2 * time.Duration(s.config.RegionInterval) * time.Second)
+
+	query := `
+		SELECT DISTINCT ON (p.item_id, p.region) p.*, i.market_hash_name
+		FROM steam_regional_prices p
+		JOIN items i ON i.id = p.item_id
+		WHERE p.captured_at >= ? AND p.best_ask > 0`
+	args := []interface{}{since}
+	if itemID != 0 {
+		query += " AND p.item_id = ?"
+		args = append(args, itemID)
+	}
+	query += " ORDER BY p.item_id, p.region, p.captured_at DESC"
+
+	var rows []struct {
+		models.SteamRegionalPrice
+		MarketHashName string
+	}
+	if err := s.db.Raw(query, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	regions := make(map[string]config.SteamRegionConfig, len(s.config.Regions))
+	for _, region := range s.config.Regions {
+		regions[region.Code] = region
+	}
+
+	byItem := make(map[uint][]models.SteamRegionalPrice)
+	names := make(map[uint]string)
+	for _, row := range rows {
+		byItem[row.ItemID] = append(byItem[row.ItemID], row.SteamRegionalPrice)
+		names[row.ItemID] = row.MarketHashName
+	}
+
+	var spreads []RegionalSpread
+	for id, prices := range byItem {
+		for _, buy := range prices {
+			buyRegion, ok := regions[buy.Region]
+			if !ok || !buyRegion.Buy || buy.AskVolume == 0 {
+				continue
+			}
+			for _, sell := range prices {
+				sellRegion, ok := regions[sell.Region]
+				if !ok || !sellRegion.Sell || sell.Region == buy.Region {
+					continue
+				}
+				spread := s.regionalSpread(buy, sell, buyRegion, sellRegion)
+				if spread.ProfitPct < minPct {
+					continue
+				}
+				spread.ItemID = id
+				spread.MarketHashName = names[id]
+				spreads = append(spreads, spread)
+			}
+		}
+	}
+
+	sort.Slice(spreads, func(i, j int) bool { return spreads[i].ProfitPct > spreads[j].ProfitPct })
+	if limit > 0 && len(spreads) > limit {
+		spreads = spreads[:limit]
+	}
+	return spreads, nil
+}
+
+// regionalSpread 以卖出区的最低卖价挂单计算到手收益
+func (s *Service) regionalSpread(buy, sell models.SteamRegionalPrice, buyRegion, sellRegion config.SteamRegionConfig) RegionalSpread {
+	fee := math.Round(s.sellFee(Platform, sell.BestAsk)*100) / 100
+	profit := sell.BestAsk - fee - buy.BestAsk
+
+	capturedAt := buy.CapturedAt
+	if sell.CapturedAt.Before(capturedAt) {
+		capturedAt = sell.CapturedAt
+	}
+	return RegionalSpread{
+		Type:           OpportunityRegional,
+		BuyRegion:      buy.Region,
+		BuyCurrency:    buy.Currency,
+		BuyLocalPrice:  buy.LocalAsk,
+		BuyPrice:       buy.BestAsk,
+		BuyVolume:      buy.AskVolume,
+		SellRegion:     sell.Region,
+		SellCurrency:   sell.Currency,
+		SellLocalPrice: sell.LocalAsk,
+		SellPrice:      sell.BestAsk,
+		SellBid:        sell.BestBid,
+		Fee:            fee,
+		Profit:         math.Round(profit*100) / 100,
+		ProfitPct:      profit / buy.BestAsk,
+		CapturedAt:     capturedAt,
+		Constraints:    s.regionalConstraints(buyRegion, sellRegion),
+	}
+}
+
+// regionalConstraints 执行分区价差的限制：Steam钱包币种固定，买卖两端需要不同账号，
+// 市场买入的物品有交易保护期，卖出所得只能留在卖出区的钱包中
+func (s *Service) regionalConstraints(buy, sell config.SteamRegionConfig) []string {
+	constraints := []string{
+		fmt.Sprintf("buy with an account whose Steam wallet is in %s (%s)", strings.ToUpper(buy.Currency), buy.Code),
+		fmt.Sprintf("sell with a different account whose Steam wallet is in %s (%s)", strings.ToUpper(sell.Currency), sell.Code),
+		fmt.Sprintf("proceeds stay in the %s wallet and cannot be withdrawn or converted to %s", strings.ToUpper(sell.Currency), strings.ToUpper(buy.Currency)),
+	}
+	if s.config.TradeHoldDays > 0 {
+		constraints = append(constraints, fmt.Sprintf("items bought on the Steam market cannot be traded to the selling account for %d days", s.config.TradeHoldDays))
+	}
+	if buy.Note != "" {
+		constraints = append(constraints, buy.Code+": "+buy.Note)
+	}
+	if sell.Note != "" && sell.Code != buy.Code {
+		constraints = append(constraints, sell.Code+": "+sell.Note)
+	}
+	return constraints
+}
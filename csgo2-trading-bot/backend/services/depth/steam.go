@@ -0,0 +1,125 @@
+package depth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"csgo2-trading-bot/services/httpclient"
+)
+
+// errRateLimited Steam返回429，本轮剩余物品留到下一轮
+var errRateLimited = errors.New("steam rate limited")
+
+// 商品页中加载买卖盘的脚本调用，参数即item_nameid
+var nameIDPattern = regexp.MustCompile(`Market_LoadOrderSpread\(\s*(\d+)\s*\)`)
+
+// steamCurrencies Steam钱包币种代码
+var steamCurrencies = map[string]int{
+	"USD": 1, "GBP": 2, "EUR": 3, "CHF": 4, "RUB": 5, "PLN": 6, "BRL": 7, "JPY": 8,
+	"NOK": 9, "IDR": 10, "MYR": 11, "PHP": 12, "SGD": 13, "THB": 14, "VND": 15, "KRW": 16,
+	"TRY": 17, "UAH": 18, "MXN": 19, "CAD": 20, "AUD": 21, "NZD": 22, "CNY": 23, "INR": 24,
+	"HKD": 29, "TWD": 30,
+}
+
+// steamHistogram 买卖盘接口的响应，graph中每项为[价格, 该价格及更优价格的累计数量, 描述]
+type steamHistogram struct {
+	Success        int             `json:"success"`
+	BuyOrderGraph  [][]interface{} `json:"buy_order_graph"`
+	SellOrderGraph [][]interface{} `json:"sell_order_graph"`
+}
+
+// fetchNameID 从商品页解析item_nameid
+func (s *Service) fetchNameID(ctx context.Context, marketHashName string) (int64, error) {
+	body, err := s.get(ctx, s.config.ListingURL+url.PathEscape(marketHashName))
+	if err != nil {
+		return 0, err
+	}
+	match := nameIDPattern.FindSubmatch(body)
+	if match == nil {
+		return 0, fmt.Errorf("item_nameid not found on listing page of %s", marketHashName)
+	}
+	return strconv.ParseInt(string(match[1]), 10, 64)
+}
+
+// fetchBook 拉取country分区下的买卖盘，价格为currency币种
+func (s *Service) fetchBook(ctx context.Context, nameID int64, country, currency string) (*Book, error) {
+	code, ok := steamCurrencies[strings.ToUpper(currency)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported steam currency: %s", currency)
+	}
+
+	params := url.Values{}
+	params.Set("country", strings.ToUpper(country))
+	params.Set("language", "english")
+	params.Set("currency", strconv.Itoa(code))
+	params.Set("item_nameid", strconv.FormatInt(nameID, 10))
+	params.Set("two_factor", "0")
+
+	body, err := s.get(ctx, s.config.HistogramURL+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var histogram steamHistogram
+	if err := json.Unmarshal(body, &histogram); err != nil {
+		return nil, err
+	}
+	if histogram.Success != 1 {
+		return nil, fmt.Errorf("steam order histogram failed")
+	}
+	return &Book{
+		Bids: levels(histogram.BuyOrderGraph),
+		Asks: levels(histogram.SellOrderGraph),
+	}, nil
+}
+
+// levels 将累计数量还原为每档数量
+func levels(graph [][]interface{}) []Level {
+	result := make([]Level, 0, len(graph))
+	previous := 0
+	for _, point := range graph {
+		if len(point) < 2 {
+			continue
+		}
+		price, ok1 := point[0].(float64)
+		cumulative, ok2 := point[1].(float64)
+		if !ok1 || !ok2 || int(cumulative) <= previous {
+			continue
+		}
+		result = append(result, Level{Price: price, Quantity: int(cumulative) - previous})
+		previous = int(cumulative)
+	}
+	return result
+}
+
+// get 以后台优先级排队取得Steam请求预算后发出请求，排队时间不计入客户端超时
+func (s *Service) get(ctx context.Context, endpoint string) ([]byte, error) {
+	ctx, err := s.budget.Reserve(ctx, httpclient.PriorityBackground)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, errRateLimited
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("steam returned %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,348 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/market"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/scheduler"
+	"csgo2-trading-bot/services/webhooks"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound 用户未设置邮件通知
+var ErrNotFound = errors.New("email subscription not found")
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// templates 每个消息一套模板，共用layout
+var templates = func() map[string]*template.Template {
+	set := make(map[string]*template.Template)
+	for _, name := range []string{"order_failed", "strategy_stopped", "login_new_device", "digest", "message", "test"} {
+		set[name] = template.Must(template.ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html"))
+	}
+	return set
+}()
+
+// 使用专门模板的事件，用户没有设置通知偏好时只发送这些事件；其他事件使用通用模板
+var eventTemplates = map[string]string{
+	webhooks.EventOrderFailed:     "order_failed",
+	webhooks.EventStrategyStopped: "strategy_stopped",
+	webhooks.EventLoginNewDevice:  "login_new_device",
+}
+
+const timeLayout = "2006-01-02 15:04"
+
+// Settings 修改邮件通知设置时提交的内容
+type Settings struct {
+	Address string `json:"address" binding:"required"`
+	Alerts  *bool  `json:"alerts"`
+	Digest  *bool  `json:"digest"`
+}
+
+// Service 邮件通知：作为通知渠道即时发送事件，每日摘要按计划发送给开启摘要的用户
+type Service struct {
+	db     *gorm.DB
+	market *market.Service
+	config config.EmailConfig
+}
+
+func NewService(db *gorm.DB, marketService *market.Service, cfg config.EmailConfig) *Service {
+	if cfg.DigestSpreads <= 0 {
+		cfg.DigestSpreads = 5
+	}
+	return &Service{
+		db:     db,
+		market: marketService,
+		config: cfg,
+	}
+}
+
+// Start 校验发件配置并注册每日摘要任务
+func (s *Service) Start(sched *scheduler.Scheduler) error {
+	if s.config.Host == "" || s.config.From == "" {
+		return errors.New("email host and from are required")
+	}
+	if _, err := mail.ParseAddress(s.config.From); err != nil {
+		return fmt.Errorf("invalid email from: %w", err)
+	}
+
+	return sched.Add(scheduler.Job{
+		ID:   "email_digest",
+		Spec: s.config.DigestSchedule,
+		Run:  s.sendDigests,
+	})
+}
+
+// Get 用户的邮件通知设置
+func (s *Service) Get(userID uint) (*models.EmailSubscription, error) {
+	var sub models.EmailSubscription
+	if err := s.db.Where("user_id = ?", userID).First(&sub).Error; err != nil {
+		return nil, ErrNotFound
+	}
+	return &sub, nil
+}
+
+// Save 创建或修改邮件通知设置，首次设置时默认开启关键事件、关闭每日摘要
+func (s *Service) Save(userID uint, settings Settings) (*models.EmailSubscription, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(settings.Address))
+	if err != nil {
+		return nil, errors.New("invalid email address")
+	}
+
+	sub := models.EmailSubscription{UserID: userID, Alerts: true}
+	s.db.Where("user_id = ?", userID).First(&sub)
+	sub.Address = addr.Address
+	if settings.Alerts != nil {
+		sub.Alerts = *settings.Alerts
+	}
+	if settings.Digest != nil {
+		sub.Digest = *settings.Digest
+	}
+	if err := s.db.Save(&sub).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Delete 删除邮件通知设置
+func (s *Service) Delete(userID uint) error {
+	result := s.db.Where("user_id = ?", userID).Delete(&models.EmailSubscription{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SendTest 向用户设置的地址发送测试邮件，同步返回发送结果
+func (s *Service) SendTest(userID uint) error {
+	sub, err := s.Get(userID)
+	if err != nil {
+		return err
+	}
+	return s.sendTemplate(sub.Address, "test", map[string]interface{}{"Time": time.Now().Format(timeLayout)})
+}
+
+func (s *Service) Name() string {
+	return "email"
+}
+
+func (s *Service) DefaultEvents() []string {
+	events := make([]string, 0, len(eventTemplates))
+	for event := range eventTemplates {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	return events
+}
+
+// Send 发送到用户设置的地址，未设置或关闭了即时通知时返回notify.ErrNotConfigured
+func (s *Service) Send(userID uint, msg notify.Message) error {
+	var sub models.EmailSubscription
+	if err := s.db.Where("user_id = ? AND alerts = ?", userID, true).First(&sub).Error; err != nil {
+		return notify.ErrNotConfigured
+	}
+
+	name, ok := eventTemplates[msg.Event]
+	if !ok {
+		name = "message"
+	}
+	data := map[string]interface{}{"Time": time.Now().Format(timeLayout), "Data": msg.Data, "Message": msg}
+	if order, ok := msg.Data.(*models.Order); ok {
+		data["Order"] = order
+		data["ItemName"] = s.itemName(order)
+	}
+	return s.sendTemplate(sub.Address, name, data)
+}
+
+// tradeSummary 摘要中的成交统计
+type tradeSummary struct {
+	Count      int
+	Buys       int
+	Sells      int
+	BuyAmount  float64
+	SellAmount float64
+	Fees       float64
+	Profit     float64
+}
+
+// sendDigests 给开启摘要的用户发送过去24小时的成交统计和价差最大的物品
+func (s *Service) sendDigests() {
+	now := time.Now()
+	since := now.Add(-24 * time.Hour)
+
+	var subs []models.EmailSubscription
+	// 留出余量，避免重启或调度抖动导致同一天重复发送
+	if err := s.db.Where("digest = ? AND (last_digest_at IS NULL OR last_digest_at < ?)", true, now.Add(-20*time.Hour)).
+		Find(&subs).Error; err != nil {
+		logrus.Errorf("Failed to load digest subscriptions: %v", err)
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+
+	spreads, err := s.market.TopSpreads(since, s.config.DigestSpreads)
+	if err != nil {
+		logrus.Warnf("Failed to load arbitrage opportunities for digest: %v", err)
+	}
+
+	for i := range subs {
+		sub := &subs[i]
+		var trades tradeSummary
+		err := s.db.Raw(`
+			SELECT COUNT(*) AS count,
+			       COUNT(*) FILTER (WHERE type = 'buy') AS buys,
+			       COUNT(*) FILTER (WHERE type = 'sell') AS sells,
+			       COALESCE(SUM(amount) FILTER (WHERE type = 'buy'), 0) AS buy_amount,
+			       COALESCE(SUM(amount) FILTER (WHERE type = 'sell'), 0) AS sell_amount,
+			       COALESCE(SUM(fee), 0) AS fees,
+			       COALESCE(SUM(profit) FILTER (WHERE type = 'sell'), 0) AS profit
+			FROM transactions
+			WHERE user_id = ? AND completed_at >= ? AND deleted_at IS NULL`, sub.UserID, since).
+			Scan(&trades).Error
+		if err != nil {
+			logrus.Errorf("Failed to summarize trades for user %d: %v", sub.UserID, err)
+			continue
+		}
+
+		err = s.sendTemplate(sub.Address, "digest", map[string]interface{}{
+			"Date":    now.Format("2006-01-02"),
+			"Trades":  trades,
+			"Spreads": spreads,
+		})
+		if err != nil {
+			logrus.Warnf("Failed to send digest to user %d: %v", sub.UserID, err)
+			continue
+		}
+		s.db.Model(sub).Update("last_digest_at", now)
+	}
+}
+
+func (s *Service) itemName(order *models.Order) string {
+	if order.Item.Name != "" {
+		return order.Item.Name
+	}
+	var item models.Item
+	s.db.Select("name").First(&item, order.ItemID)
+	return item.Name
+}
+
+// sendTemplate 渲染模板并发送
+func (s *Service) sendTemplate(to, name string, data interface{}) error {
+	tmpl := templates[name]
+
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return err
+	}
+	if err := tmpl.ExecuteTemplate(&body, "layout", data); err != nil {
+		return err
+	}
+	return s.send(to, html.UnescapeString(strings.TrimSpace(subject.String())), body.Bytes())
+}
+
+// send 发送HTML邮件
+func (s *Service) send(to, subject string, body []byte) error {
+	from, err := mail.ParseAddress(s.config.From)
+	if err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString(body)
+	for len(encoded) > 76 {
+		msg.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	msg.WriteString(encoded + "\r\n")
+
+	return s.deliver(from.Address, to, msg.Bytes())
+}
+
+// deliver 通过SMTP投递，端口465使用TLS直连，其他端口在服务器支持时升级为STARTTLS
+func (s *Service) deliver(from, to string, msg []byte) error {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	tlsConfig := &tls.Config{ServerName: s.config.Host}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if s.config.Port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.config.Port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if s.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
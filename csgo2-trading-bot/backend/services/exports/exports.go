@@ -0,0 +1,508 @@
+package exports
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/scheduler"
+	"csgo2-trading-bot/services/storage"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 任务状态
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// 执行中的任务每写完一批续期一次，超过该时间没有续期视为实例已退出，由其他实例接手
+const jobLease = 2 * time.Minute
+
+var (
+	// ErrNotFound 任务不存在或不属于当前用户
+	ErrNotFound = errors.New("export job not found")
+	// ErrNotReady 任务尚未完成，没有可下载的文件
+	ErrNotReady = errors.New("export is not ready")
+	// ErrExpired 导出文件已过期删除
+	ErrExpired = errors.New("export file has expired")
+	// ErrActive 任务仍在排队或执行，需先取消
+	ErrActive = errors.New("export job is still active, cancel it first")
+)
+
+// Service 异步导出：排队、分批写入带检查点的临时文件、完成后保存到文件存储
+type Service struct {
+	db      *gorm.DB
+	storage *storage.Service
+	config  config.ExportsConfig
+	slots   chan struct{} // 本实例可同时执行的任务数
+}
+
+func NewService(db *gorm.DB, storageService *storage.Service, cfg config.ExportsConfig) *Service {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 5000
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 30
+	}
+	return &Service{
+		db:      db,
+		storage: storageService,
+		config:  cfg,
+		slots:   make(chan struct{}, cfg.Workers),
+	}
+}
+
+// Start 注册领取任务和清理过期任务的定时任务
+func (s *Service) Start(sched *scheduler.Scheduler) error {
+	err := sched.Add(scheduler.Job{
+		ID:   "export_worker",
+		Spec: (time.Duration(s.config.PollInterval) * time.Second).String(),
+		Run:  s.poll,
+	})
+	if err != nil {
+		return err
+	}
+	return sched.Add(scheduler.Job{
+		ID:   "export_cleanup",
+		Spec: time.Hour.String(),
+		Run:  s.cleanup,
+	})
+}
+
+// Create 创建导出任务并立即尝试开始执行
+func (s *Service) Create(userID uint, kind string, params Params) (*models.ExportJob, error) {
+	exp, ok := exporters[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown export kind %q, expected %s, %s or %s", kind, KindPriceHistory, KindTransactions, KindTaxReport)
+	}
+	switch params.Format {
+	case "":
+		params.Format = FormatCSV
+	case FormatCSV, FormatPDF:
+	default:
+		return nil, fmt.Errorf("unknown export format %q, expected %s or %s", params.Format, FormatCSV, FormatPDF)
+	}
+	if exp.validate != nil {
+		if err := exp.validate(&params); err != nil {
+			return nil, err
+		}
+	}
+	if params.From != nil && params.To != nil && !params.From.Before(*params.To) {
+		return nil, errors.New("from must be before to")
+	}
+
+	var active int64
+	if err := s.db.Model(&models.ExportJob{}).
+		Where("user_id = ? AND status IN ?", userID, []string{StatusPending, StatusRunning}).
+		Count(&active).Error; err != nil {
+		return nil, err
+	}
+	if s.config.MaxActive > 0 && active >= int64(s.config.MaxActive) {
+		return nil, fmt.Errorf("at most %d exports can be queued or running at a time", s.config.MaxActive)
+	}
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	job := models.ExportJob{
+		UserID: userID,
+		Kind:   kind,
+		Params: string(raw),
+		Status: StatusPending,
+	}
+	if err := s.db.Create(&job).Error; err != nil {
+		return nil, err
+	}
+	go s.poll()
+	return &job, nil
+}
+
+// List 用户的导出任务
+func (s *Service) List(userID uint) ([]models.ExportJob, error) {
+	var jobs []models.ExportJob
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		setProgress(&jobs[i])
+	}
+	return jobs, nil
+}
+
+// Get 用户的单个导出任务
+func (s *Service) Get(userID, id uint) (*models.ExportJob, error) {
+	var job models.ExportJob
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&job).Error; err != nil {
+		return nil, ErrNotFound
+	}
+	setProgress(&job)
+	return &job, nil
+}
+
+// Cancel 取消排队或执行中的任务，执行中的任务在写完当前批次后停止
+func (s *Service) Cancel(userID, id uint) (*models.ExportJob, error) {
+	now := time.Now()
+	result := s.db.Model(&models.ExportJob{}).
+		Where("id = ? AND user_id = ? AND status IN ?", id, userID, []string{StatusPending, StatusRunning, StatusFailed}).
+		Updates(map[string]interface{}{"status": StatusCanceled, "finished_at": now, "lease_until": nil})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.Get(userID, id); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("only queued, running or failed exports can be canceled")
+	}
+	os.Remove(s.partPath(id))
+	return s.Get(userID, id)
+}
+
+// Resume 从最近的检查点重新排队失败的任务
+func (s *Service) Resume(userID, id uint) (*models.ExportJob, error) {
+	result := s.db.Model(&models.ExportJob{}).
+		Where("id = ? AND user_id = ? AND status = ?", id, userID, StatusFailed).
+		Updates(map[string]interface{}{"status": StatusPending, "error": "", "finished_at": nil})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.Get(userID, id); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("only failed exports can be resumed")
+	}
+	go s.poll()
+	return s.Get(userID, id)
+}
+
+// Delete 删除已结束的任务及其导出文件
+func (s *Service) Delete(ctx context.Context, userID, id uint) error {
+	job, err := s.Get(userID, id)
+	if err != nil {
+		return err
+	}
+	if job.Status == StatusPending || job.Status == StatusRunning {
+		return ErrActive
+	}
+	return s.remove(ctx, job)
+}
+
+// Download 已完成任务的限时下载链接
+func (s *Service) Download(userID, id uint) (*storage.Download, error) {
+	job, err := s.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != StatusCompleted || job.FileID == nil {
+		return nil, ErrNotReady
+	}
+	file, err := s.storage.Get(userID, *job.FileID)
+	if err != nil {
+		return nil, ErrExpired
+	}
+	return s.storage.DownloadURL(file)
+}
+
+// poll 在空闲的执行槽位上领取排队中的任务和租约过期的中断任务
+func (s *Service) poll() {
+	for {
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			return
+		}
+
+		job, err := s.claim()
+		if err != nil || job == nil {
+			<-s.slots
+			if err != nil {
+				logrus.Errorf("Failed to claim export job: %v", err)
+			}
+			return
+		}
+		go func() {
+			defer func() { <-s.slots }()
+			s.run(job)
+		}()
+	}
+}
+
+// claim 领取一个任务，SKIP LOCKED保证多个实例不会领到同一个任务
+func (s *Service) claim() (*models.ExportJob, error) {
+	now := time.Now()
+	var jobs []models.ExportJob
+	err := s.db.Raw(`
+		UPDATE export_jobs SET status = ?, lease_until = ?, started_at = COALESCE(started_at, ?), updated_at = ?
+		WHERE id = (
+			SELECT id FROM export_jobs
+			WHERE status = ? OR (status = ? AND lease_until < ?)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		StatusRunning, now.Add(jobLease), now, now, StatusPending, StatusRunning, now).
+		Scan(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// run 从检查点继续导出，每批写完后落盘并记录检查点；任务被取消或删除时停止并清理临时文件
+func (s *Service) run(job *models.ExportJob) {
+	exp := exporters[job.Kind]
+	var params Params
+	if err := json.Unmarshal([]byte(job.Params), &params); err != nil {
+		s.fail(job, err)
+		return
+	}
+
+	part, err := s.openPart(job)
+	if err != nil {
+		s.fail(job, err)
+		return
+	}
+	defer part.Close()
+
+	w := csv.NewWriter(part)
+	if job.Written == 0 {
+		if job.Total, err = exp.count(s.db, job.UserID, params); err != nil {
+			s.fail(job, err)
+			return
+		}
+		w.Write(exp.header)
+	}
+
+	for {
+		records, last, err := exp.batch(s.db, job.UserID, params, job.Cursor, s.config.BatchSize)
+		if err != nil {
+			s.fail(job, err)
+			return
+		}
+		w.WriteAll(records)
+		if err := w.Error(); err != nil {
+			s.fail(job, err)
+			return
+		}
+		if err := part.Sync(); err != nil {
+			s.fail(job, err)
+			return
+		}
+		written, err := part.Seek(0, io.SeekCurrent)
+		if err != nil {
+			s.fail(job, err)
+			return
+		}
+
+		job.Cursor = last
+		job.Rows += int64(len(records))
+		job.Written = written
+		active, err := s.checkpoint(job)
+		if err != nil {
+			s.fail(job, err)
+			return
+		}
+		if !active {
+			logrus.Infof("Export job %d stopped: canceled or deleted", job.ID)
+			part.Close()
+			os.Remove(part.Name())
+			return
+		}
+		if len(records) < s.config.BatchSize {
+			break
+		}
+	}
+
+	if err := s.complete(job, params, part); err != nil {
+		s.fail(job, err)
+		return
+	}
+	part.Close()
+	os.Remove(part.Name())
+}
+
+// openPart 打开临时文件并截断到检查点；临时文件缺失或短于检查点（如任务换了实例）时从头导出
+func (s *Service) openPart(job *models.ExportJob) (*os.File, error) {
+	if err := os.MkdirAll(s.config.WorkDir, 0o755); err != nil {
+		return nil, err
+	}
+	part, err := os.OpenFile(s.partPath(job.ID), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := part.Stat()
+	if err != nil {
+		part.Close()
+		return nil, err
+	}
+	if info.Size() < job.Written {
+		logrus.Warnf("Export job %d restarts from the beginning: checkpoint file is missing", job.ID)
+		job.Cursor, job.Rows, job.Written = 0, 0, 0
+	}
+	if err := part.Truncate(job.Written); err != nil {
+		part.Close()
+		return nil, err
+	}
+	if _, err := part.Seek(job.Written, io.SeekStart); err != nil {
+		part.Close()
+		return nil, err
+	}
+	return part, nil
+}
+
+// checkpoint 记录进度并续期，返回false表示任务已不再由本实例执行
+func (s *Service) checkpoint(job *models.ExportJob) (bool, error) {
+	result := s.db.Model(&models.ExportJob{}).
+		Where("id = ? AND status = ?", job.ID, StatusRunning).
+		Updates(map[string]interface{}{
+			"cursor":      job.Cursor,
+			"rows":        job.Rows,
+			"written":     job.Written,
+			"total":       job.Total,
+			"lease_until": time.Now().Add(jobLease),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// complete 上传导出文件并标记完成，要求PDF格式时由导出的CSV排版生成
+func (s *Service) complete(job *models.ExportJob, params Params, part *os.File) error {
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var body io.Reader = part
+	name, contentType := fmt.Sprintf("%s_%d.csv", job.Kind, job.ID), "text/csv"
+	if params.Format == FormatPDF {
+		doc, err := s.renderPDF(job, params, part)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(doc.Name())
+		defer doc.Close()
+		body, name, contentType = doc, fmt.Sprintf("%s_%d.pdf", job.Kind, job.ID), "application/pdf"
+	}
+
+	ttl := time.Duration(s.config.FileTTL) * time.Hour
+	file, err := s.storage.Save(context.Background(), job.UserID, storage.KindExport, name, contentType, body, ttl)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result := s.db.Model(&models.ExportJob{}).
+		Where("id = ? AND status = ?", job.ID, StatusRunning).
+		Updates(map[string]interface{}{
+			"status":      StatusCompleted,
+			"file_id":     file.ID,
+			"expires_at":  file.ExpiresAt,
+			"finished_at": now,
+			"lease_until": nil,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		// 上传期间任务被取消，文件不再需要
+		s.storage.Delete(context.Background(), job.UserID, file.ID)
+		return result.Error
+	}
+	logrus.Infof("Export job %d completed: %d rows", job.ID, job.Rows)
+	return nil
+}
+
+// renderPDF 把导出的CSV排版为PDF临时文件，返回时已定位到文件开头
+func (s *Service) renderPDF(job *models.ExportJob, params Params, part *os.File) (*os.File, error) {
+	title := job.Kind
+	if exp := exporters[job.Kind]; exp.title != nil {
+		title = exp.title(params)
+	}
+	doc, err := os.CreateTemp(s.config.WorkDir, fmt.Sprintf("export-%d-*.pdf", job.ID))
+	if err != nil {
+		return nil, err
+	}
+	err = writePDF(doc, title, part)
+	if err == nil {
+		_, err = doc.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		doc.Close()
+		os.Remove(doc.Name())
+		return nil, err
+	}
+	return doc, nil
+}
+
+// fail 标记任务失败，保留临时文件以便从检查点恢复
+func (s *Service) fail(job *models.ExportJob, err error) {
+	logrus.Errorf("Export job %d failed: %v", job.ID, err)
+	s.db.Model(&models.ExportJob{}).
+		Where("id = ? AND status = ?", job.ID, StatusRunning).
+		Updates(map[string]interface{}{
+			"status":      StatusFailed,
+			"error":       err.Error(),
+			"finished_at": time.Now(),
+			"lease_until": nil,
+		})
+}
+
+// cleanup 删除超过保留天数的已结束任务及其文件
+func (s *Service) cleanup() {
+	if s.config.RetentionDays <= 0 {
+		return
+	}
+	var jobs []models.ExportJob
+	err := s.db.Where("status IN ? AND finished_at < ?",
+		[]string{StatusCompleted, StatusFailed, StatusCanceled}, time.Now().AddDate(0, 0, -s.config.RetentionDays)).
+		Limit(500).
+		Find(&jobs).Error
+	if err != nil {
+		logrus.Errorf("Failed to load expired export jobs: %v", err)
+		return
+	}
+	for i := range jobs {
+		if err := s.remove(context.Background(), &jobs[i]); err != nil {
+			logrus.Warnf("Failed to delete export job %d: %v", jobs[i].ID, err)
+		}
+	}
+}
+
+// remove 删除任务记录、导出文件和临时文件
+func (s *Service) remove(ctx context.Context, job *models.ExportJob) error {
+	if job.FileID != nil {
+		if err := s.storage.Delete(ctx, job.UserID, *job.FileID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	os.Remove(s.partPath(job.ID))
+	return s.db.Delete(job).Error
+}
+
+func (s *Service) partPath(id uint) string {
+	return filepath.Join(s.config.WorkDir, fmt.Sprintf("export-%d.csv.part", id))
+}
+
+// setProgress 按已导出行数计算进度
+func setProgress(job *models.ExportJob) {
+	switch {
+	case job.Status == StatusCompleted:
+		job.Progress = 1
+	case job.Total > 0:
+		job.Progress = min(float64(job.Rows)/float64(job.Total), 1)
+	}
+}
@@ -0,0 +1,182 @@
+package exports
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 导出类型
+const (
+	KindPriceHistory = "price_history"
+	KindTransactions = "transactions"
+	KindTaxReport    = "tax_report"
+)
+
+// 导出文件格式
+const (
+	FormatCSV = "csv"
+	FormatPDF = "pdf"
+)
+
+// Params 导出的筛选条件，时间范围为[From, To)
+type Params struct {
+	From     *time.Time `json:"from,omitempty"`
+	To       *time.Time `json:"to,omitempty"`
+	ItemID   uint       `json:"item_id,omitempty"`
+	Platform string     `json:"platform,omitempty"`
+	Year     int        `json:"year,omitempty"`   // tax_report的纳税年度，按UTC自然年
+	Method   string     `json:"method,omitempty"` // tax_report的成本计算方式
+	Format   string     `json:"format,omitempty"` // csv（默认）或pdf
+}
+
+// exporter 一种导出：按ID递增分批读取，last为本批最后一条记录的ID，作为下一批的游标。
+// validate可选，创建任务时检查并补全筛选条件；title可选，作为PDF的标题
+type exporter struct {
+	header   []string
+	count    func(db *gorm.DB, userID uint, p Params) (int64, error)
+	batch    func(db *gorm.DB, userID uint, p Params, cursor uint, limit int) (records [][]string, last uint, err error)
+	validate func(p *Params) error
+	title    func(p Params) string
+}
+
+var exporters = map[string]exporter{
+	KindPriceHistory: {
+		header: []string{"id", "recorded_at", "item_id", "market_hash_name", "platform", "price", "volume"},
+		count: func(db *gorm.DB, userID uint, p Params) (int64, error) {
+			var total int64
+			err := priceHistoryQuery(db, p).Count(&total).Error
+			return total, err
+		},
+		batch: func(db *gorm.DB, userID uint, p Params, cursor uint, limit int) ([][]string, uint, error) {
+			var rows []struct {
+				ID             uint
+				RecordedAt     time.Time
+				ItemID         uint
+				MarketHashName string
+				Platform       string
+				Price          float64
+				Volume         int
+			}
+			err := priceHistoryQuery(db, p).
+				Select("price_histories.id, price_histories.recorded_at, price_histories.item_id, items.market_hash_name, price_histories.platform, price_histories.price, price_histories.volume").
+				Joins("JOIN items ON items.id = price_histories.item_id").
+				Where("price_histories.id > ?", cursor).
+				Order("price_histories.id").
+				Limit(limit).
+				Scan(&rows).Error
+			if err != nil || len(rows) == 0 {
+				return nil, cursor, err
+			}
+			records := make([][]string, len(rows))
+			for i, row := range rows {
+				records[i] = []string{
+					formatID(row.ID), row.RecordedAt.UTC().Format(time.RFC3339), formatID(row.ItemID),
+					row.MarketHashName, row.Platform, formatAmount(row.Price), strconv.Itoa(row.Volume),
+				}
+			}
+			return records, rows[len(rows)-1].ID, nil
+		},
+	},
+	KindTransactions: {
+		header: []string{"id", "completed_at", "order_id", "type", "platform", "item_id", "market_hash_name", "quantity", "amount", "fee", "cost_basis", "profit", "trade_id"},
+		count: func(db *gorm.DB, userID uint, p Params) (int64, error) {
+			var total int64
+			err := transactionQuery(db, userID, p).Count(&total).Error
+			return total, err
+		},
+		batch: func(db *gorm.DB, userID uint, p Params, cursor uint, limit int) ([][]string, uint, error) {
+			var rows []struct {
+				ID             uint
+				CompletedAt    time.Time
+				OrderID        uint
+				Type           string
+				Platform       string
+				ItemID         uint
+				MarketHashName string
+				Quantity       int
+				Amount         float64
+				Fee            float64
+				CostBasis      float64
+				Profit         float64
+				TradeID        string
+			}
+			err := transactionQuery(db, userID, p).
+				Select("transactions.id, transactions.completed_at, transactions.order_id, transactions.type, transactions.platform, orders.item_id, items.market_hash_name, "+
+					transactionQuantity+" AS quantity, transactions.amount, transactions.fee, transactions.cost_basis, transactions.profit, transactions.trade_id").
+				Joins("LEFT JOIN items ON items.id = orders.item_id").
+				Where("transactions.id > ?", cursor).
+				Order("transactions.id").
+				Limit(limit).
+				Scan(&rows).Error
+			if err != nil || len(rows) == 0 {
+				return nil, cursor, err
+			}
+			records := make([][]string, len(rows))
+			for i, row := range rows {
+				records[i] = []string{
+					formatID(row.ID), row.CompletedAt.UTC().Format(time.RFC3339), formatID(row.OrderID), row.Type, row.Platform,
+					formatID(row.ItemID), row.MarketHashName, strconv.Itoa(row.Quantity), formatAmount(row.Amount),
+					formatAmount(row.Fee), formatAmount(row.CostBasis), formatAmount(row.Profit), row.TradeID,
+				}
+			}
+			return records, rows[len(rows)-1].ID, nil
+		},
+	},
+	KindTaxReport: {
+		header:   taxReportHeader,
+		count:    countTaxSales,
+		batch:    taxReportBatch,
+		validate: validateTaxReport,
+		title: func(p Params) string {
+			return fmt.Sprintf("Realized gains %d (%s cost)", p.Year, p.Method)
+		},
+	},
+}
+
+// priceHistoryQuery 价格历史是公共行情数据，不按用户筛选
+func priceHistoryQuery(db *gorm.DB, p Params) *gorm.DB {
+	query := db.Table("price_histories").Where("price_histories.deleted_at IS NULL")
+	if p.ItemID != 0 {
+		query = query.Where("price_histories.item_id = ?", p.ItemID)
+	}
+	if p.Platform != "" {
+		query = query.Where("price_histories.platform = ?", p.Platform)
+	}
+	if p.From != nil {
+		query = query.Where("price_histories.recorded_at >= ?", *p.From)
+	}
+	if p.To != nil {
+		query = query.Where("price_histories.recorded_at < ?", *p.To)
+	}
+	return query
+}
+
+func transactionQuery(db *gorm.DB, userID uint, p Params) *gorm.DB {
+	query := db.Table("transactions").
+		Joins("LEFT JOIN orders ON orders.id = transactions.order_id").
+		Where("transactions.user_id = ? AND transactions.deleted_at IS NULL", userID)
+	if p.ItemID != 0 {
+		query = query.Where("orders.item_id = ?", p.ItemID)
+	}
+	if p.Platform != "" {
+		query = query.Where("transactions.platform = ?", p.Platform)
+	}
+	if p.From != nil {
+		query = query.Where("transactions.completed_at >= ?", *p.From)
+	}
+	if p.To != nil {
+		query = query.Where("transactions.completed_at < ?", *p.To)
+	}
+	return query
+}
+
+func formatID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
@@ -0,0 +1,205 @@
+package exports
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// 横向A4页面（pt）
+const (
+	pdfPageWidth  = 842
+	pdfPageHeight = 595
+	pdfMargin     = 30
+	pdfMaxColumn  = 40  // 单列最多显示的字符数
+	pdfCharWidth  = 0.6 // Courier字宽与字号之比
+)
+
+// writePDF 把导出的CSV排版为横向A4的等宽字体表格，每页重复表头。
+// 先读一遍CSV计算列宽，再逐页写出，不需要把整个文件读入内存
+func writePDF(w io.Writer, title string, src io.ReadSeeker) error {
+	widths, err := pdfColumnWidths(src)
+	if err != nil {
+		return err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// 按最宽的一行选择字号，仍然放不下时截断超出页宽的部分
+	lineChars := len(widths)*2 - 2
+	for _, width := range widths {
+		lineChars += width
+	}
+	fontSize := min(8, float64(pdfPageWidth-2*pdfMargin)/(float64(max(lineChars, 1))*pdfCharWidth))
+	fontSize = max(fontSize, 4)
+	maxChars := int(float64(pdfPageWidth-2*pdfMargin) / (fontSize * pdfCharWidth))
+	leading := fontSize * 1.3
+	rowsPerPage := int((pdfPageHeight-2*pdfMargin)/leading) - 3 // 标题、表头和分隔线
+
+	doc := newPDFWriter(w)
+	doc.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	doc.object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	r := csv.NewReader(src)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+	headerLine := pdfLine(header, widths, maxChars)
+
+	var pages []int
+	for done := false; !done; {
+		var lines []string
+		for len(lines) < rowsPerPage {
+			record, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				done = true
+				break
+			}
+			if err != nil {
+				return err
+			}
+			lines = append(lines, pdfLine(record, widths, maxChars))
+		}
+		if len(lines) == 0 && len(pages) > 0 {
+			break
+		}
+
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT /F1 %.2f Tf %.2f TL %d %.2f Td\n", fontSize, leading, pdfMargin, pdfPageHeight-pdfMargin-fontSize)
+		fmt.Fprintf(&content, "(%s) Tj\n", pdfEscape(fmt.Sprintf("%s    page %d", title, len(pages)+1)))
+		fmt.Fprintf(&content, "T* (%s) Tj\n", pdfEscape(headerLine))
+		fmt.Fprintf(&content, "T* (%s) Tj\n", pdfEscape(strings.Repeat("-", min(utf8.RuneCountInString(headerLine), maxChars))))
+		for _, line := range lines {
+			fmt.Fprintf(&content, "T* (%s) Tj\n", pdfEscape(line))
+		}
+		content.WriteString("ET")
+
+		page := 4 + 2*len(pages)
+		doc.object(page, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, page+1))
+		doc.object(page+1, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+		pages = append(pages, page)
+	}
+
+	kids := make([]string, len(pages))
+	for i, page := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+	}
+	doc.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	return doc.finish()
+}
+
+// pdfColumnWidths 各列内容的最大字符数，不超过pdfMaxColumn
+func pdfColumnWidths(src io.Reader) ([]int, error) {
+	r := csv.NewReader(src)
+	r.FieldsPerRecord = -1
+	var widths []int
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return widths, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, field := range record {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = min(max(widths[i], utf8.RuneCountInString(field)), pdfMaxColumn)
+		}
+	}
+}
+
+// pdfLine 按列宽对齐一行，超出列宽或页宽的部分截断
+func pdfLine(record []string, widths []int, maxChars int) string {
+	var b strings.Builder
+	for i, field := range record {
+		if i >= len(widths) {
+			break
+		}
+		if i > 0 {
+			b.WriteString("  ")
+		}
+		runes := []rune(field)
+		if len(runes) > widths[i] {
+			runes = runes[:widths[i]]
+		}
+		b.WriteString(string(runes))
+		if i < len(record)-1 {
+			b.WriteString(strings.Repeat(" ", widths[i]-len(runes)))
+		}
+	}
+	line := []rune(b.String())
+	if len(line) > maxChars {
+		line = line[:maxChars]
+	}
+	return string(line)
+}
+
+// pdfEscape 转义字符串中的括号和反斜杠并转换为WinAnsi编码，编码外的字符显示为?
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		case r == '™':
+			b.WriteByte(0x99)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// pdfWriter 顺序写出PDF对象并记录偏移量，最后写出交叉引用表
+type pdfWriter struct {
+	w       io.Writer
+	offset  int
+	offsets map[int]int
+	err     error
+}
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	p := &pdfWriter{w: w, offsets: make(map[int]int)}
+	p.write("%PDF-1.4\n")
+	return p
+}
+
+func (p *pdfWriter) write(s string) {
+	if p.err != nil {
+		return
+	}
+	n, err := io.WriteString(p.w, s)
+	p.offset += n
+	p.err = err
+}
+
+func (p *pdfWriter) object(id int, body string) {
+	p.offsets[id] = p.offset
+	p.write(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", id, body))
+}
+
+func (p *pdfWriter) finish() error {
+	xref := p.offset
+	size := len(p.offsets) + 1
+	p.write(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", size))
+	for id := 1; id < size; id++ {
+		p.write(fmt.Sprintf("%010d 00000 n \n", p.offsets[id]))
+	}
+	p.write(fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, xref))
+	return p.err
+}
@@ -0,0 +1,211 @@
+package exports
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 税务报告的成本计算方式，按所在地区的规定选择
+const (
+	TaxMethodLots    = "lots"    // 个别认定：按卖出时实际匹配的持仓批次（先进先出、后进先出等）计算成本和持有期
+	TaxMethodAverage = "average" // 平均成本：同一物品的全部持仓合并为一个成本池，成本含买入手续费
+)
+
+// transactionQuantity 成交数量，记录成交数量之前的交易按订单数量计算
+const transactionQuantity = "COALESCE(NULLIF(transactions.quantity, 0), orders.quantity)"
+
+var taxReportHeader = []string{
+	"transaction_id", "item_id", "market_hash_name", "platform", "quantity",
+	"acquired_at", "acquisition_price", "disposed_at", "disposal_price",
+	"proceeds", "cost", "fees", "gain", "holding_days",
+}
+
+// validateTaxReport 纳税年度必填，按年度设置时间范围，成本计算方式默认按批次
+func validateTaxReport(p *Params) error {
+	if p.Year < 2000 || p.Year > time.Now().Year() {
+		return fmt.Errorf("year must be between 2000 and %d", time.Now().Year())
+	}
+	switch p.Method {
+	case "":
+		p.Method = TaxMethodLots
+	case TaxMethodLots, TaxMethodAverage:
+	default:
+		return fmt.Errorf("unknown tax method %q, expected %s or %s", p.Method, TaxMethodLots, TaxMethodAverage)
+	}
+	from := time.Date(p.Year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+	p.From, p.To = &from, &to
+	return nil
+}
+
+// taxSale 纳税年度内的一笔卖出
+type taxSale struct {
+	ID             uint
+	CompletedAt    time.Time
+	ItemID         uint
+	MarketHashName string
+	Platform       string
+	Quantity       int
+	Amount         float64
+	Fee            float64
+	CostBasis      float64
+	Lots           *string
+}
+
+// taxLot 卖出时匹配的持仓批次，与交易记录中保存的批次字段一致
+type taxLot struct {
+	Quantity   int       `json:"quantity"`
+	BuyPrice   float64   `json:"buy_price"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+func taxSalesQuery(db *gorm.DB, userID uint, p Params) *gorm.DB {
+	return transactionQuery(db, userID, p).Where("transactions.type = ?", "sell")
+}
+
+func countTaxSales(db *gorm.DB, userID uint, p Params) (int64, error) {
+	var total int64
+	err := taxSalesQuery(db, userID, p).Count(&total).Error
+	return total, err
+}
+
+// taxReportBatch 一批卖出对应的已实现收益明细，按批次计算时一笔卖出按批次拆成多行
+func taxReportBatch(db *gorm.DB, userID uint, p Params, cursor uint, limit int) ([][]string, uint, error) {
+	var sales []taxSale
+	err := taxSalesQuery(db, userID, p).
+		Select("transactions.id, transactions.completed_at, orders.item_id, items.market_hash_name, transactions.platform, "+
+			transactionQuantity+" AS quantity, transactions.amount, transactions.fee, transactions.cost_basis, transactions.lots").
+		Joins("LEFT JOIN items ON items.id = orders.item_id").
+		Where("transactions.id > ?", cursor).
+		Order("transactions.id").
+		Limit(limit).
+		Scan(&sales).Error
+	if err != nil || len(sales) == 0 {
+		return nil, cursor, err
+	}
+
+	var averages map[uint]float64
+	if p.Method == TaxMethodAverage {
+		if averages, err = averageCosts(db, userID, sales); err != nil {
+			return nil, cursor, err
+		}
+	}
+
+	var records [][]string
+	for _, sale := range sales {
+		quantity := max(sale.Quantity, 1)
+		var lots []taxLot
+		if p.Method == TaxMethodLots && sale.Lots != nil {
+			if err := json.Unmarshal([]byte(*sale.Lots), &lots); err != nil {
+				return nil, cursor, fmt.Errorf("transaction %d has invalid lots: %w", sale.ID, err)
+			}
+		}
+		if len(lots) == 0 {
+			// 平均成本法或没有批次记录的卖出：整笔一行，没有单独的买入日期
+			cost := sale.CostBasis
+			if avg, ok := averages[sale.ID]; ok {
+				cost = avg * float64(quantity)
+			}
+			records = append(records, taxRecord(sale, quantity, nil, cost/float64(quantity)))
+			continue
+		}
+		covered := 0
+		for _, lot := range lots {
+			acquiredAt := lot.AcquiredAt
+			records = append(records, taxRecord(sale, lot.Quantity, &acquiredAt, lot.BuyPrice))
+			covered += lot.Quantity
+		}
+		if remainder := quantity - covered; remainder > 0 {
+			// 批次未覆盖的数量按交易记录的成本单独一行，保证卖出金额全部计入
+			records = append(records, taxRecord(sale, remainder, nil, sale.CostBasis/float64(quantity)))
+		}
+	}
+	return records, sales[len(sales)-1].ID, nil
+}
+
+// taxRecord 卖出中quantity件的收益，卖出金额和手续费按数量分摊
+func taxRecord(sale taxSale, quantity int, acquiredAt *time.Time, unitCost float64) []string {
+	share := float64(quantity) / float64(max(sale.Quantity, 1))
+	proceeds := sale.Amount * share
+	fees := sale.Fee * share
+	cost := unitCost * float64(quantity)
+
+	acquired, holding := "", ""
+	if acquiredAt != nil && !acquiredAt.IsZero() {
+		acquired = acquiredAt.UTC().Format(time.RFC3339)
+		holding = strconv.Itoa(int(sale.CompletedAt.Sub(*acquiredAt).Hours() / 24))
+	}
+	return []string{
+		formatID(sale.ID), formatID(sale.ItemID), sale.MarketHashName, sale.Platform, strconv.Itoa(quantity),
+		acquired, formatAmount(unitCost), sale.CompletedAt.UTC().Format(time.RFC3339), formatAmount(proceeds / float64(quantity)),
+		formatAmount(proceeds), formatAmount(cost), formatAmount(fees), formatAmount(proceeds - cost - fees), holding,
+	}
+}
+
+// averageCosts 按交易顺序重放这批卖出所涉及物品的全部买卖，得到每笔卖出时成本池的平均单位成本。
+// 买入成本含手续费，卖出按平均成本减少成本池，清仓后重新计算
+func averageCosts(db *gorm.DB, userID uint, sales []taxSale) (map[uint]float64, error) {
+	itemIDs := make([]uint, 0, len(sales))
+	inBatch := make(map[uint]bool, len(sales))
+	for _, sale := range sales {
+		itemIDs = append(itemIDs, sale.ItemID)
+		inBatch[sale.ID] = true
+	}
+
+	var trades []struct {
+		ID       uint
+		Type     string
+		ItemID   uint
+		Quantity int
+		Amount   float64
+		Fee      float64
+	}
+	err := db.Table("transactions").
+		Joins("LEFT JOIN orders ON orders.id = transactions.order_id").
+		Select("transactions.id, transactions.type, orders.item_id, "+transactionQuantity+" AS quantity, transactions.amount, transactions.fee").
+		Where("transactions.user_id = ? AND transactions.deleted_at IS NULL AND orders.item_id IN ? AND transactions.id <= ?",
+			userID, itemIDs, sales[len(sales)-1].ID).
+		Order("transactions.id").
+		Scan(&trades).Error
+	if err != nil {
+		return nil, err
+	}
+
+	type pool struct {
+		quantity int
+		cost     float64
+	}
+	pools := make(map[uint]*pool)
+	averages := make(map[uint]float64, len(sales))
+	for _, trade := range trades {
+		p := pools[trade.ItemID]
+		if p == nil {
+			p = &pool{}
+			pools[trade.ItemID] = p
+		}
+		if trade.Type == "buy" {
+			p.quantity += trade.Quantity
+			p.cost += trade.Amount + trade.Fee
+			continue
+		}
+		if p.quantity <= 0 {
+			// 没有可追溯的买入（如管理员调整的库存），沿用交易记录的成本
+			continue
+		}
+		avg := p.cost / float64(p.quantity)
+		if inBatch[trade.ID] {
+			averages[trade.ID] = avg
+		}
+		if p.quantity <= trade.Quantity {
+			*p = pool{}
+		} else {
+			p.quantity -= trade.Quantity
+			p.cost -= avg * float64(trade.Quantity)
+		}
+	}
+	return averages, nil
+}
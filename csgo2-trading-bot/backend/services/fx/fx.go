@@ -0,0 +1,211 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+)
+
+const cacheKey = "fx:rates"
+
+// Rates 汇率快照，Rates中的值为1单位外币折合多少本位币
+type Rates struct {
+	Base      string             `json:"base"`
+	Rates     map[string]float64 `json:"rates"`
+	Source    string             `json:"source"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// Service 汇率服务：定期从数据源刷新并缓存到Redis，供各平台价格统一换算为本位币
+type Service struct {
+	base     string
+	provider Provider
+	fallback map[string]float64
+	cache    *database.Cache
+	refresh  time.Duration
+
+	mu    sync.RWMutex
+	rates Rates
+}
+
+// NewService 创建汇率服务，fallback为配置中的固定汇率，数据源不可用时使用
+func NewService(cfg config.FXConfig, base string, fallback map[string]float64, cache *database.Cache, provider Provider) *Service {
+	base = strings.ToUpper(base)
+	normalized := normalize(fallback)
+
+	refresh := time.Duration(cfg.Refresh) * time.Second
+	if refresh <= 0 {
+		refresh = time.Hour
+	}
+
+	return &Service{
+		base:     base,
+		provider: provider,
+		fallback: normalized,
+		cache:    cache,
+		refresh:  refresh,
+		rates: Rates{
+			Base:   base,
+			Rates:  normalized,
+			Source: "config",
+		},
+	}
+}
+
+// Start 加载缓存的汇率，立即刷新一次并注册定期刷新任务
+func (s *Service) Start(sched *scheduler.Scheduler) error {
+	s.loadCached()
+	if err := s.Refresh(); err != nil {
+		logrus.Warnf("FX refresh failed, using %s rates: %v", s.Snapshot().Source, err)
+	}
+
+	return sched.Add(scheduler.Job{
+		ID:   "fx_refresh",
+		Spec: s.refresh.String(),
+		Run: func() {
+			if err := s.Refresh(); err != nil {
+				logrus.Warnf("FX refresh failed: %v", err)
+			}
+		},
+	})
+}
+
+// Refresh 从数据源获取最新汇率。其他实例刚刷新过时直接使用Redis中的结果
+func (s *Service) Refresh() error {
+	if s.loadCached() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	rates, err := s.provider.Rates(ctx, s.base)
+	if err != nil {
+		return err
+	}
+
+	snapshot := Rates{
+		Base:      s.base,
+		Rates:     normalize(rates),
+		Source:    s.provider.Name(),
+		UpdatedAt: time.Now(),
+	}
+	// 数据源未覆盖的币种保留固定汇率
+	for code, rate := range s.fallback {
+		if _, ok := snapshot.Rates[code]; !ok {
+			snapshot.Rates[code] = rate
+		}
+	}
+	s.set(snapshot)
+
+	if data, err := json.Marshal(snapshot); err == nil {
+		s.cache.Set(ctx, cacheKey, data, 2*s.refresh)
+	}
+	return nil
+}
+
+// loadCached 读取Redis中未过期的汇率，返回是否足够新
+func (s *Service) loadCached() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	data, err := s.cache.Get(ctx, cacheKey)
+	if err != nil {
+		return false
+	}
+
+	var snapshot Rates
+	if err := json.Unmarshal([]byte(data), &snapshot); err != nil || snapshot.Base != s.base {
+		return false
+	}
+	s.set(snapshot)
+	return time.Since(snapshot.UpdatedAt) < s.refresh
+}
+
+func (s *Service) set(snapshot Rates) {
+	s.mu.Lock()
+	s.rates = snapshot
+	s.mu.Unlock()
+}
+
+// Snapshot 当前使用的汇率
+func (s *Service) Snapshot() Rates {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rates := make(map[string]float64, len(s.rates.Rates))
+	for code, rate := range s.rates.Rates {
+		rates[code] = rate
+	}
+	snapshot := s.rates
+	snapshot.Rates = rates
+	return snapshot
+}
+
+// Base 本位币
+func (s *Service) Base() string {
+	return s.base
+}
+
+// Rate 1单位外币折合多少本位币
+func (s *Service) Rate(currency string) (float64, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == s.base {
+		return 1, nil
+	}
+
+	s.mu.RLock()
+	rate, ok := s.rates.Rates[currency]
+	s.mu.RUnlock()
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("no exchange rate for %s", currency)
+	}
+	return rate, nil
+}
+
+// ToBase 外币金额换算为本位币
+func (s *Service) ToBase(amount float64, currency string) (float64, error) {
+	rate, err := s.Rate(currency)
+	if err != nil {
+		return 0, err
+	}
+	return amount * rate, nil
+}
+
+// FromBase 本位币金额换算为外币
+func (s *Service) FromBase(amount float64, currency string) (float64, error) {
+	rate, err := s.Rate(currency)
+	if err != nil {
+		return 0, err
+	}
+	return amount / rate, nil
+}
+
+// Convert 任意两种币种之间换算
+func (s *Service) Convert(amount float64, from, to string) (float64, error) {
+	base, err := s.ToBase(amount, from)
+	if err != nil {
+		return 0, err
+	}
+	return s.FromBase(base, to)
+}
+
+// normalize 币种代码统一为大写（viper会把map的键转换为小写）
+func normalize(rates map[string]float64) map[string]float64 {
+	normalized := make(map[string]float64, len(rates))
+	for code, rate := range rates {
+		if rate > 0 {
+			normalized[strings.ToUpper(code)] = rate
+		}
+	}
+	return normalized
+}
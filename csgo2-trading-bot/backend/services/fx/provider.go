@@ -0,0 +1,86 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"csgo2-trading-bot/config"
+)
+
+// Provider 汇率数据源
+type Provider interface {
+	Name() string
+	// Rates 返回1单位外币折合多少本位币
+	Rates(ctx context.Context, base string) (map[string]float64, error)
+}
+
+// NewProvider 按配置创建数据源
+func NewProvider(cfg config.FXConfig, fallback map[string]float64, httpClient *http.Client) (Provider, error) {
+	switch cfg.Provider {
+	case "", "static":
+		return StaticProvider(fallback), nil
+	case "exchangerate":
+		return &ExchangeRateProvider{URL: cfg.URL, HTTP: httpClient}, nil
+	default:
+		return nil, fmt.Errorf("unknown fx provider: %s", cfg.Provider)
+	}
+}
+
+// StaticProvider 使用配置中的固定汇率
+type StaticProvider map[string]float64
+
+func (p StaticProvider) Name() string {
+	return "static"
+}
+
+func (p StaticProvider) Rates(ctx context.Context, base string) (map[string]float64, error) {
+	return map[string]float64(p), nil
+}
+
+// ExchangeRateProvider open.er-api.com格式的汇率接口，返回1单位本位币折合多少外币
+type ExchangeRateProvider struct {
+	URL  string
+	HTTP *http.Client
+}
+
+func (p *ExchangeRateProvider) Name() string {
+	return "exchangerate"
+}
+
+func (p *ExchangeRateProvider) Rates(ctx context.Context, base string) (map[string]float64, error) {
+	endpoint := strings.TrimRight(p.URL, "/") + "/" + base
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Result   string             `json:"result"`
+		BaseCode string             `json:"base_code"`
+		Rates    map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("invalid fx response (HTTP %d): %v", resp.StatusCode, err)
+	}
+	if data.Result != "success" || !strings.EqualFold(data.BaseCode, base) {
+		return nil, fmt.Errorf("fx provider returned %q for base %s", data.Result, base)
+	}
+
+	// 转换为1单位外币折合多少本位币
+	rates := make(map[string]float64, len(data.Rates))
+	for code, rate := range data.Rates {
+		if rate > 0 {
+			rates[code] = 1 / rate
+		}
+	}
+	return rates, nil
+}
@@ -0,0 +1,246 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"csgo2-trading-bot/config"
+)
+
+// Priority 请求在平台预算中的排队优先级，高优先级的请求先取得令牌
+type Priority int
+
+const (
+	PriorityBackground Priority = iota // 定时采集等批量请求
+	PriorityNormal                     // 用户触发的查询等，未指定时的默认值
+	PriorityTrade                      // 下单、上架、交易报价等交易请求
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityBackground:
+		return "background"
+	case PriorityTrade:
+		return "trade"
+	}
+	return "normal"
+}
+
+// ErrQueueFull 平台预算的排队请求已达上限
+var ErrQueueFull = errors.New("request budget queue is full")
+
+type priorityKey struct{}
+type reservationKey struct{}
+
+// WithPriority 为ctx上发出的请求指定排队优先级
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func priorityOf(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+// reservation 通过Budget.Reserve提前取得的令牌，由随后发出的第一个请求使用
+type reservation struct {
+	used atomic.Bool
+}
+
+// BudgetStats 平台预算的当前状态
+type BudgetStats struct {
+	Rate    float64          `json:"rate"` // 每秒请求数
+	Burst   int              `json:"burst"`
+	Tokens  float64          `json:"tokens"`
+	Queued  map[string]int   `json:"queued"` // 按优先级统计的排队请求数
+	Waited  map[string]int64 `json:"waited"` // 按优先级统计的排队过的请求数
+	AvgWait float64          `json:"avg_wait_ms"`
+}
+
+// Budget 一个平台的请求预算：令牌桶限制速率，取不到令牌的请求按优先级排队，同优先级先到先得
+type Budget struct {
+	platform string
+	rate     float64 // 每秒补充的令牌数
+	burst    float64
+	maxQueue int
+
+	mu          sync.Mutex
+	tokens      float64
+	last        time.Time
+	queues      [PriorityTrade + 1][]*waiter
+	dispatching bool
+	waited      [PriorityTrade + 1]int64
+	waitNanos   int64
+}
+
+type waiter struct {
+	ready chan struct{}
+}
+
+func newBudget(platform string, cfg config.BudgetConfig) *Budget {
+	burst := max(cfg.Burst, 1)
+	return &Budget{
+		platform: platform,
+		rate:     float64(cfg.Requests) / float64(cfg.Per),
+		burst:    float64(burst),
+		maxQueue: cfg.MaxQueue,
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// Reserve 发出请求前按优先级排队取得令牌，返回的ctx上发出的下一个请求直接使用该令牌。
+// 排队时间不计入客户端超时，适合可能排队较久的批量采集；b为nil时不限制
+func (b *Budget) Reserve(ctx context.Context, priority Priority) (context.Context, error) {
+	if b == nil {
+		return ctx, nil
+	}
+	if err := b.wait(ctx, priority); err != nil {
+		return ctx, err
+	}
+	return context.WithValue(WithPriority(ctx, priority), reservationKey{}, &reservation{}), nil
+}
+
+// acquire 请求发出前调用，ctx上有未使用的预留令牌时直接使用
+func (b *Budget) acquire(ctx context.Context) error {
+	if r, ok := ctx.Value(reservationKey{}).(*reservation); ok && r.used.CompareAndSwap(false, true) {
+		return nil
+	}
+	return b.wait(ctx, priorityOf(ctx))
+}
+
+func (b *Budget) wait(ctx context.Context, priority Priority) error {
+	b.mu.Lock()
+	b.refill(time.Now())
+	if b.tokens >= 1 && b.queued() == 0 {
+		b.tokens--
+		b.mu.Unlock()
+		return nil
+	}
+	if b.maxQueue > 0 && b.queued() >= b.maxQueue && priority < PriorityTrade {
+		b.mu.Unlock()
+		return fmt.Errorf("%s: %w", b.platform, ErrQueueFull)
+	}
+	w := &waiter{ready: make(chan struct{})}
+	b.queues[priority] = append(b.queues[priority], w)
+	b.waited[priority]++
+	if !b.dispatching {
+		b.dispatching = true
+		go b.dispatch()
+	}
+	b.mu.Unlock()
+
+	start := time.Now()
+	defer func() {
+		b.mu.Lock()
+		b.waitNanos += int64(time.Since(start))
+		b.mu.Unlock()
+	}()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if !b.remove(priority, w) {
+			// 令牌已经发给了这个请求，退回给其他请求
+			b.tokens = min(b.tokens+1, b.burst)
+		}
+		return ctx.Err()
+	}
+}
+
+// dispatch 按令牌补充的速度依次放行排队的请求，队列清空后退出
+func (b *Budget) dispatch() {
+	for {
+		b.mu.Lock()
+		b.refill(time.Now())
+		for b.tokens >= 1 {
+			w := b.pop()
+			if w == nil {
+				break
+			}
+			b.tokens--
+			close(w.ready)
+		}
+		if b.queued() == 0 {
+			b.dispatching = false
+			b.mu.Unlock()
+			return
+		}
+		next := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		time.Sleep(max(next, time.Millisecond))
+	}
+}
+
+// refill 调用方需持有mu
+func (b *Budget) refill(now time.Time) {
+	b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.burst)
+	b.last = now
+}
+
+// pop 取出优先级最高、最早排队的请求，调用方需持有mu
+func (b *Budget) pop() *waiter {
+	for p := len(b.queues) - 1; p >= 0; p-- {
+		if len(b.queues[p]) > 0 {
+			w := b.queues[p][0]
+			b.queues[p] = b.queues[p][1:]
+			return w
+		}
+	}
+	return nil
+}
+
+// remove 移除放弃排队的请求，返回false表示已被放行，调用方需持有mu
+func (b *Budget) remove(priority Priority, w *waiter) bool {
+	queue := b.queues[priority]
+	for i := range queue {
+		if queue[i] == w {
+			b.queues[priority] = append(queue[:i:i], queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Budget) queued() int {
+	n := 0
+	for _, queue := range b.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+// Stats 当前令牌数和排队情况
+func (b *Budget) Stats() BudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+
+	stats := BudgetStats{
+		Rate:   b.rate,
+		Burst:  int(b.burst),
+		Tokens: b.tokens,
+		Queued: make(map[string]int, len(b.queues)),
+		Waited: make(map[string]int64, len(b.queues)),
+	}
+	var waited int64
+	for p := range b.queues {
+		name := Priority(p).String()
+		stats.Queued[name] = len(b.queues[p])
+		stats.Waited[name] = b.waited[p]
+		waited += b.waited[p]
+	}
+	if waited > 0 {
+		stats.AvgWait = float64(b.waitNanos) / float64(waited) / float64(time.Millisecond)
+	}
+	return stats
+}
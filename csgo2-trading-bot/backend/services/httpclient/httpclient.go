@@ -0,0 +1,430 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"csgo2-trading-bot/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Stats 某平台的出站请求统计
+type Stats struct {
+	Requests     int64   `json:"requests"`
+	Errors       int64   `json:"errors"`
+	ServerErrors int64   `json:"server_errors"`
+	Retries      int64   `json:"retries"`        // 重试次数，已计入Requests
+	GaveUp       int64   `json:"gave_up"`        // 重试次数用完仍失败的请求数
+	AvgLatencyMs float64 `json:"avg_latency_ms"` // 单次请求的平均耗时，不含重试等待
+
+	Budget *BudgetStats `json:"budget,omitempty"` // 配置了请求预算的平台
+}
+
+type counters struct {
+	requests     atomic.Int64
+	errors       atomic.Int64
+	serverErrors atomic.Int64
+	retries      atomic.Int64
+	gaveUp       atomic.Int64
+	latencyNanos atomic.Int64
+}
+
+// ProxySource 为每个请求选择代理并接收请求结果，返回nil表示直连
+type ProxySource interface {
+	Acquire() (*url.URL, error)
+	Report(proxy *url.URL, resp *http.Response, err error)
+}
+
+type proxyKey struct{}
+
+// SessionSource 为请求附加登录Cookie，并从响应中获取平台新下发的Cookie和登录失效信号
+type SessionSource interface {
+	Apply(req *http.Request)
+	Observe(resp *http.Response)
+}
+
+// Factory 所有出站HTTP请求共用一个连接池，按平台区分超时、重试、代理、请求预算和统计
+type Factory struct {
+	config    config.HTTPClientConfig
+	transport *http.Transport
+	budgets   map[string]*Budget // 启动时创建，之后只读
+
+	mu       sync.Mutex
+	clients  map[string]*http.Client
+	counters map[string]*counters
+	proxies  map[string]ProxySource
+	sessions map[string]SessionSource
+	public   map[string]bool
+	hooks    []func(platform string)
+}
+
+func New(cfg config.HTTPClientConfig) *Factory {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	dial := dialer.DialContext
+	if cfg.DNSCacheTTL > 0 {
+		dial = newDNSCache(time.Duration(cfg.DNSCacheTTL) * time.Second).dialContext(dialer)
+	}
+
+	maxIdle := cfg.MaxIdleConnsPerHost
+	if maxIdle <= 0 {
+		maxIdle = 16
+	}
+
+	budgets := make(map[string]*Budget, len(cfg.Budgets))
+	for platform, budget := range cfg.Budgets {
+		if budget.Requests > 0 && budget.Per > 0 {
+			budgets[platform] = newBudget(platform, budget)
+		}
+	}
+
+	return &Factory{
+		config:  cfg,
+		budgets: budgets,
+		transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dial,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          maxIdle * 8,
+			MaxIdleConnsPerHost:   maxIdle,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+		},
+		clients:  make(map[string]*http.Client),
+		counters: make(map[string]*counters),
+		proxies:  make(map[string]ProxySource),
+		sessions: make(map[string]SessionSource),
+		public:   make(map[string]bool),
+	}
+}
+
+// UseProxies 该平台的请求通过source选择的代理发出，需在首次获取该平台客户端之前调用
+func (f *Factory) UseProxies(platform string, source ProxySource) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.clients[platform]; ok {
+		logrus.Warnf("Proxy pool for %s registered after its client was created and will not be used", platform)
+	}
+	f.proxies[platform] = source
+}
+
+// UseSession 该平台的请求携带source管理的登录Cookie，需在首次获取该平台客户端之前调用
+func (f *Factory) UseSession(platform string, source SessionSource) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.clients[platform]; ok {
+		logrus.Warnf("Session for %s registered after its client was created and will not be used", platform)
+	}
+	f.sessions[platform] = source
+}
+
+// PublicOnly 该客户端只连接公网地址，用于请求用户指定的地址（如Webhook），需在首次获取该客户端之前调用。
+// 每次建立连接时检查实际连接的地址，不使用环境变量中的代理
+func (f *Factory) PublicOnly(platform string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.clients[platform]; ok {
+		logrus.Warnf("Public-only restriction for %s registered after its client was created and will not be used", platform)
+	}
+	f.public[platform] = true
+}
+
+// Budget 平台的请求预算，未配置时返回nil。该平台客户端发出的请求都会先取得令牌，
+// 批量调用方可以先用Reserve排队，避免排队时间占用请求超时
+func (f *Factory) Budget(platform string) *Budget {
+	return f.budgets[platform]
+}
+
+// Client 获取指定平台的客户端，同一平台复用同一实例
+func (f *Factory) Client(platform string) *http.Client {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if client, ok := f.clients[platform]; ok {
+		return client
+	}
+
+	timeout := f.config.Timeout
+	if t, ok := f.config.PlatformTimeouts[platform]; ok && t > 0 {
+		timeout = t
+	}
+
+	// 使用代理池的平台单独一个连接池，代理地址由请求上下文决定
+	var transport http.RoundTripper = f.transport
+	proxies := f.proxies[platform]
+	if proxies != nil {
+		proxied := f.transport.Clone()
+		proxied.Proxy = func(req *http.Request) (*url.URL, error) {
+			proxy, _ := req.Context().Value(proxyKey{}).(*url.URL)
+			return proxy, nil
+		}
+		transport = proxied
+	} else if f.public[platform] {
+		restricted := f.transport.Clone()
+		restricted.Proxy = nil
+		restricted.DialContext = publicOnlyDialer().DialContext
+		transport = restricted
+	}
+
+	c := &counters{}
+	f.counters[platform] = c
+	client := &http.Client{
+		// 超时包含重试及其等待的时间
+		Timeout: time.Duration(timeout) * time.Second,
+		Transport: &roundTripper{
+			next:      transport,
+			proxies:   proxies,
+			session:   f.sessions[platform],
+			budget:    f.budgets[platform],
+			platform:  platform,
+			userAgent: f.config.UserAgent,
+			slow:      time.Duration(f.config.SlowThreshold) * time.Millisecond,
+			retry:     newRetryPolicy(f.config.Retry, platform),
+			counters:  c,
+			observe:   f.observe,
+		},
+	}
+	f.clients[platform] = client
+	return client
+}
+
+// OnRequest 注册出站请求回调，每个请求发出前同步调用，回调不应阻塞
+func (f *Factory) OnRequest(fn func(platform string)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hooks = append(f.hooks, fn)
+}
+
+func (f *Factory) observe(platform string) {
+	f.mu.Lock()
+	hooks := f.hooks
+	f.mu.Unlock()
+	for _, fn := range hooks {
+		fn(platform)
+	}
+}
+
+// Transport 共享的底层连接池，供需要自定义客户端的第三方库使用
+func (f *Factory) Transport() *http.Transport {
+	return f.transport
+}
+
+// Stats 各平台出站请求统计
+func (f *Factory) Stats() map[string]Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := make(map[string]Stats, len(f.counters))
+	for platform, c := range f.counters {
+		s := Stats{
+			Requests:     c.requests.Load(),
+			Errors:       c.errors.Load(),
+			ServerErrors: c.serverErrors.Load(),
+			Retries:      c.retries.Load(),
+			GaveUp:       c.gaveUp.Load(),
+		}
+		if s.Requests > 0 {
+			s.AvgLatencyMs = float64(c.latencyNanos.Load()) / float64(s.Requests) / float64(time.Millisecond)
+		}
+		if budget := f.budgets[platform]; budget != nil {
+			bs := budget.Stats()
+			s.Budget = &bs
+		}
+		stats[platform] = s
+	}
+	return stats
+}
+
+// roundTripper 统一设置请求头，按重试策略重发失败的请求，并记录耗时和错误
+type roundTripper struct {
+	next      http.RoundTripper
+	proxies   ProxySource
+	session   SessionSource
+	budget    *Budget
+	platform  string
+	userAgent string
+	slow      time.Duration
+	retry     retryPolicy
+	counters  *counters
+	observe   func(platform string)
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrip不应修改调用方的请求
+	req = req.Clone(req.Context())
+	if req.Header.Get("User-Agent") == "" && rt.userAgent != "" {
+		req.Header.Set("User-Agent", rt.userAgent)
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	if rt.session != nil {
+		rt.session.Apply(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := rt.send(req)
+		if attempt >= rt.retry.attempts || !rt.retry.retryable(req, resp, err) {
+			if attempt > 1 && (err != nil || rt.retry.statuses[resp.StatusCode]) {
+				rt.counters.gaveUp.Add(1)
+			}
+			return resp, err
+		}
+
+		wait := rt.retry.delay(attempt, resp)
+		next, rewindErr := rewind(req)
+		if rewindErr != nil {
+			return resp, err
+		}
+		if resp != nil {
+			logrus.Debugf("%s request %s %s%s returned %s, retrying in %s", rt.platform, req.Method, req.URL.Host, req.URL.Path, resp.Status, wait)
+			discard(resp)
+		} else {
+			logrus.Debugf("%s request %s %s%s failed, retrying in %s: %v", rt.platform, req.Method, req.URL.Host, req.URL.Path, wait, err)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		rt.counters.retries.Add(1)
+		req = next
+	}
+}
+
+// send 取得请求预算后发送一次请求并记录统计，使用代理池时每次尝试重新选择代理
+func (rt *roundTripper) send(req *http.Request) (*http.Response, error) {
+	if rt.budget != nil {
+		if err := rt.budget.acquire(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+
+	var proxy *url.URL
+	if rt.proxies != nil {
+		var err error
+		if proxy, err = rt.proxies.Acquire(); err != nil {
+			return nil, fmt.Errorf("%s: %w", rt.platform, err)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), proxyKey{}, proxy))
+	}
+
+	rt.observe(rt.platform)
+
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	if rt.proxies != nil && req.Context().Err() == nil {
+		rt.proxies.Report(proxy, resp, err)
+	}
+
+	rt.counters.requests.Add(1)
+	rt.counters.latencyNanos.Add(int64(elapsed))
+	if err != nil {
+		rt.counters.errors.Add(1)
+		logrus.Warnf("%s request %s %s failed after %s: %v", rt.platform, req.Method, req.URL.Host, elapsed, err)
+		return nil, err
+	}
+	if resp.StatusCode >= 500 {
+		rt.counters.serverErrors.Add(1)
+	}
+	if rt.session != nil {
+		rt.session.Observe(resp)
+	}
+	if rt.slow > 0 && elapsed > rt.slow {
+		logrus.Warnf("Slow %s request %s %s%s took %s", rt.platform, req.Method, req.URL.Host, req.URL.Path, elapsed)
+	}
+	return resp, nil
+}
+
+// dnsCache 缓存域名解析结果，多个地址时随机选择以分散连接
+type dnsCache struct {
+	ttl      time.Duration
+	resolver *net.Resolver
+
+	mu      sync.RWMutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:      ttl,
+		resolver: net.DefaultResolver,
+		entries:  make(map[string]dnsEntry),
+	}
+}
+
+func (d *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	d.mu.RLock()
+	entry, ok := d.entries[host]
+	d.mu.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := d.resolver.LookupHost(ctx, host)
+	if err != nil {
+		// 解析失败时继续使用过期结果
+		if ok {
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(d.ttl)}
+	d.mu.Unlock()
+	return addrs, nil
+}
+
+func (d *dnsCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		addrs, err := d.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no addresses for %s", host)
+		}
+
+		// 从随机位置开始依次尝试
+		offset := rand.Intn(len(addrs))
+		var lastErr error
+		for i := range addrs {
+			ip := addrs[(offset+i)%len(addrs)]
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, fmt.Errorf("dial %s: %v", host, lastErr)
+	}
+}
@@ -0,0 +1,109 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"csgo2-trading-bot/config"
+)
+
+// retryPolicy 某平台的重试策略
+type retryPolicy struct {
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	statuses  map[int]bool
+}
+
+func newRetryPolicy(cfg config.RetryConfig, platform string) retryPolicy {
+	attempts := cfg.Attempts
+	if n, ok := cfg.Platforms[platform]; ok {
+		attempts = n
+	}
+	policy := retryPolicy{
+		attempts:  max(attempts, 1),
+		baseDelay: time.Duration(cfg.BaseDelay) * time.Millisecond,
+		maxDelay:  time.Duration(cfg.MaxDelay) * time.Millisecond,
+		statuses:  make(map[int]bool, len(cfg.StatusCodes)),
+	}
+	for _, code := range cfg.StatusCodes {
+		policy.statuses[code] = true
+	}
+	return policy
+}
+
+// retryable 判断失败的请求能否再次发送。幂等方法总是可以重试；
+// 非幂等方法只在连接未建立（请求没有发出）或调用方提供了Idempotency-Key时重试，避免重复下单
+func (p retryPolicy) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if err != nil {
+		if req.Context().Err() != nil {
+			return false
+		}
+		return idempotent(req) || notSent(err)
+	}
+	return p.statuses[resp.StatusCode] && idempotent(req)
+}
+
+// delay 第attempt次重试前的等待：在0到base*2^(attempt-1)之间随机（full jitter），
+// 响应带Retry-After时按其等待，均不超过maxDelay
+func (p retryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, p.maxDelay)
+		}
+	}
+	ceiling := p.baseDelay << (attempt - 1)
+	if ceiling <= 0 || ceiling > p.maxDelay {
+		ceiling = p.maxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// notSent 建立连接阶段的错误，请求一定没有到达服务端
+func notSent(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// rewind 为重试准备一个新的请求体
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = body
+	return req, nil
+}
+
+// discard 读完并关闭不再使用的响应，使连接可以复用
+func discard(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
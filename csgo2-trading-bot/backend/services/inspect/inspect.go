@@ -0,0 +1,240 @@
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound 库存不存在或不属于当前用户
+	ErrNotFound = errors.New("inventory not found")
+	// ErrInvalidLink 不是CS2的检视链接
+	ErrInvalidLink = errors.New("invalid inspect link")
+	// ErrDisabled 未配置检视服务
+	ErrDisabled = errors.New("inspect service is not enabled")
+	// ErrRejected 检视服务无法解析该链接，如物品已不在原库存中
+	ErrRejected = errors.New("inspect service rejected link")
+)
+
+// Result 检视结果
+type Result struct {
+	FloatValue float64 `json:"float_value"`
+	PaintSeed  int     `json:"paint_seed"`
+	PaintIndex int     `json:"paint_index"`
+	DefIndex   int     `json:"def_index"`
+	MinFloat   float64 `json:"min_float"`
+	MaxFloat   float64 `json:"max_float"`
+	Name       string  `json:"name,omitempty"`
+}
+
+type inspectResponse struct {
+	ItemInfo *struct {
+		FloatValue   float64 `json:"floatvalue"`
+		PaintSeed    int     `json:"paintseed"`
+		PaintIndex   int     `json:"paintindex"`
+		DefIndex     int     `json:"defindex"`
+		Min          float64 `json:"min"`
+		Max          float64 `json:"max"`
+		FullItemName string  `json:"full_item_name"`
+	} `json:"iteminfo"`
+	Error string `json:"error"`
+}
+
+// Service 通过检视服务解析检视链接，补全库存物品的磨损值和图案模板
+type Service struct {
+	db     *gorm.DB
+	cache  *database.Cache
+	http   *http.Client
+	config config.InspectConfig
+	ctx    context.Context
+}
+
+func NewService(db *gorm.DB, cache *database.Cache, httpClient *http.Client, cfg config.InspectConfig) *Service {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+	return &Service{
+		db:     db,
+		cache:  cache,
+		http:   httpClient,
+		config: cfg,
+		ctx:    context.Background(),
+	}
+}
+
+// Start 注册库存检视补全任务
+func (s *Service) Start(sched *scheduler.Scheduler) error {
+	return sched.Add(scheduler.Job{
+		ID:   "inspect_enrich",
+		Spec: (time.Duration(s.config.Interval) * time.Second).String(),
+		Run:  s.enrich,
+	})
+}
+
+// Resolve 解析检视链接，结果按链接缓存
+func (s *Service) Resolve(ctx context.Context, link string) (*Result, error) {
+	if !s.config.Enabled {
+		return nil, ErrDisabled
+	}
+	link = strings.TrimSpace(link)
+	if !validLink(link) {
+		return nil, ErrInvalidLink
+	}
+
+	key := "inspect:" + link
+	if cached, err := s.cache.Get(ctx, key); err == nil {
+		var result Result
+		if json.Unmarshal([]byte(cached), &result) == nil {
+			return &result, nil
+		}
+	}
+
+	endpoint := s.config.URL + "?url=" + url.QueryEscape(link)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.config.APIKey != "" {
+		req.Header.Set("Authorization", s.config.APIKey)
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body inspectResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("inspect service returned status %d", resp.StatusCode)
+	}
+	if body.Error != "" {
+		return nil, fmt.Errorf("%w: %s", ErrRejected, body.Error)
+	}
+	if resp.StatusCode != http.StatusOK || body.ItemInfo == nil {
+		return nil, fmt.Errorf("inspect service returned status %d", resp.StatusCode)
+	}
+
+	info := body.ItemInfo
+	result := &Result{
+		FloatValue: info.FloatValue,
+		PaintSeed:  info.PaintSeed,
+		PaintIndex: info.PaintIndex,
+		DefIndex:   info.DefIndex,
+		MinFloat:   info.Min,
+		MaxFloat:   info.Max,
+		Name:       info.FullItemName,
+	}
+	if data, err := json.Marshal(result); err == nil {
+		s.cache.Set(ctx, key, string(data), time.Duration(s.config.CacheTTL)*time.Second)
+	}
+	return result, nil
+}
+
+// InspectInventory 设置库存物品的检视链接并立即解析，link为空时使用已保存的链接
+func (s *Service) InspectInventory(ctx context.Context, inventoryID, userID uint, link string) (*models.Inventory, error) {
+	var inventory models.Inventory
+	if err := s.db.Where("id = ? AND user_id = ?", inventoryID, userID).First(&inventory).Error; err != nil {
+		return nil, ErrNotFound
+	}
+
+	if link != "" {
+		if !validLink(link) {
+			return nil, ErrInvalidLink
+		}
+		inventory.InspectLink = strings.TrimSpace(link)
+	}
+	if inventory.InspectLink == "" {
+		return nil, ErrInvalidLink
+	}
+
+	result, err := s.Resolve(ctx, inventory.InspectLink)
+	if err != nil {
+		// 链接仍然保存，由后台任务稍后重试
+		inventory.InspectedAt = nil
+		inventory.InspectError = ""
+		s.db.Model(&inventory).Select("inspect_link", "inspected_at", "inspect_error").Updates(&inventory)
+		return nil, err
+	}
+	if err := s.apply(&inventory, result); err != nil {
+		return nil, err
+	}
+	return &inventory, nil
+}
+
+// enrich 批量补全有检视链接但尚未解析的库存
+func (s *Service) enrich() {
+	var inventories []models.Inventory
+	err := s.db.Where("inspect_link <> '' AND inspected_at IS NULL AND inspect_error = ''").
+		Order("id").
+		Limit(s.config.BatchSize).
+		Find(&inventories).Error
+	if err != nil {
+		logrus.Errorf("Failed to load inventories to inspect: %v", err)
+		return
+	}
+
+	for i := range inventories {
+		inventory := &inventories[i]
+
+		ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+		result, err := s.Resolve(ctx, inventory.InspectLink)
+		cancel()
+		if err != nil {
+			// 链接失效等永久错误记录下来，避免反复请求；网络错误留待下次重试
+			if errors.Is(err, ErrInvalidLink) || errors.Is(err, ErrRejected) {
+				s.db.Model(inventory).Update("inspect_error", err.Error())
+			}
+			logrus.Warnf("Failed to inspect inventory %d: %v", inventory.ID, err)
+			continue
+		}
+		if err := s.apply(inventory, result); err != nil {
+			logrus.Errorf("Failed to save inspect result for inventory %d: %v", inventory.ID, err)
+		}
+	}
+}
+
+// apply 保存检视结果，物品尚未记录图案编号时一并回填
+func (s *Service) apply(inventory *models.Inventory, result *Result) error {
+	now := time.Now()
+	inventory.FloatValue = &result.FloatValue
+	inventory.PaintSeed = &result.PaintSeed
+	inventory.PaintIndex = &result.PaintIndex
+	inventory.InspectedAt = &now
+	inventory.InspectError = ""
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(inventory).
+			Select("inspect_link", "float_value", "paint_seed", "paint_index", "inspected_at", "inspect_error").
+			Updates(inventory).Error
+		if err != nil {
+			return err
+		}
+		if result.PaintIndex > 0 {
+			return tx.Model(&models.Item{}).
+				Where("id = ? AND COALESCE(paint_index, 0) = 0", inventory.ItemID).
+				Update("paint_index", result.PaintIndex).Error
+		}
+		return nil
+	})
+}
+
+// validLink 检视链接形如 steam://rungame/730/76561202255233023/+csgo_econ_action_preview%20S...A...D...
+func validLink(link string) bool {
+	link = strings.TrimSpace(link)
+	return strings.HasPrefix(link, "steam://rungame/730/") && strings.Contains(link, "csgo_econ_action_preview")
+}
@@ -0,0 +1,51 @@
+package ledger
+
+import (
+	"csgo2-trading-bot/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 流水类型
+const (
+	TypeTrade      = "trade"
+	TypeFee        = "fee"
+	TypeAdjustment = "adjustment"
+)
+
+// Post 追加一条资金流水并记录入账后的余额。
+// 流水只追加不修改，更正通过反向流水完成；应传入事务句柄，同一用户的入账通过锁定用户行串行执行。
+func Post(db *gorm.DB, entry *models.LedgerEntry) error {
+	var user models.User
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, entry.UserID).Error; err != nil {
+		return err
+	}
+
+	balance, err := Balance(db, entry.UserID)
+	if err != nil {
+		return err
+	}
+	entry.Balance = balance + entry.Amount
+	return db.Create(entry).Error
+}
+
+// Balance 用户当前余额，即全部流水金额之和
+func Balance(db *gorm.DB, userID uint) (float64, error) {
+	var balance float64
+	err := db.Model(&models.LedgerEntry{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&balance).Error
+	return balance, err
+}
+
+// Entries 用户最近的流水，按时间倒序
+func Entries(db *gorm.DB, userID uint, limit int) ([]models.LedgerEntry, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	var entries []models.LedgerEntry
+	err := db.Where("user_id = ?", userID).Order("id DESC").Limit(limit).Find(&entries).Error
+	return entries, err
+}
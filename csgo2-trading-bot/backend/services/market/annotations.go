@@ -0,0 +1,157 @@
+package market
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// ErrAnnotationNotFound 标注不存在或无权删除
+var ErrAnnotationNotFound = errors.New("annotation not found")
+
+// 标注类型
+var annotationKinds = map[string]bool{
+	"game_update":  true,
+	"case_release": true,
+	"note":         true,
+}
+
+// Marker 图表上的一个标记点
+type Marker struct {
+	Time         time.Time `json:"time"`
+	Source       string    `json:"source"` // trade, strategy, annotation
+	Kind         string    `json:"kind"`   // buy, sell, game_update, case_release, note
+	Title        string    `json:"title"`
+	Description  string    `json:"description,omitempty"`
+	URL          string    `json:"url,omitempty"`
+	Price        float64   `json:"price,omitempty"`
+	Quantity     int       `json:"quantity,omitempty"`
+	OrderID      uint      `json:"order_id,omitempty"`
+	StrategyID   *uint     `json:"strategy_id,omitempty"`
+	AnnotationID uint      `json:"annotation_id,omitempty"`
+	Global       bool      `json:"global,omitempty"`
+}
+
+// GetChartMarkers 汇总物品图表的标记：用户的成交、策略操作以及全局和个人标注
+func (s *Service) GetChartMarkers(itemID, userID uint, since time.Time) ([]Marker, error) {
+	var orders []models.Order
+	err := s.db.Preload("Strategy").
+		Where("user_id = ? AND item_id = ? AND status = ? AND COALESCE(executed_at, created_at) >= ?", userID, itemID, "completed", since).
+		Find(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var annotations []models.Annotation
+	err = s.db.Where("(item_id = ? OR item_id IS NULL) AND (user_id = ? OR user_id IS NULL) AND time >= ?", itemID, userID, since).
+		Find(&annotations).Error
+	if err != nil {
+		return nil, err
+	}
+
+	markers := make([]Marker, 0, len(orders)+len(annotations))
+	for _, order := range orders {
+		at := order.CreatedAt
+		if order.ExecutedAt != nil {
+			at = *order.ExecutedAt
+		}
+
+		marker := Marker{
+			Time:     at,
+			Source:   "trade",
+			Kind:     order.Type,
+			Title:    order.Type + " " + order.Platform,
+			Price:    order.Price,
+			Quantity: order.Quantity,
+			OrderID:  order.ID,
+		}
+		if order.StrategyID != nil {
+			marker.Source = "strategy"
+			marker.StrategyID = order.StrategyID
+			if order.Strategy != nil {
+				marker.Title = order.Strategy.Name + ": " + order.Type
+			}
+		}
+		markers = append(markers, marker)
+	}
+
+	for _, a := range annotations {
+		markers = append(markers, Marker{
+			Time:         a.Time,
+			Source:       "annotation",
+			Kind:         a.Kind,
+			Title:        a.Title,
+			Description:  a.Description,
+			URL:          a.URL,
+			AnnotationID: a.ID,
+			Global:       a.UserID == nil,
+		})
+	}
+
+	sort.SliceStable(markers, func(i, j int) bool {
+		return markers[i].Time.Before(markers[j].Time)
+	})
+	return markers, nil
+}
+
+// ListAnnotations 获取用户可见的标注，itemID为0时返回全部
+func (s *Service) ListAnnotations(userID, itemID uint) ([]models.Annotation, error) {
+	query := s.db.Where("user_id = ? OR user_id IS NULL", userID)
+	if itemID > 0 {
+		query = query.Where("item_id = ? OR item_id IS NULL", itemID)
+	}
+
+	var annotations []models.Annotation
+	err := query.Order("time DESC").Find(&annotations).Error
+	return annotations, err
+}
+
+// CreateAnnotation 创建标注，userID为空时为全局事件
+func (s *Service) CreateAnnotation(annotation models.Annotation) (*models.Annotation, error) {
+	annotation.Title = strings.TrimSpace(annotation.Title)
+	if annotation.Title == "" {
+		return nil, errors.New("title is required")
+	}
+	if annotation.Kind == "" {
+		annotation.Kind = "note"
+	}
+	if !annotationKinds[annotation.Kind] {
+		return nil, errors.New("kind must be one of game_update, case_release, note")
+	}
+	if annotation.Time.IsZero() {
+		annotation.Time = time.Now()
+	}
+	if annotation.ItemID != nil {
+		var item models.Item
+		if err := s.db.Select("id").First(&item, *annotation.ItemID).Error; err != nil {
+			return nil, errors.New("item not found")
+		}
+	}
+
+	if err := s.db.Create(&annotation).Error; err != nil {
+		return nil, err
+	}
+	return &annotation, nil
+}
+
+// DeleteAnnotation 删除标注，userID为空时删除全局事件
+func (s *Service) DeleteAnnotation(annotationID uint, userID *uint) error {
+	query := s.db.Where("id = ?", annotationID)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	} else {
+		query = query.Where("user_id IS NULL")
+	}
+
+	result := query.Delete(&models.Annotation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAnnotationNotFound
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package market
+
+import (
+	"sort"
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// ComparisonCell 某物品在某平台的价格及买卖标记
+type ComparisonCell struct {
+	Price      float64   `json:"price"`
+	RecordedAt time.Time `json:"recorded_at"`
+	BestBuy    bool      `json:"best_buy"`  // 最低价，适合买入
+	BestSell   bool      `json:"best_sell"` // 最高价，适合卖出
+}
+
+// ComparisonRow 价格对比矩阵的一行
+type ComparisonRow struct {
+	ItemID         uint                      `json:"item_id"`
+	MarketHashName string                    `json:"market_hash_name"`
+	Name           string                    `json:"name"`
+	Prices         map[string]ComparisonCell `json:"prices"`
+	BestBuy        string                    `json:"best_buy,omitempty"`
+	BestSell       string                    `json:"best_sell,omitempty"`
+	Spread         float64                   `json:"spread"`
+	SpreadPercent  float64                   `json:"spread_percent"`
+}
+
+// ComparePrices 对比一组物品在各平台的最新价格，一次查询取出全部数据。
+// 价格历史统一以本位币存储，currency不为空时换算为指定币种展示
+func (s *Service) ComparePrices(itemIDs []uint, currency string) ([]ComparisonRow, []string, error) {
+	if _, err := s.fx.Rate(currency); err != nil {
+		return nil, nil, err
+	}
+
+	var items []models.Item
+	if err := s.db.Select("id", "market_hash_name", "name").
+		Where("id IN ?", itemIDs).Order("id").Find(&items).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var latest []struct {
+		ItemID     uint
+		Platform   string
+		Price      float64
+		RecordedAt time.Time
+	}
+	err := s.db.Raw(`
+		SELECT DISTINCT ON (item_id, platform) item_id, platform, price, recorded_at
+		FROM price_histories
+		WHERE item_id IN ? AND deleted_at IS NULL
+		ORDER BY item_id, platform, recorded_at DESC`, itemIDs).
+		Scan(&latest).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows := make([]ComparisonRow, len(items))
+	index := make(map[uint]*ComparisonRow, len(items))
+	for i, item := range items {
+		rows[i] = ComparisonRow{
+			ItemID:         item.ID,
+			MarketHashName: item.MarketHashName,
+			Name:           item.Name,
+			Prices:         make(map[string]ComparisonCell),
+		}
+		index[item.ID] = &rows[i]
+	}
+
+	platforms := []string{}
+	seen := make(map[string]bool)
+	for _, p := range latest {
+		row, ok := index[p.ItemID]
+		if !ok || p.Price <= 0 {
+			continue
+		}
+		price, _ := s.fx.FromBase(p.Price, currency)
+		row.Prices[p.Platform] = ComparisonCell{Price: price, RecordedAt: p.RecordedAt}
+		if !seen[p.Platform] {
+			seen[p.Platform] = true
+			platforms = append(platforms, p.Platform)
+		}
+	}
+
+	sort.Strings(platforms)
+	for i := range rows {
+		markBestPrices(&rows[i])
+	}
+
+	return rows, platforms, nil
+}
+
+// TopSpreads since之后有报价的物品中，跨平台价差百分比最大的limit个
+func (s *Service) TopSpreads(since time.Time, limit int) ([]ComparisonRow, error) {
+	var itemIDs []uint
+	err := s.db.Raw(`
+		SELECT item_id FROM (
+			SELECT DISTINCT ON (item_id, platform) item_id, platform, price
+			FROM price_histories
+			WHERE recorded_at >= ? AND price > 0 AND deleted_at IS NULL
+			ORDER BY item_id, platform, recorded_at DESC
+		) latest
+		GROUP BY item_id
+		HAVING COUNT(*) > 1
+		ORDER BY (MAX(price) - MIN(price)) / MIN(price) DESC
+		LIMIT ?`, since, limit).
+		Scan(&itemIDs).Error
+	if err != nil || len(itemIDs) == 0 {
+		return nil, err
+	}
+
+	rows, _, err := s.ComparePrices(itemIDs, "")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].SpreadPercent > rows[j].SpreadPercent })
+	return rows, nil
+}
+
+// markBestPrices 标记最低买入和最高卖出平台并计算价差
+func markBestPrices(row *ComparisonRow) {
+	var low, high float64
+	for platform, cell := range row.Prices {
+		if row.BestBuy == "" || cell.Price < low {
+			low, row.BestBuy = cell.Price, platform
+		}
+		if row.BestSell == "" || cell.Price > high {
+			high, row.BestSell = cell.Price, platform
+		}
+	}
+	// 只有一个平台报价时无从比较
+	if len(row.Prices) < 2 {
+		row.BestBuy, row.BestSell = "", ""
+		return
+	}
+
+	row.Spread = high - low
+	row.SpreadPercent = row.Spread / low * 100
+
+	buy := row.Prices[row.BestBuy]
+	buy.BestBuy = true
+	row.Prices[row.BestBuy] = buy
+
+	sell := row.Prices[row.BestSell]
+	sell.BestSell = true
+	row.Prices[row.BestSell] = sell
+}
@@ -0,0 +1,99 @@
+package market
+
+import (
+	"sync"
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// PlatformPrice 某平台的最新价格
+type PlatformPrice struct {
+	Platform   string    `json:"platform"`
+	Price      float64   `json:"price"`
+	Volume     int       `json:"volume"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// ItemFull 物品详情页所需的全部数据，单项失败时记录在Errors中，其余照常返回
+type ItemFull struct {
+	Item       *models.Item           `json:"item"`
+	Prices     []PlatformPrice        `json:"prices"`
+	Analysis   map[string]interface{} `json:"analysis"`
+	Supply     []models.MarketData    `json:"supply"`
+	OpenOrders []models.Order         `json:"open_orders"`
+	Inventory  []models.Inventory     `json:"inventory"`
+	Errors     map[string]string      `json:"errors,omitempty"`
+}
+
+// GetItemFull 并发汇总物品元数据、各平台价格、指标、供给与用户的挂单和库存
+func (s *Service) GetItemFull(itemID uint, userID uint) (*ItemFull, error) {
+	item, err := s.GetItemDetails(itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	full := &ItemFull{Item: item}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	section := func(name string, load func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := load(); err != nil {
+				mu.Lock()
+				if full.Errors == nil {
+					full.Errors = make(map[string]string)
+				}
+				full.Errors[name] = err.Error()
+				mu.Unlock()
+			}
+		}()
+	}
+
+	section("prices", func() (err error) {
+		full.Prices, err = s.GetPlatformPrices(itemID)
+		return
+	})
+	section("analysis", func() (err error) {
+		full.Analysis, err = s.GetMarketAnalysis(itemID)
+		return
+	})
+	section("supply", func() (err error) {
+		full.Supply, err = s.GetSupplyStats(itemID)
+		return
+	})
+	section("open_orders", func() error {
+		return s.db.Where("user_id = ? AND item_id = ? AND status = ?", userID, itemID, "pending").
+			Order("created_at DESC").Find(&full.OpenOrders).Error
+	})
+	section("inventory", func() error {
+		return s.db.Where("user_id = ? AND item_id = ?", userID, itemID).
+			Order("acquired_at DESC").Find(&full.Inventory).Error
+	})
+
+	wg.Wait()
+	return full, nil
+}
+
+// GetPlatformPrices 获取物品在各平台的最新价格
+func (s *Service) GetPlatformPrices(itemID uint) ([]PlatformPrice, error) {
+	var prices []PlatformPrice
+	err := s.db.Raw(`
+		SELECT DISTINCT ON (platform) platform, price, volume, recorded_at
+		FROM price_histories
+		WHERE item_id = ? AND deleted_at IS NULL
+		ORDER BY platform, recorded_at DESC`, itemID).
+		Scan(&prices).Error
+	return prices, err
+}
+
+// GetSupplyStats 获取物品在各平台最新的市场快照
+func (s *Service) GetSupplyStats(itemID uint) ([]models.MarketData, error) {
+	var snapshots []models.MarketData
+	latest := s.db.Model(&models.MarketData{}).Select("MAX(id)").
+		Where("item_id = ?", itemID).Group("platform")
+	err := s.db.Where("id IN (?)", latest).Order("platform").Find(&snapshots).Error
+	return snapshots, err
+}
@@ -6,26 +6,42 @@ import (
 	"fmt"
 	"time"
 
+	"csgo2-trading-bot/database"
 	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/fx"
 
-	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
 type Service struct {
-	db    *gorm.DB
-	redis *redis.Client
-	ctx   context.Context
+	db        *gorm.DB
+	cache     *database.Cache
+	prices    *database.PriceStore
+	fx        *fx.Service
+	ctx       context.Context
+	listeners []func(PriceUpdate)
 }
 
-func NewService(db *gorm.DB, redis *redis.Client) *Service {
+func NewService(db *gorm.DB, cache *database.Cache, prices *database.PriceStore, fxService *fx.Service) *Service {
 	return &Service{
-		db:    db,
-		redis: redis,
-		ctx:   context.Background(),
+		db:     db,
+		cache:  cache,
+		prices: prices,
+		fx:     fxService,
+		ctx:    context.Background(),
 	}
 }
 
+// OnPriceUpdate 注册价格更新回调，需在开始接收价格前调用；回调在写入价格的协程中执行，不应阻塞
+func (s *Service) OnPriceUpdate(fn func(PriceUpdate)) {
+	s.listeners = append(s.listeners, fn)
+}
+
+// BaseCurrency 价格数据使用的本位币
+func (s *Service) BaseCurrency() string {
+	return s.fx.Base()
+}
+
 // GetMarketItems 获取市场物品列表
 func (s *Service) GetMarketItems(page, pageSize int, filters map[string]interface{}) ([]models.Item, int64, error) {
 	var items []models.Item
@@ -46,10 +62,43 @@ func (s *Service) GetMarketItems(page, pageSize int, filters map[string]interfac
 	if maxPrice, ok := filters["max_price"].(float64); ok {
 		query = query.Where("current_price <= ?", maxPrice)
 	}
+	if exterior, ok := filters["exterior"].(string); ok && exterior != "" {
+		query = query.Where("exterior = ?", exterior)
+	}
+	if paintIndex, ok := filters["paint_index"].(int); ok {
+		query = query.Where("paint_index = ?", paintIndex)
+	}
+	// 磨损区间：只保留磨损等级与区间有交集的物品
+	minFloat, hasMin := filters["min_float"].(float64)
+	maxFloat, hasMax := filters["max_float"].(float64)
+	if hasMin || hasMax {
+		if !hasMax {
+			maxFloat = 1
+		}
+		query = query.Where("exterior IN ?", exteriorsInRange(minFloat, maxFloat))
+	}
+	if text, ok := filters["q"].(string); ok && text != "" {
+		pattern := "%" + text + "%"
+		query = query.Where("name ILIKE ? OR market_hash_name ILIKE ?", pattern, pattern)
+	}
+	if minPopularity, ok := filters["min_popularity"].(float64); ok {
+		query = query.Where("popularity >= ?", minPopularity)
+	}
+	// 以7日均价判断涨跌
+	switch filters["trend"] {
+	case "rising":
+		query = query.Where("avg_price_7days > 0 AND current_price > avg_price_7days")
+	case "falling":
+		query = query.Where("avg_price_7days > 0 AND current_price < avg_price_7days")
+	}
 
 	// 获取总数
 	query.Count(&total)
 
+	if filters["sort"] == "popularity" {
+		query = query.Order("popularity DESC").Order("id")
+	}
+
 	// 分页
 	offset := (page - 1) * pageSize
 	err := query.Offset(offset).Limit(pageSize).Find(&items).Error
@@ -79,6 +128,12 @@ func (s *Service) GetPriceHistory(itemID uint, days int) ([]models.PriceHistory,
 	return history, err
 }
 
+// GetPriceBuckets 获取按时间桶聚合的价格历史
+func (s *Service) GetPriceBuckets(itemID uint, platform string, days int, interval time.Duration) ([]database.PriceBucket, error) {
+	now := time.Now()
+	return s.prices.Buckets(itemID, platform, interval, now.AddDate(0, 0, -days), now)
+}
+
 // GetMarketTrends 获取市场趋势
 func (s *Service) GetMarketTrends() (map[string]interface{}, error) {
 	trends := make(map[string]interface{})
@@ -112,6 +167,11 @@ func (s *Service) GetMarketTrends() (map[string]interface{}, error) {
 	`).Scan(&fallingItems)
 	trends["falling_items"] = fallingItems
 
+	// 社区讨论热度最高的物品
+	var popularItems []models.Item
+	s.db.Where("popularity > 0").Order("popularity DESC").Limit(10).Find(&popularItems)
+	trends["popular_items"] = popularItems
+
 	// 获取市场总览
 	var marketOverview struct {
 		TotalItems      int64   `json:"total_items"`
@@ -135,6 +195,26 @@ func (s *Service) GetMarketTrends() (map[string]interface{}, error) {
 	return trends, nil
 }
 
+// GetMarketTrendsJSON 返回预先序列化的市场趋势，缓存一分钟避免重复查询和编码
+func (s *Service) GetMarketTrendsJSON() ([]byte, error) {
+	const cacheKey = "market:trends:json"
+	if data, err := s.cache.Get(s.ctx, cacheKey); err == nil {
+		return []byte(data), nil
+	}
+
+	trends, err := s.GetMarketTrends()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(trends)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(s.ctx, cacheKey, data, time.Minute)
+	return data, nil
+}
+
 // UpdateItemPrice 更新物品价格
 func (s *Service) UpdateItemPrice(itemID uint, price float64, platform string) error {
 	// 更新物品当前价格
@@ -154,27 +234,32 @@ func (s *Service) UpdateItemPrice(itemID uint, price float64, platform string) e
 		RecordedAt: time.Now(),
 	}
 	
-	if err := s.db.Create(&priceHistory).Error; err != nil {
+	if err := s.prices.Insert([]models.PriceHistory{priceHistory}); err != nil {
 		return err
 	}
 
-	// 更新Redis缓存
+	// 更新Redis缓存（不可用时跳过）
 	cacheKey := fmt.Sprintf("item:price:%d", itemID)
 	priceData, _ := json.Marshal(map[string]interface{}{
 		"price":    price,
 		"platform": platform,
 		"updated":  time.Now(),
 	})
-	s.redis.Set(s.ctx, cacheKey, priceData, 5*time.Minute)
+	s.cache.Set(s.ctx, cacheKey, priceData, 5*time.Minute)
+
+	update := PriceUpdate{ItemID: itemID, Price: price, Platform: platform, Time: priceHistory.RecordedAt}
+	for _, fn := range s.listeners {
+		fn(update)
+	}
 
 	return nil
 }
 
 // GetRealtimePrice 获取实时价格（优先从缓存）
 func (s *Service) GetRealtimePrice(itemID uint) (float64, error) {
-	// 先尝试从Redis获取
+	// 先尝试从Redis获取，不可用时回退到数据库
 	cacheKey := fmt.Sprintf("item:price:%d", itemID)
-	data, err := s.redis.Get(s.ctx, cacheKey).Result()
+	data, err := s.cache.Get(s.ctx, cacheKey)
 	
 	if err == nil {
 		var priceData map[string]interface{}
@@ -199,7 +284,7 @@ func (s *Service) SubscribePriceUpdates(itemIDs []uint) (<-chan PriceUpdate, err
 	updates := make(chan PriceUpdate, 100)
 	
 	// 使用Redis发布订阅
-	pubsub := s.redis.Subscribe(s.ctx, generatePriceChannels(itemIDs)...)
+	pubsub := s.cache.Client().Subscribe(s.ctx, generatePriceChannels(itemIDs)...)
 	
 	go func() {
 		defer close(updates)
@@ -267,20 +352,55 @@ func (s *Service) GetMarketAnalysis(itemID uint) (map[string]interface{}, error)
 	analysis["rsi"] = calculateRSI(prices, 14)
 	
 	// 趋势判断
-	trend := "neutral"
-	if len(prices) >= 7 {
-		recent := prices[len(prices)-7:]
-		if isUptrend(recent) {
-			trend = "bullish"
-		} else if isDowntrend(recent) {
-			trend = "bearish"
-		}
-	}
-	analysis["trend"] = trend
+	analysis["trend"] = trendOf(prices)
 	
 	return analysis, nil
 }
 
+// TrendSignal 物品当前的趋势指标
+type TrendSignal struct {
+	ItemID uint    `json:"item_id"`
+	Price  float64 `json:"price"`
+	Trend  string  `json:"trend"` // bullish, bearish, neutral
+	RSI    float64 `json:"rsi"`
+}
+
+// GetTrendSignal 按与市场分析相同的口径计算物品趋势和RSI
+func (s *Service) GetTrendSignal(itemID uint) (*TrendSignal, error) {
+	var prices []float64
+	err := s.db.Model(&models.PriceHistory{}).
+		Where("item_id = ? AND recorded_at >= ?", itemID, time.Now().AddDate(0, 0, -30)).
+		Order("recorded_at ASC").
+		Pluck("price", &prices).Error
+	if err != nil {
+		return nil, err
+	}
+
+	signal := &TrendSignal{ItemID: itemID, Trend: "neutral", RSI: 50}
+	if len(prices) == 0 {
+		return signal, nil
+	}
+	signal.Price = prices[len(prices)-1]
+	signal.Trend = trendOf(prices)
+	signal.RSI = calculateRSI(prices, 14)
+	return signal, nil
+}
+
+// trendOf 根据最近7个价格点判断趋势
+func trendOf(prices []float64) string {
+	if len(prices) < 7 {
+		return "neutral"
+	}
+	recent := prices[len(prices)-7:]
+	if isUptrend(recent) {
+		return "bullish"
+	}
+	if isDowntrend(recent) {
+		return "bearish"
+	}
+	return "neutral"
+}
+
 // 辅助函数
 func calculateMedian(prices []float64) float64 {
 	if len(prices) == 0 {
@@ -425,4 +545,27 @@ func generatePriceChannels(itemIDs []uint) []string {
 		channels[i] = fmt.Sprintf("price:update:%d", id)
 	}
 	return channels
-}
\ No newline at end of file
+}
+
+// exteriorRanges 各磨损等级对应的磨损值区间 [min, max)
+var exteriorRanges = []struct {
+	name     string
+	min, max float64
+}{
+	{"Factory New", 0, 0.07},
+	{"Minimal Wear", 0.07, 0.15},
+	{"Field-Tested", 0.15, 0.38},
+	{"Well-Worn", 0.38, 0.45},
+	{"Battle-Scarred", 0.45, 1},
+}
+
+// exteriorsInRange 与磨损值区间有交集的磨损等级
+func exteriorsInRange(minFloat, maxFloat float64) []string {
+	names := []string{}
+	for _, r := range exteriorRanges {
+		if minFloat < r.max && maxFloat >= r.min {
+			names = append(names, r.name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/webhooks"
+)
+
+// format 按事件生成通知标题和正文，不支持的事件返回false
+func (r *Router) format(event string, data interface{}) (string, string, bool) {
+	if order, ok := data.(*models.Order); ok {
+		desc := fmt.Sprintf("%s %s x%d @ %.2f (%s)", orderType(order.Type), r.itemName(order.ItemID, order.Item.Name),
+			order.Quantity, order.Price, order.Platform)
+		switch event {
+		case webhooks.EventOrderCompleted:
+			return fmt.Sprintf("订单 #%d 已成交", order.ID), desc, true
+		case webhooks.EventOrderFailed:
+			return fmt.Sprintf("订单 #%d 失败", order.ID), desc + "\n" + order.FailedReason, true
+		case EventOrderExpired:
+			return fmt.Sprintf("订单 #%d 已过期", order.ID), desc + "\n" + order.FailedReason, true
+		}
+		return "", "", false
+	}
+
+	// 其余事件的数据统一转为map读取，不依赖发布方的类型
+	var fields map[string]interface{}
+	if b, err := json.Marshal(data); err != nil || json.Unmarshal(b, &fields) != nil {
+		return "", "", false
+	}
+
+	switch event {
+	case webhooks.EventPriceAlert:
+		return fmt.Sprintf("价格提醒：%v", fields["item_name"]),
+			fmt.Sprintf("%v 在 %v 的价格为 %.2f，满足条件 %v",
+				fields["item_name"], fields["platform"], number(fields["price"]), fields["condition"]), true
+	case webhooks.EventArbitrageAlert:
+		return fmt.Sprintf("套利机会：%s", r.itemName(uint(number(fields["item_id"])), "")),
+			fmt.Sprintf("%v 买入 %.2f → %v 卖出 %.2f，价差 %.2f%%\n策略：%v",
+				fields["buy_platform"], number(fields["buy_price"]), fields["sell_platform"], number(fields["sell_price"]),
+				number(fields["spread_percent"]), fields["strategy_name"]), true
+	case webhooks.EventStrategyError:
+		return fmt.Sprintf("策略 #%v 执行出错", fields["strategy_id"]),
+			fmt.Sprintf("%v（%v）\n%v", fields["strategy_name"], fields["stage"], fields["error"]), true
+	case webhooks.EventStrategyStopped:
+		return fmt.Sprintf("策略 #%v 已停止", fields["strategy_id"]),
+			fmt.Sprintf("%v 已停止运行", fields["strategy_name"]), true
+	case EventNewItem:
+		items, _ := fields["items"].([]interface{})
+		lines := make([]string, 0, len(items))
+		for _, item := range items {
+			if m, ok := item.(map[string]interface{}); ok {
+				lines = append(lines, fmt.Sprint(m["market_hash_name"]))
+			}
+		}
+		return fmt.Sprintf("新物品上架：%d件", len(items)),
+			fmt.Sprintf("来源：%v\n%s", fields["platform"], strings.Join(lines, "\n")), true
+	case EventStrategyConflict:
+		return fmt.Sprintf("策略冲突：%s", r.itemName(uint(number(fields["item_id"])), "")),
+			fmt.Sprintf("策略 #%v 的%v信号与策略 %v 的反向订单冲突，按 %v 规则处理：%v",
+				fields["strategy_id"], orderType(fmt.Sprint(fields["side"])), fields["opponents"], fields["policy"], fields["outcome"]), true
+	case EventStrategySuggestion:
+		suggestions, _ := fields["suggestions"].([]interface{})
+		lines := make([]string, 0, len(suggestions))
+		for _, s := range suggestions {
+			if m, ok := s.(map[string]interface{}); ok {
+				lines = append(lines, fmt.Sprintf("· %v：%v", m["action"], m["reason"]))
+			}
+		}
+		finding := "长时间没有成交"
+		if fields["finding"] == "losing" {
+			finding = fmt.Sprintf("近期已实现收益 %.2f", number(fields["realized"]))
+		}
+		return fmt.Sprintf("策略 #%v 调整建议", fields["strategy_id"]),
+			fmt.Sprintf("%v %s\n%s", fields["strategy_name"], finding, strings.Join(lines, "\n")), true
+	case EventSessionExpired:
+		return fmt.Sprintf("%v 登录已失效", fields["platform"]),
+			fmt.Sprintf("自动刷新失败，请在管理后台重新设置Cookie\n%v", fields["error"]), true
+	case webhooks.EventLoginNewDevice:
+		return "新设备登录", fmt.Sprintf("IP：%v\n设备：%v", fields["ip"], fields["user_agent"]), true
+	}
+	return "", "", false
+}
+
+func (r *Router) itemName(itemID uint, name string) string {
+	if name != "" {
+		return name
+	}
+	var item models.Item
+	r.db.Select("name").First(&item, itemID)
+	return item.Name
+}
+
+func orderType(t string) string {
+	if t == "sell" {
+		return "卖出"
+	}
+	return "买入"
+}
+
+func number(v interface{}) float64 {
+	f, _ := v.(float64)
+	return f
+}
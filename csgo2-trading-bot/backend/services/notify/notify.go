@@ -0,0 +1,283 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/activity"
+	"csgo2-trading-bot/services/webhooks"
+	"csgo2-trading-bot/websocket"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrNotConfigured 用户没有配置该渠道，或渠道自身的设置不接收该事件
+var ErrNotConfigured = errors.New("notification channel is not configured")
+
+// 只在站内和推送渠道通知、不投递给Webhook的事件
+const (
+	EventRiskRejected       = "risk.rejected"
+	EventTrendAlert         = "trend.alert"
+	EventTradeOfferRequired = "trade_offer.required"
+	EventNewItem            = "item.new"
+	EventStrategyConflict   = "strategy.conflict"
+	EventSessionExpired     = "platform.session_expired"
+	EventStrategySuggestion = "strategy.suggestion"
+	EventOrderExpired       = "order.expired"
+)
+
+// Events 用户可以选择的全部事件
+var Events = append(append([]string{}, webhooks.Events...),
+	EventRiskRejected, EventTrendAlert, EventTradeOfferRequired, EventNewItem, EventStrategyConflict, EventSessionExpired, EventStrategySuggestion,
+	EventOrderExpired)
+
+// 严重级别，从低到高
+const (
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// Severities 严重级别列表，按从低到高排列
+var Severities = []string{SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+
+// 各事件的默认严重级别，发布方可以覆盖
+var defaultSeverity = map[string]string{
+	webhooks.EventOrderCompleted:  SeverityLow,
+	webhooks.EventOrderFailed:     SeverityHigh,
+	webhooks.EventPriceAlert:      SeverityHigh,
+	webhooks.EventStrategyError:   SeverityHigh,
+	webhooks.EventStrategyStopped: SeverityMedium,
+	webhooks.EventArbitrageAlert:  SeverityMedium,
+	webhooks.EventLoginNewDevice:  SeverityCritical,
+	EventRiskRejected:             SeverityHigh,
+	EventTrendAlert:               SeverityMedium,
+	EventTradeOfferRequired:       SeverityHigh,
+	EventNewItem:                  SeverityHigh,
+	EventStrategyConflict:         SeverityHigh,
+	EventSessionExpired:           SeverityCritical,
+	EventStrategySuggestion:       SeverityLow,
+	EventOrderExpired:             SeverityMedium,
+}
+
+// Message 一条通知：Title为空时由路由按事件格式化，Data原样推送给Webhook并保存在站内通知中
+type Message struct {
+	Event    string      `json:"event"`
+	Severity string      `json:"severity"`
+	Title    string      `json:"title"`
+	Body     string      `json:"body"` // 纯文本，可以多行
+	Data     interface{} `json:"data,omitempty"`
+}
+
+// Notifier 通知渠道，用户未配置该渠道时返回ErrNotConfigured
+type Notifier interface {
+	Name() string
+	DefaultEvents() []string // 用户没有设置偏好时投递的事件，nil表示全部事件
+	Send(userID uint, msg Message) error
+}
+
+// Router 所有服务的用户通知都经由这里发布：转发给Webhook，再按用户偏好投递到各渠道
+type Router struct {
+	db        *gorm.DB
+	webhooks  *webhooks.Service
+	activity  *activity.Service
+	notifiers []Notifier
+	queues    map[string]chan delivery
+	events    chan delivery
+}
+
+type delivery struct {
+	UserID  uint
+	Message Message
+}
+
+func NewRouter(db *gorm.DB, hub *websocket.Hub, webhookService *webhooks.Service, activityService *activity.Service) *Router {
+	r := &Router{
+		db:       db,
+		webhooks: webhookService,
+		activity: activityService,
+		queues:   make(map[string]chan delivery),
+		events:   make(chan delivery, 256),
+	}
+	r.Register(&inbox{db: db, hub: hub})
+	return r
+}
+
+// Register 注册通知渠道，须在Start之前调用
+func (r *Router) Register(n Notifier) {
+	r.notifiers = append(r.notifiers, n)
+	r.queues[n.Name()] = make(chan delivery, 256)
+}
+
+// Start 启动路由及各渠道的投递协程，每个渠道独立排队，慢渠道不影响其他渠道
+func (r *Router) Start() {
+	for _, n := range r.notifiers {
+		go r.deliver(n, r.queues[n.Name()])
+	}
+	go r.run()
+}
+
+// Publish 发布用户事件，不阻塞调用方；队列满时丢弃渠道投递，Webhook不受影响
+func (r *Router) Publish(userID uint, msg Message) {
+	if r == nil {
+		return
+	}
+	if msg.Severity == "" {
+		msg.Severity = defaultSeverity[msg.Event]
+		if msg.Severity == "" {
+			msg.Severity = SeverityMedium
+		}
+	}
+	for _, event := range webhooks.Events {
+		if event == msg.Event {
+			r.webhooks.Publish(userID, msg.Event, msg.Data)
+			break
+		}
+	}
+
+	select {
+	case r.events <- delivery{UserID: userID, Message: msg}:
+	default:
+		logrus.Debugf("Notification queue is full, %s for user %d dropped", msg.Event, userID)
+	}
+}
+
+// run 格式化消息并按用户偏好分发到各渠道的队列
+func (r *Router) run() {
+	for d := range r.events {
+		if d.Message.Title == "" {
+			title, body, ok := r.format(d.Message.Event, d.Message.Data)
+			if !ok {
+				continue
+			}
+			d.Message.Title, d.Message.Body = title, body
+		}
+		// 用户动态不受通知偏好影响；订单事件由交易服务按订单状态写入
+		if d.Message.Event != webhooks.EventOrderCompleted && d.Message.Event != webhooks.EventOrderFailed {
+			r.activity.Record(d.UserID, d.Message.Event, d.Message.Title, d.Message.Body, d.Message.Data)
+		}
+
+		prefs, err := r.storedPreferences(d.UserID)
+		if err != nil {
+			logrus.Errorf("Failed to load notification preferences for user %d: %v", d.UserID, err)
+			continue
+		}
+		now := time.Now()
+		for _, n := range r.notifiers {
+			pref := effectivePreference(n, prefs[n.Name()])
+			if !pref.allows(d.Message, now) {
+				continue
+			}
+			select {
+			case r.queues[n.Name()] <- d:
+			default:
+				logrus.Debugf("%s notification queue is full, %s for user %d dropped", n.Name(), d.Message.Event, d.UserID)
+			}
+		}
+	}
+}
+
+func (r *Router) deliver(n Notifier, queue chan delivery) {
+	for d := range queue {
+		if err := n.Send(d.UserID, d.Message); err != nil && !errors.Is(err, ErrNotConfigured) {
+			logrus.Warnf("Failed to send %s via %s to user %d: %v", d.Message.Event, n.Name(), d.UserID, err)
+		}
+	}
+}
+
+// NormalizeEvents 校验事件名，返回逗号分隔的筛选条件，为空时表示全部事件
+func NormalizeEvents(events []string) (string, error) {
+	if len(events) == 0 {
+		return "*", nil
+	}
+	seen := make(map[string]bool)
+	var filter []string
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if event == "*" {
+			return "*", nil
+		}
+		if !knownEvent(event) {
+			return "", fmt.Errorf("unknown event %q", event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			filter = append(filter, event)
+		}
+	}
+	return strings.Join(filter, ","), nil
+}
+
+// Subscribed 事件是否在筛选条件内
+func Subscribed(filter, event string) bool {
+	if filter == "*" {
+		return true
+	}
+	for _, e := range strings.Split(filter, ",") {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func knownEvent(event string) bool {
+	for _, known := range Events {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+func severityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// inbox 站内通知渠道：保存通知并通过WebSocket推送
+type inbox struct {
+	db  *gorm.DB
+	hub *websocket.Hub
+}
+
+func (i *inbox) Name() string {
+	return "websocket"
+}
+
+func (i *inbox) DefaultEvents() []string {
+	return nil
+}
+
+func (i *inbox) Send(userID uint, msg Message) error {
+	notification := models.Notification{
+		UserID:   userID,
+		Type:     msg.Event,
+		Title:    msg.Title,
+		Message:  msg.Body,
+		Priority: msg.Severity,
+		Data:     "{}",
+	}
+	if msg.Data != nil {
+		if b, err := json.Marshal(msg.Data); err == nil {
+			notification.Data = string(b)
+		}
+	}
+	if err := i.db.Create(&notification).Error; err != nil {
+		return err
+	}
+	if i.hub != nil {
+		websocket.BroadcastNotification(i.hub, &notification)
+	}
+	return nil
+}
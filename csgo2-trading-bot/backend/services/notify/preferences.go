@@ -0,0 +1,190 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// ErrUnknownChannel 渠道不存在或未启用
+var ErrUnknownChannel = errors.New("unknown notification channel")
+
+// Preference 用户对一个渠道的通知偏好，Default为true表示用户未设置、使用渠道默认值
+type Preference struct {
+	Channel     string   `json:"channel"`
+	Enabled     bool     `json:"enabled"`
+	Events      []string `json:"events"` // 空表示全部事件
+	MinSeverity string   `json:"min_severity"`
+	QuietStart  string   `json:"quiet_start,omitempty"`
+	QuietEnd    string   `json:"quiet_end,omitempty"`
+	Timezone    string   `json:"timezone,omitempty"`
+	Default     bool     `json:"default"`
+}
+
+// PreferenceSettings 修改渠道偏好时提交的内容。免打扰时段为本地时间HH:MM，可以跨零点，
+// 时段内只投递critical级别的通知
+type PreferenceSettings struct {
+	Enabled     *bool    `json:"enabled"`
+	Events      []string `json:"events"`
+	MinSeverity string   `json:"min_severity"`
+	QuietStart  string   `json:"quiet_start"`
+	QuietEnd    string   `json:"quiet_end"`
+	Timezone    string   `json:"timezone"`
+}
+
+// Preferences 用户在各个已启用渠道上的通知偏好
+func (r *Router) Preferences(userID uint) ([]Preference, error) {
+	stored, err := r.storedPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+	prefs := make([]Preference, 0, len(r.notifiers))
+	for _, n := range r.notifiers {
+		prefs = append(prefs, effectivePreference(n, stored[n.Name()]))
+	}
+	return prefs, nil
+}
+
+// SavePreference 创建或修改用户在某个渠道上的通知偏好
+func (r *Router) SavePreference(userID uint, channel string, settings PreferenceSettings) (*Preference, error) {
+	n := r.notifier(channel)
+	if n == nil {
+		return nil, ErrUnknownChannel
+	}
+
+	events, err := NormalizeEvents(settings.Events)
+	if err != nil {
+		return nil, err
+	}
+	if settings.MinSeverity == "" {
+		settings.MinSeverity = SeverityLow
+	}
+	if severityRank(settings.MinSeverity) < 0 {
+		return nil, fmt.Errorf("min_severity must be one of %s", strings.Join(Severities, ", "))
+	}
+	if (settings.QuietStart == "") != (settings.QuietEnd == "") {
+		return nil, errors.New("quiet_start and quiet_end must be set together")
+	}
+	if settings.QuietStart != "" {
+		if _, err := time.Parse("15:04", settings.QuietStart); err != nil {
+			return nil, errors.New("quiet_start must be HH:MM")
+		}
+		if _, err := time.Parse("15:04", settings.QuietEnd); err != nil {
+			return nil, errors.New("quiet_end must be HH:MM")
+		}
+	}
+	if _, err := time.LoadLocation(settings.Timezone); err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", settings.Timezone)
+	}
+
+	pref := models.NotificationPreference{UserID: userID, Channel: channel}
+	r.db.Where("user_id = ? AND channel = ?", userID, channel).First(&pref)
+	pref.Enabled = settings.Enabled == nil || *settings.Enabled
+	pref.Events = events
+	pref.MinSeverity = settings.MinSeverity
+	pref.QuietStart = settings.QuietStart
+	pref.QuietEnd = settings.QuietEnd
+	pref.Timezone = settings.Timezone
+	if err := r.db.Save(&pref).Error; err != nil {
+		return nil, err
+	}
+
+	result := effectivePreference(n, &pref)
+	return &result, nil
+}
+
+// ResetPreference 删除用户在某个渠道上的偏好，恢复渠道默认值
+func (r *Router) ResetPreference(userID uint, channel string) error {
+	if r.notifier(channel) == nil {
+		return ErrUnknownChannel
+	}
+	return r.db.Where("user_id = ? AND channel = ?", userID, channel).
+		Delete(&models.NotificationPreference{}).Error
+}
+
+func (r *Router) notifier(channel string) Notifier {
+	for _, n := range r.notifiers {
+		if n.Name() == channel {
+			return n
+		}
+	}
+	return nil
+}
+
+func (r *Router) storedPreferences(userID uint) (map[string]*models.NotificationPreference, error) {
+	var rows []models.NotificationPreference
+	if err := r.db.Where("user_id = ?", userID).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	prefs := make(map[string]*models.NotificationPreference, len(rows))
+	for i := range rows {
+		prefs[rows[i].Channel] = &rows[i]
+	}
+	return prefs, nil
+}
+
+// effectivePreference 用户的设置，没有设置时使用渠道默认值
+func effectivePreference(n Notifier, stored *models.NotificationPreference) Preference {
+	if stored == nil {
+		return Preference{
+			Channel:     n.Name(),
+			Enabled:     true,
+			Events:      n.DefaultEvents(),
+			MinSeverity: SeverityLow,
+			Default:     true,
+		}
+	}
+
+	pref := Preference{
+		Channel:     stored.Channel,
+		Enabled:     stored.Enabled,
+		MinSeverity: stored.MinSeverity,
+		QuietStart:  stored.QuietStart,
+		QuietEnd:    stored.QuietEnd,
+		Timezone:    stored.Timezone,
+	}
+	if stored.Events != "*" {
+		pref.Events = strings.Split(stored.Events, ",")
+	}
+	return pref
+}
+
+// allows 按事件、严重级别和免打扰时段判断是否投递
+func (p Preference) allows(msg Message, now time.Time) bool {
+	if !p.Enabled {
+		return false
+	}
+	if len(p.Events) > 0 && !Subscribed(strings.Join(p.Events, ","), msg.Event) {
+		return false
+	}
+	if severityRank(msg.Severity) < severityRank(p.MinSeverity) {
+		return false
+	}
+	return msg.Severity == SeverityCritical || !p.quiet(now)
+}
+
+// quiet 当前是否处于免打扰时段
+func (p Preference) quiet(now time.Time) bool {
+	if p.QuietStart == "" || p.QuietEnd == "" {
+		return false
+	}
+	start, err1 := time.Parse("15:04", p.QuietStart)
+	end, err2 := time.Parse("15:04", p.QuietEnd)
+	loc, err3 := time.LoadLocation(p.Timezone)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return false
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	// 跨零点，如23:00-07:00
+	return minute >= from || minute < to
+}
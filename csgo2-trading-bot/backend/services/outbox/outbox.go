@@ -0,0 +1,191 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 重试间隔上限，失败次数越多间隔越长
+const maxBackoff = 5 * time.Minute
+
+// Handler 投递一条事件，返回错误时稍后重试。同一事件可能被投递多次，处理方须能容忍重复
+type Handler func(payload []byte) error
+
+// Write 写入一条待投递事件，须传入业务修改所在的事务句柄，事件与业务修改一起提交或回滚
+func Write(tx *gorm.DB, topic string, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.OutboxEvent{
+		Topic:         topic,
+		Payload:       string(b),
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// Relay 事务发件箱的投递协程：按写入顺序读取未投递的事件交给对应主题的处理函数，成功后标记为已投递。
+// 进程在提交之后、投递之前退出时，事件在重启后继续投递（至少一次）
+type Relay struct {
+	db     *gorm.DB
+	config config.OutboxConfig
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	wake chan struct{}
+}
+
+func NewRelay(db *gorm.DB, cfg config.OutboxConfig) *Relay {
+	return &Relay{
+		db:       db,
+		config:   cfg,
+		handlers: make(map[string]Handler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Handle 注册主题的处理函数，须在Start之前调用
+func (r *Relay) Handle(topic string, handler Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[topic] = handler
+}
+
+// Kick 事务提交后调用，立即投递新事件而不必等到下一次轮询
+func (r *Relay) Kick() {
+	if r == nil {
+		return
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start 启动投递协程并注册已投递事件的清理任务
+func (r *Relay) Start(sched *scheduler.Scheduler) error {
+	go r.run()
+	return sched.Add(scheduler.Job{
+		ID:   "outbox_cleanup",
+		Spec: time.Hour.String(),
+		Run:  r.cleanup,
+	})
+}
+
+func (r *Relay) run() {
+	interval := time.Duration(r.config.Interval) * time.Millisecond
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// 一批投递满时还有积压，继续投递
+		for r.deliver() == r.config.BatchSize {
+		}
+		select {
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// deliver 投递一批到期的事件，返回处理的条数。
+// 多个实例同时运行时用SKIP LOCKED分摊，同一事件只由一个实例投递
+func (r *Relay) deliver() int {
+	var processed int
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var events []models.OutboxEvent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("sent_at IS NULL AND next_attempt_at <= ?", time.Now()).
+			Order("id").
+			Limit(r.config.BatchSize).
+			Find(&events).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range events {
+			event := &events[i]
+			updates := r.publish(event)
+			if err := tx.Model(event).Updates(updates).Error; err != nil {
+				return err
+			}
+			processed++
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("Failed to deliver outbox events: %v", err)
+		return 0
+	}
+	return processed
+}
+
+// publish 调用处理函数，返回需要更新的列
+func (r *Relay) publish(event *models.OutboxEvent) map[string]interface{} {
+	r.mu.RLock()
+	handler, ok := r.handlers[event.Topic]
+	r.mu.RUnlock()
+
+	err := errors.New("no handler for topic " + event.Topic)
+	if ok {
+		err = handler([]byte(event.Payload))
+	}
+	if err == nil {
+		return map[string]interface{}{"sent_at": time.Now(), "attempts": event.Attempts + 1, "last_error": ""}
+	}
+
+	attempts := event.Attempts + 1
+	logrus.Warnf("Outbox event %d (%s) delivery failed, attempt %d: %v", event.ID, event.Topic, attempts, err)
+	return map[string]interface{}{
+		"attempts":        attempts,
+		"last_error":      err.Error(),
+		"next_attempt_at": time.Now().Add(backoff(attempts)),
+	}
+}
+
+// cleanup 删除超过保留期的已投递事件，未投递的事件一直保留
+func (r *Relay) cleanup() {
+	cutoff := time.Now().Add(-time.Duration(r.config.RetentionHours) * time.Hour)
+	result := r.db.Where("sent_at < ?", cutoff).Delete(&models.OutboxEvent{})
+	if result.Error != nil {
+		logrus.Errorf("Failed to clean up outbox events: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		logrus.Infof("Removed %d delivered outbox events", result.RowsAffected)
+	}
+}
+
+// Stats 发件箱积压情况
+type Stats struct {
+	Pending int64 `json:"pending"` // 未投递的事件数
+	Failing int64 `json:"failing"` // 至少失败过一次、仍在重试的事件数
+}
+
+// Stats 统计未投递的事件，积压持续增长说明投递失败或投递协程没有运行
+func (r *Relay) Stats() (Stats, error) {
+	var stats Stats
+	err := r.db.Model(&models.OutboxEvent{}).
+		Select("COUNT(*) AS pending, COUNT(*) FILTER (WHERE attempts > 0) AS failing").
+		Where("sent_at IS NULL").
+		Scan(&stats).Error
+	return stats, err
+}
+
+func backoff(attempts int) time.Duration {
+	d := time.Second << uint(attempts)
+	if attempts > 16 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
@@ -0,0 +1,241 @@
+package bitskins
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Currency BitSkins所有报价均为美元
+const Currency = "USD"
+
+const appID = "730"
+
+// Config BitSkins接口配置
+type Config struct {
+	BaseURL string
+	APIKey  string
+	Secret  string
+}
+
+// ItemPrice 市场参考价
+type ItemPrice struct {
+	MarketHashName string  `json:"market_hash_name"`
+	Price          float64 `json:"price,string"`
+	UpdatedAt      int64   `json:"created_at"`
+}
+
+// Listing 在售商品
+type Listing struct {
+	ItemID         string  `json:"item_id"`
+	MarketHashName string  `json:"market_hash_name"`
+	Price          float64 `json:"price,string"`
+}
+
+// Withdrawal 提取状态
+type Withdrawal struct {
+	ItemID string `json:"item_id"`
+	Status string `json:"status"` // pending, sent, accepted, failed
+}
+
+// Client BitSkins API客户端，使用API Key加基于HMAC的动态验证码认证
+type Client struct {
+	config Config
+	http   *http.Client
+}
+
+func New(cfg Config, httpClient *http.Client) *Client {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "https://bitskins.com"
+	}
+	return &Client{
+		config: cfg,
+		http:   httpClient,
+	}
+}
+
+// GetBalance 获取账户余额（美元）
+func (c *Client) GetBalance(ctx context.Context) (float64, error) {
+	var data struct {
+		AvailableBalance float64 `json:"available_balance,string"`
+	}
+	if err := c.call(ctx, "get_account_balance", nil, &data); err != nil {
+		return 0, err
+	}
+	return data.AvailableBalance, nil
+}
+
+// GetAllPrices 获取全部物品的参考价
+func (c *Client) GetAllPrices(ctx context.Context) ([]ItemPrice, error) {
+	var data struct {
+		Prices []ItemPrice `json:"prices"`
+	}
+	if err := c.call(ctx, "get_all_item_prices", nil, &data); err != nil {
+		return nil, err
+	}
+	return data.Prices, nil
+}
+
+// GetLowestListing 获取物品当前最低价的在售商品
+func (c *Client) GetLowestListing(ctx context.Context, marketHashName string) (*Listing, error) {
+	params := url.Values{}
+	params.Set("market_hash_name", marketHashName)
+	params.Set("sort_by", "price")
+	params.Set("order", "asc")
+	params.Set("per_page", "1")
+
+	var data struct {
+		Items []Listing `json:"items"`
+	}
+	if err := c.call(ctx, "get_inventory_on_sale", params, &data); err != nil {
+		return nil, err
+	}
+	if len(data.Items) == 0 {
+		return nil, fmt.Errorf("no listings for %s", marketHashName)
+	}
+	return &data.Items[0], nil
+}
+
+// Buy 按指定价格购买商品，价格高于当前售价时BitSkins会拒绝
+func (c *Client) Buy(ctx context.Context, itemIDs []string, prices []float64) ([]string, error) {
+	params := url.Values{}
+	params.Set("item_ids", strings.Join(itemIDs, ","))
+	params.Set("prices", joinPrices(prices))
+	params.Set("auto_trade", "true")
+
+	var data struct {
+		Items []struct {
+			ItemID string `json:"item_id"`
+		} `json:"items"`
+	}
+	if err := c.call(ctx, "buy_item", params, &data); err != nil {
+		return nil, err
+	}
+
+	bought := make([]string, 0, len(data.Items))
+	for _, item := range data.Items {
+		bought = append(bought, item.ItemID)
+	}
+	return bought, nil
+}
+
+// ListForSale 上架出售，返回交易报价令牌
+func (c *Client) ListForSale(ctx context.Context, itemIDs []string, prices []float64) (string, error) {
+	params := url.Values{}
+	params.Set("item_ids", strings.Join(itemIDs, ","))
+	params.Set("prices", joinPrices(prices))
+
+	var data struct {
+		TradeTokens []string `json:"trade_tokens"`
+	}
+	if err := c.call(ctx, "list_item_for_sale", params, &data); err != nil {
+		return "", err
+	}
+	if len(data.TradeTokens) == 0 {
+		return "", nil
+	}
+	return data.TradeTokens[0], nil
+}
+
+// Withdraw 将已购买的商品提取到Steam库存
+func (c *Client) Withdraw(ctx context.Context, itemIDs []string) error {
+	params := url.Values{}
+	params.Set("item_ids", strings.Join(itemIDs, ","))
+	return c.call(ctx, "withdraw_item", params, nil)
+}
+
+// GetWithdrawals 查询商品的提取状态
+func (c *Client) GetWithdrawals(ctx context.Context, itemIDs []string) ([]Withdrawal, error) {
+	params := url.Values{}
+	params.Set("item_ids", strings.Join(itemIDs, ","))
+
+	var data struct {
+		Items []Withdrawal `json:"items"`
+	}
+	if err := c.call(ctx, "get_item_history", params, &data); err != nil {
+		return nil, err
+	}
+	return data.Items, nil
+}
+
+// call 调用接口，统一处理认证参数和错误
+func (c *Client) call(ctx context.Context, method string, params url.Values, out interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("api_key", c.config.APIKey)
+	params.Set("code", totp(c.config.Secret, time.Now()))
+	params.Set("app_id", appID)
+
+	endpoint := fmt.Sprintf("%s/api/v1/%s/?%s", strings.TrimRight(c.config.BaseURL, "/"), method, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Status string          `json:"status"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("bitskins %s: invalid response (HTTP %d): %v", method, resp.StatusCode, err)
+	}
+
+	if result.Status != "success" {
+		var failure struct {
+			ErrorMessage string `json:"error_message"`
+		}
+		json.Unmarshal(result.Data, &failure)
+		if failure.ErrorMessage == "" {
+			failure.ErrorMessage = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		}
+		return fmt.Errorf("bitskins %s: %s", method, failure.ErrorMessage)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Data, out)
+}
+
+func joinPrices(prices []float64) string {
+	parts := make([]string, len(prices))
+	for i, p := range prices {
+		parts[i] = strconv.FormatFloat(p, 'f', 2, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+// totp 按RFC 6238生成6位动态验证码（HMAC-SHA1，30秒步长）
+func totp(secret string, now time.Time) string {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return ""
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(now.Unix()/30))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000)
+}
@@ -0,0 +1,68 @@
+package bitskins
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	benchQuotes       = 20000 // 全量报价的条目数，与线上BitSkins目录规模相当
+	maxAllocsPerQuote = 2.0   // 每条报价的内存分配次数上限，防止解析路径退化
+)
+
+// BenchmarkGetAllPrices 解析一次包含2万条报价的get_all_item_prices响应，响应由本地服务返回，不含网络延迟的影响。
+// 按报价折算耗时和内存分配，每条报价分配超过上限时失败
+func BenchmarkGetAllPrices(b *testing.B) {
+	prices := make([]map[string]interface{}, benchQuotes)
+	for i := range prices {
+		prices[i] = map[string]interface{}{
+			"market_hash_name": "AK-47 | Redline (Field-Tested) #" + strconv.Itoa(i),
+			"price":            strconv.FormatFloat(float64(i%5000)+0.37, 'f', 2, 64),
+			"created_at":       time.Now().Unix(),
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"status": "success",
+		"data":   map[string]interface{}{"prices": prices},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client := New(Config{BaseURL: server.URL, APIKey: "bench", Secret: "JBSWY3DPEHPK3PXP"}, server.Client())
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		got, err := client.GetAllPrices(ctx)
+		if err != nil || len(got) != benchQuotes {
+			b.Fatalf("GetAllPrices: %d quotes, %v", len(got), err)
+		}
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+
+	// 与-benchmem的allocs/op相同，按全部协程的分配统计，包含本地服务端的分配
+	perQuote := float64(after.Mallocs-before.Mallocs) / float64(b.N) / benchQuotes
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/benchQuotes, "ns/quote")
+	b.ReportMetric(perQuote, "allocs/quote")
+	if perQuote > maxAllocsPerQuote {
+		b.Errorf("decoding allocates %.2f times per quote, limit %.2f", perQuote, maxAllocsPerQuote)
+	}
+}
@@ -0,0 +1,198 @@
+package marketcsgo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Config Market.CSGO接口配置
+type Config struct {
+	BaseURL  string
+	APIKey   string
+	Currency string // RUB, USD, EUR，需与账户币种一致
+}
+
+// ItemPrice 批量价格接口中的一项
+type ItemPrice struct {
+	MarketHashName string  `json:"market_hash_name"`
+	Volume         int     `json:"volume,string"`
+	Price          float64 `json:"price,string"`
+}
+
+// Purchase 购买结果
+type Purchase struct {
+	ID    string `json:"id"`
+	Price int64  `json:"price"`
+}
+
+// TradeOffer 需要由我方发出的P2P交易报价（出售的物品已被买走）
+type TradeOffer struct {
+	Partner int64  `json:"partner"`
+	Token   string `json:"token"`
+	Message string `json:"tradeoffermessage"`
+	Items   []struct {
+		AppID     int    `json:"appid"`
+		ContextID string `json:"contextid"`
+		AssetID   string `json:"assetid"`
+		Amount    int    `json:"amount"`
+	} `json:"items"`
+}
+
+// TradeURL 买家的交易链接，用于发出报价
+func (o *TradeOffer) TradeURL() string {
+	return fmt.Sprintf("https://steamcommunity.com/tradeoffer/new/?partner=%d&token=%s", o.Partner, o.Token)
+}
+
+// Client Market.CSGO v2 API客户端，使用API Key认证
+type Client struct {
+	config Config
+	http   *http.Client
+}
+
+func New(cfg Config, httpClient *http.Client) *Client {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "https://market.csgo.com"
+	}
+	if cfg.Currency == "" {
+		cfg.Currency = "RUB"
+	}
+	return &Client{
+		config: cfg,
+		http:   httpClient,
+	}
+}
+
+// Currency 账户币种，所有价格均以该币种计价
+func (c *Client) Currency() string {
+	return c.config.Currency
+}
+
+// GetPrices 获取全部物品的最低售价（批量价格文件，无需认证）
+func (c *Client) GetPrices(ctx context.Context) ([]ItemPrice, error) {
+	endpoint := fmt.Sprintf("%s/api/v2/prices/%s.json", strings.TrimRight(c.config.BaseURL, "/"), c.config.Currency)
+
+	var data struct {
+		Items []ItemPrice `json:"items"`
+	}
+	if err := c.do(ctx, "prices", endpoint, &data); err != nil {
+		return nil, err
+	}
+	return data.Items, nil
+}
+
+// GetBalance 获取账户余额
+func (c *Client) GetBalance(ctx context.Context) (float64, error) {
+	var data struct {
+		Money float64 `json:"money"`
+	}
+	if err := c.call(ctx, "get-money", nil, &data); err != nil {
+		return 0, err
+	}
+	return data.Money, nil
+}
+
+// Buy 以不高于maxPrice的价格购买一件物品，卖家随后会向绑定的交易链接发出报价
+func (c *Client) Buy(ctx context.Context, marketHashName string, maxPrice float64) (*Purchase, error) {
+	params := url.Values{}
+	params.Set("hash_name", marketHashName)
+	params.Set("price", strconv.FormatInt(c.toMinor(maxPrice), 10))
+
+	var data Purchase
+	if err := c.call(ctx, "buy", params, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// AddToSale 按Steam资产ID上架出售
+func (c *Client) AddToSale(ctx context.Context, assetID string, price float64) (string, error) {
+	params := url.Values{}
+	params.Set("id", assetID)
+	params.Set("price", strconv.FormatInt(c.toMinor(price), 10))
+	params.Set("cur", c.config.Currency)
+
+	var data struct {
+		ItemID string `json:"item_id"`
+	}
+	if err := c.call(ctx, "add-to-sale", params, &data); err != nil {
+		return "", err
+	}
+	return data.ItemID, nil
+}
+
+// Ping 保持在线状态，超过几分钟不调用时挂单会被隐藏
+func (c *Client) Ping(ctx context.Context) error {
+	return c.call(ctx, "ping", nil, nil)
+}
+
+// PendingOffers 获取已售出、需要由我方发出交易报价的物品
+func (c *Client) PendingOffers(ctx context.Context) ([]TradeOffer, error) {
+	var data struct {
+		Offers []TradeOffer `json:"offers"`
+	}
+	if err := c.call(ctx, "trade-request-give-p2p-all", nil, &data); err != nil {
+		return nil, err
+	}
+	return data.Offers, nil
+}
+
+// call 调用需要认证的接口
+func (c *Client) call(ctx context.Context, method string, params url.Values, out interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("key", c.config.APIKey)
+
+	endpoint := fmt.Sprintf("%s/api/v2/%s?%s", strings.TrimRight(c.config.BaseURL, "/"), method, params.Encode())
+	return c.do(ctx, method, endpoint, out)
+}
+
+// do 发送请求并解析响应，success为false时返回接口给出的错误信息
+func (c *Client) do(ctx context.Context, method, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("market.csgo %s: invalid response (HTTP %d): %v", method, resp.StatusCode, err)
+	}
+
+	var status struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}
+	json.Unmarshal(raw, &status)
+	if !status.Success {
+		if status.Error == "" {
+			status.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		}
+		return fmt.Errorf("market.csgo %s: %s", method, status.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// toMinor 下单接口的价格单位：卢布为戈比（x100），美元和欧元为x1000
+func (c *Client) toMinor(price float64) int64 {
+	if strings.EqualFold(c.config.Currency, "RUB") {
+		return int64(math.Round(price * 100))
+	}
+	return int64(math.Round(price * 1000))
+}
@@ -0,0 +1,458 @@
+// Package mock 模拟BitSkins、Market.CSGO和Steam市场搜索接口，用于本地端到端运行和集成测试。
+//
+// 各平台挂在不同前缀下，连接器的sandbox_url指向对应前缀即可：
+//
+//	/bitskins    BitSkins v1 接口
+//	/marketcsgo  Market.CSGO v2 接口
+//	/steam       Steam市场搜索（物品目录导入）
+//	/_mock       查看和重置模拟状态
+//
+// 物品和价格来自内置的fixtures.json，价格以美元计，其他币种按固定汇率换算。
+// 任意非空的API Key都能通过认证，值为"invalid"时返回认证失败，用于测试错误处理。
+package mock
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed fixtures.json
+var fixturesJSON []byte
+
+// 模拟汇率：1美元兑换的各币种数量
+var rates = map[string]float64{"USD": 1, "EUR": 0.92, "RUB": 90}
+
+// Item 模拟市场上的物品
+type Item struct {
+	MarketHashName string  `json:"market_hash_name"`
+	Type           string  `json:"type"`
+	Price          float64 `json:"price"` // 美元
+	Volume         int     `json:"volume"`
+}
+
+// Options 模拟行为
+type Options struct {
+	Balance  float64       // 各平台的初始余额（美元）
+	FailRate float64       // 请求随机失败的比例，0-1
+	Latency  time.Duration // 每个请求的额外延迟
+	Seed     int64
+}
+
+// Server 模拟服务，状态只保存在内存中
+type Server struct {
+	opts  Options
+	items []Item
+	mux   *http.ServeMux
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	nextID   int
+	balances map[string]float64 // 平台 -> 余额（美元）
+	listings map[string]Item    // BitSkins在售商品ID -> 物品
+	bought   map[string]string  // BitSkins已购商品ID -> 提取状态
+	sales    []string           // Market.CSGO已上架、等待发出报价的资产ID
+	requests map[string]int     // 平台/接口 -> 请求次数
+}
+
+// New 创建模拟服务
+func New(opts Options) *Server {
+	if opts.Balance <= 0 {
+		opts.Balance = 10000
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	var items []Item
+	if err := json.Unmarshal(fixturesJSON, &items); err != nil {
+		panic(fmt.Sprintf("mock: invalid fixtures: %v", err))
+	}
+
+	s := &Server{opts: opts, items: items, mux: http.NewServeMux()}
+	s.reset()
+
+	s.mux.HandleFunc("/bitskins/api/v1/", s.bitskins)
+	s.mux.HandleFunc("/marketcsgo/api/v2/", s.marketCSGO)
+	s.mux.HandleFunc("/steam/market/search/render/", s.steamSearch)
+	s.mux.HandleFunc("/_mock/state", s.state)
+	s.mux.HandleFunc("/_mock/reset", func(w http.ResponseWriter, r *http.Request) {
+		s.reset()
+		writeJSON(w, http.StatusOK, map[string]bool{"success": true})
+	})
+	return s
+}
+
+// NewServer 在随机端口上启动模拟服务，调用方负责Close
+func NewServer(opts Options) *httptest.Server {
+	return httptest.NewServer(New(opts))
+}
+
+// Items 内置的物品列表
+func (s *Server) Items() []Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Item(nil), s.items...)
+}
+
+// SetPrice 修改物品的美元价格，之后的报价、挂单和成交都按新价格，用于模拟行情变化。物品不存在时返回false
+func (s *Server) SetPrice(marketHashName string, price float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.items {
+		if s.items[i].MarketHashName == marketHashName {
+			s.items[i].Price = price
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.opts.Latency > 0 {
+		time.Sleep(s.opts.Latency)
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rand = rand.New(rand.NewSource(s.opts.Seed))
+	s.nextID = 0
+	s.balances = map[string]float64{"bitskins": s.opts.Balance, "marketcsgo": s.opts.Balance}
+	s.listings = make(map[string]Item)
+	s.bought = make(map[string]string)
+	s.sales = nil
+	s.requests = make(map[string]int)
+}
+
+// begin 记录请求并按FailRate决定是否模拟失败
+func (s *Server) begin(platform, method string) (fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[platform+"/"+method]++
+	return s.opts.FailRate > 0 && s.rand.Float64() < s.opts.FailRate
+}
+
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+func (s *Server) find(marketHashName string) (Item, bool) {
+	for _, item := range s.items {
+		if item.MarketHashName == marketHashName {
+			return item, true
+		}
+	}
+	return Item{}, false
+}
+
+// bitskins 模拟 /api/v1/{method}/，响应格式为 {"status": "success", "data": {...}}
+func (s *Server) bitskins(w http.ResponseWriter, r *http.Request) {
+	method := strings.Trim(strings.TrimPrefix(r.URL.Path, "/bitskins/api/v1/"), "/")
+	query := r.URL.Query()
+
+	fail := func(status int, message string) {
+		writeJSON(w, status, map[string]interface{}{
+			"status": "fail",
+			"data":   map[string]string{"error_message": message},
+		})
+	}
+	ok := func(data interface{}) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "data": data})
+	}
+
+	if s.begin("bitskins", method) {
+		fail(http.StatusServiceUnavailable, "simulated outage")
+		return
+	}
+	if key := query.Get("api_key"); key == "" || key == "invalid" {
+		fail(http.StatusUnauthorized, "invalid api key")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch method {
+	case "get_account_balance":
+		ok(map[string]string{"available_balance": formatPrice(s.balances["bitskins"])})
+
+	case "get_all_item_prices":
+		prices := make([]map[string]interface{}, 0, len(s.items))
+		for _, item := range s.items {
+			prices = append(prices, map[string]interface{}{
+				"market_hash_name": item.MarketHashName,
+				"price":            formatPrice(item.Price),
+				"created_at":       time.Now().Unix(),
+			})
+		}
+		ok(map[string]interface{}{"prices": prices})
+
+	case "get_inventory_on_sale":
+		item, found := s.find(query.Get("market_hash_name"))
+		if !found {
+			ok(map[string]interface{}{"items": []interface{}{}})
+			return
+		}
+		id := s.newID("bs")
+		s.listings[id] = item
+		ok(map[string]interface{}{"items": []map[string]string{{
+			"item_id":          id,
+			"market_hash_name": item.MarketHashName,
+			"price":            formatPrice(item.Price),
+		}}})
+
+	case "buy_item":
+		ids := splitList(query.Get("item_ids"))
+		prices := splitList(query.Get("prices"))
+		if len(ids) == 0 || len(ids) != len(prices) {
+			fail(http.StatusBadRequest, "item_ids and prices must have the same length")
+			return
+		}
+		var total float64
+		for i, id := range ids {
+			item, found := s.listings[id]
+			if !found {
+				fail(http.StatusBadRequest, "item "+id+" is no longer on sale")
+				return
+			}
+			price, _ := strconv.ParseFloat(prices[i], 64)
+			if price < item.Price {
+				fail(http.StatusBadRequest, "price of item "+id+" has changed")
+				return
+			}
+			total += item.Price
+		}
+		if total > s.balances["bitskins"] {
+			fail(http.StatusBadRequest, "insufficient balance")
+			return
+		}
+		s.balances["bitskins"] -= total
+		bought := make([]map[string]string, 0, len(ids))
+		for _, id := range ids {
+			delete(s.listings, id)
+			s.bought[id] = "pending"
+			bought = append(bought, map[string]string{"item_id": id})
+		}
+		ok(map[string]interface{}{"items": bought})
+
+	case "withdraw_item":
+		for _, id := range splitList(query.Get("item_ids")) {
+			if _, found := s.bought[id]; !found {
+				fail(http.StatusBadRequest, "item "+id+" is not in your account")
+				return
+			}
+			s.bought[id] = "sent"
+		}
+		ok(map[string]interface{}{})
+
+	case "get_item_history":
+		// 提取后第一次查询返回sent，之后返回accepted
+		items := []map[string]string{}
+		for _, id := range splitList(query.Get("item_ids")) {
+			status, found := s.bought[id]
+			if !found {
+				continue
+			}
+			if status == "sent" {
+				s.bought[id] = "accepted"
+			}
+			items = append(items, map[string]string{"item_id": id, "status": status})
+		}
+		ok(map[string]interface{}{"items": items})
+
+	case "list_item_for_sale":
+		if len(splitList(query.Get("item_ids"))) == 0 {
+			fail(http.StatusBadRequest, "item_ids is required")
+			return
+		}
+		ok(map[string]interface{}{"trade_tokens": []string{s.newID("token")}})
+
+	default:
+		fail(http.StatusNotFound, "unknown method "+method)
+	}
+}
+
+// marketCSGO 模拟 /api/v2/，响应为带success字段的JSON对象；价格文件无需认证
+func (s *Server) marketCSGO(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimPrefix(r.URL.Path, "/marketcsgo/api/v2/")
+	query := r.URL.Query()
+
+	fail := func(status int, message string) {
+		writeJSON(w, status, map[string]interface{}{"success": false, "error": message})
+	}
+	ok := func(data map[string]interface{}) {
+		data["success"] = true
+		writeJSON(w, http.StatusOK, data)
+	}
+
+	if s.begin("marketcsgo", method) {
+		fail(http.StatusServiceUnavailable, "simulated outage")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if currency, found := strings.CutPrefix(method, "prices/"); found {
+		currency = strings.TrimSuffix(currency, ".json")
+		rate, known := rates[currency]
+		if !known {
+			fail(http.StatusNotFound, "unknown currency")
+			return
+		}
+		items := make([]map[string]string, 0, len(s.items))
+		for _, item := range s.items {
+			items = append(items, map[string]string{
+				"market_hash_name": item.MarketHashName,
+				"volume":           strconv.Itoa(item.Volume),
+				"price":            formatPrice(item.Price * rate),
+			})
+		}
+		ok(map[string]interface{}{"currency": currency, "items": items})
+		return
+	}
+
+	if key := query.Get("key"); key == "" || key == "invalid" {
+		fail(http.StatusUnauthorized, "Bad KEY")
+		return
+	}
+
+	switch method {
+	case "ping":
+		ok(map[string]interface{}{"ping": "pong"})
+
+	case "get-money":
+		// 余额按美元保存，未指定币种时按卢布返回，与默认账户币种一致
+		ok(map[string]interface{}{"money": s.balances["marketcsgo"] * rates["RUB"], "currency": "RUB"})
+
+	case "buy":
+		item, found := s.find(query.Get("hash_name"))
+		if !found {
+			fail(http.StatusOK, "Item not found")
+			return
+		}
+		// 价格单位按卢布戈比解释
+		maxPrice, _ := strconv.ParseInt(query.Get("price"), 10, 64)
+		price := int64(math.Round(item.Price * rates["RUB"] * 100))
+		if maxPrice < price {
+			fail(http.StatusOK, "There are no offers for this item at this price")
+			return
+		}
+		if item.Price > s.balances["marketcsgo"] {
+			fail(http.StatusOK, "Not enough money")
+			return
+		}
+		s.balances["marketcsgo"] -= item.Price
+		ok(map[string]interface{}{"id": s.newID("mc"), "price": price})
+
+	case "add-to-sale":
+		assetID := query.Get("id")
+		if assetID == "" {
+			fail(http.StatusOK, "Item not found in inventory")
+			return
+		}
+		// 上架即视为售出，下次查询时需要发出交易报价
+		s.sales = append(s.sales, assetID)
+		ok(map[string]interface{}{"item_id": s.newID("mc")})
+
+	case "trade-request-give-p2p-all":
+		offers := make([]map[string]interface{}, 0, len(s.sales))
+		for _, assetID := range s.sales {
+			offers = append(offers, map[string]interface{}{
+				"partner":           39734272,
+				"token":             "mocktoken",
+				"tradeoffermessage": "mock " + assetID,
+				"items": []map[string]interface{}{{
+					"appid": 730, "contextid": "2", "assetid": assetID, "amount": 1,
+				}},
+			})
+		}
+		s.sales = nil
+		ok(map[string]interface{}{"offers": offers})
+
+	default:
+		fail(http.StatusNotFound, "unknown method "+method)
+	}
+}
+
+// steamSearch 模拟Steam市场搜索接口（norender=1）
+func (s *Server) steamSearch(w http.ResponseWriter, r *http.Request) {
+	if s.begin("steam", "search") {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+	if count <= 0 {
+		count = 10
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := []map[string]interface{}{}
+	for i := start; i < len(s.items) && i < start+count; i++ {
+		item := s.items[i]
+		results = append(results, map[string]interface{}{
+			"name":      item.MarketHashName,
+			"hash_name": item.MarketHashName,
+			"asset_description": map[string]string{
+				"type":     item.Type,
+				"icon_url": "",
+			},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"start":       start,
+		"pagesize":    count,
+		"total_count": len(s.items),
+		"results":     results,
+	})
+}
+
+// state 返回当前模拟状态，便于测试断言
+func (s *Server) state(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"balances": s.balances,
+		"listings": len(s.listings),
+		"bought":   s.bought,
+		"sales":    s.sales,
+		"requests": s.requests,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 2, 64)
+}
+
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
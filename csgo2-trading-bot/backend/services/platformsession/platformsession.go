@@ -0,0 +1,381 @@
+package platformsession
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/httpclient"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 会话状态
+const (
+	StatusUnknown = "unknown"
+	StatusHealthy = "healthy"
+	StatusExpired = "expired"
+	StatusError   = "error" // 检查请求失败，无法判断是否仍然登录
+)
+
+// ErrLoginRequired 平台返回未登录
+var ErrLoginRequired = errors.New("login required")
+
+// ErrEmptyCookie 设置的Cookie中没有任何键值
+var ErrEmptyCookie = errors.New("cookie is empty")
+
+// Manager 维护一个平台的登录Cookie：为该平台的请求附加Cookie，保存平台下发的新Cookie，
+// 定期检查登录状态，失效时尝试换取新会话，仍失败则通知管理员重新登录
+type Manager struct {
+	platform string
+	baseURL  string
+	http     *http.Client
+	db       *gorm.DB
+	notifier *notify.Router
+	config   config.SessionConfig
+
+	mu       sync.Mutex
+	state    models.PlatformSession
+	cookies  []*http.Cookie
+	checking bool
+
+	saveMu  sync.Mutex
+	recheck chan struct{}
+}
+
+// New 加载保存的会话并注册到平台的HTTP客户端，需在首次获取该平台客户端之前调用
+func New(platform, baseURL, cookie string, cfg config.SessionConfig, db *gorm.DB, httpClients *httpclient.Factory, notifier *notify.Router) (*Manager, error) {
+	m := &Manager{
+		platform: platform,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		db:       db,
+		notifier: notifier,
+		config:   cfg,
+		recheck:  make(chan struct{}, 1),
+	}
+
+	err := db.Where("platform = ?", platform).First(&m.state).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		m.state = models.PlatformSession{Platform: platform, Cookie: cookie, Status: StatusUnknown}
+		if err := db.Create(&m.state).Error; err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case m.state.Cookie == "" || (m.state.Status == StatusExpired && cookie != "" && cookie != m.state.Cookie):
+		// 保存的Cookie优先于配置文件；已失效时改用配置文件中更新过的Cookie
+		m.state.Cookie = cookie
+		m.state.Status = StatusUnknown
+	}
+	m.cookies = parseCookies(m.state.Cookie)
+
+	httpClients.UseSession(platform, m)
+	m.http = httpClients.Client(platform)
+	return m, nil
+}
+
+// Start 启动时检查一次，并注册定期检查任务
+func (m *Manager) Start(sched *scheduler.Scheduler) error {
+	go func() {
+		m.Check(context.Background())
+		// 请求返回401时提前检查
+		for range m.recheck {
+			m.Check(context.Background())
+		}
+	}()
+	return sched.Add(scheduler.Job{
+		ID:   m.platform + "_session_check",
+		Spec: (time.Duration(m.config.CheckInterval) * time.Second).String(),
+		Run:  func() { m.Check(context.Background()) },
+	})
+}
+
+// Apply 请求没有自带Cookie时附加当前会话的Cookie
+func (m *Manager) Apply(req *http.Request) {
+	if req.Header.Get("Cookie") != "" {
+		return
+	}
+	m.mu.Lock()
+	cookie := m.state.Cookie
+	m.mu.Unlock()
+	if cookie != "" {
+		req.Header.Set("Cookie", cookie)
+	}
+}
+
+// Observe 合并平台通过Set-Cookie下发的新会话；请求带的不是当前Cookie时忽略，避免混入其他会话
+func (m *Manager) Observe(resp *http.Response) {
+	m.mu.Lock()
+	if resp.Request == nil || resp.Request.Header.Get("Cookie") != m.state.Cookie {
+		m.mu.Unlock()
+		return
+	}
+	if resp.StatusCode == http.StatusUnauthorized && !m.checking && m.state.Status != StatusExpired {
+		select {
+		case m.recheck <- struct{}{}:
+		default:
+		}
+	}
+	changed := m.merge(resp.Cookies())
+	if changed {
+		now := time.Now()
+		m.state.RefreshedAt = &now
+	}
+	m.mu.Unlock()
+
+	if changed {
+		logrus.Infof("%s session cookie refreshed by the platform", m.platform)
+		m.save()
+	}
+}
+
+// Check 请求需要登录的接口检查会话，未登录时先访问refresh_path换取新会话再检查一次
+func (m *Manager) Check(ctx context.Context) error {
+	m.mu.Lock()
+	if m.checking {
+		m.mu.Unlock()
+		return nil
+	}
+	m.checking = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.checking = false
+		m.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	_, err := m.probe(ctx, "")
+	if errors.Is(err, ErrLoginRequired) && m.config.RefreshPath != "" {
+		if refreshErr := m.refresh(ctx); refreshErr != nil {
+			logrus.Warnf("Failed to refresh %s session: %v", m.platform, refreshErr)
+		} else {
+			_, err = m.probe(ctx, "")
+		}
+	}
+	m.record(err)
+	return err
+}
+
+// SetCookie 管理员重新登录后设置新Cookie，校验通过才替换当前会话
+func (m *Manager) SetCookie(ctx context.Context, cookie string) (models.PlatformSession, error) {
+	cookies := parseCookies(cookie)
+	if len(cookies) == 0 {
+		return m.Status(), ErrEmptyCookie
+	}
+	header := formatCookies(cookies)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	issued, err := m.probe(ctx, header)
+	if err != nil {
+		return m.Status(), err
+	}
+
+	m.mu.Lock()
+	now := time.Now()
+	m.cookies = cookies
+	m.state.Cookie = header
+	m.merge(issued)
+	m.state.RefreshedAt = &now
+	m.mu.Unlock()
+
+	m.record(nil)
+	logrus.Infof("%s session cookie replaced", m.platform)
+	return m.Status(), nil
+}
+
+// Status 当前会话状态
+func (m *Manager) Status() models.PlatformSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Healthy 最近一次检查是否确认已登录
+func (m *Manager) Healthy() bool {
+	return m.Status().Status == StatusHealthy
+}
+
+// probe 请求check_path，cookie为空时使用当前会话；返回响应下发的Cookie
+func (m *Manager) probe(ctx context.Context, cookie string) ([]*http.Cookie, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.baseURL+m.config.CheckPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cookie != "" {
+		req.Header.Set("Cookie", cookie)
+	}
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrLoginRequired
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("check returned %s", resp.Status)
+	}
+	// BUFF未登录时仍返回200，由code区分
+	var result struct {
+		Code  string `json:"code"`
+		Error string `json:"error"`
+		Msg   string `json:"msg"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode check response: %w", err)
+	}
+	switch result.Code {
+	case "OK":
+		return resp.Cookies(), nil
+	case "Login Required":
+		return nil, ErrLoginRequired
+	}
+	return nil, fmt.Errorf("check returned code %q: %s%s", result.Code, result.Error, result.Msg)
+}
+
+// refresh 访问页面让平台用remember_me等长期Cookie下发新的session，新Cookie由Observe保存
+func (m *Manager) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.baseURL+m.config.RefreshPath, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/html")
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	resp.Body.Close()
+	return nil
+}
+
+// record 保存检查结果，连续失效达到alert_after次时通知管理员
+func (m *Manager) record(err error) {
+	now := time.Now()
+	alert := false
+
+	m.mu.Lock()
+	m.state.CheckedAt = &now
+	switch {
+	case err == nil:
+		m.state.Status = StatusHealthy
+		m.state.Failures = 0
+		m.state.ExpiredAt = nil
+		m.state.LastError = ""
+	case errors.Is(err, ErrLoginRequired):
+		if m.state.Status != StatusExpired {
+			m.state.ExpiredAt = &now
+		}
+		m.state.Status = StatusExpired
+		m.state.Failures++
+		m.state.LastError = err.Error()
+		alert = m.state.Failures == max(m.config.AlertAfter, 1)
+	default:
+		// 网络错误等无法判断登录状态，已失效的会话保持失效
+		if m.state.Status != StatusExpired {
+			m.state.Status = StatusError
+		}
+		m.state.LastError = err.Error()
+	}
+	state := m.state
+	m.mu.Unlock()
+
+	m.save()
+	if err != nil {
+		logrus.Errorf("%s session check failed: %v", m.platform, err)
+	}
+	if alert {
+		m.alertAdmins(state)
+	}
+}
+
+// alertAdmins 自动刷新失败，通知所有管理员手动重新登录
+func (m *Manager) alertAdmins(state models.PlatformSession) {
+	var adminIDs []uint
+	if err := m.db.Model(&models.User{}).Where("is_admin = ?", true).Pluck("id", &adminIDs).Error; err != nil {
+		logrus.Errorf("Failed to load admins for %s session alert: %v", m.platform, err)
+		return
+	}
+	data := map[string]interface{}{
+		"platform":   m.platform,
+		"error":      state.LastError,
+		"expired_at": state.ExpiredAt,
+	}
+	for _, id := range adminIDs {
+		m.notifier.Publish(id, notify.Message{Event: notify.EventSessionExpired, Data: data})
+	}
+}
+
+func (m *Manager) save() {
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	state := m.Status()
+	if err := m.db.Save(&state).Error; err != nil {
+		logrus.Errorf("Failed to save %s session: %v", m.platform, err)
+	}
+}
+
+// merge 按名称合并新Cookie，过期的Cookie被删除；返回是否有变化，调用方需持有mu
+func (m *Manager) merge(issued []*http.Cookie) bool {
+	changed := false
+	for _, c := range issued {
+		deleted := c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(time.Now()))
+		i := indexOf(m.cookies, c.Name)
+		switch {
+		case i < 0 && !deleted:
+			m.cookies = append(m.cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+		case i >= 0 && deleted:
+			m.cookies = append(m.cookies[:i], m.cookies[i+1:]...)
+		case i >= 0 && m.cookies[i].Value != c.Value:
+			m.cookies[i] = &http.Cookie{Name: c.Name, Value: c.Value}
+		default:
+			continue
+		}
+		changed = true
+	}
+	if changed {
+		m.state.Cookie = formatCookies(m.cookies)
+	}
+	return changed
+}
+
+func indexOf(cookies []*http.Cookie, name string) int {
+	for i, c := range cookies {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseCookies 解析浏览器中复制的Cookie请求头，如"session=...; csrf_token=..."
+func parseCookies(header string) []*http.Cookie {
+	req := http.Request{Header: http.Header{"Cookie": {header}}}
+	return req.Cookies()
+}
+
+func formatCookies(cookies []*http.Cookie) string {
+	parts := make([]string, len(cookies))
+	for i, c := range cookies {
+		parts[i] = c.Name + "=" + c.Value
+	}
+	return strings.Join(parts, "; ")
+}
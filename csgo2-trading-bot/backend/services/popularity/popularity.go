@@ -0,0 +1,270 @@
+package popularity
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 热度以当日提及数相对前若干天日均提及数的倍数衡量
+const baselineDays = 7
+
+// 基础名称过短（如贴纸、涂鸦的简称）容易误匹配普通词语
+const minNameLength = 6
+
+// 热度评分：当日提及数除以前7日日均提及数（不足1按1计）
+const scoreQuery = `
+	WITH daily AS (
+		SELECT item_id, day, SUM(mentions) AS mentions
+		FROM item_mentions
+		WHERE day >= ?::date - 7 AND day <= ?::date
+		GROUP BY 1, 2
+	),
+	scores AS (
+		SELECT item_id,
+		       COALESCE(SUM(mentions) FILTER (WHERE day = ?::date), 0)
+		       / GREATEST(COALESCE(SUM(mentions) FILTER (WHERE day < ?::date), 0) / 7.0, 1) AS score
+		FROM daily
+		GROUP BY item_id
+	)
+	UPDATE items SET popularity = scores.score
+	FROM scores
+	WHERE items.id = scores.item_id`
+
+// Point 物品某一天的热度
+type Point struct {
+	Day      time.Time      `json:"day"`
+	Mentions int            `json:"mentions"`
+	Sources  map[string]int `json:"sources"`
+	Score    float64        `json:"score"`
+}
+
+// Service 统计社区上对物品的提及次数并计算热度
+type Service struct {
+	db      *gorm.DB
+	cache   *database.Cache
+	sources []Source
+	config  config.PopularityConfig
+	ctx     context.Context
+}
+
+func NewService(db *gorm.DB, cache *database.Cache, httpClient *http.Client, cfg config.PopularityConfig) *Service {
+	var sources []Source
+	if cfg.Reddit.Enabled {
+		sources = append(sources, &RedditSource{URL: cfg.Reddit.URL, Subreddits: cfg.Reddit.Subreddits, HTTP: httpClient})
+	}
+	if cfg.Weibo.Enabled {
+		sources = append(sources, &WeiboSource{URL: cfg.Weibo.URL, Keywords: cfg.Weibo.Keywords, HTTP: httpClient})
+	}
+	return &Service{
+		db:      db,
+		cache:   cache,
+		sources: sources,
+		config:  cfg,
+		ctx:     context.Background(),
+	}
+}
+
+// Start 注册热度采集任务
+func (s *Service) Start(sched *scheduler.Scheduler) error {
+	return sched.Add(scheduler.Job{
+		ID:   "popularity_ingest",
+		Spec: (time.Duration(s.config.Interval) * time.Second).String(),
+		Run:  s.Ingest,
+	})
+}
+
+// Ingest 拉取各来源的新帖子，统计提及并刷新热度
+func (s *Service) Ingest() {
+	names, err := s.nameIndex()
+	if err != nil {
+		logrus.Errorf("Failed to load items for popularity: %v", err)
+		return
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for _, source := range s.sources {
+		ctx, cancel := context.WithTimeout(s.ctx, 2*time.Minute)
+		posts, err := source.Fetch(ctx)
+		cancel()
+		if err != nil {
+			// 部分来源失败时仍然统计已经取到的帖子
+			logrus.Warnf("Popularity source %s failed: %v", source.Name(), err)
+		}
+
+		counts, latest := s.count(source.Name(), posts, names)
+		if err := s.save(source.Name(), today, counts); err != nil {
+			logrus.Errorf("Failed to save %s mentions: %v", source.Name(), err)
+			continue
+		}
+		if !latest.IsZero() {
+			s.cache.Set(s.ctx, sinceKey(source.Name()), latest.Unix(), 0)
+		}
+	}
+
+	if err := s.updateScores(today); err != nil {
+		logrus.Errorf("Failed to update popularity scores: %v", err)
+	}
+}
+
+// History 物品最近若干天的每日提及和热度
+func (s *Service) History(itemID uint, days int) ([]Point, error) {
+	if days <= 0 {
+		days = 30
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from := today.AddDate(0, 0, -(days + baselineDays - 1))
+
+	var mentions []models.ItemMention
+	err := s.db.Where("item_id = ? AND day >= ?", itemID, from).Order("day").Find(&mentions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byDay := make(map[time.Time]*Point)
+	for _, m := range mentions {
+		day := m.Day.UTC().Truncate(24 * time.Hour)
+		p, ok := byDay[day]
+		if !ok {
+			p = &Point{Day: day, Sources: map[string]int{}}
+			byDay[day] = p
+		}
+		p.Mentions += m.Mentions
+		p.Sources[m.Source] += m.Mentions
+	}
+
+	points := make([]Point, 0, days)
+	for day := today.AddDate(0, 0, -(days - 1)); !day.After(today); day = day.AddDate(0, 0, 1) {
+		point := Point{Day: day, Sources: map[string]int{}}
+		if p, ok := byDay[day]; ok {
+			point = *p
+		}
+
+		var baseline int
+		for i := 1; i <= baselineDays; i++ {
+			if p, ok := byDay[day.AddDate(0, 0, -i)]; ok {
+				baseline += p.Mentions
+			}
+		}
+		avg := float64(baseline) / baselineDays
+		if avg < 1 {
+			avg = 1
+		}
+		point.Score = float64(point.Mentions) / avg
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// nameIndex 物品基础名称（去掉磨损和StatTrak等前缀，小写）到物品ID的映射
+func (s *Service) nameIndex() (map[string][]uint, error) {
+	var items []models.Item
+	err := s.db.Select("id", "market_hash_name").
+		Where("current_price >= ?", s.config.MinPrice).
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string][]uint)
+	for _, item := range items {
+		name := baseName(item.MarketHashName)
+		if len(name) < minNameLength {
+			continue
+		}
+		names[name] = append(names[name], item.ID)
+	}
+	return names, nil
+}
+
+// count 统计上次采集之后的新帖子中各物品被提及的帖子数
+func (s *Service) count(source string, posts []Post, names map[string][]uint) (map[uint]int, time.Time) {
+	var since time.Time
+	if cached, err := s.cache.Get(s.ctx, sinceKey(source)); err == nil {
+		if ts, err := strconv.ParseInt(cached, 10, 64); err == nil {
+			since = time.Unix(ts, 0)
+		}
+	}
+
+	counts := make(map[uint]int)
+	var latest time.Time
+	for _, post := range posts {
+		if !post.Time.After(since) {
+			continue
+		}
+		if post.Time.After(latest) {
+			latest = post.Time
+		}
+
+		text := strings.ToLower(post.Text)
+		for name, ids := range names {
+			if strings.Contains(text, name) {
+				for _, id := range ids {
+					counts[id]++
+				}
+			}
+		}
+	}
+	return counts, latest
+}
+
+// save 累加当日提及数
+func (s *Service) save(source string, day time.Time, counts map[uint]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	rows := make([]models.ItemMention, 0, len(counts))
+	for itemID, n := range counts {
+		rows = append(rows, models.ItemMention{ItemID: itemID, Day: day, Source: source, Mentions: n})
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "item_id"}, {Name: "day"}, {Name: "source"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"mentions": gorm.Expr("item_mentions.mentions + EXCLUDED.mentions"),
+		}),
+	}).Create(&rows).Error
+}
+
+// updateScores 刷新物品热度，近期没有提及的物品归零
+func (s *Service) updateScores(today time.Time) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`UPDATE items SET popularity = 0
+			WHERE popularity <> 0
+			AND id NOT IN (SELECT item_id FROM item_mentions WHERE day >= ?::date - 7)`, today).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(scoreQuery, today, today, today, today).Error
+	})
+}
+
+// baseName 去掉StatTrak™、Souvenir、★前缀和磨损后缀
+func baseName(marketHashName string) string {
+	name := marketHashName
+	for _, prefix := range []string{"★", "StatTrak™", "Souvenir"} {
+		name = strings.TrimSpace(strings.TrimPrefix(name, prefix))
+	}
+	if i := strings.LastIndex(name, " ("); i > 0 && strings.HasSuffix(name, ")") {
+		name = name[:i]
+	}
+	return strings.ToLower(name)
+}
+
+func sinceKey(source string) string {
+	return "popularity:since:" + source
+}
@@ -0,0 +1,138 @@
+package popularity
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Post 社区来源上的一条帖子
+type Post struct {
+	ID   string
+	Text string
+	Time time.Time
+}
+
+// Source 社区数据源，返回最近的帖子
+type Source interface {
+	Name() string
+	Fetch(ctx context.Context) ([]Post, error)
+}
+
+// RedditSource 读取若干subreddit的最新帖子
+type RedditSource struct {
+	URL        string
+	Subreddits []string
+	HTTP       *http.Client
+}
+
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Data struct {
+				ID         string  `json:"id"`
+				Title      string  `json:"title"`
+				Selftext   string  `json:"selftext"`
+				CreatedUTC float64 `json:"created_utc"`
+			} `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+func (s *RedditSource) Name() string {
+	return "reddit"
+}
+
+func (s *RedditSource) Fetch(ctx context.Context) ([]Post, error) {
+	var posts []Post
+	for _, sub := range s.Subreddits {
+		endpoint := fmt.Sprintf("%s/r/%s/new.json?limit=100", strings.TrimRight(s.URL, "/"), url.PathEscape(sub))
+
+		var listing redditListing
+		if err := getJSON(ctx, s.HTTP, endpoint, &listing); err != nil {
+			return posts, fmt.Errorf("r/%s: %w", sub, err)
+		}
+		for _, child := range listing.Data.Children {
+			d := child.Data
+			posts = append(posts, Post{
+				ID:   d.ID,
+				Text: d.Title + "\n" + d.Selftext,
+				Time: time.Unix(int64(d.CreatedUTC), 0),
+			})
+		}
+	}
+	return posts, nil
+}
+
+// WeiboSource 按关键词搜索微博移动端的实时结果
+type WeiboSource struct {
+	URL      string
+	Keywords []string
+	HTTP     *http.Client
+}
+
+type weiboSearch struct {
+	Data struct {
+		Cards []struct {
+			Mblog *struct {
+				ID        string `json:"id"`
+				Text      string `json:"text"`
+				CreatedAt string `json:"created_at"`
+			} `json:"mblog"`
+		} `json:"cards"`
+	} `json:"data"`
+}
+
+func (s *WeiboSource) Name() string {
+	return "weibo"
+}
+
+func (s *WeiboSource) Fetch(ctx context.Context) ([]Post, error) {
+	var posts []Post
+	for _, keyword := range s.Keywords {
+		params := url.Values{}
+		params.Set("containerid", "100103type=61&q="+keyword)
+		params.Set("page_type", "searchall")
+
+		var result weiboSearch
+		if err := getJSON(ctx, s.HTTP, s.URL+"?"+params.Encode(), &result); err != nil {
+			return posts, fmt.Errorf("weibo %q: %w", keyword, err)
+		}
+		for _, card := range result.Data.Cards {
+			if card.Mblog == nil {
+				continue
+			}
+			createdAt, err := time.Parse(time.RubyDate, card.Mblog.CreatedAt)
+			if err != nil {
+				createdAt = time.Now()
+			}
+			posts = append(posts, Post{
+				ID:   card.Mblog.ID,
+				Text: card.Mblog.Text,
+				Time: createdAt,
+			})
+		}
+	}
+	return posts, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
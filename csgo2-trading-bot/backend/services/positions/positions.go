@@ -0,0 +1,97 @@
+package positions
+
+import (
+	"csgo2-trading-bot/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Buy 买入quantity件，cost为含手续费的总成本，按移动平均更新持仓成本。
+// 应传入事务句柄，与成交记录和资金流水一同提交
+func Buy(db *gorm.DB, userID, itemID uint, quantity int, cost float64) error {
+	if quantity <= 0 {
+		return nil
+	}
+	position, err := lock(db, userID, itemID)
+	if err != nil {
+		return err
+	}
+	total := position.AvgPrice*float64(position.Quantity) + cost
+	position.Quantity += quantity
+	return db.Model(position).Updates(map[string]interface{}{
+		"quantity":  position.Quantity,
+		"avg_price": total / float64(position.Quantity),
+	}).Error
+}
+
+// Sell 卖出quantity件，proceeds为扣除手续费后的到账金额，按平均成本计入已实现盈亏并返回本次盈亏。
+// 持仓清空后平均成本归零，下次买入重新计算
+func Sell(db *gorm.DB, userID, itemID uint, quantity int, proceeds float64) (float64, error) {
+	if quantity <= 0 {
+		return 0, nil
+	}
+	position, err := lock(db, userID, itemID)
+	if err != nil {
+		return 0, err
+	}
+	realized := proceeds - position.AvgPrice*float64(quantity)
+	return realized, reduce(db, position, quantity, realized)
+}
+
+// Remove 不经交易减少持仓（管理员调整库存等），不产生盈亏
+func Remove(db *gorm.DB, userID, itemID uint, quantity int) error {
+	if quantity <= 0 {
+		return nil
+	}
+	position, err := lock(db, userID, itemID)
+	if err != nil {
+		return err
+	}
+	return reduce(db, position, quantity, 0)
+}
+
+// List 用户的持仓，按物品当前价格计算市值和未实现盈亏；已清仓但有已实现盈亏的物品一并返回
+func List(db *gorm.DB, userID uint) ([]models.Position, error) {
+	var positions []models.Position
+	err := db.Preload("Item").
+		Where("user_id = ? AND (quantity > 0 OR realized_pnl <> 0)", userID).
+		Order("item_id").
+		Find(&positions).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range positions {
+		p := &positions[i]
+		if p.Quantity > 0 && p.Item.CurrentPrice > 0 {
+			p.MarketValue = p.Item.CurrentPrice * float64(p.Quantity)
+			p.UnrealizedPnL = p.MarketValue - p.AvgPrice*float64(p.Quantity)
+		}
+	}
+	return positions, nil
+}
+
+// lock 锁定用户在该物品上的持仓，没有时先建立空持仓
+func lock(db *gorm.DB, userID, itemID uint) (*models.Position, error) {
+	position := models.Position{UserID: userID, ItemID: itemID}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&position).Error; err != nil {
+		return nil, err
+	}
+	position = models.Position{}
+	err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND item_id = ?", userID, itemID).
+		First(&position).Error
+	return &position, err
+}
+
+// reduce 减少持仓数量并累加已实现盈亏；数量超出持仓时（持仓建立前的库存）按清仓处理
+func reduce(db *gorm.DB, position *models.Position, quantity int, realized float64) error {
+	updates := map[string]interface{}{
+		"quantity":     position.Quantity - quantity,
+		"realized_pnl": gorm.Expr("realized_pnl + ?", realized),
+	}
+	if position.Quantity <= quantity {
+		updates["quantity"], updates["avg_price"] = 0, 0
+	}
+	return db.Model(position).Updates(updates).Error
+}
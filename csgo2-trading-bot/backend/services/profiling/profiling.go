@@ -0,0 +1,176 @@
+package profiling
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 保存的剖析类型，文件名为<类型>-<UTC时间>.pprof
+var kinds = []string{"cpu", "heap"}
+
+// ErrNotFound 剖析文件不存在或文件名不合法
+var ErrNotFound = errors.New("profile not found")
+
+// File 一份保存的剖析文件
+type File struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Service 持续剖析：定期采集一段CPU剖析和一次堆剖析保存到本地，只保留最近的若干份，
+// 出现性能退化时可以下载退化前后的剖析对比（go tool pprof -diff_base）
+type Service struct {
+	config config.ProfilingConfig
+	mu     sync.Mutex // 同一时间只能有一个CPU剖析
+}
+
+func NewService(cfg config.ProfilingConfig) *Service {
+	return &Service{config: cfg}
+}
+
+// Start 开启持续剖析时注册采集任务
+func (s *Service) Start(sched *scheduler.Scheduler) error {
+	if !s.config.Continuous {
+		return nil
+	}
+	if err := os.MkdirAll(s.config.Dir, 0o750); err != nil {
+		return err
+	}
+	return sched.Add(scheduler.Job{
+		ID:   "continuous_profiling",
+		Spec: (time.Duration(s.config.Interval) * time.Second).String(),
+		Run:  s.Capture,
+	})
+}
+
+// Capture 采集一次CPU和堆剖析并清理超出保留数量的旧文件
+func (s *Service) Capture() {
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	if err := s.captureCPU(stamp); err != nil {
+		logrus.Warnf("CPU profile skipped: %v", err)
+	}
+	if err := s.write("heap", stamp); err != nil {
+		logrus.Warnf("Heap profile skipped: %v", err)
+	}
+	for _, kind := range kinds {
+		s.prune(kind)
+	}
+}
+
+// captureCPU 采样cpu_duration秒；管理员正在通过pprof接口采集CPU剖析时会失败，本次跳过
+func (s *Service) captureCPU(stamp string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.path("cpu", stamp)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := pprof.StartCPUProfile(f); err != nil {
+		os.Remove(path)
+		return err
+	}
+	time.Sleep(time.Duration(s.config.CPUDuration) * time.Second)
+	pprof.StopCPUProfile()
+	return nil
+}
+
+// write 保存runtime/pprof中的一种剖析
+func (s *Service) write(kind, stamp string) error {
+	profile := pprof.Lookup(kind)
+	if profile == nil {
+		return fmt.Errorf("unknown profile %s", kind)
+	}
+	f, err := os.Create(s.path(kind, stamp))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return profile.WriteTo(f, 0)
+}
+
+// prune 每种剖析只保留最近keep份
+func (s *Service) prune(kind string) {
+	files, err := filepath.Glob(filepath.Join(s.config.Dir, kind+"-*.pprof"))
+	if err != nil || len(files) <= s.config.Keep {
+		return
+	}
+	sort.Strings(files)
+	for _, f := range files[:len(files)-s.config.Keep] {
+		if err := os.Remove(f); err != nil {
+			logrus.Warnf("Failed to remove old profile %s: %v", f, err)
+		}
+	}
+}
+
+// List 保存的剖析文件，最新的在前
+func (s *Service) List() ([]File, error) {
+	entries, err := os.ReadDir(s.config.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []File{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]File, 0, len(entries))
+	for _, entry := range entries {
+		kind, ok := kindOf(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, File{Name: entry.Name(), Kind: kind, Size: info.Size(), CreatedAt: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name > files[j].Name })
+	return files, nil
+}
+
+// Path 剖析文件的本地路径，只接受List返回的文件名
+func (s *Service) Path(name string) (string, error) {
+	if _, ok := kindOf(name); !ok || filepath.Base(name) != name {
+		return "", ErrNotFound
+	}
+	path := filepath.Join(s.config.Dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+func (s *Service) path(kind, stamp string) string {
+	return filepath.Join(s.config.Dir, kind+"-"+stamp+".pprof")
+}
+
+func kindOf(name string) (string, bool) {
+	kind, rest, found := strings.Cut(name, "-")
+	if !found || !strings.HasSuffix(rest, ".pprof") {
+		return "", false
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return kind, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,312 @@
+package proxypool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 健康分的平滑系数，越大越看重最近的请求
+const scoreAlpha = 0.2
+
+// ErrNoProxy 所有代理都在冷却中且不允许直连
+var ErrNoProxy = errors.New("no proxy available")
+
+// Stats 单个代理的状态，地址中的密码已隐藏
+type Stats struct {
+	Proxy         string     `json:"proxy"`
+	Source        string     `json:"source"` // static或provider
+	Score         float64    `json:"score"`
+	Requests      int64      `json:"requests"`
+	Failures      int64      `json:"failures"`
+	RateLimited   int64      `json:"rate_limited"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+type proxy struct {
+	url           *url.URL
+	source        string
+	score         float64
+	requests      int64
+	failures      int64
+	rateLimited   int64
+	streak        int // 连续429的次数，决定冷却时间
+	cooldownUntil time.Time
+	lastError     string
+}
+
+// Pool 轮换代理池：按顺序轮流使用可用代理，429后冷却，健康分过低时暂停
+type Pool struct {
+	name   string
+	http   *http.Client // 请求服务商列表接口，不经过代理池
+	config config.ProxyPoolConfig
+
+	mu      sync.Mutex
+	proxies []*proxy
+	next    int
+}
+
+// New 以静态列表创建代理池，配置了服务商接口时还需调用Start定期刷新
+func New(name string, cfg config.ProxyPoolConfig, httpClient *http.Client) (*Pool, error) {
+	p := &Pool{
+		name:   name,
+		http:   httpClient,
+		config: cfg,
+	}
+	for _, raw := range cfg.Proxies {
+		u, err := parseProxy(raw)
+		if err != nil {
+			return nil, err
+		}
+		p.proxies = append(p.proxies, &proxy{url: u, source: "static", score: 1})
+	}
+	if len(p.proxies) == 0 && cfg.ProviderURL == "" {
+		return nil, fmt.Errorf("%s proxy pool requires proxies or provider_url", name)
+	}
+	return p, nil
+}
+
+// Start 立即拉取一次服务商列表并注册定期刷新任务
+func (p *Pool) Start(sched *scheduler.Scheduler) error {
+	if p.config.ProviderURL == "" {
+		return nil
+	}
+	p.Refresh()
+	return sched.Add(scheduler.Job{
+		ID:   p.name + "_proxy_refresh",
+		Spec: (time.Duration(p.config.ProviderInterval) * time.Second).String(),
+		Run:  p.Refresh,
+	})
+}
+
+// Acquire 选择下一个可用代理；没有可用代理时，允许直连则返回nil，否则返回ErrNoProxy
+func (p *Pool) Acquire() (*url.URL, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for i := 0; i < len(p.proxies); i++ {
+		px := p.proxies[(p.next+i)%len(p.proxies)]
+		if now.Before(px.cooldownUntil) {
+			continue
+		}
+		if px.score < p.config.MinScore {
+			// 冷却结束后给一次机会，再次失败会重新进入冷却
+			px.score = p.config.MinScore
+		}
+		p.next = (p.next + i + 1) % len(p.proxies)
+		px.requests++
+		return px.url, nil
+	}
+	if p.config.AllowDirect {
+		return nil, nil
+	}
+	return nil, ErrNoProxy
+}
+
+// Report 记录使用proxyURL的请求结果并更新健康分和冷却状态
+func (p *Pool) Report(proxyURL *url.URL, resp *http.Response, err error) {
+	if proxyURL == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	px := p.find(proxyURL.String())
+	if px == nil {
+		return
+	}
+	now := time.Now()
+
+	switch {
+	case err != nil:
+		px.failures++
+		px.lastError = err.Error()
+		p.degrade(px, now)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		px.rateLimited++
+		px.streak++
+		px.lastError = resp.Status
+		px.cooldownUntil = now.Add(p.rateLimitCooldown(px.streak, resp))
+		logrus.Warnf("%s proxy %s rate limited, cooling down until %s", p.name, px.url.Redacted(), px.cooldownUntil.Format(time.RFC3339))
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusProxyAuthRequired || resp.StatusCode >= 500:
+		// 403多为出口IP被封，407为代理认证失败，5xx可能来自代理本身
+		px.failures++
+		px.lastError = resp.Status
+		p.degrade(px, now)
+	default:
+		px.streak = 0
+		px.score = px.score*(1-scoreAlpha) + scoreAlpha
+	}
+}
+
+// degrade 降低健康分，低于下限时进入冷却
+func (p *Pool) degrade(px *proxy, now time.Time) {
+	px.score *= 1 - scoreAlpha
+	if px.score < p.config.MinScore {
+		px.cooldownUntil = now.Add(time.Duration(p.config.ErrorCooldown) * time.Second)
+		logrus.Warnf("%s proxy %s unhealthy (score %.2f): %s", p.name, px.url.Redacted(), px.score, px.lastError)
+	}
+}
+
+// rateLimitCooldown 第streak次连续429的冷却时间，响应带Retry-After时取两者较大值
+func (p *Pool) rateLimitCooldown(streak int, resp *http.Response) time.Duration {
+	base := time.Duration(p.config.Cooldown) * time.Second
+	limit := time.Duration(p.config.MaxCooldown) * time.Second
+	cooldown := base << (streak - 1)
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		cooldown = max(cooldown, time.Duration(seconds)*time.Second)
+	}
+	if cooldown <= 0 || (limit > 0 && cooldown > limit) {
+		cooldown = limit
+	}
+	return cooldown
+}
+
+// Refresh 拉取服务商的代理列表，保留仍在列表中的代理的状态，移除不在列表中的服务商代理
+func (p *Pool) Refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	list, err := p.fetchProvider(ctx)
+	if err != nil {
+		logrus.Errorf("Failed to refresh %s proxy list: %v", p.name, err)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := make(map[string]*proxy, len(p.proxies))
+	var proxies []*proxy
+	for _, px := range p.proxies {
+		if px.source == "static" {
+			proxies = append(proxies, px)
+		}
+		existing[px.url.String()] = px
+	}
+	for _, u := range list {
+		if px, ok := existing[u.String()]; ok {
+			if px.source == "provider" {
+				proxies = append(proxies, px)
+			}
+			continue
+		}
+		proxies = append(proxies, &proxy{url: u, source: "provider", score: 1})
+	}
+	p.proxies = proxies
+	p.next = 0
+	logrus.Infof("%s proxy pool refreshed: %d proxies", p.name, len(proxies))
+}
+
+// fetchProvider 服务商接口返回JSON字符串数组或每行一个代理
+func (p *Pool) fetchProvider(ctx context.Context) ([]*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.ProviderURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("provider returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	if err := json.Unmarshal(body, &lines); err != nil {
+		lines = strings.Split(string(body), "\n")
+	}
+	var list []*url.URL
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := parseProxy(line)
+		if err != nil {
+			logrus.Warnf("Skipping invalid %s proxy from provider: %v", p.name, err)
+			continue
+		}
+		list = append(list, u)
+	}
+	if len(list) == 0 {
+		return nil, errors.New("provider returned no proxies")
+	}
+	return list, nil
+}
+
+// Stats 各代理的状态，按健康分降序
+func (p *Pool) Stats() []Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]Stats, 0, len(p.proxies))
+	for _, px := range p.proxies {
+		s := Stats{
+			Proxy:       px.url.Redacted(),
+			Source:      px.source,
+			Score:       px.score,
+			Requests:    px.requests,
+			Failures:    px.failures,
+			RateLimited: px.rateLimited,
+			LastError:   px.lastError,
+		}
+		if now.Before(px.cooldownUntil) {
+			until := px.cooldownUntil
+			s.CooldownUntil = &until
+		}
+		stats = append(stats, s)
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Score > stats[j].Score })
+	return stats
+}
+
+func (p *Pool) find(key string) *proxy {
+	for _, px := range p.proxies {
+		if px.url.String() == key {
+			return px
+		}
+	}
+	return nil
+}
+
+// parseProxy 解析代理地址，没有协议时按http处理
+func parseProxy(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		// 不在错误中输出原始地址，其中可能带有代理密码
+		return nil, errors.New("invalid proxy address")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	return u, nil
+}
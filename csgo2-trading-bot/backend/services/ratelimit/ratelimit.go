@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"csgo2-trading-bot/config"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// 限流维度
+const (
+	ByIP   = "ip"
+	ByUser = "user"
+)
+
+const keyPrefix = "ratelimit:"
+
+// Redis不可用时告警日志的最小间隔
+const warnInterval = time.Minute
+
+// slidingWindow 滑动窗口计数：有序集合保存窗口内每个请求的时间戳（毫秒），
+// 先清理窗口外的记录，未达上限时记入本次请求；达到上限时返回最早一条记录离开窗口的剩余时间
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	return {1, limit - count - 1, 0}
+end
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local retry = window
+if oldest[2] then
+	retry = tonumber(oldest[2]) + window - now
+end
+return {0, 0, retry}
+`)
+
+// Rule 一条限流规则
+type Rule struct {
+	Name   string // 计数键的一部分，区分全局限流和各接口限流
+	Limit  int
+	Window time.Duration
+}
+
+// Result 一次限流判断的结果
+type Result struct {
+	Rule       Rule
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Limiter 多实例共享计数的限流器
+type Limiter struct {
+	redis    redis.UniversalClient
+	config   config.RateLimitConfig
+	routes   map[string]config.RouteRateLimit
+	instance string // 区分不同实例写入的同一毫秒的请求
+	seq      atomic.Uint64
+	warnedAt atomic.Int64
+}
+
+func NewLimiter(redisClient redis.UniversalClient, cfg config.RateLimitConfig) *Limiter {
+	routes := make(map[string]config.RouteRateLimit, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		if route.By == "" {
+			route.By = ByUser
+		}
+		routes[strings.ToUpper(route.Method)+" "+route.Path] = route
+	}
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return &Limiter{
+		redis:    redisClient,
+		config:   cfg,
+		routes:   routes,
+		instance: hex.EncodeToString(buf),
+	}
+}
+
+// Enabled 是否启用限流
+func (l *Limiter) Enabled() bool {
+	return l.config.Enabled
+}
+
+// Rules by维度下该接口适用的规则：全局上限和接口单独的上限
+func (l *Limiter) Rules(by, method, path string) []Rule {
+	window := time.Duration(l.config.Window) * time.Second
+	var rules []Rule
+
+	global := l.config.PerIP
+	if by == ByUser {
+		global = l.config.PerUser
+	}
+	if global > 0 {
+		rules = append(rules, Rule{Name: "all", Limit: global, Window: window})
+	}
+
+	if route, ok := l.routes[method+" "+path]; ok && route.By == by && route.Limit > 0 {
+		routeWindow := window
+		if route.Window > 0 {
+			routeWindow = time.Duration(route.Window) * time.Second
+		}
+		rules = append(rules, Rule{Name: method + " " + path, Limit: route.Limit, Window: routeWindow})
+	}
+	return rules
+}
+
+// Allow 依次检查规则，返回第一条被拒绝的结果；全部通过时返回剩余次数最少的结果。
+// 按用户计数时同时累计每小时的请求数用于用量统计。Redis不可用时按fail_open放行或拒绝
+func (l *Limiter) Allow(ctx context.Context, by, identity string, rules []Rule) (*Result, error) {
+	result, err := l.check(ctx, by, identity, rules)
+	if err == nil && by == ByUser && len(rules) > 0 {
+		l.recordUsage(ctx, identity, result == nil || result.Allowed)
+	}
+	return result, err
+}
+
+func (l *Limiter) check(ctx context.Context, by, identity string, rules []Rule) (*Result, error) {
+	var tightest *Result
+	for _, rule := range rules {
+		result, err := l.allow(ctx, by, identity, rule)
+		if err != nil {
+			l.warn(err)
+			if l.config.FailOpen {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if !result.Allowed {
+			return result, nil
+		}
+		if tightest == nil || result.Remaining < tightest.Remaining {
+			tightest = result
+		}
+	}
+	return tightest, nil
+}
+
+func (l *Limiter) allow(ctx context.Context, by, identity string, rule Rule) (*Result, error) {
+	now := time.Now().UnixMilli()
+	key := keyPrefix + by + ":" + identity + ":" + rule.Name
+	member := fmt.Sprintf("%d-%s-%d", now, l.instance, l.seq.Add(1))
+
+	values, err := slidingWindow.Run(ctx, l.redis, []string{key}, now, rule.Window.Milliseconds(), rule.Limit, member).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 3 {
+		return nil, fmt.Errorf("unexpected rate limit script result: %v", values)
+	}
+	return &Result{
+		Rule:       rule,
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+// warn Redis不可用时限频输出告警
+func (l *Limiter) warn(err error) {
+	now := time.Now().UnixNano()
+	last := l.warnedAt.Load()
+	if now-last < int64(warnInterval) || !l.warnedAt.CompareAndSwap(last, now) {
+		return
+	}
+	logrus.Warnf("Rate limiter unavailable: %v", err)
+}
@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 按小时汇总的用户请求数，键为 ratelimit:usage:<用户>:<UTC小时>
+const (
+	usagePrefix = keyPrefix + "usage:"
+	usageLayout = "2006010215"
+)
+
+// RuleUsage 一条限流规则在当前窗口内的用量
+type RuleUsage struct {
+	Rule      string    `json:"rule"` // all表示全部接口合计，其余为 方法 路径
+	Limit     int       `json:"limit"`
+	Window    int       `json:"window"` // 秒
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at,omitempty"` // 最早一次请求离开窗口的时间，窗口内没有请求时为空
+}
+
+// UsageHour 一小时内的请求数和被限流拒绝的次数
+type UsageHour struct {
+	Hour     time.Time `json:"hour"`
+	Requests int64     `json:"requests"`
+	Rejected int64     `json:"rejected"`
+}
+
+// UserRules 适用于登录用户的全部规则：全局上限和按用户计数的接口上限
+func (l *Limiter) UserRules() []Rule {
+	rules := l.Rules(ByUser, "", "")
+	window := time.Duration(l.config.Window) * time.Second
+	for key, route := range l.routes {
+		if route.By != ByUser || route.Limit <= 0 {
+			continue
+		}
+		routeWindow := window
+		if route.Window > 0 {
+			routeWindow = time.Duration(route.Window) * time.Second
+		}
+		rules = append(rules, Rule{Name: key, Limit: route.Limit, Window: routeWindow})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// Usage 用户在各规则当前窗口内的用量，只读取计数不记入请求
+func (l *Limiter) Usage(ctx context.Context, userID uint) ([]RuleUsage, error) {
+	identity := strconv.FormatUint(uint64(userID), 10)
+	rules := l.UserRules()
+	now := time.Now()
+
+	pipe := l.redis.Pipeline()
+	counts := make([]*redis.IntCmd, len(rules))
+	oldest := make([]*redis.ZSliceCmd, len(rules))
+	for i, rule := range rules {
+		key := keyPrefix + ByUser + ":" + identity + ":" + rule.Name
+		min := strconv.FormatInt(now.Add(-rule.Window).UnixMilli(), 10)
+		counts[i] = pipe.ZCount(ctx, key, "("+min, "+inf")
+		oldest[i] = pipe.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: "(" + min, Max: "+inf", Count: 1})
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	usage := make([]RuleUsage, 0, len(rules))
+	for i, rule := range rules {
+		used := int(counts[i].Val())
+		u := RuleUsage{
+			Rule:      rule.Name,
+			Limit:     rule.Limit,
+			Window:    int(rule.Window.Seconds()),
+			Used:      used,
+			Remaining: max(rule.Limit-used, 0),
+		}
+		if z := oldest[i].Val(); len(z) > 0 {
+			u.ResetAt = time.UnixMilli(int64(z[0].Score)).Add(rule.Window)
+		}
+		usage = append(usage, u)
+	}
+	return usage, nil
+}
+
+// UsageHistory 用户最近hours小时的每小时请求数，最早的在前，没有请求的小时计为0。
+// hours超出保留期时按保留期返回
+func (l *Limiter) UsageHistory(ctx context.Context, userID uint, hours int) ([]UsageHour, error) {
+	if limit := l.config.HistoryDays * 24; hours <= 0 || hours > limit {
+		hours = limit
+	}
+	identity := strconv.FormatUint(uint64(userID), 10)
+	start := time.Now().UTC().Truncate(time.Hour).Add(-time.Duration(hours-1) * time.Hour)
+
+	pipe := l.redis.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, hours)
+	for i := range cmds {
+		hour := start.Add(time.Duration(i) * time.Hour)
+		cmds[i] = pipe.HGetAll(ctx, usagePrefix+identity+":"+hour.Format(usageLayout))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	history := make([]UsageHour, hours)
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		requests, _ := strconv.ParseInt(fields["requests"], 10, 64)
+		rejected, _ := strconv.ParseInt(fields["rejected"], 10, 64)
+		history[i] = UsageHour{Hour: start.Add(time.Duration(i) * time.Hour), Requests: requests, Rejected: rejected}
+	}
+	return history, nil
+}
+
+// recordUsage 累计登录用户本小时的请求数，失败时只影响历史统计，不影响限流
+func (l *Limiter) recordUsage(ctx context.Context, identity string, allowed bool) {
+	key := usagePrefix + identity + ":" + time.Now().UTC().Format(usageLayout)
+	pipe := l.redis.Pipeline()
+	pipe.HIncrBy(ctx, key, "requests", 1)
+	if !allowed {
+		pipe.HIncrBy(ctx, key, "rejected", 1)
+	}
+	pipe.Expire(ctx, key, time.Duration(l.config.HistoryDays)*24*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		l.warn(err)
+	}
+}
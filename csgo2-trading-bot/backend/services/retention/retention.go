@@ -0,0 +1,244 @@
+package retention
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrRunning 已有任务在执行
+var ErrRunning = errors.New("retention run already in progress")
+
+// 降采样SQL：按天分批，将源数据聚合写入price_aggregates后删除源数据。
+// 重复执行时与已有K线合并，保证任务中断后可以安全重跑。
+const (
+	hourlyInsert = `
+		INSERT INTO price_aggregates (item_id, platform, resolution, bucket, open, high, low, close, avg, volume, samples)
+		SELECT item_id, platform, 'hour', date_trunc('hour', recorded_at),
+		       (array_agg(price ORDER BY recorded_at))[1],
+		       MAX(price), MIN(price),
+		       (array_agg(price ORDER BY recorded_at DESC))[1],
+		       AVG(price), COALESCE(SUM(volume), 0), COUNT(*)
+		FROM price_histories
+		WHERE recorded_at >= ? AND recorded_at < ?
+		GROUP BY item_id, platform, date_trunc('hour', recorded_at)` + mergeAggregate
+
+	hourlyPurge = `DELETE FROM price_histories WHERE recorded_at >= ? AND recorded_at < ?`
+
+	dailyInsert = `
+		INSERT INTO price_aggregates (item_id, platform, resolution, bucket, open, high, low, close, avg, volume, samples)
+		SELECT item_id, platform, 'day', date_trunc('day', bucket),
+		       (array_agg(open ORDER BY bucket))[1],
+		       MAX(high), MIN(low),
+		       (array_agg(close ORDER BY bucket DESC))[1],
+		       SUM(avg * samples) / NULLIF(SUM(samples), 0), SUM(volume), SUM(samples)
+		FROM price_aggregates
+		WHERE resolution = 'hour' AND bucket >= ? AND bucket < ?
+		GROUP BY item_id, platform, date_trunc('day', bucket)` + mergeAggregate
+
+	dailyPurge = `DELETE FROM price_aggregates WHERE resolution = 'hour' AND bucket >= ? AND bucket < ?`
+
+	mergeAggregate = `
+		ON CONFLICT (item_id, platform, resolution, bucket) DO UPDATE SET
+			high = GREATEST(price_aggregates.high, EXCLUDED.high),
+			low = LEAST(price_aggregates.low, EXCLUDED.low),
+			close = EXCLUDED.close,
+			avg = (price_aggregates.avg * price_aggregates.samples + EXCLUDED.avg * EXCLUDED.samples)
+			      / NULLIF(price_aggregates.samples + EXCLUDED.samples, 0),
+			volume = price_aggregates.volume + EXCLUDED.volume,
+			samples = price_aggregates.samples + EXCLUDED.samples`
+)
+
+// stage 一个降采样阶段
+type stage struct {
+	name      string
+	oldest    string
+	insert    string
+	purge     string
+	keepDays  int
+	progress0 float64
+	progress1 float64
+}
+
+// Service 价格数据降采样与清理，同一时间只允许一个任务执行
+type Service struct {
+	db      *gorm.DB
+	config  config.RetentionConfig
+	running atomic.Bool
+}
+
+func NewService(db *gorm.DB, cfg config.RetentionConfig) *Service {
+	return &Service{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// Run 同步执行一次任务，供定时任务调用
+func (s *Service) Run(trigger string) (*models.RetentionRun, error) {
+	run, err := s.begin(trigger)
+	if err != nil {
+		return nil, err
+	}
+	s.execute(run)
+	return run, nil
+}
+
+// Start 异步执行一次任务，立即返回执行记录以便查询进度
+func (s *Service) Start(trigger string) (*models.RetentionRun, error) {
+	run, err := s.begin(trigger)
+	if err != nil {
+		return nil, err
+	}
+	go s.execute(run)
+	return run, nil
+}
+
+// Running 是否有任务在执行
+func (s *Service) Running() bool {
+	return s.running.Load()
+}
+
+// ListRuns 获取最近的执行记录
+func (s *Service) ListRuns(limit int) ([]models.RetentionRun, error) {
+	var runs []models.RetentionRun
+	err := s.db.Order("id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// GetRun 获取单次执行记录
+func (s *Service) GetRun(id uint) (*models.RetentionRun, error) {
+	var run models.RetentionRun
+	if err := s.db.First(&run, id).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (s *Service) begin(trigger string) (*models.RetentionRun, error) {
+	if !s.running.CompareAndSwap(false, true) {
+		return nil, ErrRunning
+	}
+
+	run := &models.RetentionRun{
+		Trigger:   trigger,
+		Status:    "running",
+		StartedAt: time.Now(),
+	}
+	if err := s.db.Create(run).Error; err != nil {
+		s.running.Store(false)
+		return nil, err
+	}
+	return run, nil
+}
+
+func (s *Service) execute(run *models.RetentionRun) {
+	defer s.running.Store(false)
+
+	stages := []stage{
+		{
+			name:      "hourly",
+			oldest:    "SELECT MIN(recorded_at) FROM price_histories",
+			insert:    hourlyInsert,
+			purge:     hourlyPurge,
+			keepDays:  s.config.RawDays,
+			progress0: 0,
+			progress1: 50,
+		},
+		{
+			name:      "daily",
+			oldest:    "SELECT MIN(bucket) FROM price_aggregates WHERE resolution = 'hour'",
+			insert:    dailyInsert,
+			purge:     dailyPurge,
+			keepDays:  s.config.HourlyDays,
+			progress0: 50,
+			progress1: 100,
+		},
+	}
+
+	var err error
+	for _, st := range stages {
+		// 保留天数为0表示该阶段不降采样
+		if st.keepDays <= 0 {
+			continue
+		}
+		if err = s.downsample(run, st); err != nil {
+			break
+		}
+	}
+
+	now := time.Now()
+	run.FinishedAt = &now
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+		logrus.Errorf("Price retention run %d failed: %v", run.ID, err)
+	} else {
+		run.Status = "completed"
+		run.Progress = 100
+		logrus.Infof("Price retention run %d completed: %d aggregates, %d rows purged", run.ID, run.Aggregated, run.Purged)
+	}
+	s.db.Save(run)
+}
+
+// downsample 按天处理早于保留期的数据，每天一个事务并更新进度
+func (s *Service) downsample(run *models.RetentionRun, st stage) error {
+	run.Stage = st.name
+	run.Progress = st.progress0
+	s.db.Save(run)
+
+	now := time.Now()
+	cutoff := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -st.keepDays)
+
+	var oldest sql.NullTime
+	if err := s.db.Raw(st.oldest).Scan(&oldest).Error; err != nil {
+		return err
+	}
+	if !oldest.Valid || !oldest.Time.Before(cutoff) {
+		return nil
+	}
+
+	start := oldest.Time.In(now.Location())
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, now.Location())
+	totalDays := cutoff.Sub(start).Hours() / 24
+
+	for day := start; day.Before(cutoff); day = day.AddDate(0, 0, 1) {
+		end := day.AddDate(0, 0, 1)
+
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			inserted := tx.Exec(st.insert, day, end)
+			if inserted.Error != nil {
+				return inserted.Error
+			}
+			purged := tx.Exec(st.purge, day, end)
+			if purged.Error != nil {
+				return purged.Error
+			}
+
+			run.Aggregated += inserted.RowsAffected
+			run.Purged += purged.RowsAffected
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s downsample of %s: %v", st.name, day.Format("2006-01-02"), err)
+		}
+
+		done := end.Sub(start).Hours() / 24
+		run.Progress = st.progress0 + (st.progress1-st.progress0)*done/totalDays
+		s.db.Model(run).Updates(map[string]interface{}{
+			"progress":   run.Progress,
+			"aggregated": run.Aggregated,
+			"purged":     run.Purged,
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package scheduler
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultSchedule 未声明调度表达式时的默认周期
+const DefaultSchedule = "@every 1m"
+
+var parser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// Job 调度任务
+type Job struct {
+	ID            string
+	Spec          string        // cron表达式、@every 30s 或 5m 形式的间隔
+	Jitter        time.Duration // 每次触发前的随机延迟上限
+	MaxConcurrent int           // 同一任务允许同时运行的实例数
+	Run           func()
+}
+
+type entry struct {
+	job      Job
+	schedule cron.Schedule
+	next     time.Time
+}
+
+// Scheduler 集中管理所有周期任务，取代每个任务单独一个goroutine
+type Scheduler struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	running map[string]int // 按任务ID统计运行中的实例，任务被替换后仍然有效
+	stop    chan struct{}
+	paused  bool
+}
+
+func New() *Scheduler {
+	return &Scheduler{
+		entries: make(map[string]*entry),
+		running: make(map[string]int),
+		stop:    make(chan struct{}),
+	}
+}
+
+// ParseSpec 解析调度表达式，支持cron表达式和时间间隔
+func ParseSpec(spec string) (cron.Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		spec = DefaultSchedule
+	}
+
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d <= 0 {
+			return nil, errors.New("interval must be positive")
+		}
+		return cron.Every(d), nil
+	}
+
+	return parser.Parse(spec)
+}
+
+// Add 添加或替换任务
+func (s *Scheduler) Add(job Job) error {
+	schedule, err := ParseSpec(job.Spec)
+	if err != nil {
+		return err
+	}
+	if job.MaxConcurrent <= 0 {
+		job.MaxConcurrent = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[job.ID] = &entry{
+		job:      job,
+		schedule: schedule,
+		next:     schedule.Next(time.Now()),
+	}
+
+	return nil
+}
+
+// Remove 移除任务，已在运行的实例会执行完毕
+func (s *Scheduler) Remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, id)
+}
+
+// Start 启动调度循环
+func (s *Scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				s.dispatch(now)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止调度循环
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+// Pause 暂停调度，不再触发新的任务实例
+func (s *Scheduler) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paused = true
+}
+
+// Resume 恢复调度
+func (s *Scheduler) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.paused = false
+}
+
+// Paused 调度是否已暂停
+func (s *Scheduler) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.paused
+}
+
+func (s *Scheduler) dispatch(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paused {
+		return
+	}
+
+	for _, e := range s.entries {
+		if now.Before(e.next) {
+			continue
+		}
+		e.next = e.schedule.Next(now)
+
+		id := e.job.ID
+		if s.running[id] >= e.job.MaxConcurrent {
+			logrus.Warnf("Scheduler: job %s skipped, %d instance(s) still running", id, s.running[id])
+			continue
+		}
+
+		s.running[id]++
+		go s.run(e.job)
+	}
+}
+
+func (s *Scheduler) run(job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.Errorf("Scheduler: job %s panicked: %v", job.ID, r)
+		}
+
+		s.mu.Lock()
+		s.running[job.ID]--
+		if s.running[job.ID] <= 0 {
+			delete(s.running, job.ID)
+		}
+		s.mu.Unlock()
+	}()
+
+	if job.Jitter > 0 {
+		time.Sleep(time.Duration(rand.Int63n(int64(job.Jitter))))
+	}
+
+	job.Run()
+}
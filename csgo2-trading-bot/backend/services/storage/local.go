@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DownloadPath local驱动下载链接的路由前缀
+const DownloadPath = "/api/v1/files/download/"
+
+// signingScope 派生签名密钥，避免下载签名与其他用途的签名混用
+const signingScope = "storage_download"
+
+// ErrInvalidSignature 下载链接签名无效或已过期
+var ErrInvalidSignature = errors.New("invalid or expired download link")
+
+// LocalStore 保存在本地磁盘，下载链接由本服务校验签名后提供
+type LocalStore struct {
+	dir       string
+	publicURL string
+	key       []byte
+}
+
+func NewLocalStore(dir, publicURL, secret string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingScope))
+	return &LocalStore{
+		dir:       dir,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		key:       mac.Sum(nil),
+	}, nil
+}
+
+// Put 先写临时文件再改名，读取方不会看到写了一半的文件
+func (s *LocalStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// SignedURL 指向本服务下载接口的链接，文件名由下载接口根据文件记录设置
+func (s *LocalStore) SignedURL(key, filename string, expires time.Time) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	params.Set("signature", s.sign(key, expires.Unix()))
+	return s.publicURL + DownloadPath + key + "?" + params.Encode(), nil
+}
+
+// Verify 校验下载链接的签名和有效期
+func (s *LocalStore) Verify(key, expires, signature string) error {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(key, unix))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (s *LocalStore) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path 文件在磁盘上的路径，拒绝跳出存储目录的key
+func (s *LocalStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if key == "" || clean != "/"+key {
+		return "", errors.New("invalid storage key")
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 文件类别
+const (
+	KindReport = "report"
+	KindExport = "export"
+	KindImage  = "image"
+)
+
+// 单次清理最多删除的文件数
+const cleanupBatch = 500
+
+// Download 带有效期的下载链接
+type Download struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Service 用户文件的保存、下载链接签发和过期清理，供报表和导出使用
+type Service struct {
+	db     *gorm.DB
+	store  Store
+	config config.StorageConfig
+}
+
+func NewService(db *gorm.DB, store Store, cfg config.StorageConfig) *Service {
+	return &Service{
+		db:     db,
+		store:  store,
+		config: cfg,
+	}
+}
+
+// Start 注册过期文件清理任务
+func (s *Service) Start(sched *scheduler.Scheduler) error {
+	return sched.Add(scheduler.Job{
+		ID:   "storage_cleanup",
+		Spec: s.config.CleanupSchedule,
+		Run: func() {
+			if _, err := s.Cleanup(context.Background()); err != nil {
+				logrus.Errorf("Storage cleanup failed: %v", err)
+			}
+		},
+	})
+}
+
+// Save 保存用户文件，ttl为零时按retention_days保留，为负数时永久保存
+func (s *Service) Save(ctx context.Context, userID uint, kind, name, contentType string, body io.Reader, ttl time.Duration) (*models.StoredFile, error) {
+	// 先写入临时文件得到长度，S3上传需要Content-Length
+	tmp, err := os.CreateTemp("", "storage-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	suffix, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+	file := models.StoredFile{
+		UserID:      userID,
+		Kind:        kind,
+		Name:        name,
+		Key:         fmt.Sprintf("%s/%d/%s%s", kind, userID, suffix, path.Ext(name)),
+		ContentType: contentType,
+		Size:        size,
+	}
+	if ttl == 0 {
+		ttl = time.Duration(s.config.RetentionDays) * 24 * time.Hour
+	}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		file.ExpiresAt = &expires
+	}
+
+	if err := s.store.Put(ctx, file.Key, tmp, size, contentType); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(&file).Error; err != nil {
+		s.store.Delete(ctx, file.Key)
+		return nil, err
+	}
+	return &file, nil
+}
+
+// List 用户未过期的文件，kind为空时返回全部类别
+func (s *Service) List(userID uint, kind string) ([]models.StoredFile, error) {
+	query := s.db.Where("user_id = ? AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now())
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	var files []models.StoredFile
+	err := query.Order("created_at DESC").Find(&files).Error
+	return files, err
+}
+
+// Get 用户的单个未过期文件
+func (s *Service) Get(userID, fileID uint) (*models.StoredFile, error) {
+	var file models.StoredFile
+	err := s.db.Where("id = ? AND user_id = ?", fileID, userID).First(&file).Error
+	if err != nil || (file.ExpiresAt != nil && file.ExpiresAt.Before(time.Now())) {
+		return nil, ErrNotFound
+	}
+	return &file, nil
+}
+
+// DownloadURL 签发下载链接，链接有效期不超过文件本身的有效期
+func (s *Service) DownloadURL(file *models.StoredFile) (*Download, error) {
+	expires := time.Now().Add(time.Duration(s.config.URLTTL) * time.Second)
+	if file.ExpiresAt != nil && file.ExpiresAt.Before(expires) {
+		expires = *file.ExpiresAt
+	}
+	url, err := s.store.SignedURL(file.Key, file.Name, expires)
+	if err != nil {
+		return nil, err
+	}
+	return &Download{URL: url, ExpiresAt: expires}, nil
+}
+
+// Delete 删除用户的文件
+func (s *Service) Delete(ctx context.Context, userID, fileID uint) error {
+	file, err := s.Get(userID, fileID)
+	if err != nil {
+		return err
+	}
+	return s.remove(ctx, file)
+}
+
+// OpenSigned 校验local驱动的下载链接并打开文件
+func (s *Service) OpenSigned(ctx context.Context, key, expires, signature string) (*models.StoredFile, io.ReadCloser, error) {
+	local, ok := s.store.(*LocalStore)
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	if err := local.Verify(key, expires, signature); err != nil {
+		return nil, nil, err
+	}
+
+	var file models.StoredFile
+	if err := s.db.Where("key = ?", key).First(&file).Error; err != nil {
+		return nil, nil, ErrNotFound
+	}
+	body, err := local.Open(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &file, body, nil
+}
+
+// Cleanup 删除已过期的文件，返回删除数量
+func (s *Service) Cleanup(ctx context.Context) (int, error) {
+	var files []models.StoredFile
+	err := s.db.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).
+		Order("expires_at").
+		Limit(cleanupBatch).
+		Find(&files).Error
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for i := range files {
+		if err := s.remove(ctx, &files[i]); err != nil {
+			logrus.Warnf("Failed to delete expired file %s: %v", files[i].Key, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		logrus.Infof("Storage cleanup removed %d expired files", removed)
+	}
+	return removed, nil
+}
+
+// remove 先删除存储中的文件再删除记录，存储删除失败时保留记录以便下次重试
+func (s *Service) remove(ctx context.Context, file *models.StoredFile) error {
+	if err := s.store.Delete(ctx, file.Key); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return s.db.Delete(file).Error
+}
+
+func randomName() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"csgo2-trading-bot/config"
+)
+
+// ErrNotFound 文件不存在
+var ErrNotFound = errors.New("file not found")
+
+// Store 文件存储后端
+type Store interface {
+	// Put 写入文件，size为内容长度
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Open 读取文件
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete 删除文件，文件不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// SignedURL 生成在expires之前有效的下载链接，filename为下载时的文件名
+	SignedURL(key, filename string, expires time.Time) (string, error)
+}
+
+// NewStore 按配置创建存储后端，secret用于派生local驱动下载链接的签名密钥
+func NewStore(cfg config.StorageConfig, httpClient *http.Client, secret string) (Store, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocalStore(cfg.Dir, cfg.PublicURL, secret)
+	case "s3":
+		return NewS3Store(cfg, httpClient)
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", cfg.Driver)
+	}
+}
@@ -0,0 +1,153 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"csgo2-trading-bot/database"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maintenanceKey      = "system:maintenance"
+	maintenanceInterval = 2 * time.Second
+)
+
+// Maintenance 维护模式：拒绝交易写操作，暂停所有调度任务、订单执行和条件单触发，读接口和行情推送不受影响。
+// 状态保存在Redis中，各实例定期同步；Redis不可用时保持最近一次同步到的状态
+type Maintenance struct {
+	mu        sync.RWMutex
+	status    MaintenanceStatus
+	scheduler *scheduler.Scheduler
+	cache     *database.Cache
+}
+
+// MaintenanceStatus 维护模式状态
+type MaintenanceStatus struct {
+	Enabled   bool       `json:"enabled"`
+	Reason    string     `json:"reason,omitempty"`
+	Since     *time.Time `json:"since,omitempty"`
+	EnabledBy uint       `json:"enabled_by,omitempty"`
+}
+
+func NewMaintenance(sched *scheduler.Scheduler, cache *database.Cache) *Maintenance {
+	m := &Maintenance{scheduler: sched, cache: cache}
+	m.sync()
+	go func() {
+		for range time.Tick(maintenanceInterval) {
+			m.sync()
+		}
+	}()
+	return m
+}
+
+// Enable 开启维护模式
+func (m *Maintenance) Enable(userID uint, reason string) error {
+	status := m.Status()
+	if !status.Enabled {
+		now := time.Now()
+		status.Since = &now
+	}
+	status.Enabled = true
+	status.Reason = reason
+	status.EnabledBy = userID
+	if err := m.save(status); err != nil {
+		return err
+	}
+
+	logrus.Warnf("Maintenance mode enabled by user %d: %s", userID, reason)
+	return nil
+}
+
+// Disable 关闭维护模式
+func (m *Maintenance) Disable(userID uint) error {
+	if err := m.save(MaintenanceStatus{}); err != nil {
+		return err
+	}
+
+	logrus.Warnf("Maintenance mode disabled by user %d", userID)
+	return nil
+}
+
+// Enabled 是否处于维护模式
+func (m *Maintenance) Enabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.status.Enabled
+}
+
+// Status 返回维护模式状态
+func (m *Maintenance) Status() MaintenanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.status
+}
+
+// save 写入Redis后立即在本实例生效，其他实例在下次同步时生效
+func (m *Maintenance) save(status MaintenanceStatus) error {
+	if m.cache != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		var err error
+		if status.Enabled {
+			var b []byte
+			if b, err = json.Marshal(status); err == nil {
+				err = m.cache.Client().Set(ctx, maintenanceKey, b, 0).Err()
+			}
+		} else {
+			err = m.cache.Client().Del(ctx, maintenanceKey).Err()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	m.apply(status)
+	return nil
+}
+
+// sync 从Redis读取其他实例修改的状态
+func (m *Maintenance) sync() {
+	if m.cache == nil || !m.cache.Available() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var status MaintenanceStatus
+	raw, err := m.cache.Client().Get(ctx, maintenanceKey).Bytes()
+	switch {
+	case errors.Is(err, redis.Nil):
+	case err != nil:
+		logrus.Warnf("Failed to sync maintenance mode: %v", err)
+		return
+	default:
+		if err := json.Unmarshal(raw, &status); err != nil {
+			logrus.Warnf("Invalid maintenance mode state: %v", err)
+			return
+		}
+	}
+	m.apply(status)
+}
+
+// apply 更新本实例的状态，进入或退出维护模式时暂停或恢复调度器
+func (m *Maintenance) apply(status MaintenanceStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case status.Enabled && !m.status.Enabled:
+		m.scheduler.Pause()
+	case !status.Enabled && m.status.Enabled:
+		m.scheduler.Resume()
+	}
+	m.status = status
+}
@@ -0,0 +1,396 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/trading"
+	"csgo2-trading-bot/services/webhooks"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrNotLinked 用户尚未绑定Telegram
+var ErrNotLinked = errors.New("telegram is not linked")
+
+// 用户没有设置通知偏好时推送到Telegram的事件
+var defaultEvents = []string{
+	webhooks.EventOrderCompleted,
+	webhooks.EventOrderFailed,
+	webhooks.EventStrategyError,
+	webhooks.EventArbitrageAlert,
+}
+
+const helpText = `可用命令：
+/balance 查看余额
+/orders 查看未成交订单
+/pause-strategy <策略ID> 暂停策略
+/unlink 解除绑定`
+
+// LinkCode 绑定码，用户在Telegram中向机器人发送 /start <code> 完成绑定
+type LinkCode struct {
+	Code      string    `json:"code"`
+	URL       string    `json:"url,omitempty"` // 配置了机器人用户名时生成的一键绑定链接
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Service Telegram机器人：作为通知渠道向绑定的会话推送消息，并响应查询命令
+type Service struct {
+	db      *gorm.DB
+	http    *http.Client
+	trading *trading.Service
+	config  config.TelegramConfig
+}
+
+func NewService(db *gorm.DB, httpClient *http.Client, tradingService *trading.Service, cfg config.TelegramConfig) *Service {
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.telegram.org"
+	}
+	if cfg.PollTimeout <= 0 {
+		cfg.PollTimeout = 30
+	}
+	if cfg.LinkTTL <= 0 {
+		cfg.LinkTTL = 600
+	}
+
+	// 长轮询的等待时间由poll_timeout控制，不受平台默认超时限制
+	client := *httpClient
+	client.Timeout = 0
+
+	return &Service{
+		db:      db,
+		http:    &client,
+		trading: tradingService,
+		config:  cfg,
+	}
+}
+
+// Start 启动消息轮询
+func (s *Service) Start() error {
+	if s.config.Token == "" {
+		return errors.New("telegram token is not configured")
+	}
+	go s.poll()
+	return nil
+}
+
+func (s *Service) Name() string {
+	return "telegram"
+}
+
+func (s *Service) DefaultEvents() []string {
+	return defaultEvents
+}
+
+// Link 生成新的绑定码，已绑定的会话在新绑定码使用前继续有效
+func (s *Service) Link(userID uint) (*LinkCode, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	code := LinkCode{
+		Code:      hex.EncodeToString(buf),
+		ExpiresAt: time.Now().Add(time.Duration(s.config.LinkTTL) * time.Second),
+	}
+	if s.config.Username != "" {
+		code.URL = fmt.Sprintf("https://t.me/%s?start=%s", s.config.Username, code.Code)
+	}
+
+	var link models.TelegramLink
+	err := s.db.Where(models.TelegramLink{UserID: userID}).
+		Assign(map[string]interface{}{"link_code": code.Code, "link_expires_at": code.ExpiresAt}).
+		FirstOrCreate(&link).Error
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// Status 用户的绑定状态
+func (s *Service) Status(userID uint) (*models.TelegramLink, error) {
+	var link models.TelegramLink
+	if err := s.db.Where("user_id = ? AND chat_id IS NOT NULL", userID).First(&link).Error; err != nil {
+		return nil, ErrNotLinked
+	}
+	return &link, nil
+}
+
+// Unlink 解除绑定
+func (s *Service) Unlink(userID uint) error {
+	result := s.db.Where("user_id = ?", userID).Delete(&models.TelegramLink{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotLinked
+	}
+	return nil
+}
+
+// Send 推送到用户绑定的会话，未绑定时返回notify.ErrNotConfigured
+func (s *Service) Send(userID uint, msg notify.Message) error {
+	var link models.TelegramLink
+	if err := s.db.Where("user_id = ? AND chat_id IS NOT NULL", userID).First(&link).Error; err != nil {
+		return notify.ErrNotConfigured
+	}
+	return s.send(*link.ChatID, msg.Title+"\n"+msg.Body)
+}
+
+// poll 长轮询获取机器人收到的消息
+func (s *Service) poll() {
+	var offset int64
+	for {
+		var updates []update
+		err := s.call(context.Background(), "getUpdates", map[string]interface{}{
+			"offset":          offset,
+			"timeout":         s.config.PollTimeout,
+			"allowed_updates": []string{"message"},
+		}, &updates)
+		if err != nil {
+			logrus.Warnf("Telegram getUpdates failed: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message != nil && u.Message.Text != "" {
+				s.handle(u.Message)
+			}
+		}
+	}
+}
+
+// handle 处理一条命令，/start之外的命令需要先绑定
+func (s *Service) handle(msg *message) {
+	fields := strings.Fields(msg.Text)
+	command := strings.ToLower(fields[0])
+	if at := strings.Index(command, "@"); at >= 0 {
+		command = command[:at]
+	}
+	args := fields[1:]
+
+	if command == "/start" {
+		s.reply(msg, s.link(msg, args))
+		return
+	}
+
+	var link models.TelegramLink
+	if err := s.db.Where("chat_id = ?", msg.Chat.ID).First(&link).Error; err != nil {
+		s.reply(msg, "尚未绑定账户，请在网页端生成绑定码后发送 /start <绑定码>")
+		return
+	}
+
+	switch command {
+	case "/balance":
+		s.reply(msg, s.balance(link.UserID))
+	case "/orders":
+		s.reply(msg, s.orders(link.UserID))
+	case "/pause-strategy", "/pause_strategy", "/pause":
+		s.reply(msg, s.pauseStrategy(link.UserID, args))
+	case "/unlink":
+		if err := s.Unlink(link.UserID); err != nil {
+			s.reply(msg, "解除绑定失败，请稍后重试")
+			return
+		}
+		s.reply(msg, "已解除绑定")
+	default:
+		s.reply(msg, helpText)
+	}
+}
+
+// link 用绑定码把会话绑定到用户
+func (s *Service) link(msg *message, args []string) string {
+	if len(args) == 0 {
+		return "请在网页端生成绑定码后发送 /start <绑定码>\n\n" + helpText
+	}
+
+	var link models.TelegramLink
+	err := s.db.Where("link_code = ? AND link_expires_at > ?", args[0], time.Now()).First(&link).Error
+	if err != nil {
+		return "绑定码无效或已过期"
+	}
+
+	now := time.Now()
+	chatID := msg.Chat.ID
+	var username string
+	if msg.From != nil {
+		username = msg.From.Username
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 同一会话只能绑定一个用户
+		if err := tx.Where("chat_id = ? AND user_id <> ?", chatID, link.UserID).Delete(&models.TelegramLink{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&link).Updates(map[string]interface{}{
+			"chat_id":         chatID,
+			"username":        username,
+			"link_code":       "",
+			"link_expires_at": nil,
+			"linked_at":       now,
+		}).Error
+	})
+	if err != nil {
+		logrus.Errorf("Failed to link telegram chat for user %d: %v", link.UserID, err)
+		return "绑定失败，请稍后重试"
+	}
+	return "绑定成功，订单成交、策略错误和套利机会将推送到这里\n\n" + helpText
+}
+
+func (s *Service) balance(userID uint) string {
+	balance, _, err := s.trading.GetLedger(userID, 1)
+	if err != nil {
+		return "查询余额失败，请稍后重试"
+	}
+	_, pending, err := s.trading.GetOrders(userID, "pending", 1, 1)
+	if err != nil {
+		return fmt.Sprintf("余额：%.2f", balance)
+	}
+	return fmt.Sprintf("余额：%.2f\n未成交订单：%d", balance, pending)
+}
+
+func (s *Service) orders(userID uint) string {
+	orders, total, err := s.trading.GetOrders(userID, "pending", 1, 10)
+	if err != nil {
+		return "查询订单失败，请稍后重试"
+	}
+	if total == 0 {
+		return "没有未成交的订单"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "未成交订单（共%d笔）：", total)
+	for _, order := range orders {
+		fmt.Fprintf(&b, "\n#%d %s %s x%d @ %.2f (%s)",
+			order.ID, orderType(order.Type), order.Item.Name, order.Quantity, order.Price, order.Platform)
+	}
+	if total > int64(len(orders)) {
+		fmt.Fprintf(&b, "\n……仅显示最近%d笔", len(orders))
+	}
+	return b.String()
+}
+
+func (s *Service) pauseStrategy(userID uint, args []string) string {
+	if len(args) == 0 {
+		return "用法：/pause-strategy <策略ID>"
+	}
+	strategyID, err := strconv.ParseUint(strings.TrimPrefix(args[0], "#"), 10, 32)
+	if err != nil {
+		return "策略ID无效"
+	}
+
+	var strategy models.Strategy
+	if err := s.db.Where("id = ? AND user_id = ?", strategyID, userID).First(&strategy).Error; err != nil {
+		return "策略不存在"
+	}
+	if strategy.Status != "active" {
+		return fmt.Sprintf("策略 #%d %s 未在运行", strategy.ID, strategy.Name)
+	}
+	if err := s.trading.DeactivateStrategy(strategy.ID, userID); err != nil {
+		return "暂停策略失败，请稍后重试"
+	}
+	return fmt.Sprintf("策略 #%d %s 已暂停", strategy.ID, strategy.Name)
+}
+
+func orderType(t string) string {
+	if t == "sell" {
+		return "卖出"
+	}
+	return "买入"
+}
+
+func (s *Service) reply(msg *message, text string) {
+	if err := s.send(msg.Chat.ID, text); err != nil {
+		logrus.Warnf("Failed to reply telegram chat %d: %v", msg.Chat.ID, err)
+	}
+}
+
+func (s *Service) send(chatID int64, text string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	}, nil)
+}
+
+// Bot API的数据结构，只保留用到的字段
+type update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *message `json:"message"`
+}
+
+type message struct {
+	Text string `json:"text"`
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	From *struct {
+		Username string `json:"username"`
+	} `json:"from"`
+}
+
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description"`
+}
+
+// call 调用Bot API，result不为空时解析返回结果
+func (s *Service) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(s.config.PollTimeout+10)*time.Second)
+		defer cancel()
+	}
+
+	endpoint := fmt.Sprintf("%s/bot%s/%s", strings.TrimRight(s.config.APIURL, "/"), s.config.Token, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		// 错误信息中的URL包含Token，只保留底层错误
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var res apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("%s: invalid response (status %d)", method, resp.StatusCode)
+	}
+	if !res.OK {
+		return fmt.Errorf("%s: %s", method, res.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(res.Result, result)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package trading
+
+import (
+	"fmt"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/websocket"
+)
+
+// 订单事件在动态中的标题
+var activityTitles = map[string]string{
+	OrderCreated:   "已提交",
+	OrderAmended:   "已修改",
+	OrderTriggered: "已触发",
+	OrderFilled:    "部分成交",
+	OrderCompleted: "已成交",
+	OrderFailed:    "失败",
+	OrderCancelled: "已取消",
+	OrderExpired:   "已过期",
+}
+
+// recordActivity 把订单事件写入用户动态，须在事件所在的事务提交之后调用
+func (s *Service) recordActivity(order *models.Order, eventType string) {
+	if s.activity == nil || activityTitles[eventType] == "" {
+		return
+	}
+	side := "买入"
+	if order.Type == "sell" {
+		side = "卖出"
+	}
+
+	var name string
+	s.db.Model(&models.Item{}).Where("id = ?", order.ItemID).Pluck("name", &name)
+	if name == "" {
+		name = fmt.Sprintf("物品 #%d", order.ItemID)
+	}
+
+	title := fmt.Sprintf("%s订单 #%d %s", side, order.ID, activityTitles[eventType])
+	body := fmt.Sprintf("%s x%d @ %.2f (%s)", name, order.Quantity, order.Price, order.Platform)
+	if eventType == OrderFilled {
+		body += fmt.Sprintf("\n已成交 %d/%d", order.FilledQuantity, order.Quantity)
+	}
+	if order.FailedReason != "" && (eventType == OrderFailed || eventType == OrderExpired) {
+		body += "\n" + order.FailedReason
+	}
+	s.activity.Record(order.UserID, "order."+eventType, title, body, websocket.NewOrderV1(order))
+}
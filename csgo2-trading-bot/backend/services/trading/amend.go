@@ -0,0 +1,124 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+
+	"csgo2-trading-bot/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrOrderNotAmendable 订单不能修改：已结束、是拆分执行的子单，或修改内容不合法
+var ErrOrderNotAmendable = errors.New("order cannot be amended")
+
+// OrderAmendment 订单修改内容，为空的字段保持不变
+type OrderAmendment struct {
+	Price    *float64
+	Quantity *int
+}
+
+// AmendOrder 修改尚未开始执行的挂单的价格或数量。买单重新检查余额，卖单按新数量重新选择并锁定批次，
+// 修改后的订单重新经过风控检查并交给执行队列（条件单继续等待触发）。
+// version为调用方读取到的订单版本，订单已开始执行或版本不一致时返回ErrVersionConflict
+func (s *Service) AmendOrder(orderID uint, userID uint, version int, amendment OrderAmendment) (*models.Order, error) {
+	if s.underMaintenance() {
+		return nil, ErrMaintenance
+	}
+	if amendment.Price == nil && amendment.Quantity == nil {
+		return nil, fmt.Errorf("%w: nothing to change", ErrOrderNotAmendable)
+	}
+	if (amendment.Price != nil && *amendment.Price <= 0) || (amendment.Quantity != nil && *amendment.Quantity <= 0) {
+		return nil, fmt.Errorf("%w: price and quantity must be positive", ErrOrderNotAmendable)
+	}
+
+	var order models.Order
+	if err := s.db.First(&order, orderID).Error; err != nil {
+		return nil, err
+	}
+	if order.UserID != userID {
+		return nil, errors.New("unauthorized")
+	}
+	if order.Status != "pending" {
+		return nil, fmt.Errorf("%w: order is %s", ErrOrderNotAmendable, order.Status)
+	}
+	if order.Version != version {
+		return nil, fmt.Errorf("%w: order %d is at version %d", ErrVersionConflict, order.ID, order.Version)
+	}
+	if order.ExecutionStartedAt != nil {
+		return nil, fmt.Errorf("%w: order %d is being executed", ErrVersionConflict, order.ID)
+	}
+	// 拆分执行的子单由母单按进度提交，OCO两腿共用同一批库存，数量须保持一致
+	if order.ParentID != nil {
+		return nil, fmt.Errorf("%w: slices are managed by their parent order", ErrOrderNotAmendable)
+	}
+	if order.OCOID != nil && amendment.Quantity != nil {
+		return nil, fmt.Errorf("%w: quantity of an OCO leg cannot be changed", ErrOrderNotAmendable)
+	}
+
+	amended := order
+	data := orderEventData{}
+	if amendment.Price != nil && *amendment.Price != order.Price {
+		amended.Price, data.Price = *amendment.Price, *amendment.Price
+	}
+	if amendment.Quantity != nil && *amendment.Quantity != order.Quantity {
+		amended.Quantity, data.Quantity = *amendment.Quantity, *amendment.Quantity
+	}
+	if data.Price == 0 && data.Quantity == 0 {
+		return &order, nil
+	}
+	if data.Price > 0 {
+		if err := s.checkOCOPrices(s.db, &amended); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrOrderNotAmendable, err)
+		}
+	}
+
+	var violation *RiskViolation
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID); err != nil {
+			return err
+		}
+
+		if amended.Type == "buy" {
+			if !s.checkUserBalance(tx, userID, amended.Platform, amended.Price*float64(amended.Quantity-amended.FilledQuantity), order.ID) {
+				return errors.New("insufficient balance")
+			}
+		} else if data.Quantity > 0 {
+			// 释放原批次后按新数量重新选择，失败时随事务回滚，原批次保持锁定
+			if err := unlockLots(tx, &order); err != nil {
+				return err
+			}
+			lots, err := s.selectLots(tx, &amended)
+			if err != nil {
+				return err
+			}
+			if err := setOrderLots(&amended, lots); err != nil {
+				return err
+			}
+			if err := lockLots(tx, lots); err != nil {
+				return err
+			}
+			data.Lots = amended.Lots
+		}
+
+		if violation = s.evaluateRisk(&amended); violation != nil {
+			return violation
+		}
+		return s.transitionOrder(tx, &order, OrderAmended, data)
+	})
+	if violation != nil {
+		s.notifyRiskViolation(&amended, violation)
+	}
+	if errors.Is(err, errOrderTransition) {
+		return nil, fmt.Errorf("%w: order is %s", ErrOrderNotAmendable, order.Status)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.outbox.Kick()
+	order.Lots = amended.Lots
+
+	// 执行队列中的旧消息在领取时因版本不一致被放弃，按修改后的订单重新入队
+	s.dispatchOrder(&order)
+	return &order, nil
+}
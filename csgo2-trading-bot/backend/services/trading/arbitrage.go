@@ -0,0 +1,167 @@
+package trading
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// OpportunityCrossPlatform 跨平台套利的机会类型，区别于Steam分区价差
+const OpportunityCrossPlatform = "cross_platform"
+
+// ArbitrageOpportunity 在一个平台买入、另一个平台卖出并提现的净收益。
+// 价格历史入库时已换算为本位币，手续费按各平台当前生效的费率计算，金额为本位币或请求的展示币种
+type ArbitrageOpportunity struct {
+	Type           string  `json:"type"`
+	ItemID         uint    `json:"item_id"`
+	MarketHashName string  `json:"market_hash_name"`
+	BuyPlatform    string  `json:"buy_platform"`
+	BuyPrice       float64 `json:"buy_price"`
+	BuyFee         float64 `json:"buy_fee"`
+	Cost           float64 `json:"cost"` // 买入价加买入手续费
+	SellPlatform   string  `json:"sell_platform"`
+	SellPrice      float64 `json:"sell_price"`
+	SellFee        float64 `json:"sell_fee"`
+	WithdrawalFee  float64 `json:"withdrawal_fee"` // 卖出所得从卖出平台提现的费用
+	NetProceeds    float64 `json:"net_proceeds"`   // 扣除卖出手续费和提现费后的到手金额
+	Spread         float64 `json:"spread"`         // 未计费用的价差
+	SpreadPercent  float64 `json:"spread_percent"`
+	Profit         float64 `json:"profit"`         // 到手金额减成本
+	ProfitPercent  float64 `json:"profit_percent"` // 相对成本的百分比
+	Currency       string  `json:"currency"`
+}
+
+// arbitrage 在各平台的报价中找出净收益最高的买入、卖出平台组合，少于两个平台时返回nil
+func (s *Service) arbitrage(itemID uint, prices map[string]float64) *ArbitrageOpportunity {
+	var best *ArbitrageOpportunity
+	for buyPlatform, buyPrice := range prices {
+		for sellPlatform, sellPrice := range prices {
+			if buyPlatform == sellPlatform || buyPrice <= 0 || sellPrice <= 0 {
+				continue
+			}
+			o := s.netArbitrage(buyPlatform, buyPrice, sellPlatform, sellPrice)
+			if best == nil || o.Profit > best.Profit || (o.Profit == best.Profit && o.BuyPlatform < best.BuyPlatform) {
+				best = o
+			}
+		}
+	}
+	if best != nil {
+		best.ItemID = itemID
+	}
+	return best
+}
+
+// netArbitrage 按两个平台的手续费计算一组买卖的净收益
+func (s *Service) netArbitrage(buyPlatform string, buyPrice float64, sellPlatform string, sellPrice float64) *ArbitrageOpportunity {
+	o := &ArbitrageOpportunity{
+		Type:         OpportunityCrossPlatform,
+		BuyPlatform:  buyPlatform,
+		BuyPrice:     buyPrice,
+		BuyFee:       s.buyFee(buyPlatform, buyPrice),
+		SellPlatform: sellPlatform,
+		SellPrice:    sellPrice,
+		SellFee:      s.sellFee(sellPlatform, sellPrice),
+		Spread:       sellPrice - buyPrice,
+	}
+	o.Cost = o.BuyPrice + o.BuyFee
+	o.WithdrawalFee = (o.SellPrice - o.SellFee) * s.feeSchedule(sellPlatform).WithdrawalFee
+	o.NetProceeds = o.SellPrice - o.SellFee - o.WithdrawalFee
+	o.Profit = o.NetProceeds - o.Cost
+	o.SpreadPercent = o.Spread / o.BuyPrice * 100
+	if o.Cost > 0 {
+		o.ProfitPercent = o.Profit / o.Cost * 100
+	}
+	return o
+}
+
+// GetArbitrageOpportunities since之后有至少两个平台报价的物品中，扣除费用后收益率不低于minProfitPercent的
+// 跨平台套利机会，按收益率从高到低取limit个；currency不为空时金额换算为该币种
+func (s *Service) GetArbitrageOpportunities(since time.Time, minProfitPercent float64, limit int, currency string) ([]ArbitrageOpportunity, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if _, err := s.fromBaseCurrency(1, currency); err != nil {
+		return nil, err
+	}
+
+	var latest []struct {
+		ItemID   uint
+		Platform string
+		Price    float64
+	}
+	err := s.db.Raw(`
+		SELECT item_id, platform, price FROM (
+			SELECT DISTINCT ON (item_id, platform) item_id, platform, price
+			FROM price_histories
+			WHERE recorded_at >= ? AND price > 0 AND deleted_at IS NULL
+			ORDER BY item_id, platform, recorded_at DESC
+		) latest
+		WHERE item_id IN (
+			SELECT item_id FROM price_histories
+			WHERE recorded_at >= ? AND price > 0 AND deleted_at IS NULL
+			GROUP BY item_id HAVING COUNT(DISTINCT platform) > 1
+		)`, since, since).
+		Scan(&latest).Error
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[uint]map[string]float64)
+	for _, row := range latest {
+		if prices[row.ItemID] == nil {
+			prices[row.ItemID] = make(map[string]float64)
+		}
+		prices[row.ItemID][row.Platform] = row.Price
+	}
+
+	opportunities := []ArbitrageOpportunity{}
+	for itemID, itemPrices := range prices {
+		if o := s.arbitrage(itemID, itemPrices); o != nil && o.Profit > 0 && o.ProfitPercent >= minProfitPercent {
+			opportunities = append(opportunities, *o)
+		}
+	}
+	sort.Slice(opportunities, func(i, j int) bool {
+		if opportunities[i].ProfitPercent != opportunities[j].ProfitPercent {
+			return opportunities[i].ProfitPercent > opportunities[j].ProfitPercent
+		}
+		return opportunities[i].ItemID < opportunities[j].ItemID
+	})
+	if len(opportunities) > limit {
+		opportunities = opportunities[:limit]
+	}
+	if len(opportunities) == 0 {
+		return opportunities, nil
+	}
+
+	itemIDs := make([]uint, len(opportunities))
+	for i, o := range opportunities {
+		itemIDs[i] = o.ItemID
+	}
+	var items []models.Item
+	if err := s.db.Select("id", "market_hash_name").Where("id IN ?", itemIDs).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(items))
+	for _, item := range items {
+		names[item.ID] = item.MarketHashName
+	}
+
+	for i := range opportunities {
+		o := &opportunities[i]
+		o.MarketHashName = names[o.ItemID]
+		o.Currency = s.config.BaseCurrency
+		if currency != "" {
+			o.Currency = currency
+			for _, amount := range []*float64{&o.BuyPrice, &o.BuyFee, &o.Cost, &o.SellPrice, &o.SellFee,
+				&o.WithdrawalFee, &o.NetProceeds, &o.Spread, &o.Profit} {
+				*amount, _ = s.fromBaseCurrency(*amount, currency)
+			}
+		}
+		for _, amount := range []*float64{&o.BuyFee, &o.Cost, &o.SellFee, &o.WithdrawalFee, &o.NetProceeds, &o.Profit} {
+			*amount = math.Round(*amount*100) / 100
+		}
+	}
+	return opportunities, nil
+}
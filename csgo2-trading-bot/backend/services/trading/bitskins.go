@@ -0,0 +1,189 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/httpclient"
+	"csgo2-trading-bot/services/platforms/bitskins"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+)
+
+// executeBitSkinsBuy 逐件购买不高于订单价格的最低价商品，并提取到Steam库存
+func (s *Service) executeBitSkinsBuy(order *models.Order) error {
+	var item models.Item
+	if err := s.db.Select("id", "market_hash_name").First(&item, order.ItemID).Error; err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(httpclient.WithPriority(s.ctx, httpclient.PriorityTrade), time.Minute)
+	defer cancel()
+
+	var bought []string
+	var buyErr error
+	for len(bought) < order.Quantity {
+		listing, err := s.bitskins.GetLowestListing(ctx, item.MarketHashName)
+		if err != nil {
+			buyErr = err
+			break
+		}
+
+		price, err := s.toBaseCurrency(listing.Price, bitskins.Currency)
+		if err != nil {
+			buyErr = err
+			break
+		}
+		if price > order.Price {
+			buyErr = fmt.Errorf("lowest bitskins listing %.2f exceeds order price %.2f", price, order.Price)
+			break
+		}
+
+		ids, err := s.bitskins.Buy(ctx, []string{listing.ItemID}, []float64{listing.Price})
+		if err != nil {
+			buyErr = err
+			break
+		}
+		bought = append(bought, ids...)
+		s.recordFill(order, len(ids))
+	}
+
+	if len(bought) == 0 {
+		if buyErr == nil {
+			buyErr = errors.New("nothing bought")
+		}
+		return buyErr
+	}
+	if buyErr != nil {
+		logrus.Warnf("BitSkins order %d partially filled %d/%d: %v", order.ID, len(bought), order.Quantity, buyErr)
+		order.Quantity = len(bought)
+	}
+
+	// 提取失败不影响成交，可在BitSkins后台重新发起
+	if err := s.bitskins.Withdraw(ctx, bought); err != nil {
+		logrus.Warnf("BitSkins withdrawal for order %d failed: %v", order.ID, err)
+	}
+	return nil
+}
+
+// executeBitSkinsSell 按订单价格上架订单锁定批次中的物品
+func (s *Service) executeBitSkinsSell(order *models.Order) error {
+	assets, err := s.lotAssets(order)
+	if err != nil {
+		return err
+	}
+
+	price, err := s.fromBaseCurrency(order.Price, bitskins.Currency)
+	if err != nil {
+		return err
+	}
+	prices := make([]float64, len(assets))
+	for i := range prices {
+		prices[i] = price
+	}
+
+	ctx, cancel := context.WithTimeout(httpclient.WithPriority(s.ctx, httpclient.PriorityTrade), time.Minute)
+	defer cancel()
+
+	_, err = s.bitskins.ListForSale(ctx, assets, prices)
+	return err
+}
+
+// SyncBitSkinsPrices 注册BitSkins价格同步任务，价格换算为本位币后写入价格历史
+func (s *Service) SyncBitSkinsPrices(interval time.Duration) error {
+	if s.bitskins == nil {
+		return errors.New("bitskins is not enabled")
+	}
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "bitskins_prices",
+		Spec: interval.String(),
+		Run:  s.syncBitSkinsPrices,
+	})
+}
+
+func (s *Service) syncBitSkinsPrices() {
+	ctx, cancel := context.WithTimeout(httpclient.WithPriority(s.ctx, httpclient.PriorityBackground), 2*time.Minute)
+	defer cancel()
+
+	prices, err := s.bitskins.GetAllPrices(ctx)
+	if err != nil {
+		logrus.Errorf("Failed to fetch BitSkins prices: %v", err)
+		return
+	}
+
+	quotes := make(map[string]float64, len(prices))
+	for _, p := range prices {
+		quotes[p.MarketHashName] = p.Price
+	}
+	s.savePlatformPrices("bitskins", bitskins.Currency, quotes)
+}
+
+// OnNewItems 注册新物品回调：平台报价中出现目录未收录的物品时调用，回调中建档的物品本次即保存价格
+func (s *Service) OnNewItems(fn func(platform string, names []string)) {
+	s.newItemListeners = append(s.newItemListeners, fn)
+}
+
+// savePlatformPrices 将平台报价换算为本位币后写入价格历史，只保存已收录的物品
+func (s *Service) savePlatformPrices(platform, currency string, quotes map[string]float64) {
+	var items []models.Item
+	s.db.Select("id", "market_hash_name").Find(&items)
+
+	// 目录为空时（尚未导入）所有物品都是未收录的，不当作新物品
+	if len(items) > 0 && len(s.newItemListeners) > 0 {
+		known := make(map[string]bool, len(items))
+		for _, item := range items {
+			known[item.MarketHashName] = true
+		}
+		var unknown []string
+		for name, quote := range quotes {
+			if !known[name] && quote > 0 {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			for _, fn := range s.newItemListeners {
+				fn(platform, unknown)
+			}
+			var added []models.Item
+			s.db.Select("id", "market_hash_name").Where("market_hash_name IN ?", unknown).Find(&added)
+			items = append(items, added...)
+		}
+	}
+
+	// 同一批报价的汇率相同，只查一次
+	rate, err := s.toBaseCurrency(1, currency)
+	if err != nil {
+		logrus.Errorf("Failed to convert %s prices: %v", platform, err)
+		return
+	}
+
+	now := s.now()
+	history := make([]models.PriceHistory, 0, min(len(items), len(quotes)))
+	for _, item := range items {
+		quote, ok := quotes[item.MarketHashName]
+		if !ok || quote <= 0 {
+			continue
+		}
+		history = append(history, models.PriceHistory{
+			ItemID:     item.ID,
+			Price:      quote * rate,
+			Platform:   platform,
+			RecordedAt: now,
+		})
+	}
+
+	if len(history) == 0 {
+		return
+	}
+	if err := s.db.CreateInBatches(history, 500).Error; err != nil {
+		logrus.Errorf("Failed to save %s prices: %v", platform, err)
+		return
+	}
+	logrus.Infof("Synced %d %s prices", len(history), platform)
+}
@@ -0,0 +1,185 @@
+package trading
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/notify"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 策略冲突仲裁规则
+const (
+	ConflictPriority  = "priority"   // 优先级高的策略胜出，相同时保留已有订单
+	ConflictNewerWins = "newer_wins" // 后发出信号的策略胜出，撤销对方的挂单
+	ConflictBlock     = "block"      // 双方都不成交：拒绝新信号、撤销对方挂单并通知用户
+)
+
+// StrategyConflict 信号因与其他策略的反向订单冲突而被拒绝
+type StrategyConflict struct {
+	StrategyID uint   `json:"strategy_id"`
+	ItemID     uint   `json:"item_id"`
+	Side       string `json:"side"`
+	Opponents  []uint `json:"opponents"` // 持有反向订单的策略
+	Policy     string `json:"policy"`
+	Outcome    string `json:"outcome"`
+}
+
+func (c *StrategyConflict) Error() string {
+	return fmt.Sprintf("%s signal on item %d conflicts with strategies %v (%s): %s", c.Side, c.ItemID, c.Opponents, c.Policy, c.Outcome)
+}
+
+// conflictingOrders 同一用户其他策略在该物品上的反向订单：未成交的挂单，或冲突窗口内下的订单
+func (s *Service) conflictingOrders(strategy *models.Strategy, itemID uint, side string) []models.Order {
+	opposite := "sell"
+	if side == "sell" {
+		opposite = "buy"
+	}
+	window := time.Duration(s.config.StrategyConflict.Window) * time.Second
+
+	var orders []models.Order
+	s.db.Joins("JOIN strategies ON strategies.id = orders.strategy_id AND strategies.status = ? AND strategies.deleted_at IS NULL", "active").
+		Where("orders.user_id = ? AND orders.item_id = ? AND orders.type = ? AND orders.strategy_id <> ?",
+			strategy.UserID, itemID, opposite, strategy.ID).
+		Where("orders.status = ? OR orders.created_at >= ?", "pending", time.Now().Add(-window)).
+		Find(&orders)
+	return orders
+}
+
+// conflictPolicy 策略配置中的conflict_policy优先于全局配置
+func (s *Service) conflictPolicy(env *StrategyEnv) string {
+	if policy, _ := env.Config["conflict_policy"].(string); policy != "" {
+		return policy
+	}
+	if s.config.StrategyConflict.Policy != "" {
+		return s.config.StrategyConflict.Policy
+	}
+	return ConflictPriority
+}
+
+// arbitrate 下单前检查与其他策略的冲突，信号被拒绝时返回*StrategyConflict
+func (s *Service) arbitrate(env *StrategyEnv, itemID uint, side string) error {
+	orders := s.conflictingOrders(env.Strategy, itemID, side)
+	if len(orders) == 0 {
+		return nil
+	}
+
+	conflict := s.resolveConflict(env, itemID, side, orders)
+	if env.DryRun() {
+		if conflict.Outcome == "allowed" {
+			return nil
+		}
+		return conflict
+	}
+
+	data := map[string]interface{}{
+		"item_id":   itemID,
+		"side":      side,
+		"policy":    conflict.Policy,
+		"outcome":   conflict.Outcome,
+		"opponents": conflict.Opponents,
+	}
+
+	// 胜出方或block规则下撤销对方仍在挂单中的订单
+	if conflict.Outcome != "blocked" || conflict.Policy == ConflictBlock {
+		var cancelled []uint
+		for _, order := range orders {
+			if order.Status != "pending" {
+				continue
+			}
+			if err := s.CancelOrder(order.ID, order.UserID, 0); err != nil {
+				logrus.Warnf("Failed to cancel conflicting order %d: %v", order.ID, err)
+				continue
+			}
+			cancelled = append(cancelled, order.ID)
+		}
+		data["cancelled_orders"] = cancelled
+	}
+
+	s.runLog(env.Strategy.ID, "conflict", conflict.Error(), data)
+	for _, opponent := range conflict.Opponents {
+		s.runLog(opponent, "conflict", fmt.Sprintf("strategy %d sent an opposing %s signal: %s", env.Strategy.ID, side, conflict.Outcome), data)
+	}
+
+	if conflict.Policy == ConflictBlock {
+		data["strategy_id"] = env.Strategy.ID
+		data["time"] = time.Now()
+		s.notifier.Publish(env.Strategy.UserID, notify.Message{Event: notify.EventStrategyConflict, Data: data})
+	}
+
+	if conflict.Outcome == "allowed" {
+		return nil
+	}
+	return conflict
+}
+
+// resolveConflict 按规则决定新信号是否放行
+func (s *Service) resolveConflict(env *StrategyEnv, itemID uint, side string, orders []models.Order) *StrategyConflict {
+	seen := make(map[uint]bool)
+	var opponents []uint
+	for _, order := range orders {
+		if !seen[*order.StrategyID] {
+			seen[*order.StrategyID] = true
+			opponents = append(opponents, *order.StrategyID)
+		}
+	}
+	sort.Slice(opponents, func(i, j int) bool { return opponents[i] < opponents[j] })
+
+	conflict := &StrategyConflict{
+		StrategyID: env.Strategy.ID,
+		ItemID:     itemID,
+		Side:       side,
+		Opponents:  opponents,
+		Policy:     s.conflictPolicy(env),
+	}
+
+	switch conflict.Policy {
+	case ConflictNewerWins:
+		conflict.Outcome = "allowed"
+	case ConflictBlock:
+		conflict.Outcome = "blocked"
+	default:
+		conflict.Policy = ConflictPriority
+		var highest int
+		s.db.Model(&models.Strategy{}).Where("id IN ?", opponents).
+			Select("COALESCE(MAX(priority), 0)").Scan(&highest)
+		if env.Strategy.Priority > highest {
+			conflict.Outcome = "allowed"
+		} else {
+			conflict.Outcome = "blocked"
+		}
+	}
+	return conflict
+}
+
+// runLog 写入策略运行日志
+func (s *Service) runLog(strategyID uint, event, message string, data interface{}) {
+	payload := "{}"
+	if data != nil {
+		if b, err := json.Marshal(data); err == nil {
+			payload = string(b)
+		}
+	}
+	entry := models.StrategyRunLog{StrategyID: strategyID, Event: event, Message: message, Data: payload}
+	if err := s.db.Create(&entry).Error; err != nil {
+		logrus.Errorf("Failed to write run log for strategy %d: %v", strategyID, err)
+	}
+}
+
+// GetStrategyRunLogs 策略最近的运行日志，按时间倒序
+func (s *Service) GetStrategyRunLogs(strategyID, userID uint, limit int) ([]models.StrategyRunLog, error) {
+	if _, err := s.GetStrategy(strategyID, userID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	var logs []models.StrategyRunLog
+	err := s.db.Where("strategy_id = ?", strategyID).Order("created_at DESC, id DESC").Limit(limit).Find(&logs).Error
+	return logs, err
+}
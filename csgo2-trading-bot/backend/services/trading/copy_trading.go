@@ -0,0 +1,144 @@
+package trading
+
+import (
+	"errors"
+	"math"
+
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// GetPublicStrategies 获取可跟单的公开策略
+func (s *Service) GetPublicStrategies() ([]models.Strategy, error) {
+	var strategies []models.Strategy
+	err := s.db.Where("is_public = ?", true).Order("created_at DESC").Find(&strategies).Error
+	return strategies, err
+}
+
+// Subscribe 订阅公开策略
+func (s *Service) Subscribe(followerID uint, strategyID uint, budget float64, maxOrderValue float64) (*models.Subscription, error) {
+	var strategy models.Strategy
+	if err := s.db.First(&strategy, strategyID).Error; err != nil {
+		return nil, err
+	}
+
+	if !strategy.IsPublic {
+		return nil, errors.New("strategy is not public")
+	}
+	if strategy.UserID == followerID {
+		return nil, errors.New("cannot subscribe to own strategy")
+	}
+	if budget <= 0 {
+		return nil, errors.New("budget must be positive")
+	}
+
+	var existing int64
+	s.db.Model(&models.Subscription{}).
+		Where("follower_id = ? AND strategy_id = ?", followerID, strategyID).
+		Count(&existing)
+	if existing > 0 {
+		return nil, errors.New("already subscribed")
+	}
+
+	subscription := models.Subscription{
+		FollowerID:    followerID,
+		StrategyID:    strategyID,
+		Budget:        budget,
+		MaxOrderValue: maxOrderValue,
+		Status:        "active",
+	}
+	if err := s.db.Create(&subscription).Error; err != nil {
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+// GetSubscriptions 获取用户的跟单订阅
+func (s *Service) GetSubscriptions(followerID uint) ([]models.Subscription, error) {
+	var subscriptions []models.Subscription
+	err := s.db.Preload("Strategy").Where("follower_id = ?", followerID).Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// Unsubscribe 取消跟单
+func (s *Service) Unsubscribe(subscriptionID uint, followerID uint) error {
+	return s.db.Where("id = ? AND follower_id = ?", subscriptionID, followerID).
+		Delete(&models.Subscription{}).Error
+}
+
+// fanOutSignal 将策略产生的交易信号按跟单者预算比例复制到所有订阅者
+func (s *Service) fanOutSignal(strategy *models.Strategy, signal *models.Order) {
+	if !strategy.IsPublic {
+		return
+	}
+
+	var subscriptions []models.Subscription
+	s.db.Where("strategy_id = ? AND status = ?", strategy.ID, "active").Find(&subscriptions)
+
+	for i := range subscriptions {
+		if err := s.mirrorOrder(strategy, &subscriptions[i], signal); err != nil {
+			logrus.Warnf("Copy trade for subscription %d skipped: %v", subscriptions[i].ID, err)
+		}
+	}
+}
+
+// mirrorOrder 为单个订阅者创建跟单订单
+func (s *Service) mirrorOrder(strategy *models.Strategy, subscription *models.Subscription, signal *models.Order) error {
+	// 按跟单者预算与策略预算的比例缩放数量
+	ratio := 1.0
+	if strategy.MaxInvest > 0 {
+		ratio = subscription.Budget / strategy.MaxInvest
+	}
+	quantity := int(math.Floor(float64(signal.Quantity) * ratio))
+	if quantity < 1 {
+		return errors.New("scaled quantity is below one unit")
+	}
+
+	// 单笔跟单金额上限
+	if subscription.MaxOrderValue > 0 {
+		maxQuantity := int(subscription.MaxOrderValue / signal.Price)
+		if maxQuantity < 1 {
+			return errors.New("price exceeds max order value")
+		}
+		if quantity > maxQuantity {
+			quantity = maxQuantity
+		}
+	}
+
+	order := &models.Order{
+		UserID:         subscription.FollowerID,
+		ItemID:         signal.ItemID,
+		Type:           signal.Type,
+		Price:          signal.Price,
+		Quantity:       quantity,
+		Platform:       signal.Platform,
+		SubscriptionID: &subscription.ID,
+	}
+
+	if order.Type == "sell" {
+		return s.submitSellOrder(order, nil)
+	}
+
+	// 跟单预算：未成交跟单买单 + 跟单持仓成本
+	cost := order.Price * float64(order.Quantity)
+	if s.subscriptionCommitted(subscription.ID)+cost > subscription.Budget {
+		return errors.New("subscription budget exhausted")
+	}
+	return s.submitBuyOrder(order)
+}
+
+// subscriptionCommitted 订阅已占用的资金
+func (s *Service) subscriptionCommitted(subscriptionID uint) float64 {
+	var holdings, pending float64
+
+	s.db.Model(&models.Inventory{}).
+		Where("subscription_id = ?", subscriptionID).
+		Select("COALESCE(SUM(quantity * buy_price), 0)").Scan(&holdings)
+	s.db.Model(&models.Order{}).
+		Where("subscription_id = ? AND type = ? AND status = ?", subscriptionID, "buy", "pending").
+		Select("COALESCE(SUM((quantity - filled_quantity) * price), 0)").Scan(&pending)
+
+	return holdings + pending
+}
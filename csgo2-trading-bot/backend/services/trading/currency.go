@@ -0,0 +1,11 @@
+package trading
+
+// toBaseCurrency 将外币金额换算为本位币
+func (s *Service) toBaseCurrency(amount float64, currency string) (float64, error) {
+	return s.fx.ToBase(amount, currency)
+}
+
+// fromBaseCurrency 将本位币金额换算为外币
+func (s *Service) fromBaseCurrency(amount float64, currency string) (float64, error) {
+	return s.fx.FromBase(amount, currency)
+}
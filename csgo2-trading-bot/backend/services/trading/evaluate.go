@@ -0,0 +1,115 @@
+package trading
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// Signal 试运行中策略发出的交易信号
+type Signal struct {
+	Type     string         `json:"type"` // buy, sell
+	ItemID   uint           `json:"item_id"`
+	Price    float64        `json:"price"`
+	Quantity int            `json:"quantity"`
+	Platform string         `json:"platform"`
+	Blocked  string         `json:"blocked,omitempty"` // 实际下单时会失败的原因
+	Risk     *RiskViolation `json:"risk,omitempty"`
+}
+
+// Evaluation 策略试运行结果
+type Evaluation struct {
+	StrategyID  uint      `json:"strategy_id"`
+	Type        string    `json:"type"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+	DurationMs  int64     `json:"duration_ms"`
+	Signals     []Signal  `json:"signals"`
+	Reasoning   []string  `json:"reasoning"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// EvaluateStrategy 用当前数据执行一次策略决策逻辑，只记录信号和理由，不会下单或修改策略状态
+func (s *Service) EvaluateStrategy(strategyID uint, userID uint) (*Evaluation, error) {
+	var strategy models.Strategy
+	if err := s.db.Where("id = ? AND user_id = ?", strategyID, userID).First(&strategy).Error; err != nil {
+		return nil, err
+	}
+
+	evaluation := &Evaluation{
+		StrategyID:  strategy.ID,
+		Type:        strategy.Type,
+		EvaluatedAt: time.Now(),
+		Signals:     []Signal{},
+		Reasoning:   []string{},
+	}
+
+	runner, err := newRunner(strategy.Type)
+	if err != nil {
+		evaluation.Error = err.Error()
+		return evaluation, nil
+	}
+
+	env := s.newStrategyEnv(&strategy)
+	env.evaluation = evaluation
+
+	// 使用独立的执行器实例，不影响正在运行的策略
+	ctx, cancel := context.WithTimeout(s.ctx, s.strategyTimeout())
+	defer cancel()
+
+	start := time.Now()
+	if err := runner.Init(ctx, env); err != nil {
+		evaluation.Error = fmt.Sprintf("init: %v", err)
+	} else {
+		// 以运行中策略最近一次快照的状态试运行
+		if _, err := s.restoreRunner(ctx, &strategy, runner, env); err != nil {
+			env.Explain("could not restore saved state: %v", err)
+		}
+		if err := runner.Tick(ctx, env); err != nil {
+			evaluation.Error = fmt.Sprintf("tick: %v", err)
+		}
+		runner.Stop(ctx, env)
+	}
+	evaluation.DurationMs = time.Since(start).Milliseconds()
+
+	if len(evaluation.Signals) == 0 && evaluation.Error == "" {
+		env.Explain("no trading signal under current market data")
+	}
+	return evaluation, nil
+}
+
+// dryRunOrder 试运行时代替下单：记录信号并检查实际下单时是否会被拒绝
+func (s *Service) dryRunOrder(env *StrategyEnv, orderType string, itemID uint, price float64, quantity int, platform string) *models.Order {
+	order := &models.Order{
+		UserID:     env.Strategy.UserID,
+		ItemID:     itemID,
+		Type:       orderType,
+		Price:      price,
+		Quantity:   quantity,
+		Platform:   platform,
+		StrategyID: &env.Strategy.ID,
+		Status:     "pending",
+	}
+
+	signal := Signal{
+		Type:     orderType,
+		ItemID:   itemID,
+		Price:    price,
+		Quantity: quantity,
+		Platform: platform,
+	}
+	if orderType == "buy" && !s.checkUserBalance(s.db, order.UserID, platform, price*float64(quantity), 0) {
+		signal.Blocked = "insufficient balance"
+	} else if orderType == "sell" && !s.checkInventory(order.UserID, itemID, quantity) {
+		signal.Blocked = "insufficient inventory"
+	} else if violation := s.evaluateRisk(order); violation != nil {
+		signal.Blocked = violation.Reason
+		signal.Risk = violation
+	} else if err := s.arbitrate(env, itemID, orderType); err != nil {
+		signal.Blocked = err.Error()
+	}
+
+	env.evaluation.Signals = append(env.evaluation.Signals, signal)
+	return order
+}
@@ -0,0 +1,513 @@
+package trading
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/audit"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// A/B测试的评选指标
+const (
+	MetricProfit  = "profit"   // 已实现利润
+	MetricReturn  = "return"   // 利润占分配预算的比例
+	MetricWinRate = "win_rate" // 卖出胜率
+)
+
+// ErrExperimentNotFound 实验不存在或不属于该策略
+var ErrExperimentNotFound = errors.New("experiment not found")
+
+// VariantRequest 一个参数变体，Config覆盖母策略配置中的同名参数，Weight为分得的预算比例
+type VariantRequest struct {
+	Name   string                 `json:"name" binding:"required"`
+	Config map[string]interface{} `json:"config"`
+	Weight float64                `json:"weight"`
+}
+
+// ExperimentRequest 启动A/B测试，权重都为0时平均分配预算
+type ExperimentRequest struct {
+	Variants             []VariantRequest `json:"variants" binding:"required,dive"`
+	Hours                int              `json:"hours" binding:"required"` // 评估期
+	Metric               string           `json:"metric"`
+	MinTrades            int              `json:"min_trades"`
+	AutoPromote          *bool            `json:"auto_promote"` // 默认true
+	AcknowledgedWarnings []string         `json:"acknowledged_warnings"`
+}
+
+// VariantResult 变体在实验期间的表现
+type VariantResult struct {
+	StrategyPerformance
+	Variant  string  `json:"variant"`
+	Budget   float64 `json:"budget"`
+	Return   float64 `json:"return"`
+	Score    float64 `json:"score"`    // 按实验指标计算的得分
+	Eligible bool    `json:"eligible"` // 卖出笔数达到min_trades
+}
+
+// ExperimentReport 实验及各变体的当前表现，Leader为目前领先的变体
+type ExperimentReport struct {
+	*models.StrategyExperiment
+	Standings []VariantResult `json:"standings"`
+	Leader    *uint           `json:"leader"`
+}
+
+// StartExperiment 按变体创建子策略并分配母策略的预算，实验期间母策略暂停，由各变体代为交易
+func (s *Service) StartExperiment(userID, strategyID uint, req ExperimentRequest) (*models.StrategyExperiment, error) {
+	parent, err := s.GetStrategy(strategyID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.ExperimentID != nil {
+		return nil, errors.New("a variant cannot run its own experiment")
+	}
+	if parent.MaxInvest <= 0 {
+		return nil, errors.New("strategy needs max_invest to split between variants")
+	}
+
+	var running int64
+	s.db.Model(&models.StrategyExperiment{}).Where("strategy_id = ? AND status = ?", strategyID, "running").Count(&running)
+	if running > 0 {
+		return nil, errors.New("strategy already has a running experiment")
+	}
+
+	if len(req.Variants) < 2 {
+		return nil, errors.New("an experiment needs at least 2 variants")
+	}
+	if limit := s.config.Experiments.MaxVariants; limit > 0 && len(req.Variants) > limit {
+		return nil, fmt.Errorf("an experiment can have at most %d variants", limit)
+	}
+	if req.Hours <= 0 {
+		return nil, errors.New("hours must be positive")
+	}
+	switch req.Metric {
+	case "":
+		req.Metric = MetricProfit
+	case MetricProfit, MetricReturn, MetricWinRate:
+	default:
+		return nil, fmt.Errorf("unknown metric: %s", req.Metric)
+	}
+
+	weights, err := variantWeights(req.Variants)
+	if err != nil {
+		return nil, err
+	}
+
+	// 变体按母策略的配置交易，激活前的警告同样需要确认
+	result, err := s.preflight(parent)
+	if err != nil {
+		return nil, err
+	}
+	if missing := result.unacknowledged(req.AcknowledgedWarnings); len(missing) > 0 {
+		return nil, &PreflightRequired{Preflight: result, Unacknowledged: missing}
+	}
+	s.recordAcknowledgement(parent, result)
+
+	base := make(map[string]interface{})
+	if parent.Config != "" {
+		json.Unmarshal([]byte(parent.Config), &base)
+	}
+
+	now := time.Now()
+	experiment := &models.StrategyExperiment{
+		UserID:       userID,
+		StrategyID:   strategyID,
+		Status:       "running",
+		Metric:       req.Metric,
+		MinTrades:    req.MinTrades,
+		AutoPromote:  req.AutoPromote == nil || *req.AutoPromote,
+		StartedAt:    now,
+		EndsAt:       now.Add(time.Duration(req.Hours) * time.Hour),
+		ParentStatus: parent.Status,
+		Results:      "[]",
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(experiment).Error; err != nil {
+			return err
+		}
+		for i, v := range req.Variants {
+			config := make(map[string]interface{}, len(base)+len(v.Config))
+			for k, value := range base {
+				config[k] = value
+			}
+			for k, value := range v.Config {
+				config[k] = value
+			}
+			raw, err := json.Marshal(config)
+			if err != nil {
+				return err
+			}
+
+			experimentID := experiment.ID
+			variant := models.Strategy{
+				UserID:       userID,
+				Name:         fmt.Sprintf("%s [%s]", parent.Name, v.Name),
+				Description:  parent.Description,
+				Type:         parent.Type,
+				Status:       "active",
+				Config:       string(raw),
+				MaxInvest:    math.Round(parent.MaxInvest*weights[i]*100) / 100,
+				MinProfit:    parent.MinProfit,
+				StopLoss:     parent.StopLoss,
+				TakeProfit:   parent.TakeProfit,
+				Schedule:     parent.Schedule,
+				Jitter:       parent.Jitter,
+				Concurrency:  parent.Concurrency,
+				Performance:  "{}",
+				Priority:     parent.Priority,
+				ExperimentID: &experimentID,
+				Variant:      v.Name,
+			}
+			if err := tx.Create(&variant).Error; err != nil {
+				return err
+			}
+			experiment.Variants = append(experiment.Variants, variant)
+		}
+		return tx.Model(parent).Update("status", "paused").Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if experiment.ParentStatus == "active" {
+		s.scheduler.Remove(strategyJobID(strategyID))
+		s.stopRunner(strategyID)
+	}
+	for i := range experiment.Variants {
+		if err := s.scheduleStrategy(&experiment.Variants[i]); err != nil {
+			logrus.Errorf("Failed to schedule variant %d of experiment %d: %v", experiment.Variants[i].ID, experiment.ID, err)
+		}
+	}
+
+	s.runLog(strategyID, "experiment", fmt.Sprintf("experiment %d started with %d variants", experiment.ID, len(experiment.Variants)), map[string]interface{}{
+		"experiment_id": experiment.ID,
+		"ends_at":       experiment.EndsAt,
+		"metric":        experiment.Metric,
+	})
+	return experiment, nil
+}
+
+// variantWeights 归一化后的预算比例
+func variantWeights(variants []VariantRequest) ([]float64, error) {
+	weights := make([]float64, len(variants))
+	seen := make(map[string]bool, len(variants))
+	var total float64
+	for i, v := range variants {
+		name := strings.TrimSpace(v.Name)
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate variant name: %s", name)
+		}
+		seen[name] = true
+		if v.Weight < 0 {
+			return nil, errors.New("variant weight must not be negative")
+		}
+		weights[i] = v.Weight
+		total += v.Weight
+	}
+
+	for i := range weights {
+		if total == 0 {
+			weights[i] = 1 / float64(len(weights))
+		} else {
+			weights[i] /= total
+		}
+	}
+	return weights, nil
+}
+
+// GetExperiments 策略的全部实验，按开始时间倒序
+func (s *Service) GetExperiments(userID, strategyID uint) ([]models.StrategyExperiment, error) {
+	var experiments []models.StrategyExperiment
+	err := s.db.Where("user_id = ? AND strategy_id = ?", userID, strategyID).
+		Order("started_at DESC").
+		Find(&experiments).Error
+	return experiments, err
+}
+
+// GetExperiment 实验详情及各变体的当前表现
+func (s *Service) GetExperiment(userID, strategyID, experimentID uint) (*ExperimentReport, error) {
+	experiment, err := s.loadExperiment(s.db, userID, strategyID, experimentID)
+	if err != nil {
+		return nil, err
+	}
+	standings, err := s.experimentStandings(experiment)
+	if err != nil {
+		return nil, err
+	}
+	return &ExperimentReport{StrategyExperiment: experiment, Standings: standings, Leader: leader(standings)}, nil
+}
+
+func (s *Service) loadExperiment(db *gorm.DB, userID, strategyID, experimentID uint) (*models.StrategyExperiment, error) {
+	var experiment models.StrategyExperiment
+	err := db.Preload("Variants", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped().Order("id") }).
+		Where("id = ? AND user_id = ? AND strategy_id = ?", experimentID, userID, strategyID).
+		First(&experiment).Error
+	if err != nil {
+		return nil, ErrExperimentNotFound
+	}
+	return &experiment, nil
+}
+
+// experimentStandings 按交易归因统计各变体自实验开始以来的表现
+func (s *Service) experimentStandings(experiment *models.StrategyExperiment) ([]VariantResult, error) {
+	ids := make([]uint, 0, len(experiment.Variants))
+	for _, v := range experiment.Variants {
+		ids = append(ids, v.ID)
+	}
+
+	var rows []StrategyPerformance
+	err := s.db.Model(&models.Transaction{}).
+		Joins("JOIN orders ON orders.id = transactions.order_id").
+		Where("orders.strategy_id IN ? AND transactions.completed_at >= ?", ids, experiment.StartedAt).
+		Select("orders.strategy_id AS strategy_id," + performanceColumns).
+		Group("orders.strategy_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	byStrategy := make(map[uint]StrategyPerformance, len(rows))
+	for _, row := range rows {
+		byStrategy[*row.StrategyID] = row
+	}
+
+	results := make([]VariantResult, 0, len(experiment.Variants))
+	for _, v := range experiment.Variants {
+		id := v.ID
+		perf, ok := byStrategy[id]
+		if !ok {
+			perf = StrategyPerformance{StrategyID: &id}
+		}
+		perf.Name = v.Name
+		perf.WinRate = winRate(perf.WinCount, perf.SellCount)
+
+		result := VariantResult{
+			StrategyPerformance: perf,
+			Variant:             v.Variant,
+			Budget:              v.MaxInvest,
+			Eligible:            perf.SellCount >= int64(experiment.MinTrades),
+		}
+		if v.MaxInvest > 0 {
+			result.Return = perf.Profit / v.MaxInvest
+		}
+		switch experiment.Metric {
+		case MetricReturn:
+			result.Score = result.Return
+		case MetricWinRate:
+			result.Score = perf.WinRate
+		default:
+			result.Score = perf.Profit
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// leader 得分最高的合格变体，得分相同时取先创建的变体
+func leader(results []VariantResult) *uint {
+	var best *VariantResult
+	for i := range results {
+		if !results[i].Eligible {
+			continue
+		}
+		if best == nil || results[i].Score > best.Score {
+			best = &results[i]
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.StrategyID
+}
+
+// RunExperiments 注册A/B测试评估任务，评估期结束的实验选出胜者
+func (s *Service) RunExperiments(interval time.Duration) error {
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "strategy_experiments",
+		Spec: interval.String(),
+		Run:  s.evaluateExperiments,
+	})
+}
+
+func (s *Service) evaluateExperiments() {
+	var experiments []models.StrategyExperiment
+	if err := s.db.Where("status = ? AND ends_at <= ?", "running", time.Now()).Find(&experiments).Error; err != nil {
+		logrus.Errorf("Failed to load finished experiments: %v", err)
+		return
+	}
+
+	for _, e := range experiments {
+		experiment, err := s.loadExperiment(s.db, e.UserID, e.StrategyID, e.ID)
+		if err != nil {
+			continue
+		}
+		standings, err := s.experimentStandings(experiment)
+		if err != nil {
+			logrus.Errorf("Failed to evaluate experiment %d: %v", experiment.ID, err)
+			continue
+		}
+		if err := s.finishExperiment(experiment, standings, leader(standings), experiment.AutoPromote, nil); err != nil {
+			logrus.Errorf("Failed to finish experiment %d: %v", experiment.ID, err)
+		}
+	}
+}
+
+// PromoteVariant 提前结束实验，将指定变体的参数写回母策略并重新激活
+func (s *Service) PromoteVariant(userID, strategyID, experimentID, variantID uint) (*models.StrategyExperiment, error) {
+	experiment, err := s.loadExperiment(s.db, userID, strategyID, experimentID)
+	if err != nil {
+		return nil, err
+	}
+	if experiment.Status != "running" {
+		return nil, errors.New("experiment is not running")
+	}
+	found := false
+	for _, v := range experiment.Variants {
+		found = found || v.ID == variantID
+	}
+	if !found {
+		return nil, errors.New("variant does not belong to this experiment")
+	}
+
+	standings, err := s.experimentStandings(experiment)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.finishExperiment(experiment, standings, &variantID, true, &userID); err != nil {
+		return nil, err
+	}
+	return experiment, nil
+}
+
+// CancelExperiment 取消实验，停止全部变体并恢复母策略原来的状态
+func (s *Service) CancelExperiment(userID, strategyID, experimentID uint) (*models.StrategyExperiment, error) {
+	experiment, err := s.loadExperiment(s.db, userID, strategyID, experimentID)
+	if err != nil {
+		return nil, err
+	}
+	if experiment.Status != "running" {
+		return nil, errors.New("experiment is not running")
+	}
+
+	standings, err := s.experimentStandings(experiment)
+	if err != nil {
+		return nil, err
+	}
+	experiment.Status = "cancelled"
+	if err := s.finishExperiment(experiment, standings, nil, false, &userID); err != nil {
+		return nil, err
+	}
+	return experiment, nil
+}
+
+// finishExperiment 停止全部变体并记录结果；有胜者且promote时胜者的配置写回母策略并激活，否则母策略恢复实验前的状态
+func (s *Service) finishExperiment(experiment *models.StrategyExperiment, standings []VariantResult, winnerID *uint, promote bool, actorID *uint) error {
+	var winner *models.Strategy
+	if winnerID != nil {
+		for i := range experiment.Variants {
+			if experiment.Variants[i].ID == *winnerID {
+				winner = &experiment.Variants[i]
+			}
+		}
+	}
+
+	results, err := json.Marshal(standings)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	experiment.CompletedAt = &now
+	experiment.WinnerID = winnerID
+	experiment.Results = string(results)
+	switch {
+	case experiment.Status == "cancelled":
+	case winner == nil:
+		experiment.Status = "inconclusive"
+	default:
+		experiment.Status = "completed"
+	}
+	experiment.Promoted = winner != nil && promote && experiment.Status == "completed"
+
+	var parent models.Strategy
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 条件更新防止评估任务和手动操作重复结束同一个实验
+		result := tx.Model(&models.StrategyExperiment{}).
+			Where("id = ? AND status = ?", experiment.ID, "running").
+			Updates(map[string]interface{}{
+				"status":       experiment.Status,
+				"completed_at": experiment.CompletedAt,
+				"winner_id":    experiment.WinnerID,
+				"promoted":     experiment.Promoted,
+				"results":      experiment.Results,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("experiment is not running")
+		}
+
+		if err := tx.Model(&models.Strategy{}).Where("experiment_id = ?", experiment.ID).Update("status", "stopped").Error; err != nil {
+			return err
+		}
+
+		if err := tx.First(&parent, experiment.StrategyID).Error; err != nil {
+			// 母策略已删除，只停止变体
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		before := parent
+		parent.Status = experiment.ParentStatus
+		if experiment.Promoted {
+			parent.Config = winner.Config
+			parent.Status = "active"
+		}
+		if err := tx.Model(&parent).Select("status", "config").Updates(&parent).Error; err != nil {
+			return err
+		}
+
+		return audit.Log(tx, audit.Entry{
+			ActorID:    actorID,
+			UserID:     &experiment.UserID,
+			Action:     "strategy.experiment_" + experiment.Status,
+			EntityType: "strategy",
+			EntityID:   parent.ID,
+			Details:    map[string]interface{}{"experiment_id": experiment.ID, "winner_id": winnerID, "promoted": experiment.Promoted},
+			Before:     before,
+			After:      parent,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, v := range experiment.Variants {
+		s.scheduler.Remove(strategyJobID(v.ID))
+		s.stopRunner(v.ID)
+	}
+	if parent.ID != 0 && parent.Status == "active" {
+		if err := s.scheduleStrategy(&parent); err != nil {
+			logrus.Errorf("Failed to reschedule strategy %d after experiment %d: %v", parent.ID, experiment.ID, err)
+		}
+	}
+
+	message := fmt.Sprintf("experiment %d %s", experiment.ID, experiment.Status)
+	if winner != nil {
+		message += fmt.Sprintf(", winner %q", winner.Variant)
+		if experiment.Promoted {
+			message += " promoted"
+		}
+	}
+	s.runLog(experiment.StrategyID, "experiment", message, standings)
+	return nil
+}
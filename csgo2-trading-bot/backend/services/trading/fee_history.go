@@ -0,0 +1,279 @@
+package trading
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/audit"
+	"csgo2-trading-bot/services/ledger"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 手续费版本表很小，缓存在内存中，定期重新加载以同步其他实例的修改
+const feeVersionsRefresh = 5 * time.Minute
+
+// FeeVersionRequest 新增手续费版本
+type FeeVersionRequest struct {
+	Platform      string    `json:"platform" binding:"required"`
+	Buy           float64   `json:"buy"`
+	Sell          float64   `json:"sell"`
+	MinFee        float64   `json:"min_fee"`
+	WithdrawalFee float64   `json:"withdrawal_fee"`
+	Notes         string    `json:"notes"`
+	EffectiveFrom time.Time `json:"effective_from" binding:"required"`
+}
+
+// FeeHistory 平台的手续费历史，Baseline为配置文件中的手续费，适用于第一个版本之前
+type FeeHistory struct {
+	Platform string                      `json:"platform"`
+	Baseline FeeRates                    `json:"baseline"`
+	Versions []models.FeeScheduleVersion `json:"versions"`
+	Current  FeeRates                    `json:"current"`
+}
+
+// FeeRates 某一时刻生效的手续费
+type FeeRates struct {
+	Buy           float64 `json:"buy"`
+	Sell          float64 `json:"sell"`
+	MinFee        float64 `json:"min_fee"`
+	WithdrawalFee float64 `json:"withdrawal_fee"`
+}
+
+// FeeRecomputeReport 按历史手续费重算交易的结果
+type FeeRecomputeReport struct {
+	Checked  int               `json:"checked"`
+	Changed  int               `json:"changed"`
+	FeeDelta float64           `json:"fee_delta"` // 新手续费合计减旧手续费合计
+	Changes  []FeeRecomputeRow `json:"changes"`
+	DryRun   bool              `json:"dry_run"`
+}
+
+// FeeRecomputeRow 一笔手续费有变化的交易
+type FeeRecomputeRow struct {
+	TransactionID uint    `json:"transaction_id"`
+	OrderID       uint    `json:"order_id"`
+	Platform      string  `json:"platform"`
+	OldFee        float64 `json:"old_fee"`
+	NewFee        float64 `json:"new_fee"`
+	OldProfit     float64 `json:"old_profit"`
+	NewProfit     float64 `json:"new_profit"`
+}
+
+// CreateFeeVersion 新增手续费版本，同一平台同一生效时间只能有一个版本
+func (s *Service) CreateFeeVersion(actorID uint, req FeeVersionRequest) (*models.FeeScheduleVersion, error) {
+	for _, rate := range []float64{req.Buy, req.Sell, req.WithdrawalFee} {
+		if rate < 0 || rate >= 1 {
+			return nil, errors.New("fee rates must be between 0 and 1")
+		}
+	}
+	if req.MinFee < 0 {
+		return nil, errors.New("min_fee must not be negative")
+	}
+
+	var count int64
+	s.db.Model(&models.FeeScheduleVersion{}).
+		Where("platform = ? AND effective_from = ?", req.Platform, req.EffectiveFrom).
+		Count(&count)
+	if count > 0 {
+		return nil, errors.New("a fee version with the same effective time already exists")
+	}
+
+	version := &models.FeeScheduleVersion{
+		Platform:      req.Platform,
+		Buy:           req.Buy,
+		Sell:          req.Sell,
+		MinFee:        req.MinFee,
+		WithdrawalFee: req.WithdrawalFee,
+		Notes:         req.Notes,
+		EffectiveFrom: req.EffectiveFrom,
+		CreatedBy:     actorID,
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(version).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, &actorID, "fees.version_create", "fee_schedule_version", version.ID, version)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.loadFeeVersions()
+	return version, nil
+}
+
+// GetFeeHistory 平台的手续费历史
+func (s *Service) GetFeeHistory(platform string) (*FeeHistory, error) {
+	var versions []models.FeeScheduleVersion
+	if err := s.db.Where("platform = ?", platform).Order("effective_from").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return &FeeHistory{
+		Platform: platform,
+		Baseline: feeRates(s.configFeeSchedule(platform)),
+		Versions: versions,
+		Current:  feeRates(s.feeScheduleAt(platform, time.Now())),
+	}, nil
+}
+
+// feeScheduleAt 平台在at时刻生效的手续费：依次查找该平台的版本、该平台的配置、default的版本、default的配置
+func (s *Service) feeScheduleAt(platform string, at time.Time) config.FeeSchedule {
+	s.feeMu.RLock()
+	stale := time.Since(s.feeLoadedAt) > feeVersionsRefresh
+	s.feeMu.RUnlock()
+	if stale {
+		s.loadFeeVersions()
+	}
+
+	s.feeMu.RLock()
+	defer s.feeMu.RUnlock()
+
+	for _, key := range []string{platform, "default"} {
+		if v := versionAt(s.feeVersions[key], at); v != nil {
+			return config.FeeSchedule{Buy: v.Buy, Sell: v.Sell, MinFee: v.MinFee, WithdrawalFee: v.WithdrawalFee}
+		}
+		if _, ok := s.config.Fees[key]; ok {
+			return s.config.Fees[key]
+		}
+	}
+	return config.FeeSchedule{Buy: defaultFeeRate, Sell: defaultFeeRate}
+}
+
+// configFeeSchedule 配置文件中的手续费，未配置时使用default
+func (s *Service) configFeeSchedule(platform string) config.FeeSchedule {
+	for _, key := range []string{platform, "default"} {
+		if fees, ok := s.config.Fees[key]; ok {
+			return fees
+		}
+	}
+	return config.FeeSchedule{Buy: defaultFeeRate, Sell: defaultFeeRate}
+}
+
+func (s *Service) loadFeeVersions() {
+	var versions []models.FeeScheduleVersion
+	if err := s.db.Order("effective_from").Find(&versions).Error; err != nil {
+		logrus.Errorf("Failed to load fee versions: %v", err)
+		return
+	}
+
+	byPlatform := make(map[string][]models.FeeScheduleVersion)
+	for _, v := range versions {
+		byPlatform[v.Platform] = append(byPlatform[v.Platform], v)
+	}
+
+	s.feeMu.Lock()
+	s.feeVersions = byPlatform
+	s.feeLoadedAt = time.Now()
+	s.feeMu.Unlock()
+}
+
+// versionAt 按生效时间升序排列的版本中at时刻生效的版本
+func versionAt(versions []models.FeeScheduleVersion, at time.Time) *models.FeeScheduleVersion {
+	i := sort.Search(len(versions), func(i int) bool {
+		return versions[i].EffectiveFrom.After(at)
+	})
+	if i == 0 {
+		return nil
+	}
+	return &versions[i-1]
+}
+
+func feeRates(fees config.FeeSchedule) FeeRates {
+	return FeeRates{Buy: fees.Buy, Sell: fees.Sell, MinFee: fees.MinFee, WithdrawalFee: fees.WithdrawalFee}
+}
+
+// transactionFee 按交易完成时生效的手续费计算
+func (s *Service) transactionFee(txType, platform string, amount float64, at time.Time) float64 {
+	fees := s.feeScheduleAt(platform, at)
+	if txType == "sell" {
+		return math.Max(amount*fees.Sell, fees.MinFee)
+	}
+	return amount * fees.Buy
+}
+
+// RecomputeFees 按交易完成时生效的手续费重算[from, to)内的交易手续费和利润，差额记为手续费流水；dryRun时只报告
+func (s *Service) RecomputeFees(actorID uint, platform string, from, to time.Time, dryRun bool) (*FeeRecomputeReport, error) {
+	report := &FeeRecomputeReport{Changes: []FeeRecomputeRow{}, DryRun: dryRun}
+
+	query := s.db.Model(&models.Transaction{}).Where("completed_at >= ? AND completed_at < ?", from, to).Order("id")
+	if platform != "" {
+		query = query.Where("platform = ?", platform)
+	}
+
+	var batch []models.Transaction
+	err := query.FindInBatches(&batch, 200, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			t := &batch[i]
+			report.Checked++
+
+			// 差额不足一分的视为一致
+			fee := s.transactionFee(t.Type, t.Platform, t.Amount, t.CompletedAt)
+			if math.Abs(fee-t.Fee) < 0.005 {
+				continue
+			}
+
+			row := FeeRecomputeRow{
+				TransactionID: t.ID,
+				OrderID:       t.OrderID,
+				Platform:      t.Platform,
+				OldFee:        t.Fee,
+				NewFee:        fee,
+				OldProfit:     t.Profit,
+				NewProfit:     t.Profit,
+			}
+			if t.Type == "sell" {
+				row.NewProfit = t.Profit + t.Fee - fee
+			}
+			report.Changed++
+			report.FeeDelta += fee - t.Fee
+			report.Changes = append(report.Changes, row)
+
+			if dryRun {
+				continue
+			}
+			if err := s.applyFeeCorrection(actorID, t, row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// applyFeeCorrection 更新交易的手续费和利润，并追加一条差额手续费流水
+func (s *Service) applyFeeCorrection(actorID uint, t *models.Transaction, row FeeRecomputeRow) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(t).Updates(map[string]interface{}{"fee": row.NewFee, "profit": row.NewProfit}).Error; err != nil {
+			return err
+		}
+		orderID := t.OrderID
+		if err := ledger.Post(tx, &models.LedgerEntry{
+			UserID:  t.UserID,
+			Type:    ledger.TypeFee,
+			Amount:  row.OldFee - row.NewFee,
+			OrderID: &orderID,
+			ActorID: &actorID,
+			Reason:  "fee recomputed with historical schedule",
+		}); err != nil {
+			return err
+		}
+		return audit.Log(tx, audit.Entry{
+			ActorID:    &actorID,
+			UserID:     &t.UserID,
+			Action:     "transaction.fee_recompute",
+			EntityType: "transaction",
+			EntityID:   t.ID,
+			Before:     map[string]float64{"fee": row.OldFee, "profit": row.OldProfit},
+			After:      map[string]float64{"fee": row.NewFee, "profit": row.NewProfit},
+		})
+	})
+}
@@ -0,0 +1,132 @@
+package trading
+
+import (
+	"errors"
+	"math"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+)
+
+// 未配置任何手续费时使用的费率
+const defaultFeeRate = 0.025
+
+// BreakEven 保本卖出价计算结果，价格均为本位币
+type BreakEven struct {
+	Platform       string  `json:"platform"`
+	BuyPlatform    string  `json:"buy_platform,omitempty"`
+	BuyPrice       float64 `json:"buy_price"`
+	BuyFee         float64 `json:"buy_fee"`
+	Cost           float64 `json:"cost"` // 买入价加买入手续费
+	SellFeeRate    float64 `json:"sell_fee_rate"`
+	MinFee         float64 `json:"min_fee,omitempty"`
+	BreakEvenPrice float64 `json:"break_even_price"` // 扣除卖出手续费后刚好收回成本的挂单价
+
+	// 指定物品时，按目标平台当前价格计算
+	ItemID          uint     `json:"item_id,omitempty"`
+	MarketPrice     *float64 `json:"market_price,omitempty"`
+	SellFee         float64  `json:"sell_fee,omitempty"`     // 按当前价格卖出的手续费
+	NetProceeds     float64  `json:"net_proceeds,omitempty"` // 按当前价格卖出的到手金额
+	Profit          float64  `json:"profit,omitempty"`
+	Distance        float64  `json:"distance,omitempty"`         // 当前价格减保本价
+	DistancePercent float64  `json:"distance_percent,omitempty"` // 相对保本价的百分比
+	AboveBreakEven  bool     `json:"above_break_even,omitempty"`
+}
+
+// feeSchedule 平台当前生效的手续费
+func (s *Service) feeSchedule(platform string) config.FeeSchedule {
+	return s.feeScheduleAt(platform, s.now())
+}
+
+// buyFee 买入成交额对应的手续费
+func (s *Service) buyFee(platform string, amount float64) float64 {
+	return amount * s.feeSchedule(platform).Buy
+}
+
+// sellFee 卖出成交额对应的手续费，不低于最低手续费
+func (s *Service) sellFee(platform string, amount float64) float64 {
+	fees := s.feeSchedule(platform)
+	return math.Max(amount*fees.Sell, fees.MinFee)
+}
+
+// SellFee 按平台手续费计算卖出成交额的手续费
+func (s *Service) SellFee(platform string, amount float64) float64 {
+	return s.sellFee(platform, amount)
+}
+
+// breakEvenPrice 扣除卖出手续费后到手金额等于cost的最低卖出价
+func (s *Service) breakEvenPrice(platform string, cost float64) float64 {
+	fees := s.feeSchedule(platform)
+	if fees.Sell >= 1 {
+		return math.Inf(1)
+	}
+	price := cost / (1 - fees.Sell)
+	if price*fees.Sell < fees.MinFee {
+		price = cost + fees.MinFee
+	}
+	// 向上取整到分，避免挂单价四舍五入后略低于保本价
+	return math.Ceil(price*100) / 100
+}
+
+// BreakEven 计算在platform卖出的保本价；buyPlatform不为空时计入买入手续费，itemID不为空时给出当前价格与保本价的距离
+func (s *Service) BreakEven(buyPrice float64, platform, buyPlatform string, itemID uint) (*BreakEven, error) {
+	if buyPrice <= 0 {
+		return nil, errors.New("buy_price must be positive")
+	}
+	if platform == "" {
+		return nil, errors.New("platform is required")
+	}
+
+	fees := s.feeSchedule(platform)
+	result := &BreakEven{
+		Platform:    platform,
+		BuyPlatform: buyPlatform,
+		BuyPrice:    buyPrice,
+		SellFeeRate: fees.Sell,
+		MinFee:      fees.MinFee,
+		ItemID:      itemID,
+	}
+	if buyPlatform != "" {
+		result.BuyFee = s.buyFee(buyPlatform, buyPrice)
+	}
+	result.Cost = buyPrice + result.BuyFee
+	result.BreakEvenPrice = s.breakEvenPrice(platform, result.Cost)
+
+	if itemID == 0 {
+		return result, nil
+	}
+
+	price, err := s.platformPrice(itemID, platform)
+	if err != nil {
+		return nil, err
+	}
+	result.MarketPrice = &price
+	result.SellFee = s.sellFee(platform, price)
+	result.NetProceeds = price - result.SellFee
+	result.Profit = result.NetProceeds - result.Cost
+	result.Distance = price - result.BreakEvenPrice
+	if result.BreakEvenPrice > 0 {
+		result.DistancePercent = result.Distance / result.BreakEvenPrice * 100
+	}
+	result.AboveBreakEven = result.Distance >= 0
+	return result, nil
+}
+
+// platformPrice 物品在平台上的最新价格，没有该平台记录时使用物品当前价
+func (s *Service) platformPrice(itemID uint, platform string) (float64, error) {
+	var item models.Item
+	if err := s.db.Select("id", "current_price").First(&item, itemID).Error; err != nil {
+		return 0, errors.New("item not found")
+	}
+
+	var prices []float64
+	s.db.Model(&models.PriceHistory{}).
+		Where("item_id = ? AND platform = ?", itemID, platform).
+		Order("recorded_at DESC").
+		Limit(1).
+		Pluck("price", &prices)
+	if len(prices) > 0 && prices[0] > 0 {
+		return prices[0], nil
+	}
+	return item.CurrentPrice, nil
+}
@@ -0,0 +1,30 @@
+package trading
+
+import (
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// recordFill 平台执行过程中报告部分成交：追加filled事件并立即按成交数量入库（买单）或出库（卖单）、记账，
+// 订单保持pending直到执行结束。记录失败时返回false，这部分成交由执行结束时的completed事件一并处理
+func (s *Service) recordFill(order *models.Order, quantity int) bool {
+	filled := order.FilledQuantity
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return s.transitionOrder(tx, order, OrderFilled, orderEventData{Quantity: quantity})
+	})
+	if err != nil {
+		logrus.Errorf("Failed to record fill of %d for order %d: %v", quantity, order.ID, err)
+		return false
+	}
+	s.outbox.Kick()
+
+	if order.Type == "sell" {
+		s.removeFromInventory(order, filled, quantity)
+	} else {
+		s.addToInventory(order, quantity)
+	}
+	s.recordTransaction(order, filled, quantity)
+	return true
+}
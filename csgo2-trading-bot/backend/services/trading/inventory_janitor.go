@@ -0,0 +1,76 @@
+package trading
+
+import (
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/audit"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 没有对应挂单的锁定库存：同一用户同一物品不存在待执行的卖单
+const orphanedLockCondition = `locked = ? AND updated_at < ? AND NOT EXISTS (
+	SELECT 1 FROM orders
+	WHERE orders.user_id = inventories.user_id AND orders.item_id = inventories.item_id
+	  AND orders.type = 'sell' AND orders.status = 'pending' AND orders.deleted_at IS NULL)`
+
+// CleanupLockedInventory 注册遗留锁定库存的清理任务。
+// 服务在卖单执行期间崩溃时库存会保持锁定，且不会再有订单将其解锁。
+func (s *Service) CleanupLockedInventory(interval, threshold time.Duration) error {
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "inventory_janitor",
+		Spec: interval.String(),
+		Run: func() {
+			if n, err := s.unlockOrphanedInventory(threshold); err != nil {
+				logrus.Errorf("Inventory janitor failed: %v", err)
+			} else if n > 0 {
+				logrus.Warnf("Inventory janitor unlocked %d orphaned inventory rows", n)
+			}
+		},
+	})
+}
+
+// unlockOrphanedInventory 解锁锁定时间超过threshold且没有挂单的库存，并记录审计日志
+func (s *Service) unlockOrphanedInventory(threshold time.Duration) (int, error) {
+	cutoff := time.Now().Add(-threshold)
+
+	var orphaned []models.Inventory
+	if err := s.db.Where(orphanedLockCondition, true, cutoff).Find(&orphaned).Error; err != nil {
+		return 0, err
+	}
+
+	unlocked := 0
+	for _, inv := range orphaned {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			// 查询后可能有新卖单锁定了该库存，解锁时重新检查条件
+			result := tx.Model(&models.Inventory{}).
+				Where("id = ?", inv.ID).
+				Where(orphanedLockCondition, true, cutoff).
+				Update("locked", false)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+
+			unlocked++
+			return audit.Log(tx, audit.Entry{
+				UserID:     &inv.UserID,
+				Action:     "inventory.unlock_orphaned",
+				EntityType: "inventory",
+				EntityID:   inv.ID,
+				Details: map[string]interface{}{
+					"user_id":   inv.UserID,
+					"item_id":   inv.ItemID,
+					"quantity":  inv.Quantity,
+					"locked_at": inv.UpdatedAt,
+				},
+			})
+		})
+		if err != nil {
+			logrus.Errorf("Failed to unlock orphaned inventory %d: %v", inv.ID, err)
+		}
+	}
+	return unlocked, nil
+}
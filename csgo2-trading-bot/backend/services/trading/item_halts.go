@@ -0,0 +1,200 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/audit"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 暂停交易的来源
+const (
+	HaltByAdmin   = "admin"
+	HaltByAnomaly = "anomaly"
+)
+
+// ErrItemNotFound 物品不存在
+var ErrItemNotFound = errors.New("item not found")
+
+// haltViolation 物品已暂停交易时返回拒单原因，买单和卖单都会被拒绝
+func (s *Service) haltViolation(itemID uint) *RiskViolation {
+	var item models.Item
+	err := s.db.Select("id", "halted_at", "halt_reason").First(&item, itemID).Error
+	if err != nil || item.HaltedAt == nil {
+		return nil
+	}
+	return &RiskViolation{
+		Code:   RiskItemHalted,
+		Reason: fmt.Sprintf("trading on item %d is halted: %s", itemID, item.HaltReason),
+	}
+}
+
+// HaltedItems 暂停交易中的物品，最近暂停的在前
+func (s *Service) HaltedItems() ([]models.Item, error) {
+	var items []models.Item
+	err := s.db.Where("halted_at IS NOT NULL").Order("halted_at DESC").Find(&items).Error
+	return items, err
+}
+
+// HaltItem 暂停物品的交易，actorID为空表示由异常检测自动暂停。已暂停的物品只更新原因
+func (s *Service) HaltItem(actorID *uint, itemID uint, reason string) (*models.Item, error) {
+	source := HaltByAdmin
+	if actorID == nil {
+		source = HaltByAnomaly
+	}
+
+	var item models.Item
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&item, itemID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrItemNotFound
+			}
+			return err
+		}
+		before := haltState(&item)
+
+		now := time.Now()
+		if item.HaltedAt == nil {
+			item.HaltedAt = &now
+		}
+		item.HaltReason = reason
+		item.HaltSource = source
+		if err := tx.Model(&item).Select("halted_at", "halt_reason", "halt_source").Updates(&item).Error; err != nil {
+			return err
+		}
+
+		return audit.Log(tx, audit.Entry{
+			ActorID:    actorID,
+			Action:     "item.halt",
+			EntityType: "item",
+			EntityID:   item.ID,
+			Before:     before,
+			After:      haltState(&item),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Warnf("Trading halted on item %d (%s) by %s: %s", item.ID, item.MarketHashName, source, reason)
+	return &item, nil
+}
+
+// ResumeItem 恢复物品的交易。异常检测在冷却期内不会再次自动暂停该物品
+func (s *Service) ResumeItem(actorID uint, itemID uint) (*models.Item, error) {
+	var item models.Item
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&item, itemID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrItemNotFound
+			}
+			return err
+		}
+		if item.HaltedAt == nil {
+			return nil
+		}
+		before := haltState(&item)
+
+		now := time.Now()
+		item.HaltedAt = nil
+		item.HaltReason = ""
+		item.HaltSource = ""
+		item.HaltResumedAt = &now
+		err := tx.Model(&item).Select("halted_at", "halt_reason", "halt_source", "halt_resumed_at").Updates(&item).Error
+		if err != nil {
+			return err
+		}
+
+		return audit.Log(tx, audit.Entry{
+			ActorID:    &actorID,
+			Action:     "item.resume",
+			EntityType: "item",
+			EntityID:   item.ID,
+			Before:     before,
+			After:      haltState(&item),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func haltState(item *models.Item) map[string]interface{} {
+	return map[string]interface{}{
+		"halted_at":   item.HaltedAt,
+		"halt_reason": item.HaltReason,
+		"halt_source": item.HaltSource,
+	}
+}
+
+// DetectPriceAnomalies 注册价格异常检测任务：最近采集的平台价格偏离7日均价超过max_deviation时自动暂停该物品的交易，
+// 用于拦截行情被操纵或数据源返回错误价格时的自动下单
+func (s *Service) DetectPriceAnomalies(interval time.Duration) error {
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "price_anomaly_halt",
+		Spec: interval.String(),
+		Run: func() {
+			if n, err := s.haltAnomalies(interval); err != nil {
+				logrus.Errorf("Price anomaly detection failed: %v", err)
+			} else if n > 0 {
+				logrus.Warnf("Halted trading on %d items with anomalous prices", n)
+			}
+		},
+	})
+}
+
+// priceSample 物品在一个平台上最近的价格
+type priceSample struct {
+	ItemID        uint
+	Platform      string
+	Price         float64
+	AvgPrice7Days float64 `gorm:"column:avg_price_7days"`
+}
+
+// haltAnomalies 检查最近window内采集的价格，返回新暂停的物品数
+func (s *Service) haltAnomalies(window time.Duration) (int, error) {
+	cfg := s.config.AnomalyHalt
+	now := time.Now()
+	cooldown := now.Add(-time.Duration(cfg.Cooldown) * time.Second)
+
+	var samples []priceSample
+	err := s.db.Raw(`
+		SELECT DISTINCT ON (ph.item_id, ph.platform) ph.item_id, ph.platform, ph.price, i.avg_price_7days
+		FROM price_histories ph
+		JOIN items i ON i.id = ph.item_id
+		WHERE ph.recorded_at >= ? AND ph.price > 0 AND ph.deleted_at IS NULL
+		  AND i.halted_at IS NULL AND i.avg_price_7days > 0 AND i.deleted_at IS NULL
+		  AND (i.halt_resumed_at IS NULL OR i.halt_resumed_at < ?)
+		ORDER BY ph.item_id, ph.platform, ph.recorded_at DESC`,
+		now.Add(-window), cooldown).Scan(&samples).Error
+	if err != nil {
+		return 0, err
+	}
+
+	halted := make(map[uint]bool)
+	for _, sample := range samples {
+		if halted[sample.ItemID] {
+			continue
+		}
+		deviation := sample.Price/sample.AvgPrice7Days - 1
+		if math.Abs(deviation) <= cfg.MaxDeviation {
+			continue
+		}
+		reason := fmt.Sprintf("%s price %.2f deviates %+.0f%% from 7-day average %.2f",
+			sample.Platform, sample.Price, deviation*100, sample.AvgPrice7Days)
+		if _, err := s.HaltItem(nil, sample.ItemID, reason); err != nil {
+			logrus.Errorf("Failed to halt item %d: %v", sample.ItemID, err)
+			continue
+		}
+		halted[sample.ItemID] = true
+	}
+	return len(halted), nil
+}
@@ -0,0 +1,147 @@
+package trading
+
+import (
+	"sync"
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 行情到下单链路上统计的各环节
+const (
+	HopCollectToIngest  = "collect_to_ingest"  // 采集 → 入库
+	HopIngestToEvaluate = "ingest_to_evaluate" // 入库 → 策略决策
+	HopEvaluateToSubmit = "evaluate_to_submit" // 策略决策 → 提交到平台
+	HopCollectToSubmit  = "collect_to_submit"  // 端到端：下单时行情已有多旧
+)
+
+var latencyHops = []string{HopCollectToIngest, HopIngestToEvaluate, HopEvaluateToSubmit, HopCollectToSubmit}
+
+// 直方图桶的上界（秒）
+var latencyBuckets = []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 300, 900, 3600}
+
+// LatencyBucket 耗时不超过LE秒的样本数（累计），LE为0表示+Inf
+type LatencyBucket struct {
+	LE    float64 `json:"le"`
+	Count int64   `json:"count"`
+}
+
+// LatencyHistogram 一个环节的耗时分布
+type LatencyHistogram struct {
+	Count   int64           `json:"count"`
+	Sum     float64         `json:"sum"` // 秒
+	Max     float64         `json:"max"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// LatencyReport 服务启动以来各环节的耗时分布
+type LatencyReport struct {
+	Since time.Time                    `json:"since"`
+	Hops  map[string]*LatencyHistogram `json:"hops"`
+}
+
+// latencyMetrics 进程内的环节耗时直方图
+type latencyMetrics struct {
+	mu     sync.Mutex
+	since  time.Time
+	counts map[string][]int64 // 每个桶的样本数（非累计），最后一个为+Inf
+	sums   map[string]float64
+	maxes  map[string]float64
+}
+
+func newLatencyMetrics() *latencyMetrics {
+	m := &latencyMetrics{
+		since:  time.Now(),
+		counts: make(map[string][]int64),
+		sums:   make(map[string]float64),
+		maxes:  make(map[string]float64),
+	}
+	for _, hop := range latencyHops {
+		m.counts[hop] = make([]int64, len(latencyBuckets)+1)
+	}
+	return m
+}
+
+func (m *latencyMetrics) observe(hop string, d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	seconds := d.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := 0
+	for i < len(latencyBuckets) && seconds > latencyBuckets[i] {
+		i++
+	}
+	m.counts[hop][i]++
+	m.sums[hop] += seconds
+	if seconds > m.maxes[hop] {
+		m.maxes[hop] = seconds
+	}
+}
+
+func (m *latencyMetrics) report() *LatencyReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := &LatencyReport{Since: m.since, Hops: make(map[string]*LatencyHistogram, len(latencyHops))}
+	for _, hop := range latencyHops {
+		h := &LatencyHistogram{Sum: m.sums[hop], Max: m.maxes[hop]}
+		for i, count := range m.counts[hop] {
+			h.Count += count
+			le := 0.0
+			if i < len(latencyBuckets) {
+				le = latencyBuckets[i]
+			}
+			h.Buckets = append(h.Buckets, LatencyBucket{LE: le, Count: h.Count})
+		}
+		report.Hops[hop] = h
+	}
+	return report
+}
+
+// GetLatencyReport 各环节的耗时分布
+func (s *Service) GetLatencyReport() *LatencyReport {
+	return s.latency.report()
+}
+
+// newOrderLatency 记录策略下单所依据的最新行情及决策时间，订单创建时一并写入
+func (s *Service) newOrderLatency(strategyID, itemID uint, platform string) *models.OrderLatency {
+	latency := &models.OrderLatency{StrategyID: strategyID, EvaluatedAt: time.Now()}
+
+	var tick models.PriceHistory
+	query := s.db.Select("recorded_at", "ingested_at").Where("item_id = ?", itemID)
+	if platform != "" && platform != PlatformAuto {
+		query = query.Where("platform = ?", platform)
+	}
+	if err := query.Order("recorded_at DESC").First(&tick).Error; err != nil {
+		return nil
+	}
+
+	latency.CollectedAt = tick.RecordedAt
+	latency.IngestedAt = tick.IngestedAt
+	return latency
+}
+
+// recordSubmission 订单提交到平台时补全时间点并计入直方图
+func (s *Service) recordSubmission(order *models.Order) {
+	latency := order.Latency
+	if latency == nil || latency.ID == 0 || latency.SubmittedAt != nil {
+		return
+	}
+
+	now := time.Now()
+	latency.SubmittedAt = &now
+	if err := s.db.Model(latency).Update("submitted_at", now).Error; err != nil {
+		logrus.Errorf("Failed to record submission of order %d: %v", order.ID, err)
+	}
+
+	s.latency.observe(HopCollectToIngest, latency.IngestedAt.Sub(latency.CollectedAt))
+	s.latency.observe(HopIngestToEvaluate, latency.EvaluatedAt.Sub(latency.IngestedAt))
+	s.latency.observe(HopEvaluateToSubmit, now.Sub(latency.EvaluatedAt))
+	s.latency.observe(HopCollectToSubmit, now.Sub(latency.CollectedAt))
+}
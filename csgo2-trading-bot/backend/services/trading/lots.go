@@ -0,0 +1,355 @@
+package trading
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 卖出时选择持仓批次的方式
+const (
+	LotFIFO          = "fifo"           // 先买先卖
+	LotLIFO          = "lifo"           // 后买先卖
+	LotMinGain       = "min_gain"       // 成本最高的批次优先，使已实现收益最小
+	LotHarvestLosses = "harvest_losses" // 优先卖出浮亏最大的批次实现亏损，其余按先买先卖
+)
+
+// LotMethods 可选的批次选择方式
+var LotMethods = []string{LotFIFO, LotLIFO, LotMinGain, LotHarvestLosses}
+
+// errInventoryChanged 选定的批次在锁定前被其他订单占用
+var errInventoryChanged = errors.New("inventory changed while placing the order, please retry")
+
+// LotSelection 卖单选定的一个持仓批次及从中卖出的数量
+type LotSelection struct {
+	InventoryID uint      `json:"inventory_id"`
+	Quantity    int       `json:"quantity"`
+	BuyPrice    float64   `json:"buy_price"`
+	AcquiredAt  time.Time `json:"acquired_at"`
+}
+
+func validLotMethod(method string) bool {
+	for _, m := range LotMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// GetLotMethod 用户默认的批次选择方式
+func (s *Service) GetLotMethod(userID uint) string {
+	var user models.User
+	if err := s.db.Select("lot_method").First(&user, userID).Error; err != nil || !validLotMethod(user.LotMethod) {
+		return LotFIFO
+	}
+	return user.LotMethod
+}
+
+// SetLotMethod 修改用户默认的批次选择方式
+func (s *Service) SetLotMethod(userID uint, method string) error {
+	if !validLotMethod(method) {
+		return fmt.Errorf("unknown lot method: %s", method)
+	}
+	return s.db.Model(&models.User{}).Where("id = ?", userID).Update("lot_method", method).Error
+}
+
+// selectLots 按订单的批次选择方式从可用库存中选出要卖出的批次，未指定时使用用户默认设置。
+// 可用库存行以FOR UPDATE读取，须在事务中调用，锁定到事务结束
+func (s *Service) selectLots(tx *gorm.DB, order *models.Order) ([]LotSelection, error) {
+	if order.LotMethod == "" {
+		order.LotMethod = s.GetLotMethod(order.UserID)
+	}
+	if !validLotMethod(order.LotMethod) {
+		return nil, fmt.Errorf("unknown lot method: %s", order.LotMethod)
+	}
+
+	var inventories []models.Inventory
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND item_id = ? AND locked = ? AND quantity > 0", order.UserID, order.ItemID, false).
+		Where(notReserved).
+		Find(&inventories).Error
+	if err != nil {
+		return nil, err
+	}
+
+	lots, remaining := pickLots(inventories, order)
+	if remaining > 0 {
+		return nil, errors.New("insufficient inventory")
+	}
+	return lots, nil
+}
+
+// claimLots 校验调用方指定的批次仍属于该用户和物品、未锁定且数量足够，合计数量须等于订单数量。
+// 持仓监控用它卖出触发止损止盈的那一批，而不是按批次选择方式选中其他批次。须在事务中调用
+func claimLots(tx *gorm.DB, order *models.Order, given []LotSelection) ([]LotSelection, error) {
+	var inventories []models.Inventory
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ? AND user_id = ? AND item_id = ? AND locked = ?", lotIDs(given), order.UserID, order.ItemID, false).
+		Where(notReserved).
+		Find(&inventories).Error
+	if err != nil {
+		return nil, err
+	}
+	available := make(map[uint]models.Inventory, len(inventories))
+	for _, inv := range inventories {
+		available[inv.ID] = inv
+	}
+
+	lots := make([]LotSelection, 0, len(given))
+	total := 0
+	for _, lot := range given {
+		inv, ok := available[lot.InventoryID]
+		if !ok || lot.Quantity <= 0 || inv.Quantity < lot.Quantity {
+			return nil, errInventoryChanged
+		}
+		lots = append(lots, LotSelection{
+			InventoryID: inv.ID,
+			Quantity:    lot.Quantity,
+			BuyPrice:    inv.BuyPrice,
+			AcquiredAt:  inv.AcquiredAt,
+		})
+		total += lot.Quantity
+	}
+	if total != order.Quantity {
+		return nil, fmt.Errorf("selected lots cover %d items, order quantity is %d", total, order.Quantity)
+	}
+	return lots, nil
+}
+
+// pickLots 按订单的批次选择方式依次从批次中取出订单数量，remaining为库存不足的数量
+func pickLots(inventories []models.Inventory, order *models.Order) (lots []LotSelection, remaining int) {
+	sortLots(inventories, order.LotMethod, order.Price)
+
+	remaining = order.Quantity
+	for _, inv := range inventories {
+		if remaining == 0 {
+			break
+		}
+		quantity := min(inv.Quantity, remaining)
+		lots = append(lots, LotSelection{
+			InventoryID: inv.ID,
+			Quantity:    quantity,
+			BuyPrice:    inv.BuyPrice,
+			AcquiredAt:  inv.AcquiredAt,
+		})
+		remaining -= quantity
+	}
+	return lots, remaining
+}
+
+// assignLots 为没有记录批次的卖单（批次核算之前提交的订单）在成交时按用户的批次选择方式匹配批次并保存到订单。
+// 这类订单下单时锁定了该物品的全部库存，因此已锁定的批次也参与匹配；没有可匹配的库存时返回nil
+func (s *Service) assignLots(order *models.Order) []LotSelection {
+	if !validLotMethod(order.LotMethod) {
+		order.LotMethod = s.GetLotMethod(order.UserID)
+	}
+
+	var lots []LotSelection
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var inventories []models.Inventory
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND item_id = ? AND quantity > 0", order.UserID, order.ItemID).
+			Where(notReserved).
+			Find(&inventories).Error; err != nil {
+			return err
+		}
+
+		var remaining int
+		if lots, remaining = pickLots(inventories, order); len(lots) == 0 {
+			return nil
+		}
+		if remaining > 0 {
+			logrus.Warnf("Sell order %d matched only %d of %d items to inventory lots", order.ID, order.Quantity-remaining, order.Quantity)
+		}
+		if err := setOrderLots(order, lots); err != nil {
+			return err
+		}
+		return tx.Model(order).Updates(map[string]interface{}{"lots": order.Lots, "lot_method": order.LotMethod}).Error
+	})
+	if err != nil {
+		logrus.Errorf("Failed to assign lots to order %d: %v", order.ID, err)
+		return nil
+	}
+	return lots
+}
+
+// sortLots 按选择方式排列批次，同等条件下先买入的优先
+func sortLots(inventories []models.Inventory, method string, price float64) {
+	sort.SliceStable(inventories, func(i, j int) bool {
+		a, b := inventories[i], inventories[j]
+		switch method {
+		case LotLIFO:
+			return a.AcquiredAt.After(b.AcquiredAt)
+		case LotMinGain:
+			if a.BuyPrice != b.BuyPrice {
+				return a.BuyPrice > b.BuyPrice
+			}
+		case LotHarvestLosses:
+			lossA, lossB := a.BuyPrice > price, b.BuyPrice > price
+			if lossA != lossB {
+				return lossA
+			}
+			if lossA && a.BuyPrice != b.BuyPrice {
+				return a.BuyPrice > b.BuyPrice
+			}
+		}
+		return a.AcquiredAt.Before(b.AcquiredAt)
+	})
+}
+
+// setOrderLots 在订单上记录选定的批次
+func setOrderLots(order *models.Order, lots []LotSelection) error {
+	encoded, err := encodeLots(lots)
+	if err != nil {
+		return err
+	}
+	order.Lots = encoded
+	return nil
+}
+
+// encodeLots 批次编码为订单和成交记录中保存的JSON
+func encodeLots(lots []LotSelection) (*string, error) {
+	raw, err := json.Marshal(lots)
+	if err != nil {
+		return nil, err
+	}
+	encoded := string(raw)
+	return &encoded, nil
+}
+
+// orderLots 订单上记录的批次，早期订单没有记录时返回nil
+func orderLots(order *models.Order) []LotSelection {
+	if order.Lots == nil {
+		return nil
+	}
+	var lots []LotSelection
+	if err := json.Unmarshal([]byte(*order.Lots), &lots); err != nil {
+		return nil
+	}
+	return lots
+}
+
+func lotIDs(lots []LotSelection) []uint {
+	ids := make([]uint, 0, len(lots))
+	for _, lot := range lots {
+		ids = append(ids, lot.InventoryID)
+	}
+	return ids
+}
+
+// lockLots 锁定选定的批次，任一批次已被占用时全部回滚
+func lockLots(db *gorm.DB, lots []LotSelection) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Inventory{}).
+			Where("id IN ? AND locked = ?", lotIDs(lots), false).
+			Where(notReserved).
+			Update("locked", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != int64(len(lots)) {
+			return errInventoryChanged
+		}
+		return nil
+	})
+}
+
+// lotAssets 卖单批次对应的Steam资产ID，只取订单自己锁定的批次；没有记录批次的卖单先匹配批次
+func (s *Service) lotAssets(order *models.Order) ([]string, error) {
+	lots := orderLots(order)
+	if lots == nil {
+		if lots = s.assignLots(order); lots == nil {
+			return nil, errors.New("no inventory lots matched the sell order")
+		}
+	}
+	var assets []string
+	if err := s.db.Model(&models.Inventory{}).
+		Where("id IN ? AND asset_id <> ''", lotIDs(lots)).
+		Order("acquired_at, id").
+		Limit(order.Quantity).
+		Pluck("asset_id", &assets).Error; err != nil {
+		return nil, err
+	}
+	if len(assets) < order.Quantity {
+		return nil, errors.New("inventory items have no steam asset id")
+	}
+	return assets, nil
+}
+
+// unlockLots 解锁订单的库存：有批次记录时只解锁这些批次
+func unlockLots(db *gorm.DB, order *models.Order) error {
+	query := db.Model(&models.Inventory{})
+	if lots := orderLots(order); lots != nil {
+		query = query.Where("id IN ?", lotIDs(lots))
+	} else {
+		query = query.Where("user_id = ? AND item_id = ?", order.UserID, order.ItemID).Where(notReserved)
+	}
+	return query.Update("locked", false).Error
+}
+
+// fillLots 部分成交时对应的批次：订单的批次按顺序排列，已成交filled件之后的quantity件。
+// open为本次之后订单仍需从中卖出的批次，扣减后继续保持锁定
+func fillLots(lots []LotSelection, filled, quantity int) (portion []LotSelection, open []uint) {
+	start, end := filled, filled+quantity
+	offset := 0
+	for _, lot := range lots {
+		from, to := max(start, offset), min(end, offset+lot.Quantity)
+		if from < to {
+			part := lot
+			part.Quantity = to - from
+			portion = append(portion, part)
+			if to < offset+lot.Quantity {
+				open = append(open, lot.InventoryID)
+			}
+		}
+		offset += lot.Quantity
+	}
+	return portion, open
+}
+
+// consumeLots 扣减卖出的批次，批次卖完时删除，未卖完的部分解锁；open中的批次订单还要继续卖出，保持锁定
+func consumeLots(db *gorm.DB, lots []LotSelection, open ...uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, lot := range lots {
+			var inv models.Inventory
+			if err := tx.First(&inv, lot.InventoryID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue
+				}
+				return err
+			}
+			if inv.Quantity <= lot.Quantity {
+				if err := tx.Delete(&inv).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Model(&inv).Updates(map[string]interface{}{
+				"quantity": inv.Quantity - lot.Quantity,
+				"locked":   slices.Contains(open, inv.ID),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// costBasis 批次的买入成本合计
+func costBasis(lots []LotSelection) float64 {
+	var total float64
+	for _, lot := range lots {
+		total += lot.BuyPrice * float64(lot.Quantity)
+	}
+	return total
+}
@@ -0,0 +1,163 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/httpclient"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+)
+
+// executeMarketCSGOBuy 逐件购买不高于订单价格的物品，卖家随后向账户绑定的交易链接发出报价
+func (s *Service) executeMarketCSGOBuy(order *models.Order) error {
+	var item models.Item
+	if err := s.db.Select("id", "market_hash_name").First(&item, order.ItemID).Error; err != nil {
+		return err
+	}
+
+	maxPrice, err := s.fromBaseCurrency(order.Price, s.marketcsgo.Currency())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(httpclient.WithPriority(s.ctx, httpclient.PriorityTrade), time.Minute)
+	defer cancel()
+
+	bought := 0
+	var buyErr error
+	for bought < order.Quantity {
+		if _, err := s.marketcsgo.Buy(ctx, item.MarketHashName, maxPrice); err != nil {
+			buyErr = err
+			break
+		}
+		bought++
+		s.recordFill(order, 1)
+	}
+
+	if bought == 0 {
+		return buyErr
+	}
+	if buyErr != nil {
+		logrus.Warnf("Market.CSGO order %d partially filled %d/%d: %v", order.ID, bought, order.Quantity, buyErr)
+		order.Quantity = bought
+	}
+	return nil
+}
+
+// executeMarketCSGOSell 按订单价格上架订单锁定批次中的物品
+func (s *Service) executeMarketCSGOSell(order *models.Order) error {
+	assets, err := s.lotAssets(order)
+	if err != nil {
+		return err
+	}
+
+	price, err := s.fromBaseCurrency(order.Price, s.marketcsgo.Currency())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(httpclient.WithPriority(s.ctx, httpclient.PriorityTrade), time.Minute)
+	defer cancel()
+
+	for _, assetID := range assets {
+		if _, err := s.marketcsgo.AddToSale(ctx, assetID, price); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncMarketCSGO 注册Market.CSGO价格同步和交易报价交接任务
+func (s *Service) SyncMarketCSGO(priceInterval, handoffInterval time.Duration) error {
+	if s.marketcsgo == nil {
+		return errors.New("market.csgo is not enabled")
+	}
+	if err := s.scheduler.Add(scheduler.Job{
+		ID:   "marketcsgo_prices",
+		Spec: priceInterval.String(),
+		Run:  s.syncMarketCSGOPrices,
+	}); err != nil {
+		return err
+	}
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "marketcsgo_handoff",
+		Spec: handoffInterval.String(),
+		Run:  s.handoffMarketCSGOTrades,
+	})
+}
+
+func (s *Service) syncMarketCSGOPrices() {
+	ctx, cancel := context.WithTimeout(httpclient.WithPriority(s.ctx, httpclient.PriorityBackground), 2*time.Minute)
+	defer cancel()
+
+	prices, err := s.marketcsgo.GetPrices(ctx)
+	if err != nil {
+		logrus.Errorf("Failed to fetch Market.CSGO prices: %v", err)
+		return
+	}
+
+	quotes := make(map[string]float64, len(prices))
+	for _, p := range prices {
+		quotes[p.MarketHashName] = p.Price
+	}
+	s.savePlatformPrices("marketcsgo", s.marketcsgo.Currency(), quotes)
+}
+
+// handoffMarketCSGOTrades 保持在线并将已售出物品的交易报价交给物品所属用户发出
+func (s *Service) handoffMarketCSGOTrades() {
+	ctx, cancel := context.WithTimeout(httpclient.WithPriority(s.ctx, httpclient.PriorityTrade), time.Minute)
+	defer cancel()
+
+	if err := s.marketcsgo.Ping(ctx); err != nil {
+		logrus.Warnf("Market.CSGO ping failed: %v", err)
+	}
+
+	offers, err := s.marketcsgo.PendingOffers(ctx)
+	if err != nil {
+		logrus.Warnf("Failed to fetch Market.CSGO trade requests: %v", err)
+		return
+	}
+
+	for i := range offers {
+		offer := &offers[i]
+		assetIDs := make([]string, 0, len(offer.Items))
+		for _, item := range offer.Items {
+			assetIDs = append(assetIDs, item.AssetID)
+		}
+		if len(assetIDs) == 0 {
+			continue
+		}
+
+		// 同一报价只通知一次，买家超时未收到时平台会取消订单
+		key := fmt.Sprintf("marketcsgo:offer:%d:%s", offer.Partner, assetIDs[0])
+		if _, err := s.cache.Get(ctx, key); err == nil {
+			continue
+		}
+
+		var inventory models.Inventory
+		if err := s.db.Where("asset_id IN ?", assetIDs).First(&inventory).Error; err != nil {
+			logrus.Warnf("Market.CSGO trade request for unknown assets %v", assetIDs)
+			continue
+		}
+
+		s.notifier.Publish(inventory.UserID, notify.Message{
+			Event: notify.EventTradeOfferRequired,
+			Title: "Market.CSGO物品已售出",
+			Body:  fmt.Sprintf("请向买家发送包含%d件物品的交易报价", len(assetIDs)),
+			Data: map[string]interface{}{
+				"platform":  "marketcsgo",
+				"trade_url": offer.TradeURL(),
+				"message":   offer.Message,
+				"asset_ids": assetIDs,
+			},
+		})
+
+		s.cache.Set(ctx, key, 1, time.Hour)
+	}
+}
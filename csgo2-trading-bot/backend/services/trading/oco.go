@@ -0,0 +1,203 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidOCOPrices 止盈价须高于止损触发价，价格均须为正
+var ErrInvalidOCOPrices = errors.New("take_profit must be greater than stop_price, and prices must be positive")
+
+// OCORequest 止盈止损OCO订单：两腿卖出同一批持仓，一腿开始执行时另一腿自动取消
+type OCORequest struct {
+	ItemID     uint
+	Quantity   int
+	Platform   string
+	LotMethod  string
+	TakeProfit float64 // 止盈价
+	StopPrice  float64 // 止损触发价
+	StopLimit  float64 // 止损卖出价，0表示按触发价卖出
+	ExpiresAt  *time.Time
+}
+
+// OCOPair OCO订单的两腿
+type OCOPair struct {
+	TakeProfit *models.Order `json:"take_profit"`
+	StopLoss   *models.Order `json:"stop_loss"`
+}
+
+// CreateOCOOrder 为持仓提交止盈和止损两腿卖单。两腿共用同一批锁定的库存，
+// 任一腿开始执行、被取消或过期时另一腿在同一事务中取消
+func (s *Service) CreateOCOOrder(userID uint, req OCORequest) (*OCOPair, error) {
+	if s.underMaintenance() {
+		return nil, ErrMaintenance
+	}
+	if req.StopPrice <= 0 || req.TakeProfit <= req.StopPrice || req.StopLimit < 0 {
+		return nil, ErrInvalidOCOPrices
+	}
+	if err := validateExpiry(req.ExpiresAt); err != nil {
+		return nil, err
+	}
+	stopLimit := req.StopLimit
+	if stopLimit == 0 {
+		stopLimit = req.StopPrice
+	}
+	stopPrice := req.StopPrice
+
+	takeProfit := &models.Order{
+		UserID:    userID,
+		ItemID:    req.ItemID,
+		Type:      "sell",
+		Price:     req.TakeProfit,
+		Quantity:  req.Quantity,
+		Platform:  req.Platform,
+		LotMethod: req.LotMethod,
+		ExpiresAt: req.ExpiresAt,
+		Kind:      OrderKindTakeProfit,
+	}
+	// 两腿在同一平台卖出，按止盈腿确定平台
+	if err := s.resolvePlatform(takeProfit); err != nil {
+		return nil, err
+	}
+	stopLoss := &models.Order{
+		UserID:    userID,
+		ItemID:    req.ItemID,
+		Type:      "sell",
+		Price:     stopLimit,
+		Quantity:  req.Quantity,
+		Platform:  takeProfit.Platform,
+		Routing:   takeProfit.Routing,
+		ExpiresAt: req.ExpiresAt,
+		Kind:      OrderKindStopLoss,
+		StopPrice: &stopPrice,
+	}
+
+	var violation *RiskViolation
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID); err != nil {
+			return err
+		}
+
+		lots, err := s.selectLots(tx, takeProfit)
+		if err != nil {
+			return err
+		}
+		if err := setOrderLots(takeProfit, lots); err != nil {
+			return err
+		}
+		stopLoss.LotMethod, stopLoss.Lots = takeProfit.LotMethod, takeProfit.Lots
+
+		for _, leg := range []*models.Order{takeProfit, stopLoss} {
+			leg.Status = "pending"
+			if violation = s.evaluateRisk(leg); violation != nil {
+				return violation
+			}
+		}
+
+		if err := lockLots(tx, lots); err != nil {
+			return err
+		}
+		if err := insertOrder(tx, takeProfit); err != nil {
+			return err
+		}
+		stopLoss.OCOID = &takeProfit.ID
+		if err := insertOrder(tx, stopLoss); err != nil {
+			return err
+		}
+		return s.transitionOrder(tx, takeProfit, OrderLinked, orderEventData{OCOID: &stopLoss.ID})
+	})
+	if violation != nil {
+		s.notifyRiskViolation(takeProfit, violation)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.outbox.Kick()
+	s.watchTrigger(req.ItemID)
+
+	return &OCOPair{TakeProfit: takeProfit, StopLoss: stopLoss}, nil
+}
+
+// cancelLinkedOrder 在事务中取消OCO订单的另一腿，另一腿已结束时忽略
+func (s *Service) cancelLinkedOrder(tx *gorm.DB, orderID, by uint) error {
+	linked := &models.Order{}
+	linked.ID = orderID
+	err := s.transitionOrder(tx, linked, OrderCancelled, orderEventData{
+		Reason: fmt.Sprintf("linked order #%d", by),
+		linked: true,
+	})
+	if errors.Is(err, errOrderTransition) {
+		return nil
+	}
+	return err
+}
+
+// claimLinkedExecution 标记OCO订单的一腿开始执行并在同一事务中取消另一腿；
+// 两腿按id顺序加锁，同时触发时只有一腿能开始执行
+func (s *Service) claimLinkedExecution(order *models.Order) bool {
+	now := time.Now()
+	claimed := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var legs []models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", []uint{order.ID, *order.OCOID}).
+			Order("id").
+			Find(&legs).Error; err != nil {
+			return err
+		}
+		for _, leg := range legs {
+			if leg.Status == "pending" && leg.ExecutionStartedAt != nil {
+				return nil
+			}
+		}
+
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND status = ? AND execution_started_at IS NULL AND version = ?", order.ID, "pending", order.Version).
+			Updates(map[string]interface{}{"execution_started_at": now, "version": gorm.Expr("version + 1")})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := s.cancelLinkedOrder(tx, *order.OCOID, order.ID); err != nil {
+			return err
+		}
+		claimed = true
+		return appendTimelineEvent(tx, order.ID, OrderSent, orderEventData{Platform: order.Platform})
+	})
+	if err != nil {
+		logrus.Errorf("Failed to claim OCO order %d for execution: %v", order.ID, err)
+		return false
+	}
+	if !claimed {
+		return false
+	}
+	s.outbox.Kick()
+	order.ExecutionStartedAt = &now
+	order.Version++
+	return true
+}
+
+// checkOCOPrices 修改OCO一腿的价格后重新检查止盈价须高于止损触发价，与下单时的规则一致
+func (s *Service) checkOCOPrices(db *gorm.DB, leg *models.Order) error {
+	if leg.OCOID == nil {
+		return nil
+	}
+	var other models.Order
+	if err := db.First(&other, *leg.OCOID).Error; err != nil {
+		return err
+	}
+	takeProfit, stopLoss := leg, &other
+	if leg.Kind == OrderKindStopLoss {
+		takeProfit, stopLoss = &other, leg
+	}
+	if stopLoss.StopPrice == nil || *stopLoss.StopPrice <= 0 || takeProfit.Price <= *stopLoss.StopPrice {
+		return ErrInvalidOCOPrices
+	}
+	return nil
+}
@@ -0,0 +1,482 @@
+package trading
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/audit"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 订单事件类型
+const (
+	OrderCreated   = "created"
+	OrderTriggered = "triggered" // 条件单价格触发，订单仍为pending
+	OrderAmended   = "amended"   // 用户修改了价格或数量，订单仍为pending
+	OrderFilled    = "filled"    // 部分成交，订单仍为pending
+	OrderCompleted = "completed"
+	OrderFailed    = "failed"
+	OrderCancelled = "cancelled"
+	OrderExpired   = "expired"
+	OrderLinked    = "linked" // OCO订单的一腿关联到另一腿，订单仍为pending
+)
+
+// 只记录在订单时间线中、不改变订单状态的事件，用于说明订单为什么一直处于pending
+const (
+	OrderQueued       = "queued"       // 交给执行队列
+	OrderDeferred     = "deferred"     // 平台API配额用尽，延迟执行
+	OrderSent         = "sent"         // 开始向平台提交
+	OrderAcknowledged = "acknowledged" // 平台已接受（买入成功或卖单已上架）
+)
+
+// timelineEvents 不参与状态投影的事件
+var timelineEvents = map[string]bool{
+	OrderQueued:       true,
+	OrderDeferred:     true,
+	OrderSent:         true,
+	OrderAcknowledged: true,
+}
+
+// errOrderTransition 事件与订单当前状态不符，如已取消的订单又收到成交事件
+var errOrderTransition = errors.New("invalid order transition")
+
+// ErrOrderNotFound 订单不存在或不属于该用户
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrVersionConflict 订单或策略在读取之后已被修改（如撤单时订单已开始执行），需要重新读取后再操作
+var ErrVersionConflict = errors.New("modified concurrently, reload and retry")
+
+// orderEventData 事件内容，不同事件只使用其中的部分字段
+type orderEventData struct {
+	// created，amended（修改后的价格和数量），triggered（止损单触发时的成交价）
+	UserID         uint    `json:"user_id,omitempty"`
+	ItemID         uint    `json:"item_id,omitempty"`
+	Type           string  `json:"type,omitempty"`
+	Price          float64 `json:"price,omitempty"`
+	Platform       string  `json:"platform,omitempty"`
+	StrategyID     *uint   `json:"strategy_id,omitempty"`
+	SubscriptionID *uint   `json:"subscription_id,omitempty"`
+	ParentID       *uint   `json:"parent_id,omitempty"`
+
+	// created：条件单、OCO、过期时间和卖单批次；amended（按新数量重新选择的批次）
+	Kind      string     `json:"kind,omitempty"`
+	StopPrice *float64   `json:"stop_price,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Routing   *string    `json:"routing,omitempty"`
+	LotMethod string     `json:"lot_method,omitempty"`
+	Lots      *string    `json:"lots,omitempty"`
+
+	// created（止损腿）、linked（止盈腿）
+	OCOID *uint `json:"oco_id,omitempty"`
+
+	// triggered
+	TriggeredAt *time.Time `json:"triggered_at,omitempty"`
+
+	// created、completed（部分成交时为实际成交数量）、filled（本次成交数量）
+	Quantity int `json:"quantity,omitempty"`
+
+	// completed
+	ExecutedAt *time.Time `json:"executed_at,omitempty"`
+
+	// failed、expired，cancelled（OCO另一腿自动取消时），deferred（延迟原因）
+	Reason string `json:"reason,omitempty"`
+
+	// linked 由OCO另一腿引起的取消，不再反过来取消另一腿
+	linked bool
+}
+
+// projectionColumns 由事件投影得到的订单列
+var projectionColumns = []string{
+	"user_id", "item_id", "type", "price", "quantity", "platform", "strategy_id", "subscription_id", "parent_id",
+	"kind", "stop_price", "expires_at", "routing", "lot_method", "lots", "oco_id", "triggered_at",
+	"status", "filled_quantity", "executed_at", "failed_reason",
+}
+
+// versionedColumns 投影列加上版本号，状态变化时一起更新
+var versionedColumns = append(append([]string{}, projectionColumns...), "version")
+
+// applyOrderEvent 把一个事件应用到订单上，是订单状态的唯一推导规则
+func applyOrderEvent(order *models.Order, eventType string, data orderEventData) error {
+	if timelineEvents[eventType] {
+		return nil
+	}
+	if eventType == OrderCreated {
+		if order.Status != "" {
+			return fmt.Errorf("%w: order %d already created", errOrderTransition, order.ID)
+		}
+		order.UserID = data.UserID
+		order.ItemID = data.ItemID
+		order.Type = data.Type
+		order.Price = data.Price
+		order.Quantity = data.Quantity
+		order.Platform = data.Platform
+		order.StrategyID = data.StrategyID
+		order.SubscriptionID = data.SubscriptionID
+		order.ParentID = data.ParentID
+		order.Kind = data.Kind
+		order.StopPrice = data.StopPrice
+		order.ExpiresAt = data.ExpiresAt
+		order.Routing = data.Routing
+		order.LotMethod = data.LotMethod
+		order.Lots = data.Lots
+		order.OCOID = data.OCOID
+		order.Status = "pending"
+		return nil
+	}
+
+	// 其余事件只能从pending转入，除修改、触发、关联和部分成交外都是终态
+	if order.Status != "pending" {
+		return fmt.Errorf("%w: order %d is %s, cannot apply %s", errOrderTransition, order.ID, order.Status, eventType)
+	}
+	switch eventType {
+	case OrderAmended:
+		if data.Price > 0 {
+			order.Price = data.Price
+		}
+		if data.Quantity > 0 {
+			order.Quantity = data.Quantity
+		}
+		if data.Lots != nil {
+			order.Lots = data.Lots
+		}
+	case OrderTriggered:
+		if data.Price > 0 {
+			order.Price = data.Price
+		}
+		if data.TriggeredAt != nil {
+			order.TriggeredAt = data.TriggeredAt
+		}
+	case OrderLinked:
+		order.OCOID = data.OCOID
+	case OrderFilled:
+		if data.Quantity <= 0 || order.FilledQuantity+data.Quantity > order.Quantity {
+			return fmt.Errorf("%w: order %d filled %d/%d, cannot fill %d more",
+				errOrderTransition, order.ID, order.FilledQuantity, order.Quantity, data.Quantity)
+		}
+		order.FilledQuantity += data.Quantity
+	case OrderCompleted:
+		order.Status = "completed"
+		if data.Quantity > 0 {
+			order.Quantity = data.Quantity
+		}
+		order.FilledQuantity = order.Quantity
+		order.ExecutedAt = data.ExecutedAt
+	case OrderFailed, OrderExpired:
+		order.Status = eventType
+		order.FailedReason = data.Reason
+	case OrderCancelled:
+		order.Status = "cancelled"
+	default:
+		return fmt.Errorf("unknown order event %q", eventType)
+	}
+	return nil
+}
+
+// insertOrder 在事务中写入订单、created事件和待推送的消息，调用方在提交后调用s.outbox.Kick()
+func insertOrder(tx *gorm.DB, order *models.Order) error {
+	order.Status = "pending"
+	if err := tx.Create(order).Error; err != nil {
+		return err
+	}
+	if err := appendOrderEvent(tx, order.ID, 1, OrderCreated, createdEventData(order)); err != nil {
+		return err
+	}
+	return writeOrderOutbox(tx, OrderCreated, order)
+}
+
+// createdEventData created事件的内容，包含重放出完整订单所需的全部下单字段
+func createdEventData(order *models.Order) orderEventData {
+	return orderEventData{
+		UserID:         order.UserID,
+		ItemID:         order.ItemID,
+		Type:           order.Type,
+		Price:          order.Price,
+		Quantity:       order.Quantity,
+		Platform:       order.Platform,
+		StrategyID:     order.StrategyID,
+		SubscriptionID: order.SubscriptionID,
+		ParentID:       order.ParentID,
+		Kind:           order.Kind,
+		StopPrice:      order.StopPrice,
+		ExpiresAt:      order.ExpiresAt,
+		Routing:        order.Routing,
+		LotMethod:      order.LotMethod,
+		Lots:           order.Lots,
+		OCOID:          order.OCOID,
+	}
+}
+
+// transitionOrder 锁定订单行，校验并追加事件，再更新订单表的投影并增加版本号，同时写入待推送的消息。
+// order带有版本号且与数据库不一致时返回ErrVersionConflict，事件与订单状态不符时返回errOrderTransition，
+// 两种情况下order保持数据库中的最新状态；
+// 调用方在事务提交后调用s.outbox.Kick()立即推送
+func (s *Service) transitionOrder(tx *gorm.DB, order *models.Order, eventType string, data orderEventData) error {
+	var current models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, order.ID).Error; err != nil {
+		return err
+	}
+	if order.Version > 0 && current.Version != order.Version {
+		order.Status, order.Version = current.Status, current.Version
+		return fmt.Errorf("%w: order %d is at version %d", ErrVersionConflict, order.ID, current.Version)
+	}
+	if err := applyOrderEvent(&current, eventType, data); err != nil {
+		order.Status, order.Version = current.Status, current.Version
+		return err
+	}
+
+	sequence, err := nextSequence(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	if err := appendOrderEvent(tx, order.ID, sequence, eventType, data); err != nil {
+		return err
+	}
+	current.Version++
+	if err := tx.Model(&current).Select(versionedColumns).Updates(&current).Error; err != nil {
+		return err
+	}
+	if err := writeOrderOutbox(tx, eventType, &current); err != nil {
+		return err
+	}
+	// OCO订单的一腿进入终态时在同一事务中取消另一腿，两腿共用的库存由调用方按本订单解锁
+	if current.OCOID != nil && current.Status != "pending" && !data.linked {
+		if err := s.cancelLinkedOrder(tx, *current.OCOID, order.ID); err != nil {
+			return err
+		}
+	}
+
+	order.Status = current.Status
+	order.Price = current.Price
+	order.Quantity = current.Quantity
+	order.FilledQuantity = current.FilledQuantity
+	order.ExecutedAt = current.ExecutedAt
+	order.FailedReason = current.FailedReason
+	order.Lots = current.Lots
+	order.OCOID = current.OCOID
+	order.TriggeredAt = current.TriggeredAt
+	order.Version = current.Version
+	return nil
+}
+
+// recordTimeline 在独立事务中追加时间线事件，锁定订单行以保证序号连续；失败只记录日志，不影响执行
+func (s *Service) recordTimeline(orderID uint, eventType string, data orderEventData) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return appendTimelineEvent(tx, orderID, eventType, data)
+	})
+	if err != nil {
+		logrus.Warnf("Failed to record %s event for order %d: %v", eventType, orderID, err)
+	}
+}
+
+// appendTimelineEvent 在事务中追加时间线事件，不改变订单状态和版本号
+func appendTimelineEvent(tx *gorm.DB, orderID uint, eventType string, data orderEventData) error {
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&order, orderID).Error; err != nil {
+		return err
+	}
+	sequence, err := nextSequence(tx, orderID)
+	if err != nil {
+		return err
+	}
+	return appendOrderEvent(tx, orderID, sequence, eventType, data)
+}
+
+// nextSequence 订单下一个事件的序号，调用方须已锁定订单行
+func nextSequence(tx *gorm.DB, orderID uint) (int, error) {
+	var sequence int
+	err := tx.Model(&models.OrderEvent{}).Where("order_id = ?", orderID).
+		Select("COALESCE(MAX(sequence), 0)").Scan(&sequence).Error
+	return sequence + 1, err
+}
+
+func appendOrderEvent(tx *gorm.DB, orderID uint, sequence int, eventType string, data orderEventData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.OrderEvent{
+		OrderID:  orderID,
+		Sequence: sequence,
+		Type:     eventType,
+		Data:     string(b),
+	}).Error
+}
+
+// OrderTimelineEntry 订单时间线中的一个事件
+type OrderTimelineEntry struct {
+	Sequence int             `json:"sequence"`
+	Type     string          `json:"type"`
+	Data     json.RawMessage `json:"data"`
+	At       time.Time       `json:"at"`
+	Elapsed  float64         `json:"elapsed"` // 距上一个事件的秒数
+}
+
+// GetOrderEvents 用户订单的全部事件，按发生顺序排列
+func (s *Service) GetOrderEvents(orderID uint, userID uint) ([]OrderTimelineEntry, error) {
+	var order models.Order
+	if err := s.db.Select("id").Where("id = ? AND user_id = ?", orderID, userID).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	var events []models.OrderEvent
+	if err := s.db.Where("order_id = ?", orderID).Order("sequence").Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	timeline := make([]OrderTimelineEntry, len(events))
+	for i, event := range events {
+		timeline[i] = OrderTimelineEntry{
+			Sequence: event.Sequence,
+			Type:     event.Type,
+			Data:     json.RawMessage(event.Data),
+			At:       event.CreatedAt,
+		}
+		if i > 0 {
+			timeline[i].Elapsed = event.CreatedAt.Sub(events[i-1].CreatedAt).Seconds()
+		}
+	}
+	return timeline, nil
+}
+
+// projectOrder 按顺序重放事件得到订单状态
+func projectOrder(orderID uint, events []models.OrderEvent) (*models.Order, error) {
+	order := &models.Order{}
+	order.ID = orderID
+	for i, event := range events {
+		if event.Sequence != i+1 {
+			return nil, fmt.Errorf("order %d: event sequence gap at %d", orderID, i+1)
+		}
+		var data orderEventData
+		if err := json.Unmarshal([]byte(event.Data), &data); err != nil {
+			return nil, fmt.Errorf("order %d: event %d: %w", orderID, event.Sequence, err)
+		}
+		if err := applyOrderEvent(order, event.Type, data); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// RebuildReport 订单读模型重建结果
+type RebuildReport struct {
+	Checked    int      `json:"checked"`
+	Drifted    []uint   `json:"drifted"`    // 订单表与事件投影不一致的订单
+	Backfilled []uint   `json:"backfilled"` // 引入事件之前创建、按现有状态补写事件的订单
+	Errors     []string `json:"errors,omitempty"`
+	DryRun     bool     `json:"dry_run"`
+}
+
+// RebuildOrders 从事件重新投影订单表，orderIDs为空时处理全部订单；dryRun时只报告不一致的订单
+func (s *Service) RebuildOrders(actorID uint, orderIDs []uint, dryRun bool) (*RebuildReport, error) {
+	report := &RebuildReport{Drifted: []uint{}, Backfilled: []uint{}, DryRun: dryRun}
+
+	query := s.db.Model(&models.Order{}).Order("id")
+	if len(orderIDs) > 0 {
+		query = query.Where("id IN ?", orderIDs)
+	}
+
+	var batch []models.Order
+	err := query.FindInBatches(&batch, 200, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			report.Checked++
+			if err := s.rebuildOrder(&batch[i], dryRun, report); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if !dryRun && len(report.Drifted)+len(report.Backfilled) > 0 {
+		if err := audit.Record(s.db, &actorID, "order.rebuild", "order", 0, report); err != nil {
+			logrus.Errorf("Failed to audit order rebuild: %v", err)
+		}
+	}
+	return report, nil
+}
+
+func (s *Service) rebuildOrder(order *models.Order, dryRun bool, report *RebuildReport) error {
+	var events []models.OrderEvent
+	if err := s.db.Where("order_id = ?", order.ID).Order("sequence").Find(&events).Error; err != nil {
+		return err
+	}
+
+	if len(events) == 0 {
+		report.Backfilled = append(report.Backfilled, order.ID)
+		if dryRun {
+			return nil
+		}
+		return s.backfillOrderEvents(order)
+	}
+
+	projected, err := projectOrder(order.ID, events)
+	if err != nil {
+		return err
+	}
+	if orderMatches(order, projected) {
+		return nil
+	}
+
+	report.Drifted = append(report.Drifted, order.ID)
+	if dryRun {
+		return nil
+	}
+	projected.Version = order.Version + 1
+	return s.db.Model(projected).Select(versionedColumns).Updates(projected).Error
+}
+
+// backfillOrderEvents 为没有事件的历史订单按当前状态补写事件
+func (s *Service) backfillOrderEvents(order *models.Order) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := appendOrderEvent(tx, order.ID, 1, OrderCreated, createdEventData(order)); err != nil {
+			return err
+		}
+		sequence := 2
+		if order.TriggeredAt != nil {
+			if err := appendOrderEvent(tx, order.ID, sequence, OrderTriggered, orderEventData{TriggeredAt: order.TriggeredAt}); err != nil {
+				return err
+			}
+			sequence++
+		}
+		if order.Status == "pending" {
+			return nil
+		}
+
+		data := orderEventData{Reason: order.FailedReason}
+		if order.Status == "completed" {
+			data = orderEventData{Quantity: order.Quantity, ExecutedAt: order.ExecutedAt}
+		}
+		return appendOrderEvent(tx, order.ID, sequence, order.Status, data)
+	})
+}
+
+func orderMatches(a, b *models.Order) bool {
+	// 数据库时间精度为微秒，事件中保存的是纳秒
+	sameTime := (a.ExecutedAt == nil) == (b.ExecutedAt == nil) &&
+		(a.ExecutedAt == nil || a.ExecutedAt.Sub(*b.ExecutedAt).Abs() < time.Millisecond)
+	return a.Status == b.Status &&
+		a.Quantity == b.Quantity &&
+		a.FilledQuantity == b.FilledQuantity &&
+		a.Price == b.Price &&
+		a.FailedReason == b.FailedReason &&
+		a.Kind == b.Kind &&
+		equalPtr(a.StopPrice, b.StopPrice) &&
+		equalPtr(a.OCOID, b.OCOID) &&
+		(a.TriggeredAt == nil) == (b.TriggeredAt == nil) &&
+		sameTime
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
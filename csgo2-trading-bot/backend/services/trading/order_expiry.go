@@ -0,0 +1,152 @@
+package trading
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/audit"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ExpireOrders 注册挂单过期任务，超过有效期（下单时指定的expires_at或按平台配置的有效期）
+// 仍未成交的订单标记为expired，释放锁定的库存并通知用户
+func (s *Service) ExpireOrders(interval time.Duration) error {
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "order_expiry",
+		Spec: interval.String(),
+		Run: func() {
+			if n, err := s.expirePendingOrders(); err != nil {
+				logrus.Errorf("Order expiry failed: %v", err)
+			} else if n > 0 {
+				logrus.Infof("Expired %d pending orders", n)
+			}
+		},
+	})
+}
+
+// orderTTL 按 平台_类型、平台、类型 的顺序匹配有效期，0表示永不过期
+func (s *Service) orderTTL(platform, orderType string) time.Duration {
+	cfg := s.config.OrderExpiry
+	// viper会把map的键转换为小写
+	for _, key := range []string{platform + "_" + orderType, platform, orderType} {
+		if ttl, ok := cfg.TTLs[strings.ToLower(key)]; ok {
+			return time.Duration(ttl) * time.Second
+		}
+	}
+	return time.Duration(cfg.DefaultTTL) * time.Second
+}
+
+// ErrInvalidExpiry 下单时指定的过期时间不在未来
+var ErrInvalidExpiry = errors.New("expires_at must be in the future")
+
+// validateExpiry 校验下单时指定的过期时间
+func validateExpiry(expiresAt *time.Time) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return ErrInvalidExpiry
+	}
+	return nil
+}
+
+// minOrderTTL 所有配置中最短的有效期，用于缩小查询范围；未开启按平台过期时返回0
+func (s *Service) minOrderTTL() time.Duration {
+	cfg := s.config.OrderExpiry
+	if !cfg.Enabled {
+		return 0
+	}
+	min := cfg.DefaultTTL
+	for _, ttl := range cfg.TTLs {
+		if ttl > 0 && (min <= 0 || ttl < min) {
+			min = ttl
+		}
+	}
+	return time.Duration(min) * time.Second
+}
+
+// orderDeadline 订单的过期时间：下单时指定了expires_at的以它为准，否则按平台有效期计算；不过期时返回false
+func (s *Service) orderDeadline(order *models.Order) (time.Time, bool) {
+	if order.ExpiresAt != nil {
+		return *order.ExpiresAt, true
+	}
+	// 条件单等待价格触发，平台有效期不适用
+	if order.Kind != "" || !s.config.OrderExpiry.Enabled {
+		return time.Time{}, false
+	}
+	ttl := s.orderTTL(order.Platform, order.Type)
+	if ttl <= 0 {
+		return time.Time{}, false
+	}
+	return order.CreatedAt.Add(ttl), true
+}
+
+func (s *Service) expirePendingOrders() (int, error) {
+	now := time.Now()
+
+	// 已开始向平台提交的订单不过期，执行中断的由failStaleExecutions处理
+	query := s.db.Where("status = ? AND execution_started_at IS NULL", "pending")
+	if minTTL := s.minOrderTTL(); minTTL > 0 {
+		query = query.Where("expires_at <= ? OR (expires_at IS NULL AND kind = '' AND created_at < ?)", now, now.Add(-minTTL))
+	} else {
+		query = query.Where("expires_at <= ?", now)
+	}
+	var orders []models.Order
+	if err := query.Find(&orders).Error; err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range orders {
+		order := &orders[i]
+		deadline, ok := s.orderDeadline(order)
+		if !ok || now.Before(deadline) {
+			continue
+		}
+		reason := "order expired after " + deadline.Sub(order.CreatedAt).Round(time.Second).String()
+		if order.ExpiresAt != nil {
+			reason = "order expired at " + deadline.UTC().Format(time.RFC3339)
+		}
+
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			// 只过期仍处于pending且没有被修改的订单，避免覆盖刚开始执行、成交或被取消的订单
+			err := s.transitionOrder(tx, order, OrderExpired, orderEventData{Reason: reason})
+			if errors.Is(err, errOrderTransition) || errors.Is(err, ErrVersionConflict) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if order.Type == "sell" {
+				if err := unlockLots(tx, order); err != nil {
+					return err
+				}
+			}
+
+			expired++
+			return audit.Log(tx, audit.Entry{
+				UserID:     &order.UserID,
+				Action:     "order.expire",
+				EntityType: "order",
+				EntityID:   order.ID,
+				Details: map[string]interface{}{
+					"platform":   order.Platform,
+					"type":       order.Type,
+					"expires_at": deadline,
+					"created_at": order.CreatedAt,
+				},
+			})
+		})
+		if err != nil {
+			logrus.Errorf("Failed to expire order %d: %v", order.ID, err)
+			continue
+		}
+	}
+	if expired > 0 {
+		s.outbox.Kick()
+	}
+	return expired, nil
+}
@@ -0,0 +1,52 @@
+package trading
+
+import (
+	"encoding/json"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/outbox"
+	"csgo2-trading-bot/websocket"
+
+	"gorm.io/gorm"
+)
+
+// orderTopic 订单事件在发件箱中的主题
+const orderTopic = "order"
+
+// orderMessage 发件箱中的订单事件，Order为事件提交时的订单状态
+type orderMessage struct {
+	Event string       `json:"event"`
+	Order models.Order `json:"order"`
+}
+
+// writeOrderOutbox 在订单事件所在的事务中写入待推送的消息
+func writeOrderOutbox(tx *gorm.DB, eventType string, order *models.Order) error {
+	msg := orderMessage{Event: eventType, Order: *order}
+	// 关联对象不随事件推送
+	msg.Order.User = models.User{}
+	msg.Order.Item = models.Item{}
+	msg.Order.Strategy = nil
+	return outbox.Write(tx, orderTopic, msg)
+}
+
+// deliverOrderEvent 推送订单事件：写入用户动态（动态流通过WebSocket实时推送）、广播过期订单、
+// 通知用户成交或失败。投递是至少一次的，进程在标记已投递前退出时同一事件会再推送一次
+func (s *Service) deliverOrderEvent(payload []byte) error {
+	var msg orderMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return err
+	}
+	order := &msg.Order
+
+	s.recordActivity(order, msg.Event)
+	switch msg.Event {
+	case OrderExpired:
+		if s.hub != nil {
+			websocket.BroadcastOrderUpdate(s.hub, "expired", order)
+		}
+		s.publishOrder(order)
+	case OrderCompleted, OrderFailed:
+		s.publishOrder(order)
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	executionStream = "orders:execution"
+	executionGroup  = "executors"
+	executionMaxLen = 10000
+)
+
+// errExecutionInterrupted 订单开始执行后服务中断，无法确认平台上是否已经成交
+var errExecutionInterrupted = errors.New("execution interrupted by restart, check the order on the platform before retrying")
+
+// StartExecution 启动订单执行工作协程并恢复未完成的订单。
+// 新订单写入Redis流，由workers个协程消费，执行完成后才确认，进程退出时未确认的消息在重启后继续执行；
+// Redis不可用时退化为进程内队列，这些订单在下次启动时从数据库中恢复
+func (s *Service) StartExecution() error {
+	if s.executions != nil {
+		return nil
+	}
+	cfg := s.config.Execution
+	s.executions = make(chan uint, cfg.Workers*4)
+	s.consumer = consumerName()
+	s.ensureExecutionGroup()
+
+	for i := 0; i < cfg.Workers; i++ {
+		go s.executionWorker()
+	}
+	go s.resumeExecutions()
+
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "order_execution_recovery",
+		Spec: (time.Duration(cfg.ClaimIdle) * time.Second).String(),
+		Run: func() {
+			s.claimAbandonedExecutions()
+			s.requeueDroppedExecutions()
+			s.failStaleExecutions()
+		},
+	})
+}
+
+// enqueueExecution 把订单交给执行队列
+func (s *Service) enqueueExecution(order *models.Order) {
+	if s.executions == nil {
+		// 执行队列尚未启动（只读模式），订单保持pending，启动后从数据库中恢复
+		logrus.Warnf("Order execution is not running, order %d will be executed after startup", order.ID)
+		return
+	}
+	s.recordTimeline(order.ID, OrderQueued, orderEventData{})
+	if s.cache != nil && s.cache.Available() {
+		ctx, cancel := context.WithTimeout(s.ctx, 2*time.Second)
+		err := s.cache.Client().XAdd(ctx, &redis.XAddArgs{
+			Stream: executionStream,
+			MaxLen: executionMaxLen,
+			Approx: true,
+			Values: map[string]interface{}{"order_id": order.ID},
+		}).Err()
+		cancel()
+		if err == nil {
+			return
+		}
+		logrus.Warnf("Failed to queue order %d in redis, executing in process: %v", order.ID, err)
+	}
+	select {
+	case s.executions <- order.ID:
+	default:
+		// 不阻塞下单接口，队列满时丢弃，订单保持pending，由恢复任务重新入队
+		logrus.Warnf("Order execution queue is full, order %d will be retried by recovery", order.ID)
+	}
+}
+
+// executionWorker 依次执行进程内队列和Redis流中的订单
+func (s *Service) executionWorker() {
+	for {
+		// 维护期间不领取新消息，已入队的订单等维护结束后执行
+		if s.underMaintenance() {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		select {
+		case orderID := <-s.executions:
+			s.runExecution(orderID)
+			continue
+		default:
+		}
+
+		if s.cache == nil || !s.cache.Available() {
+			select {
+			case orderID := <-s.executions:
+				s.runExecution(orderID)
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		streams, err := s.cache.Client().XReadGroup(s.ctx, &redis.XReadGroupArgs{
+			Group:    executionGroup,
+			Consumer: s.consumer,
+			Streams:  []string{executionStream, ">"},
+			Count:    1,
+			Block:    time.Second,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				s.ensureExecutionGroup()
+			} else {
+				logrus.Warnf("Failed to read order execution queue: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				s.handleExecutionMessage(msg)
+			}
+		}
+	}
+}
+
+// handleExecutionMessage 执行消息中的订单，执行结束后才确认，执行中途退出的消息会被重新投递
+func (s *Service) handleExecutionMessage(msg redis.XMessage) {
+	// 读取后才进入维护模式的消息不确认，维护结束后由恢复任务重新领取
+	if s.underMaintenance() {
+		return
+	}
+	raw, _ := msg.Values["order_id"].(string)
+	if orderID, err := strconv.ParseUint(raw, 10, 64); err == nil {
+		s.runExecution(uint(orderID))
+	} else {
+		logrus.Warnf("Dropping invalid order execution message %s", msg.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, 2*time.Second)
+	defer cancel()
+	pipe := s.cache.Client().TxPipeline()
+	pipe.XAck(ctx, executionStream, executionGroup, msg.ID)
+	pipe.XDel(ctx, executionStream, msg.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logrus.Warnf("Failed to acknowledge order execution message %s: %v", msg.ID, err)
+	}
+}
+
+// runExecution 从数据库加载订单并执行，订单已不是pending时跳过
+func (s *Service) runExecution(orderID uint) {
+	var order models.Order
+	if err := s.db.Preload("Latency").First(&order, orderID).Error; err != nil {
+		logrus.Errorf("Failed to load order %d for execution: %v", orderID, err)
+		return
+	}
+	if order.Status != "pending" || order.ExecutionStartedAt != nil || awaitingTrigger(&order) {
+		return
+	}
+	if s.underMaintenance() {
+		// 订单保持pending，维护结束后由恢复任务重新入队
+		logrus.Infof("Order %d execution postponed until maintenance ends", order.ID)
+		return
+	}
+
+	// 下单后物品被暂停交易，尚未提交到平台的订单直接失败
+	if violation := s.haltViolation(order.ItemID); violation != nil {
+		if s.finishOrder(&order, violation) && order.Type == "sell" {
+			s.unlockInventory(&order)
+		}
+		return
+	}
+
+	stop := s.executionHeartbeat(order.ID)
+	defer stop()
+	if order.Type == "sell" {
+		s.executeSellOrder(&order)
+	} else {
+		s.executeBuyOrder(&order)
+	}
+}
+
+// executionHeartbeat 执行期间定期更新订单的心跳时间，返回的函数停止更新。
+// 订单尚未被本协程标记开始执行时更新不会影响任何行
+func (s *Service) executionHeartbeat(orderID uint) (stop func()) {
+	interval := time.Duration(s.config.Execution.StaleAfter) * time.Second / 3
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(max(interval, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				s.db.Model(&models.Order{}).
+					Where("id = ? AND status = ? AND execution_started_at IS NOT NULL", orderID, "pending").
+					UpdateColumn("execution_heartbeat_at", now)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// claimExecution 标记订单开始执行并增加版本号，同一订单被重复投递时只有一个工作协程能标记成功；
+// 之后基于旧版本的撤单会被拒绝。加载后订单被修改过（版本不一致）时放弃，由修改后重新入队的消息执行
+func (s *Service) claimExecution(order *models.Order) bool {
+	if order.OCOID != nil {
+		return s.claimLinkedExecution(order)
+	}
+	now := time.Now()
+	claimed := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND status = ? AND execution_started_at IS NULL AND version = ?", order.ID, "pending", order.Version).
+			Updates(map[string]interface{}{"execution_started_at": now, "version": gorm.Expr("version + 1")})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		claimed = true
+		return appendTimelineEvent(tx, order.ID, OrderSent, orderEventData{Platform: order.Platform})
+	})
+	if err != nil {
+		logrus.Errorf("Failed to claim order %d for execution: %v", order.ID, err)
+		return false
+	}
+	if !claimed {
+		return false
+	}
+	order.ExecutionStartedAt = &now
+	order.Version++
+	return true
+}
+
+// resumeExecutions 启动时继续执行：先处理本实例上次读取但未确认的消息，再把尚未开始执行的pending订单重新入队，
+// 未触发的条件单除外
+func (s *Service) resumeExecutions() {
+	if s.cache != nil && s.cache.Available() {
+		streams, err := s.cache.Client().XReadGroup(s.ctx, &redis.XReadGroupArgs{
+			Group:    executionGroup,
+			Consumer: s.consumer,
+			Streams:  []string{executionStream, "0"},
+			Count:    executionMaxLen,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			logrus.Warnf("Failed to read unacknowledged order executions: %v", err)
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				s.handleExecutionMessage(msg)
+			}
+		}
+	}
+
+	var orders []models.Order
+	err := s.db.Select("id").
+		Where("status = ? AND execution_started_at IS NULL", "pending").
+		Where("kind = '' OR triggered_at IS NOT NULL").
+		Order("id").
+		Find(&orders).Error
+	if err != nil {
+		logrus.Errorf("Failed to load pending orders for execution: %v", err)
+		return
+	}
+	for i := range orders {
+		s.enqueueExecution(&orders[i])
+	}
+	if len(orders) > 0 {
+		logrus.Infof("Resumed execution of %d pending orders", len(orders))
+	}
+}
+
+// claimAbandonedExecutions 其他实例读取后长时间未确认的消息（实例已退出）转由本实例执行
+func (s *Service) claimAbandonedExecutions() {
+	if s.cache == nil || !s.cache.Available() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, 5*time.Second)
+	defer cancel()
+
+	messages, _, err := s.cache.Client().XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   executionStream,
+		Group:    executionGroup,
+		Consumer: s.consumer,
+		MinIdle:  time.Duration(s.config.Execution.ClaimIdle) * time.Second,
+		Start:    "0",
+		Count:    100,
+	}).Result()
+	if err != nil {
+		logrus.Warnf("Failed to claim abandoned order executions: %v", err)
+		return
+	}
+	for _, msg := range messages {
+		s.handleExecutionMessage(msg)
+	}
+}
+
+// requeueDroppedExecutions Redis不可用时，进程内队列满而被丢弃的订单重新入队。
+// 只处理尚未开始执行且超过ClaimIdle未更新的订单，重复入队的订单在领取时被跳过
+func (s *Service) requeueDroppedExecutions() {
+	if s.cache != nil && s.cache.Available() {
+		return
+	}
+	cutoff := time.Now().Add(-time.Duration(s.config.Execution.ClaimIdle) * time.Second)
+	var orders []models.Order
+	if err := s.db.Select("id").
+		Where("status = ? AND execution_started_at IS NULL AND updated_at < ?", "pending", cutoff).
+		Where("kind = '' OR triggered_at IS NOT NULL").
+		Order("id").
+		Limit(cap(s.executions)).
+		Find(&orders).Error; err != nil {
+		logrus.Errorf("Failed to load pending orders for execution: %v", err)
+		return
+	}
+	for i := range orders {
+		s.enqueueExecution(&orders[i])
+	}
+}
+
+// failStaleExecutions 开始执行后超过StaleAfter没有心跳的订单视为执行中断（执行的实例已退出）。
+// 平台上可能已经成交，自动重试可能重复下单，因此标记为失败并通知用户核对
+func (s *Service) failStaleExecutions() {
+	cutoff := time.Now().Add(-time.Duration(s.config.Execution.StaleAfter) * time.Second)
+	var orders []models.Order
+	if err := s.db.Where("status = ? AND COALESCE(execution_heartbeat_at, execution_started_at) < ?", "pending", cutoff).
+		Find(&orders).Error; err != nil {
+		logrus.Errorf("Failed to load stale order executions: %v", err)
+		return
+	}
+
+	for i := range orders {
+		order := &orders[i]
+		if !s.finishOrder(order, errExecutionInterrupted) {
+			continue
+		}
+		if order.Type == "sell" {
+			s.unlockInventory(order)
+		}
+		logrus.Warnf("Order %d marked failed: %v", order.ID, errExecutionInterrupted)
+	}
+}
+
+func (s *Service) ensureExecutionGroup() {
+	if s.cache == nil || !s.cache.Available() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, 2*time.Second)
+	defer cancel()
+	err := s.cache.Client().XGroupCreateMkStream(ctx, executionStream, executionGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		logrus.Warnf("Failed to create order execution group: %v", err)
+	}
+}
+
+// consumerName 以主机名区分实例，容器重启后主机名不变，可以继续处理上次未确认的消息
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "backend"
+	}
+	return host
+}
@@ -0,0 +1,99 @@
+package trading
+
+import (
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// 允许的排序字段，避免拼接任意列名
+var orderSortColumns = map[string]string{
+	"created_at":  "orders.created_at",
+	"executed_at": "orders.executed_at",
+	"price":       "orders.price",
+	"quantity":    "orders.quantity",
+	"total":       "orders.price * orders.quantity",
+}
+
+// OrderSearch 订单搜索条件，零值字段表示不过滤
+type OrderSearch struct {
+	Text       string
+	Types      []string
+	Platforms  []string
+	Statuses   []string
+	MinPrice   float64
+	MaxPrice   float64
+	From       *time.Time
+	To         *time.Time
+	StrategyID *uint
+	SortBy     string
+	SortDesc   bool
+	Page       int
+	PageSize   int
+}
+
+// SearchOrders 按条件搜索用户订单
+func (s *Service) SearchOrders(userID uint, search OrderSearch) ([]models.Order, int64, error) {
+	var orders []models.Order
+	var total int64
+
+	// 走 (user_id, created_at) 复合索引
+	query := s.db.Model(&models.Order{}).Where("orders.user_id = ?", userID)
+
+	if search.Text != "" {
+		pattern := "%" + search.Text + "%"
+		query = query.Joins("JOIN items ON items.id = orders.item_id").
+			Where("items.name ILIKE ? OR items.market_hash_name ILIKE ?", pattern, pattern)
+	}
+	if len(search.Types) > 0 {
+		query = query.Where("orders.type IN ?", search.Types)
+	}
+	if len(search.Platforms) > 0 {
+		query = query.Where("orders.platform IN ?", search.Platforms)
+	}
+	if len(search.Statuses) > 0 {
+		query = query.Where("orders.status IN ?", search.Statuses)
+	}
+	if search.MinPrice > 0 {
+		query = query.Where("orders.price >= ?", search.MinPrice)
+	}
+	if search.MaxPrice > 0 {
+		query = query.Where("orders.price <= ?", search.MaxPrice)
+	}
+	if search.From != nil {
+		query = query.Where("orders.created_at >= ?", *search.From)
+	}
+	if search.To != nil {
+		query = query.Where("orders.created_at < ?", *search.To)
+	}
+	if search.StrategyID != nil {
+		query = query.Where("orders.strategy_id = ?", *search.StrategyID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := orderSortColumns[search.SortBy]
+	if !ok {
+		column = orderSortColumns["created_at"]
+		search.SortDesc = true
+	}
+	direction := " ASC"
+	if search.SortDesc {
+		direction = " DESC"
+	}
+
+	if search.Page < 1 {
+		search.Page = 1
+	}
+	if search.PageSize < 1 || search.PageSize > 100 {
+		search.PageSize = 20
+	}
+
+	offset := (search.Page - 1) * search.PageSize
+	err := query.Preload("Item").Offset(offset).Limit(search.PageSize).
+		Order(column + direction).Order("orders.id DESC").Find(&orders).Error
+
+	return orders, total, err
+}
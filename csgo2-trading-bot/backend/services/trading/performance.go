@@ -0,0 +1,144 @@
+package trading
+
+import (
+	"errors"
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"gorm.io/gorm"
+)
+
+// StrategyPerformance 按策略归因的交易表现，StrategyID为空表示手动交易
+type StrategyPerformance struct {
+	StrategyID *uint   `json:"strategy_id"`
+	Name       string  `json:"name"`
+	Profit     float64 `json:"profit"`
+	Fees       float64 `json:"fees"`
+	Turnover   float64 `json:"turnover"`
+	TradeCount int64   `json:"trade_count"`
+	SellCount  int64   `json:"sell_count"`
+	WinCount   int64   `json:"win_count"`
+	WinRate    float64 `json:"win_rate"`
+}
+
+// DailyPnL 每日盈亏
+type DailyPnL struct {
+	Date       string  `json:"date"`
+	Profit     float64 `json:"profit"`
+	Fees       float64 `json:"fees"`
+	Turnover   float64 `json:"turnover"`
+	TradeCount int64   `json:"trade_count"`
+	Cumulative float64 `json:"cumulative"`
+}
+
+// StrategyPerformanceReport 单个策略的表现报告
+type StrategyPerformanceReport struct {
+	StrategyPerformance
+	Since   time.Time           `json:"since"`
+	Daily   []DailyPnL          `json:"daily"`
+	Metrics *PerformanceMetrics `json:"metrics"`
+}
+
+// 交易记录通过订单关联到策略；胜率只统计卖出，买入不产生盈亏
+const performanceColumns = `
+	COALESCE(SUM(transactions.profit), 0) AS profit,
+	COALESCE(SUM(transactions.fee), 0) AS fees,
+	COALESCE(SUM(transactions.amount), 0) AS turnover,
+	COUNT(*) AS trade_count,
+	COUNT(*) FILTER (WHERE transactions.type = 'sell') AS sell_count,
+	COUNT(*) FILTER (WHERE transactions.type = 'sell' AND transactions.profit > 0) AS win_count`
+
+// GetProfitByStrategy 按策略分组统计盈亏
+func (s *Service) GetProfitByStrategy(userID uint, since time.Time) ([]StrategyPerformance, error) {
+	var rows []StrategyPerformance
+	err := s.db.Model(&models.Transaction{}).
+		Joins("JOIN orders ON orders.id = transactions.order_id").
+		Joins("LEFT JOIN strategies ON strategies.id = orders.strategy_id").
+		Where("transactions.user_id = ? AND transactions.completed_at >= ?", userID, since).
+		Select("orders.strategy_id AS strategy_id, COALESCE(strategies.name, '') AS name," + performanceColumns).
+		Group("orders.strategy_id, strategies.name").
+		Order("profit DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rows {
+		rows[i].WinRate = winRate(rows[i].WinCount, rows[i].SellCount)
+	}
+	return rows, nil
+}
+
+// GetStrategyPerformance 获取策略最近days天的表现及每日盈亏序列
+func (s *Service) GetStrategyPerformance(strategyID uint, userID uint, days int) (*StrategyPerformanceReport, error) {
+	var strategy models.Strategy
+	if err := s.db.First(&strategy, strategyID).Error; err != nil {
+		return nil, err
+	}
+	if strategy.UserID != userID {
+		return nil, errors.New("unauthorized")
+	}
+
+	if days <= 0 {
+		days = 30
+	}
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1-days)
+
+	report := &StrategyPerformanceReport{Since: since, Daily: []DailyPnL{}}
+
+	base := s.db.Model(&models.Transaction{}).
+		Joins("JOIN orders ON orders.id = transactions.order_id").
+		Where("orders.strategy_id = ? AND transactions.completed_at >= ?", strategyID, since)
+
+	if err := base.Session(&gorm.Session{}).Select(performanceColumns).Scan(&report.StrategyPerformance).Error; err != nil {
+		return nil, err
+	}
+	report.StrategyID = &strategy.ID
+	report.Name = strategy.Name
+	report.WinRate = winRate(report.WinCount, report.SellCount)
+
+	var daily []DailyPnL
+	err := base.Session(&gorm.Session{}).
+		Select(`TO_CHAR(DATE(transactions.completed_at), 'YYYY-MM-DD') AS date,
+			COALESCE(SUM(transactions.profit), 0) AS profit,
+			COALESCE(SUM(transactions.fee), 0) AS fees,
+			COALESCE(SUM(transactions.amount), 0) AS turnover,
+			COUNT(*) AS trade_count`).
+		Group("DATE(transactions.completed_at)").
+		Order("DATE(transactions.completed_at)").
+		Scan(&daily).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// 补齐没有成交的日期，便于前端直接绘图
+	byDate := make(map[string]DailyPnL, len(daily))
+	for _, d := range daily {
+		byDate[d.Date] = d
+	}
+	cumulative := 0.0
+	for day := since; !day.After(now); day = day.AddDate(0, 0, 1) {
+		key := day.Format("2006-01-02")
+		d, ok := byDate[key]
+		if !ok {
+			d = DailyPnL{Date: key}
+		}
+		cumulative += d.Profit
+		d.Cumulative = cumulative
+		report.Daily = append(report.Daily, d)
+	}
+
+	if report.Metrics, err = s.computePerformance(strategyScope(strategy.ID), since); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func winRate(wins, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(wins) / float64(total) * 100
+}
@@ -0,0 +1,292 @@
+package trading
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// PerformanceMetrics 一段时间内的收益风险指标。夏普和索提诺比率按每日已实现盈亏计算并按365天年化，
+// 最大回撤为累计盈亏从峰值回落的最大金额
+type PerformanceMetrics struct {
+	Since        time.Time          `json:"since"`
+	Until        time.Time          `json:"until"`
+	Invested     float64            `json:"invested"` // 买入金额和手续费合计
+	Profit       float64            `json:"profit"`   // 已实现盈亏
+	ROI          float64            `json:"roi"`      // 已实现盈亏占买入金额的百分比
+	Sharpe       float64            `json:"sharpe"`
+	Sortino      float64            `json:"sortino"`
+	MaxDrawdown  float64            `json:"max_drawdown"`
+	AvgHoldHours float64            `json:"avg_hold_hours"` // 卖出批次按数量加权的平均持有时间
+	Exposure     []PlatformExposure `json:"exposure"`       // 当前持仓按平台的分布
+	ComputedAt   time.Time          `json:"computed_at"`
+}
+
+// PlatformExposure 持仓在单个平台上的市值，没有当前价格的物品按买入价计算
+type PlatformExposure struct {
+	Platform string  `json:"platform"`
+	Value    float64 `json:"value"`
+	Share    float64 `json:"share"` // 占全部持仓市值的百分比
+}
+
+// performanceScope 指标的统计范围：用户的全部交易或单个策略的交易
+type performanceScope struct {
+	transactions string // 交易记录（关联订单）的筛选条件
+	inventory    string // 库存的筛选条件
+	id           uint
+}
+
+func userScope(userID uint) performanceScope {
+	return performanceScope{"transactions.user_id = ?", "user_id = ?", userID}
+}
+
+func strategyScope(strategyID uint) performanceScope {
+	return performanceScope{"orders.strategy_id = ?", "strategy_id = ?", strategyID}
+}
+
+// RecordPerformance 注册定期计算收益风险指标的任务，结果保存到用户和策略的performance字段
+func (s *Service) RecordPerformance(interval time.Duration, days int) error {
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "performance_metrics",
+		Spec: interval.String(),
+		Run:  func() { s.recordPerformance(days) },
+	})
+}
+
+// recordPerformance 计算统计期内有成交或仍有持仓的用户，以及这些用户的全部策略
+func (s *Service) recordPerformance(days int) {
+	since := performanceSince(days)
+	var userIDs []uint
+	if err := s.db.Raw(`
+		SELECT user_id FROM transactions WHERE completed_at >= ? AND deleted_at IS NULL
+		UNION
+		SELECT user_id FROM inventories WHERE deleted_at IS NULL`, since).
+		Scan(&userIDs).Error; err != nil {
+		logrus.Errorf("Failed to load users for performance metrics: %v", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		metrics, err := s.computePerformance(userScope(userID), since)
+		if err == nil {
+			err = s.savePerformance(&models.User{}, userID, metrics)
+		}
+		if err != nil {
+			logrus.Errorf("Failed to record performance of user %d: %v", userID, err)
+			continue
+		}
+
+		var strategyIDs []uint
+		s.db.Model(&models.Strategy{}).Where("user_id = ?", userID).Pluck("id", &strategyIDs)
+		for _, strategyID := range strategyIDs {
+			metrics, err := s.computePerformance(strategyScope(strategyID), since)
+			if err == nil {
+				err = s.savePerformance(&models.Strategy{}, strategyID, metrics)
+			}
+			if err != nil {
+				logrus.Errorf("Failed to record performance of strategy %d: %v", strategyID, err)
+			}
+		}
+	}
+}
+
+func (s *Service) savePerformance(model interface{}, id uint, metrics *PerformanceMetrics) error {
+	raw, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+	return s.db.Model(model).Where("id = ?", id).UpdateColumn("performance", string(raw)).Error
+}
+
+// GetPerformance 用户最近days天的收益风险指标及各策略的指标。days为0时返回定期保存的结果，
+// 未开启定期计算或尚未计算过时按配置的天数即时计算
+func (s *Service) GetPerformance(userID uint, days int) (*PerformanceMetrics, map[uint]*PerformanceMetrics, error) {
+	if days <= 0 && !s.config.Performance.Enabled {
+		days = max(s.config.Performance.Days, 1)
+	}
+	if days > 0 {
+		since := performanceSince(days)
+		metrics, err := s.computePerformance(userScope(userID), since)
+		if err != nil {
+			return nil, nil, err
+		}
+		var strategies []models.Strategy
+		if err := s.db.Select("id").Where("user_id = ?", userID).Find(&strategies).Error; err != nil {
+			return nil, nil, err
+		}
+		byStrategy := make(map[uint]*PerformanceMetrics, len(strategies))
+		for _, strategy := range strategies {
+			if byStrategy[strategy.ID], err = s.computePerformance(strategyScope(strategy.ID), since); err != nil {
+				return nil, nil, err
+			}
+		}
+		return metrics, byStrategy, nil
+	}
+
+	var user models.User
+	if err := s.db.Select("id, performance").First(&user, userID).Error; err != nil {
+		return nil, nil, err
+	}
+	if user.Performance == nil {
+		return s.GetPerformance(userID, max(s.config.Performance.Days, 1))
+	}
+	var metrics PerformanceMetrics
+	if err := json.Unmarshal([]byte(*user.Performance), &metrics); err != nil {
+		return nil, nil, err
+	}
+
+	var strategies []models.Strategy
+	if err := s.db.Select("id, performance").Where("user_id = ?", userID).Find(&strategies).Error; err != nil {
+		return nil, nil, err
+	}
+	byStrategy := make(map[uint]*PerformanceMetrics, len(strategies))
+	for _, strategy := range strategies {
+		var m PerformanceMetrics
+		if strategy.Performance != "" && json.Unmarshal([]byte(strategy.Performance), &m) == nil {
+			byStrategy[strategy.ID] = &m
+		}
+	}
+	return &metrics, byStrategy, nil
+}
+
+func performanceSince(days int) time.Time {
+	if days <= 0 {
+		days = 30
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1-days)
+}
+
+// computePerformance 计算统计范围自since起的指标
+func (s *Service) computePerformance(scope performanceScope, since time.Time) (*PerformanceMetrics, error) {
+	now := time.Now()
+	metrics := &PerformanceMetrics{Since: since, Until: now, Exposure: []PlatformExposure{}, ComputedAt: now}
+
+	base := s.db.Model(&models.Transaction{}).
+		Joins("JOIN orders ON orders.id = transactions.order_id").
+		Where(scope.transactions, scope.id).
+		Where("transactions.completed_at >= ?", since)
+
+	var totals struct {
+		Invested float64
+		Profit   float64
+	}
+	if err := base.Session(&gorm.Session{}).
+		Select(`COALESCE(SUM(transactions.amount + transactions.fee) FILTER (WHERE transactions.type = 'buy'), 0) AS invested,
+			COALESCE(SUM(transactions.profit), 0) AS profit`).
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	metrics.Invested, metrics.Profit = totals.Invested, totals.Profit
+	if metrics.Invested > 0 {
+		metrics.ROI = metrics.Profit / metrics.Invested * 100
+	}
+
+	var daily []DailyPnL
+	if err := base.Session(&gorm.Session{}).
+		Select(`TO_CHAR(DATE(transactions.completed_at), 'YYYY-MM-DD') AS date, COALESCE(SUM(transactions.profit), 0) AS profit`).
+		Group("DATE(transactions.completed_at)").
+		Scan(&daily).Error; err != nil {
+		return nil, err
+	}
+	byDate := make(map[string]float64, len(daily))
+	for _, d := range daily {
+		byDate[d.Date] = d.Profit
+	}
+	var series []float64
+	for day := since; !day.After(now); day = day.AddDate(0, 0, 1) {
+		series = append(series, byDate[day.Format("2006-01-02")])
+	}
+	metrics.Sharpe, metrics.Sortino = riskRatios(series)
+	metrics.MaxDrawdown = maxDrawdown(series)
+
+	var sells []struct {
+		CompletedAt time.Time
+		Lots        string
+	}
+	if err := base.Session(&gorm.Session{}).
+		Select("transactions.completed_at, transactions.lots").
+		Where("transactions.type = ? AND transactions.lots IS NOT NULL", "sell").
+		Scan(&sells).Error; err != nil {
+		return nil, err
+	}
+	var held, quantity float64
+	for _, sell := range sells {
+		var lots []LotSelection
+		if json.Unmarshal([]byte(sell.Lots), &lots) != nil {
+			continue
+		}
+		for _, lot := range lots {
+			held += sell.CompletedAt.Sub(lot.AcquiredAt).Hours() * float64(lot.Quantity)
+			quantity += float64(lot.Quantity)
+		}
+	}
+	if quantity > 0 {
+		metrics.AvgHoldHours = held / quantity
+	}
+
+	if err := s.db.Model(&models.Inventory{}).
+		Joins("JOIN items ON items.id = inventories.item_id").
+		Where("inventories."+scope.inventory, scope.id).
+		Select("inventories.platform AS platform, SUM(inventories.quantity * COALESCE(NULLIF(items.current_price, 0), inventories.buy_price)) AS value").
+		Group("inventories.platform").
+		Order("value DESC").
+		Scan(&metrics.Exposure).Error; err != nil {
+		return nil, err
+	}
+	var total float64
+	for _, e := range metrics.Exposure {
+		total += e.Value
+	}
+	for i := range metrics.Exposure {
+		if total > 0 {
+			metrics.Exposure[i].Share = metrics.Exposure[i].Value / total * 100
+		}
+	}
+	return metrics, nil
+}
+
+// riskRatios 每日盈亏序列的年化夏普和索提诺比率，无风险收益按0计算；索提诺只以亏损日的波动为分母
+func riskRatios(daily []float64) (sharpe, sortino float64) {
+	if len(daily) < 2 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range daily {
+		sum += v
+	}
+	mean := sum / float64(len(daily))
+
+	var variance, downside float64
+	for _, v := range daily {
+		variance += (v - mean) * (v - mean)
+		if v < 0 {
+			downside += v * v
+		}
+	}
+	annualize := math.Sqrt(365)
+	if std := math.Sqrt(variance / float64(len(daily)-1)); std > 0 {
+		sharpe = mean / std * annualize
+	}
+	if dd := math.Sqrt(downside / float64(len(daily))); dd > 0 {
+		sortino = mean / dd * annualize
+	}
+	return sharpe, sortino
+}
+
+// maxDrawdown 累计盈亏从此前峰值回落的最大金额，峰值从0起算
+func maxDrawdown(daily []float64) float64 {
+	var cumulative, peak, drawdown float64
+	for _, v := range daily {
+		cumulative += v
+		peak = max(peak, cumulative)
+		drawdown = max(drawdown, peak-cumulative)
+	}
+	return drawdown
+}
@@ -0,0 +1,119 @@
+package trading
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/scheduler"
+	"csgo2-trading-bot/websocket"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MonitorPositions 注册持仓监控任务，执行移动止损和止盈
+func (s *Service) MonitorPositions(interval time.Duration) error {
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "position_monitor",
+		Spec: interval.String(),
+		Run:  s.checkPositions,
+	})
+}
+
+// checkPositions 检查所有由激活策略买入的持仓
+func (s *Service) checkPositions() {
+	var strategies []models.Strategy
+	if err := s.db.Where("status = ? AND (stop_loss > 0 OR take_profit > 0)", "active").
+		Find(&strategies).Error; err != nil {
+		logrus.Errorf("Failed to load strategies for position monitor: %v", err)
+		return
+	}
+
+	for i := range strategies {
+		strategy := &strategies[i]
+
+		var positions []models.Inventory
+		s.db.Preload("Item").
+			Where("strategy_id = ? AND locked = ? AND tradable = ?", strategy.ID, false, true).
+			Where(notReserved).
+			Find(&positions)
+
+		for j := range positions {
+			s.checkPosition(strategy, &positions[j])
+		}
+	}
+}
+
+// checkPosition 对单个持仓判断是否触发止损或止盈
+// StopLoss、TakeProfit均为百分比，止损以持仓期间最高价为基准（移动止损）
+func (s *Service) checkPosition(strategy *models.Strategy, position *models.Inventory) {
+	price := position.Item.CurrentPrice
+	if price <= 0 || position.BuyPrice <= 0 {
+		return
+	}
+
+	peak := s.updatePeakPrice(position, price)
+
+	var event string
+	switch {
+	case strategy.TakeProfit > 0 && price >= position.BuyPrice*(1+strategy.TakeProfit/100):
+		event = "take_profit"
+	case strategy.StopLoss > 0 && price <= peak*(1-strategy.StopLoss/100):
+		event = "stop_loss"
+	default:
+		return
+	}
+
+	// 止盈比例设得较低时，扣除卖出手续费后可能反而亏损
+	if event == "take_profit" && price < s.breakEvenPrice(position.Platform, position.BuyPrice) {
+		logrus.Debugf("Take profit for inventory %d skipped: price %.2f is below break-even", position.ID, price)
+		return
+	}
+
+	// 只卖出触发的这一批，用户手动买入或其他策略的同物品批次不受影响
+	lots := []LotSelection{{InventoryID: position.ID, Quantity: position.Quantity}}
+	order, err := s.createSellOrder(position.UserID, position.ItemID, price, position.Quantity, position.Platform, &strategy.ID, lots)
+	if err != nil {
+		logrus.Errorf("Failed to create %s order for inventory %d: %v", event, position.ID, err)
+		return
+	}
+
+	s.cache.Del(s.ctx, peakPriceKey(position.ID))
+
+	if s.hub != nil {
+		websocket.BroadcastStrategyEvent(s.hub, event, map[string]interface{}{
+			"strategy_id":  strategy.ID,
+			"user_id":      position.UserID,
+			"item_id":      position.ItemID,
+			"inventory_id": position.ID,
+			"buy_price":    position.BuyPrice,
+			"peak_price":   peak,
+			"price":        price,
+			"order_id":     order.ID,
+		})
+	}
+}
+
+// updatePeakPrice 更新并返回持仓期间的最高价
+func (s *Service) updatePeakPrice(position *models.Inventory, price float64) float64 {
+	key := peakPriceKey(position.ID)
+
+	// Redis不可用时退化为以买入价为基准的固定止损
+	cached, _ := s.cache.Get(s.ctx, key)
+	peak, err := strconv.ParseFloat(cached, 64)
+	if err != nil || peak < position.BuyPrice {
+		peak = position.BuyPrice
+	}
+
+	if price > peak {
+		peak = price
+	}
+	s.cache.Set(s.ctx, key, peak, 30*24*time.Hour)
+
+	return peak
+}
+
+func peakPriceKey(inventoryID uint) string {
+	return fmt.Sprintf("position:peak:%d", inventoryID)
+}
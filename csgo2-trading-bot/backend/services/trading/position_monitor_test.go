@@ -0,0 +1,61 @@
+package trading
+
+import (
+	"testing"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database/dbtest"
+	"csgo2-trading-bot/models"
+)
+
+// TestStopLossSellsTriggeringLot 用户同时持有手动买入和策略买入的同一物品，止损只卖出策略的批次，
+// 不会按先买先卖选中更早的手动批次，下一轮检查也不会重复卖出
+func TestStopLossSellsTriggeringLot(t *testing.T) {
+	db := dbtest.Open(t)
+	s := newTestService(t, db, config.TradingConfig{})
+	user := createTestUser(t, db, 0)
+	item := createTestItem(t, db, "M4A1-S | Printstream (Field-Tested)", 85)
+
+	strategy := models.Strategy{UserID: user.ID, Name: "trend", Type: "trend_following", Status: "active", Config: "{}", Performance: "{}", StopLoss: 10}
+	if err := db.Create(&strategy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	manual := models.Inventory{UserID: user.ID, ItemID: item.ID, AssetID: "2001", Quantity: 1, BuyPrice: 50, Platform: "buff", AcquiredAt: time.Now().Add(-48 * time.Hour), Tradable: true}
+	position := models.Inventory{UserID: user.ID, ItemID: item.ID, AssetID: "2002", Quantity: 1, BuyPrice: 100, Platform: "buff", StrategyID: &strategy.ID, AcquiredAt: time.Now().Add(-time.Hour), Tradable: true}
+	if err := db.Create(&manual).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&position).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s.checkPositions()
+	s.checkPositions()
+
+	var orders []models.Order
+	if err := db.Where("user_id = ? AND type = ?", user.ID, "sell").Find(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 {
+		t.Fatalf("%d stop-loss orders created, want 1", len(orders))
+	}
+	lots := orderLots(&orders[0])
+	if len(lots) != 1 || lots[0].InventoryID != position.ID || lots[0].Quantity != 1 {
+		t.Fatalf("stop-loss order lots = %+v, want strategy inventory %d", lots, position.ID)
+	}
+
+	if err := db.First(&manual, manual.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.First(&position, position.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if manual.Locked {
+		t.Error("manual lot was locked by the stop-loss order")
+	}
+	if !position.Locked {
+		t.Error("strategy lot was not locked by the stop-loss order")
+	}
+}
@@ -0,0 +1,197 @@
+package trading
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/audit"
+	"csgo2-trading-bot/services/ledger"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 激活前检查项代码
+const (
+	CheckUnlimitedBudget     = "unlimited_budget"
+	CheckBudgetOverBalance   = "budget_exceeds_balance"
+	CheckBudgetsOverBalance  = "total_budget_exceeds_balance"
+	CheckNoLiquidity         = "no_liquidity"
+	CheckLowLiquidity        = "low_liquidity"
+	CheckOverlappingStrategy = "overlapping_strategy"
+	CheckGridOverBudget      = "grid_exceeds_budget"
+)
+
+// 订单规模超过物品24小时成交量的该比例时视为流动性不足
+const liquidityShare = 0.1
+
+// PreflightCheck 一项激活前检查的警告，Points计入风险评分
+type PreflightCheck struct {
+	Code     string  `json:"code"`
+	Severity string  `json:"severity"` // warning, critical
+	Message  string  `json:"message"`
+	Points   int     `json:"points"`
+	Limit    float64 `json:"limit,omitempty"`
+	Actual   float64 `json:"actual,omitempty"`
+}
+
+// Preflight 策略激活前的检查结果，Score为0-100的风险评分
+type Preflight struct {
+	StrategyID uint             `json:"strategy_id"`
+	Score      int              `json:"score"`
+	Level      string           `json:"level"` // low, medium, high
+	Warnings   []PreflightCheck `json:"warnings"`
+	Balance    float64          `json:"balance"`
+}
+
+// PreflightRequired 激活请求没有确认全部警告
+type PreflightRequired struct {
+	Preflight      *Preflight `json:"preflight"`
+	Unacknowledged []string   `json:"unacknowledged"`
+}
+
+func (e *PreflightRequired) Error() string {
+	return fmt.Sprintf("strategy activation requires acknowledging warnings: %v", e.Unacknowledged)
+}
+
+// PreflightStrategy 激活前检查：预算与余额、物品流动性与订单规模、同一物品上的其他策略
+func (s *Service) PreflightStrategy(strategyID uint, userID uint) (*Preflight, error) {
+	var strategy models.Strategy
+	if err := s.db.Where("id = ? AND user_id = ?", strategyID, userID).First(&strategy).Error; err != nil {
+		return nil, err
+	}
+	return s.preflight(&strategy)
+}
+
+func (s *Service) preflight(strategy *models.Strategy) (*Preflight, error) {
+	balance, err := ledger.Balance(s.db, strategy.UserID)
+	if err != nil {
+		return nil, err
+	}
+	result := &Preflight{StrategyID: strategy.ID, Warnings: []PreflightCheck{}, Balance: balance}
+	warn := func(check PreflightCheck) {
+		result.Warnings = append(result.Warnings, check)
+	}
+
+	cfg := make(map[string]interface{})
+	if strategy.Config != "" {
+		json.Unmarshal([]byte(strategy.Config), &cfg)
+	}
+
+	// 预算与钱包余额
+	if strategy.MaxInvest <= 0 {
+		warn(PreflightCheck{Code: CheckUnlimitedBudget, Severity: "warning", Points: 20,
+			Message: "strategy has no max_invest, only global risk limits apply"})
+	} else if strategy.MaxInvest > balance {
+		warn(PreflightCheck{Code: CheckBudgetOverBalance, Severity: "critical", Points: 30,
+			Message: "strategy budget exceeds wallet balance", Limit: balance, Actual: strategy.MaxInvest})
+	}
+
+	var otherBudgets float64
+	s.db.Model(&models.Strategy{}).
+		Where("user_id = ? AND status = ? AND id <> ?", strategy.UserID, "active", strategy.ID).
+		Select("COALESCE(SUM(max_invest), 0)").Scan(&otherBudgets)
+	if total := otherBudgets + strategy.MaxInvest; strategy.MaxInvest > 0 && otherBudgets > 0 && total > balance {
+		warn(PreflightCheck{Code: CheckBudgetsOverBalance, Severity: "warning", Points: 15,
+			Message: "budgets of all active strategies exceed wallet balance", Limit: balance, Actual: total})
+	}
+
+	itemID := uint(toFloat(cfg["item_id"]))
+	if itemID == 0 {
+		s.scorePreflight(result)
+		return result, nil
+	}
+
+	// 物品流动性与订单规模：网格策略最多同时持有grid_count件，其他策略按quantity计
+	size := math.Max(toFloat(cfg["quantity"]), 1)
+	if strategy.Type == "grid" {
+		gridCount := toFloat(cfg["grid_count"])
+		size = math.Max(gridCount, 1)
+		if cost := gridCount * toFloat(cfg["max_price"]); strategy.MaxInvest > 0 && cost > strategy.MaxInvest {
+			warn(PreflightCheck{Code: CheckGridOverBudget, Severity: "warning", Points: 10,
+				Message: "filling every grid level would exceed the strategy budget", Limit: strategy.MaxInvest, Actual: cost})
+		}
+	}
+
+	var item models.Item
+	if err := s.db.First(&item, itemID).Error; err == nil {
+		switch {
+		case item.Volume24h <= 0:
+			warn(PreflightCheck{Code: CheckNoLiquidity, Severity: "critical", Points: 30,
+				Message: fmt.Sprintf("%s had no trades in the last 24 hours", item.MarketHashName), Actual: size})
+		case size > float64(item.Volume24h)*liquidityShare:
+			warn(PreflightCheck{Code: CheckLowLiquidity, Severity: "warning", Points: 20,
+				Message: fmt.Sprintf("order size is large relative to the 24h volume of %s", item.MarketHashName),
+				Limit:   float64(item.Volume24h) * liquidityShare, Actual: size})
+		}
+	}
+
+	// 同一物品上已激活的其他策略，互相之间可能对敲或重复建仓
+	var overlapping []models.Strategy
+	s.db.Select("id", "name", "type").
+		Where("user_id = ? AND status = ? AND id <> ? AND config->>'item_id' = ?",
+			strategy.UserID, "active", strategy.ID, strconv.FormatUint(uint64(itemID), 10)).
+		Find(&overlapping)
+	for _, other := range overlapping {
+		warn(PreflightCheck{Code: CheckOverlappingStrategy, Severity: "warning", Points: 15,
+			Message: fmt.Sprintf("active %s strategy %q (#%d) trades the same item", other.Type, other.Name, other.ID)})
+	}
+
+	s.scorePreflight(result)
+	return result, nil
+}
+
+func (s *Service) scorePreflight(result *Preflight) {
+	score := 0
+	for _, check := range result.Warnings {
+		score += check.Points
+	}
+	result.Score = min(score, 100)
+	switch {
+	case result.Score >= 60:
+		result.Level = "high"
+	case result.Score >= 30:
+		result.Level = "medium"
+	default:
+		result.Level = "low"
+	}
+}
+
+// unacknowledged 未在acknowledged中确认的警告代码
+func (p *Preflight) unacknowledged(acknowledged []string) []string {
+	acked := make(map[string]bool, len(acknowledged))
+	for _, code := range acknowledged {
+		acked[code] = true
+	}
+	var missing []string
+	seen := make(map[string]bool)
+	for _, check := range p.Warnings {
+		if !acked[check.Code] && !seen[check.Code] {
+			seen[check.Code] = true
+			missing = append(missing, check.Code)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// recordAcknowledgement 记录激活时的风险评分和用户确认的警告
+func (s *Service) recordAcknowledgement(strategy *models.Strategy, result *Preflight) {
+	if len(result.Warnings) == 0 {
+		return
+	}
+	err := audit.Log(s.db, audit.Entry{
+		ActorID:    &strategy.UserID,
+		UserID:     &strategy.UserID,
+		Action:     "strategy.risk_acknowledge",
+		EntityType: "strategy",
+		EntityID:   strategy.ID,
+		Details:    result,
+	})
+	if err != nil {
+		logrus.Warnf("Failed to audit risk acknowledgement of strategy %d: %v", strategy.ID, err)
+	}
+}
@@ -0,0 +1,213 @@
+package trading
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// apiWindow 固定窗口内的API调用计数
+type apiWindow struct {
+	start time.Time
+	calls int
+}
+
+// QuotaMeter 一项限额的用量，Limit为0表示不限制
+type QuotaMeter struct {
+	Limit     float64    `json:"limit"`
+	Used      float64    `json:"used"`
+	Remaining float64    `json:"remaining"`
+	ResetAt   *time.Time `json:"reset_at,omitempty"`
+}
+
+// QuotaUsage 平台账户的限额及当前用量
+type QuotaUsage struct {
+	Platform  string     `json:"platform"`
+	Purchases QuotaMeter `json:"purchases"`
+	Spend     QuotaMeter `json:"spend"`
+	Listings  QuotaMeter `json:"listings"`
+	APICalls  QuotaMeter `json:"api_calls"`
+}
+
+func newMeter(limit, used float64, resetAt *time.Time) QuotaMeter {
+	m := QuotaMeter{Limit: limit, Used: used, ResetAt: resetAt}
+	if limit > 0 && used < limit {
+		m.Remaining = limit - used
+	}
+	return m
+}
+
+// GetQuotas 所有配置了限额的平台账户的当前用量
+func (s *Service) GetQuotas() []QuotaUsage {
+	platforms := make([]string, 0, len(s.config.Quotas))
+	for platform := range s.config.Quotas {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+
+	usage := make([]QuotaUsage, 0, len(platforms))
+	for _, platform := range platforms {
+		usage = append(usage, s.quotaUsage(platform))
+	}
+	return usage
+}
+
+func (s *Service) quotaUsage(platform string) QuotaUsage {
+	card := s.config.Quotas[platform]
+	purchases, spend := s.dailyPurchases(platform, 0)
+	dayEnd := startOfDay(time.Now()).AddDate(0, 0, 1)
+
+	calls, windowEnd := s.apiCalls(platform, card)
+
+	return QuotaUsage{
+		Platform:  platform,
+		Purchases: newMeter(float64(card.DailyPurchases), float64(purchases), &dayEnd),
+		Spend:     newMeter(card.DailySpend, spend, &dayEnd),
+		Listings:  newMeter(float64(card.Listings), float64(s.activeListings(platform, 0)), nil),
+		APICalls:  newMeter(float64(card.APICalls), float64(calls), &windowEnd),
+	}
+}
+
+// evaluateQuota 订单会超出平台账户的购买或在售限额时拒绝
+func (s *Service) evaluateQuota(order *models.Order) *RiskViolation {
+	card, ok := s.config.Quotas[order.Platform]
+	if !ok {
+		return nil
+	}
+
+	if order.Type == "sell" {
+		if card.Listings <= 0 {
+			return nil
+		}
+		listings := s.activeListings(order.Platform, order.ID) + int64(order.Quantity)
+		if listings > int64(card.Listings) {
+			return quotaViolation(order.Platform, "listing", float64(card.Listings), float64(listings))
+		}
+		return nil
+	}
+
+	if card.DailyPurchases <= 0 && card.DailySpend <= 0 {
+		return nil
+	}
+	purchases, spend := s.dailyPurchases(order.Platform, order.ID)
+	purchases += int64(order.Quantity)
+	spend += order.Price * float64(order.Quantity)
+	if card.DailyPurchases > 0 && purchases > int64(card.DailyPurchases) {
+		return quotaViolation(order.Platform, "daily purchase", float64(card.DailyPurchases), float64(purchases))
+	}
+	if card.DailySpend > 0 && spend > card.DailySpend {
+		return quotaViolation(order.Platform, "daily spend", card.DailySpend, spend)
+	}
+	return nil
+}
+
+func quotaViolation(platform, quota string, limit, actual float64) *RiskViolation {
+	return &RiskViolation{
+		Code:   RiskPlatformQuota,
+		Reason: fmt.Sprintf("%s %s quota exceeded", platform, quota),
+		Limit:  limit,
+		Actual: actual,
+	}
+}
+
+// dailyPurchases 平台账户当日已成交及未成交买单的件数和金额，未成交的买单预先占用限额；
+// excludeID为修改中的订单，不计入（新订单为0）
+func (s *Service) dailyPurchases(platform string, excludeID uint) (int64, float64) {
+	var result struct {
+		Quantity int64
+		Amount   float64
+	}
+	s.db.Model(&models.Order{}).
+		Where("platform = ? AND type = ? AND (status = ? OR (status = ? AND executed_at >= ?))",
+			platform, "buy", "pending", "completed", startOfDay(time.Now())).
+		Where("id <> ?", excludeID).
+		Select("COALESCE(SUM(quantity), 0) AS quantity, COALESCE(SUM(quantity * price), 0) AS amount").
+		Scan(&result)
+	return result.Quantity, result.Amount
+}
+
+// activeListings 平台账户上未成交卖单的件数，未触发的条件单尚未上架，不计入；excludeID同dailyPurchases
+func (s *Service) activeListings(platform string, excludeID uint) int64 {
+	var listings int64
+	s.db.Model(&models.Order{}).
+		Where("platform = ? AND type = ? AND status = ? AND id <> ?", platform, "sell", "pending", excludeID).
+		Where("kind = '' OR triggered_at IS NOT NULL").
+		Select("COALESCE(SUM(quantity - filled_quantity), 0)").Scan(&listings)
+	return listings
+}
+
+// countAPICall 出站请求回调，按平台累计当前窗口的调用次数（本实例）
+func (s *Service) countAPICall(platform string) {
+	card, ok := s.config.Quotas[platform]
+	if !ok || card.APICalls <= 0 {
+		return
+	}
+
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	w := s.currentWindow(platform, card)
+	w.calls++
+}
+
+// apiCalls 当前窗口的调用次数及窗口结束时间
+func (s *Service) apiCalls(platform string, card config.QuotaCard) (int, time.Time) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	w := s.currentWindow(platform, card)
+	return w.calls, w.start.Add(apiWindowLength(card))
+}
+
+// currentWindow 调用方需持有quotaMu
+func (s *Service) currentWindow(platform string, card config.QuotaCard) *apiWindow {
+	length := apiWindowLength(card)
+	start := time.Now().Truncate(length)
+	w, ok := s.apiUsage[platform]
+	if !ok || !w.start.Equal(start) {
+		w = &apiWindow{start: start}
+		s.apiUsage[platform] = w
+	}
+	return w
+}
+
+func apiWindowLength(card config.QuotaCard) time.Duration {
+	if card.APIWindow <= 0 {
+		return time.Hour
+	}
+	return time.Duration(card.APIWindow) * time.Second
+}
+
+// deferForQuota 平台API调用预算已用尽时，把订单延后到下一个窗口再执行，返回true表示已延后。
+// 延后期间订单可能被取消或过期，届时不再执行
+func (s *Service) deferForQuota(order *models.Order) bool {
+	card, ok := s.config.Quotas[order.Platform]
+	if !ok || card.APICalls <= 0 {
+		return false
+	}
+	calls, resetAt := s.apiCalls(order.Platform, card)
+	if calls < card.APICalls {
+		return false
+	}
+
+	wait := time.Until(resetAt)
+	s.recordTimeline(order.ID, OrderDeferred, orderEventData{
+		Reason: fmt.Sprintf("%s API quota exhausted (%d/%d), retry in %s", order.Platform, calls, card.APICalls, wait.Round(time.Second)),
+	})
+	logrus.Infof("%s API quota exhausted (%d/%d), order %d delayed %s", order.Platform, calls, card.APICalls, order.ID, wait.Round(time.Second))
+	time.AfterFunc(wait, func() {
+		var current models.Order
+		if err := s.db.Select("id", "status").First(&current, order.ID).Error; err != nil || current.Status != "pending" {
+			return
+		}
+		s.enqueueExecution(order)
+	})
+	return true
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
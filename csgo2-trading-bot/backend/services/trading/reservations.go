@@ -0,0 +1,104 @@
+package trading
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"gorm.io/gorm"
+)
+
+// notReserved 库存未预留或预留已过期，策略、自动卖出和下单只使用满足该条件的库存
+const notReserved = "(reserved_until IS NULL OR reserved_until <= NOW())"
+
+// 单次预留的最长时间
+const maxReservation = 30 * 24 * time.Hour
+
+var (
+	// ErrInventoryNotFound 库存不存在或不属于该用户
+	ErrInventoryNotFound = errors.New("inventory not found")
+	// ErrInventoryNotReserved 库存没有生效中的预留
+	ErrInventoryNotReserved = errors.New("inventory is not reserved")
+)
+
+// ReservationRequest 预留库存，ExpiresAt为空时按Duration（秒）计算
+type ReservationRequest struct {
+	Reason    string     `json:"reason" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Duration  int        `json:"duration"`
+}
+
+// ReserveInventory 为站外用途预留库存，已有预留时更新原因和到期时间；挂单中的库存不能预留
+func (s *Service) ReserveInventory(userID, inventoryID uint, req ReservationRequest) (*models.Inventory, error) {
+	var until time.Time
+	switch {
+	case req.ExpiresAt != nil:
+		until = *req.ExpiresAt
+	case req.Duration > 0:
+		until = time.Now().Add(time.Duration(req.Duration) * time.Second)
+	default:
+		return nil, errors.New("expires_at or duration is required")
+	}
+	if !until.After(time.Now()) {
+		return nil, errors.New("reservation must expire in the future")
+	}
+	if until.Sub(time.Now()) > maxReservation {
+		return nil, errors.New("reservation cannot exceed 30 days")
+	}
+
+	var inventory models.Inventory
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", inventoryID, userID).First(&inventory).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInventoryNotFound
+			}
+			return err
+		}
+		if inventory.Locked {
+			return errors.New("inventory is locked by an open order")
+		}
+		inventory.ReservedUntil = &until
+		inventory.ReservedFor = strings.TrimSpace(req.Reason)
+		return tx.Model(&inventory).Updates(map[string]interface{}{
+			"reserved_until": inventory.ReservedUntil,
+			"reserved_for":   inventory.ReservedFor,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &inventory, nil
+}
+
+// ReleaseReservation 取消预留，库存重新可被策略使用
+func (s *Service) ReleaseReservation(userID, inventoryID uint) (*models.Inventory, error) {
+	var inventory models.Inventory
+	if err := s.db.Where("id = ? AND user_id = ?", inventoryID, userID).First(&inventory).Error; err != nil {
+		return nil, ErrInventoryNotFound
+	}
+	if inventory.ReservedUntil == nil || !inventory.ReservedUntil.After(time.Now()) {
+		return nil, ErrInventoryNotReserved
+	}
+
+	if err := s.db.Model(&inventory).Updates(map[string]interface{}{
+		"reserved_until": nil,
+		"reserved_for":   "",
+	}).Error; err != nil {
+		return nil, err
+	}
+	inventory.ReservedUntil = nil
+	inventory.ReservedFor = ""
+	return &inventory, nil
+}
+
+// GetReservations 用户生效中的库存预留，按到期时间排序
+func (s *Service) GetReservations(userID uint) ([]models.Inventory, error) {
+	var inventories []models.Inventory
+	err := s.db.Preload("Item").
+		Where("user_id = ? AND reserved_until > NOW()", userID).
+		Order("reserved_until").
+		Find(&inventories).Error
+	return inventories, err
+}
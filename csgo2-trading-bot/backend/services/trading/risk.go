@@ -0,0 +1,193 @@
+package trading
+
+import (
+	"fmt"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/notify"
+)
+
+// 风控拒单原因代码
+const (
+	RiskMaxItemInvestment = "max_item_investment"
+	RiskMaxExposure       = "max_exposure"
+	RiskDailyLossLimit    = "daily_loss_limit"
+	RiskMaxOpenOrders     = "max_open_orders"
+	RiskStrategyBudget    = "strategy_budget"
+	RiskPlatformQuota     = "platform_quota"
+	RiskItemHalted        = "item_halted"
+)
+
+// RiskViolation 风控拒单，Code为可供程序判断的原因代码
+type RiskViolation struct {
+	Code   string  `json:"code"`
+	Reason string  `json:"reason"`
+	Limit  float64 `json:"limit"`
+	Actual float64 `json:"actual"`
+}
+
+func (v *RiskViolation) Error() string {
+	return v.Reason
+}
+
+// checkRisk 所有订单创建前必须通过的风控检查，限额为0表示不限制
+func (s *Service) checkRisk(order *models.Order) error {
+	violation := s.evaluateRisk(order)
+	if violation == nil {
+		return nil
+	}
+
+	s.notifyRiskViolation(order, violation)
+	return violation
+}
+
+// evaluateRisk 风控检查；已有ID的订单（修改订单时）按修改后的价格和数量替换原订单计算
+func (s *Service) evaluateRisk(order *models.Order) *RiskViolation {
+	// 物品已暂停交易
+	if violation := s.haltViolation(order.ItemID); violation != nil {
+		return violation
+	}
+
+	// 平台账户限额
+	if violation := s.evaluateQuota(order); violation != nil {
+		return violation
+	}
+
+	limits := s.config.Risk
+
+	// 每个平台的挂单数量
+	if limits.MaxOpenOrdersPerPlatform > 0 {
+		var openOrders int64
+		s.db.Model(&models.Order{}).
+			Where("user_id = ? AND platform = ? AND status = ? AND id <> ?", order.UserID, order.Platform, "pending", order.ID).
+			Count(&openOrders)
+		if openOrders >= int64(limits.MaxOpenOrdersPerPlatform) {
+			return &RiskViolation{
+				Code:   RiskMaxOpenOrders,
+				Reason: fmt.Sprintf("too many open orders on %s", order.Platform),
+				Limit:  float64(limits.MaxOpenOrdersPerPlatform),
+				Actual: float64(openOrders),
+			}
+		}
+	}
+
+	// 卖单只会降低持仓，其余检查仅针对买单
+	if order.Type != "buy" {
+		return nil
+	}
+
+	cost := order.Price * float64(order.Quantity)
+
+	// 当日亏损达到上限后禁止继续买入
+	if limits.DailyLossLimit > 0 {
+		var dailyProfit float64
+		now := time.Now()
+		startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		s.db.Model(&models.Transaction{}).
+			Where("user_id = ? AND completed_at >= ?", order.UserID, startOfDay).
+			Select("COALESCE(SUM(profit), 0)").Scan(&dailyProfit)
+		if -dailyProfit >= limits.DailyLossLimit {
+			return &RiskViolation{
+				Code:   RiskDailyLossLimit,
+				Reason: "daily loss limit reached",
+				Limit:  limits.DailyLossLimit,
+				Actual: -dailyProfit,
+			}
+		}
+	}
+
+	// 策略预算（MaxInvest为0表示不限制）
+	if order.StrategyID != nil {
+		var strategy models.Strategy
+		if err := s.db.Select("id", "max_invest").First(&strategy, *order.StrategyID).Error; err == nil && strategy.MaxInvest > 0 {
+			committed := s.strategyCommitted(strategy.ID, order.ID) + cost
+			if committed > strategy.MaxInvest {
+				return &RiskViolation{
+					Code:   RiskStrategyBudget,
+					Reason: "strategy budget exhausted",
+					Limit:  strategy.MaxInvest,
+					Actual: committed,
+				}
+			}
+		}
+	}
+
+	// 单个物品的投入上限（持仓成本 + 未成交买单）
+	if limits.MaxItemInvestment > 0 {
+		itemExposure := s.exposure(order.UserID, &order.ItemID, order.ID) + cost
+		if itemExposure > limits.MaxItemInvestment {
+			return &RiskViolation{
+				Code:   RiskMaxItemInvestment,
+				Reason: "item investment limit exceeded",
+				Limit:  limits.MaxItemInvestment,
+				Actual: itemExposure,
+			}
+		}
+	}
+
+	// 总持仓上限
+	if limits.MaxExposure > 0 {
+		totalExposure := s.exposure(order.UserID, nil, order.ID) + cost
+		if totalExposure > limits.MaxExposure {
+			return &RiskViolation{
+				Code:   RiskMaxExposure,
+				Reason: "total exposure limit exceeded",
+				Limit:  limits.MaxExposure,
+				Actual: totalExposure,
+			}
+		}
+	}
+
+	return nil
+}
+
+// exposure 计算持仓成本与未成交买单金额之和，itemID为空时统计全部物品；
+// excludeID为修改中的订单，不计入未成交买单（新订单为0）
+func (s *Service) exposure(userID uint, itemID *uint, excludeID uint) float64 {
+	var holdings, pending float64
+
+	inventoryQuery := s.db.Model(&models.Inventory{}).Where("user_id = ?", userID)
+	orderQuery := s.db.Model(&models.Order{}).Where("user_id = ? AND type = ? AND status = ? AND id <> ?", userID, "buy", "pending", excludeID)
+	if itemID != nil {
+		inventoryQuery = inventoryQuery.Where("item_id = ?", *itemID)
+		orderQuery = orderQuery.Where("item_id = ?", *itemID)
+	}
+
+	inventoryQuery.Select("COALESCE(SUM(quantity * buy_price), 0)").Scan(&holdings)
+	// 部分成交的数量已计入库存，挂单只算未成交部分
+	orderQuery.Select("COALESCE(SUM((quantity - filled_quantity) * price), 0)").Scan(&pending)
+
+	return holdings + pending
+}
+
+// strategyCommitted 策略已占用的资金：未成交买单 + 策略买入且仍持有的库存成本，excludeID同exposure
+func (s *Service) strategyCommitted(strategyID uint, excludeID uint) float64 {
+	var holdings, pending float64
+
+	s.db.Model(&models.Inventory{}).
+		Where("strategy_id = ?", strategyID).
+		Select("COALESCE(SUM(quantity * buy_price), 0)").Scan(&holdings)
+	s.db.Model(&models.Order{}).
+		Where("strategy_id = ? AND type = ? AND status = ? AND id <> ?", strategyID, "buy", "pending", excludeID).
+		Select("COALESCE(SUM((quantity - filled_quantity) * price), 0)").Scan(&pending)
+
+	return holdings + pending
+}
+
+// notifyRiskViolation 通知用户订单被风控拒绝
+func (s *Service) notifyRiskViolation(order *models.Order, violation *RiskViolation) {
+	s.notifier.Publish(order.UserID, notify.Message{
+		Event: notify.EventRiskRejected,
+		Title: "订单被风控拒绝",
+		Body:  violation.Reason,
+		Data: map[string]interface{}{
+			"violation": violation,
+			"item_id":   order.ItemID,
+			"type":      order.Type,
+			"platform":  order.Platform,
+			"price":     order.Price,
+			"quantity":  order.Quantity,
+		},
+	})
+}
@@ -0,0 +1,313 @@
+package trading
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// PlatformAuto 下单时由路由层选择平台
+const PlatformAuto = "auto"
+
+const (
+	// 超过该时长没有更新的平台价格不参与自动路由
+	routingPriceMaxAge = 24 * time.Hour
+	// 平台健康度按最近一段时间的订单结果计算
+	routingHealthWindow   = time.Hour
+	routingHealthMinCount = 5
+	routingHealthMaxFail  = 0.5
+)
+
+// RoutingCandidate 一个候选平台的评估结果
+type RoutingCandidate struct {
+	Platform  string  `json:"platform"`
+	Price     float64 `json:"price,omitempty"` // 平台最新价格
+	Fee       float64 `json:"fee,omitempty"`
+	Effective float64 `json:"effective,omitempty"` // 买入为含手续费的单价，卖出为扣除手续费后的到手单价
+	Preferred bool    `json:"preferred,omitempty"`
+	Rejected  string  `json:"rejected,omitempty"` // 不可用的原因
+}
+
+// RoutingDecision 自动路由的决策记录，保存在订单上
+type RoutingDecision struct {
+	Platform   string             `json:"platform"`
+	Reason     string             `json:"reason"`
+	Candidates []RoutingCandidate `json:"candidates"`
+	DecidedAt  time.Time          `json:"decided_at"`
+}
+
+// RoutingSettings 修改下单平台偏好时提交的内容
+type RoutingSettings struct {
+	DefaultPlatform string   `json:"default_platform"`
+	Preferred       []string `json:"preferred"`
+	Excluded        []string `json:"excluded"`
+	Margin          float64  `json:"margin"`
+}
+
+// GetRoutingPreference 用户的下单平台偏好，未设置时返回空偏好
+func (s *Service) GetRoutingPreference(userID uint) *models.RoutingPreference {
+	pref := models.RoutingPreference{UserID: userID}
+	s.db.Where("user_id = ?", userID).First(&pref)
+	return &pref
+}
+
+// SaveRoutingPreference 创建或修改下单平台偏好
+func (s *Service) SaveRoutingPreference(userID uint, settings RoutingSettings) (*models.RoutingPreference, error) {
+	known := s.RoutablePlatforms()
+	valid := func(platform string) bool {
+		for _, p := range known {
+			if p == platform {
+				return true
+			}
+		}
+		return false
+	}
+
+	if settings.DefaultPlatform != "" && settings.DefaultPlatform != PlatformAuto && !valid(settings.DefaultPlatform) {
+		return nil, fmt.Errorf("unknown platform %q", settings.DefaultPlatform)
+	}
+	for _, platform := range append(append([]string{}, settings.Preferred...), settings.Excluded...) {
+		if !valid(platform) {
+			return nil, fmt.Errorf("unknown platform %q", platform)
+		}
+	}
+	if settings.Margin < 0 || settings.Margin > 20 {
+		return nil, errors.New("margin must be between 0 and 20")
+	}
+
+	pref := s.GetRoutingPreference(userID)
+	pref.DefaultPlatform = settings.DefaultPlatform
+	pref.Preferred = strings.Join(settings.Preferred, ",")
+	pref.Excluded = strings.Join(settings.Excluded, ",")
+	pref.Margin = settings.Margin
+	if err := s.db.Save(pref).Error; err != nil {
+		return nil, err
+	}
+	return pref, nil
+}
+
+// RoutablePlatforms 已接入且启用、可参与路由的交易平台
+func (s *Service) RoutablePlatforms() []string {
+	platforms := []string{"steam"}
+	if s.config.BuffAPI.Enabled {
+		platforms = append(platforms, "buff")
+	}
+	if s.config.YouPin.Enabled {
+		platforms = append(platforms, "youpin")
+	}
+	if s.bitskins != nil {
+		platforms = append(platforms, "bitskins")
+	}
+	if s.marketcsgo != nil {
+		platforms = append(platforms, "marketcsgo")
+	}
+	return platforms
+}
+
+// resolvePlatform 未指定平台时使用用户的默认平台，平台为auto时按有效价格选择并记录决策
+func (s *Service) resolvePlatform(order *models.Order) error {
+	if order.Platform != "" && order.Platform != PlatformAuto {
+		return nil
+	}
+
+	pref := s.GetRoutingPreference(order.UserID)
+	if order.Platform == "" && pref.DefaultPlatform != "" && pref.DefaultPlatform != PlatformAuto {
+		order.Platform = pref.DefaultPlatform
+		return nil
+	}
+
+	decision, err := s.routeOrder(order, pref)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(decision)
+	if err != nil {
+		return err
+	}
+	routing := string(b)
+	order.Platform = decision.Platform
+	order.Routing = &routing
+	return nil
+}
+
+// routeOrder 评估各平台的有效价格、可用性和健康度，买单选含手续费成本最低的平台，卖单选到手金额最高的平台
+func (s *Service) routeOrder(order *models.Order, pref *models.RoutingPreference) (*RoutingDecision, error) {
+	prices, err := s.latestPlatformPrices(order.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	excluded := splitList(pref.Excluded)
+	preferred := splitList(pref.Preferred)
+	held := s.heldPlatforms(order)
+	now := time.Now()
+
+	decision := &RoutingDecision{DecidedAt: now}
+	var eligible []RoutingCandidate
+	for _, platform := range s.RoutablePlatforms() {
+		c := RoutingCandidate{Platform: platform, Preferred: indexOf(preferred, platform) >= 0}
+		quote, ok := prices[platform]
+		if ok {
+			c.Price = quote.Price
+			if order.Type == "sell" {
+				c.Fee = s.sellFee(platform, quote.Price)
+				c.Effective = quote.Price - c.Fee
+			} else {
+				c.Fee = s.buyFee(platform, quote.Price)
+				c.Effective = quote.Price + c.Fee
+			}
+		}
+
+		switch {
+		case indexOf(excluded, platform) >= 0:
+			c.Rejected = "excluded by preference"
+		case !ok:
+			c.Rejected = "no price"
+		case now.Sub(quote.RecordedAt) > routingPriceMaxAge:
+			c.Rejected = "stale price"
+		case order.Type == "buy" && quote.Price > order.Price:
+			c.Rejected = "market price above limit"
+		case order.Type == "sell" && quote.Price < order.Price:
+			c.Rejected = "market price below limit"
+		case held != nil && !held[platform]:
+			c.Rejected = "item not held on platform"
+		case !s.platformHealthy(platform, now):
+			c.Rejected = "unhealthy"
+		default:
+			probe := *order
+			probe.Platform = platform
+			if violation := s.evaluateQuota(&probe); violation != nil {
+				c.Rejected = violation.Reason
+			}
+		}
+
+		decision.Candidates = append(decision.Candidates, c)
+		if c.Rejected == "" {
+			eligible = append(eligible, c)
+		}
+	}
+
+	if len(eligible) == 0 {
+		return nil, errors.New("no platform available for auto routing")
+	}
+
+	// better 按订单方向比较有效价格
+	better := func(a, b float64) bool {
+		if order.Type == "sell" {
+			return a > b
+		}
+		return a < b
+	}
+	sort.SliceStable(eligible, func(i, j int) bool {
+		return better(eligible[i].Effective, eligible[j].Effective)
+	})
+	best := eligible[0]
+	decision.Platform = best.Platform
+	decision.Reason = "best effective price"
+
+	// 偏好平台与最优价的差距在容忍范围内时优先选择，按偏好顺序
+	if pref.Margin > 0 {
+		for _, platform := range preferred {
+			for _, c := range eligible {
+				if c.Platform != platform || c.Platform == best.Platform {
+					continue
+				}
+				gap := (c.Effective - best.Effective) / best.Effective * 100
+				if order.Type == "sell" {
+					gap = -gap
+				}
+				if gap <= pref.Margin {
+					decision.Platform = c.Platform
+					decision.Reason = fmt.Sprintf("preferred platform within %.2f%% of best (%s)", pref.Margin, best.Platform)
+					return decision, nil
+				}
+			}
+			if platform == best.Platform {
+				break
+			}
+		}
+	}
+	return decision, nil
+}
+
+// platformQuote 平台的最新价格及记录时间
+type platformQuote struct {
+	Platform   string
+	Price      float64
+	RecordedAt time.Time
+}
+
+// latestPlatformPrices 物品在各平台的最新价格
+func (s *Service) latestPlatformPrices(itemID uint) (map[string]platformQuote, error) {
+	var rows []platformQuote
+	err := s.db.Raw(`
+		SELECT DISTINCT ON (platform) platform, price, recorded_at
+		FROM price_histories
+		WHERE item_id = ? AND price > 0 AND deleted_at IS NULL
+		ORDER BY platform, recorded_at DESC`, itemID).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := make(map[string]platformQuote, len(rows))
+	for _, row := range rows {
+		quotes[row.Platform] = row
+	}
+	return quotes, nil
+}
+
+// heldPlatforms 卖单只能在持有该物品的平台上卖出；库存没有记录平台时返回nil，表示不限制
+func (s *Service) heldPlatforms(order *models.Order) map[string]bool {
+	if order.Type != "sell" {
+		return nil
+	}
+	var platforms []string
+	s.db.Model(&models.Inventory{}).
+		Where("user_id = ? AND item_id = ? AND quantity > 0 AND platform <> ''", order.UserID, order.ItemID).
+		Distinct().Pluck("platform", &platforms)
+	if len(platforms) == 0 {
+		return nil
+	}
+	held := make(map[string]bool, len(platforms))
+	for _, p := range platforms {
+		held[p] = true
+	}
+	return held
+}
+
+// platformHealthy 最近一小时内订单失败率过高的平台视为不健康
+func (s *Service) platformHealthy(platform string, now time.Time) bool {
+	var result struct {
+		Total  int
+		Failed int
+	}
+	s.db.Model(&models.Order{}).
+		Where("platform = ? AND status IN ? AND updated_at >= ?", platform, []string{"completed", "failed"}, now.Add(-routingHealthWindow)).
+		Select("COUNT(*) AS total, COUNT(*) FILTER (WHERE status = 'failed') AS failed").
+		Scan(&result)
+	if result.Total < routingHealthMinCount {
+		return true
+	}
+	return float64(result.Failed)/float64(result.Total) < routingHealthMaxFail
+}
+
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
+
+func indexOf(list []string, value string) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
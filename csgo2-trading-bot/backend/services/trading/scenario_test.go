@@ -0,0 +1,348 @@
+package trading
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database/dbtest"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/catalog"
+	"csgo2-trading-bot/services/clock"
+	"csgo2-trading-bot/services/ledger"
+	"csgo2-trading-bot/services/platforms/mock"
+
+	"gorm.io/gorm"
+)
+
+const (
+	gridItem    = "AK-47 | Redline (Field-Tested)"
+	scriptItem  = "USP-S | Kill Confirmed (Field-Tested)"
+	arbItem     = "AWP | Asiimov (Field-Tested)"
+	trendItem   = "M4A1-S | Printstream (Minimal Wear)"
+	revertItem  = "Glock-18 | Water Elemental (Minimal Wear)"
+	startFunds  = 1000.0
+	marketFunds = 10000.0
+)
+
+// dayPrices 模拟交易日的价格走势：物品 -> 小时 -> 价格，两个关键点之间保持上一个价格
+var dayPrices = map[string]map[int]float64{
+	// 网格10-20共10格：3、6点下穿买入，9、12点上穿卖出，15点继续上穿但没有库存，18点下穿买入
+	gridItem: {0: 15.0, 3: 13.2, 6: 12.4, 9: 14.6, 12: 16.1, 15: 17.3, 18: 15.5},
+	// 脚本低于58且空仓时买入，高于64且有持仓时卖出：2点买入，8点卖出，14点再次买入
+	scriptItem: {0: 61.3, 2: 57.0, 5: 60.0, 8: 65.0, 11: 66.0, 14: 56.0, 17: 59.0},
+	arbItem:    {0: 92.4, 10: 88.0, 20: 95.0},
+	trendItem:  {0: 210.0, 6: 220.0, 12: 230.0, 18: 240.0},
+	revertItem: {0: 4.2, 8: 3.6, 16: 4.8},
+}
+
+const scenarioScript = `
+function tick()
+  local p = bot.price(%d)
+  local held = bot.inventory(%d)
+  if held == 0 and p < 58 then
+    bot.buy(%d, p, 1, "bitskins")
+  elseif held > 0 and p > 64 then
+    bot.sell(%d, p, held, "bitskins")
+  end
+end
+`
+
+// scenarioTrade 按价格走势推算出的成交
+type scenarioTrade struct {
+	item  string
+	side  string
+	price float64
+	cost  float64 // 卖出批次的买入价
+}
+
+var expectedTrades = []scenarioTrade{
+	{gridItem, "buy", 13.2, 0},
+	{gridItem, "buy", 12.4, 0},
+	{gridItem, "sell", 14.6, 13.2},
+	{gridItem, "sell", 16.1, 12.4},
+	{gridItem, "buy", 15.5, 0},
+	{scriptItem, "buy", 57.0, 0},
+	{scriptItem, "sell", 65.0, 57.0},
+	{scriptItem, "buy", 56.0, 0},
+}
+
+// TestTradingDayScenario 在模拟市场上运行完整的一个交易日：导入物品目录，每小时推送行情、
+// 运行各类型策略并执行订单，最后核对资金流水、库存和统计
+func TestTradingDayScenario(t *testing.T) {
+	db := dbtest.Open(t)
+
+	market := mock.New(mock.Options{Balance: marketFunds, Seed: 1})
+	srv := httptest.NewServer(market)
+	t.Cleanup(srv.Close)
+
+	// 物品目录从模拟的Steam市场搜索导入
+	source, err := catalog.NewSource(config.CatalogConfig{URL: srv.URL + "/steam/market/search/render/"}, srv.Client(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := catalog.NewService(db, source, nil, config.CatalogConfig{}).Run("scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != "completed" || run.Created != len(market.Items()) {
+		t.Fatalf("catalog import %s created %d items, want %d: %s", run.Status, run.Created, len(market.Items()), run.Error)
+	}
+	items := make(map[string]uint)
+	var catalogItems []models.Item
+	db.Find(&catalogItems)
+	for _, item := range catalogItems {
+		items[item.MarketHashName] = item.ID
+	}
+
+	var cfg config.TradingConfig
+	cfg.BitSkins.Enabled = true
+	cfg.BitSkins.APIKey = "scenario"
+	cfg.BitSkins.SandboxURL = srv.URL + "/bitskins"
+	cfg.MarketCSGO.Enabled = true
+	cfg.MarketCSGO.APIKey = "scenario"
+	cfg.MarketCSGO.SandboxURL = srv.URL + "/marketcsgo"
+	cfg.Fees = map[string]config.FeeSchedule{
+		"bitskins":   {Buy: 0.01, Sell: 0.05},
+		"marketcsgo": {Buy: 0, Sell: 0.05},
+	}
+	s := newTestService(t, db, cfg)
+
+	// 交易日从过去的某一天开始，统计区间必须按服务的时钟而不是系统时间计算
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -3)
+	clk := clock.NewFake(day)
+	s.UseClock(clk)
+
+	user := createTestUser(t, db, startFunds)
+	strategies := map[string]uint{
+		"grid": createScenarioStrategy(t, s, user.ID, "grid", map[string]interface{}{
+			"item_id": items[gridItem], "min_price": 10, "max_price": 20, "grid_count": 10, "platform": "bitskins",
+		}),
+		"script": createScenarioStrategy(t, s, user.ID, "script", map[string]interface{}{
+			"item_id": items[scriptItem],
+			"script":  fmt.Sprintf(scenarioScript, items[scriptItem], items[scriptItem], items[scriptItem], items[scriptItem]),
+		}),
+		"arbitrage":       createScenarioStrategy(t, s, user.ID, "arbitrage", map[string]interface{}{"item_id": items[arbItem]}),
+		"trend_following": createScenarioStrategy(t, s, user.ID, "trend_following", map[string]interface{}{"item_id": items[trendItem]}),
+		"mean_reversion":  createScenarioStrategy(t, s, user.ID, "mean_reversion", map[string]interface{}{"item_id": items[revertItem]}),
+	}
+
+	for _, strategyType := range StrategyTypes() {
+		if strategies[strategyType] == 0 {
+			t.Fatalf("strategy type %s is not covered by the scenario", strategyType)
+		}
+	}
+
+	prices := make(map[string]float64)
+	for hour := 0; hour < 24; hour++ {
+		if hour > 0 {
+			clk.Advance(time.Hour)
+		}
+		for name, path := range dayPrices {
+			if price, ok := path[hour]; ok {
+				prices[name] = price
+			}
+		}
+		publishPrices(t, s, market, items, prices)
+
+		for _, strategyType := range StrategyTypes() {
+			tickStrategy(t, s, strategies[strategyType])
+		}
+		executePending(t, s, user.ID)
+		receiveWithdrawals(t, db, user.ID)
+	}
+
+	// 成交
+	var transactions []models.Transaction
+	db.Where("user_id = ?", user.ID).Order("completed_at, id").Find(&transactions)
+	if len(transactions) != len(expectedTrades) {
+		t.Fatalf("%d transactions, want %d", len(transactions), len(expectedTrades))
+	}
+	var (
+		wantBalance = startFunds
+		wantVolume  float64
+		wantProfit  float64
+		wantWins    int64
+		wantSpent   float64 // 在BitSkins上买入花费的美元
+		held        = make(map[string]int)
+	)
+	for _, trade := range expectedTrades {
+		wantVolume += trade.price
+		if trade.side == "buy" {
+			wantBalance -= trade.price + s.buyFee("bitskins", trade.price)
+			wantSpent += trade.price
+			held[trade.item]++
+			continue
+		}
+		fee := s.sellFee("bitskins", trade.price)
+		profit := trade.price - trade.cost - fee
+		wantBalance += trade.price - fee
+		wantProfit += profit
+		if profit > 0 {
+			wantWins++
+		}
+		held[trade.item]--
+	}
+	for _, tx := range transactions {
+		if tx.CompletedAt.Before(day) || tx.CompletedAt.After(clk.Now()) {
+			t.Errorf("transaction %d completed at %s, outside the simulated day", tx.ID, tx.CompletedAt)
+		}
+	}
+
+	// 资金流水
+	balance, err := ledger.Balance(db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertAmount(t, "ledger balance", balance, wantBalance)
+	var last models.LedgerEntry
+	db.Where("user_id = ?", user.ID).Order("id DESC").First(&last)
+	assertAmount(t, "running balance of the last ledger entry", last.Balance, wantBalance)
+
+	// 库存
+	for name, id := range items {
+		var quantity int
+		db.Model(&models.Inventory{}).Where("user_id = ? AND item_id = ?", user.ID, id).
+			Select("COALESCE(SUM(quantity), 0)").Scan(&quantity)
+		if quantity != held[name] {
+			t.Errorf("inventory of %s = %d, want %d", name, quantity, held[name])
+		}
+	}
+
+	// 没有遗留的挂单，只有网格和脚本策略下过单
+	var pending int64
+	db.Model(&models.Order{}).Where("user_id = ? AND status <> ?", user.ID, "completed").Count(&pending)
+	if pending != 0 {
+		t.Errorf("%d orders did not complete", pending)
+	}
+	for strategyType, id := range strategies {
+		var orders int64
+		db.Model(&models.Order{}).Where("strategy_id = ?", id).Count(&orders)
+		if want := strategyType == "grid" || strategyType == "script"; want != (orders > 0) {
+			t.Errorf("%s strategy placed %d orders", strategyType, orders)
+		}
+	}
+
+	// 统计
+	stats, err := s.GetTradingStats(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertAmount(t, "total volume", stats["total_volume"].(float64), wantVolume)
+	assertAmount(t, "inventory value", stats["inventory_value"].(float64), prices[gridItem]+prices[scriptItem])
+	if stats["active_orders"].(int64) != 0 || stats["strategy_count"].(int64) != int64(len(strategies)) {
+		t.Errorf("trading stats = %v", stats)
+	}
+
+	profit, err := s.GetProfitStats(user.ID, "day", "strategy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertAmount(t, "total profit", profit["total_profit"].(float64), wantProfit)
+	if profit["trade_count"].(int64) != int64(len(expectedTrades)) {
+		t.Errorf("trade count = %v, want %d", profit["trade_count"], len(expectedTrades))
+	}
+	assertAmount(t, "win rate", profit["win_rate"].(float64), float64(wantWins)/float64(len(expectedTrades))*100)
+
+	// 模拟市场上的账户余额与成交一致
+	var state struct {
+		Balances map[string]float64 `json:"balances"`
+	}
+	resp, err := srv.Client().Get(srv.URL + "/_mock/state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		t.Fatal(err)
+	}
+	assertAmount(t, "bitskins account balance", state.Balances["bitskins"], marketFunds-wantSpent)
+}
+
+func createScenarioStrategy(t *testing.T, s *Service, userID uint, strategyType string, cfg map[string]interface{}) uint {
+	t.Helper()
+	raw, _ := json.Marshal(cfg)
+	strategy := &models.Strategy{Name: strategyType, Type: strategyType, Config: string(raw), Schedule: "1h", MaxInvest: 200}
+	if err := s.CreateStrategy(userID, strategy); err != nil {
+		t.Fatalf("create %s strategy: %v", strategyType, err)
+	}
+
+	err := s.ActivateStrategy(strategy.ID, userID, nil)
+	var required *PreflightRequired
+	if errors.As(err, &required) {
+		err = s.ActivateStrategy(strategy.ID, userID, required.Unacknowledged)
+	}
+	if err != nil {
+		t.Fatalf("activate %s strategy: %v", strategyType, err)
+	}
+	return strategy.ID
+}
+
+// publishPrices 更新模拟市场的价格并同步两个平台的报价，物品当前价格按采集器的方式更新
+func publishPrices(t *testing.T, s *Service, market *mock.Server, items map[string]uint, prices map[string]float64) {
+	t.Helper()
+	for name, price := range prices {
+		if !market.SetPrice(name, price) {
+			t.Fatalf("%s is not listed on the mock market", name)
+		}
+		if err := s.db.Model(&models.Item{}).Where("id = ?", items[name]).
+			Updates(map[string]interface{}{"current_price": price, "last_updated": s.now()}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.syncBitSkinsPrices()
+	s.syncMarketCSGOPrices()
+}
+
+// tickStrategy 执行策略的一个调度周期，与调度任务runStrategy相同，但执行出错时测试失败
+func tickStrategy(t *testing.T, s *Service, strategyID uint) {
+	t.Helper()
+	var strategy models.Strategy
+	if err := s.db.First(&strategy, strategyID).Error; err != nil {
+		t.Fatal(err)
+	}
+	env := s.newStrategyEnv(&strategy)
+	runner, err := s.getRunner(&strategy, env)
+	if err != nil {
+		t.Fatalf("%s strategy init: %v", strategy.Type, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.strategyTimeout())
+	defer cancel()
+	if err := runner.Tick(ctx, env); err != nil {
+		t.Fatalf("%s strategy tick at %s: %v", strategy.Type, s.now().Format(time.Kitchen), err)
+	}
+	s.snapshotRunner(&strategy, runner)
+}
+
+// executePending 依次执行用户的待执行订单，代替执行队列的工作协程
+func executePending(t *testing.T, s *Service, userID uint) {
+	t.Helper()
+	var ids []uint
+	s.db.Model(&models.Order{}).Where("user_id = ? AND status = ?", userID, "pending").Order("id").Pluck("id", &ids)
+	for _, id := range ids {
+		s.runExecution(id)
+	}
+}
+
+// receiveWithdrawals 从平台提取的物品到达Steam库存后获得资产ID，卖出时上架需要资产ID
+func receiveWithdrawals(t *testing.T, db *gorm.DB, userID uint) {
+	t.Helper()
+	if err := db.Model(&models.Inventory{}).Where("user_id = ? AND asset_id = ''", userID).
+		Update("asset_id", gorm.Expr("'steam-' || id")).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertAmount(t *testing.T, name string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-6 {
+		t.Errorf("%s = %.4f, want %.4f", name, got, want)
+	}
+}
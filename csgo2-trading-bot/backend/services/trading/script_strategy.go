@@ -0,0 +1,295 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+
+	"csgo2-trading-bot/services/depth"
+
+	"github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func init() {
+	RegisterStrategy("script", func() StrategyRunner { return &scriptRunner{} })
+}
+
+// scriptRunner 用户自定义Lua脚本策略
+//
+// 脚本保存在Strategy.Config的script字段中，需定义tick()函数，可选定义init()和stop()。
+// 脚本只能通过bot表访问行情、库存和下单：
+//
+//	bot.price(item_id)                          -> 当前价格
+//	bot.history(item_id, days)                  -> 价格序列
+//	bot.popularity(item_id)                     -> 社区热度
+//	bot.thin_ask_wall(item_id, pct, max_qty)    -> 是否薄卖墙, 范围内卖单数量, 买光的金额
+//	bot.inventory(item_id)                      -> 可交易数量
+//	bot.buy(item_id, price, quantity, platform) -> 订单ID
+//	bot.sell(item_id, price, quantity, platform)-> 订单ID
+//	bot.log(message)
+//
+// 试运行时bot.buy/bot.sell只记录信号并返回0，bot.log的内容作为决策理由返回。
+// 沙箱限制调用深度和值栈大小，string.rep的结果长度有上限，单次执行期间进程堆内存增长超过上限时中断脚本，之后的执行直接返回错误。
+type scriptRunner struct {
+	mu    sync.Mutex // LState不是并发安全的
+	state *lua.LState
+}
+
+// 沙箱中移除的全局函数，禁止加载外部代码和访问文件系统；print会写到服务器的标准输出，脚本日志使用bot.log
+var luaBlockedGlobals = []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "collectgarbage", "print"}
+
+// 沙箱资源限制
+const (
+	luaCallStackSize   = 200       // 函数调用嵌套层数
+	luaRegistrySize    = 4 * 1024  // 值栈初始大小
+	luaRegistryMaxSize = 64 * 1024 // 值栈上限，超过时脚本报错而不是继续增长
+	luaMaxStringSize   = 1 << 20   // string.rep结果的最大字节数
+	luaMemorySample    = 5 * time.Millisecond
+)
+
+// luaMemoryLimit 单次执行期间进程堆内存增长的上限。gopher-lua不统计单个虚拟机的内存，
+// 按进程采样会把同期其他协程的分配也算进去，上限取单个策略正常情况下远达不到的值
+var luaMemoryLimit int64 = 256 << 20
+
+// errScriptMemory 脚本执行期间内存增长超过上限，策略被停止
+var errScriptMemory = errors.New("script exceeded its memory limit")
+
+func (r *scriptRunner) Init(ctx context.Context, env *StrategyEnv) error {
+	script, _ := env.Config["script"].(string)
+	if script == "" {
+		return errors.New("script strategy requires config.script")
+	}
+
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   luaCallStackSize,
+		RegistrySize:    luaRegistrySize,
+		RegistryMaxSize: luaRegistryMaxSize,
+	})
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range luaBlockedGlobals {
+		L.SetGlobal(name, lua.LNil)
+	}
+	// 字符串方法与string表共用，替换后("x"):rep(n)同样受限
+	L.SetField(L.GetGlobal("string"), "rep", L.NewFunction(luaStringRep))
+	L.SetGlobal("bot", r.newAPI(L, env))
+
+	if err := withMemoryLimit(ctx, func(ctx context.Context) error {
+		L.SetContext(ctx)
+		defer L.RemoveContext()
+		return L.DoString(script)
+	}); err != nil {
+		L.Close()
+		return err
+	}
+	r.state = L
+
+	return r.call(ctx, "init", false)
+}
+
+func (r *scriptRunner) Tick(ctx context.Context, env *StrategyEnv) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == nil {
+		return errScriptMemory
+	}
+	// 每次执行前更新API绑定的策略快照
+	r.state.SetGlobal("bot", r.newAPI(r.state, env))
+	return r.call(ctx, "tick", true)
+}
+
+func (r *scriptRunner) Stop(ctx context.Context, env *StrategyEnv) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state == nil {
+		return nil
+	}
+	err := r.call(ctx, "stop", false)
+	if r.state != nil {
+		r.state.Close()
+		r.state = nil
+	}
+	return err
+}
+
+// call 调用脚本中的全局函数，ctx超时后脚本会被中断
+func (r *scriptRunner) call(ctx context.Context, name string, required bool) error {
+	fn := r.state.GetGlobal(name)
+	if fn.Type() != lua.LTFunction {
+		if required {
+			return errors.New("script must define function " + name + "()")
+		}
+		return nil
+	}
+
+	err := withMemoryLimit(ctx, func(ctx context.Context) error {
+		r.state.SetContext(ctx)
+		defer r.state.RemoveContext()
+		return r.state.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true})
+	})
+	if errors.Is(err, errScriptMemory) {
+		// 脚本可能把占用的内存保存在全局变量中，关闭虚拟机释放，之后的执行直接返回错误
+		r.state.Close()
+		r.state = nil
+	}
+	return err
+}
+
+// withMemoryLimit 执行run期间定期采样进程堆内存，增长超过luaMemoryLimit时取消ctx中断脚本
+func withMemoryLimit(ctx context.Context, run func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		base := heapBytes()
+		ticker := time.NewTicker(luaMemorySample)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if heapBytes()-base > luaMemoryLimit {
+					cancel(errScriptMemory)
+					return
+				}
+			}
+		}
+	}()
+
+	err := run(ctx)
+	if errors.Is(context.Cause(ctx), errScriptMemory) {
+		return errScriptMemory
+	}
+	return err
+}
+
+// heapBytes 进程堆上对象占用的字节数，不触发STW
+func heapBytes() int64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return int64(sample[0].Value.Uint64())
+}
+
+// luaStringRep 带长度上限的string.rep，strings.Repeat在一次调用内完成，无法被ctx中断
+func luaStringRep(L *lua.LState) int {
+	str := L.CheckString(1)
+	n := L.CheckInt(2)
+	if n <= 0 || str == "" {
+		L.Push(lua.LString(""))
+		return 1
+	}
+	if n > luaMaxStringSize/len(str) {
+		L.RaiseError("string.rep: result exceeds %d bytes", luaMaxStringSize)
+	}
+	L.Push(lua.LString(strings.Repeat(str, n)))
+	return 1
+}
+
+func (r *scriptRunner) newAPI(L *lua.LState, env *StrategyEnv) *lua.LTable {
+	api := L.NewTable()
+
+	L.SetField(api, "price", L.NewFunction(func(L *lua.LState) int {
+		price, err := env.CurrentPrice(L.Context(), uint(L.CheckInt(1)))
+		if err != nil {
+			L.RaiseError("price: %v", err)
+		}
+		L.Push(lua.LNumber(price))
+		return 1
+	}))
+
+	L.SetField(api, "history", L.NewFunction(func(L *lua.LState) int {
+		prices, err := env.PriceHistory(L.Context(), uint(L.CheckInt(1)), L.OptInt(2, 30))
+		if err != nil {
+			L.RaiseError("history: %v", err)
+		}
+		table := L.CreateTable(len(prices), 0)
+		for _, p := range prices {
+			table.Append(lua.LNumber(p))
+		}
+		L.Push(table)
+		return 1
+	}))
+
+	L.SetField(api, "popularity", L.NewFunction(func(L *lua.LState) int {
+		score, err := env.Popularity(L.Context(), uint(L.CheckInt(1)))
+		if err != nil {
+			L.RaiseError("popularity: %v", err)
+		}
+		L.Push(lua.LNumber(score))
+		return 1
+	}))
+
+	L.SetField(api, "thin_ask_wall", L.NewFunction(func(L *lua.LState) int {
+		wall, err := env.ThinAskWall(L.Context(), uint(L.CheckInt(1)), float64(L.OptNumber(2, 0.05)), L.OptInt(3, 5))
+		if errors.Is(err, depth.ErrNoSnapshot) || errors.Is(err, depth.ErrStaleSnapshot) {
+			// 没有可用的深度数据时不产生信号
+			L.Push(lua.LFalse)
+			L.Push(lua.LNumber(0))
+			L.Push(lua.LNumber(0))
+			return 3
+		}
+		if err != nil {
+			L.RaiseError("thin_ask_wall: %v", err)
+		}
+		L.Push(lua.LBool(wall.Thin))
+		L.Push(lua.LNumber(wall.Quantity))
+		L.Push(lua.LNumber(wall.Cost))
+		return 3
+	}))
+
+	L.SetField(api, "inventory", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LNumber(env.InventoryQuantity(L.Context(), uint(L.CheckInt(1)))))
+		return 1
+	}))
+
+	L.SetField(api, "buy", L.NewFunction(func(L *lua.LState) int {
+		order, err := env.Buy(uint(L.CheckInt(1)), float64(L.CheckNumber(2)), L.CheckInt(3), L.OptString(4, "buff"))
+		if err != nil {
+			L.RaiseError("buy: %v", err)
+		}
+		L.Push(lua.LNumber(order.ID))
+		return 1
+	}))
+
+	L.SetField(api, "sell", L.NewFunction(func(L *lua.LState) int {
+		order, err := env.Sell(uint(L.CheckInt(1)), float64(L.CheckNumber(2)), L.CheckInt(3), L.OptString(4, "buff"))
+		if err != nil {
+			L.RaiseError("sell: %v", err)
+		}
+		L.Push(lua.LNumber(order.ID))
+		return 1
+	}))
+
+	L.SetField(api, "log", L.NewFunction(func(L *lua.LState) int {
+		// 试运行时脚本日志作为决策理由返回
+		if env.DryRun() {
+			env.Explain("%s", L.CheckString(1))
+			return 0
+		}
+		logrus.WithField("strategy_id", env.Strategy.ID).Info(L.CheckString(1))
+		return 0
+	}))
+
+	return api
+}
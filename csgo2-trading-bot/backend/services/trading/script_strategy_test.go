@@ -0,0 +1,98 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startScript(t *testing.T, script string) *scriptRunner {
+	t.Helper()
+	r := &scriptRunner{}
+	if err := r.Init(context.Background(), &StrategyEnv{Config: map[string]interface{}{"script": script}}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	t.Cleanup(func() { r.Stop(context.Background(), nil) })
+	return r
+}
+
+func tickScript(r *scriptRunner) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return r.Tick(ctx, &StrategyEnv{Config: map[string]interface{}{}})
+}
+
+// withScriptMemoryLimit 测试期间使用较小的内存上限，不必真的分配数百MB
+func withScriptMemoryLimit(t *testing.T, limit int64) {
+	old := luaMemoryLimit
+	luaMemoryLimit = limit
+	t.Cleanup(func() { luaMemoryLimit = old })
+}
+
+func TestScriptRunawayTableIsRejected(t *testing.T) {
+	withScriptMemoryLimit(t, 32<<20)
+	r := startScript(t, `
+		hoard = {}
+		function tick()
+			local i = 0
+			while true do
+				i = i + 1
+				hoard[i] = {i, i, i}
+			end
+		end`)
+
+	if err := tickScript(r); !errors.Is(err, errScriptMemory) {
+		t.Fatalf("runaway table growth returned %v, want %v", err, errScriptMemory)
+	}
+	// 虚拟机已关闭，之后的执行不再运行脚本
+	if err := tickScript(r); !errors.Is(err, errScriptMemory) {
+		t.Fatalf("tick after the memory limit returned %v, want %v", err, errScriptMemory)
+	}
+}
+
+func TestScriptRunawayTableAtLoadIsRejected(t *testing.T) {
+	withScriptMemoryLimit(t, 32<<20)
+	r := &scriptRunner{}
+	err := r.Init(context.Background(), &StrategyEnv{Config: map[string]interface{}{"script": `
+		local t = {}
+		for i = 1, 1e9 do t[i] = {i} end
+		function tick() end`}})
+	if !errors.Is(err, errScriptMemory) {
+		t.Fatalf("runaway script body returned %v, want %v", err, errScriptMemory)
+	}
+}
+
+func TestScriptStringRepIsCapped(t *testing.T) {
+	for _, call := range []string{`string.rep("x", 1e9)`, `("x"):rep(1e9)`} {
+		r := startScript(t, "function tick() local s = "+call+" end")
+		err := tickScript(r)
+		if err == nil || !strings.Contains(err.Error(), "string.rep") {
+			t.Fatalf("%s returned %v, want a string.rep limit error", call, err)
+		}
+	}
+
+	r := startScript(t, `function tick() assert(#string.rep("ab", 10) == 20) end`)
+	if err := tickScript(r); err != nil {
+		t.Fatalf("small string.rep failed: %v", err)
+	}
+}
+
+func TestScriptSandboxGlobals(t *testing.T) {
+	for _, name := range []string{"print", "load", "dofile", "require"} {
+		r := startScript(t, "function tick() assert("+name+" == nil, '"+name+" is available') end")
+		if err := tickScript(r); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestScriptDeepRecursionFails(t *testing.T) {
+	r := startScript(t, `
+		local function f(n) return f(n + 1) + 1 end
+		function tick() f(1) end`)
+	if err := tickScript(r); err == nil {
+		t.Fatal("unbounded recursion did not fail")
+	}
+}
@@ -0,0 +1,302 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrSlicedOrderNotFound 母单不存在或不属于当前用户
+var ErrSlicedOrderNotFound = errors.New("sliced order not found")
+
+// 拆单执行方式
+const (
+	SliceTWAP    = "twap"    // 在时间窗口内均匀分批
+	SliceIceberg = "iceberg" // 每次只挂出一小部分，成交后再挂下一片
+)
+
+// SlicedOrderRequest 创建拆单时提交的参数
+type SlicedOrderRequest struct {
+	ItemID    uint    `json:"item_id" binding:"required"`
+	Type      string  `json:"type" binding:"required"`
+	Price     float64 `json:"price" binding:"required,min=0"`
+	Quantity  int     `json:"quantity" binding:"required,min=2"`
+	Platform  string  `json:"platform" binding:"required"`
+	Mode      string  `json:"mode" binding:"required"`
+	Window    int     `json:"window"`     // twap：执行窗口（秒）
+	Slices    int     `json:"slices"`     // twap：分片数，默认每片约1件、不超过20片
+	SliceSize int     `json:"slice_size"` // iceberg：每次挂出的数量
+	Jitter    float64 `json:"jitter"`     // 分片数量和间隔的随机浮动比例，0~0.5
+}
+
+// CreateSlicedOrder 创建母单，按整单数量做一次余额/库存和风控检查，子订单由定时任务分批提交
+func (s *Service) CreateSlicedOrder(userID uint, req SlicedOrderRequest) (*models.SlicedOrder, error) {
+	if req.Type != "buy" && req.Type != "sell" {
+		return nil, errors.New("type must be buy or sell")
+	}
+	if req.Jitter < 0 || req.Jitter > 0.5 {
+		return nil, errors.New("jitter must be between 0 and 0.5")
+	}
+
+	switch req.Mode {
+	case SliceTWAP:
+		if req.Window < 60 {
+			return nil, errors.New("window must be at least 60 seconds")
+		}
+		if req.Slices <= 0 {
+			req.Slices = req.Quantity
+			if req.Slices > 20 {
+				req.Slices = 20
+			}
+		}
+		if req.Slices < 2 || req.Slices > req.Quantity {
+			return nil, fmt.Errorf("slices must be between 2 and %d", req.Quantity)
+		}
+		req.SliceSize = 0
+	case SliceIceberg:
+		if req.SliceSize <= 0 || req.SliceSize >= req.Quantity {
+			return nil, errors.New("slice_size must be positive and less than quantity")
+		}
+		req.Window, req.Slices = 0, 0
+	default:
+		return nil, fmt.Errorf("mode must be %s or %s", SliceTWAP, SliceIceberg)
+	}
+
+	total := &models.Order{
+		UserID:   userID,
+		ItemID:   req.ItemID,
+		Type:     req.Type,
+		Price:    req.Price,
+		Quantity: req.Quantity,
+		Platform: req.Platform,
+	}
+	if req.Type == "buy" {
+		if !s.checkUserBalance(s.db, userID, req.Platform, req.Price*float64(req.Quantity), 0) {
+			return nil, errors.New("insufficient balance")
+		}
+	} else if !s.checkInventory(userID, req.ItemID, req.Quantity) {
+		return nil, errors.New("insufficient inventory")
+	}
+	if err := s.checkRisk(total); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	parent := &models.SlicedOrder{
+		UserID:      userID,
+		ItemID:      req.ItemID,
+		Type:        req.Type,
+		Mode:        req.Mode,
+		Price:       req.Price,
+		Quantity:    req.Quantity,
+		Platform:    req.Platform,
+		Window:      req.Window,
+		Slices:      req.Slices,
+		SliceSize:   req.SliceSize,
+		Jitter:      req.Jitter,
+		Status:      "active",
+		NextSliceAt: &now,
+	}
+	if err := s.db.Create(parent).Error; err != nil {
+		return nil, err
+	}
+	return parent, nil
+}
+
+// GetSlicedOrders 用户的母单
+func (s *Service) GetSlicedOrders(userID uint) ([]models.SlicedOrder, error) {
+	var parents []models.SlicedOrder
+	err := s.db.Preload("Item").Where("user_id = ?", userID).Order("created_at DESC").Find(&parents).Error
+	return parents, err
+}
+
+// GetSlicedOrder 母单及其全部子订单
+func (s *Service) GetSlicedOrder(userID, id uint) (*models.SlicedOrder, error) {
+	var parent models.SlicedOrder
+	err := s.db.Preload("Item").Preload("Orders", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("id = ? AND user_id = ?", id, userID).First(&parent).Error
+	if err != nil {
+		return nil, ErrSlicedOrderNotFound
+	}
+	return &parent, nil
+}
+
+// CancelSlicedOrder 停止提交新的子订单并取消未成交的子订单，已成交部分保留
+func (s *Service) CancelSlicedOrder(userID, id uint) error {
+	var parent models.SlicedOrder
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&parent).Error; err != nil {
+		return ErrSlicedOrderNotFound
+	}
+
+	now := time.Now()
+	result := s.db.Model(&parent).Where("status = ?", "active").
+		Updates(map[string]interface{}{"status": "cancelled", "finished_at": now, "next_slice_at": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("sliced order cannot be cancelled")
+	}
+
+	var pending []models.Order
+	s.db.Select("id").Where("parent_id = ? AND status = ?", parent.ID, "pending").Find(&pending)
+	for _, child := range pending {
+		if err := s.CancelOrder(child.ID, userID, 0); err != nil {
+			logrus.Warnf("Failed to cancel slice %d of sliced order %d: %v", child.ID, parent.ID, err)
+		}
+	}
+	return nil
+}
+
+// RunSlicedOrders 注册拆单执行任务
+func (s *Service) RunSlicedOrders(interval time.Duration) error {
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "sliced_orders",
+		Spec: interval.String(),
+		Run:  s.advanceSlicedOrders,
+	})
+}
+
+func (s *Service) advanceSlicedOrders() {
+	var parents []models.SlicedOrder
+	if err := s.db.Where("status = ?", "active").Find(&parents).Error; err != nil {
+		logrus.Errorf("Failed to load sliced orders: %v", err)
+		return
+	}
+	for i := range parents {
+		if err := s.advanceSlicedOrder(&parents[i]); err != nil {
+			logrus.Errorf("Failed to advance sliced order %d: %v", parents[i].ID, err)
+		}
+	}
+}
+
+// sliceProgress 子订单的汇总
+type sliceProgress struct {
+	Filled    int
+	Amount    float64
+	Completed int // 已成交的子订单数
+	Pending   int
+}
+
+// advanceSlicedOrder 汇总子订单进度，没有未成交的子订单且到了下一片的时间时提交下一片
+func (s *Service) advanceSlicedOrder(parent *models.SlicedOrder) error {
+	var progress sliceProgress
+	err := s.db.Model(&models.Order{}).Where("parent_id = ?", parent.ID).
+		Select(`COALESCE(SUM(quantity) FILTER (WHERE status = 'completed'), 0) AS filled,
+			COALESCE(SUM(quantity * price) FILTER (WHERE status = 'completed'), 0) AS amount,
+			COUNT(*) FILTER (WHERE status = 'completed') AS completed,
+			COUNT(*) FILTER (WHERE status = 'pending') AS pending`).
+		Scan(&progress).Error
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"filled_quantity": progress.Filled, "filled_amount": progress.Amount}
+	now := time.Now()
+	remaining := parent.Quantity - progress.Filled
+
+	switch {
+	case remaining <= 0:
+		updates["status"], updates["finished_at"], updates["next_slice_at"] = "completed", now, nil
+	case progress.Pending > 0 || (parent.NextSliceAt != nil && now.Before(*parent.NextSliceAt)):
+		// 等待当前子订单结束或下一片的时间
+	case s.consecutiveSliceFailures(parent.ID) >= s.maxSliceFailures():
+		updates["status"], updates["finished_at"], updates["next_slice_at"] = "failed", now, nil
+		updates["failed_reason"] = "too many failed slices"
+	default:
+		size := s.nextSliceSize(parent, remaining, progress.Completed)
+		if err := s.submitSlice(parent, size); err != nil {
+			// 风控拒单等错误在下次检查时大概率仍会发生，直接放弃母单
+			updates["status"], updates["finished_at"], updates["next_slice_at"] = "failed", now, nil
+			updates["failed_reason"] = err.Error()
+			break
+		}
+		updates["next_slice_at"] = now.Add(s.nextSliceDelay(parent))
+	}
+
+	return s.db.Model(parent).Where("status = ?", "active").Updates(updates).Error
+}
+
+// submitSlice 以母单的价格和平台提交一个子订单
+func (s *Service) submitSlice(parent *models.SlicedOrder, quantity int) error {
+	order := &models.Order{
+		UserID:   parent.UserID,
+		ItemID:   parent.ItemID,
+		Type:     parent.Type,
+		Price:    parent.Price,
+		Quantity: quantity,
+		Platform: parent.Platform,
+		ParentID: &parent.ID,
+	}
+	if parent.Type == "sell" {
+		return s.submitSellOrder(order, nil)
+	}
+	return s.submitBuyOrder(order)
+}
+
+// nextSliceSize TWAP把剩余数量平均分到剩余的分片上，冰山使用固定的显示数量，两者都按Jitter随机浮动
+func (s *Service) nextSliceSize(parent *models.SlicedOrder, remaining, completed int) int {
+	base := float64(parent.SliceSize)
+	if parent.Mode == SliceTWAP {
+		slicesLeft := parent.Slices - completed
+		if slicesLeft < 1 {
+			slicesLeft = 1
+		}
+		base = float64(remaining) / float64(slicesLeft)
+	}
+
+	size := int(math.Round(base * jitter(parent.Jitter)))
+	if size < 1 {
+		size = 1
+	}
+	if size > remaining {
+		size = remaining
+	}
+	return size
+}
+
+// nextSliceDelay TWAP按窗口平分间隔；冰山在子订单成交后尽快挂出下一片，只加入少量随机延迟
+func (s *Service) nextSliceDelay(parent *models.SlicedOrder) time.Duration {
+	if parent.Mode == SliceTWAP {
+		interval := float64(parent.Window) / float64(parent.Slices)
+		return time.Duration(interval*jitter(parent.Jitter)) * time.Second
+	}
+	return time.Duration(rand.Float64()*parent.Jitter*float64(s.config.SlicedOrders.Interval)) * time.Second
+}
+
+// consecutiveSliceFailures 最近连续失败或过期的子订单数
+func (s *Service) consecutiveSliceFailures(parentID uint) int {
+	var statuses []string
+	s.db.Model(&models.Order{}).Where("parent_id = ?", parentID).
+		Order("id DESC").Limit(s.maxSliceFailures()).Pluck("status", &statuses)
+
+	failures := 0
+	for _, status := range statuses {
+		if status != "failed" && status != "expired" {
+			break
+		}
+		failures++
+	}
+	return failures
+}
+
+func (s *Service) maxSliceFailures() int {
+	if s.config.SlicedOrders.MaxFailures <= 0 {
+		return 3
+	}
+	return s.config.SlicedOrders.MaxFailures
+}
+
+// jitter 返回 [1-j, 1+j] 范围内的随机系数
+func jitter(j float64) float64 {
+	return 1 + (rand.Float64()*2-1)*j
+}
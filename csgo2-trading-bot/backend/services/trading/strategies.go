@@ -0,0 +1,245 @@
+package trading
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/webhooks"
+
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterStrategy("grid", func() StrategyRunner { return &gridRunner{} })
+	RegisterStrategy("arbitrage", func() StrategyRunner { return &arbitrageRunner{} })
+	RegisterStrategy("trend_following", func() StrategyRunner { return &trendFollowingRunner{} })
+	RegisterStrategy("mean_reversion", func() StrategyRunner { return &meanReversionRunner{} })
+}
+
+// gridRunner 网格策略
+type gridRunner struct {
+	itemID    uint
+	minPrice  float64
+	maxPrice  float64
+	gridCount int
+	platform  string
+
+	state gridState
+}
+
+// gridState 网格策略的运行时状态，随快照保存
+type gridState struct {
+	Level      int         `json:"level"`
+	HasLevel   bool        `json:"has_level"`
+	OpenOrders []gridOrder `json:"open_orders"`
+}
+
+// gridOrder 网格挂出且尚未成交的订单
+type gridOrder struct {
+	OrderID uint   `json:"order_id"`
+	Level   int    `json:"level"`
+	Type    string `json:"type"`
+}
+
+func (r *gridRunner) Init(ctx context.Context, env *StrategyEnv) error {
+	// 获取价格区间和网格数量
+	r.itemID = uint(toFloat(env.Config["item_id"]))
+	r.minPrice = toFloat(env.Config["min_price"])
+	r.maxPrice = toFloat(env.Config["max_price"])
+	r.gridCount = int(toFloat(env.Config["grid_count"]))
+	if r.itemID == 0 || r.gridCount <= 0 || r.maxPrice <= r.minPrice {
+		return errors.New("grid strategy requires item_id, grid_count and max_price > min_price")
+	}
+
+	r.platform, _ = env.Config["platform"].(string)
+	if r.platform == "" {
+		r.platform = "buff"
+	}
+	return nil
+}
+
+func (r *gridRunner) Tick(ctx context.Context, env *StrategyEnv) error {
+	r.pruneOrders(ctx, env)
+
+	price, err := env.CurrentPrice(ctx, r.itemID)
+	if err != nil {
+		return err
+	}
+	if price < r.minPrice || price > r.maxPrice {
+		env.Explain("price %.2f is outside grid range [%.2f, %.2f]", price, r.minPrice, r.maxPrice)
+		return nil
+	}
+
+	// 计算当前价格所在的网格
+	gridSize := (r.maxPrice - r.minPrice) / float64(r.gridCount)
+	level := int((price - r.minPrice) / gridSize)
+	env.Explain("price %.2f is at grid level %d of %d (grid size %.2f)", price, level, r.gridCount, gridSize)
+
+	// 价格跨越网格时才交易：下穿买入，上穿卖出
+	lastLevel, hasLevel := r.state.Level, r.state.HasLevel
+	r.state.Level, r.state.HasLevel = level, true
+	if !hasLevel {
+		env.Explain("no previous grid level recorded, waiting for the next tick")
+		return nil
+	}
+	if level == lastLevel {
+		env.Explain("grid level unchanged since last tick")
+		return nil
+	}
+
+	var order *models.Order
+	if level < lastLevel {
+		env.Explain("price crossed down from level %d to %d, buying 1", lastLevel, level)
+		order, err = env.Buy(r.itemID, price, 1, r.platform)
+	} else if env.HasInventory(r.itemID, 1) {
+		env.Explain("price crossed up from level %d to %d, selling 1", lastLevel, level)
+		order, err = env.Sell(r.itemID, price, 1, r.platform)
+	} else {
+		env.Explain("price crossed up from level %d to %d but no inventory to sell", lastLevel, level)
+	}
+	if order != nil && order.ID > 0 && order.Status == "pending" {
+		r.state.OpenOrders = append(r.state.OpenOrders, gridOrder{OrderID: order.ID, Level: level, Type: order.Type})
+	}
+	return err
+}
+
+// Stop 撤销网格仍未成交的挂单
+func (r *gridRunner) Stop(ctx context.Context, env *StrategyEnv) error {
+	if env.DryRun() {
+		return nil
+	}
+	r.pruneOrders(ctx, env)
+	for _, o := range r.state.OpenOrders {
+		if err := env.service.CancelOrder(o.OrderID, env.Strategy.UserID, 0); err != nil {
+			logrus.Warnf("Grid strategy %d failed to cancel order %d: %v", env.Strategy.ID, o.OrderID, err)
+		}
+	}
+	r.state.OpenOrders = nil
+	return nil
+}
+
+func (r *gridRunner) Snapshot() ([]byte, error) {
+	return json.Marshal(r.state)
+}
+
+func (r *gridRunner) Restore(ctx context.Context, env *StrategyEnv, data []byte) error {
+	var state gridState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	r.state = state
+	r.pruneOrders(ctx, env)
+	return nil
+}
+
+// pruneOrders 移除已成交、失败或被撤销的订单
+func (r *gridRunner) pruneOrders(ctx context.Context, env *StrategyEnv) {
+	if len(r.state.OpenOrders) == 0 {
+		return
+	}
+
+	ids := make([]uint, 0, len(r.state.OpenOrders))
+	for _, o := range r.state.OpenOrders {
+		ids = append(ids, o.OrderID)
+	}
+	var pending []uint
+	err := env.service.db.WithContext(ctx).Model(&models.Order{}).
+		Where("id IN ? AND status = ?", ids, "pending").
+		Pluck("id", &pending).Error
+	if err != nil {
+		return
+	}
+
+	open := make(map[uint]bool, len(pending))
+	for _, id := range pending {
+		open[id] = true
+	}
+	kept := r.state.OpenOrders[:0]
+	for _, o := range r.state.OpenOrders {
+		if open[o.OrderID] {
+			kept = append(kept, o)
+		}
+	}
+	r.state.OpenOrders = kept
+}
+
+// arbitrageRunner 套利策略，目前只发现机会并推送提醒，不自动下单
+type arbitrageRunner struct {
+	itemID    uint
+	minSpread float64 // 触发提醒的最低净收益率（%），扣除两边手续费和提现费
+
+	open bool // 上次检查时价差已满足条件，价差回落后才会再次提醒
+}
+
+func (r *arbitrageRunner) Init(ctx context.Context, env *StrategyEnv) error {
+	r.itemID = uint(toFloat(env.Config["item_id"]))
+	if r.itemID == 0 {
+		return errors.New("arbitrage strategy requires item_id")
+	}
+	r.minSpread = toFloat(env.Config["min_spread"])
+	if r.minSpread <= 0 {
+		r.minSpread = 5
+	}
+	return nil
+}
+
+func (r *arbitrageRunner) Tick(ctx context.Context, env *StrategyEnv) error {
+	// 比较不同平台的价格差异，寻找套利机会
+	prices, err := env.PlatformPrices(ctx, r.itemID)
+	if err != nil {
+		return err
+	}
+
+	o := env.service.arbitrage(r.itemID, prices)
+	if o == nil {
+		r.open = false
+		return nil
+	}
+
+	met := o.Profit > 0 && o.ProfitPercent >= r.minSpread
+	if met && !r.open {
+		env.Explain("net profit %.2f%% buying on %s (%.2f) and selling on %s (%.2f), spread %.2f%%",
+			o.ProfitPercent, o.BuyPlatform, o.BuyPrice, o.SellPlatform, o.SellPrice, o.SpreadPercent)
+		env.Alert(webhooks.EventArbitrageAlert, map[string]interface{}{
+			"item_id":        r.itemID,
+			"buy_platform":   o.BuyPlatform,
+			"buy_price":      o.BuyPrice,
+			"sell_platform":  o.SellPlatform,
+			"sell_price":     o.SellPrice,
+			"spread_percent": o.SpreadPercent,
+			"fees":           o.BuyFee + o.SellFee + o.WithdrawalFee,
+			"profit":         o.Profit,
+			"profit_percent": o.ProfitPercent,
+		})
+	}
+	r.open = met
+	return nil
+}
+
+func (r *arbitrageRunner) Stop(ctx context.Context, env *StrategyEnv) error { return nil }
+
+// trendFollowingRunner 趋势跟踪策略
+type trendFollowingRunner struct{}
+
+func (r *trendFollowingRunner) Init(ctx context.Context, env *StrategyEnv) error { return nil }
+
+func (r *trendFollowingRunner) Tick(ctx context.Context, env *StrategyEnv) error {
+	// 根据移动平均线等指标判断趋势
+	return nil
+}
+
+func (r *trendFollowingRunner) Stop(ctx context.Context, env *StrategyEnv) error { return nil }
+
+// meanReversionRunner 均值回归策略
+type meanReversionRunner struct{}
+
+func (r *meanReversionRunner) Init(ctx context.Context, env *StrategyEnv) error { return nil }
+
+func (r *meanReversionRunner) Tick(ctx context.Context, env *StrategyEnv) error {
+	// 当价格偏离均值时进行交易
+	return nil
+}
+
+func (r *meanReversionRunner) Stop(ctx context.Context, env *StrategyEnv) error { return nil }
@@ -0,0 +1,341 @@
+package trading
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 策略复查发现的问题
+const (
+	FindingIdle   = "idle"   // 长时间没有成交
+	FindingLosing = "losing" // 近期已实现收益为负
+)
+
+// 调整建议的类型
+const (
+	SuggestRecenterGrid   = "recenter_grid"    // 当前价格在网格区间外，移动区间
+	SuggestDenserGrid     = "denser_grid"      // 价格在区间内但不跨越网格，增加网格数
+	SuggestWidenGrid      = "widen_grid"       // 网格间距小于手续费，减少网格数
+	SuggestLowerMinSpread = "lower_min_spread" // 套利阈值高于近期价差
+	SuggestSwitchItem     = "switch_item"      // 换成同类型中流动性更好的物品
+	SuggestReview         = "review"           // 没有可自动给出的参数，提醒用户检查
+)
+
+// reviewStrategy 复查时读取的策略近况
+type reviewStrategy struct {
+	strategy   *models.Strategy
+	config     map[string]interface{}
+	item       *models.Item // 策略未配置物品时为空
+	lastTrade  time.Time    // 最近一次成交，从未成交时为激活（最近修改）时间
+	realized   float64      // 复查窗口内卖出的已实现收益
+	sells      int64
+	finding    string
+	lossWindow int
+}
+
+// ReviewStrategies 注册策略复查任务：找出长时间未成交或持续亏损的激活策略，按近期行情生成调整建议并通知策略所有者
+func (s *Service) ReviewStrategies(interval time.Duration) error {
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "strategy_review",
+		Spec: interval.String(),
+		Run: func() {
+			if n, err := s.reviewStrategies(); err != nil {
+				logrus.Errorf("Strategy review failed: %v", err)
+			} else if n > 0 {
+				logrus.Infof("Suggested adjustments for %d strategies", n)
+			}
+		},
+	})
+}
+
+// GetStrategySuggestions 策略最近的调整建议，最新的在前
+func (s *Service) GetStrategySuggestions(strategyID, userID uint) ([]models.StrategySuggestion, error) {
+	if _, err := s.GetStrategy(strategyID, userID); err != nil {
+		return nil, err
+	}
+	var suggestions []models.StrategySuggestion
+	err := s.db.Where("strategy_id = ?", strategyID).Order("id DESC").Limit(50).Find(&suggestions).Error
+	return suggestions, err
+}
+
+// reviewStrategies 复查全部激活的策略，返回生成了建议的策略数
+func (s *Service) reviewStrategies() (int, error) {
+	var strategies []models.Strategy
+	if err := s.db.Where("status = ? AND experiment_id IS NULL", "active").Find(&strategies).Error; err != nil {
+		return 0, err
+	}
+
+	reviewed := 0
+	for i := range strategies {
+		review, err := s.loadReview(&strategies[i])
+		if err != nil {
+			logrus.Errorf("Failed to review strategy %d: %v", strategies[i].ID, err)
+			continue
+		}
+		if review.finding == "" || s.recentlySuggested(review.strategy.ID) {
+			continue
+		}
+
+		suggestions := s.suggest(review)
+		if len(suggestions) == 0 {
+			continue
+		}
+		if err := s.db.Create(&suggestions).Error; err != nil {
+			logrus.Errorf("Failed to save suggestions for strategy %d: %v", review.strategy.ID, err)
+			continue
+		}
+		s.publishSuggestions(review, suggestions)
+		reviewed++
+	}
+	return reviewed, nil
+}
+
+func (s *Service) loadReview(strategy *models.Strategy) (*reviewStrategy, error) {
+	cfg := s.config.StrategyReview
+	review := &reviewStrategy{
+		strategy:   strategy,
+		config:     make(map[string]interface{}),
+		lastTrade:  strategy.UpdatedAt,
+		lossWindow: cfg.LossDays,
+	}
+	if strategy.Config != "" {
+		json.Unmarshal([]byte(strategy.Config), &review.config)
+	}
+	if itemID := uint(toFloat(review.config["item_id"])); itemID > 0 {
+		var item models.Item
+		if err := s.db.First(&item, itemID).Error; err == nil {
+			review.item = &item
+		}
+	}
+
+	var last *time.Time
+	err := s.db.Model(&models.Transaction{}).
+		Joins("JOIN orders ON orders.id = transactions.order_id").
+		Where("orders.strategy_id = ?", strategy.ID).
+		Select("MAX(transactions.completed_at)").Scan(&last).Error
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && last.After(review.lastTrade) {
+		review.lastTrade = *last
+	}
+
+	var result struct {
+		Realized float64
+		Sells    int64
+	}
+	err = s.db.Model(&models.Transaction{}).
+		Joins("JOIN orders ON orders.id = transactions.order_id").
+		Where("orders.strategy_id = ? AND transactions.type = ? AND transactions.completed_at >= ?",
+			strategy.ID, "sell", time.Now().AddDate(0, 0, -cfg.LossDays)).
+		Select("COALESCE(SUM(transactions.profit), 0) AS realized, COUNT(*) AS sells").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	review.realized, review.sells = result.Realized, result.Sells
+
+	switch {
+	case review.sells >= int64(cfg.MinSells) && review.realized < 0:
+		review.finding = FindingLosing
+	case time.Since(review.lastTrade) >= time.Duration(cfg.IdleDays)*24*time.Hour:
+		review.finding = FindingIdle
+	}
+	return review, nil
+}
+
+// recentlySuggested 冷却期内已经给出过建议的策略不再重复通知
+func (s *Service) recentlySuggested(strategyID uint) bool {
+	var count int64
+	s.db.Model(&models.StrategySuggestion{}).
+		Where("strategy_id = ? AND created_at >= ?", strategyID, time.Now().AddDate(0, 0, -s.config.StrategyReview.CooldownDays)).
+		Count(&count)
+	return count > 0
+}
+
+// suggest 按策略类型和物品近期行情生成建议，Changes可以直接作为修改策略的请求体
+func (s *Service) suggest(review *reviewStrategy) []models.StrategySuggestion {
+	var suggestions []models.StrategySuggestion
+	add := func(action, reason string, changes map[string]interface{}) {
+		encoded := "{}"
+		if changes != nil {
+			b, _ := json.Marshal(changes)
+			encoded = string(b)
+		}
+		suggestions = append(suggestions, models.StrategySuggestion{
+			StrategyID: review.strategy.ID,
+			UserID:     review.strategy.UserID,
+			Finding:    review.finding,
+			Action:     action,
+			Reason:     reason,
+			Changes:    encoded,
+		})
+	}
+
+	switch review.strategy.Type {
+	case "grid":
+		s.suggestGrid(review, add)
+	case "arbitrage":
+		s.suggestArbitrage(review, add)
+	}
+
+	// 持续亏损或物品本身缺少成交时建议换物品
+	if review.item != nil && (review.finding == FindingLosing || review.item.Volume24h == 0) {
+		s.suggestSwitchItem(review, add)
+	}
+
+	if len(suggestions) == 0 {
+		if review.finding == FindingLosing {
+			add(SuggestReview, fmt.Sprintf("realized %.2f over the last %d days across %d sells", review.realized, review.lossWindow, review.sells), nil)
+		} else {
+			add(SuggestReview, fmt.Sprintf("no trades since %s", review.lastTrade.Format("2006-01-02")), nil)
+		}
+	}
+	return suggestions
+}
+
+func (s *Service) suggestGrid(review *reviewStrategy, add func(string, string, map[string]interface{})) {
+	item := review.item
+	minPrice, maxPrice := toFloat(review.config["min_price"]), toFloat(review.config["max_price"])
+	gridCount := int(toFloat(review.config["grid_count"]))
+	if item == nil || item.CurrentPrice <= 0 || gridCount <= 0 || maxPrice <= minPrice {
+		return
+	}
+	price := item.CurrentPrice
+	platform, _ := review.config["platform"].(string)
+	if platform == "" {
+		platform = "buff"
+	}
+
+	if price < minPrice || price > maxPrice {
+		// 保持区间宽度，以当前价格和7日均价为中心
+		center := price
+		if item.AvgPrice7Days > 0 {
+			center = (price + item.AvgPrice7Days) / 2
+		}
+		half := (maxPrice - minPrice) / 2
+		changes := gridChanges(review.config, math.Max(center-half, 0.01), center+half, gridCount)
+		add(SuggestRecenterGrid, fmt.Sprintf("price %.2f is outside the grid range [%.2f, %.2f]", price, minPrice, maxPrice), changes)
+		return
+	}
+
+	// 每格的价差至少要覆盖一次买卖的手续费
+	spacing := (maxPrice - minPrice) / float64(gridCount)
+	minSpacing := s.SellFee(platform, price) * 2
+	if minSpacing > 0 && spacing < minSpacing {
+		count := max(int((maxPrice-minPrice)/minSpacing), 1)
+		add(SuggestWidenGrid, fmt.Sprintf("grid spacing %.2f does not cover fees of %.2f per round trip", spacing, minSpacing),
+			gridChanges(review.config, minPrice, maxPrice, count))
+		return
+	}
+
+	if review.finding == FindingIdle {
+		// 近期波动小于网格间距时价格不会跨越网格
+		if item.AvgPrice7Days > 0 && math.Abs(price-item.AvgPrice7Days) < spacing {
+			count := gridCount * 2
+			if minSpacing > 0 {
+				count = min(count, max(int((maxPrice-minPrice)/minSpacing), gridCount))
+			}
+			if count > gridCount {
+				add(SuggestDenserGrid, fmt.Sprintf("price moved %.2f from its 7-day average, less than the grid spacing %.2f",
+					math.Abs(price-item.AvgPrice7Days), spacing), gridChanges(review.config, minPrice, maxPrice, count))
+			}
+		}
+	}
+}
+
+func gridChanges(config map[string]interface{}, minPrice, maxPrice float64, gridCount int) map[string]interface{} {
+	updated := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		updated[k] = v
+	}
+	updated["min_price"] = math.Round(minPrice*100) / 100
+	updated["max_price"] = math.Round(maxPrice*100) / 100
+	updated["grid_count"] = gridCount
+	b, _ := json.Marshal(updated)
+	return map[string]interface{}{"config": string(b)}
+}
+
+func (s *Service) suggestArbitrage(review *reviewStrategy, add func(string, string, map[string]interface{})) {
+	if review.item == nil || review.finding != FindingIdle {
+		return
+	}
+	env := s.newStrategyEnv(review.strategy)
+	prices, err := env.PlatformPrices(context.Background(), review.item.ID)
+	if err != nil || len(prices) < 2 {
+		return
+	}
+	// 阈值按扣除手续费和提现费后的净收益率比较，亏损的价差不建议降低阈值
+	o := s.arbitrage(review.item.ID, prices)
+	if o == nil {
+		return
+	}
+	spread := o.ProfitPercent
+
+	minSpread := toFloat(review.config["min_spread"])
+	if minSpread <= 0 {
+		minSpread = 5
+	}
+	if spread <= 0 || spread >= minSpread {
+		return
+	}
+
+	updated := make(map[string]interface{}, len(review.config))
+	for k, v := range review.config {
+		updated[k] = v
+	}
+	updated["min_spread"] = math.Floor(spread*10) / 10
+	b, _ := json.Marshal(updated)
+	add(SuggestLowerMinSpread, fmt.Sprintf("current cross-platform net profit is %.2f%%, below min_spread %.2f%%", spread, minSpread),
+		map[string]interface{}{"config": string(b)})
+}
+
+// suggestSwitchItem 推荐同类型中24小时成交量最高的物品
+func (s *Service) suggestSwitchItem(review *reviewStrategy, add func(string, string, map[string]interface{})) {
+	item := review.item
+	var candidates []models.Item
+	err := s.db.Where("type = ? AND id <> ? AND volume_24h > ? AND current_price > 0 AND halted_at IS NULL",
+		item.Type, item.ID, item.Volume24h).
+		Order("volume_24h DESC").Limit(1).Find(&candidates).Error
+	if err != nil || len(candidates) == 0 {
+		return
+	}
+	candidate := candidates[0]
+
+	updated := make(map[string]interface{}, len(review.config))
+	for k, v := range review.config {
+		updated[k] = v
+	}
+	updated["item_id"] = candidate.ID
+	if review.strategy.Type == "grid" && item.CurrentPrice > 0 {
+		// 网格区间按新物品的价格等比缩放
+		ratio := candidate.CurrentPrice / item.CurrentPrice
+		updated["min_price"] = math.Round(toFloat(review.config["min_price"])*ratio*100) / 100
+		updated["max_price"] = math.Round(toFloat(review.config["max_price"])*ratio*100) / 100
+	}
+	b, _ := json.Marshal(updated)
+	add(SuggestSwitchItem, fmt.Sprintf("%s trades %d per day, %s trades %d", item.Name, item.Volume24h, candidate.Name, candidate.Volume24h),
+		map[string]interface{}{"config": string(b)})
+}
+
+// publishSuggestions 通知策略所有者
+func (s *Service) publishSuggestions(review *reviewStrategy, suggestions []models.StrategySuggestion) {
+	s.notifier.Publish(review.strategy.UserID, notify.Message{Event: notify.EventStrategySuggestion, Data: map[string]interface{}{
+		"strategy_id":   review.strategy.ID,
+		"strategy_name": review.strategy.Name,
+		"strategy_type": review.strategy.Type,
+		"finding":       review.finding,
+		"last_trade_at": review.lastTrade,
+		"realized":      review.realized,
+		"suggestions":   suggestions,
+	}})
+}
@@ -0,0 +1,370 @@
+package trading
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/depth"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/webhooks"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StrategyRunner 策略执行器接口，新的策略类型实现该接口并注册即可
+type StrategyRunner interface {
+	// Init 策略激活（或服务重启后首次运行）时调用
+	Init(ctx context.Context, env *StrategyEnv) error
+	// Tick 每个调度周期调用一次
+	Tick(ctx context.Context, env *StrategyEnv) error
+	// Stop 策略停用或删除时调用
+	Stop(ctx context.Context, env *StrategyEnv) error
+}
+
+// RunnerFactory 为每个策略实例创建独立的执行器
+type RunnerFactory func() StrategyRunner
+
+var (
+	runnerRegistryMu sync.RWMutex
+	runnerRegistry   = make(map[string]RunnerFactory)
+)
+
+// RegisterStrategy 注册策略类型
+func RegisterStrategy(strategyType string, factory RunnerFactory) {
+	runnerRegistryMu.Lock()
+	defer runnerRegistryMu.Unlock()
+
+	runnerRegistry[strategyType] = factory
+}
+
+// StrategyTypes 返回已注册的策略类型
+func StrategyTypes() []string {
+	runnerRegistryMu.RLock()
+	defer runnerRegistryMu.RUnlock()
+
+	types := make([]string, 0, len(runnerRegistry))
+	for t := range runnerRegistry {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func newRunner(strategyType string) (StrategyRunner, error) {
+	runnerRegistryMu.RLock()
+	factory, ok := runnerRegistry[strategyType]
+	runnerRegistryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy type: %s", strategyType)
+	}
+	return factory(), nil
+}
+
+// StrategyEnv 策略运行环境，向执行器暴露行情、库存和下单能力
+type StrategyEnv struct {
+	Strategy *models.Strategy
+	Config   map[string]interface{}
+	service  *Service
+
+	evaluation *Evaluation // 试运行时不为空，下单被替换为记录信号
+}
+
+func (s *Service) newStrategyEnv(strategy *models.Strategy) *StrategyEnv {
+	config := make(map[string]interface{})
+	if strategy.Config != "" {
+		json.Unmarshal([]byte(strategy.Config), &config)
+	}
+
+	return &StrategyEnv{
+		Strategy: strategy,
+		Config:   config,
+		service:  s,
+	}
+}
+
+// CurrentPrice 获取物品当前价格
+func (e *StrategyEnv) CurrentPrice(ctx context.Context, itemID uint) (float64, error) {
+	var item models.Item
+	if err := e.service.db.WithContext(ctx).Select("current_price").First(&item, itemID).Error; err != nil {
+		return 0, err
+	}
+	return item.CurrentPrice, nil
+}
+
+// PriceHistory 获取最近若干天的价格序列（按时间升序）
+func (e *StrategyEnv) PriceHistory(ctx context.Context, itemID uint, days int) ([]float64, error) {
+	var prices []float64
+	err := e.service.db.WithContext(ctx).Model(&models.PriceHistory{}).
+		Where("item_id = ? AND recorded_at >= ?", itemID, e.service.now().AddDate(0, 0, -days)).
+		Order("recorded_at ASC").
+		Pluck("price", &prices).Error
+	return prices, err
+}
+
+// Popularity 物品社区热度，当日提及数相对前7日日均的倍数
+func (e *StrategyEnv) Popularity(ctx context.Context, itemID uint) (float64, error) {
+	var item models.Item
+	if err := e.service.db.WithContext(ctx).Select("popularity").First(&item, itemID).Error; err != nil {
+		return 0, err
+	}
+	return item.Popularity, nil
+}
+
+// ThinAskWall 按最新的买卖盘快照检测薄卖墙：最低卖价上方pct范围内的卖单不超过maxQty
+func (e *StrategyEnv) ThinAskWall(ctx context.Context, itemID uint, pct float64, maxQty int) (*depth.AskWall, error) {
+	return depth.ThinAskWall(e.service.db.WithContext(ctx), itemID, depth.Platform, pct, maxQty)
+}
+
+// PlatformPrices 物品在各平台的最新价格
+func (e *StrategyEnv) PlatformPrices(ctx context.Context, itemID uint) (map[string]float64, error) {
+	var rows []models.PriceHistory
+	err := e.service.db.WithContext(ctx).Raw(`
+		SELECT DISTINCT ON (platform) platform, price
+		FROM price_histories
+		WHERE item_id = ? AND price > 0 AND deleted_at IS NULL
+		ORDER BY platform, recorded_at DESC`, itemID).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	prices := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		prices[row.Platform] = row.Price
+	}
+	return prices, nil
+}
+
+// Alert 以策略名义向用户推送事件，试运行时只记录决策理由
+func (e *StrategyEnv) Alert(event string, data map[string]interface{}) {
+	if e.DryRun() {
+		e.Explain("alert %s: %v", event, data)
+		return
+	}
+	data["strategy_id"] = e.Strategy.ID
+	data["strategy_name"] = e.Strategy.Name
+	data["time"] = e.service.now()
+	e.service.notifier.Publish(e.Strategy.UserID, notify.Message{Event: event, Data: data})
+}
+
+// HasInventory 是否持有足够的可交易库存
+func (e *StrategyEnv) HasInventory(itemID uint, quantity int) bool {
+	return e.service.checkInventory(e.Strategy.UserID, itemID, quantity)
+}
+
+// InventoryQuantity 未锁定、未预留的可交易库存数量
+func (e *StrategyEnv) InventoryQuantity(ctx context.Context, itemID uint) int {
+	var quantity int
+	e.service.db.WithContext(ctx).Model(&models.Inventory{}).
+		Where("user_id = ? AND item_id = ? AND locked = ? AND tradable = ?", e.Strategy.UserID, itemID, false, true).
+		Where(notReserved).
+		Select("COALESCE(SUM(quantity), 0)").Scan(&quantity)
+	return quantity
+}
+
+// DryRun 是否处于试运行模式，执行器在该模式下不应修改任何持久状态
+func (e *StrategyEnv) DryRun() bool {
+	return e.evaluation != nil
+}
+
+// Explain 记录决策理由，试运行时返回给调用方
+func (e *StrategyEnv) Explain(format string, args ...interface{}) {
+	if e.evaluation != nil {
+		e.evaluation.Reasoning = append(e.evaluation.Reasoning, fmt.Sprintf(format, args...))
+		return
+	}
+	logrus.WithField("strategy_id", e.Strategy.ID).Debugf(format, args...)
+}
+
+// Buy 以策略名义创建买单，并复制给跟单者
+func (e *StrategyEnv) Buy(itemID uint, price float64, quantity int, platform string) (*models.Order, error) {
+	if e.DryRun() {
+		return e.service.dryRunOrder(e, "buy", itemID, price, quantity, platform), nil
+	}
+	if violation := e.service.haltViolation(itemID); violation != nil {
+		return nil, violation
+	}
+	if err := e.service.arbitrate(e, itemID, "buy"); err != nil {
+		return nil, err
+	}
+
+	order := &models.Order{
+		UserID:     e.Strategy.UserID,
+		ItemID:     itemID,
+		Type:       "buy",
+		Price:      price,
+		Quantity:   quantity,
+		Platform:   platform,
+		StrategyID: &e.Strategy.ID,
+		Latency:    e.service.newOrderLatency(e.Strategy.ID, itemID, platform),
+	}
+	if err := e.service.submitBuyOrder(order); err != nil {
+		return nil, err
+	}
+
+	go e.service.fanOutSignal(e.Strategy, order)
+	return order, nil
+}
+
+// Sell 以策略名义创建卖单，并复制给跟单者
+func (e *StrategyEnv) Sell(itemID uint, price float64, quantity int, platform string) (*models.Order, error) {
+	if e.DryRun() {
+		return e.service.dryRunOrder(e, "sell", itemID, price, quantity, platform), nil
+	}
+	if violation := e.service.haltViolation(itemID); violation != nil {
+		return nil, violation
+	}
+	if err := e.service.arbitrate(e, itemID, "sell"); err != nil {
+		return nil, err
+	}
+
+	order := &models.Order{
+		UserID:     e.Strategy.UserID,
+		ItemID:     itemID,
+		Type:       "sell",
+		Price:      price,
+		Quantity:   quantity,
+		Platform:   platform,
+		StrategyID: &e.Strategy.ID,
+		Latency:    e.service.newOrderLatency(e.Strategy.ID, itemID, platform),
+	}
+	if err := e.service.submitSellOrder(order, nil); err != nil {
+		return nil, err
+	}
+
+	go e.service.fanOutSignal(e.Strategy, order)
+	return order, nil
+}
+
+// runStrategy 执行一次策略
+func (s *Service) runStrategy(strategyID uint) {
+	// 检查策略是否仍然激活
+	var strategy models.Strategy
+	if err := s.db.First(&strategy, strategyID).Error; err != nil || strategy.Status != "active" {
+		s.scheduler.Remove(strategyJobID(strategyID))
+		s.stopRunner(strategyID)
+		return
+	}
+
+	env := s.newStrategyEnv(&strategy)
+
+	runner, err := s.getRunner(&strategy, env)
+	if err != nil {
+		logrus.Errorf("Strategy %d init failed: %v", strategyID, err)
+		s.publishStrategyError(&strategy, "init", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.strategyTimeout())
+	defer cancel()
+
+	if err := runner.Tick(ctx, env); err != nil {
+		// 冲突仲裁拒绝的信号已写入运行日志，物品暂停交易时每个周期都会被拒绝，均不视为执行出错
+		var conflict *StrategyConflict
+		var violation *RiskViolation
+		if errors.As(err, &conflict) {
+			logrus.Infof("Strategy %d signal rejected: %v", strategyID, err)
+		} else if errors.As(err, &violation) && violation.Code == RiskItemHalted {
+			logrus.Infof("Strategy %d skipped: %v", strategyID, err)
+		} else {
+			logrus.Errorf("Strategy %d tick failed: %v", strategyID, err)
+			s.publishStrategyError(&strategy, "tick", err)
+		}
+	}
+	s.snapshotRunner(&strategy, runner)
+}
+
+// publishStrategyError 通知用户策略执行出错
+func (s *Service) publishStrategyError(strategy *models.Strategy, stage string, err error) {
+	s.notifier.Publish(strategy.UserID, notify.Message{Event: webhooks.EventStrategyError, Data: map[string]interface{}{
+		"strategy_id":   strategy.ID,
+		"strategy_name": strategy.Name,
+		"strategy_type": strategy.Type,
+		"stage":         stage,
+		"error":         err.Error(),
+		"time":          s.now(),
+	}})
+}
+
+// publishStrategyStopped 通知用户策略已停止运行
+func (s *Service) publishStrategyStopped(strategyID, userID uint) {
+	var strategy models.Strategy
+	s.db.Select("id", "name", "type").First(&strategy, strategyID)
+	s.notifier.Publish(userID, notify.Message{Event: webhooks.EventStrategyStopped, Data: map[string]interface{}{
+		"strategy_id":   strategyID,
+		"strategy_name": strategy.Name,
+		"strategy_type": strategy.Type,
+		"time":          s.now(),
+	}})
+}
+
+// getRunner 获取策略的执行器，不存在时创建并调用Init
+func (s *Service) getRunner(strategy *models.Strategy, env *StrategyEnv) (StrategyRunner, error) {
+	s.runnersMu.Lock()
+	defer s.runnersMu.Unlock()
+
+	if runner, ok := s.runners[strategy.ID]; ok {
+		return runner, nil
+	}
+
+	runner, err := newRunner(strategy.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.strategyTimeout())
+	defer cancel()
+
+	if err := runner.Init(ctx, env); err != nil {
+		return nil, err
+	}
+
+	// 服务重启后从快照恢复网格档位、挂单等内存状态
+	cycle, err := s.restoreRunner(ctx, strategy, runner, env)
+	if err != nil {
+		logrus.Errorf("Strategy %d restore failed, starting fresh: %v", strategy.ID, err)
+	} else if cycle > 0 {
+		logrus.Infof("Strategy %d restored from snapshot at cycle %d", strategy.ID, cycle)
+	}
+	s.cycles[strategy.ID] = cycle
+
+	s.runners[strategy.ID] = runner
+	return runner, nil
+}
+
+// stopRunner 停止并移除策略的执行器
+func (s *Service) stopRunner(strategyID uint) {
+	s.runnersMu.Lock()
+	runner, ok := s.runners[strategyID]
+	delete(s.runners, strategyID)
+	s.runnersMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	var strategy models.Strategy
+	s.db.Unscoped().First(&strategy, strategyID)
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.strategyTimeout())
+	defer cancel()
+
+	if err := runner.Stop(ctx, s.newStrategyEnv(&strategy)); err != nil {
+		logrus.Errorf("Strategy %d stop failed: %v", strategyID, err)
+	}
+	s.deleteRunnerState(strategyID)
+}
+
+func (s *Service) strategyTimeout() time.Duration {
+	if s.config.StrategyTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(s.config.StrategyTimeout) * time.Second
+}
@@ -0,0 +1,92 @@
+package trading
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"csgo2-trading-bot/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StatefulRunner 带有内存状态的执行器实现该接口后，状态会在每个周期后保存并在重启时恢复
+type StatefulRunner interface {
+	StrategyRunner
+	// Snapshot 序列化当前状态
+	Snapshot() ([]byte, error)
+	// Restore 在Init之后用上次保存的状态恢复执行器
+	Restore(ctx context.Context, env *StrategyEnv, state []byte) error
+}
+
+// snapshotRunner 周期结束后按配置的频率保存执行器状态
+func (s *Service) snapshotRunner(strategy *models.Strategy, runner StrategyRunner) {
+	stateful, ok := runner.(StatefulRunner)
+	if !ok || !s.config.StrategySnapshot.Enabled {
+		return
+	}
+
+	s.runnersMu.Lock()
+	s.cycles[strategy.ID]++
+	cycle := s.cycles[strategy.ID]
+	s.runnersMu.Unlock()
+
+	every := int64(s.config.StrategySnapshot.Every)
+	if every > 1 && cycle%every != 0 {
+		return
+	}
+
+	data, err := stateful.Snapshot()
+	if err != nil {
+		logrus.Errorf("Strategy %d snapshot failed: %v", strategy.ID, err)
+		return
+	}
+
+	state := models.StrategyState{
+		StrategyID: strategy.ID,
+		Type:       strategy.Type,
+		State:      string(data),
+		Cycle:      cycle,
+		UpdatedAt:  time.Now(),
+	}
+	err = s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "strategy_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"type", "state", "cycle", "updated_at"}),
+	}).Create(&state).Error
+	if err != nil {
+		logrus.Errorf("Failed to save strategy %d state: %v", strategy.ID, err)
+	}
+}
+
+// restoreRunner 用保存的快照恢复刚初始化的执行器，返回快照时的周期数；策略类型变化后的旧快照会被忽略
+func (s *Service) restoreRunner(ctx context.Context, strategy *models.Strategy, runner StrategyRunner, env *StrategyEnv) (int64, error) {
+	stateful, ok := runner.(StatefulRunner)
+	if !ok {
+		return 0, nil
+	}
+
+	var state models.StrategyState
+	err := s.db.Where("strategy_id = ?", strategy.ID).First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && state.Type != strategy.Type) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := stateful.Restore(ctx, env, []byte(state.State)); err != nil {
+		return 0, err
+	}
+	return state.Cycle, nil
+}
+
+// deleteRunnerState 策略停止后清除快照
+func (s *Service) deleteRunnerState(strategyID uint) {
+	s.runnersMu.Lock()
+	delete(s.cycles, strategyID)
+	s.runnersMu.Unlock()
+
+	s.db.Where("strategy_id = ?", strategyID).Delete(&models.StrategyState{})
+}
@@ -2,32 +2,144 @@ package trading
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database"
 	"csgo2-trading-bot/models"
-
-	"github.com/redis/go-redis/v9"
+	"csgo2-trading-bot/services/activity"
+	"csgo2-trading-bot/services/clock"
+	"csgo2-trading-bot/services/fx"
+	"csgo2-trading-bot/services/httpclient"
+	"csgo2-trading-bot/services/ledger"
+	"csgo2-trading-bot/services/market"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/outbox"
+	"csgo2-trading-bot/services/platforms/bitskins"
+	"csgo2-trading-bot/services/platforms/marketcsgo"
+	"csgo2-trading-bot/services/positions"
+	"csgo2-trading-bot/services/scheduler"
+	"csgo2-trading-bot/services/webhooks"
+	"csgo2-trading-bot/websocket"
+
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Service struct {
 	db      *gorm.DB
-	redis   *redis.Client
+	cache   *database.Cache
 	config  config.TradingConfig
-	ctx     context.Context
+	hub       *websocket.Hub
+	scheduler *scheduler.Scheduler
+	bitskins  *bitskins.Client
+	marketcsgo *marketcsgo.Client
+	fx        *fx.Service
+	notifier  *notify.Router
+	activity  *activity.Service
+	outbox    *outbox.Relay
+	ctx       context.Context
+
+	runnersMu sync.Mutex
+	runners   map[uint]StrategyRunner
+	cycles    map[uint]int64 // 各策略已执行的周期数，用于控制快照频率
+
+	quotaMu  sync.Mutex
+	apiUsage map[string]*apiWindow // 各平台当前窗口的API调用次数
+
+	latency *latencyMetrics
+
+	feeMu       sync.RWMutex
+	feeVersions map[string][]models.FeeScheduleVersion // 按平台分组，按生效时间升序
+	feeLoadedAt time.Time
+
+	newItemListeners []func(platform string, names []string)
+
+	priceTicks   chan market.PriceUpdate // 存在未触发条件单的物品的价格更新
+	triggerMu    sync.RWMutex
+	triggerItems map[uint]bool // 存在未触发条件单的物品
+
+	executions chan uint // 进程内执行队列，Redis不可用时使用
+	consumer   string    // 本实例在执行队列消费组中的名称
+
+	maintenance interface{ Enabled() bool } // 维护模式，开启时拒绝下单并暂停执行和条件单触发
+
+	clock clock.Clock // 成交、入库、价格记录和统计区间使用的时间
 }
 
-func NewService(db *gorm.DB, redis *redis.Client, cfg config.TradingConfig) *Service {
-	return &Service{
-		db:     db,
-		redis:  redis,
-		config: cfg,
-		ctx:    context.Background(),
+func NewService(db *gorm.DB, cache *database.Cache, cfg config.TradingConfig, hub *websocket.Hub, sched *scheduler.Scheduler, httpClients *httpclient.Factory, fxService *fx.Service, notifier *notify.Router, activityService *activity.Service, relay *outbox.Relay) *Service {
+	s := &Service{
+		db:        db,
+		cache:     cache,
+		config:    cfg,
+		hub:       hub,
+		scheduler: sched,
+		fx:        fxService,
+		notifier:  notifier,
+		activity:  activityService,
+		outbox:    relay,
+		ctx:       context.Background(),
+		runners:   make(map[uint]StrategyRunner),
+		cycles:    make(map[uint]int64),
+		apiUsage:  make(map[string]*apiWindow),
+		latency:   newLatencyMetrics(),
+		priceTicks:   make(chan market.PriceUpdate, 1024),
+		triggerItems: make(map[uint]bool),
+		clock:        clock.System{},
+	}
+	httpClients.OnRequest(s.countAPICall)
+	relay.Handle(orderTopic, s.deliverOrderEvent)
+
+	if cfg.BitSkins.Enabled {
+		s.bitskins = bitskins.New(bitskins.Config{
+			BaseURL: connectorURL("bitskins", cfg.BitSkins.BaseURL, cfg.BitSkins.SandboxURL),
+			APIKey:  cfg.BitSkins.APIKey,
+			Secret:  cfg.BitSkins.Secret,
+		}, httpClients.Client("bitskins"))
+	}
+	if cfg.MarketCSGO.Enabled {
+		s.marketcsgo = marketcsgo.New(marketcsgo.Config{
+			BaseURL:  connectorURL("marketcsgo", cfg.MarketCSGO.BaseURL, cfg.MarketCSGO.SandboxURL),
+			APIKey:   cfg.MarketCSGO.APIKey,
+			Currency: cfg.MarketCSGO.Currency,
+		}, httpClients.Client("marketcsgo"))
 	}
+
+	return s
+}
+
+// ErrMaintenance 维护模式下不接受新订单
+var ErrMaintenance = errors.New("service is under maintenance")
+
+// UseMaintenance 维护模式开启时拒绝下单，执行队列和条件单触发暂停到维护结束
+func (s *Service) UseMaintenance(maintenance interface{ Enabled() bool }) {
+	s.maintenance = maintenance
+}
+
+func (s *Service) underMaintenance() bool {
+	return s.maintenance != nil && s.maintenance.Enabled()
+}
+
+// UseClock 替换时间来源，场景测试在模拟的交易日上运行
+func (s *Service) UseClock(c clock.Clock) {
+	s.clock = c
+}
+
+func (s *Service) now() time.Time {
+	return s.clock.Now()
+}
+
+// connectorURL 配置了沙箱地址时使用沙箱地址
+func connectorURL(platform, baseURL, sandboxURL string) string {
+	if sandboxURL == "" {
+		return baseURL
+	}
+	logrus.Warnf("%s connector is in sandbox mode: %s", platform, sandboxURL)
+	return sandboxURL
 }
 
 // GetInventory 获取用户库存
@@ -37,91 +149,212 @@ func (s *Service) GetInventory(userID uint) ([]models.Inventory, error) {
 	return inventory, err
 }
 
-// CreateBuyOrder 创建买入订单
-func (s *Service) CreateBuyOrder(userID uint, itemID uint, price float64, quantity int, platform string) (*models.Order, error) {
-	// 检查用户余额（这里简化处理，实际需要接入支付系统）
-	totalCost := price * float64(quantity)
-	if !s.checkUserBalance(userID, totalCost) {
-		return nil, errors.New("insufficient balance")
+// CreateBuyOrder 创建买入订单，expiresAt不为空时到期仍未成交的订单自动取消
+func (s *Service) CreateBuyOrder(userID uint, itemID uint, price float64, quantity int, platform string, expiresAt *time.Time) (*models.Order, error) {
+	if err := validateExpiry(expiresAt); err != nil {
+		return nil, err
 	}
-
-	// 创建订单
-	order := models.Order{
-		UserID:   userID,
-		ItemID:   itemID,
-		Type:     "buy",
-		Status:   "pending",
-		Price:    price,
-		Quantity: quantity,
-		Platform: platform,
+	order := &models.Order{
+		UserID:    userID,
+		ItemID:    itemID,
+		Type:      "buy",
+		Price:     price,
+		Quantity:  quantity,
+		Platform:  platform,
+		ExpiresAt: expiresAt,
 	}
+	if err := s.submitBuyOrder(order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
 
-	if err := s.db.Create(&order).Error; err != nil {
+// createBuyOrder 创建买入订单，strategyID不为空时表示由策略触发
+func (s *Service) createBuyOrder(userID uint, itemID uint, price float64, quantity int, platform string, strategyID *uint) (*models.Order, error) {
+	order := &models.Order{
+		UserID:     userID,
+		ItemID:     itemID,
+		Type:       "buy",
+		Price:      price,
+		Quantity:   quantity,
+		Platform:   platform,
+		StrategyID: strategyID,
+	}
+	if err := s.submitBuyOrder(order); err != nil {
 		return nil, err
 	}
+	return order, nil
+}
+
+// submitBuyOrder 校验并提交买单
+func (s *Service) submitBuyOrder(order *models.Order) error {
+	if s.underMaintenance() {
+		return ErrMaintenance
+	}
+	// 确定下单平台
+	if err := s.resolvePlatform(order); err != nil {
+		return err
+	}
 
-	// 异步执行订单
-	go s.executeBuyOrder(&order)
+	// 余额检查、风控检查和写入订单在同一事务中完成，同一用户的下单串行执行，
+	// 并发提交的订单不会同时通过余额和风控限额检查
+	var violation *RiskViolation
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, order.UserID); err != nil {
+			return err
+		}
 
-	return &order, nil
+		// 检查用户可用余额
+		totalCost := order.Price * float64(order.Quantity)
+		if !s.checkUserBalance(tx, order.UserID, order.Platform, totalCost, 0) {
+			return errors.New("insufficient balance")
+		}
+
+		order.Status = "pending"
+
+		// 风控检查
+		if violation = s.evaluateRisk(order); violation != nil {
+			return violation
+		}
+
+		// 创建订单
+		return insertOrder(tx, order)
+	})
+	if violation != nil {
+		s.notifyRiskViolation(order, violation)
+	}
+	if err != nil {
+		return err
+	}
+	s.outbox.Kick()
+
+	// 交给执行队列，条件单等待价格触发
+	s.dispatchOrder(order)
+
+	return nil
 }
 
-// CreateSellOrder 创建卖出订单
-func (s *Service) CreateSellOrder(userID uint, itemID uint, price float64, quantity int, platform string) (*models.Order, error) {
-	// 检查库存
-	if !s.checkInventory(userID, itemID, quantity) {
-		return nil, errors.New("insufficient inventory")
+// CreateSellOrder 创建卖出订单，expiresAt不为空时到期仍未成交的订单自动取消并释放锁定的库存
+func (s *Service) CreateSellOrder(userID uint, itemID uint, price float64, quantity int, platform string, lotMethod string, expiresAt *time.Time) (*models.Order, error) {
+	if err := validateExpiry(expiresAt); err != nil {
+		return nil, err
+	}
+	order := &models.Order{
+		UserID:    userID,
+		ItemID:    itemID,
+		Type:      "sell",
+		Price:     price,
+		Quantity:  quantity,
+		Platform:  platform,
+		LotMethod: lotMethod,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.submitSellOrder(order, nil); err != nil {
+		return nil, err
 	}
+	return order, nil
+}
 
-	// 锁定库存
-	if err := s.lockInventory(userID, itemID, quantity); err != nil {
+// createSellOrder 创建卖出订单，strategyID不为空时表示由策略触发，lots不为空时只卖出指定的批次
+func (s *Service) createSellOrder(userID uint, itemID uint, price float64, quantity int, platform string, strategyID *uint, lots []LotSelection) (*models.Order, error) {
+	order := &models.Order{
+		UserID:     userID,
+		ItemID:     itemID,
+		Type:       "sell",
+		Price:      price,
+		Quantity:   quantity,
+		Platform:   platform,
+		StrategyID: strategyID,
+	}
+	if err := s.submitSellOrder(order, lots); err != nil {
 		return nil, err
 	}
+	return order, nil
+}
 
-	// 创建订单
-	order := models.Order{
-		UserID:   userID,
-		ItemID:   itemID,
-		Type:     "sell",
-		Status:   "pending",
-		Price:    price,
-		Quantity: quantity,
-		Platform: platform,
+// submitSellOrder 校验库存、锁定并提交卖单。preselected不为空时卖出指定的批次，否则按批次选择方式选择
+func (s *Service) submitSellOrder(order *models.Order, preselected []LotSelection) error {
+	if s.underMaintenance() {
+		return ErrMaintenance
+	}
+	// 确定下单平台
+	if err := s.resolvePlatform(order); err != nil {
+		return err
 	}
 
-	if err := s.db.Create(&order).Error; err != nil {
-		s.unlockInventory(userID, itemID, quantity)
-		return nil, err
+	// 选择批次、锁定库存和写入订单在同一事务中完成：选中的库存行被锁定到事务结束，
+	// 并发提交的卖单不会选中同一批库存，任一步失败时库存锁定随事务回滚
+	var violation *RiskViolation
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, order.UserID); err != nil {
+			return err
+		}
+
+		// 按批次选择方式选定要卖出的库存，调用方指定了批次时只校验这些批次
+		var lots []LotSelection
+		var err error
+		if preselected != nil {
+			lots, err = claimLots(tx, order, preselected)
+		} else {
+			lots, err = s.selectLots(tx, order)
+		}
+		if err != nil {
+			return err
+		}
+		if err := setOrderLots(order, lots); err != nil {
+			return err
+		}
+
+		order.Status = "pending"
+
+		// 风控检查
+		if violation = s.evaluateRisk(order); violation != nil {
+			return violation
+		}
+
+		// 锁定库存
+		if err := lockLots(tx, lots); err != nil {
+			return err
+		}
+
+		// 创建订单
+		return insertOrder(tx, order)
+	})
+	if violation != nil {
+		s.notifyRiskViolation(order, violation)
 	}
+	if err != nil {
+		return err
+	}
+	s.outbox.Kick()
 
-	// 异步执行订单
-	go s.executeSellOrder(&order)
+	// 交给执行队列，条件单等待价格触发
+	s.dispatchOrder(order)
 
-	return &order, nil
+	return nil
 }
 
 // GetOrders 获取用户订单
 func (s *Service) GetOrders(userID uint, status string, page, pageSize int) ([]models.Order, int64, error) {
-	var orders []models.Order
-	var total int64
-
-	query := s.db.Model(&models.Order{}).Where("user_id = ?", userID)
-	
+	search := OrderSearch{Page: page, PageSize: pageSize}
 	if status != "" {
-		query = query.Where("status = ?", status)
+		search.Statuses = []string{status}
 	}
+	return s.SearchOrders(userID, search)
+}
 
-	query.Count(&total)
-
-	offset := (page - 1) * pageSize
-	err := query.Preload("Item").Offset(offset).Limit(pageSize).
-		Order("created_at DESC").Find(&orders).Error
-
-	return orders, total, err
+// GetOrder 获取用户的单个订单
+func (s *Service) GetOrder(orderID uint, userID uint) (*models.Order, error) {
+	var order models.Order
+	if err := s.db.Where("id = ? AND user_id = ?", orderID, userID).First(&order).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
 }
 
-// CancelOrder 取消订单
-func (s *Service) CancelOrder(orderID uint, userID uint) error {
+// CancelOrder 取消订单。version为调用方读取到的订单版本，订单已开始向平台提交或版本不一致时返回ErrVersionConflict；
+// 0表示不检查，只供内部撤单（冲突订单、拆分订单的子单、策略撤单）使用，客户端请求必须带上版本
+func (s *Service) CancelOrder(orderID uint, userID uint, version int) error {
 	var order models.Order
 	if err := s.db.First(&order, orderID).Error; err != nil {
 		return err
@@ -134,25 +367,46 @@ func (s *Service) CancelOrder(orderID uint, userID uint) error {
 	if order.Status != "pending" {
 		return errors.New("order cannot be cancelled")
 	}
+	if version > 0 && order.Version != version {
+		return fmt.Errorf("%w: order %d is at version %d", ErrVersionConflict, order.ID, order.Version)
+	}
+	if order.ExecutionStartedAt != nil {
+		return fmt.Errorf("%w: order %d is being executed", ErrVersionConflict, order.ID)
+	}
+
+	// transitionOrder按读取到的版本校验，这期间开始执行的订单不会被取消
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return s.transitionOrder(tx, &order, OrderCancelled, orderEventData{})
+	})
+	if errors.Is(err, errOrderTransition) {
+		return errors.New("order cannot be cancelled")
+	}
+	if err != nil {
+		return err
+	}
+	s.outbox.Kick()
 
 	// 如果是卖单，解锁库存
 	if order.Type == "sell" {
-		s.unlockInventory(order.UserID, order.ItemID, order.Quantity)
+		s.unlockInventory(&order)
 	}
-
-	order.Status = "cancelled"
-	return s.db.Save(&order).Error
+	return nil
 }
 
 // executeBuyOrder 执行买入订单
 func (s *Service) executeBuyOrder(order *models.Order) {
+	if s.deferForQuota(order) || !s.claimExecution(order) {
+		return
+	}
+	s.recordSubmission(order)
+
 	// 根据平台执行不同的购买逻辑
 	var err error
 	
 	switch order.Platform {
 	case "buff":
 		if s.config.BuffAPI.Enabled {
-			err = s.executeBuff Buy(order)
+			err = s.executeBuffBuy(order)
 		}
 	case "youpin":
 		if s.config.YouPin.Enabled {
@@ -160,30 +414,47 @@ func (s *Service) executeBuyOrder(order *models.Order) {
 		}
 	case "steam":
 		err = s.executeSteamBuy(order)
+	case "bitskins":
+		if s.bitskins == nil {
+			err = errors.New("bitskins is not enabled")
+		} else {
+			err = s.executeBitSkinsBuy(order)
+		}
+	case "marketcsgo":
+		if s.marketcsgo == nil {
+			err = errors.New("market.csgo is not enabled")
+		} else {
+			err = s.executeMarketCSGOBuy(order)
+		}
 	default:
 		err = errors.New("unsupported platform")
 	}
 
-	if err != nil {
-		order.Status = "failed"
-		order.FailedReason = err.Error()
-	} else {
-		order.Status = "completed"
-		now := time.Now()
-		order.ExecutedAt = &now
-		
+	if err == nil {
+		s.recordTimeline(order.ID, OrderAcknowledged, orderEventData{Quantity: order.Quantity})
+	}
+
+	// 执行过程中部分成交的数量已经入库和记账，完成时只处理剩余部分
+	filled := order.FilledQuantity
+	if !s.finishOrder(order, err) {
+		return
+	}
+	if err == nil && order.Quantity > filled {
 		// 添加到库存
-		s.addToInventory(order)
+		s.addToInventory(order, order.Quantity-filled)
 		
 		// 记录交易
-		s.recordTransaction(order)
+		s.recordTransaction(order, filled, order.Quantity-filled)
 	}
-
-	s.db.Save(order)
 }
 
 // executeSellOrder 执行卖出订单
 func (s *Service) executeSellOrder(order *models.Order) {
+	if s.deferForQuota(order) || !s.claimExecution(order) {
+		return
+	}
+	s.recordSubmission(order)
+
 	// 根据平台执行不同的出售逻辑
 	var err error
 	
@@ -198,164 +469,312 @@ func (s *Service) executeSellOrder(order *models.Order) {
 		}
 	case "steam":
 		err = s.executeSteamSell(order)
+	case "bitskins":
+		if s.bitskins == nil {
+			err = errors.New("bitskins is not enabled")
+		} else {
+			err = s.executeBitSkinsSell(order)
+		}
+	case "marketcsgo":
+		if s.marketcsgo == nil {
+			err = errors.New("market.csgo is not enabled")
+		} else {
+			err = s.executeMarketCSGOSell(order)
+		}
 	default:
 		err = errors.New("unsupported platform")
 	}
 
+	if err == nil {
+		s.recordTimeline(order.ID, OrderAcknowledged, orderEventData{Quantity: order.Quantity})
+	}
+
+	// 执行过程中部分成交的数量已经出库和记账，完成时只处理剩余部分
+	filled := order.FilledQuantity
+	if !s.finishOrder(order, err) {
+		return
+	}
 	if err != nil {
-		order.Status = "failed"
-		order.FailedReason = err.Error()
-		// 解锁库存
-		s.unlockInventory(order.UserID, order.ItemID, order.Quantity)
-	} else {
-		order.Status = "completed"
-		now := time.Now()
-		order.ExecutedAt = &now
-		
+		// 解锁未成交部分的库存
+		s.unlockInventory(order)
+	} else if order.Quantity > filled {
 		// 从库存移除
-		s.removeFromInventory(order)
+		s.removeFromInventory(order, filled, order.Quantity-filled)
 		
 		// 记录交易
-		s.recordTransaction(order)
+		s.recordTransaction(order, filled, order.Quantity-filled)
+	}
+}
+
+// finishOrder 记录平台执行结果（completed或failed事件），订单已被取消或过期时返回false
+func (s *Service) finishOrder(order *models.Order, execErr error) bool {
+	eventType, data := OrderFailed, orderEventData{}
+	if execErr != nil {
+		data.Reason = execErr.Error()
+	} else {
+		now := s.now()
+		eventType, data = OrderCompleted, orderEventData{Quantity: order.Quantity, ExecutedAt: &now}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return s.transitionOrder(tx, order, eventType, data)
+	})
+	if err != nil {
+		// 执行期间订单已进入终态，平台上的成交需要人工核对
+		logrus.Errorf("Failed to record %s for order %d: %v", eventType, order.ID, err)
+		return false
+	}
+	s.outbox.Kick()
+	return true
+}
+
+// publishOrder 通知用户订单的最终状态
+func (s *Service) publishOrder(order *models.Order) {
+	switch order.Status {
+	case "completed":
+		s.notifier.Publish(order.UserID, notify.Message{Event: webhooks.EventOrderCompleted, Data: order})
+	case "failed":
+		s.notifier.Publish(order.UserID, notify.Message{Event: webhooks.EventOrderFailed, Data: order})
+	case "expired":
+		s.notifier.Publish(order.UserID, notify.Message{Event: notify.EventOrderExpired, Data: order})
 	}
+}
 
-	s.db.Save(order)
+// StrategySummary 策略及其资金占用情况
+type StrategySummary struct {
+	models.Strategy
+	Committed   float64 `json:"committed"`   // 已占用资金（未成交买单 + 策略持仓成本）
+	Utilization float64 `json:"utilization"` // 占MaxInvest的百分比，未设置预算时为0
 }
 
 // GetStrategies 获取交易策略
-func (s *Service) GetStrategies(userID uint) ([]models.Strategy, error) {
+func (s *Service) GetStrategies(userID uint) ([]StrategySummary, error) {
 	var strategies []models.Strategy
-	err := s.db.Where("user_id = ?", userID).Find(&strategies).Error
-	return strategies, err
+	if err := s.db.Where("user_id = ?", userID).Find(&strategies).Error; err != nil {
+		return nil, err
+	}
+
+	summaries := make([]StrategySummary, len(strategies))
+	for i, strategy := range strategies {
+		committed := s.strategyCommitted(strategy.ID, 0)
+		summaries[i] = StrategySummary{
+			Strategy:  strategy,
+			Committed: committed,
+		}
+		if strategy.MaxInvest > 0 {
+			summaries[i].Utilization = committed / strategy.MaxInvest * 100
+		}
+	}
+	return summaries, nil
 }
 
 // CreateStrategy 创建交易策略
 func (s *Service) CreateStrategy(userID uint, strategy *models.Strategy) error {
+	if _, err := newRunner(strategy.Type); err != nil {
+		return err
+	}
+	if _, err := scheduler.ParseSpec(strategy.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+
 	strategy.UserID = userID
 	strategy.Status = "paused"
 	return s.db.Create(strategy).Error
 }
 
-// UpdateStrategy 更新交易策略
-func (s *Service) UpdateStrategy(strategyID uint, userID uint, updates map[string]interface{}) error {
-	return s.db.Model(&models.Strategy{}).
-		Where("id = ? AND user_id = ?", strategyID, userID).
-		Updates(updates).Error
+// ErrInvalidStrategyUpdate 修改了不允许直接修改的字段，状态须通过激活、停用接口修改
+var ErrInvalidStrategyUpdate = errors.New("field cannot be updated")
+
+// editableStrategyFields 修改策略接口允许修改的字段
+var editableStrategyFields = map[string]bool{
+	"name": true, "description": true, "type": true, "config": true,
+	"max_invest": true, "min_profit": true, "stop_loss": true, "take_profit": true,
+	"schedule": true, "jitter": true, "concurrency": true, "is_public": true, "priority": true,
+}
+
+// UpdateStrategy 更新交易策略。version为调用方读取到的策略版本，
+// 版本不一致（期间被其他请求修改或激活、停用）时返回ErrVersionConflict；
+// 只能修改editableStrategyFields中的字段，其余字段（如status、user_id）返回ErrInvalidStrategyUpdate
+func (s *Service) UpdateStrategy(strategyID uint, userID uint, updates map[string]interface{}, version int) error {
+	delete(updates, "version")
+	for field := range updates {
+		if !editableStrategyFields[field] {
+			return fmt.Errorf("%w: %s", ErrInvalidStrategyUpdate, field)
+		}
+	}
+	if len(updates) == 0 {
+		return fmt.Errorf("%w: nothing to change", ErrInvalidStrategyUpdate)
+	}
+	if strategyType, ok := updates["type"].(string); ok {
+		if _, err := newRunner(strategyType); err != nil {
+			return err
+		}
+	}
+	if spec, ok := updates["schedule"].(string); ok {
+		if _, err := scheduler.ParseSpec(spec); err != nil {
+			return fmt.Errorf("invalid schedule: %w", err)
+		}
+	}
+
+	updates["version"] = gorm.Expr("version + 1")
+	result := s.db.Model(&models.Strategy{}).
+		Where("id = ? AND user_id = ? AND version = ?", strategyID, userID, version).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.GetStrategy(strategyID, userID); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: strategy %d has changed since version %d", ErrVersionConflict, strategyID, version)
+	}
+
+	// 已激活的策略按新的配置重新初始化并注册，暂停的策略只能通过ActivateStrategy激活
+	var strategy models.Strategy
+	if err := s.db.Where("id = ? AND user_id = ?", strategyID, userID).First(&strategy).Error; err != nil {
+		return err
+	}
+	if strategy.Status == "active" {
+		s.stopRunner(strategyID)
+		return s.scheduleStrategy(&strategy)
+	}
+	return nil
+}
+
+// GetStrategy 获取用户的单个策略
+func (s *Service) GetStrategy(strategyID uint, userID uint) (*models.Strategy, error) {
+	var strategy models.Strategy
+	if err := s.db.Where("id = ? AND user_id = ?", strategyID, userID).First(&strategy).Error; err != nil {
+		return nil, err
+	}
+	return &strategy, nil
 }
 
 // DeleteStrategy 删除交易策略
 func (s *Service) DeleteStrategy(strategyID uint, userID uint) error {
-	return s.db.Where("id = ? AND user_id = ?", strategyID, userID).
-		Delete(&models.Strategy{}).Error
+	if err := s.db.Where("id = ? AND user_id = ?", strategyID, userID).
+		Delete(&models.Strategy{}).Error; err != nil {
+		return err
+	}
+
+	s.scheduler.Remove(strategyJobID(strategyID))
+	s.stopRunner(strategyID)
+	return nil
 }
 
-// ActivateStrategy 激活策略
-func (s *Service) ActivateStrategy(strategyID uint, userID uint) error {
+// ActivateStrategy 激活策略，激活前检查产生的警告必须全部在acknowledged中确认
+func (s *Service) ActivateStrategy(strategyID uint, userID uint, acknowledged []string) error {
 	var strategy models.Strategy
 	if err := s.db.Where("id = ? AND user_id = ?", strategyID, userID).First(&strategy).Error; err != nil {
 		return err
 	}
 
-	strategy.Status = "active"
-	if err := s.db.Save(&strategy).Error; err != nil {
-		return err
+	// 实验期间由各变体代为交易
+	var running int64
+	s.db.Model(&models.StrategyExperiment{}).Where("strategy_id = ? AND status = ?", strategyID, "running").Count(&running)
+	if running > 0 {
+		return errors.New("strategy has a running experiment")
 	}
 
-	// 启动策略执行器
-	go s.runStrategy(&strategy)
+	result, err := s.preflight(&strategy)
+	if err != nil {
+		return err
+	}
+	if missing := result.unacknowledged(acknowledged); len(missing) > 0 {
+		return &PreflightRequired{Preflight: result, Unacknowledged: missing}
+	}
+	s.recordAcknowledgement(&strategy, result)
+
+	// 检查期间策略被修改时，确认的警告可能已经不适用
+	updated := s.db.Model(&models.Strategy{}).
+		Where("id = ? AND version = ?", strategy.ID, strategy.Version).
+		Updates(map[string]interface{}{"status": "active", "version": gorm.Expr("version + 1")})
+	if updated.Error != nil {
+		return updated.Error
+	}
+	if updated.RowsAffected == 0 {
+		return fmt.Errorf("%w: strategy %d changed during activation", ErrVersionConflict, strategy.ID)
+	}
+	strategy.Status = "active"
+	strategy.Version++
 
-	return nil
+	// 注册到调度器
+	return s.scheduleStrategy(&strategy)
 }
 
 // DeactivateStrategy 停用策略
 func (s *Service) DeactivateStrategy(strategyID uint, userID uint) error {
-	return s.db.Model(&models.Strategy{}).
+	result := s.db.Model(&models.Strategy{}).
 		Where("id = ? AND user_id = ?", strategyID, userID).
-		Update("status", "paused").Error
-}
+		Updates(map[string]interface{}{"status": "paused", "version": gorm.Expr("version + 1")})
+	if result.Error != nil {
+		return result.Error
+	}
 
-// runStrategy 运行策略
-func (s *Service) runStrategy(strategy *models.Strategy) {
-	ticker := time.NewTicker(1 * time.Minute) // 每分钟检查一次
-	defer ticker.Stop()
+	if result.RowsAffected > 0 {
+		s.scheduler.Remove(strategyJobID(strategyID))
+		s.stopRunner(strategyID)
+		s.publishStrategyStopped(strategyID, userID)
+	}
+	return nil
+}
 
-	for range ticker.C {
-		// 检查策略是否仍然激活
-		var currentStrategy models.Strategy
-		if err := s.db.First(&currentStrategy, strategy.ID).Error; err != nil {
-			return
-		}
+// RestoreActiveStrategies 启动时重新调度所有激活中的策略
+func (s *Service) RestoreActiveStrategies() error {
+	var strategies []models.Strategy
+	if err := s.db.Where("status = ?", "active").Find(&strategies).Error; err != nil {
+		return err
+	}
 
-		if currentStrategy.Status != "active" {
-			return
+	for i := range strategies {
+		if err := s.scheduleStrategy(&strategies[i]); err != nil {
+			return fmt.Errorf("strategy %d: %w", strategies[i].ID, err)
 		}
 
-		// 根据策略类型执行不同的逻辑
-		switch strategy.Type {
-		case "grid":
-			s.executeGridStrategy(strategy)
-		case "arbitrage":
-			s.executeArbitrageStrategy(strategy)
-		case "trend_following":
-			s.executeTrendFollowingStrategy(strategy)
-		case "mean_reversion":
-			s.executeMeanReversionStrategy(strategy)
+		// 立即创建执行器，从快照恢复状态并核对遗留的挂单，而不是等到下一个周期
+		if _, err := s.getRunner(&strategies[i], s.newStrategyEnv(&strategies[i])); err != nil {
+			logrus.Errorf("Strategy %d init failed: %v", strategies[i].ID, err)
 		}
 	}
+	return nil
 }
 
-// executeGridStrategy 执行网格策略
-func (s *Service) executeGridStrategy(strategy *models.Strategy) {
-	// 网格交易策略实现
-	var config map[string]interface{}
-	json.Unmarshal([]byte(strategy.Config), &config)
-	
-	// 获取价格区间和网格数量
-	minPrice := config["min_price"].(float64)
-	maxPrice := config["max_price"].(float64)
-	gridCount := int(config["grid_count"].(float64))
-	
-	// 计算每个网格的价格
-	gridSize := (maxPrice - minPrice) / float64(gridCount)
-	
-	// 检查当前价格并执行相应操作
-	// 这里需要实现具体的网格交易逻辑
-}
-
-// executeArbitrageStrategy 执行套利策略
-func (s *Service) executeArbitrageStrategy(strategy *models.Strategy) {
-	// 套利策略实现
-	// 比较不同平台的价格差异，寻找套利机会
-}
-
-// executeTrendFollowingStrategy 执行趋势跟踪策略
-func (s *Service) executeTrendFollowingStrategy(strategy *models.Strategy) {
-	// 趋势跟踪策略实现
-	// 根据移动平均线等指标判断趋势
+// scheduleStrategy 按策略声明的调度表达式注册任务
+func (s *Service) scheduleStrategy(strategy *models.Strategy) error {
+	strategyID := strategy.ID
+
+	return s.scheduler.Add(scheduler.Job{
+		ID:            strategyJobID(strategyID),
+		Spec:          strategy.Schedule,
+		Jitter:        time.Duration(strategy.Jitter) * time.Second,
+		MaxConcurrent: strategy.Concurrency,
+		Run: func() {
+			s.runStrategy(strategyID)
+		},
+	})
 }
 
-// executeMeanReversionStrategy 执行均值回归策略
-func (s *Service) executeMeanReversionStrategy(strategy *models.Strategy) {
-	// 均值回归策略实现
-	// 当价格偏离均值时进行交易
+func strategyJobID(strategyID uint) string {
+	return fmt.Sprintf("strategy:%d", strategyID)
 }
 
 // GetProfitStats 获取盈利统计
-func (s *Service) GetProfitStats(userID uint, period string) (map[string]interface{}, error) {
+func (s *Service) GetProfitStats(userID uint, period string, groupBy string) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 	
 	var startDate time.Time
 	switch period {
 	case "day":
-		startDate = time.Now().AddDate(0, 0, -1)
+		startDate = s.now().AddDate(0, 0, -1)
 	case "week":
-		startDate = time.Now().AddDate(0, 0, -7)
+		startDate = s.now().AddDate(0, 0, -7)
 	case "month":
-		startDate = time.Now().AddDate(0, -1, 0)
+		startDate = s.now().AddDate(0, -1, 0)
 	case "year":
-		startDate = time.Now().AddDate(-1, 0, 0)
+		startDate = s.now().AddDate(-1, 0, 0)
 	default:
-		startDate = time.Now().AddDate(0, -1, 0)
+		startDate = s.now().AddDate(0, -1, 0)
 	}
 
 	// 计算总盈利
@@ -390,6 +809,15 @@ func (s *Service) GetProfitStats(userID uint, period string) (map[string]interfa
 		Order("profit DESC").First(&bestTrade)
 	stats["best_trade"] = bestTrade
 
+	// 按策略归因
+	if groupBy == "strategy" {
+		byStrategy, err := s.GetProfitByStrategy(userID, startDate)
+		if err != nil {
+			return nil, err
+		}
+		stats["by_strategy"] = byStrategy
+	}
+
 	return stats, nil
 }
 
@@ -432,9 +860,51 @@ func (s *Service) GetTradingStats(userID uint) (map[string]interface{}, error) {
 }
 
 // 辅助函数
-func (s *Service) checkUserBalance(userID uint, amount float64) bool {
-	// 实际实现需要接入支付系统
-	return true
+func toFloat(v interface{}) float64 {
+	f, _ := v.(float64)
+	return f
+}
+
+// lockUser 锁定用户行直到事务结束，同一用户的下单和资金入账（ledger.Post）串行执行
+func lockUser(tx *gorm.DB, userID uint) error {
+	var user models.User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&user, userID).Error
+}
+
+// checkUserBalance 用户可用余额是否足以支付amount（含买入手续费）。可用余额为资金流水余额减去未成交买单占用的金额，
+// excludeOrderID为正在修改的订单，不计入占用。下单时应传入已通过lockUser锁定用户行的事务句柄，
+// 同一用户并发提交的买单依次检查，不会同时通过
+func (s *Service) checkUserBalance(db *gorm.DB, userID uint, platform string, amount float64, excludeOrderID uint) bool {
+	available, err := s.availableBalance(db, userID, excludeOrderID)
+	if err != nil {
+		logrus.Errorf("Failed to check balance of user %d: %v", userID, err)
+		return false
+	}
+	return available >= amount+s.buyFee(platform, amount)
+}
+
+// availableBalance 资金流水余额减去未成交买单剩余数量的金额和手续费
+func (s *Service) availableBalance(db *gorm.DB, userID uint, excludeOrderID uint) (float64, error) {
+	balance, err := ledger.Balance(db, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var reserved []struct {
+		Platform string
+		Amount   float64
+	}
+	if err := db.Model(&models.Order{}).
+		Select("platform, COALESCE(SUM(price * (quantity - filled_quantity)), 0) AS amount").
+		Where("user_id = ? AND type = ? AND status = ? AND id <> ?", userID, "buy", "pending", excludeOrderID).
+		Group("platform").
+		Scan(&reserved).Error; err != nil {
+		return 0, err
+	}
+	for _, r := range reserved {
+		balance -= r.Amount + s.buyFee(r.Platform, r.Amount)
+	}
+	return balance, nil
 }
 
 func (s *Service) checkInventory(userID uint, itemID uint, quantity int) bool {
@@ -442,63 +912,125 @@ func (s *Service) checkInventory(userID uint, itemID uint, quantity int) bool {
 	s.db.Model(&models.Inventory{}).
 		Where("user_id = ? AND item_id = ? AND quantity >= ? AND locked = ?", 
 			userID, itemID, quantity, false).
+		Where(notReserved).
 		Count(&count)
 	return count > 0
 }
 
-func (s *Service) lockInventory(userID uint, itemID uint, quantity int) error {
-	return s.db.Model(&models.Inventory{}).
-		Where("user_id = ? AND item_id = ?", userID, itemID).
-		Update("locked", true).Error
+func (s *Service) unlockInventory(order *models.Order) error {
+	return unlockLots(s.db, order)
 }
 
-func (s *Service) unlockInventory(userID uint, itemID uint, quantity int) error {
-	return s.db.Model(&models.Inventory{}).
-		Where("user_id = ? AND item_id = ?", userID, itemID).
-		Update("locked", false).Error
-}
-
-func (s *Service) addToInventory(order *models.Order) {
+func (s *Service) addToInventory(order *models.Order, quantity int) {
 	inventory := models.Inventory{
-		UserID:     order.UserID,
-		ItemID:     order.ItemID,
-		Quantity:   order.Quantity,
-		BuyPrice:   order.Price,
-		Platform:   order.Platform,
-		AcquiredAt: time.Now(),
-		Tradable:   true,
+		UserID:         order.UserID,
+		ItemID:         order.ItemID,
+		Quantity:       quantity,
+		BuyPrice:       order.Price,
+		Platform:       order.Platform,
+		StrategyID:     order.StrategyID,
+		SubscriptionID: order.SubscriptionID,
+		AcquiredAt:     s.now(),
+		Tradable:       true,
 	}
 	s.db.Create(&inventory)
 }
 
-func (s *Service) removeFromInventory(order *models.Order) {
-	s.db.Where("user_id = ? AND item_id = ?", order.UserID, order.ItemID).
-		Delete(&models.Inventory{})
+// removeFromInventory 扣减卖单已成交filled件之后的quantity件对应的批次，订单没有记录批次时先匹配批次
+func (s *Service) removeFromInventory(order *models.Order, filled, quantity int) {
+	lots := orderLots(order)
+	if lots == nil {
+		if lots = s.assignLots(order); lots == nil {
+			logrus.Warnf("No inventory lots matched sell order %d, inventory left unchanged", order.ID)
+			return
+		}
+	}
+	portion, open := fillLots(lots, filled, quantity)
+	if err := consumeLots(s.db, portion, open...); err != nil {
+		logrus.Errorf("Failed to remove sold lots of order %d: %v", order.ID, err)
+	}
 }
 
-func (s *Service) recordTransaction(order *models.Order) {
+// recordTransaction 记录订单已成交filled件之后的quantity件的成交，部分成交时每次成交各记一笔
+func (s *Service) recordTransaction(order *models.Order, filled, quantity int) {
 	transaction := models.Transaction{
 		UserID:      order.UserID,
 		OrderID:     order.ID,
 		Type:        order.Type,
-		Amount:      order.Price * float64(order.Quantity),
+		Quantity:    quantity,
+		Amount:      order.Price * float64(quantity),
 		Platform:    order.Platform,
-		CompletedAt: time.Now(),
+		CompletedAt: s.now(),
 	}
 	
-	// 计算手续费（简化处理）
-	transaction.Fee = transaction.Amount * 0.025 // 2.5%手续费
-	
-	// 如果是卖单，计算利润
+	// 按平台手续费计算
 	if order.Type == "sell" {
-		var buyPrice float64
-		s.db.Model(&models.Inventory{}).
-			Where("user_id = ? AND item_id = ?", order.UserID, order.ItemID).
-			Select("buy_price").Scan(&buyPrice)
-		transaction.Profit = (order.Price - buyPrice) * float64(order.Quantity) - transaction.Fee
+		transaction.Fee = s.sellFee(order.Platform, transaction.Amount)
+	} else {
+		transaction.Fee = s.buyFee(order.Platform, transaction.Amount)
 	}
 	
-	s.db.Create(&transaction)
+	// 如果是卖单，按成交对应的批次计算成本和利润；没有可匹配的批次时按持仓平均成本计算
+	if order.Type == "sell" {
+		if lots := orderLots(order); lots != nil {
+			portion, _ := fillLots(lots, filled, quantity)
+			transaction.CostBasis = costBasis(portion)
+			transaction.LotMethod = order.LotMethod
+			transaction.Lots, _ = encodeLots(portion)
+		} else {
+			var avgPrice float64
+			s.db.Model(&models.Position{}).
+				Where("user_id = ? AND item_id = ?", order.UserID, order.ItemID).
+				Select("avg_price").Scan(&avgPrice)
+			transaction.CostBasis = avgPrice * float64(quantity)
+		}
+		transaction.Profit = transaction.Amount - transaction.CostBasis - transaction.Fee
+	}
+
+	// 成交额和手续费分别记入资金流水，持仓按平均成本同步更新
+	amount := transaction.Amount
+	if order.Type == "buy" {
+		amount = -amount
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&transaction).Error; err != nil {
+			return err
+		}
+		var err error
+		if order.Type == "sell" {
+			_, err = positions.Sell(tx, order.UserID, order.ItemID, quantity, transaction.Amount-transaction.Fee)
+		} else {
+			err = positions.Buy(tx, order.UserID, order.ItemID, quantity, transaction.Amount+transaction.Fee)
+		}
+		if err != nil {
+			return err
+		}
+		if err := ledger.Post(tx, &models.LedgerEntry{UserID: order.UserID, Type: ledger.TypeTrade, Amount: amount, OrderID: &order.ID}); err != nil {
+			return err
+		}
+		if transaction.Fee == 0 {
+			return nil
+		}
+		return ledger.Post(tx, &models.LedgerEntry{UserID: order.UserID, Type: ledger.TypeFee, Amount: -transaction.Fee, OrderID: &order.ID})
+	})
+	if err != nil {
+		logrus.Errorf("Failed to record transaction for order %d: %v", order.ID, err)
+	}
+}
+
+// GetPositions 用户的持仓、平均成本和盈亏
+func (s *Service) GetPositions(userID uint) ([]models.Position, error) {
+	return positions.List(s.db, userID)
+}
+
+// GetLedger 用户的余额和最近的资金流水
+func (s *Service) GetLedger(userID uint, limit int) (float64, []models.LedgerEntry, error) {
+	balance, err := ledger.Balance(s.db, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	entries, err := ledger.Entries(s.db, userID, limit)
+	return balance, entries, err
 }
 
 // Platform specific implementations (需要根据实际API实现)
@@ -0,0 +1,139 @@
+package trading
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database"
+	"csgo2-trading-bot/database/dbtest"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/fx"
+	"csgo2-trading-bot/services/httpclient"
+	"csgo2-trading-bot/services/ledger"
+	"csgo2-trading-bot/services/outbox"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// testRates 测试使用的固定汇率，与模拟市场的汇率一致
+var testRates = map[string]float64{"USD": 1, "EUR": 1 / 0.92, "RUB": 1.0 / 90}
+
+// newTestService 连接测试库的交易服务。Redis指向不可达地址，执行队列使用进程内队列
+func newTestService(t *testing.T, db *gorm.DB, cfg config.TradingConfig) *Service {
+	t.Helper()
+	cache := database.NewCache(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 50 * time.Millisecond}))
+	fxService := fx.NewService(config.FXConfig{}, "USD", testRates, cache, fx.StaticProvider(testRates))
+	return NewService(db, cache, cfg, nil, scheduler.New(), httpclient.New(config.HTTPClientConfig{}), fxService, nil, nil, outbox.NewRelay(db, config.OutboxConfig{}))
+}
+
+func createTestUser(t *testing.T, db *gorm.DB, balance float64) *models.User {
+	t.Helper()
+	user := &models.User{SteamID: fmt.Sprintf("7656%d", time.Now().UnixNano()), Username: "tester"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if balance != 0 {
+		if err := ledger.Post(db, &models.LedgerEntry{UserID: user.ID, Type: ledger.TypeAdjustment, Amount: balance}); err != nil {
+			t.Fatalf("post balance: %v", err)
+		}
+	}
+	return user
+}
+
+func createTestItem(t *testing.T, db *gorm.DB, name string, price float64) *models.Item {
+	t.Helper()
+	item := &models.Item{MarketHashName: name, Name: name, CurrentPrice: price, LastUpdated: time.Now()}
+	if err := db.Create(item).Error; err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+	return item
+}
+
+// submitConcurrently 同时调用n次submit，返回成功的次数
+func submitConcurrently(n int, submit func() error) int {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if submit() == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return succeeded
+}
+
+func TestConcurrentBuyOrdersCannotOverdraw(t *testing.T) {
+	db := dbtest.Open(t)
+	s := newTestService(t, db, config.TradingConfig{})
+	user := createTestUser(t, db, 100)
+	item := createTestItem(t, db, "AK-47 | Redline (Field-Tested)", 30)
+
+	const price = 30.0
+	want := int(math.Floor(100 / (price + s.buyFee("buff", price))))
+
+	succeeded := submitConcurrently(10, func() error {
+		_, err := s.CreateBuyOrder(user.ID, item.ID, price, 1, "buff", nil)
+		return err
+	})
+	if succeeded != want {
+		t.Fatalf("%d buy orders accepted, want %d", succeeded, want)
+	}
+
+	available, err := s.availableBalance(db, user.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available < 0 {
+		t.Fatalf("available balance %.2f is negative", available)
+	}
+}
+
+func TestConcurrentSellOrdersCannotDoubleSell(t *testing.T) {
+	db := dbtest.Open(t)
+	s := newTestService(t, db, config.TradingConfig{})
+	user := createTestUser(t, db, 0)
+	item := createTestItem(t, db, "AWP | Asiimov (Field-Tested)", 80)
+
+	lot := models.Inventory{UserID: user.ID, ItemID: item.ID, AssetID: "1001", Quantity: 1, BuyPrice: 70, Platform: "buff", AcquiredAt: time.Now(), Tradable: true}
+	if err := db.Create(&lot).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	succeeded := submitConcurrently(10, func() error {
+		_, err := s.CreateSellOrder(user.ID, item.ID, 90, 1, "buff", "", nil)
+		return err
+	})
+	if succeeded != 1 {
+		t.Fatalf("%d sell orders accepted for a single lot, want 1", succeeded)
+	}
+
+	var orders []models.Order
+	if err := db.Where("user_id = ? AND type = ?", user.ID, "sell").Find(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 {
+		t.Fatalf("%d sell orders stored, want 1", len(orders))
+	}
+	lots := orderLots(&orders[0])
+	if len(lots) != 1 || lots[0].InventoryID != lot.ID {
+		t.Fatalf("sell order lots = %+v, want inventory %d", lots, lot.ID)
+	}
+}
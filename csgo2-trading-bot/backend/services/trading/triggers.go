@@ -0,0 +1,262 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/market"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 条件单类型：下单后不立即执行，价格满足条件时才交给执行队列
+const (
+	OrderKindTakeProfit = "take_profit" // OCO止盈腿：价格不低于Price时卖出
+	OrderKindStopLoss   = "stop_loss"   // OCO止损腿：价格不高于StopPrice时按Price卖出
+	OrderKindStop       = "stop"        // 止损单：价格穿过StopPrice后按触发时的价格成交
+	OrderKindStopLimit  = "stop_limit"  // 止损限价单：价格穿过StopPrice后按Price限价成交
+)
+
+// ErrInvalidStopOrder 止损单参数不合法
+var ErrInvalidStopOrder = errors.New("invalid stop order")
+
+// StopRequest 止损单和止损限价单。买单价格不低于StopPrice时触发（突破买入），卖单价格不高于StopPrice时触发
+type StopRequest struct {
+	Type       string // buy、sell
+	ItemID     uint
+	Quantity   int
+	Platform   string
+	LotMethod  string
+	StopPrice  float64
+	LimitPrice float64 // 0表示止损单，触发后按当时的价格成交
+	ExpiresAt  *time.Time
+}
+
+// CreateStopOrder 提交止损单或止损限价单：余额、风控检查和卖单的库存锁定在下单时完成，
+// 订单保持pending直到价格触发才交给执行队列
+func (s *Service) CreateStopOrder(userID uint, req StopRequest) (*models.Order, error) {
+	if req.Type != "buy" && req.Type != "sell" {
+		return nil, fmt.Errorf("%w: type must be buy or sell", ErrInvalidStopOrder)
+	}
+	if req.StopPrice <= 0 || req.LimitPrice < 0 {
+		return nil, fmt.Errorf("%w: stop_price must be positive and limit_price must not be negative", ErrInvalidStopOrder)
+	}
+	if err := validateExpiry(req.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	stopPrice := req.StopPrice
+	order := &models.Order{
+		UserID:    userID,
+		ItemID:    req.ItemID,
+		Type:      req.Type,
+		Price:     req.LimitPrice,
+		Quantity:  req.Quantity,
+		Platform:  req.Platform,
+		ExpiresAt: req.ExpiresAt,
+		Kind:      OrderKindStopLimit,
+		StopPrice: &stopPrice,
+	}
+	if req.LimitPrice == 0 {
+		// 成交价在触发时才确定，下单时按触发价估算金额
+		order.Kind, order.Price = OrderKindStop, req.StopPrice
+	}
+
+	var err error
+	if req.Type == "buy" {
+		err = s.submitBuyOrder(order)
+	} else {
+		order.LotMethod = req.LotMethod
+		err = s.submitSellOrder(order, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// WatchPrices 订阅行情服务的价格更新驱动条件单触发，需在开始接收价格前调用。
+// 只有存在未触发条件单的物品才进入队列，由TriggerOrders启动的协程按顺序评估
+func (s *Service) WatchPrices(marketService *market.Service) {
+	marketService.OnPriceUpdate(func(update market.PriceUpdate) {
+		if !s.watchingItem(update.ItemID) {
+			return
+		}
+		select {
+		case s.priceTicks <- update:
+		default:
+			logrus.Debugf("Order trigger queue is full, item %d update dropped", update.ItemID)
+		}
+	})
+}
+
+// TriggerOrders 启动条件单触发：实时价格更新由单独的协程评估，另按interval扫描全部未触发的条件单，
+// 覆盖平台同步等直接写库的价格来源，并刷新需要关注价格的物品
+func (s *Service) TriggerOrders(interval time.Duration) error {
+	s.checkTriggers()
+	go func() {
+		for update := range s.priceTicks {
+			s.onPriceTick(update)
+		}
+	}()
+
+	return s.scheduler.Add(scheduler.Job{
+		ID:   "order_triggers",
+		Spec: interval.String(),
+		Run:  s.checkTriggers,
+	})
+}
+
+// onPriceTick 评估下单平台与价格来源一致的未触发条件单
+func (s *Service) onPriceTick(update market.PriceUpdate) {
+	var orders []models.Order
+	if err := s.db.Where("status = ? AND kind <> '' AND triggered_at IS NULL AND item_id = ? AND platform = ?",
+		"pending", update.ItemID, update.Platform).Find(&orders).Error; err != nil {
+		logrus.Errorf("Failed to load conditional orders for item %d: %v", update.ItemID, err)
+		return
+	}
+	for i := range orders {
+		if orderTriggered(&orders[i], update.Price) {
+			s.triggerOrder(&orders[i], update.Price)
+		}
+	}
+}
+
+// checkTriggers 按物品当前价格扫描全部未触发的条件单
+func (s *Service) checkTriggers() {
+	var orders []models.Order
+	if err := s.db.Preload("Item").
+		Where("status = ? AND kind <> '' AND triggered_at IS NULL", "pending").
+		Find(&orders).Error; err != nil {
+		logrus.Errorf("Failed to load conditional orders: %v", err)
+		return
+	}
+
+	watched := make(map[uint]bool, len(orders))
+	for i := range orders {
+		order := &orders[i]
+		if orderTriggered(order, order.Item.CurrentPrice) && s.triggerOrder(order, order.Item.CurrentPrice) {
+			continue
+		}
+		watched[order.ItemID] = true
+	}
+
+	s.triggerMu.Lock()
+	s.triggerItems = watched
+	s.triggerMu.Unlock()
+}
+
+// triggerOrder 记录条件单触发并交给执行队列，止损单的价格改为触发时的价格；止损买单余额不足以按触发价成交时订单失败。
+// 已被其他协程触发、已结束或处于维护模式时返回false
+func (s *Service) triggerOrder(order *models.Order, price float64) bool {
+	// 维护期间不触发，维护结束后的价格更新或定期扫描会再次评估
+	if s.underMaintenance() {
+		return false
+	}
+	now := time.Now()
+	data := orderEventData{TriggeredAt: &now}
+	if order.Kind == OrderKindStop {
+		data.Price = price
+	}
+
+	triggered, rejected := false, false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 止损买单下单时按StopPrice占用资金，价格跳空时触发价可能远高于StopPrice，按触发价重新检查余额。
+		// 与下单、修改订单一样先锁定用户行
+		recheck := order.Type == "buy" && order.Kind == OrderKindStop
+		if recheck {
+			if err := lockUser(tx, order.UserID); err != nil {
+				return err
+			}
+		}
+
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND status = ? AND triggered_at IS NULL", order.ID, "pending").
+			Update("triggered_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if recheck && !s.checkUserBalance(tx, order.UserID, order.Platform, price*float64(order.Quantity-order.FilledQuantity), order.ID) {
+			rejected = true
+			return s.transitionOrder(tx, order, OrderFailed, orderEventData{
+				Reason: fmt.Sprintf("insufficient balance to buy at trigger price %.2f", price),
+			})
+		}
+		if err := s.transitionOrder(tx, order, OrderTriggered, data); err != nil {
+			return err
+		}
+		triggered = true
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("Failed to trigger order %d: %v", order.ID, err)
+		return false
+	}
+	if rejected {
+		s.outbox.Kick()
+		logrus.Warnf("Stop order %d failed at trigger price %.2f: insufficient balance", order.ID, price)
+		return true
+	}
+	if !triggered {
+		return false
+	}
+	s.outbox.Kick()
+
+	order.TriggeredAt = &now
+	logrus.Infof("Order %d (%s) triggered at price %.2f", order.ID, order.Kind, price)
+	s.enqueueExecution(order)
+	return true
+}
+
+// orderTriggered 条件单在给定价格下是否满足触发条件
+func orderTriggered(order *models.Order, price float64) bool {
+	if price <= 0 {
+		return false
+	}
+	switch order.Kind {
+	case OrderKindTakeProfit:
+		return price >= order.Price
+	case OrderKindStopLoss:
+		return order.StopPrice != nil && price <= *order.StopPrice
+	case OrderKindStop, OrderKindStopLimit:
+		if order.StopPrice == nil {
+			return false
+		}
+		if order.Type == "buy" {
+			return price >= *order.StopPrice
+		}
+		return price <= *order.StopPrice
+	}
+	return false
+}
+
+// dispatchOrder 提交后的订单交给执行队列，条件单改为关注价格等待触发
+func (s *Service) dispatchOrder(order *models.Order) {
+	if awaitingTrigger(order) {
+		s.watchTrigger(order.ItemID)
+		return
+	}
+	s.enqueueExecution(order)
+}
+
+// awaitingTrigger 条件单尚未触发，不能执行
+func awaitingTrigger(order *models.Order) bool {
+	return order.Kind != "" && order.TriggeredAt == nil
+}
+
+// watchTrigger 新提交的条件单所在物品加入价格关注，不必等到下次扫描
+func (s *Service) watchTrigger(itemID uint) {
+	s.triggerMu.Lock()
+	s.triggerItems[itemID] = true
+	s.triggerMu.Unlock()
+}
+
+func (s *Service) watchingItem(itemID uint) bool {
+	s.triggerMu.RLock()
+	defer s.triggerMu.RUnlock()
+	return s.triggerItems[itemID]
+}
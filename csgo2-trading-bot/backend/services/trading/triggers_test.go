@@ -0,0 +1,66 @@
+package trading
+
+import (
+	"strings"
+	"testing"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database/dbtest"
+	"csgo2-trading-bot/models"
+)
+
+// TestGappedBuyStopRechecksBalance 止损买单按StopPrice占用资金，价格跳空到余额买不起的价位触发时订单失败，不进入执行队列
+func TestGappedBuyStopRechecksBalance(t *testing.T) {
+	db := dbtest.Open(t)
+	s := newTestService(t, db, config.TradingConfig{})
+	user := createTestUser(t, db, 100)
+	item := createTestItem(t, db, "Desert Eagle | Blaze (Factory New)", 45)
+
+	order, err := s.CreateStopOrder(user.ID, StopRequest{Type: "buy", ItemID: item.ID, Quantity: 1, Platform: "buff", StopPrice: 50})
+	if err != nil {
+		t.Fatalf("CreateStopOrder: %v", err)
+	}
+
+	if !s.triggerOrder(order, 150) {
+		t.Fatal("gapped stop order was left waiting for a trigger")
+	}
+
+	var stored models.Order
+	if err := db.First(&stored, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "failed" || !strings.Contains(stored.FailedReason, "insufficient balance") {
+		t.Fatalf("order status %q reason %q, want failed for insufficient balance", stored.Status, stored.FailedReason)
+	}
+	available, err := s.availableBalance(db, user.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available != 100 {
+		t.Fatalf("available balance %.2f after the failed stop order, want 100", available)
+	}
+}
+
+// TestBuyStopTriggersWithinBalance 触发价仍在余额范围内时按触发价成交
+func TestBuyStopTriggersWithinBalance(t *testing.T) {
+	db := dbtest.Open(t)
+	s := newTestService(t, db, config.TradingConfig{})
+	user := createTestUser(t, db, 100)
+	item := createTestItem(t, db, "Glock-18 | Fade (Factory New)", 45)
+
+	order, err := s.CreateStopOrder(user.ID, StopRequest{Type: "buy", ItemID: item.ID, Quantity: 1, Platform: "buff", StopPrice: 50})
+	if err != nil {
+		t.Fatalf("CreateStopOrder: %v", err)
+	}
+	if !s.triggerOrder(order, 60) {
+		t.Fatal("stop order did not trigger")
+	}
+
+	var stored models.Order
+	if err := db.First(&stored, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "pending" || stored.TriggeredAt == nil || stored.Price != 60 {
+		t.Fatalf("order status %q triggered_at %v price %.2f, want pending, triggered at 60", stored.Status, stored.TriggeredAt, stored.Price)
+	}
+}
@@ -0,0 +1,146 @@
+package verify
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Violation 一条不变量违规记录
+type Violation struct {
+	Check    string `json:"check"`
+	Entity   string `json:"entity"`
+	EntityID uint   `json:"entity_id"`
+	UserID   uint   `json:"user_id"`
+	Detail   string `json:"detail"`
+}
+
+// CheckResult 单项检查结果
+type CheckResult struct {
+	Name       string      `json:"name"`
+	Passed     bool        `json:"passed"`
+	Violations []Violation `json:"violations"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// Report 完整性检查报告
+type Report struct {
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	Passed     bool          `json:"passed"`
+	Checks     []CheckResult `json:"checks"`
+}
+
+type check struct {
+	name   string
+	entity string
+	query  string
+}
+
+// 每条查询返回违规行：entity_id, user_id, detail
+var checks = []check{
+	{
+		// 已完成的订单必须有对应的交易记录
+		name:   "completed_order_has_transaction",
+		entity: "order",
+		query: `
+			SELECT o.id AS entity_id, o.user_id, 'order ' || o.type || ' completed without transaction' AS detail
+			FROM orders o
+			LEFT JOIN transactions t ON t.order_id = o.id AND t.deleted_at IS NULL
+			WHERE o.status = 'completed' AND o.deleted_at IS NULL AND t.id IS NULL`,
+	},
+	{
+		// 库存数量不能为负
+		name:   "inventory_non_negative",
+		entity: "inventory",
+		query: `
+			SELECT i.id AS entity_id, i.user_id, 'quantity ' || i.quantity AS detail
+			FROM inventories i
+			WHERE i.quantity < 0 AND i.deleted_at IS NULL`,
+	},
+	{
+		// 被锁定的库存必须有未完成的卖单
+		name:   "locked_inventory_has_pending_order",
+		entity: "inventory",
+		query: `
+			SELECT i.id AS entity_id, i.user_id, 'locked item ' || i.item_id || ' has no pending sell order' AS detail
+			FROM inventories i
+			WHERE i.locked = true AND i.deleted_at IS NULL
+			  AND NOT EXISTS (
+				SELECT 1 FROM orders o
+				WHERE o.user_id = i.user_id AND o.item_id = i.item_id
+				  AND o.type = 'sell' AND o.status = 'pending' AND o.deleted_at IS NULL
+			  )`,
+	},
+	{
+		// 交易金额必须与订单成交金额一致
+		name:   "transaction_amount_matches_order",
+		entity: "transaction",
+		query: `
+			SELECT t.id AS entity_id, t.user_id,
+			       'amount ' || t.amount || ' != order ' || (o.price * o.quantity) AS detail
+			FROM transactions t
+			JOIN orders o ON o.id = t.order_id
+			WHERE t.deleted_at IS NULL AND ABS(t.amount - o.price * o.quantity) > 0.01`,
+	},
+	{
+		// 交易记录必须对应一个已完成的订单
+		name:   "transaction_has_completed_order",
+		entity: "transaction",
+		query: `
+			SELECT t.id AS entity_id, t.user_id, 'order ' || t.order_id || ' is missing or not completed' AS detail
+			FROM transactions t
+			LEFT JOIN orders o ON o.id = t.order_id AND o.deleted_at IS NULL
+			WHERE t.deleted_at IS NULL AND (o.id IS NULL OR o.status <> 'completed')`,
+	},
+}
+
+// Service 数据完整性检查，只报告问题，不自动修复
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Run 执行所有不变量检查
+func (s *Service) Run(ctx context.Context) *Report {
+	report := &Report{
+		StartedAt: time.Now(),
+		Passed:    true,
+	}
+
+	for _, c := range checks {
+		result := CheckResult{Name: c.name, Violations: []Violation{}}
+
+		var rows []struct {
+			EntityID uint
+			UserID   uint
+			Detail   string
+		}
+		if err := s.db.WithContext(ctx).Raw(c.query).Scan(&rows).Error; err != nil {
+			result.Error = err.Error()
+		}
+
+		for _, row := range rows {
+			result.Violations = append(result.Violations, Violation{
+				Check:    c.name,
+				Entity:   c.entity,
+				EntityID: row.EntityID,
+				UserID:   row.UserID,
+				Detail:   row.Detail,
+			})
+		}
+
+		result.Passed = result.Error == "" && len(result.Violations) == 0
+		if !result.Passed {
+			report.Passed = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	report.FinishedAt = time.Now()
+	return report
+}
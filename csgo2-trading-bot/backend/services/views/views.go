@@ -0,0 +1,215 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/market"
+	"csgo2-trading-bot/services/trading"
+
+	"gorm.io/gorm"
+)
+
+// 视图可筛选的列表
+const (
+	TargetOrders      = "orders"
+	TargetMarketItems = "market_items"
+)
+
+// Filters 视图保存的筛选条件，按Target使用其中的字段
+type Filters struct {
+	Query      string     `json:"q,omitempty"`
+	MinPrice   float64    `json:"min_price,omitempty"`
+	MaxPrice   float64    `json:"max_price,omitempty"`
+	Types      []string   `json:"types,omitempty"`
+	Platforms  []string   `json:"platforms,omitempty"`
+	Statuses   []string   `json:"statuses,omitempty"`
+	From       *time.Time `json:"from,omitempty"`
+	To         *time.Time `json:"to,omitempty"`
+	Days       int        `json:"days,omitempty"` // 相对时间窗口，执行时换算为最近N天
+	StrategyID *uint      `json:"strategy_id,omitempty"`
+	Sort       string     `json:"sort,omitempty"`
+	Desc       bool       `json:"desc,omitempty"`
+
+	ItemType string `json:"item_type,omitempty"`
+	Rarity   string `json:"rarity,omitempty"`
+	Trend    string `json:"trend,omitempty"` // rising, falling
+}
+
+// Result 视图执行结果
+type Result struct {
+	View     models.SavedView `json:"view"`
+	Orders   []models.Order   `json:"orders,omitempty"`
+	Items    []models.Item    `json:"items,omitempty"`
+	Total    int64            `json:"total"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+}
+
+// Service 保存的筛选视图，在服务端执行以便API、CLI和机器人复用
+type Service struct {
+	db      *gorm.DB
+	trading *trading.Service
+	market  *market.Service
+}
+
+func NewService(db *gorm.DB, tradingService *trading.Service, marketService *market.Service) *Service {
+	return &Service{
+		db:      db,
+		trading: tradingService,
+		market:  marketService,
+	}
+}
+
+// List 获取用户的所有视图
+func (s *Service) List(userID uint) ([]models.SavedView, error) {
+	var views []models.SavedView
+	err := s.db.Where("user_id = ?", userID).Order("name").Find(&views).Error
+	return views, err
+}
+
+// Get 获取单个视图
+func (s *Service) Get(viewID, userID uint) (*models.SavedView, error) {
+	var view models.SavedView
+	if err := s.db.Where("id = ? AND user_id = ?", viewID, userID).First(&view).Error; err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// GetByName 按名称获取视图，供命令行和机器人使用
+func (s *Service) GetByName(userID uint, name string) (*models.SavedView, error) {
+	var view models.SavedView
+	if err := s.db.Where("user_id = ? AND name = ?", userID, name).First(&view).Error; err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// Create 保存新视图
+func (s *Service) Create(userID uint, name, target string, filters Filters) (*models.SavedView, error) {
+	view := models.SavedView{UserID: userID}
+	if err := applyView(&view, name, target, filters); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&view).Error; err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// Update 修改视图
+func (s *Service) Update(viewID, userID uint, name, target string, filters Filters) (*models.SavedView, error) {
+	view, err := s.Get(viewID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyView(view, name, target, filters); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(view).Error; err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+// Delete 删除视图
+func (s *Service) Delete(viewID, userID uint) error {
+	return s.db.Where("id = ? AND user_id = ?", viewID, userID).Delete(&models.SavedView{}).Error
+}
+
+// Execute 执行视图并返回结果
+func (s *Service) Execute(view *models.SavedView, page, pageSize int) (*Result, error) {
+	var filters Filters
+	if view.Filters != "" {
+		if err := json.Unmarshal([]byte(view.Filters), &filters); err != nil {
+			return nil, fmt.Errorf("invalid view filters: %v", err)
+		}
+	}
+
+	if filters.Days > 0 {
+		from := time.Now().AddDate(0, 0, -filters.Days)
+		filters.From = &from
+	}
+
+	result := &Result{View: *view, Page: page, PageSize: pageSize}
+
+	switch view.Target {
+	case TargetOrders:
+		orders, total, err := s.trading.SearchOrders(view.UserID, trading.OrderSearch{
+			Text:       filters.Query,
+			Types:      filters.Types,
+			Platforms:  filters.Platforms,
+			Statuses:   filters.Statuses,
+			MinPrice:   filters.MinPrice,
+			MaxPrice:   filters.MaxPrice,
+			From:       filters.From,
+			To:         filters.To,
+			StrategyID: filters.StrategyID,
+			SortBy:     filters.Sort,
+			SortDesc:   filters.Desc,
+			Page:       page,
+			PageSize:   pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Orders = orders
+		result.Total = total
+
+	case TargetMarketItems:
+		marketFilters := map[string]interface{}{
+			"type":   filters.ItemType,
+			"rarity": filters.Rarity,
+			"q":      filters.Query,
+			"trend":  filters.Trend,
+		}
+		if filters.MinPrice > 0 {
+			marketFilters["min_price"] = filters.MinPrice
+		}
+		if filters.MaxPrice > 0 {
+			marketFilters["max_price"] = filters.MaxPrice
+		}
+
+		items, total, err := s.market.GetMarketItems(page, pageSize, marketFilters)
+		if err != nil {
+			return nil, err
+		}
+		result.Items = items
+		result.Total = total
+
+	default:
+		return nil, fmt.Errorf("unknown view target: %s", view.Target)
+	}
+
+	return result, nil
+}
+
+func applyView(view *models.SavedView, name, target string, filters Filters) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("view name is required")
+	}
+	if target != TargetOrders && target != TargetMarketItems {
+		return fmt.Errorf("unknown view target: %s", target)
+	}
+	if filters.Trend != "" && filters.Trend != "rising" && filters.Trend != "falling" {
+		return fmt.Errorf("unknown trend: %s", filters.Trend)
+	}
+
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return err
+	}
+
+	view.Name = name
+	view.Target = target
+	view.Filters = string(data)
+	return nil
+}
@@ -0,0 +1,293 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/httpclient"
+	"csgo2-trading-bot/services/market"
+	"csgo2-trading-bot/services/notify"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound 订阅不存在或不属于当前用户
+var ErrNotFound = errors.New("watch not found")
+
+// Event 趋势订阅触发的事件，同时用于通知和Webhook请求体
+type Event struct {
+	Event    string    `json:"event"` // trend_flip, rsi_above, rsi_below
+	WatchID  uint      `json:"watch_id"`
+	ItemID   uint      `json:"item_id"`
+	ItemName string    `json:"item_name"`
+	From     string    `json:"from,omitempty"`
+	To       string    `json:"to,omitempty"`
+	Price    float64   `json:"price"`
+	RSI      float64   `json:"rsi"`
+	Time     time.Time `json:"time"`
+}
+
+// Service 物品趋势订阅，定期评估趋势并在状态确认变化后推送
+type Service struct {
+	db       *gorm.DB
+	market   *market.Service
+	notifier *notify.Router
+	http     *http.Client
+	config   config.WatchConfig
+}
+
+func NewService(db *gorm.DB, marketService *market.Service, notifier *notify.Router, httpClient *http.Client, cfg config.WatchConfig) *Service {
+	if cfg.Confirmations <= 0 {
+		cfg.Confirmations = 1
+	}
+	return &Service{
+		db:       db,
+		market:   marketService,
+		notifier: notifier,
+		http:     httpClient,
+		config:   cfg,
+	}
+}
+
+// Start 注册定期评估任务
+func (s *Service) Start(sched *scheduler.Scheduler) error {
+	return sched.Add(scheduler.Job{
+		ID:   "item_watch",
+		Spec: (time.Duration(s.config.Interval) * time.Second).String(),
+		Run:  s.Evaluate,
+	})
+}
+
+// List 获取用户的趋势订阅
+func (s *Service) List(userID uint) ([]models.ItemWatch, error) {
+	var watches []models.ItemWatch
+	err := s.db.Preload("Item").Where("user_id = ?", userID).Order("created_at DESC").Find(&watches).Error
+	return watches, err
+}
+
+// Create 订阅物品趋势
+func (s *Service) Create(userID uint, watch models.ItemWatch) (*models.ItemWatch, error) {
+	if watch.WebhookURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := httpclient.ValidatePublicURL(ctx, watch.WebhookURL)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("webhook_url %v", err)
+		}
+	}
+	if watch.RSIAbove < 0 || watch.RSIAbove > 100 || watch.RSIBelow < 0 || watch.RSIBelow > 100 {
+		return nil, errors.New("rsi thresholds must be between 0 and 100")
+	}
+	if watch.RSIAbove > 0 && watch.RSIBelow > 0 && watch.RSIBelow >= watch.RSIAbove {
+		return nil, errors.New("rsi_below must be lower than rsi_above")
+	}
+
+	var item models.Item
+	if err := s.db.Select("id").First(&item, watch.ItemID).Error; err != nil {
+		return nil, errors.New("item not found")
+	}
+
+	var count int64
+	s.db.Model(&models.ItemWatch{}).Where("user_id = ? AND item_id = ?", userID, watch.ItemID).Count(&count)
+	if count > 0 {
+		return nil, errors.New("item is already watched")
+	}
+
+	created := models.ItemWatch{
+		UserID:     userID,
+		ItemID:     watch.ItemID,
+		WebhookURL: watch.WebhookURL,
+		RSIAbove:   watch.RSIAbove,
+		RSIBelow:   watch.RSIBelow,
+	}
+	if err := s.db.Create(&created).Error; err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Delete 取消订阅
+func (s *Service) Delete(watchID, userID uint) error {
+	result := s.db.Unscoped().Where("id = ? AND user_id = ?", watchID, userID).Delete(&models.ItemWatch{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Evaluate 评估所有订阅，同一物品的指标只计算一次
+func (s *Service) Evaluate() {
+	var watches []models.ItemWatch
+	if err := s.db.Preload("Item").Find(&watches).Error; err != nil {
+		logrus.Errorf("Failed to load item watches: %v", err)
+		return
+	}
+
+	signals := make(map[uint]*market.TrendSignal)
+	for i := range watches {
+		watch := &watches[i]
+
+		signal, ok := signals[watch.ItemID]
+		if !ok {
+			var err error
+			signal, err = s.market.GetTrendSignal(watch.ItemID)
+			if err != nil {
+				logrus.Warnf("Failed to compute trend for item %d: %v", watch.ItemID, err)
+				continue
+			}
+			signals[watch.ItemID] = signal
+		}
+
+		events := s.apply(watch, signal)
+		if len(events) > 0 && s.coolingDown(watch) {
+			logrus.Debugf("Item watch %d is cooling down, %d events suppressed", watch.ID, len(events))
+			events = nil
+		}
+		if len(events) > 0 {
+			now := time.Now()
+			watch.LastNotifiedAt = &now
+		}
+
+		if err := s.db.Model(watch).
+			Select("trend", "zone", "pending_trend", "pending_zone", "trend_count", "zone_count", "last_notified_at").
+			Updates(watch).Error; err != nil {
+			logrus.Errorf("Failed to save item watch %d: %v", watch.ID, err)
+			continue
+		}
+
+		for _, event := range events {
+			s.notify(watch, event)
+		}
+	}
+}
+
+// apply 根据最新指标推进订阅状态，返回确认后的变化事件
+func (s *Service) apply(watch *models.ItemWatch, signal *market.TrendSignal) []Event {
+	var events []Event
+	newEvent := func(name, from, to string) Event {
+		return Event{
+			Event:    name,
+			WatchID:  watch.ID,
+			ItemID:   watch.ItemID,
+			ItemName: watch.Item.Name,
+			From:     from,
+			To:       to,
+			Price:    signal.Price,
+			RSI:      signal.RSI,
+			Time:     time.Now(),
+		}
+	}
+
+	// 中性读数不改变已确认的趋势，但会打断连续确认
+	if signal.Trend == "neutral" {
+		watch.PendingTrend, watch.TrendCount = "", 0
+	} else {
+		previous := watch.Trend
+		if debounce(&watch.Trend, &watch.PendingTrend, &watch.TrendCount, signal.Trend, s.config.Confirmations) && previous != "" {
+			events = append(events, newEvent("trend_flip", previous, watch.Trend))
+		}
+	}
+
+	zone := ""
+	if watch.RSIAbove > 0 && signal.RSI >= watch.RSIAbove {
+		zone = "above"
+	} else if watch.RSIBelow > 0 && signal.RSI <= watch.RSIBelow {
+		zone = "below"
+	}
+	previous := watch.Zone
+	if debounce(&watch.Zone, &watch.PendingZone, &watch.ZoneCount, zone, s.config.Confirmations) && zone != "" {
+		events = append(events, newEvent("rsi_"+zone, previous, zone))
+	}
+
+	return events
+}
+
+// debounce 新状态需连续出现confirmations次才会被确认，返回是否确认了变化
+func debounce(confirmed, pending *string, count *int, observed string, confirmations int) bool {
+	if observed == *confirmed {
+		*pending, *count = "", 0
+		return false
+	}
+	if observed != *pending {
+		*pending, *count = observed, 0
+	}
+	*count++
+	if *count < confirmations {
+		return false
+	}
+	*confirmed, *pending, *count = observed, "", 0
+	return true
+}
+
+func (s *Service) coolingDown(watch *models.ItemWatch) bool {
+	if watch.LastNotifiedAt == nil || s.config.Cooldown <= 0 {
+		return false
+	}
+	return time.Since(*watch.LastNotifiedAt) < time.Duration(s.config.Cooldown)*time.Second
+}
+
+// notify 发布趋势通知，并调用订阅配置的Webhook
+func (s *Service) notify(watch *models.ItemWatch, event Event) {
+	data, _ := json.Marshal(event)
+
+	s.notifier.Publish(watch.UserID, notify.Message{
+		Event: notify.EventTrendAlert,
+		Title: eventTitle(event),
+		Body:  fmt.Sprintf("%s 当前价格 %.2f，RSI %.1f", event.ItemName, event.Price, event.RSI),
+		Data:  event,
+	})
+
+	if watch.WebhookURL == "" {
+		return
+	}
+	if err := s.postWebhook(watch.WebhookURL, data); err != nil {
+		logrus.Warnf("Item watch %d webhook failed: %v", watch.ID, err)
+	}
+}
+
+func (s *Service) postWebhook(endpoint string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func eventTitle(event Event) string {
+	switch event.Event {
+	case "trend_flip":
+		if event.To == "bullish" {
+			return "趋势转为上涨"
+		}
+		return "趋势转为下跌"
+	case "rsi_above":
+		return "RSI突破上限"
+	default:
+		return "RSI跌破下限"
+	}
+}
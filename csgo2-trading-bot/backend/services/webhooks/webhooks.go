@@ -0,0 +1,421 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/httpclient"
+	"csgo2-trading-bot/services/scheduler"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// 可订阅的事件
+const (
+	EventOrderCompleted  = "order.completed"
+	EventOrderFailed     = "order.failed"
+	EventPriceAlert      = "price.alert"
+	EventStrategyError   = "strategy.error"
+	EventStrategyStopped = "strategy.stopped"
+	EventArbitrageAlert  = "arbitrage.alert"
+	EventLoginNewDevice  = "login.new_device"
+	EventPing            = "ping"
+)
+
+// Events 用户可以订阅的事件列表
+var Events = []string{
+	EventOrderCompleted, EventOrderFailed, EventPriceAlert, EventStrategyError,
+	EventStrategyStopped, EventArbitrageAlert, EventLoginNewDevice,
+}
+
+// 投递开始后，在该时间内重试任务不会再次领取同一条记录
+const deliveryLease = 2 * time.Minute
+
+// ErrNotFound Webhook不存在或不属于当前用户
+var ErrNotFound = errors.New("webhook not found")
+
+// Payload 投递的请求体
+type Payload struct {
+	ID        uint        `json:"id"` // 投递记录ID，重试时不变，可用于去重
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Registration 创建Webhook的返回值，签名密钥只在此时返回
+type Registration struct {
+	models.Webhook
+	Secret string `json:"secret"`
+}
+
+// Service 用户事件回调：按事件筛选、签名投递并在失败后重试
+type Service struct {
+	db     *gorm.DB
+	http   *http.Client
+	config config.WebhooksConfig
+}
+
+func NewService(db *gorm.DB, httpClient *http.Client, cfg config.WebhooksConfig) *Service {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 30
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10
+	}
+	return &Service{
+		db:     db,
+		http:   httpClient,
+		config: cfg,
+	}
+}
+
+// Start 注册重试任务
+func (s *Service) Start(sched *scheduler.Scheduler) error {
+	return sched.Add(scheduler.Job{
+		ID:   "webhook_retry",
+		Spec: (time.Duration(s.config.RetryInterval) * time.Second).String(),
+		Run:  s.retry,
+	})
+}
+
+// List 用户的Webhook
+func (s *Service) List(userID uint) ([]models.Webhook, error) {
+	var hooks []models.Webhook
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&hooks).Error
+	return hooks, err
+}
+
+// Create 注册Webhook，events为空时订阅全部事件
+func (s *Service) Create(userID uint, endpoint string, events []string, description string) (*Registration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpclient.ValidatePublicURL(ctx, endpoint); err != nil {
+		return nil, fmt.Errorf("url %v", err)
+	}
+	filter, err := normalizeEvents(events)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	s.db.Model(&models.Webhook{}).Where("user_id = ?", userID).Count(&count)
+	if s.config.MaxPerUser > 0 && count >= int64(s.config.MaxPerUser) {
+		return nil, fmt.Errorf("at most %d webhooks are allowed", s.config.MaxPerUser)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	hook := models.Webhook{
+		UserID:      userID,
+		URL:         endpoint,
+		Events:      filter,
+		Secret:      hex.EncodeToString(secret),
+		Description: strings.TrimSpace(description),
+		Enabled:     true,
+	}
+	if err := s.db.Create(&hook).Error; err != nil {
+		return nil, err
+	}
+	return &Registration{Webhook: hook, Secret: hook.Secret}, nil
+}
+
+// Delete 删除Webhook及其投递记录
+func (s *Service) Delete(hookID, userID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Where("id = ? AND user_id = ?", hookID, userID).Delete(&models.Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return tx.Where("webhook_id = ?", hookID).Delete(&models.WebhookDelivery{}).Error
+	})
+}
+
+// Deliveries Webhook最近的投递记录
+func (s *Service) Deliveries(hookID, userID uint, status string, limit int) ([]models.WebhookDelivery, error) {
+	if err := s.owned(hookID, userID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	query := s.db.Where("webhook_id = ?", hookID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var deliveries []models.WebhookDelivery
+	err := query.Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// Ping 向Webhook发送一条测试事件，同步返回投递结果
+func (s *Service) Ping(hookID, userID uint) (*models.WebhookDelivery, error) {
+	if err := s.owned(hookID, userID); err != nil {
+		return nil, err
+	}
+	var hook models.Webhook
+	if err := s.db.First(&hook, hookID).Error; err != nil {
+		return nil, ErrNotFound
+	}
+
+	delivery, err := s.enqueue(&hook, EventPing, map[string]interface{}{"webhook_id": hook.ID})
+	if err != nil {
+		return nil, err
+	}
+	s.deliver(&hook, delivery)
+	return delivery, nil
+}
+
+// Publish 把事件投递给用户订阅了该事件的Webhook，异步执行，不阻塞调用方
+func (s *Service) Publish(userID uint, event string, data interface{}) {
+	if s == nil || !s.config.Enabled {
+		return
+	}
+
+	go func() {
+		var hooks []models.Webhook
+		if err := s.db.Where("user_id = ? AND enabled = ?", userID, true).Find(&hooks).Error; err != nil {
+			logrus.Errorf("Failed to load webhooks for user %d: %v", userID, err)
+			return
+		}
+
+		for i := range hooks {
+			hook := &hooks[i]
+			if !subscribed(hook.Events, event) {
+				continue
+			}
+			delivery, err := s.enqueue(hook, event, data)
+			if err != nil {
+				logrus.Errorf("Failed to queue webhook %d delivery: %v", hook.ID, err)
+				continue
+			}
+			s.deliver(hook, delivery)
+		}
+	}()
+}
+
+// enqueue 记录待投递的事件，请求体在此时固定，重试时发送相同内容
+func (s *Service) enqueue(hook *models.Webhook, event string, data interface{}) (*models.WebhookDelivery, error) {
+	lease := time.Now().Add(deliveryLease)
+	delivery := models.WebhookDelivery{
+		WebhookID:     hook.ID,
+		Event:         event,
+		Payload:       "{}",
+		Status:        "pending",
+		NextAttemptAt: &lease,
+	}
+	return &delivery, s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&delivery).Error; err != nil {
+			return err
+		}
+		payload, err := json.Marshal(Payload{ID: delivery.ID, Event: event, CreatedAt: delivery.CreatedAt, Data: data})
+		if err != nil {
+			return err
+		}
+		delivery.Payload = string(payload)
+		return tx.Model(&delivery).Update("payload", delivery.Payload).Error
+	})
+}
+
+// retry 重新投递到期的失败记录，并清理过期的投递记录
+func (s *Service) retry() {
+	var deliveries []models.WebhookDelivery
+	err := s.db.Where("status = ? AND next_attempt_at <= ?", "pending", time.Now()).
+		Order("next_attempt_at").Limit(100).Find(&deliveries).Error
+	if err != nil {
+		logrus.Errorf("Failed to load webhook deliveries: %v", err)
+		return
+	}
+
+	for i := range deliveries {
+		delivery := &deliveries[i]
+
+		// 领取记录，避免与仍在进行的首次投递重复发送
+		lease := time.Now().Add(deliveryLease)
+		claimed := s.db.Model(&models.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, "pending", delivery.NextAttemptAt).
+			Update("next_attempt_at", lease)
+		if claimed.Error != nil || claimed.RowsAffected == 0 {
+			continue
+		}
+
+		var hook models.Webhook
+		if err := s.db.Where("id = ? AND enabled = ?", delivery.WebhookID, true).First(&hook).Error; err != nil {
+			s.db.Model(delivery).Updates(map[string]interface{}{
+				"status":          "failed",
+				"error":           "webhook disabled or deleted",
+				"next_attempt_at": nil,
+			})
+			continue
+		}
+		s.deliver(&hook, delivery)
+	}
+
+	if s.config.Retention > 0 {
+		s.db.Where("created_at < ? AND status <> ?", time.Now().AddDate(0, 0, -s.config.Retention), "pending").
+			Delete(&models.WebhookDelivery{})
+	}
+}
+
+// deliver 发送一次请求并更新投递记录；2xx视为成功，其余响应按指数退避重试
+func (s *Service) deliver(hook *models.Webhook, delivery *models.WebhookDelivery) {
+	started := time.Now()
+	code, err := s.post(hook, delivery)
+
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	delivery.DurationMs = time.Since(started).Milliseconds()
+	delivery.Error = ""
+	delivery.NextAttemptAt = nil
+
+	switch {
+	case err == nil:
+		now := time.Now()
+		delivery.Status = "success"
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= s.config.MaxAttempts:
+		delivery.Status = "failed"
+		delivery.Error = err.Error()
+	default:
+		next := time.Now().Add(s.backoff(delivery.Attempts))
+		delivery.Status = "pending"
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = &next
+	}
+
+	err = s.db.Model(delivery).
+		Select("status", "attempts", "response_code", "error", "duration_ms", "next_attempt_at", "delivered_at").
+		Updates(delivery).Error
+	if err != nil {
+		logrus.Errorf("Failed to save webhook delivery %d: %v", delivery.ID, err)
+	}
+	if delivery.Status == "failed" {
+		logrus.Warnf("Webhook %d gave up on delivery %d after %d attempts: %s", hook.ID, delivery.ID, delivery.Attempts, delivery.Error)
+	}
+}
+
+// backoff 第n次失败后的等待时间，最长1小时
+func (s *Service) backoff(attempts int) time.Duration {
+	wait := time.Duration(s.config.RetryInterval) * time.Second << (attempts - 1)
+	if wait <= 0 || wait > time.Hour {
+		wait = time.Hour
+	}
+	return wait
+}
+
+// post 签名并发送请求体
+//
+// 签名为 HMAC-SHA256(secret, timestamp + "." + body) 的十六进制，放在 X-Webhook-Signature 头中，
+// 接收方应校验签名并拒绝时间戳过旧的请求。
+func (s *Service) post(hook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.config.Timeout)*time.Second)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+sign(hook.Secret, timestamp, body))
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (s *Service) owned(hookID, userID uint) error {
+	var count int64
+	s.db.Model(&models.Webhook{}).Where("id = ? AND user_id = ?", hookID, userID).Count(&count)
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// normalizeEvents 校验事件名，返回逗号分隔的筛选条件
+func normalizeEvents(events []string) (string, error) {
+	if len(events) == 0 {
+		return "*", nil
+	}
+	seen := make(map[string]bool)
+	var filter []string
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if event == "*" {
+			return "*", nil
+		}
+		valid := false
+		for _, known := range Events {
+			if event == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return "", fmt.Errorf("unknown event %q", event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			filter = append(filter, event)
+		}
+	}
+	return strings.Join(filter, ","), nil
+}
+
+func subscribed(filter, event string) bool {
+	if filter == "*" {
+		return true
+	}
+	for _, e := range strings.Split(filter, ",") {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/models"
+	"csgo2-trading-bot/services/notify"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotBound 用户尚未设置微信推送
+var ErrNotBound = errors.New("wechat is not bound")
+
+// 推送方式
+const (
+	ProviderServerChan = "serverchan" // Server酱，推送到个人微信
+	ProviderWeCom      = "wecom"      // 企业微信群机器人
+)
+
+// Settings 修改微信推送设置时提交的内容，推送哪些事件由通知偏好决定
+type Settings struct {
+	Provider string `json:"provider" binding:"required"`
+	Key      string `json:"key" binding:"required"`
+}
+
+// Service 通过Server酱或企业微信群机器人推送通知，实现notify.Notifier
+type Service struct {
+	db     *gorm.DB
+	http   *http.Client
+	config config.WeChatConfig
+}
+
+func NewService(db *gorm.DB, httpClient *http.Client, cfg config.WeChatConfig) *Service {
+	return &Service{db: db, http: httpClient, config: cfg}
+}
+
+func (s *Service) Name() string {
+	return "wechat"
+}
+
+func (s *Service) DefaultEvents() []string {
+	return nil
+}
+
+// Get 用户的微信推送设置
+func (s *Service) Get(userID uint) (*models.WeChatBinding, error) {
+	var binding models.WeChatBinding
+	if err := s.db.Where("user_id = ?", userID).First(&binding).Error; err != nil {
+		return nil, ErrNotBound
+	}
+	return &binding, nil
+}
+
+// Save 创建或修改微信推送设置
+func (s *Service) Save(userID uint, settings Settings) (*models.WeChatBinding, error) {
+	if settings.Provider != ProviderServerChan && settings.Provider != ProviderWeCom {
+		return nil, fmt.Errorf("provider must be %s or %s", ProviderServerChan, ProviderWeCom)
+	}
+	key := strings.TrimSpace(settings.Key)
+	if key == "" || strings.ContainsAny(key, "/?#& ") {
+		return nil, errors.New("invalid key")
+	}
+
+	binding := models.WeChatBinding{UserID: userID}
+	s.db.Where("user_id = ?", userID).First(&binding)
+	binding.Provider = settings.Provider
+	binding.Key = key
+	if err := s.db.Save(&binding).Error; err != nil {
+		return nil, err
+	}
+	return &binding, nil
+}
+
+// Delete 删除微信推送设置
+func (s *Service) Delete(userID uint) error {
+	result := s.db.Where("user_id = ?", userID).Delete(&models.WeChatBinding{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotBound
+	}
+	return nil
+}
+
+// SendTest 发送测试消息，同步返回发送结果
+func (s *Service) SendTest(userID uint) error {
+	if !s.config.Enabled {
+		return errors.New("wechat notifications are disabled")
+	}
+	binding, err := s.Get(userID)
+	if err != nil {
+		return err
+	}
+	return s.deliver(binding, notify.Message{
+		Title: "测试消息",
+		Body:  "微信推送设置成功，" + time.Now().Format("2006-01-02 15:04"),
+	})
+}
+
+// Send 推送到用户设置的微信，未设置时返回notify.ErrNotConfigured
+func (s *Service) Send(userID uint, msg notify.Message) error {
+	var binding models.WeChatBinding
+	if err := s.db.Where("user_id = ?", userID).First(&binding).Error; err != nil {
+		return notify.ErrNotConfigured
+	}
+	return s.deliver(&binding, msg)
+}
+
+func (s *Service) deliver(binding *models.WeChatBinding, msg notify.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch binding.Provider {
+	case ProviderServerChan:
+		return s.serverChan(ctx, binding.Key, msg)
+	case ProviderWeCom:
+		return s.weCom(ctx, binding.Key, msg)
+	}
+	return fmt.Errorf("unknown provider %q", binding.Provider)
+}
+
+// serverChan Server酱接口：POST {url}/{SendKey}.send，desp支持Markdown
+func (s *Service) serverChan(ctx context.Context, key string, msg notify.Message) error {
+	form := url.Values{}
+	form.Set("title", msg.Title)
+	form.Set("desp", strings.ReplaceAll(msg.Body, "\n", "\n\n"))
+
+	endpoint := fmt.Sprintf("%s/%s.send", strings.TrimRight(s.config.ServerChanURL, "/"), url.PathEscape(key))
+	var res struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := s.post(ctx, endpoint, "application/x-www-form-urlencoded", []byte(form.Encode()), &res); err != nil {
+		return err
+	}
+	if res.Code != 0 {
+		return fmt.Errorf("serverchan: %s (code %d)", res.Message, res.Code)
+	}
+	return nil
+}
+
+// weCom 企业微信群机器人：POST {url}?key={key}，使用markdown消息
+func (s *Service) weCom(ctx context.Context, key string, msg notify.Message) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"content": fmt.Sprintf("**%s**\n%s", msg.Title, msg.Body),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := s.config.WeComURL + "?key=" + url.QueryEscape(key)
+	var res struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := s.post(ctx, endpoint, "application/json", body, &res); err != nil {
+		return err
+	}
+	if res.ErrCode != 0 {
+		return fmt.Errorf("wecom: %s (errcode %d)", res.ErrMsg, res.ErrCode)
+	}
+	return nil
+}
+
+func (s *Service) post(ctx context.Context, endpoint, contentType string, body []byte, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		// 错误信息中的URL包含用户的key，只保留底层错误
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("invalid response (status %d)", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"csgo2-trading-bot/services/activity"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 每次阻塞读取的最长时间，超时后发送ping检查连接
+const activityBlock = 25 * time.Second
+
+// HandleActivityStream 推送当前用户的新动态，消息为 {"type":"activity","data":Entry}。
+// 断线重连时通过 ?after=<最后收到的ID> 补发错过的动态，不带时只推送连接之后的动态
+func HandleActivityStream(feed *activity.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("user_id")
+		after := c.Query("after")
+		if after != "" && !activity.ValidCursor(after) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after cursor"})
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if after == "" {
+			latest, err := feed.Latest(ctx, userID)
+			if err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "activity feed unavailable"})
+				return
+			}
+			after = latest
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			log.Println("WebSocket upgrade failed:", err)
+			return
+		}
+		defer conn.Close()
+
+		// 客户端不需要发送消息，读取只用于处理pong和发现连接关闭
+		go func() {
+			defer cancel()
+			conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+			conn.SetPongHandler(func(string) error {
+				conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+				return nil
+			})
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		for ctx.Err() == nil {
+			entries, err := feed.Tail(ctx, userID, after, activityBlock)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Activity stream for user %d failed: %v", userID, err)
+					conn.WriteControl(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "activity feed unavailable"),
+						time.Now().Add(10*time.Second))
+				}
+				return
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if len(entries) == 0 {
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
+				continue
+			}
+			for _, entry := range entries {
+				if err := conn.WriteJSON(Message{Type: "activity", Data: entry}); err != nil {
+					return
+				}
+				after = entry.ID
+			}
+		}
+	}
+}
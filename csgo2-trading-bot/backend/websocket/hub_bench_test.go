@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"csgo2-trading-bot/config"
+)
+
+// 压测参数：1万个进程内连接各订阅20个物品，以每秒1000条的速率发布500个物品的价格更新，每100条夹一条全局广播
+const (
+	fanoutClients   = 10000
+	fanoutRate      = 1000
+	fanoutItems     = 500
+	fanoutSubs      = 20
+	fanoutBroadcast = 100
+	fanoutMaxP99    = 50 * time.Millisecond
+)
+
+// BenchmarkHubFanout 压测Hub的分发能力，每次操作按目标速率发布一条消息。
+// 发布速率达不到目标的95%、排队p99超过50ms或有连接被断开时失败，例如压测30秒：
+//
+//	go test ./websocket -run '^$' -bench HubFanout -benchtime 30000x
+func BenchmarkHubFanout(b *testing.B) {
+	// 连接和断开的日志在压测时没有意义
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	hub := NewHub(nil, config.WebSocketConfig{
+		SendQueue:      256,
+		SlowThreshold:  0.75,
+		SlowGrace:      10,
+		OverflowPolicy: OverflowDisconnect,
+	})
+	go hub.Run()
+
+	for i := 0; i < fanoutClients; i++ {
+		itemIDs := make([]uint, fanoutSubs)
+		for j := range itemIDs {
+			itemIDs[j] = uint(rand.Intn(fanoutItems) + 1)
+		}
+		send := hub.attach(SchemaVersion, itemIDs)
+		go func() {
+			for range send {
+			}
+		}()
+	}
+	before := hub.Stats()
+
+	b.ResetTimer()
+	// 每10ms补齐到目标速率应发布的数量，Hub阻塞发布方时实际速率会低于目标
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	start := time.Now()
+	published := 0
+	for published < b.N {
+		now := <-ticker.C
+		due := min(int(now.Sub(start).Seconds()*fanoutRate), b.N)
+		for ; published < due; published++ {
+			if (published+1)%fanoutBroadcast == 0 {
+				BroadcastStrategyEvent(hub, "bench", map[string]interface{}{"n": published})
+				continue
+			}
+			BroadcastPriceUpdate(hub, uint(rand.Intn(fanoutItems)+1), rand.Float64()*1000, "bench")
+		}
+	}
+	elapsed := time.Since(start)
+	// 等待Hub处理完已发布的消息
+	for hub.Stats().Messages-before.Messages < int64(b.N) {
+		time.Sleep(time.Millisecond)
+	}
+	b.StopTimer()
+
+	stats := hub.Stats()
+	achieved := float64(b.N) / elapsed.Seconds()
+	queueP99 := time.Duration(stats.Latency[LatencyQueue].Quantile(0.99) * float64(time.Second))
+	fanoutP99 := time.Duration(stats.Latency[LatencyFanout].Quantile(0.99) * float64(time.Second))
+	var disconnects int64
+	for _, n := range stats.Disconnects {
+		disconnects += n
+	}
+
+	b.ReportMetric(achieved, "msg/s")
+	b.ReportMetric(float64(queueP99)/float64(time.Millisecond), "queue-p99-ms")
+	b.ReportMetric(float64(fanoutP99)/float64(time.Millisecond), "fanout-p99-ms")
+	b.ReportMetric(float64(stats.Enqueued-before.Enqueued)/float64(b.N), "enqueued/msg")
+	b.ReportMetric(float64(stats.Dropped-before.Dropped), "dropped")
+
+	// 发布不足1秒时速率受计时粒度影响，不作判断
+	if elapsed >= time.Second && achieved < fanoutRate*0.95 {
+		b.Errorf("published %.0f msg/s, below 95%% of %d: the hub is blocking publishers", achieved, fanoutRate)
+	}
+	if queueP99 > fanoutMaxP99 {
+		b.Errorf("p99 queue latency %s exceeds %s", queueP99, fanoutMaxP99)
+	}
+	if disconnects > 0 {
+		b.Errorf("%d clients were disconnected without slow readers: %v", disconnects, stats.Disconnects)
+	}
+}
@@ -0,0 +1,209 @@
+package websocket
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"csgo2-trading-bot/models"
+)
+
+// SchemaVersion 当前的消息结构版本。连接时通过 ?schema=1 协商，
+// 未指定版本的旧客户端按版本0处理，收到的消息结构与引入版本之前一致。
+// 版本1的推送消息带递增的seq，断线重连后发送 {"type":"resume","data":{"resume_from":seq}} 重放错过的消息
+const SchemaVersion = 1
+
+// PriceUpdateV1 price_update 消息
+type PriceUpdateV1 struct {
+	ItemID   uint      `json:"item_id"`
+	Price    float64   `json:"price"`
+	Platform string    `json:"platform"`
+	Time     time.Time `json:"time"`
+}
+
+// OrderV1 推送给客户端的订单
+type OrderV1 struct {
+	ID         uint      `json:"id"`
+	UserID     uint      `json:"user_id"`
+	ItemID     uint      `json:"item_id"`
+	Type       string    `json:"type"`
+	Status     string    `json:"status"`
+	Price      float64   `json:"price"`
+	Quantity   int       `json:"quantity"`
+	Filled     int       `json:"filled_quantity"` // 已成交数量，部分成交时小于quantity
+	Platform   string    `json:"platform"`
+	StrategyID *uint     `json:"strategy_id,omitempty"`
+	ParentID   *uint     `json:"parent_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// OrderUpdateV1 order_update 消息
+type OrderUpdateV1 struct {
+	Type  string    `json:"type"` // 订单事件，如expired
+	Order OrderV1   `json:"order"`
+	Time  time.Time `json:"time"`
+}
+
+// NotificationV1 notification 消息
+type NotificationV1 struct {
+	ID        uint            `json:"id"`
+	UserID    uint            `json:"user_id"`
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Message   string          `json:"message"`
+	Priority  string          `json:"priority"`
+	Read      bool            `json:"read"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// StrategyEventV1 strategy_event 消息
+type StrategyEventV1 struct {
+	Event string                 `json:"event"`
+	Data  map[string]interface{} `json:"data"`
+	Time  time.Time              `json:"time"`
+}
+
+// SubscriptionV1 subscribed/unsubscribed 消息，包含连接当前订阅的全部物品
+type SubscriptionV1 struct {
+	ItemIDs []uint `json:"item_ids"`
+}
+
+// MessageSchema 消息类型与其data结构的对应关系，用于生成前端类型定义
+type MessageSchema struct {
+	Type    string
+	Payload interface{} // nil表示data结构不固定
+}
+
+// Schemas 服务端推送的全部消息类型
+var Schemas = []MessageSchema{
+	{Type: "price_update", Payload: PriceUpdateV1{}},
+	{Type: "order_update", Payload: OrderUpdateV1{}},
+	{Type: "notification", Payload: NotificationV1{}},
+	{Type: "strategy_event", Payload: StrategyEventV1{}},
+	{Type: "market_update"},
+	{Type: "subscribed", Payload: SubscriptionV1{}},
+	{Type: "unsubscribed", Payload: SubscriptionV1{}},
+	{Type: "pong", Payload: int64(0)},
+	{Type: "resumed", Payload: ResumeV1{}},
+}
+
+// NewOrderV1 订单模型转换为消息结构
+func NewOrderV1(order *models.Order) OrderV1 {
+	return OrderV1{
+		ID:         order.ID,
+		UserID:     order.UserID,
+		ItemID:     order.ItemID,
+		Type:       order.Type,
+		Status:     order.Status,
+		Price:      order.Price,
+		Quantity:   order.Quantity,
+		Filled:     order.FilledQuantity,
+		Platform:   order.Platform,
+		StrategyID: order.StrategyID,
+		ParentID:   order.ParentID,
+		CreatedAt:  order.CreatedAt,
+		UpdatedAt:  order.UpdatedAt,
+	}
+}
+
+// NewNotificationV1 通知模型转换为消息结构
+func NewNotificationV1(notification *models.Notification) NotificationV1 {
+	msg := NotificationV1{
+		ID:        notification.ID,
+		UserID:    notification.UserID,
+		Type:      notification.Type,
+		Title:     notification.Title,
+		Message:   notification.Message,
+		Priority:  notification.Priority,
+		Read:      notification.Read,
+		CreatedAt: notification.CreatedAt,
+	}
+	if json.Valid([]byte(notification.Data)) {
+		msg.Data = json.RawMessage(notification.Data)
+	}
+	return msg
+}
+
+// ResumeV1 resumed 消息：重放了from之后到to为止错过的消息，complete为false时客户端应通过接口重新拉取状态
+type ResumeV1 struct {
+	From     uint64 `json:"from"`
+	To       uint64 `json:"to"`
+	Replayed int    `json:"replayed"`
+	Complete bool   `json:"complete"`
+}
+
+// frame 一条待推送的消息，data已编码，由Hub分配序号后封装
+type frame struct {
+	msgType string
+	current json.RawMessage
+	legacy  json.RawMessage
+	created time.Time // 发布时间，用于统计在Hub中排队的耗时
+}
+
+// newFrame 编码消息；legacy为版本0客户端使用的data，为nil时与payload相同
+func newFrame(msgType string, payload, legacy interface{}) (frame, error) {
+	current, err := json.Marshal(payload)
+	if err != nil {
+		return frame{}, err
+	}
+	old := current
+	if legacy != nil {
+		if old, err = json.Marshal(legacy); err != nil {
+			return frame{}, err
+		}
+	}
+	return frame{msgType: msgType, current: current, legacy: old, created: time.Now()}, nil
+}
+
+// sealed 已分配序号的消息编码
+type sealed struct {
+	current []byte
+	legacy  []byte
+}
+
+// seal 封装消息；序号只出现在当前版本中，版本0的客户端不支持断线重放。
+// 每条推送都要封装，直接拼接已编码的data，两个版本共用一次分配，输出与json.Marshal(Message{...})相同
+func (f frame) seal(seq uint64) sealed {
+	const overhead = len(`{"type":,"schema":,"seq":,"data":}`) + len(`{"type":,"data":}`) + 2*20
+	buf := make([]byte, 0, overhead+2*len(f.msgType)+len(f.current)+len(f.legacy))
+
+	buf = append(buf, `{"type":`...)
+	buf = appendString(buf, f.msgType)
+	buf = append(buf, `,"schema":`...)
+	buf = strconv.AppendInt(buf, SchemaVersion, 10)
+	buf = append(buf, `,"seq":`...)
+	buf = strconv.AppendUint(buf, seq, 10)
+	buf = append(buf, `,"data":`...)
+	buf = append(buf, f.current...)
+	buf = append(buf, '}')
+	n := len(buf)
+
+	buf = append(buf, `{"type":`...)
+	buf = appendString(buf, f.msgType)
+	buf = append(buf, `,"data":`...)
+	buf = append(buf, f.legacy...)
+	buf = append(buf, '}')
+	return sealed{current: buf[:n:n], legacy: buf[n:]}
+}
+
+// appendString 消息类型都是ASCII标识符，直接加引号；含需要转义的字符时交给encoding/json
+func appendString(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			quoted, _ := json.Marshal(s)
+			return append(dst, quoted...)
+		}
+	}
+	dst = append(dst, '"')
+	dst = append(dst, s...)
+	return append(dst, '"')
+}
+
+func (s sealed) encode(schema int) []byte {
+	if schema >= 1 {
+		return s.current
+	}
+	return s.legacy
+}
@@ -0,0 +1,192 @@
+package websocket
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// 推送链路上统计耗时的环节
+const (
+	LatencyQueue  = "queue"  // 消息发布 → Hub开始分发，持续升高说明Hub处理不过来
+	LatencyFanout = "fanout" // 一条消息放入全部接收者发送队列的耗时
+)
+
+var latencyStages = []string{LatencyQueue, LatencyFanout}
+
+// 直方图桶的上界（秒）
+var latencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// 统计中列出的积压最多的连接数
+const maxReportedClients = 20
+
+// Bucket 耗时不超过LE秒的样本数（累计），LE为0表示+Inf
+type Bucket struct {
+	LE    float64 `json:"le"`
+	Count int64   `json:"count"`
+}
+
+// Histogram 一个环节的耗时分布
+type Histogram struct {
+	Count   int64    `json:"count"`
+	Sum     float64  `json:"sum"` // 秒
+	Max     float64  `json:"max"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Quantile 按桶上界估算分位数（秒），不超过观测到的最大值
+func (h *Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(q * float64(h.Count)))
+	for _, b := range h.Buckets {
+		if b.Count >= target && b.LE > 0 {
+			return min(b.LE, h.Max)
+		}
+	}
+	return h.Max
+}
+
+// DepthBucket 发送队列中积压不超过LE条的连接数（不累计）
+type DepthBucket struct {
+	LE      int `json:"le"`
+	Clients int `json:"clients"`
+}
+
+// ClientStats 单个连接的发送情况
+type ClientStats struct {
+	Addr        string     `json:"addr"`
+	ConnectedAt time.Time  `json:"connected_at"`
+	Depth       int        `json:"depth"`     // 当前积压
+	MaxDepth    int        `json:"max_depth"` // 连接以来的最大积压
+	Sent        int64      `json:"sent"`
+	Dropped     int64      `json:"dropped"`
+	Items       int        `json:"items"`
+	SlowSince   *time.Time `json:"slow_since,omitempty"`
+}
+
+// HubStats 服务启动以来的推送统计
+type HubStats struct {
+	Since           time.Time             `json:"since"`
+	Clients         int                   `json:"clients"`
+	SubscribedItems int                   `json:"subscribed_items"`
+	SendQueue       int                   `json:"send_queue"`
+	Messages        int64                 `json:"messages"` // 分发的消息数
+	Enqueued        int64                 `json:"enqueued"` // 放入各连接发送队列的总数
+	Dropped         int64                 `json:"dropped"`
+	Disconnects     map[string]int64      `json:"disconnects"` // 按原因统计Hub主动断开的连接
+	QueueDepth      []DepthBucket         `json:"queue_depth"`
+	SlowClients     []ClientStats         `json:"slow_clients"` // 积压最多的连接
+	Latency         map[string]*Histogram `json:"latency"`
+}
+
+// hubMetrics 推送统计，只在Hub.Run协程中读写
+type hubMetrics struct {
+	since       time.Time
+	messages    int64
+	enqueued    int64
+	dropped     int64
+	disconnects map[string]int64
+	counts      map[string][]int64 // 每个桶的样本数（非累计），最后一个为+Inf
+	sums        map[string]float64
+	maxes       map[string]float64
+}
+
+func newHubMetrics() *hubMetrics {
+	m := &hubMetrics{
+		since:       time.Now(),
+		disconnects: make(map[string]int64),
+		counts:      make(map[string][]int64),
+		sums:        make(map[string]float64),
+		maxes:       make(map[string]float64),
+	}
+	for _, stage := range latencyStages {
+		m.counts[stage] = make([]int64, len(latencyBuckets)+1)
+	}
+	return m
+}
+
+func (m *hubMetrics) observe(stage string, d time.Duration) {
+	seconds := max(d, 0).Seconds()
+	i := 0
+	for i < len(latencyBuckets) && seconds > latencyBuckets[i] {
+		i++
+	}
+	m.counts[stage][i]++
+	m.sums[stage] += seconds
+	if seconds > m.maxes[stage] {
+		m.maxes[stage] = seconds
+	}
+}
+
+// snapshot 汇总统计及各连接的发送队列
+func (h *Hub) snapshot() HubStats {
+	m := h.metrics
+	stats := HubStats{
+		Since:           m.since,
+		Clients:         len(h.clients),
+		SubscribedItems: len(h.subscriptions),
+		SendQueue:       h.config.SendQueue,
+		Messages:        m.messages,
+		Enqueued:        m.enqueued,
+		Dropped:         m.dropped,
+		Disconnects:     make(map[string]int64, len(m.disconnects)),
+		Latency:         make(map[string]*Histogram, len(latencyStages)),
+	}
+	for reason, n := range m.disconnects {
+		stats.Disconnects[reason] = n
+	}
+	for _, stage := range latencyStages {
+		hist := &Histogram{Sum: m.sums[stage], Max: m.maxes[stage]}
+		for i, count := range m.counts[stage] {
+			hist.Count += count
+			le := 0.0
+			if i < len(latencyBuckets) {
+				le = latencyBuckets[i]
+			}
+			hist.Buckets = append(hist.Buckets, Bucket{LE: le, Count: hist.Count})
+		}
+		stats.Latency[stage] = hist
+	}
+
+	// 队列深度按容量的0、1/4、1/2、3/4和满分桶
+	size := h.config.SendQueue
+	for _, le := range []int{0, size / 4, size / 2, size * 3 / 4, size} {
+		if n := len(stats.QueueDepth); n == 0 || stats.QueueDepth[n-1].LE < le {
+			stats.QueueDepth = append(stats.QueueDepth, DepthBucket{LE: le})
+		}
+	}
+	clients := make([]ClientStats, 0, len(h.clients))
+	for client := range h.clients {
+		depth := len(client.send)
+		for i := range stats.QueueDepth {
+			if depth <= stats.QueueDepth[i].LE || i == len(stats.QueueDepth)-1 {
+				stats.QueueDepth[i].Clients++
+				break
+			}
+		}
+		cs := ClientStats{
+			Addr:        client.addr,
+			ConnectedAt: client.connectedAt,
+			Depth:       depth,
+			MaxDepth:    client.maxDepth,
+			Sent:        client.sent,
+			Dropped:     client.dropped,
+			Items:       len(client.items),
+		}
+		if !client.slowSince.IsZero() {
+			since := client.slowSince
+			cs.SlowSince = &since
+		}
+		clients = append(clients, cs)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Depth != clients[j].Depth {
+			return clients[i].Depth > clients[j].Depth
+		}
+		return clients[i].Dropped > clients[j].Dropped
+	})
+	stats.SlowClients = clients[:min(len(clients), maxReportedClients)]
+	return stats
+}
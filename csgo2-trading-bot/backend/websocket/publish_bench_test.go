@@ -0,0 +1,57 @@
+package websocket
+
+import (
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"csgo2-trading-bot/config"
+)
+
+// maxAllocsPerPublish 每条价格推送的内存分配次数上限，防止推送编码路径退化
+const maxAllocsPerPublish = 6.0
+
+// BenchmarkPriceUpdatePublish 发布价格更新并等待订阅连接收到，包括编码、分配序号、写入重放缓冲和分发。
+// 每条推送分配超过上限时失败
+func BenchmarkPriceUpdatePublish(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	hub := NewHub(nil, config.WebSocketConfig{
+		SendQueue:      1024,
+		SlowThreshold:  1,
+		SlowGrace:      60,
+		OverflowPolicy: OverflowDrop,
+	})
+	go hub.Run()
+
+	send := hub.attach(SchemaVersion, []uint{1})
+	go func() {
+		for range send {
+		}
+	}()
+
+	b.ReportAllocs()
+	start := hub.Stats().Messages
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		BroadcastPriceUpdate(hub, 1, float64(i), "bench")
+	}
+	// 读取速度跟不上时队列中的消息会被丢弃，按Hub处理完的消息数判断结束
+	for hub.Stats().Messages-start < int64(b.N) {
+		time.Sleep(time.Millisecond)
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&after)
+
+	// 等待期间轮询统计也会分配，N较小时（基准框架的预热轮次）占比过高，不作判断
+	perMessage := float64(after.Mallocs-before.Mallocs) / float64(b.N)
+	if b.N >= 10000 && perMessage > maxAllocsPerPublish {
+		b.Errorf("publishing allocates %.2f times per message, limit %.2f", perMessage, maxAllocsPerPublish)
+	}
+}
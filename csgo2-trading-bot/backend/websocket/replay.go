@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"csgo2-trading-bot/database"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	replayKey  = "ws:replay"
+	replaySize = 500             // 最多保留的消息数
+	replayTTL  = 5 * time.Minute // 超过该时长的消息不再重放
+)
+
+// replayEntry 一条已推送的消息，只保存当前版本的编码
+type replayEntry struct {
+	Seq    uint64          `json:"seq"`
+	ItemID uint            `json:"item_id,omitempty"` // 不为0时只重放给订阅了该物品的连接
+	Time   int64           `json:"time"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// replayBuffer 最近推送的消息：内存中保留一份，Redis可用时同时写入，服务重启后仍可重放
+type replayBuffer struct {
+	cache   *database.Cache
+	entries []replayEntry // 按seq升序，容量为两倍replaySize，写满后把最近的replaySize条移到开头
+
+	// 待写入Redis的消息，由单独的协程批量写入，Redis变慢时不阻塞Hub的分发
+	pending chan replayEntry
+}
+
+func newReplayBuffer(cache *database.Cache) *replayBuffer {
+	b := &replayBuffer{cache: cache, entries: make([]replayEntry, 0, 2*replaySize)}
+	if cache != nil {
+		b.pending = make(chan replayEntry, 1024)
+		go b.persist()
+	}
+	return b
+}
+
+// lastSeq Redis中最新的序号，服务重启后从这里继续编号
+func (b *replayBuffer) lastSeq() uint64 {
+	if b.cache == nil || !b.cache.Available() {
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	members, err := b.cache.Client().ZRevRangeWithScores(ctx, replayKey, 0, 0).Result()
+	if err != nil || len(members) == 0 {
+		return 0
+	}
+	return uint64(members[0].Score)
+}
+
+func (b *replayBuffer) append(seq uint64, itemID uint, data []byte) {
+	entry := replayEntry{Seq: seq, ItemID: itemID, Time: time.Now().Unix(), Data: data}
+	if len(b.entries) == cap(b.entries) {
+		// 每replaySize条消息整体移动一次，不必每条都截断后重新分配
+		b.entries = b.entries[:copy(b.entries, b.entries[len(b.entries)-replaySize+1:])]
+	}
+	b.entries = append(b.entries, entry)
+
+	if b.pending == nil {
+		return
+	}
+	select {
+	case b.pending <- entry:
+	default:
+		logrus.Debugf("Websocket replay queue is full, message %d not buffered in redis", seq)
+	}
+}
+
+// persist 把待写入的消息批量写入Redis
+func (b *replayBuffer) persist() {
+	for entry := range b.pending {
+		batch := []replayEntry{entry}
+	drain:
+		for len(batch) < 100 {
+			select {
+			case next := <-b.pending:
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+		b.write(batch)
+	}
+}
+
+func (b *replayBuffer) write(batch []replayEntry) {
+	if !b.cache.Available() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	pipe := b.cache.Client().Pipeline()
+	for _, entry := range batch {
+		member, err := json.Marshal(entry)
+		if err != nil {
+			continue
+		}
+		pipe.ZAdd(ctx, replayKey, redis.Z{Score: float64(entry.Seq), Member: member})
+	}
+	pipe.ZRemRangeByRank(ctx, replayKey, 0, -replaySize-1)
+	pipe.Expire(ctx, replayKey, replayTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logrus.Debugf("Failed to buffer %d websocket messages: %v", len(batch), err)
+	}
+}
+
+// recent 最近的replaySize条消息
+func (b *replayBuffer) recent() []replayEntry {
+	if len(b.entries) > replaySize {
+		return b.entries[len(b.entries)-replaySize:]
+	}
+	return b.entries
+}
+
+// since 序号大于from的消息；complete为false表示缓冲区已不包含from之后的全部消息
+func (b *replayBuffer) since(from, current uint64) ([]replayEntry, bool) {
+	if from == current {
+		return nil, true
+	}
+	if from > current {
+		// 序号来自之前的服务实例且Redis中没有延续下来
+		return nil, false
+	}
+
+	entries := b.recent()
+	if len(entries) == 0 || entries[0].Seq > from+1 {
+		// 内存中不够（如服务刚重启），从Redis读取
+		if stored, ok := b.load(from); ok {
+			entries = stored
+		}
+	}
+
+	cutoff := time.Now().Add(-replayTTL).Unix()
+	var missed []replayEntry
+	for _, entry := range entries {
+		if entry.Seq > from && entry.Time >= cutoff {
+			missed = append(missed, entry)
+		}
+	}
+	complete := len(missed) > 0 && missed[0].Seq == from+1
+	return missed, complete
+}
+
+func (b *replayBuffer) load(from uint64) ([]replayEntry, bool) {
+	if b.cache == nil || !b.cache.Available() {
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	members, err := b.cache.Client().ZRangeByScore(ctx, replayKey, &redis.ZRangeBy{
+		Min: "(" + strconv.FormatUint(from, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, false
+	}
+
+	entries := make([]replayEntry, 0, len(members))
+	for _, member := range members {
+		var entry replayEntry
+		if json.Unmarshal([]byte(member), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, true
+}
@@ -4,8 +4,13 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
+	"csgo2-trading-bot/config"
+	"csgo2-trading-bot/database"
+	"csgo2-trading-bot/models"
 	"csgo2-trading-bot/services/market"
 
 	"github.com/gin-gonic/gin"
@@ -18,31 +23,134 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// 单个连接最多订阅的物品数
+const maxItemSubscriptions = 200
+
+// 发送队列已满时的处理方式
+const (
+	OverflowDisconnect = "disconnect"
+	OverflowDrop       = "drop" // 丢弃的消息可通过seq缺口发现，并用resume补发
+)
+
 type Hub struct {
 	clients    map[*Client]bool
-	broadcast  chan []byte
+	broadcast  chan frame
 	register   chan *Client
 	unregister chan *Client
+
+	// 按物品订阅的连接，只在Run协程中读写
+	subscriptions map[uint]map[*Client]bool
+	subscribe     chan subscription
+	itemBroadcast chan itemMessage
+
+	// 推送消息的序号及最近消息的缓冲，用于断线重放
+	seq    uint64
+	replay *replayBuffer
+	resume chan resumeRequest
+
+	config    config.WebSocketConfig
+	slowDepth int         // 发送队列积压达到该值视为慢连接
+	metrics   *hubMetrics // 只在Run协程中读写
+	stats     chan chan HubStats
 }
 
 type Client struct {
-	hub  *Hub
-	conn *websocket.Conn
-	send chan []byte
+	hub   *Hub
+	conn  *websocket.Conn
+	send  chan []byte
+	items map[uint]bool // 已订阅的物品，只在Hub.Run协程中读写
+
+	schema int // 协商的消息结构版本
+
+	addr        string
+	connectedAt time.Time
+
+	// 发送统计和慢连接状态，只在Hub.Run协程中读写
+	sent      int64
+	dropped   int64
+	maxDepth  int
+	slowSince time.Time
+}
+
+// subscription 订阅或取消订阅一组物品
+type subscription struct {
+	client  *Client
+	itemIDs []uint
+	remove  bool
+}
+
+// resumeRequest 客户端重连后请求重放序号from之后的消息
+type resumeRequest struct {
+	client *Client
+	from   uint64
+}
+
+// itemMessage 只推送给订阅了该物品的连接
+type itemMessage struct {
+	itemID uint
+	frame  frame
 }
 
 type Message struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+	Type   string      `json:"type"`
+	Schema int         `json:"schema,omitempty"` // 消息结构版本，版本0的客户端不带该字段
+	Seq    uint64      `json:"seq,omitempty"`    // 推送消息的序号，用于断线重放
+	Data   interface{} `json:"data"`
 }
 
-func NewHub() *Hub {
+// NewHub cache用于保存最近推送的消息，为nil时只在内存中保留
+func NewHub(cache *database.Cache, cfg config.WebSocketConfig) *Hub {
+	if cfg.SendQueue <= 0 {
+		cfg.SendQueue = 256
+	}
+	if cfg.SlowThreshold <= 0 || cfg.SlowThreshold > 1 {
+		cfg.SlowThreshold = 1
+	}
+	replay := newReplayBuffer(cache)
 	return &Hub{
-		broadcast:  make(chan []byte),
+		broadcast:  make(chan frame, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
+
+		subscriptions: make(map[uint]map[*Client]bool),
+		subscribe:     make(chan subscription),
+		itemBroadcast: make(chan itemMessage, 256),
+
+		seq:    replay.lastSeq(),
+		replay: replay,
+		resume: make(chan resumeRequest),
+
+		config:    cfg,
+		slowDepth: max(int(float64(cfg.SendQueue)*cfg.SlowThreshold), 1),
+		metrics:   newHubMetrics(),
+		stats:     make(chan chan HubStats),
+	}
+}
+
+// Stats 当前连接的发送队列和服务启动以来的推送统计
+func (h *Hub) Stats() HubStats {
+	reply := make(chan HubStats, 1)
+	h.stats <- reply
+	return <-reply
+}
+
+// attach 注册一个不经过网络的进程内连接并订阅物品，用于基准测试Hub的分发能力；
+// 返回该连接的发送队列，连接被Hub断开时关闭
+func (h *Hub) attach(schema int, itemIDs []uint) <-chan []byte {
+	client := &Client{
+		hub:         h,
+		send:        make(chan []byte, h.config.SendQueue),
+		items:       make(map[uint]bool),
+		schema:      schema,
+		addr:        "local",
+		connectedAt: time.Now(),
 	}
+	h.register <- client
+	if len(itemIDs) > 0 {
+		h.subscribe <- subscription{client: client, itemIDs: itemIDs}
+	}
+	return client.send
 }
 
 func (h *Hub) Run() {
@@ -54,28 +162,169 @@ func (h *Hub) Run() {
 
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+				h.remove(client)
 				log.Println("Client disconnected")
 			}
 
 		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
+			h.deliver(message, 0, h.clients)
+
+		case sub := <-h.subscribe:
+			if _, ok := h.clients[sub.client]; ok {
+				h.applySubscription(sub)
 			}
+
+		case message := <-h.itemBroadcast:
+			h.deliver(message.frame, message.itemID, h.subscriptions[message.itemID])
+
+		case req := <-h.resume:
+			if _, ok := h.clients[req.client]; ok {
+				h.replayTo(req.client, req.from)
+			}
+
+		case reply := <-h.stats:
+			reply <- h.snapshot()
+		}
+	}
+}
+
+// deliver 分配序号、写入重放缓冲并推送给接收者
+func (h *Hub) deliver(f frame, itemID uint, recipients map[*Client]bool) {
+	start := time.Now()
+	h.metrics.observe(LatencyQueue, start.Sub(f.created))
+
+	h.seq++
+	message := f.seal(h.seq)
+	h.replay.append(h.seq, itemID, message.current)
+
+	for client := range recipients {
+		h.enqueue(client, message.encode(client.schema), start)
+	}
+	h.metrics.messages++
+	h.metrics.observe(LatencyFanout, time.Since(start))
+}
+
+// enqueue 放入连接的发送队列，不阻塞。队列已满时按overflow_policy断开连接或丢弃消息；
+// 积压超过slow_threshold持续slow_grace秒的连接视为慢连接并断开。返回false表示连接已断开
+func (h *Hub) enqueue(client *Client, data []byte, now time.Time) bool {
+	select {
+	case client.send <- data:
+		client.sent++
+		h.metrics.enqueued++
+	default:
+		client.dropped++
+		h.metrics.dropped++
+		if h.config.OverflowPolicy != OverflowDrop {
+			h.disconnect(client, "queue_full")
+			return false
+		}
+	}
+
+	depth := len(client.send)
+	client.maxDepth = max(client.maxDepth, depth)
+	if depth < h.slowDepth {
+		client.slowSince = time.Time{}
+		return true
+	}
+	if client.slowSince.IsZero() {
+		client.slowSince = now
+		return true
+	}
+	if now.Sub(client.slowSince) > time.Duration(h.config.SlowGrace)*time.Second {
+		h.disconnect(client, "slow")
+		return false
+	}
+	return true
+}
+
+// disconnect Hub主动断开跟不上推送的连接
+func (h *Hub) disconnect(client *Client, reason string) {
+	h.metrics.disconnects[reason]++
+	log.Printf("Disconnecting %s websocket client %s: depth %d, sent %d, dropped %d",
+		reason, client.addr, len(client.send), client.sent, client.dropped)
+	h.remove(client)
+}
+
+// replayTo 补发连接错过的消息，物品消息只补发当前已订阅的物品；补发量超过发送队列余量时放弃补发
+func (h *Hub) replayTo(client *Client, from uint64) {
+	entries, complete := h.replay.since(from, h.seq)
+
+	var missed [][]byte
+	for _, entry := range entries {
+		if entry.ItemID == 0 || client.items[entry.ItemID] {
+			missed = append(missed, entry.Data)
+		}
+	}
+	if len(missed) >= cap(client.send)-len(client.send) {
+		missed, complete = nil, false
+	}
+
+	for _, data := range missed {
+		client.send <- data
+	}
+
+	data, err := client.encode("resumed", ResumeV1{From: from, To: h.seq, Replayed: len(missed), Complete: complete})
+	if err != nil {
+		return
+	}
+	h.enqueue(client, data, time.Now())
+}
+
+// remove 断开连接并清理它的物品订阅
+func (h *Hub) remove(client *Client) {
+	for itemID := range client.items {
+		h.unsubscribeItem(client, itemID)
+	}
+	delete(h.clients, client)
+	close(client.send)
+}
+
+// applySubscription 更新连接的物品订阅，并回复当前订阅的物品列表
+func (h *Hub) applySubscription(sub subscription) {
+	client := sub.client
+	for _, itemID := range sub.itemIDs {
+		if sub.remove {
+			h.unsubscribeItem(client, itemID)
+			continue
+		}
+		if client.items[itemID] || len(client.items) >= maxItemSubscriptions {
+			continue
+		}
+		if h.subscriptions[itemID] == nil {
+			h.subscriptions[itemID] = make(map[*Client]bool)
 		}
+		h.subscriptions[itemID][client] = true
+		client.items[itemID] = true
 	}
+
+	itemIDs := make([]uint, 0, len(client.items))
+	for itemID := range client.items {
+		itemIDs = append(itemIDs, itemID)
+	}
+	sort.Slice(itemIDs, func(i, j int) bool { return itemIDs[i] < itemIDs[j] })
+
+	msgType := "subscribed"
+	if sub.remove {
+		msgType = "unsubscribed"
+	}
+	data, err := client.encode(msgType, SubscriptionV1{ItemIDs: itemIDs})
+	if err != nil {
+		return
+	}
+	h.enqueue(client, data, time.Now())
 }
 
-func HandleWebSocket(marketService *market.Service) gin.HandlerFunc {
-	hub := NewHub()
-	go hub.Run()
+func (h *Hub) unsubscribeItem(client *Client, itemID uint) {
+	delete(client.items, itemID)
+	if subscribers, ok := h.subscriptions[itemID]; ok {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(h.subscriptions, itemID)
+		}
+	}
+}
 
+func HandleWebSocket(hub *Hub, marketService *market.Service) gin.HandlerFunc {
 	// 启动价格更新推送
 	go func() {
 		ticker := time.NewTicker(5 * time.Second)
@@ -88,17 +337,12 @@ func HandleWebSocket(marketService *market.Service) gin.HandlerFunc {
 				continue
 			}
 
-			message := Message{
-				Type: "market_update",
-				Data: trends,
-			}
-
-			data, err := json.Marshal(message)
+			f, err := newFrame("market_update", trends, nil)
 			if err != nil {
 				continue
 			}
 
-			hub.broadcast <- data
+			hub.broadcast <- f
 		}
 	}()
 
@@ -110,9 +354,16 @@ func HandleWebSocket(marketService *market.Service) gin.HandlerFunc {
 		}
 
 		client := &Client{
-			hub:  hub,
-			conn: conn,
-			send: make(chan []byte, 256),
+			hub:         hub,
+			conn:        conn,
+			send:        make(chan []byte, hub.config.SendQueue),
+			items:       make(map[uint]bool),
+			addr:        c.ClientIP(),
+			connectedAt: time.Now(),
+		}
+		// 客户端通过 ?schema= 选择消息结构版本，不支持的版本按最新版本处理
+		if v, err := strconv.Atoi(c.Query("schema")); err == nil && v > 0 {
+			client.schema = SchemaVersion
 		}
 
 		client.hub.register <- client
@@ -151,24 +402,67 @@ func (c *Client) readPump() {
 
 		// 根据消息类型处理
 		switch msg.Type {
-		case "subscribe":
-			// 处理订阅请求
-			log.Printf("Client subscribed to: %v", msg.Data)
-		case "unsubscribe":
-			// 处理取消订阅请求
-			log.Printf("Client unsubscribed from: %v", msg.Data)
+		case "subscribe", "unsubscribe":
+			// 订阅或取消订阅指定物品的价格更新
+			itemIDs := parseItemIDs(msg.Data)
+			if len(itemIDs) == 0 {
+				continue
+			}
+			c.hub.subscribe <- subscription{client: c, itemIDs: itemIDs, remove: msg.Type == "unsubscribe"}
+		case "resume":
+			// 重连后补发错过的消息，需要先重新订阅物品
+			if c.schema < 1 {
+				continue
+			}
+			if obj, ok := msg.Data.(map[string]interface{}); ok {
+				if from, ok := obj["resume_from"].(float64); ok && from >= 0 {
+					c.hub.resume <- resumeRequest{client: c, from: uint64(from)}
+				}
+			}
 		case "ping":
 			// 响应ping
-			response := Message{
-				Type: "pong",
-				Data: time.Now().Unix(),
-			}
-			data, _ := json.Marshal(response)
+			data, _ := c.encode("pong", time.Now().Unix())
 			c.send <- data
 		}
 	}
 }
 
+// encode 按连接协商的版本编码发给该连接的消息
+func (c *Client) encode(msgType string, data interface{}) ([]byte, error) {
+	message := Message{Type: msgType, Data: data}
+	if c.schema >= 1 {
+		message.Schema = c.schema
+	}
+	return json.Marshal(message)
+}
+
+// parseItemIDs 解析订阅消息中的物品ID，支持 {"item_ids": [1, 2]}、[1, 2] 或单个ID
+func parseItemIDs(data interface{}) []uint {
+	if obj, ok := data.(map[string]interface{}); ok {
+		if ids, ok := obj["item_ids"]; ok {
+			data = ids
+		} else {
+			data = obj["item_id"]
+		}
+	}
+
+	var values []interface{}
+	switch v := data.(type) {
+	case []interface{}:
+		values = v
+	default:
+		values = []interface{}{v}
+	}
+
+	itemIDs := make([]uint, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(float64); ok && id > 0 && id == float64(uint(id)) {
+			itemIDs = append(itemIDs, uint(id))
+		}
+	}
+	return itemIDs
+}
+
 func (c *Client) writePump() {
 	ticker := time.NewTicker(54 * time.Second)
 	defer func() {
@@ -196,56 +490,60 @@ func (c *Client) writePump() {
 	}
 }
 
-// BroadcastPriceUpdate 广播价格更新
+// BroadcastPriceUpdate 向订阅了该物品的连接推送价格更新
 func BroadcastPriceUpdate(hub *Hub, itemID uint, price float64, platform string) {
-	message := Message{
-		Type: "price_update",
-		Data: map[string]interface{}{
-			"item_id":  itemID,
-			"price":    price,
-			"platform": platform,
-			"time":     time.Now(),
-		},
-	}
-
-	data, err := json.Marshal(message)
+	f, err := newFrame("price_update", PriceUpdateV1{
+		ItemID:   itemID,
+		Price:    price,
+		Platform: platform,
+		Time:     time.Now(),
+	}, nil)
 	if err != nil {
 		return
 	}
 
-	hub.broadcast <- data
+	hub.itemBroadcast <- itemMessage{itemID: itemID, frame: f}
 }
 
 // BroadcastOrderUpdate 广播订单更新
-func BroadcastOrderUpdate(hub *Hub, orderType string, order interface{}) {
-	message := Message{
-		Type: "order_update",
-		Data: map[string]interface{}{
-			"type":  orderType,
-			"order": order,
-			"time":  time.Now(),
-		},
-	}
-
-	data, err := json.Marshal(message)
+func BroadcastOrderUpdate(hub *Hub, orderType string, order *models.Order) {
+	now := time.Now()
+	f, err := newFrame("order_update", OrderUpdateV1{
+		Type:  orderType,
+		Order: NewOrderV1(order),
+		Time:  now,
+	}, map[string]interface{}{
+		"type":  orderType,
+		"order": order,
+		"time":  now,
+	})
 	if err != nil {
 		return
 	}
 
-	hub.broadcast <- data
+	hub.broadcast <- f
 }
 
 // BroadcastNotification 广播通知
-func BroadcastNotification(hub *Hub, notification interface{}) {
-	message := Message{
-		Type: "notification",
-		Data: notification,
+func BroadcastNotification(hub *Hub, notification *models.Notification) {
+	f, err := newFrame("notification", NewNotificationV1(notification), notification)
+	if err != nil {
+		return
 	}
 
-	data, err := json.Marshal(message)
+	hub.broadcast <- f
+}
+
+// BroadcastStrategyEvent 广播策略事件（止损、止盈等）
+func BroadcastStrategyEvent(hub *Hub, event string, payload map[string]interface{}) {
+	f, err := newFrame("strategy_event", StrategyEventV1{
+		Event: event,
+		Data:  payload,
+		Time:  time.Now(),
+	}, nil)
 	if err != nil {
 		return
 	}
 
-	hub.broadcast <- data
-}
\ No newline at end of file
+	hub.broadcast <- f
+}
@@ -23,6 +23,7 @@ class BuffCollector(BaseCollector):
         super().__init__(config, db_manager)
         self.base_url = self.config.BUFF_BASE_URL
         self.game_id = 730  # CS2
+        self.cookie = self.config.BUFF_COOKIE
         
     async def initialize(self):
         """初始化采集器"""
@@ -34,6 +35,9 @@ class BuffCollector(BaseCollector):
         items = []
         
         try:
+            # 使用后端维护的最新Cookie，后端会在会话失效时刷新
+            self.cookie = await self.db_manager.get_platform_cookie('buff') or self.config.BUFF_COOKIE
+            
             # 获取物品列表
             item_list = await self._get_item_list()
             
@@ -82,6 +86,8 @@ class BuffCollector(BaseCollector):
                     
                     if data.get('code') == 'OK':
                         items = data.get('data', {}).get('items', [])
+                    elif data.get('code') == 'Login Required':
+                        logger.error("BUFF登录已失效，等待后端刷新会话或管理员重新登录")
                         
         except Exception as e:
             logger.error(f"获取BUFF物品列表失败: {e}")
@@ -217,7 +223,7 @@ class BuffCollector(BaseCollector):
             'Accept-Language': 'zh-CN,zh;q=0.9,en;q=0.8',
             'X-Requested-With': 'XMLHttpRequest',
             'Referer': f'{self.base_url}/market/csgo',
-            'Cookie': self.config.BUFF_COOKIE
+            'Cookie': self.cookie
         }
         
         return headers
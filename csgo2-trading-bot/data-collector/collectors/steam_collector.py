@@ -61,6 +61,21 @@ class SteamCollector(BaseCollector):
             
         return items
         
+    async def collect_items(self, item_names: List[str]) -> List[Dict[str, Any]]:
+        """采集指定物品的数据"""
+        items = []
+        results = await asyncio.gather(
+            *(self._collect_item_data(name) for name in item_names[:self.config.MAX_ITEMS_PER_RUN]),
+            return_exceptions=True
+        )
+        for result in results:
+            if isinstance(result, dict):
+                items.append(result)
+                await self._save_item_data(result)
+            elif isinstance(result, Exception):
+                logger.error(f"采集物品数据失败: {result}")
+        return items
+        
     async def _get_popular_items(self) -> List[str]:
         """获取热门物品列表"""
         items = []
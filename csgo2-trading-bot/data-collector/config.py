@@ -51,6 +51,7 @@ class Config:
         # 采集配置
         self.COLLECT_INTERVAL = int(os.getenv('COLLECT_INTERVAL', 300))  # 秒
         self.MAX_ITEMS_PER_RUN = int(os.getenv('MAX_ITEMS_PER_RUN', 100))
+        self.FAST_TRACK_INTERVAL = int(os.getenv('FAST_TRACK_INTERVAL', 60))  # 秒，最高采集层级（新上架物品）的采集间隔
         self.CONCURRENT_REQUESTS = int(os.getenv('CONCURRENT_REQUESTS', 5))
         self.REQUEST_TIMEOUT = int(os.getenv('REQUEST_TIMEOUT', 30))
         self.RETRY_TIMES = int(os.getenv('RETRY_TIMES', 3))
@@ -118,42 +118,35 @@ class DatabaseManager:
     async def get_cross_platform_prices(self) -> List[Dict[str, Any]]:
         """获取跨平台价格"""
         async with self.pool.acquire() as conn:
+            # 除Steam外，每个平台取最新一条价格（包括BitSkins、Market.CSGO等后端同步的平台）
             rows = await conn.fetch("""
                 SELECT 
                     i.id,
                     i.market_hash_name as name,
                     i.current_price as steam_price,
-                    (
-                        SELECT price FROM price_histories 
-                        WHERE item_id = i.id AND platform = 'buff'
-                        ORDER BY recorded_at DESC LIMIT 1
-                    ) as buff_price,
-                    (
-                        SELECT price FROM price_histories 
-                        WHERE item_id = i.id AND platform = 'youpin'
-                        ORDER BY recorded_at DESC LIMIT 1
-                    ) as youpin_price
+                    p.platform,
+                    p.price
                 FROM items i
+                LEFT JOIN LATERAL (
+                    SELECT DISTINCT ON (platform) platform, price
+                    FROM price_histories
+                    WHERE item_id = i.id AND platform <> 'steam'
+                    ORDER BY platform, recorded_at DESC
+                ) p ON true
                 WHERE i.current_price > 0
             """)
             
-            result = []
+            items = {}
             for row in rows:
-                prices = {}
-                if row['steam_price']:
-                    prices['steam'] = float(row['steam_price'])
-                if row['buff_price']:
-                    prices['buff'] = float(row['buff_price'])
-                if row['youpin_price']:
-                    prices['youpin'] = float(row['youpin_price'])
-                    
-                if len(prices) >= 2:
-                    result.append({
-                        'id': row['id'],
-                        'name': row['name'],
-                        'prices': prices
-                    })
+                item = items.setdefault(row['id'], {
+                    'id': row['id'],
+                    'name': row['name'],
+                    'prices': {'steam': float(row['steam_price'])}
+                })
+                if row['platform'] and row['price']:
+                    item['prices'][row['platform']] = float(row['price'])
                     
+            result = [item for item in items.values() if len(item['prices']) >= 2]
             return result
             
     async def save_arbitrage_opportunities(self, opportunities: List[Dict[str, Any]]):
@@ -167,6 +160,28 @@ class DatabaseManager:
             if self.config.ENABLE_NOTIFICATIONS:
                 await self._send_notification(opp)
                 
+    async def get_items_by_tier(self, tier: int) -> List[str]:
+        """获取指定采集层级的物品，层级1为后端快速通道建档的新上架物品"""
+        async with self.pool.acquire() as conn:
+            rows = await conn.fetch("""
+                SELECT market_hash_name FROM items
+                WHERE collection_tier = $1 AND deleted_at IS NULL
+                ORDER BY created_at DESC
+            """, tier)
+            return [row['market_hash_name'] for row in rows]
+            
+    async def get_platform_cookie(self, platform: str) -> Optional[str]:
+        """获取后端保存的平台登录Cookie，由后端自动刷新或管理员重新设置"""
+        try:
+            async with self.pool.acquire() as conn:
+                return await conn.fetchval("""
+                    SELECT cookie FROM platform_sessions
+                    WHERE platform = $1 AND cookie <> ''
+                """, platform)
+        except asyncpg.UndefinedTableError:
+            # 后端尚未建表时使用配置中的Cookie
+            return None
+            
     async def cleanup_old_price_history(self, days: int) -> int:
         """清理历史价格数据"""
         cutoff_date = datetime.now() - timedelta(days=days)
@@ -73,6 +73,17 @@ class DataCollectorService:
                 replace_existing=True
             )
         
+        # 新上架物品（最高采集层级）- 默认每分钟
+        if self.config.STEAM_ENABLED:
+            self.scheduler.add_job(
+                self.collect_fast_track_data,
+                IntervalTrigger(seconds=self.config.FAST_TRACK_INTERVAL),
+                id='fast_track_collector',
+                name='新上架物品采集',
+                replace_existing=True,
+                max_instances=1
+            )
+        
         # BUFF数据采集 - 每10分钟
         if self.config.BUFF_ENABLED:
             self.scheduler.add_job(
@@ -122,6 +133,17 @@ class DataCollectorService:
         except Exception as e:
             logger.error(f"Steam数据采集失败: {e}")
             
+    async def collect_fast_track_data(self):
+        """采集最高层级（新上架）物品的Steam数据"""
+        try:
+            names = await self.db_manager.get_items_by_tier(1)
+            if not names:
+                return
+            items = await self.collectors['steam'].collect_items(names)
+            logger.info(f"新上架物品采集完成，共采集 {len(items)}/{len(names)} 个物品")
+        except Exception as e:
+            logger.error(f"新上架物品采集失败: {e}")
+            
     async def collect_buff_data(self):
         """采集BUFF市场数据"""
         try:
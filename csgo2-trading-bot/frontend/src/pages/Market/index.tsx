@@ -1,4 +1,4 @@
-import React, { useEffect, useState } from 'react';
+import React, { useEffect, useRef, useState } from 'react';
 import {
   Card,
   Table,
@@ -27,6 +27,7 @@ import ReactECharts from 'echarts-for-react';
 import { useDispatch, useSelector } from 'react-redux';
 import { RootState } from '../../store';
 import { fetchMarketItems, setFilters } from '../../store/slices/marketSlice';
+import { WS_SCHEMA_VERSION, WSMessage } from '../../types/websocket';
 import './Market.css';
 
 const { Title, Text } = Typography;
@@ -44,25 +45,51 @@ const Market: React.FC = () => {
   const [selectedType, setSelectedType] = useState<string>('all');
   const [selectedRarity, setSelectedRarity] = useState<string>('all');
   const [currentPage, setCurrentPage] = useState(1);
+  const wsRef = useRef<WebSocket | null>(null);
+  const subscribedRef = useRef<number[]>([]);
 
   useEffect(() => {
     loadMarketData();
     
     // WebSocket订阅价格更新
-    const ws = new WebSocket('ws://localhost:8080/ws');
+    const ws = new WebSocket(`ws://localhost:8080/ws?schema=${WS_SCHEMA_VERSION}`);
+    wsRef.current = ws;
+    ws.onopen = () => syncSubscriptions();
     ws.onmessage = (event) => {
-      const data = JSON.parse(event.data);
-      if (data.type === 'price_update') {
+      const msg: WSMessage = JSON.parse(event.data);
+      if (msg.type === 'price_update') {
         // 更新价格
-        dispatch(updateItemPrice(data.data));
+        dispatch(updateItemPrice(msg.data));
       }
     };
 
     return () => {
+      wsRef.current = null;
+      subscribedRef.current = [];
       ws.close();
     };
   }, []);
 
+  // 只订阅当前列表中物品的价格更新
+  const syncSubscriptions = () => {
+    const ws = wsRef.current;
+    if (!ws || ws.readyState !== WebSocket.OPEN) return;
+
+    const ids: number[] = items.map((item: { id: number }) => item.id);
+    const stale = subscribedRef.current.filter((id) => !ids.includes(id));
+    if (stale.length > 0) {
+      ws.send(JSON.stringify({ type: 'unsubscribe', data: { item_ids: stale } }));
+    }
+    if (ids.length > 0) {
+      ws.send(JSON.stringify({ type: 'subscribe', data: { item_ids: ids } }));
+    }
+    subscribedRef.current = ids;
+  };
+
+  useEffect(() => {
+    syncSubscriptions();
+  }, [items]);
+
   const loadMarketData = () => {
     dispatch(fetchMarketItems({
       page: currentPage,
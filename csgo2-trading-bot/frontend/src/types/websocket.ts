@@ -0,0 +1,124 @@
+// Code generated by backend/cmd/wstypes. DO NOT EDIT.
+
+export const WS_SCHEMA_VERSION = 1;
+
+export interface WSEnvelope {
+  type: string;
+  schema?: number;
+  seq?: number;
+  data: unknown;
+}
+
+export interface PriceUpdateV1 {
+  item_id: number;
+  price: number;
+  platform: string;
+  time: string;
+}
+
+export interface PriceUpdateMessage extends WSEnvelope {
+  type: 'price_update';
+  data: PriceUpdateV1;
+}
+
+export interface OrderV1 {
+  id: number;
+  user_id: number;
+  item_id: number;
+  type: string;
+  status: string;
+  price: number;
+  quantity: number;
+  filled_quantity: number;
+  platform: string;
+  strategy_id?: number | null;
+  parent_id?: number | null;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface OrderUpdateV1 {
+  type: string;
+  order: OrderV1;
+  time: string;
+}
+
+export interface OrderUpdateMessage extends WSEnvelope {
+  type: 'order_update';
+  data: OrderUpdateV1;
+}
+
+export interface NotificationV1 {
+  id: number;
+  user_id: number;
+  type: string;
+  title: string;
+  message: string;
+  priority: string;
+  read: boolean;
+  data?: unknown;
+  created_at: string;
+}
+
+export interface NotificationMessage extends WSEnvelope {
+  type: 'notification';
+  data: NotificationV1;
+}
+
+export interface StrategyEventV1 {
+  event: string;
+  data: Record<string, unknown>;
+  time: string;
+}
+
+export interface StrategyEventMessage extends WSEnvelope {
+  type: 'strategy_event';
+  data: StrategyEventV1;
+}
+
+export interface MarketUpdateMessage extends WSEnvelope {
+  type: 'market_update';
+  data: unknown;
+}
+
+export interface SubscriptionV1 {
+  item_ids: number[];
+}
+
+export interface SubscribedMessage extends WSEnvelope {
+  type: 'subscribed';
+  data: SubscriptionV1;
+}
+
+export interface UnsubscribedMessage extends WSEnvelope {
+  type: 'unsubscribed';
+  data: SubscriptionV1;
+}
+
+export interface PongMessage extends WSEnvelope {
+  type: 'pong';
+  data: number;
+}
+
+export interface ResumeV1 {
+  from: number;
+  to: number;
+  replayed: number;
+  complete: boolean;
+}
+
+export interface ResumedMessage extends WSEnvelope {
+  type: 'resumed';
+  data: ResumeV1;
+}
+
+export type WSMessage =
+  | PriceUpdateMessage
+  | OrderUpdateMessage
+  | NotificationMessage
+  | StrategyEventMessage
+  | MarketUpdateMessage
+  | SubscribedMessage
+  | UnsubscribedMessage
+  | PongMessage
+  | ResumedMessage;